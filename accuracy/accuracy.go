@@ -0,0 +1,250 @@
+// Package accuracy evaluates PMU performance per IEEE C37.118.1 by comparing
+// a measured stream with a reference stream of the same layout, such as the
+// ground truth of a simulator: the total vector error (TVE) of every phasor
+// and the frequency and ROCOF errors (FE, RFE) of every station
+package accuracy
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// TVE returns the total vector error of a measured phasor as a fraction of
+// the reference, e.g. 0.01 for 1 %
+func TVE(measured, reference complex128) float64 {
+	return cmplx.Abs(measured-reference) / cmplx.Abs(reference)
+}
+
+// FE returns the frequency error in Hz
+func FE(measured, reference float64) float64 {
+	return math.Abs(measured - reference)
+}
+
+// RFE returns the ROCOF error in Hz/s
+func RFE(measured, reference float64) float64 {
+	return math.Abs(measured - reference)
+}
+
+// Options configures an Evaluator. The limits default to the steady-state
+// limits of C37.118.1a for P class PMUs.
+type Options struct {
+	// TVE limit as a fraction, defaults to 0.01
+	TVE float64
+	// FE limit in Hz, defaults to 0.005
+	FE float64
+	// RFE limit in Hz/s, defaults to 0.4
+	RFE float64
+	// Pending is the number of sets of each stream kept for matching,
+	// defaults to 256. Older sets are dropped as unmatched.
+	Pending int
+}
+
+// Result holds the errors of a channel: the TVE of "Sub 1.<phasor>", the FE
+// of "Sub 1.freq" or the RFE of "Sub 1.rocof"
+type Result struct {
+	Channel string
+	// Count is the number of compared samples
+	Count uint64
+	Max   float64
+	Mean  float64
+	// Exceeded is the number of samples above the limit
+	Exceeded uint64
+	// MaxTime is the time of the maximum error
+	MaxTime time.Time
+}
+
+// channel accumulates the errors of a channel
+type channel struct {
+	limit float64
+	sum   float64
+	Result
+}
+
+// add records an error at time t
+func (c *channel) add(err float64, t int64) {
+	if math.IsNaN(err) || math.IsInf(err, 0) {
+		return
+	}
+	c.Count++
+	c.sum += err
+	if err > c.limit {
+		c.Exceeded++
+	}
+	if c.Count == 1 || err > c.Max {
+		c.Max = err
+		c.MaxTime = time.Unix(0, t).UTC()
+	}
+}
+
+// Evaluator compares a measured stream with a reference stream, matching the
+// sets by timestamp. It is safe for concurrent use, so both streams may be
+// written from their own goroutines.
+type Evaluator struct {
+	opts Options
+	mu   sync.Mutex
+	cfg  *synchrophasor.ConfigFrame
+	// channels holds per station the FE, RFE and phasor channels
+	channels           [][]channel
+	measured, ref      pending
+	matched, unmatched uint64
+}
+
+// pending are the unmatched sets of a stream by time
+type pending struct {
+	sets  map[int64]*synchrophasor.Measurements
+	order []int64
+}
+
+// New creates an evaluator for streams of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) *Evaluator {
+	if opts.TVE <= 0 {
+		opts.TVE = 0.01
+	}
+	if opts.FE <= 0 {
+		opts.FE = 0.005
+	}
+	if opts.RFE <= 0 {
+		opts.RFE = 0.4
+	}
+	if opts.Pending <= 0 {
+		opts.Pending = 256
+	}
+	e := &Evaluator{opts: opts}
+	e.setConfig(cfg)
+	return e
+}
+
+// SetConfig replaces the configuration, discarding the pending sets and the
+// results
+func (e *Evaluator) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.setConfig(cfg)
+}
+
+// setConfig resets the evaluator for cfg, e.mu must be held
+func (e *Evaluator) setConfig(cfg *synchrophasor.ConfigFrame) {
+	e.cfg = cfg
+	e.channels = make([][]channel, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN) + "."
+		chans := []channel{
+			{limit: e.opts.FE, Result: Result{Channel: stn + "freq"}},
+			{limit: e.opts.RFE, Result: Result{Channel: stn + "rocof"}},
+		}
+		for _, name := range pmu.CHNAMPhasor {
+			chans = append(chans, channel{limit: e.opts.TVE, Result: Result{Channel: stn + strings.TrimSpace(name)}})
+		}
+		e.channels[i] = chans
+	}
+	e.measured = pending{sets: make(map[int64]*synchrophasor.Measurements)}
+	e.ref = pending{sets: make(map[int64]*synchrophasor.Measurements)}
+	e.matched, e.unmatched = 0, 0
+}
+
+// WriteMeasured adds a set of the measured stream
+func (e *Evaluator) WriteMeasured(m *synchrophasor.Measurements) error {
+	return e.write(m, true)
+}
+
+// WriteReference adds a set of the reference stream
+func (e *Evaluator) WriteReference(m *synchrophasor.Measurements) error {
+	return e.write(m, false)
+}
+
+// write compares m with the set of the other stream at its time, if present,
+// and keeps it pending otherwise
+func (e *Evaluator) write(m *synchrophasor.Measurements, measured bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(m.Stations) != len(e.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(e.cfg.PMUStationList))
+	}
+	for i, pmu := range e.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	own, other := &e.measured, &e.ref
+	if !measured {
+		own, other = other, own
+	}
+	t := m.UnixNano()
+	match, ok := other.sets[t]
+	if !ok {
+		if _, ok := own.sets[t]; !ok {
+			own.order = append(own.order, t)
+		}
+		own.sets[t] = m.Clone()
+		for len(own.order) > e.opts.Pending {
+			delete(own.sets, own.order[0])
+			own.order = own.order[1:]
+			e.unmatched++
+		}
+		return nil
+	}
+
+	delete(other.sets, t)
+	for i, pt := range other.order {
+		if pt == t {
+			other.order = append(other.order[:i], other.order[i+1:]...)
+			break
+		}
+	}
+	if measured {
+		e.compare(m, match, t)
+	} else {
+		e.compare(match, m, t)
+	}
+	return nil
+}
+
+// compare records the errors of a measured set against its reference
+func (e *Evaluator) compare(m, ref *synchrophasor.Measurements, t int64) {
+	e.matched++
+	for i, chans := range e.channels {
+		ms, rs := &m.Stations[i], &ref.Stations[i]
+		if ms.Stat&synchrophasor.StatDataError != 0 || rs.Stat&synchrophasor.StatDataError != 0 {
+			continue
+		}
+		chans[0].add(FE(float64(ms.Frequency), float64(rs.Frequency)), t)
+		chans[1].add(RFE(float64(ms.ROCOF), float64(rs.ROCOF)), t)
+		for j := range ms.Phasors {
+			chans[2+j].add(TVE(ms.Phasors[j], rs.Phasors[j]), t)
+		}
+	}
+}
+
+// Results returns the errors of all channels in configuration order
+func (e *Evaluator) Results() []Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var results []Result
+	for _, chans := range e.channels {
+		for _, c := range chans {
+			r := c.Result
+			if r.Count > 0 {
+				r.Mean = c.sum / float64(r.Count)
+			}
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// Matched returns the number of compared sets and of sets dropped without a
+// counterpart in the other stream
+func (e *Evaluator) Matched() (matched, unmatched uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.matched, e.unmatched
+}
@@ -0,0 +1,76 @@
+package accuracy
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 1, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second
+func set(cfg *synchrophasor.ConfigFrame, i int, va complex128, freq, rocof float32) *synchrophasor.Measurements {
+	sub := cfg.PMUStationList[0]
+	sub.PhasorValues[0] = va
+	sub.Freq = freq
+	sub.DFreq = rocof
+	return testutil.Measurements(cfg, i)
+}
+
+func TestErrors(t *testing.T) {
+	require.InDelta(t, 0.01, TVE(101, 100), 1e-12)
+	// A phase error of 0.573 degrees is about 1 % TVE
+	require.InDelta(t, 0.01, TVE(cmplx.Rect(100, 0.573*math.Pi/180), 100), 1e-4)
+	require.InDelta(t, 0.002, FE(50.002, 50), 1e-9)
+	require.InDelta(t, 0.1, RFE(-0.05, 0.05), 1e-9)
+}
+
+func TestEvaluator(t *testing.T) {
+	cfg := testConfig()
+	e := New(cfg, Options{Pending: 4})
+
+	// The reference runs ahead of the measured stream
+	for i := 0; i < 5; i++ {
+		require.NoError(t, e.WriteReference(set(cfg, i, 100, 50, 0)))
+	}
+	require.NoError(t, e.WriteMeasured(set(cfg, 1, 100.5, 50.001, 0.1)))
+	require.NoError(t, e.WriteMeasured(set(cfg, 2, 102, 50.01, -0.5)))
+	// Frame 5 arrives measured first, frame 0 was dropped as unmatched
+	require.NoError(t, e.WriteMeasured(set(cfg, 5, 100, 50, 0)))
+	require.NoError(t, e.WriteReference(set(cfg, 5, 100, 50, 0)))
+	invalid := set(cfg, 3, 0, 0, 0)
+	invalid.Stations[0].Stat = 0x8000
+	require.NoError(t, e.WriteMeasured(invalid))
+
+	matched, unmatched := e.Matched()
+	require.Equal(t, uint64(4), matched)
+	require.Equal(t, uint64(1), unmatched)
+
+	results := e.Results()
+	require.Len(t, results, 3)
+	fe, rfe, tve := results[0], results[1], results[2]
+	require.Equal(t, "Sub 1.freq", fe.Channel)
+	require.Equal(t, uint64(3), fe.Count)
+	require.InDelta(t, 0.01, fe.Max, 1e-5)
+	require.Equal(t, uint64(1), fe.Exceeded)
+	require.Equal(t, "Sub 1.rocof", rfe.Channel)
+	require.Equal(t, uint64(1), rfe.Exceeded)
+	require.Equal(t, "Sub 1.VA", tve.Channel)
+	require.InDelta(t, 0.02, tve.Max, 1e-9)
+	require.InDelta(t, (0.005+0.02)/3, tve.Mean, 1e-9)
+	require.Equal(t, uint64(1), tve.Exceeded)
+	require.Equal(t, time.Unix(1700000000, 200000000).UTC(), tve.MaxTime)
+
+	require.ErrorIs(t, e.WriteMeasured(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+	e.SetConfig(cfg)
+	require.Zero(t, e.Results()[0].Count)
+}
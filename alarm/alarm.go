@@ -0,0 +1,299 @@
+// Package alarm raises and clears events when measurement channels cross
+// configured limits, such as frequency, ROCOF, voltage magnitude, angle
+// differences between stations or digital status bits, with hysteresis and
+// dwell times against chattering
+package alarm
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Condition selects when a rule is violated
+type Condition uint8
+
+const (
+	// Above is violated while the value exceeds the limit
+	Above Condition = iota
+	// Below is violated while the value falls short of the limit
+	Below
+	// Outside is violated while the absolute value exceeds the limit, e.g.
+	// for ROCOF or angle differences
+	Outside
+)
+
+// Rule monitors a channel
+type Rule struct {
+	// Name identifies the rule in events and stats, defaults to the channel
+	Name string
+	// Channel is named as by ConfigFrame.Channels, e.g. "Sub 1.freq",
+	// "Sub 1.<phasor>.mag" or "Sub 1.<digital>". Digital channels are 1
+	// while set, so a rule Above 0.5 is violated while the bit is set.
+	Channel string
+	// Reference makes the rule monitor Channel minus Reference, wrapped to
+	// ±180 degrees for angles, e.g. "Sub 2.VA.ang"
+	Reference string
+	Condition Condition
+	Limit     float64
+	// Hysteresis is the margin within the limit the value must return by to
+	// clear the event
+	Hysteresis float64
+	// Dwell is how long the rule must be violated before the event is raised
+	Dwell time.Duration
+}
+
+// Event reports a rule raised or cleared
+type Event struct {
+	Rule    string
+	Channel string
+	// Raised is true when the rule was raised and false when it cleared
+	Raised bool
+	// Time is the measurement time of the change
+	Time time.Time
+	// Since is the time the violation started
+	Since time.Time
+	// Value is the monitored value at Time
+	Value float64
+}
+
+// Options configures an Engine
+type Options struct {
+	// OnEvent is called with every raised and cleared event from Write
+	OnEvent func(e Event)
+}
+
+// Stats counts the events by rule
+type Stats struct {
+	Raised  map[string]uint64
+	Cleared map[string]uint64
+	// Skipped counts the evaluations skipped for invalid data
+	Skipped uint64
+}
+
+// rule is a Rule with its state
+type rule struct {
+	Rule
+	channel, reference synchrophasor.ChannelRef
+	hasReference       bool
+	// pending is the start of the current violation, zero if none, and
+	// raised whether its event was raised at raisedAt
+	pending           int64
+	raised            bool
+	raisedAt          int64
+	value             float64
+	raisedN, clearedN uint64
+}
+
+// Engine evaluates rules on a stream of measurement sets. Write must be called
+// from a single goroutine, Active and Stats may be called concurrently.
+type Engine struct {
+	opts    Options
+	mu      sync.Mutex
+	rules   []*rule
+	skipped uint64
+}
+
+// New creates an engine for measurements of the given configuration. Rules
+// on channels not in the configuration are rejected.
+func New(cfg *synchrophasor.ConfigFrame, rules []Rule, opts Options) (*Engine, error) {
+	e := &Engine{opts: opts}
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.Name == "" {
+			r.Name = r.Channel
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("%w: duplicate rule %q", synchrophasor.ErrInvalidParameter, r.Name)
+		}
+		names[r.Name] = true
+		e.rules = append(e.rules, &rule{Rule: r})
+	}
+	if err := e.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetConfig replaces the configuration, keeping the state of the rules
+func (e *Engine) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.setConfig(cfg)
+}
+
+// setConfig resolves the channels of the rules in cfg, e.mu must be held
+func (e *Engine) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	chans := cfg.Channels()
+	refs := make([][2]synchrophasor.ChannelRef, len(e.rules))
+	for i, r := range e.rules {
+		ref, ok := chans[r.Channel]
+		if !ok {
+			return fmt.Errorf("%w: rule %q: unknown channel %q", synchrophasor.ErrInvalidParameter, r.Name, r.Channel)
+		}
+		refs[i][0] = ref
+		if r.Reference == "" {
+			continue
+		}
+		if refs[i][1], ok = chans[r.Reference]; !ok {
+			return fmt.Errorf("%w: rule %q: unknown channel %q", synchrophasor.ErrInvalidParameter, r.Name, r.Reference)
+		}
+	}
+	for i, r := range e.rules {
+		r.channel, r.reference, r.hasReference = refs[i][0], refs[i][1], r.Reference != ""
+	}
+	return nil
+}
+
+// Write evaluates the rules on a measurement set, calling OnEvent for the
+// rules raised or cleared by it. The stations of m must match the
+// configuration.
+func (e *Engine) Write(m *synchrophasor.Measurements) error {
+	t := m.UnixNano()
+	var events []Event
+	e.mu.Lock()
+	for _, r := range e.rules {
+		v, ok, err := r.evaluate(m)
+		if err != nil {
+			e.mu.Unlock()
+			return err
+		}
+		if !ok {
+			e.skipped++
+			continue
+		}
+		if ev, changed := r.update(t, v); changed {
+			events = append(events, ev)
+		}
+	}
+	e.mu.Unlock()
+
+	if e.opts.OnEvent != nil {
+		for _, ev := range events {
+			e.opts.OnEvent(ev)
+		}
+	}
+	return nil
+}
+
+// evaluate returns the monitored value of a rule, false if it is invalid
+func (r *rule) evaluate(m *synchrophasor.Measurements) (float64, bool, error) {
+	v, ok, err := lookup(m, r.channel)
+	if err != nil || !ok || !r.hasReference {
+		return v, ok, err
+	}
+	ref, ok, err := lookup(m, r.reference)
+	if err != nil || !ok {
+		return 0, ok, err
+	}
+	v -= ref
+	if r.channel.Kind == synchrophasor.ChannelAngle && r.reference.Kind == synchrophasor.ChannelAngle {
+		v = math.Remainder(v, 360)
+	}
+	return v, true, nil
+}
+
+// update advances the state of a rule with the value at time t, returning the
+// event if the rule was raised or cleared
+func (r *rule) update(t int64, v float64) (Event, bool) {
+	r.value = v
+	if !r.raised {
+		if !r.violated(v, 0) {
+			r.pending = 0
+			return Event{}, false
+		}
+		if r.pending == 0 {
+			r.pending = t
+		}
+		if t-r.pending < int64(r.Dwell) {
+			return Event{}, false
+		}
+		r.raised, r.raisedAt = true, t
+		r.raisedN++
+		return r.event(t, true), true
+	}
+
+	if r.violated(v, r.Hysteresis) {
+		return Event{}, false
+	}
+	r.raised = false
+	r.clearedN++
+	ev := r.event(t, false)
+	r.pending = 0
+	return ev, true
+}
+
+// violated reports whether v violates the limit moved inwards by margin
+func (r *rule) violated(v, margin float64) bool {
+	switch r.Condition {
+	case Below:
+		return v < r.Limit+margin
+	case Outside:
+		return math.Abs(v) > r.Limit-margin
+	}
+	return v > r.Limit-margin
+}
+
+// event returns the event of the rule at time t
+func (r *rule) event(t int64, raised bool) Event {
+	return Event{
+		Rule:    r.Name,
+		Channel: r.Channel,
+		Raised:  raised,
+		Time:    time.Unix(0, t).UTC(),
+		Since:   time.Unix(0, r.pending).UTC(),
+		Value:   r.value,
+	}
+}
+
+// Active returns the events of the rules currently raised, with the latest
+// value of each
+func (e *Engine) Active() []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var active []Event
+	for _, r := range e.rules {
+		if r.raised {
+			active = append(active, r.event(r.raisedAt, true))
+		}
+	}
+	return active
+}
+
+// Stats returns the event counters
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Stats{
+		Raised:  make(map[string]uint64, len(e.rules)),
+		Cleared: make(map[string]uint64, len(e.rules)),
+		Skipped: e.skipped,
+	}
+	for _, r := range e.rules {
+		s.Raised[r.Name] = r.raisedN
+		s.Cleared[r.Name] = r.clearedN
+	}
+	return s
+}
+
+// lookup returns a channel value of a measurement set, false if the station
+// flags a data error or the value is NaN
+func lookup(m *synchrophasor.Measurements, ref synchrophasor.ChannelRef) (float64, bool, error) {
+	if ref.Station >= len(m.Stations) {
+		return 0, false, fmt.Errorf("%w: station %d not in the measurement set",
+			synchrophasor.ErrInvalidParameter, ref.Station)
+	}
+	st := &m.Stations[ref.Station]
+	if st.Stat&synchrophasor.StatDataError != 0 {
+		return 0, false, nil
+	}
+	v, ok := ref.Value(st)
+	if !ok {
+		return 0, false, fmt.Errorf("%w: station %d does not match the configuration",
+			synchrophasor.ErrInvalidParameter, ref.Station)
+	}
+	return v, !math.IsNaN(v), nil
+}
@@ -0,0 +1,94 @@
+package alarm
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// frequency of Sub 1, its VA angle against Sub 2 in degrees and its breaker
+func set(cfg *synchrophasor.ConfigFrame, i int, freq, angle float64, brk bool) *synchrophasor.Measurements {
+	sub := cfg.PMUStationList[0]
+	sub.Freq = float32(freq)
+	sub.PhasorValues[0] = cmplx.Rect(1, (170+angle)*math.Pi/180)
+	sub.DigitalValues[0][0] = brk
+	cfg.PMUStationList[1].PhasorValues[0] = cmplx.Rect(1, 170*math.Pi/180)
+	return testutil.Measurements(cfg, i)
+}
+
+func TestEngine(t *testing.T) {
+	cfg := testConfig()
+	var events []Event
+	e, err := New(cfg, []Rule{
+		{Name: "underfrequency", Channel: "Sub 1.freq", Condition: Below, Limit: 49.8, Hysteresis: 0.05,
+			Dwell: 200 * time.Millisecond},
+		{Name: "angle", Channel: "Sub 1.VA.ang", Reference: "Sub 2.VA.ang", Condition: Outside, Limit: 30},
+		{Channel: "Sub 1.BRK1", Condition: Above, Limit: 0.5},
+	}, Options{OnEvent: func(ev Event) { events = append(events, ev) }})
+	require.NoError(t, err)
+
+	freqs := []float64{50, 49.7, 49.7, 49.9, 49.7, 49.7, 49.7, 49.83, 49.86, 50}
+	for i, freq := range freqs {
+		require.NoError(t, e.Write(set(cfg, i, freq, 0, false)))
+	}
+	// The dip at frame 1 is shorter than the dwell time, the one from frame 4
+	// is raised at frame 6 and cleared at frame 8 beyond the hysteresis
+	require.Len(t, events, 2)
+	require.Equal(t, "underfrequency", events[0].Rule)
+	require.True(t, events[0].Raised)
+	require.Equal(t, time.Unix(1700000000, 600000000).UTC(), events[0].Time)
+	require.Equal(t, time.Unix(1700000000, 400000000).UTC(), events[0].Since)
+	require.InDelta(t, 49.7, events[0].Value, 1e-5)
+	require.False(t, events[1].Raised)
+	require.Equal(t, time.Unix(1700000000, 800000000).UTC(), events[1].Time)
+
+	// The angle difference wraps around 180 degrees
+	events = events[:0]
+	require.NoError(t, e.Write(set(cfg, 10, 50, 35, true)))
+	require.Len(t, events, 2)
+	require.Equal(t, "angle", events[0].Rule)
+	require.InDelta(t, 35, events[0].Value, 1e-9)
+	require.Equal(t, "Sub 1.BRK1", events[1].Rule)
+	require.Len(t, e.Active(), 2)
+
+	// Invalid data is not evaluated
+	events = events[:0]
+	m := set(cfg, 11, 50, 0, false)
+	m.Stations[0].Stat = 0x8000
+	require.NoError(t, e.Write(m))
+	require.Empty(t, events)
+	require.NoError(t, e.Write(set(cfg, 12, 50, -20, false)))
+	require.Len(t, events, 2)
+	require.Empty(t, e.Active())
+
+	stats := e.Stats()
+	require.Equal(t, uint64(1), stats.Raised["underfrequency"])
+	require.Equal(t, uint64(1), stats.Cleared["angle"])
+	require.Equal(t, uint64(3), stats.Skipped)
+
+	require.ErrorIs(t, e.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+	require.NoError(t, e.SetConfig(cfg))
+}
+
+func TestNew(t *testing.T) {
+	cfg := testConfig()
+	_, err := New(cfg, []Rule{{Channel: "Sub 3.freq"}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, []Rule{{Channel: "Sub 1.freq", Reference: "Sub 1.VB.ang"}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, []Rule{{Channel: "Sub 1.freq"}, {Channel: "Sub 1.freq"}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
@@ -0,0 +1,266 @@
+// Package anglediff monitors phase angle differences between stations, a
+// core WAMS indicator of power flow stress: pairwise or against a reference
+// phasor, with per-pair statistics and limits, and appends the differences to
+// the stream as analog channels that can be republished or exported
+package anglediff
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Pair configures the angle difference A - B
+type Pair struct {
+	// Name is the derived analog channel, at most 16 characters, defaulting
+	// to the station names "Sub 1-Sub 2", or the phasor names for phasors of
+	// the same station
+	Name string
+	// A and B are phasors named "Sub 1.VA"
+	A, B string
+	// Limit in degrees of the absolute difference, defaults to Options.Limit
+	Limit float64
+}
+
+// Options configures a Monitor
+type Options struct {
+	// Pairs lists the differences monitored. Without pairs, the first phasor
+	// of every station is paired with Reference, or with the first phasor of
+	// every other station if Reference is empty.
+	Pairs     []Pair
+	Reference string
+	// Limit in degrees of pairs without a limit of their own, zero for none
+	Limit float64
+	// IDCode of the derived stream, zero keeps the ID code of the
+	// configuration
+	IDCode uint16
+}
+
+// Stats summarizes the differences of a pair in degrees
+type Stats struct {
+	Pair  string
+	Count uint64
+	// Last is the latest difference, NaN if it was invalid
+	Last           float64
+	Min, Max, Mean float64
+	// Exceeded counts the differences beyond the limit and Violated is true
+	// while the latest one is
+	Exceeded uint64
+	Violated bool
+	// MaxTime is the time of the largest absolute difference
+	MaxTime time.Time
+}
+
+// pair is a resolved Pair with its statistics
+type pair struct {
+	a, b  synchrophasor.PhasorRef
+	limit float64
+	sum   float64
+	peak  float64
+	Stats
+}
+
+// Monitor computes the angle differences of measurement sets. Write must be
+// called from a single goroutine, Stats may be called concurrently.
+type Monitor struct {
+	opts  Options
+	mu    sync.Mutex
+	cfg   *synchrophasor.ConfigFrame
+	out   *synchrophasor.DerivedStream
+	pairs []*pair
+	set   synchrophasor.Measurements
+}
+
+// New creates a monitor for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Monitor, error) {
+	m := &Monitor{opts: opts}
+	if err := m.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SetConfig replaces the configuration, keeping the statistics of the pairs
+// that are still present
+func (m *Monitor) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setConfig(cfg)
+}
+
+// setConfig resolves the pairs in cfg and builds the derived configuration,
+// m.mu must be held
+func (m *Monitor) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	var firsts []string
+	for _, ref := range cfg.Phasors() {
+		if ref.Index == 0 {
+			firsts = append(firsts, ref.Name)
+		}
+	}
+
+	specs := m.opts.Pairs
+	if len(specs) == 0 {
+		for i, a := range firsts {
+			if m.opts.Reference != "" {
+				if a != m.opts.Reference {
+					specs = append(specs, Pair{A: a, B: m.opts.Reference})
+				}
+				continue
+			}
+			for _, b := range firsts[i+1:] {
+				specs = append(specs, Pair{A: a, B: b})
+			}
+		}
+	}
+
+	out := synchrophasor.NewDerivedStream(cfg, m.opts.IDCode)
+	old := make(map[string]*pair, len(m.pairs))
+	for _, p := range m.pairs {
+		old[p.Pair] = p
+	}
+	pairs := make([]*pair, len(specs))
+	names := make(map[string]bool, len(specs))
+	for i, spec := range specs {
+		a, ok := cfg.FindPhasor(spec.A)
+		if !ok {
+			return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, spec.A)
+		}
+		b, ok := cfg.FindPhasor(spec.B)
+		if !ok {
+			return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, spec.B)
+		}
+		name := spec.Name
+		if name == "" {
+			name = defaultName(spec.A, spec.B)
+		}
+		if len(name) > 16 || names[name] {
+			return fmt.Errorf("%w: pair name %q longer than 16 characters or duplicate",
+				synchrophasor.ErrInvalidParameter, name)
+		}
+		names[name] = true
+		limit := spec.Limit
+		if limit <= 0 {
+			limit = m.opts.Limit
+		}
+
+		p, ok := old[name]
+		if !ok {
+			p = &pair{Stats: Stats{Pair: name, Last: math.NaN()}}
+		}
+		p.a, p.b, p.limit = a, b, limit
+		pairs[i] = p
+
+		out.AddAnalog(a.Station, name)
+	}
+
+	m.cfg, m.out, m.pairs = cfg, out, pairs
+	return nil
+}
+
+// defaultName names the pair of the phasors a and b after their stations, or
+// their phasors if they belong to the same station
+func defaultName(a, b string) string {
+	stnA, phA, _ := strings.Cut(a, ".")
+	stnB, phB, _ := strings.Cut(b, ".")
+	if stnA == stnB {
+		return phA + "-" + phB
+	}
+	return stnA + "-" + stnB
+}
+
+// Config returns the configuration extended by the difference channels
+func (m *Monitor) Config() *synchrophasor.ConfigFrame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.out.Config
+}
+
+// Write updates the statistics with the differences of a measurement set and
+// calls fn, unless nil, with m extended by the difference channels. Stations
+// receiving them are flagged as modified, and differences of invalid phasors
+// are NaN. The set passed to fn is only valid during the call and m is not
+// modified.
+func (m *Monitor) Write(ms *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	m.mu.Lock()
+	if len(ms.Stations) != len(m.cfg.PMUStationList) {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(ms.Stations), len(m.cfg.PMUStationList))
+	}
+	for i, pmu := range m.cfg.PMUStationList {
+		if st := &ms.Stations[i]; len(st.Phasors) != len(pmu.PhasorValues) || len(st.Analog) != len(pmu.AnalogValues) {
+			m.mu.Unlock()
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	m.out.CopyTo(ms, &m.set)
+	t := ms.UnixNano()
+	for _, p := range m.pairs {
+		d := difference(ms, p.a, p.b)
+		p.add(d, t)
+		st := &m.set.Stations[p.a.Station]
+		st.Analog = append(st.Analog, float32(d))
+	}
+	m.mu.Unlock()
+
+	if fn == nil {
+		return nil
+	}
+	return fn(&m.set)
+}
+
+// difference returns the angle of phasor a minus phasor b in degrees, wrapped
+// to ±180, or NaN if either is invalid
+func difference(m *synchrophasor.Measurements, a, b synchrophasor.PhasorRef) float64 {
+	stA, stB := &m.Stations[a.Station], &m.Stations[b.Station]
+	pa, pb := stA.Phasors[a.Index], stB.Phasors[b.Index]
+	if stA.Stat&synchrophasor.StatDataError != 0 || stB.Stat&synchrophasor.StatDataError != 0 ||
+		cmplx.IsNaN(pa) || cmplx.IsNaN(pb) || pa == 0 || pb == 0 {
+		return math.NaN()
+	}
+	return math.Remainder((cmplx.Phase(pa)-cmplx.Phase(pb))*180/math.Pi, 360)
+}
+
+// add records the difference d at time t
+func (p *pair) add(d float64, t int64) {
+	p.Last = d
+	if math.IsNaN(d) {
+		p.Violated = false
+		return
+	}
+	p.Count++
+	p.sum += d
+	if p.Count == 1 {
+		p.Min, p.Max = d, d
+	}
+	p.Min, p.Max = min(p.Min, d), max(p.Max, d)
+	if abs := math.Abs(d); p.Count == 1 || abs > p.peak {
+		p.peak, p.MaxTime = abs, time.Unix(0, t).UTC()
+	}
+	p.Violated = p.limit > 0 && math.Abs(d) > p.limit
+	if p.Violated {
+		p.Exceeded++
+	}
+}
+
+// Stats returns the statistics of the pairs in configuration order. The mean
+// is the plain mean of the wrapped differences, meaningful for pairs that do
+// not swing across ±180 degrees.
+func (m *Monitor) Stats() []Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make([]Stats, len(m.pairs))
+	for i, p := range m.pairs {
+		stats[i] = p.Stats
+		if p.Count > 0 {
+			stats[i].Mean = p.sum / float64(p.Count)
+		}
+	}
+	return stats
+}
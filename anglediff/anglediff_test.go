@@ -0,0 +1,114 @@
+package anglediff
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := testutil.NewConfig(10, 3, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("VB", 1, synchrophasor.PhunitVoltage)
+	})
+	cfg.IDCode = 7
+	return cfg
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// VA angles of the stations in degrees
+func set(cfg *synchrophasor.ConfigFrame, i int, angles ...float64) *synchrophasor.Measurements {
+	for j, pmu := range cfg.PMUStationList {
+		pmu.PhasorValues[0] = cmplx.Rect(230, angles[j]*math.Pi/180)
+		pmu.PhasorValues[1] = cmplx.Rect(230, (angles[j]-120)*math.Pi/180)
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+func TestMonitor(t *testing.T) {
+	cfg := testConfig()
+	m, err := New(cfg, Options{Reference: "Sub 1.VA", Limit: 30, IDCode: 70})
+	require.NoError(t, err)
+
+	out := m.Config()
+	require.Equal(t, uint16(70), out.IDCode)
+	require.Empty(t, cfg.PMUStationList[1].CHNAMAnalog)
+	require.Equal(t, "Sub 2-Sub 1", strings.TrimSpace(out.PMUStationList[1].CHNAMAnalog[0]))
+	require.Equal(t, "Sub 3-Sub 1", strings.TrimSpace(out.PMUStationList[2].CHNAMAnalog[0]))
+	require.Equal(t, uint16(0x04), out.PMUStationList[2].Format&0x04)
+
+	var got *synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		got = m
+		return nil
+	}
+	require.NoError(t, m.Write(set(cfg, 0, 170, -170, 100), keep))
+	require.Equal(t, uint16(70), got.PMUID)
+	require.Equal(t, uint16(0), got.Stations[0].Stat)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), got.Stations[1].Stat)
+	require.InDelta(t, 20, got.Stations[1].Analog[0], 1e-4)
+	require.InDelta(t, -70, got.Stations[2].Analog[0], 1e-4)
+
+	require.NoError(t, m.Write(set(cfg, 1, 0, 10, -20), nil))
+	invalid := set(cfg, 2, 0, 0, 0)
+	invalid.Stations[2].Stat = 0x8000
+	require.NoError(t, m.Write(invalid, keep))
+	require.True(t, math.IsNaN(float64(got.Stations[2].Analog[0])))
+
+	stats := m.Stats()
+	require.Len(t, stats, 2)
+	require.Equal(t, "Sub 2-Sub 1", stats[0].Pair)
+	require.Equal(t, uint64(3), stats[0].Count)
+	require.InDelta(t, 0, stats[0].Min, 1e-9)
+	require.InDelta(t, 20, stats[0].Max, 1e-9)
+	require.InDelta(t, 10, stats[0].Mean, 1e-9)
+	require.Zero(t, stats[0].Exceeded)
+	require.InDelta(t, 0, stats[0].Last, 1e-9)
+
+	require.Equal(t, uint64(2), stats[1].Count)
+	require.Equal(t, uint64(1), stats[1].Exceeded)
+	require.False(t, stats[1].Violated)
+	require.True(t, math.IsNaN(stats[1].Last))
+	require.InDelta(t, -70, stats[1].Min, 1e-9)
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), stats[1].MaxTime)
+
+	// Statistics of pairs still present survive a new configuration
+	require.NoError(t, m.SetConfig(cfg))
+	require.Equal(t, uint64(3), m.Stats()[0].Count)
+
+	require.ErrorIs(t, m.Write(&synchrophasor.Measurements{}, keep), synchrophasor.ErrInvalidParameter)
+}
+
+func TestPairs(t *testing.T) {
+	cfg := testConfig()
+	m, err := New(cfg, Options{})
+	require.NoError(t, err)
+	var names []string
+	for _, s := range m.Stats() {
+		names = append(names, s.Pair)
+	}
+	require.Equal(t, []string{"Sub 1-Sub 2", "Sub 1-Sub 3", "Sub 2-Sub 3"}, names)
+
+	m, err = New(cfg, Options{Pairs: []Pair{{A: "Sub 1.VA", B: "Sub 1.VB", Limit: 100}}})
+	require.NoError(t, err)
+	require.NoError(t, m.Write(set(cfg, 0, 0, 0, 0), nil))
+	require.Equal(t, "VA-VB", m.Stats()[0].Pair)
+	require.InDelta(t, 120, m.Stats()[0].Last, 1e-9)
+	require.True(t, m.Stats()[0].Violated)
+
+	for _, opts := range []Options{
+		{Reference: "Sub 4.VA"},
+		{Pairs: []Pair{{A: "Sub 1.VA", B: "Sub 1.IA"}}},
+		{Pairs: []Pair{{Name: "Angle Sub 1 to Sub 2", A: "Sub 1.VA", B: "Sub 2.VA"}}},
+		{Pairs: []Pair{{A: "Sub 1.VA", B: "Sub 2.VA"}, {A: "Sub 1.VA", B: "Sub 2.VA"}}},
+	} {
+		_, err := New(cfg, opts)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+}
@@ -0,0 +1,192 @@
+// Package angleref derives relative-angle streams as shown on wide-area
+// displays: the phasors of all stations are rotated so that a reference
+// phasor, fixed or chosen automatically among candidates, is at zero degrees
+package angleref
+
+import (
+	"fmt"
+	"math/cmplx"
+	"sync"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// STAT bits of the relative-angle stream
+const (
+	// statAbsentData flags stations without a valid reference
+	statAbsentData = 0x8000
+)
+
+// Options configures a Referencer
+type Options struct {
+	// Reference is the reference phasor named "Sub 1.VA". If set, stations
+	// are flagged absent while it is invalid.
+	Reference string
+	// Candidates are the phasors chosen from automatically without a
+	// Reference, in order of preference, defaulting to the first phasor of
+	// every station. The reference only changes when it becomes invalid, to
+	// the first valid candidate.
+	Candidates []string
+	// IDCode of the relative-angle stream, zero keeps the ID code of the
+	// configuration
+	IDCode uint16
+}
+
+// Referencer rotates measurement sets to a reference phasor. Write must be
+// called from a single goroutine, Reference may be called concurrently.
+type Referencer struct {
+	opts       Options
+	mu         sync.Mutex
+	cfg        *synchrophasor.ConfigFrame
+	candidates []synchrophasor.PhasorRef
+	// current is the index of the reference among the candidates, -1 if
+	// none is valid
+	current int
+	out     synchrophasor.Measurements
+}
+
+// New creates a referencer for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Referencer, error) {
+	r := &Referencer{opts: opts}
+	if err := r.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SetConfig replaces the configuration, choosing the reference anew
+func (r *Referencer) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	var firsts []string
+	for _, ref := range cfg.Phasors() {
+		if ref.Index == 0 {
+			firsts = append(firsts, ref.Name)
+		}
+	}
+
+	names := r.opts.Candidates
+	switch {
+	case r.opts.Reference != "":
+		names = []string{r.opts.Reference}
+	case len(names) == 0:
+		names = firsts
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%w: no phasors to reference", synchrophasor.ErrInvalidParameter)
+	}
+	candidates := make([]synchrophasor.PhasorRef, len(names))
+	for i, name := range names {
+		ref, ok := cfg.FindPhasor(name)
+		if !ok {
+			return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		candidates[i] = ref
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg, r.candidates, r.current = cfg, candidates, -1
+	return nil
+}
+
+// Config returns the configuration of the relative-angle stream, a copy of
+// the input configuration with its own station values, e.g. for serving the
+// stream through downsample.NewOutput
+func (r *Referencer) Config() *synchrophasor.ConfigFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := *r.cfg
+	if r.opts.IDCode != 0 {
+		out.IDCode = r.opts.IDCode
+	}
+	out.PMUStationList = make([]*synchrophasor.PMUStation, len(r.cfg.PMUStationList))
+	for i, pmu := range r.cfg.PMUStationList {
+		p := *pmu
+		p.PhasorValues = make([]complex128, len(pmu.PhasorValues))
+		p.AnalogValues = make([]float32, len(pmu.AnalogValues))
+		p.DigitalValues = make([][]bool, len(pmu.DigitalValues))
+		for j, word := range pmu.DigitalValues {
+			p.DigitalValues[j] = make([]bool, len(word))
+		}
+		out.PMUStationList[i] = &p
+	}
+	return &out
+}
+
+// Reference returns the name of the current reference phasor, empty if none
+// is valid
+func (r *Referencer) Reference() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current < 0 {
+		return ""
+	}
+	return r.candidates[r.current].Name
+}
+
+// Write calls fn with m rotated to the reference phasor. The phasor angles
+// of all stations are relative to the reference, which is at zero degrees,
+// and the stations are flagged as modified, or as absent if no reference is
+// valid. The set passed to fn is only valid during the call and m is not
+// modified.
+func (r *Referencer) Write(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	r.mu.Lock()
+	if len(m.Stations) != len(r.cfg.PMUStationList) {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(r.cfg.PMUStationList))
+	}
+	for i, pmu := range r.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			r.mu.Unlock()
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+	if r.current < 0 || !valid(m, r.candidates[r.current]) {
+		r.current = -1
+		for i, c := range r.candidates {
+			if valid(m, c) {
+				r.current = i
+				break
+			}
+		}
+	}
+	var ref synchrophasor.PhasorRef
+	current := r.current
+	if current >= 0 {
+		ref = r.candidates[current]
+	}
+	r.mu.Unlock()
+
+	m.CopyTo(&r.out)
+	if r.opts.IDCode != 0 {
+		r.out.PMUID = r.opts.IDCode
+	}
+	if current < 0 {
+		for i := range r.out.Stations {
+			st := &r.out.Stations[i]
+			st.Stat |= statAbsentData | synchrophasor.StatDataModified
+			for j := range st.Phasors {
+				st.Phasors[j] = cmplx.NaN()
+			}
+		}
+		return fn(&r.out)
+	}
+
+	rot := cmplx.Rect(1, -cmplx.Phase(m.Stations[ref.Station].Phasors[ref.Index]))
+	for i := range r.out.Stations {
+		st := &r.out.Stations[i]
+		st.Stat |= synchrophasor.StatDataModified
+		for j := range st.Phasors {
+			st.Phasors[j] *= rot
+		}
+	}
+	return fn(&r.out)
+}
+
+// valid reports whether a phasor of m is usable as reference
+func valid(m *synchrophasor.Measurements, ref synchrophasor.PhasorRef) bool {
+	st := &m.Stations[ref.Station]
+	p := st.Phasors[ref.Index]
+	return st.Stat&synchrophasor.StatDataError == 0 && !cmplx.IsNaN(p) && !cmplx.IsInf(p) && cmplx.Abs(p) > 0
+}
@@ -0,0 +1,83 @@
+package angleref
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := testutil.NewConfig(10, 3, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+	})
+	cfg.IDCode = 7
+	return cfg
+}
+
+// set returns measurements with the VA angles of the stations in degrees and
+// the STAT of Sub 1
+func set(cfg *synchrophasor.ConfigFrame, stat uint16, angles ...float64) *synchrophasor.Measurements {
+	for i, pmu := range cfg.PMUStationList {
+		pmu.PhasorValues[0] = cmplx.Rect(230, angles[i]*math.Pi/180)
+		pmu.PhasorValues[1] = cmplx.Rect(10, (angles[i]-30)*math.Pi/180)
+	}
+	cfg.PMUStationList[0].Stat = stat
+	return testutil.Measurements(cfg, 0)
+}
+
+func angle(p complex128) float64 {
+	return cmplx.Phase(p) * 180 / math.Pi
+}
+
+func TestReferencer(t *testing.T) {
+	cfg := testConfig()
+	r, err := New(cfg, Options{IDCode: 70})
+	require.NoError(t, err)
+	require.Equal(t, uint16(70), r.Config().IDCode)
+	require.Equal(t, "", r.Reference())
+
+	var out *synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		out = m
+		return nil
+	}
+	in := set(cfg, 0, 170, -170, 100)
+	require.NoError(t, r.Write(in, keep))
+	require.Equal(t, "Sub 1.VA", r.Reference())
+	require.Equal(t, uint16(70), out.PMUID)
+	require.InDelta(t, 0, angle(out.Stations[0].Phasors[0]), 1e-9)
+	require.InDelta(t, -30, angle(out.Stations[0].Phasors[1]), 1e-9)
+	require.InDelta(t, 20, angle(out.Stations[1].Phasors[0]), 1e-9)
+	require.InDelta(t, -70, angle(out.Stations[2].Phasors[0]), 1e-9)
+	require.InDelta(t, 230, cmplx.Abs(out.Stations[2].Phasors[0]), 1e-9)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), out.Stations[1].Stat)
+	require.InDelta(t, 170, angle(in.Stations[0].Phasors[0]), 1e-9)
+
+	// The reference moves to the next valid candidate and stays there
+	require.NoError(t, r.Write(set(cfg, 0x4000, 170, -170, 100), keep))
+	require.Equal(t, "Sub 2.VA", r.Reference())
+	require.InDelta(t, -20, angle(out.Stations[0].Phasors[0]), 1e-9)
+	require.NoError(t, r.Write(set(cfg, 0, 170, -170, 100), keep))
+	require.Equal(t, "Sub 2.VA", r.Reference())
+
+	// A fixed reference is not replaced
+	r, err = New(cfg, Options{Reference: "Sub 3.IA"})
+	require.NoError(t, err)
+	require.NoError(t, r.Write(set(cfg, 0, 170, -170, 100), keep))
+	require.InDelta(t, 30, angle(out.Stations[2].Phasors[0]), 1e-9)
+	m := set(cfg, 0, 170, -170, 100)
+	m.Stations[2].Stat = 0x8000
+	require.NoError(t, r.Write(m, keep))
+	require.Equal(t, "", r.Reference())
+	require.True(t, cmplx.IsNaN(out.Stations[0].Phasors[0]))
+	require.Equal(t, uint16(statAbsentData|synchrophasor.StatDataModified), out.Stations[0].Stat)
+
+	require.ErrorIs(t, r.Write(&synchrophasor.Measurements{}, keep), synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Candidates: []string{"Sub 4.VA"}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
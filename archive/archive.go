@@ -0,0 +1,86 @@
+// Package archive stores raw C37.118 frames in an indexed, compressed
+// container and extracts them by time range.
+//
+// An archive starts with an 8 byte header followed by blocks and ends with a
+// block index. All integers are big-endian.
+//
+//	header  = "C37ARC" version(1) reserved(1)
+//	block   = kind(1) count(4) first(8) last(8) rawLen(4) dataLen(4) crc(4) data
+//	index   = (offset(8) kind(1) count(4) first(8) last(8))*
+//	trailer = indexOffset(8) entries(4) "C37AIDX" version(1)
+//
+// A block of kind 'C' holds one configuration frame, a block of kind 'D'
+// consecutive data frames described by the preceding configuration. The data
+// is zstd compressed, crc is the CRC-32C of the compressed data, first and
+// last are the frame times in Unix nanoseconds. Archives without a trailer,
+// e.g. after a crash, are recovered by scanning the blocks.
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ErrCorrupt is returned for archives with invalid structure or checksums
+var ErrCorrupt = errors.New("corrupt archive")
+
+// Container constants
+const (
+	version       = 1
+	headerSize    = 8
+	blockHeader   = 33
+	indexEntry    = 29
+	trailerSize   = 20
+	kindConfig    = 'C'
+	kindData      = 'D'
+	headerMagic   = "C37ARC"
+	trailerMagic  = "C37AIDX"
+	frameHeadSize = 16
+)
+
+// crcTable is the Castagnoli table of the block checksums
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// block describes one block of the archive
+type block struct {
+	offset int64
+	kind   byte
+	count  uint32
+	first  int64
+	last   int64
+	// config is the index of the configuration of data blocks
+	config int
+}
+
+// appendBlockHeader appends the header of a block with compressed data
+func appendBlockHeader(b []byte, blk *block, rawLen int, data []byte) []byte {
+	b = append(b, blk.kind)
+	b = binary.BigEndian.AppendUint32(b, blk.count)
+	b = binary.BigEndian.AppendUint64(b, uint64(blk.first))
+	b = binary.BigEndian.AppendUint64(b, uint64(blk.last))
+	b = binary.BigEndian.AppendUint32(b, uint32(rawLen))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return binary.BigEndian.AppendUint32(b, crc32.Checksum(data, crcTable))
+}
+
+// frameTime returns the time of a frame in Unix nanoseconds
+func frameTime(frame []byte, timeBase uint32) int64 {
+	soc := int64(binary.BigEndian.Uint32(frame[6:]))
+	frac := int64(binary.BigEndian.Uint32(frame[10:]) & 0xFFFFFF)
+	if timeBase == 0 {
+		return soc * 1e9
+	}
+	return soc*1e9 + frac*1e9/int64(timeBase)
+}
+
+// checkFrame verifies the sync byte and size of a raw frame and returns its
+// type
+func checkFrame(frame []byte) (synchrophasor.FrameType, error) {
+	if len(frame) < frameHeadSize || int(binary.BigEndian.Uint16(frame[2:])) != len(frame) {
+		return 0, synchrophasor.ErrInvalidSize
+	}
+	return synchrophasor.GetFrameType(frame)
+}
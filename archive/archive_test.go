@@ -0,0 +1,165 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(name string) *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+	station := synchrophasor.NewPMUStation(name, 7, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, 0)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+func dataFrame(t *testing.T, cfg *synchrophasor.ConfigFrame, soc, frac uint32) []byte {
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = soc
+	df.FracSec = frac
+	b, err := df.Pack()
+	require.NoError(t, err)
+	return b
+}
+
+// writeArchive writes two configurations with 100 data frames each at 50
+// frames per second
+func writeArchive(t *testing.T, close bool) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Options{BlockSize: 1024})
+	require.NoError(t, err)
+
+	for i, name := range []string{"Sub 1", "Sub 2"} {
+		cfg := testConfig(name)
+		require.NoError(t, w.WriteConfig(cfg))
+		for j := 0; j < 100; j++ {
+			n := uint32(i*100 + j)
+			require.NoError(t, w.Write(dataFrame(t, cfg, 1700000000+n/50, n%50*20000)))
+			if j == 50 {
+				// Repeated configurations are not stored again
+				cfg.SOC++
+				require.NoError(t, w.WriteConfig(cfg))
+			}
+		}
+	}
+	if close {
+		require.NoError(t, w.Close())
+	} else {
+		require.NoError(t, w.Flush())
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, it *Iterator) []Frame {
+	var out []Frame
+	for {
+		f, err := it.Next()
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		frame := *f
+		frame.Data = append([]byte(nil), f.Data...)
+		out = append(out, frame)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	b := writeArchive(t, true)
+	r, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	require.False(t, r.Recovered())
+	require.Len(t, r.Configs(), 2)
+	require.Equal(t, "Sub 2", r.Configs()[1].PMUStationList[0].STN)
+	require.Greater(t, len(r.blocks), 4)
+
+	first, last := r.Span()
+	require.Equal(t, time.Unix(1700000000, 0), first)
+	require.Equal(t, time.Unix(1700000003, 980000000), last)
+
+	segments := r.Segments()
+	require.Len(t, segments, 2)
+	require.Same(t, r.Configs()[1], segments[1].Config)
+	require.Equal(t, 100, segments[1].Frames)
+	require.Equal(t, time.Unix(1700000002, 0), segments[1].First)
+	require.Equal(t, last, segments[1].Last)
+
+	frames := readAll(t, r.Range(time.Time{}, time.Time{}))
+	require.Len(t, frames, 200)
+	require.Equal(t, dataFrame(t, testConfig("Sub 1"), 1700000000, 0), frames[0].Data)
+	require.Same(t, r.Configs()[0], frames[99].Config)
+	require.Same(t, r.Configs()[1], frames[100].Config)
+
+	// The frames decode with their configuration
+	df := synchrophasor.NewDataFrame(frames[150].Config)
+	require.NoError(t, df.Unpack(frames[150].Data))
+	require.Equal(t, uint32(1700000003), df.SOC)
+
+	frames = readAll(t, r.Range(time.Unix(1700000001, 500000000), time.Unix(1700000002, 100000000)))
+	require.Len(t, frames, 30)
+	require.Equal(t, time.Unix(1700000001, 500000000), frames[0].Time)
+	require.Equal(t, time.Unix(1700000002, 80000000), frames[29].Time)
+
+	require.Empty(t, readAll(t, r.Range(time.Unix(1800000000, 0), time.Time{})))
+}
+
+func TestArchiveRecover(t *testing.T) {
+	b := writeArchive(t, false)
+	// A partially written block is ignored
+	b = append(b, 'D', 0, 0)
+
+	name := filepath.Join(t.TempDir(), "test.c37a")
+	require.NoError(t, os.WriteFile(name, b, 0o600))
+	r, err := OpenFile(name)
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	require.True(t, r.Recovered())
+	require.Len(t, r.Configs(), 2)
+	require.Len(t, readAll(t, r.Range(time.Time{}, time.Time{})), 200)
+}
+
+func TestArchiveErrors(t *testing.T) {
+	b := writeArchive(t, true)
+
+	// Corrupted data fails the checksum of its block
+	r, err := NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+	corrupt := append([]byte(nil), b...)
+	corrupt[r.blocks[len(r.blocks)-1].offset+blockHeader] ^= 0xFF
+	require.NoError(t, r.Close())
+	r, err = NewReader(bytes.NewReader(corrupt), int64(len(corrupt)))
+	require.NoError(t, err)
+	it := r.Range(time.Time{}, time.Time{})
+	for err == nil {
+		_, err = it.Next()
+	}
+	require.ErrorIs(t, err, ErrCorrupt)
+	_, err = it.Next()
+	require.ErrorIs(t, err, ErrCorrupt)
+	require.NoError(t, r.Close())
+
+	_, err = NewReader(bytes.NewReader(b[1:]), int64(len(b)-1))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Options{})
+	require.NoError(t, err)
+	cfg := testConfig("Sub 1")
+	require.ErrorIs(t, w.Write(dataFrame(t, cfg, 1700000000, 0)), synchrophasor.ErrInvalidParameter)
+	require.ErrorIs(t, w.Write([]byte{0xAA, 0x01, 0x00}), synchrophasor.ErrInvalidSize)
+	require.NoError(t, w.Close())
+
+	_, err = NewWriter(&buf, Options{Level: 23})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
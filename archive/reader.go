@@ -0,0 +1,364 @@
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Frame is a raw frame read from an archive
+type Frame struct {
+	Time time.Time
+	// Data is the raw frame, valid until the next call to Next
+	Data []byte
+	// Config is the configuration describing data frames
+	Config *synchrophasor.ConfigFrame
+}
+
+// Reader extracts frames from an archive. A Reader and its iterators are
+// not safe for concurrent use.
+type Reader struct {
+	r       io.ReaderAt
+	closer  io.Closer
+	decoder *zstd.Decoder
+	blocks  []block
+	configs []*synchrophasor.ConfigFrame
+	// timeBases holds the time base of every configuration
+	timeBases []uint32
+	// recovered is set when the index was rebuilt by scanning the blocks
+	recovered bool
+	buf       []byte
+}
+
+// OpenFile opens an archive file
+func OpenFile(name string) (*Reader, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r, err := NewReader(file, info.Size())
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	r.closer = file
+	return r, nil
+}
+
+// NewReader reads the index and configurations of an archive of the given
+// size
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	header := make([]byte, headerSize)
+	if _, err := ra.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if string(header[:6]) != headerMagic || header[6] != version {
+		return nil, fmt.Errorf("%w: unknown header", ErrCorrupt)
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{r: ra, decoder: decoder}
+	if err := r.readIndex(size); err != nil {
+		// Archives not closed properly are scanned
+		r.blocks = r.blocks[:0]
+		if err := r.scan(size); err != nil {
+			decoder.Close()
+			return nil, err
+		}
+		r.recovered = true
+	}
+
+	// Load the configurations and assign them to the data blocks
+	current := -1
+	for i := range r.blocks {
+		blk := &r.blocks[i]
+		if blk.kind == kindData {
+			if current < 0 {
+				decoder.Close()
+				return nil, fmt.Errorf("%w: data block before configuration", ErrCorrupt)
+			}
+			blk.config = current
+			continue
+		}
+		raw, err := r.readBlock(blk, nil)
+		if err != nil {
+			decoder.Close()
+			return nil, err
+		}
+		cfg := synchrophasor.NewConfigFrame()
+		if err := cfg.Unpack(raw); err != nil {
+			decoder.Close()
+			return nil, fmt.Errorf("%w: configuration: %v", ErrCorrupt, err)
+		}
+		r.configs = append(r.configs, cfg)
+		r.timeBases = append(r.timeBases, binary.BigEndian.Uint32(raw[14:])&0xFFFFFF)
+		current = len(r.configs) - 1
+		blk.config = current
+	}
+	return r, nil
+}
+
+// readIndex reads the block index from the trailer
+func (r *Reader) readIndex(size int64) error {
+	if size < headerSize+trailerSize {
+		return ErrCorrupt
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := r.r.ReadAt(trailer, size-trailerSize); err != nil {
+		return err
+	}
+	if string(trailer[12:19]) != trailerMagic || trailer[19] != version {
+		return ErrCorrupt
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(trailer))
+	entries := int64(binary.BigEndian.Uint32(trailer[8:]))
+	if indexOffset < headerSize || indexOffset+entries*indexEntry != size-trailerSize {
+		return ErrCorrupt
+	}
+
+	index := make([]byte, entries*indexEntry)
+	if _, err := r.r.ReadAt(index, indexOffset); err != nil {
+		return err
+	}
+	for b := index; len(b) > 0; b = b[indexEntry:] {
+		r.blocks = append(r.blocks, block{
+			offset: int64(binary.BigEndian.Uint64(b)),
+			kind:   b[8],
+			count:  binary.BigEndian.Uint32(b[9:]),
+			first:  int64(binary.BigEndian.Uint64(b[13:])),
+			last:   int64(binary.BigEndian.Uint64(b[21:])),
+		})
+	}
+	return nil
+}
+
+// scan rebuilds the block index from the block headers, ignoring a
+// truncated last block
+func (r *Reader) scan(size int64) error {
+	header := make([]byte, blockHeader)
+	for offset := int64(headerSize); offset+blockHeader <= size; {
+		if _, err := r.r.ReadAt(header, offset); err != nil {
+			return err
+		}
+		kind := header[0]
+		if kind != kindConfig && kind != kindData {
+			break
+		}
+		next := offset + blockHeader + int64(binary.BigEndian.Uint32(header[25:]))
+		if next > size {
+			break
+		}
+		r.blocks = append(r.blocks, block{
+			offset: offset,
+			kind:   kind,
+			count:  binary.BigEndian.Uint32(header[1:]),
+			first:  int64(binary.BigEndian.Uint64(header[5:])),
+			last:   int64(binary.BigEndian.Uint64(header[13:])),
+		})
+		offset = next
+	}
+	return nil
+}
+
+// readBlock reads, verifies and decompresses a block into dst
+func (r *Reader) readBlock(blk *block, dst []byte) ([]byte, error) {
+	header := make([]byte, blockHeader)
+	if _, err := r.r.ReadAt(header, blk.offset); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if header[0] != blk.kind {
+		return nil, fmt.Errorf("%w: block at %d", ErrCorrupt, blk.offset)
+	}
+	rawLen := int(binary.BigEndian.Uint32(header[21:]))
+	dataLen := int(binary.BigEndian.Uint32(header[25:]))
+
+	r.buf = resize(r.buf, dataLen)
+	if _, err := r.r.ReadAt(r.buf, blk.offset+blockHeader); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if crc32.Checksum(r.buf, crcTable) != binary.BigEndian.Uint32(header[29:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch in block at %d", ErrCorrupt, blk.offset)
+	}
+	raw, err := r.decoder.DecodeAll(r.buf, dst[:0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if len(raw) != rawLen {
+		return nil, fmt.Errorf("%w: block at %d has %d bytes, expected %d", ErrCorrupt, blk.offset, len(raw), rawLen)
+	}
+	return raw, nil
+}
+
+// Recovered reports whether the archive had no valid index and was scanned
+func (r *Reader) Recovered() bool {
+	return r.recovered
+}
+
+// Configs returns the configuration snapshots in archive order
+func (r *Reader) Configs() []*synchrophasor.ConfigFrame {
+	return r.configs
+}
+
+// Span returns the time of the first and last data frame
+func (r *Reader) Span() (time.Time, time.Time) {
+	var first, last int64
+	found := false
+	for _, blk := range r.blocks {
+		if blk.kind != kindData {
+			continue
+		}
+		if !found {
+			first, last = blk.first, blk.last
+			found = true
+		}
+		first, last = min(first, blk.first), max(last, blk.last)
+	}
+	if !found {
+		return time.Time{}, time.Time{}
+	}
+	return time.Unix(0, first), time.Unix(0, last)
+}
+
+// Segment is a span of consecutive data blocks sharing a configuration
+type Segment struct {
+	Config      *synchrophasor.ConfigFrame
+	First, Last time.Time
+	Frames      int
+}
+
+// Segments returns the data spans in archive order, one per run of data
+// blocks following a configuration
+func (r *Reader) Segments() []Segment {
+	var segments []Segment
+	current := -1
+	for _, blk := range r.blocks {
+		if blk.kind != kindData {
+			continue
+		}
+		first, last := time.Unix(0, blk.first), time.Unix(0, blk.last)
+		if n := len(segments); n > 0 && blk.config == current {
+			seg := &segments[n-1]
+			if first.Before(seg.First) {
+				seg.First = first
+			}
+			if last.After(seg.Last) {
+				seg.Last = last
+			}
+			seg.Frames += int(blk.count)
+			continue
+		}
+		current = blk.config
+		segments = append(segments, Segment{Config: r.configs[blk.config], First: first, Last: last, Frames: int(blk.count)})
+	}
+	return segments
+}
+
+// Range returns an iterator over the data frames with from <= time < to.
+// A zero from or to leaves the range open on that side.
+func (r *Reader) Range(from, to time.Time) *Iterator {
+	it := &Iterator{r: r, from: minTime, to: maxTime}
+	if !from.IsZero() {
+		it.from = from.UnixNano()
+	}
+	if !to.IsZero() {
+		it.to = to.UnixNano()
+	}
+	return it
+}
+
+// Close releases the decoder and closes the file opened by OpenFile
+func (r *Reader) Close() error {
+	r.decoder.Close()
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Bounds of open time ranges
+const (
+	minTime = -1 << 63
+	maxTime = 1<<63 - 1
+)
+
+// Iterator reads the frames of a time range
+type Iterator struct {
+	r        *Reader
+	from, to int64
+	next     int
+	raw      []byte
+	frames   []byte
+	config   int
+	frame    Frame
+	err      error
+}
+
+// Next returns the next frame in the range and io.EOF after the last one
+func (it *Iterator) Next() (*Frame, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	r := it.r
+	for {
+		for len(it.frames) > 0 {
+			size := int(binary.BigEndian.Uint16(it.frames[2:]))
+			if size < frameHeadSize || size > len(it.frames) {
+				it.err = fmt.Errorf("%w: invalid frame size", ErrCorrupt)
+				return nil, it.err
+			}
+			data := it.frames[:size]
+			it.frames = it.frames[size:]
+
+			t := frameTime(data, r.timeBases[it.config])
+			if t < it.from || t >= it.to {
+				continue
+			}
+			it.frame = Frame{Time: time.Unix(0, t), Data: data, Config: r.configs[it.config]}
+			return &it.frame, nil
+		}
+
+		// Find the next data block overlapping the range
+		for it.next < len(r.blocks) {
+			blk := &r.blocks[it.next]
+			if blk.kind == kindData && blk.last >= it.from && blk.first < it.to {
+				break
+			}
+			it.next++
+		}
+		if it.next == len(r.blocks) {
+			it.err = io.EOF
+			return nil, it.err
+		}
+
+		blk := &r.blocks[it.next]
+		it.next++
+		raw, err := r.readBlock(blk, it.raw)
+		if err != nil {
+			it.err = err
+			return nil, err
+		}
+		it.raw, it.frames, it.config = raw, raw, blk.config
+	}
+}
+
+// resize returns s with length n, reallocating only if the capacity is too small
+func resize(s []byte, n int) []byte {
+	if cap(s) < n {
+		return make([]byte, n)
+	}
+	return s[:n]
+}
@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Options configures a Writer
+type Options struct {
+	// BlockSize is the uncompressed size of the frames at which a data block
+	// is written, defaults to 1 MiB
+	BlockSize int
+	// Level is the zstd compression level from 1 (fastest) to 22, defaults
+	// to 3
+	Level int
+}
+
+// Writer appends frames to an archive. A Writer is not safe for concurrent
+// use.
+type Writer struct {
+	opts     Options
+	w        io.Writer
+	encoder  *zstd.Encoder
+	offset   int64
+	blocks   []block
+	config   []byte
+	timeBase uint32
+	pending  block
+	raw      []byte
+	buf      []byte
+}
+
+// NewWriter writes the archive header to w and returns a writer for it
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = 1 << 20
+	}
+	if opts.Level == 0 {
+		opts.Level = 3
+	}
+	if opts.Level < 1 || opts.Level > 22 {
+		return nil, fmt.Errorf("%w: zstd level %d", synchrophasor.ErrInvalidParameter, opts.Level)
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(opts.Level)))
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(headerMagic), version, 0)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{opts: opts, w: w, encoder: encoder, offset: headerSize, pending: block{kind: kindData}}, nil
+}
+
+// Write adds a raw frame. Configuration frames (CFG-1 and CFG-2) are stored
+// as snapshots when they differ from the previous one, data frames are
+// collected into blocks and require a preceding configuration. Header and
+// command frames are ignored.
+func (w *Writer) Write(frame []byte) error {
+	frameType, err := checkFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	switch frameType {
+	case synchrophasor.FrameTypeCfg1, synchrophasor.FrameTypeCfg2:
+		return w.writeConfig(frame)
+	case synchrophasor.FrameTypeData:
+	default:
+		return nil
+	}
+	if w.config == nil {
+		return fmt.Errorf("%w: data frame before configuration", synchrophasor.ErrInvalidParameter)
+	}
+
+	t := frameTime(frame, w.timeBase)
+	if w.pending.count == 0 {
+		w.pending.first, w.pending.last = t, t
+	}
+	w.pending.first = min(w.pending.first, t)
+	w.pending.last = max(w.pending.last, t)
+	w.pending.count++
+	w.raw = append(w.raw, frame...)
+	if len(w.raw) >= w.opts.BlockSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// WriteConfig adds a configuration snapshot
+func (w *Writer) WriteConfig(cfg *synchrophasor.ConfigFrame) error {
+	frame, err := cfg.Pack()
+	if err != nil {
+		return err
+	}
+	return w.Write(frame)
+}
+
+// writeConfig stores a configuration frame unless only its time and CRC
+// differ from the current one
+func (w *Writer) writeConfig(frame []byte) error {
+	if w.config != nil && len(frame) == len(w.config) &&
+		bytes.Equal(frame[:6], w.config[:6]) && bytes.Equal(frame[14:len(frame)-2], w.config[14:len(frame)-2]) {
+		return nil
+	}
+	// Data blocks refer to the configuration preceding them
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	t := frameTime(frame, 0)
+	if err := w.writeBlock(block{kind: kindConfig, count: 1, first: t, last: t}, frame); err != nil {
+		return err
+	}
+	w.config = append(w.config[:0], frame...)
+	w.timeBase = binary.BigEndian.Uint32(frame[14:]) & 0xFFFFFF
+	return nil
+}
+
+// Flush writes the collected data frames as a block
+func (w *Writer) Flush() error {
+	if w.pending.count == 0 {
+		return nil
+	}
+	if err := w.writeBlock(w.pending, w.raw); err != nil {
+		return err
+	}
+	w.pending = block{kind: kindData}
+	w.raw = w.raw[:0]
+	return nil
+}
+
+// writeBlock compresses raw and writes it as a block
+func (w *Writer) writeBlock(blk block, raw []byte) error {
+	data := w.encoder.EncodeAll(raw, nil)
+	w.buf = appendBlockHeader(w.buf[:0], &blk, len(raw), data)
+	w.buf = append(w.buf, data...)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	blk.offset = w.offset
+	w.offset += int64(len(w.buf))
+	w.blocks = append(w.blocks, blk)
+	return nil
+}
+
+// Close flushes the data frames and writes the block index. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	defer func() { _ = w.encoder.Close() }()
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	b := w.buf[:0]
+	for _, blk := range w.blocks {
+		b = binary.BigEndian.AppendUint64(b, uint64(blk.offset))
+		b = append(b, blk.kind)
+		b = binary.BigEndian.AppendUint32(b, blk.count)
+		b = binary.BigEndian.AppendUint64(b, uint64(blk.first))
+		b = binary.BigEndian.AppendUint64(b, uint64(blk.last))
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(w.offset))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(w.blocks)))
+	b = append(b, trailerMagic...)
+	b = append(b, version)
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
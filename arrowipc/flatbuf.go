@@ -0,0 +1,215 @@
+package arrowipc
+
+import "encoding/binary"
+
+// The Arrow IPC metadata is encoded as FlatBuffers. Only the handful of tables
+// needed for schemas and record batches are written, so instead of pulling in
+// the FlatBuffers runtime this file contains a small builder that lays objects
+// out front to back: every table is preceded by its vtable and followed by the
+// objects it references, which keeps all offsets positive as the format requires.
+
+// fbObject is anything a table field can reference
+type fbObject interface {
+	// write appends the object to b and returns its position
+	write(b *fbBuilder) int
+}
+
+// fbField is a table field, either an inline scalar or a reference
+type fbField struct {
+	size  int // scalar size in bytes, 0 for references
+	value uint64
+	ref   fbObject
+}
+
+// fbTable is a table under construction, fields indexed by their schema id
+type fbTable struct {
+	fields []*fbField
+}
+
+// set stores field id, growing the field list as needed
+func (t *fbTable) set(id int, f *fbField) *fbTable {
+	for len(t.fields) <= id {
+		t.fields = append(t.fields, nil)
+	}
+	t.fields[id] = f
+	return t
+}
+
+// addBool sets a boolean field
+func (t *fbTable) addBool(id int, v bool) *fbTable {
+	var bits uint64
+	if v {
+		bits = 1
+	}
+	return t.set(id, &fbField{size: 1, value: bits})
+}
+
+// addUint8 sets a ubyte field
+func (t *fbTable) addUint8(id int, v uint8) *fbTable {
+	return t.set(id, &fbField{size: 1, value: uint64(v)})
+}
+
+// addInt16 sets a short field
+func (t *fbTable) addInt16(id int, v int16) *fbTable {
+	return t.set(id, &fbField{size: 2, value: uint64(uint16(v))})
+}
+
+// addInt32 sets an int field
+func (t *fbTable) addInt32(id int, v int32) *fbTable {
+	return t.set(id, &fbField{size: 4, value: uint64(uint32(v))})
+}
+
+// addInt64 sets a long field
+func (t *fbTable) addInt64(id int, v int64) *fbTable {
+	return t.set(id, &fbField{size: 8, value: uint64(v)})
+}
+
+// addRef sets a field referencing a table, string or vector
+func (t *fbTable) addRef(id int, obj fbObject) *fbTable {
+	return t.set(id, &fbField{ref: obj})
+}
+
+// write lays out the vtable, the table and then the referenced objects
+func (t *fbTable) write(b *fbBuilder) int {
+	// Inline layout: soffset to the vtable first, then fields by descending size
+	offsets := make([]int, len(t.fields))
+	size := 4
+	for _, width := range []int{8, 4, 2, 1} {
+		for id, f := range t.fields {
+			if f == nil || f.width() != width {
+				continue
+			}
+			size = align(size, width)
+			offsets[id] = size
+			size += width
+		}
+	}
+
+	vtable := b.pad(2)
+	b.appendUint16(uint16(4 + 2*len(t.fields)))
+	b.appendUint16(uint16(size))
+	for _, off := range offsets {
+		b.appendUint16(uint16(off))
+	}
+
+	pos := b.pad(8)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(int32(pos-vtable)))
+
+	for id, f := range t.fields {
+		if f == nil || f.ref != nil {
+			continue
+		}
+		at := b.buf[pos+offsets[id]:]
+		switch f.size {
+		case 1:
+			at[0] = byte(f.value)
+		case 2:
+			binary.LittleEndian.PutUint16(at, uint16(f.value))
+		case 4:
+			binary.LittleEndian.PutUint32(at, uint32(f.value))
+		case 8:
+			binary.LittleEndian.PutUint64(at, f.value)
+		}
+	}
+
+	for id, f := range t.fields {
+		if f != nil && f.ref != nil {
+			b.patch(pos+offsets[id], f.ref.write(b))
+		}
+	}
+
+	return pos
+}
+
+// width returns the inline size of the field
+func (f *fbField) width() int {
+	if f.ref != nil {
+		return 4
+	}
+	return f.size
+}
+
+// fbString is a string reference
+type fbString string
+
+// write appends the length-prefixed, NUL terminated string
+func (s fbString) write(b *fbBuilder) int {
+	pos := b.pad(4)
+	b.appendUint32(uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+// fbVector is a vector of tables or strings
+type fbVector []fbObject
+
+// write appends the offset vector followed by its elements
+func (v fbVector) write(b *fbBuilder) int {
+	pos := b.pad(4)
+	b.appendUint32(uint32(len(v)))
+	slots := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, obj := range v {
+		b.patch(slots+4*i, obj.write(b))
+	}
+	return pos
+}
+
+// fbStructs is a vector of structs made of 64 bit integers, such as the
+// FieldNode and Buffer structs of a record batch
+type fbStructs []int64
+
+// write appends the vector with the struct data 8 byte aligned
+func (s fbStructs) write(b *fbBuilder) int {
+	for (len(b.buf)+4)%8 != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	pos := len(b.buf)
+	b.appendUint32(uint32(len(s) / 2))
+	for _, v := range s {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(v))
+	}
+	return pos
+}
+
+// fbBuilder accumulates a FlatBuffer
+type fbBuilder struct {
+	buf []byte
+}
+
+// finish builds a buffer whose root is t
+func finish(t *fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4, 256)}
+	b.patch(0, t.write(b))
+	return b.buf
+}
+
+// pad aligns the end of the buffer and returns it
+func (b *fbBuilder) pad(n int) int {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	return len(b.buf)
+}
+
+// appendUint16 appends a little-endian uint16
+func (b *fbBuilder) appendUint16(v uint16) {
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, v)
+}
+
+// appendUint32 appends a little-endian uint32
+func (b *fbBuilder) appendUint32(v uint32) {
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, v)
+}
+
+// patch stores the offset from slot to target in slot
+func (b *fbBuilder) patch(slot, target int) {
+	binary.LittleEndian.PutUint32(b.buf[slot:], uint32(target-slot))
+}
+
+// align rounds n up to a multiple of a
+func align(n, a int) int {
+	return (n + a - 1) / a * a
+}
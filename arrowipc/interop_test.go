@@ -0,0 +1,99 @@
+package arrowipc
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriterArrowGo reads the stream with the reference Go implementation of
+// Arrow, independently of the FlatBuffer layout assumed by the writer
+func TestWriterArrowGo(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.PMUStationList[0].AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+	station := cfg.PMUStationList[0]
+	df := synchrophasor.NewDataFrame(cfg)
+
+	var out bytes.Buffer
+	w := NewWriter(&out, cfg, Options{})
+	var m synchrophasor.Measurements
+	for i, frac := range []uint32{0, 400000, 800000, 200000, 600000} {
+		df.SOC = 1760529600 + uint32(i/3)
+		df.FracSec = frac
+		station.Stat = uint16(i)
+		station.Freq = 50 + float32(i)/100
+		station.PhasorValues[0] = complex(0, float64(100+i))
+		station.PhasorValues[1] = complex(float64(i), 0)
+		station.AnalogValues[0] = float32(math.NaN())
+		station.DigitalValues[0][0] = i%2 == 0
+		df.FillMeasurements(&m)
+		require.NoError(t, w.Write(&m))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := ipc.NewReader(&out)
+	require.NoError(t, err)
+	defer r.Release()
+
+	schema := r.Schema()
+	columns := Columns(cfg)
+	require.Equal(t, len(columns), schema.NumFields())
+	types := map[DataType]arrow.DataType{
+		Timestamp: &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"},
+		Float32:   arrow.PrimitiveTypes.Float32,
+		Float64:   arrow.PrimitiveTypes.Float64,
+		Uint16:    arrow.PrimitiveTypes.Uint16,
+		Bool:      arrow.FixedWidthTypes.Boolean,
+	}
+	for i, col := range columns {
+		field := schema.Field(i)
+		require.Equal(t, col.Name, field.Name)
+		require.True(t, arrow.TypeEqual(types[col.Type], field.Type), "%s: %s", col.Name, field.Type)
+		require.Equal(t, len(col.Metadata), field.Metadata.Len())
+		for k, v := range col.Metadata {
+			idx := field.Metadata.FindKey(k)
+			require.GreaterOrEqual(t, idx, 0, "%s: %s", col.Name, k)
+			require.Equal(t, v, field.Metadata.Values()[idx])
+		}
+	}
+
+	index := func(name string) int {
+		idx := schema.FieldIndices(name)
+		require.Len(t, idx, 1, name)
+		return idx[0]
+	}
+	var rows []int
+	row := 0
+	for r.Next() {
+		rec := r.RecordBatch()
+		rows = append(rows, int(rec.NumRows()))
+		times := rec.Column(0).(*array.Timestamp)
+		stat := rec.Column(index("Station A.stat")).(*array.Uint16)
+		freq := rec.Column(index("Station A.freq")).(*array.Float32)
+		vaMag := rec.Column(index("Station A.VA.mag")).(*array.Float64)
+		vaAng := rec.Column(index("Station A.VA.ang")).(*array.Float64)
+		iaMag := rec.Column(index("Station A.IA.mag")).(*array.Float64)
+		p := rec.Column(index("Station A.P")).(*array.Float32)
+		brk := rec.Column(index("Station A.BRK1")).(*array.Boolean)
+		for j := 0; j < int(rec.NumRows()); j, row = j+1, row+1 {
+			want := time.Unix(1760529600+int64(row/3), int64([]int{0, 400, 800, 200, 600}[row])*int64(time.Millisecond))
+			require.Equal(t, want.UnixNano(), int64(times.Value(j)))
+			require.Equal(t, uint16(row), stat.Value(j))
+			require.InDelta(t, 50+float64(row)/100, freq.Value(j), 1e-5)
+			require.InDelta(t, 100+float64(row), vaMag.Value(j), 1e-9)
+			require.InDelta(t, 90, vaAng.Value(j), 1e-9)
+			require.InDelta(t, float64(row), iaMag.Value(j), 1e-9)
+			require.True(t, math.IsNaN(float64(p.Value(j))))
+			require.Equal(t, row%2 == 0, brk.Value(j))
+		}
+	}
+	require.NoError(t, r.Err())
+	require.Equal(t, []int{3, 2}, rows)
+}
@@ -0,0 +1,380 @@
+// Package arrowipc writes synchrophasor measurements as Apache Arrow record
+// batches in the IPC streaming format, readable by pyarrow, pandas, polars and
+// DataFusion without a bespoke parser
+package arrowipc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Arrow format constants from Schema.fbs and Message.fbs
+const (
+	metadataV5 = 4
+
+	headerSchema      = 1
+	headerRecordBatch = 3
+
+	typeInt           = 2
+	typeFloatingPoint = 3
+	typeBool          = 6
+	typeTimestamp     = 10
+
+	precisionSingle = 1
+	precisionDouble = 2
+
+	unitNanosecond = 3
+)
+
+// DataType is the Arrow type of a column
+type DataType int
+
+// Column types
+const (
+	Timestamp DataType = iota // nanoseconds since the epoch, UTC
+	Float32
+	Float64
+	Uint16
+	Bool
+)
+
+// Column describes one column of the schema
+type Column struct {
+	Name string
+	Type DataType
+	// Metadata is attached to the Arrow field, e.g. station and unit
+	Metadata map[string]string
+}
+
+// MessageWriter receives the IPC messages without stream framing: the Message
+// FlatBuffer and the body. Writers created for a MessageWriter pass every
+// message to WriteMessage instead of Write and omit the end-of-stream marker,
+// as needed for Arrow Flight.
+type MessageWriter interface {
+	WriteMessage(metadata, body []byte) error
+}
+
+// Options configures a writer
+type Options struct {
+	// Window aligns record batches to multiples of this duration, so a batch
+	// never spans a window boundary. Defaults to one second.
+	Window time.Duration
+	// MaxRows flushes a batch once it holds this many rows; zero disables
+	MaxRows int
+}
+
+// Writer streams measurements as Arrow record batches, one batch per window.
+// A Writer is not safe for concurrent use.
+type Writer struct {
+	w       io.Writer
+	opts    Options
+	columns []Column
+	values  [][]byte
+	rows    int
+	window  int64
+	started bool
+}
+
+// NewWriter creates a writer for measurements of the given configuration
+func NewWriter(w io.Writer, cfg *synchrophasor.ConfigFrame, opts Options) *Writer {
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+
+	columns := Columns(cfg)
+	return &Writer{
+		w:       w,
+		opts:    opts,
+		columns: columns,
+		values:  make([][]byte, len(columns)),
+	}
+}
+
+// Columns returns the schema for a configuration: the frame time followed by
+// status, frequency, ROCOF, phasor magnitude and angle (degrees), analog and
+// digital columns of every station
+func Columns(cfg *synchrophasor.ConfigFrame) []Column {
+	columns := []Column{{Name: "time", Type: Timestamp}}
+
+	for _, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN)
+		meta := func(kv ...string) map[string]string {
+			m := map[string]string{"station": stn, "id_code": strconv.Itoa(int(pmu.IDCode))}
+			for i := 0; i+1 < len(kv); i += 2 {
+				m[kv[i]] = kv[i+1]
+			}
+			return m
+		}
+
+		columns = append(columns,
+			Column{Name: stn + ".stat", Type: Uint16, Metadata: meta()},
+			Column{Name: stn + ".freq", Type: Float32, Metadata: meta("unit", "Hz")},
+			Column{Name: stn + ".rocof", Type: Float32, Metadata: meta("unit", "Hz/s")})
+
+		for j, name := range pmu.CHNAMPhasor {
+			name = strings.TrimSpace(name)
+			unit := "V"
+			if j < len(pmu.Phunit) && pmu.Phunit[j]>>24 == synchrophasor.PhunitCurrent {
+				unit = "A"
+			}
+			columns = append(columns,
+				Column{Name: stn + "." + name + ".mag", Type: Float64, Metadata: meta("channel", name, "unit", unit)},
+				Column{Name: stn + "." + name + ".ang", Type: Float64, Metadata: meta("channel", name, "unit", "deg")})
+		}
+
+		for _, name := range pmu.CHNAMAnalog {
+			name = strings.TrimSpace(name)
+			columns = append(columns, Column{Name: stn + "." + name, Type: Float32, Metadata: meta("channel", name)})
+		}
+
+		for word := 0; word < int(pmu.Dgnmr); word++ {
+			for bit := 0; bit < 16; bit++ {
+				name := ""
+				if i := word*16 + bit; i < len(pmu.CHNAMDigital) {
+					name = strings.TrimSpace(pmu.CHNAMDigital[i])
+				}
+				if name == "" {
+					name = fmt.Sprintf("D%d.%d", word, bit)
+				}
+				columns = append(columns, Column{Name: stn + "." + name, Type: Bool, Metadata: meta("channel", name)})
+			}
+		}
+	}
+
+	return columns
+}
+
+// Write appends a row, first flushing the pending batch if the row starts a new window
+func (w *Writer) Write(m *synchrophasor.Measurements) error {
+	nanos := m.UnixNano()
+
+	window := nanos / int64(w.opts.Window)
+	if w.rows > 0 && (window != w.window || (w.opts.MaxRows > 0 && w.rows >= w.opts.MaxRows)) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	w.window = window
+
+	if n := rowSize(m); n != len(w.columns) {
+		return fmt.Errorf("%w: row has %d columns, want %d", synchrophasor.ErrInvalidParameter, n, len(w.columns))
+	}
+
+	v := w.values
+	v[0] = binary.LittleEndian.AppendUint64(v[0], uint64(nanos))
+	col := 1
+	for i := range m.Stations {
+		st := &m.Stations[i]
+		v[col] = binary.LittleEndian.AppendUint16(v[col], st.Stat)
+		v[col+1] = appendFloat32(v[col+1], st.Frequency)
+		v[col+2] = appendFloat32(v[col+2], st.ROCOF)
+		col += 3
+		for _, ph := range st.Phasors {
+			v[col] = appendFloat64(v[col], cmplx.Abs(ph))
+			v[col+1] = appendFloat64(v[col+1], cmplx.Phase(ph)*180/math.Pi)
+			col += 2
+		}
+		for _, a := range st.Analog {
+			v[col] = appendFloat32(v[col], a)
+			col++
+		}
+		for _, word := range st.Digital {
+			for _, bit := range word {
+				v[col] = appendBit(v[col], w.rows, bit)
+				col++
+			}
+		}
+	}
+
+	w.rows++
+	return nil
+}
+
+// Flush writes the pending rows as a record batch
+func (w *Writer) Flush() error {
+	if err := w.writeSchema(); err != nil {
+		return err
+	}
+	if w.rows == 0 {
+		return nil
+	}
+
+	var nodes, buffers []int64
+	var body []byte
+	for i, col := range w.columns {
+		values := w.values[i][:bufferSize(col.Type, w.rows)]
+		nodes = append(nodes, int64(w.rows), 0)
+		// Empty validity bitmap, no nulls
+		buffers = append(buffers, int64(len(body)), 0)
+		buffers = append(buffers, int64(len(body)), int64(len(values)))
+		body = append(body, values...)
+		body = append(body, make([]byte, align(len(body), 8)-len(body))...)
+	}
+
+	batch := (&fbTable{}).
+		addInt64(0, int64(w.rows)).
+		addRef(1, fbStructs(nodes)).
+		addRef(2, fbStructs(buffers))
+
+	if err := w.writeMessage(headerRecordBatch, batch, body); err != nil {
+		return err
+	}
+
+	for i := range w.values {
+		w.values[i] = w.values[i][:0]
+	}
+	w.rows = 0
+	return nil
+}
+
+// Close flushes pending rows and writes the end-of-stream marker
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if _, ok := w.w.(MessageWriter); ok {
+		return nil
+	}
+	_, err := w.w.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0})
+	return err
+}
+
+// writeSchema writes the schema message once, before the first batch
+func (w *Writer) writeSchema() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	fields := make(fbVector, len(w.columns))
+	for i, col := range w.columns {
+		typeID, typ := arrowType(col.Type)
+		field := (&fbTable{}).
+			addRef(0, fbString(col.Name)).
+			addBool(1, false).
+			addUint8(2, typeID).
+			addRef(3, typ).
+			addRef(5, fbVector{})
+		if len(col.Metadata) > 0 {
+			field.addRef(6, keyValues(col.Metadata))
+		}
+		fields[i] = field
+	}
+
+	schema := (&fbTable{}).
+		addInt16(0, 0). // little endian
+		addRef(1, fields)
+
+	return w.writeMessage(headerSchema, schema, nil)
+}
+
+// writeMessage writes an encapsulated IPC message: continuation marker,
+// metadata length, the Message FlatBuffer padded to 8 bytes and the body
+func (w *Writer) writeMessage(headerType uint8, header *fbTable, body []byte) error {
+	msg := (&fbTable{}).
+		addInt16(0, metadataV5).
+		addUint8(1, headerType).
+		addRef(2, header).
+		addInt64(3, int64(len(body)))
+
+	meta := finish(msg)
+	meta = append(meta, make([]byte, align(len(meta), 8)-len(meta))...)
+	if mw, ok := w.w.(MessageWriter); ok {
+		return mw.WriteMessage(meta, body)
+	}
+
+	prefix := make([]byte, 8, 8+len(meta)+len(body))
+	binary.LittleEndian.PutUint32(prefix, 0xFFFFFFFF)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+
+	_, err := w.w.Write(append(append(prefix, meta...), body...))
+	return err
+}
+
+// arrowType returns the Type union member for a column type
+func arrowType(t DataType) (uint8, *fbTable) {
+	switch t {
+	case Timestamp:
+		return typeTimestamp, (&fbTable{}).addInt16(0, unitNanosecond).addRef(1, fbString("UTC"))
+	case Float32:
+		return typeFloatingPoint, (&fbTable{}).addInt16(0, precisionSingle)
+	case Float64:
+		return typeFloatingPoint, (&fbTable{}).addInt16(0, precisionDouble)
+	case Uint16:
+		return typeInt, (&fbTable{}).addInt32(0, 16).addBool(1, false)
+	default:
+		return typeBool, &fbTable{}
+	}
+}
+
+// keyValues encodes field metadata as a vector of KeyValue tables, sorted by key
+func keyValues(m map[string]string) fbVector {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	v := make(fbVector, len(keys))
+	for i, k := range keys {
+		v[i] = (&fbTable{}).addRef(0, fbString(k)).addRef(1, fbString(m[k]))
+	}
+	return v
+}
+
+// rowSize returns the number of columns needed for m
+func rowSize(m *synchrophasor.Measurements) int {
+	n := 1
+	for i := range m.Stations {
+		st := &m.Stations[i]
+		n += 3 + 2*len(st.Phasors) + len(st.Analog)
+		for _, word := range st.Digital {
+			n += len(word)
+		}
+	}
+	return n
+}
+
+// bufferSize returns the byte length of a value buffer holding rows values
+func bufferSize(t DataType, rows int) int {
+	switch t {
+	case Timestamp, Float64:
+		return 8 * rows
+	case Float32:
+		return 4 * rows
+	case Uint16:
+		return 2 * rows
+	default:
+		return (rows + 7) / 8
+	}
+}
+
+// appendBit sets bit row of a bitmap, growing it as needed
+func appendBit(b []byte, row int, v bool) []byte {
+	if row%8 == 0 {
+		b = append(b, 0)
+	}
+	if v {
+		b[row/8] |= 1 << uint(row%8)
+	}
+	return b
+}
+
+// appendFloat32 appends a little-endian float32
+func appendFloat32(b []byte, v float32) []byte {
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+}
+
+// appendFloat64 appends a little-endian float64
+func appendFloat64(b []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
@@ -0,0 +1,180 @@
+package arrowipc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// fbReader decodes FlatBuffer tables following the format specification,
+// independently of the builder
+type fbReader []byte
+
+func (r fbReader) root() int {
+	return int(binary.LittleEndian.Uint32(r))
+}
+
+// field returns the absolute position of field id of the table at t, or 0
+func (r fbReader) field(t, id int) int {
+	vt := t - int(int32(binary.LittleEndian.Uint32(r[t:])))
+	if 4+2*id >= int(binary.LittleEndian.Uint16(r[vt:])) {
+		return 0
+	}
+	off := int(binary.LittleEndian.Uint16(r[vt+4+2*id:]))
+	if off == 0 {
+		return 0
+	}
+	return t + off
+}
+
+func (r fbReader) deref(p int) int {
+	return p + int(binary.LittleEndian.Uint32(r[p:]))
+}
+
+func (r fbReader) str(p int) string {
+	s := r.deref(p)
+	n := int(binary.LittleEndian.Uint32(r[s:]))
+	return string(r[s+4 : s+4+n])
+}
+
+func (r fbReader) vector(p int) (start, n int) {
+	v := r.deref(p)
+	return v + 4, int(binary.LittleEndian.Uint32(r[v:]))
+}
+
+// message reads one encapsulated IPC message
+func readMessage(t *testing.T, data []byte) (meta fbReader, msg int, body, rest []byte) {
+	require.Equal(t, uint32(0xFFFFFFFF), binary.LittleEndian.Uint32(data))
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	require.Zero(t, (8+size)%8)
+	meta = fbReader(data[8 : 8+size])
+	msg = meta.root()
+	require.Equal(t, uint16(metadataV5), binary.LittleEndian.Uint16(meta[meta.field(msg, 0):]))
+	bodyLen := int(binary.LittleEndian.Uint64(meta[meta.field(msg, 3):]))
+	return meta, msg, data[8+size : 8+size+bodyLen], data[8+size+bodyLen:]
+}
+
+func newTestConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Station A", 1, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+	station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+func TestWriterStream(t *testing.T) {
+	cfg := newTestConfig()
+	station := cfg.PMUStationList[0]
+	df := synchrophasor.NewDataFrame(cfg)
+
+	var out bytes.Buffer
+	w := NewWriter(&out, cfg, Options{})
+	var m synchrophasor.Measurements
+
+	// Three rows in the first second, two in the next
+	for i, frac := range []uint32{0, 400000, 800000, 200000, 600000} {
+		df.SOC = 1760529600 + uint32(i/3)
+		df.FracSec = frac
+		station.PhasorValues[0] = complex(0, float64(100+i))
+		station.DigitalValues[0][0] = i%2 == 0
+		df.FillMeasurements(&m)
+		require.NoError(t, w.Write(&m))
+	}
+	require.NoError(t, w.Close())
+	data := out.Bytes()
+
+	// Schema
+	meta, msg, body, data := readMessage(t, data)
+	require.Empty(t, body)
+	require.Equal(t, byte(headerSchema), meta[meta.field(msg, 1)])
+	schema := meta.deref(meta.field(msg, 2))
+	fields, n := meta.vector(meta.field(schema, 1))
+	require.Equal(t, 1+3+2+1+16, n)
+
+	first := meta.deref(fields)
+	require.Equal(t, "time", meta.str(meta.field(first, 0)))
+	require.Equal(t, byte(typeTimestamp), meta[meta.field(first, 2)])
+
+	mag := meta.deref(fields + 4*4)
+	require.Equal(t, "Station A.VA.mag", meta.str(meta.field(mag, 0)))
+	kvs, nkv := meta.vector(meta.field(mag, 6))
+	require.Equal(t, 4, nkv)
+	unit := meta.deref(kvs + 4*3)
+	require.Equal(t, "unit", meta.str(meta.field(unit, 0)))
+	require.Equal(t, "V", meta.str(meta.field(unit, 1)))
+
+	// First batch holds the three rows of the first second
+	for _, rows := range []int{3, 2} {
+		var batchMeta fbReader
+		batchMeta, msg, body, data = readMessage(t, data)
+		require.Equal(t, byte(headerRecordBatch), batchMeta[batchMeta.field(msg, 1)])
+		batch := batchMeta.deref(batchMeta.field(msg, 2))
+		require.Equal(t, uint64(rows), binary.LittleEndian.Uint64(batchMeta[batchMeta.field(batch, 0):]))
+
+		buffers, nbuf := batchMeta.vector(batchMeta.field(batch, 2))
+		require.Equal(t, 2*n, nbuf)
+		require.Zero(t, buffers%8)
+		buffer := func(i int) []byte {
+			off := binary.LittleEndian.Uint64(batchMeta[buffers+16*i:])
+			size := binary.LittleEndian.Uint64(batchMeta[buffers+16*i+8:])
+			require.Zero(t, off%8)
+			return body[off : off+size]
+		}
+
+		times := buffer(1)
+		require.Len(t, times, 8*rows)
+		mags := buffer(2*4 + 1)
+		first := math.Float64frombits(binary.LittleEndian.Uint64(mags))
+		bits := buffer(2*7 + 1)
+		if rows == 3 {
+			require.Equal(t, int64(1760529600400000000), int64(binary.LittleEndian.Uint64(times[8:])))
+			require.InDelta(t, 100, first, 1e-9)
+			require.Equal(t, []byte{0b101}, bits)
+		} else {
+			require.InDelta(t, 103, first, 1e-9)
+			require.Equal(t, []byte{0b10}, bits)
+		}
+	}
+
+	require.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 0, 0, 0}, data)
+}
+
+// messages collects the messages passed to WriteMessage
+type messages struct {
+	bytes.Buffer
+	meta, body [][]byte
+}
+
+func (m *messages) WriteMessage(meta, body []byte) error {
+	m.meta = append(m.meta, meta)
+	m.body = append(m.body, body)
+	return nil
+}
+
+func TestWriterMessages(t *testing.T) {
+	cfg := newTestConfig()
+	df := synchrophasor.NewDataFrame(cfg)
+	var m synchrophasor.Measurements
+	df.SOC = 1760529600
+	df.FillMeasurements(&m)
+
+	var out messages
+	w := NewWriter(&out, cfg, Options{})
+	require.NoError(t, w.Write(&m))
+	require.NoError(t, w.Close())
+
+	require.Zero(t, out.Len())
+	require.Len(t, out.meta, 2)
+	require.Empty(t, out.body[0])
+	require.NotEmpty(t, out.body[1])
+	meta := fbReader(out.meta[1])
+	require.Zero(t, len(meta)%8)
+	require.Equal(t, byte(headerRecordBatch), meta[meta.field(meta.root(), 1)])
+}
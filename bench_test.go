@@ -0,0 +1,206 @@
+package synchrophasor
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+// benchStations are the station counts benchmarked, from a single PMU up to a super-PDC stream
+var benchStations = []int{1, 10, 100}
+
+// newBenchConfig builds a configuration frame with the given number of stations
+func newBenchConfig(stations int) *ConfigFrame {
+	cfg := NewConfigFrame()
+	cfg.IDCode = 7734
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 60
+
+	for i := 0; i < stations; i++ {
+		station := NewPMUStation(fmt.Sprintf("Station %d", i), uint16(i+1), true, true, true, true)
+		station.AddPhasor("VA", 915527, PhunitVoltage)
+		station.AddPhasor("VB", 915527, PhunitVoltage)
+		station.AddPhasor("VC", 915527, PhunitVoltage)
+		station.AddPhasor("I1", 45776, PhunitCurrent)
+		station.AddAnalog("ANALOG1", 1, AnunitPow)
+		station.AddDigital([]string{"BREAKER 1 STATUS"}, 0x0000, 0xFFFF)
+		station.Fnom = FreqNom50Hz
+		cfg.AddPMUStation(station)
+	}
+
+	return cfg
+}
+
+// benchSizes runs fn as a sub-benchmark for every station count
+func benchSizes(b *testing.B, fn func(b *testing.B, stations int)) {
+	for _, stations := range benchStations {
+		b.Run(fmt.Sprintf("stations=%d", stations), func(b *testing.B) {
+			fn(b, stations)
+		})
+	}
+}
+
+func BenchmarkDataFramePack(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		df := NewDataFrame(newBenchConfig(stations))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := df.Pack(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDataFrameAppendToPooled(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		df := NewDataFrame(newBenchConfig(stations))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			buf := getFrameBuffer()
+			data, err := df.AppendTo(*buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			*buf = data
+			putFrameBuffer(buf)
+		}
+	})
+}
+
+func BenchmarkDataFramePackTo(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		df := NewDataFrame(newBenchConfig(stations))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := df.PackTo(io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDataFrameUnpack(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		cfg := newBenchConfig(stations)
+		data, err := NewDataFrame(cfg).Pack()
+		if err != nil {
+			b.Fatal(err)
+		}
+		df := NewDataFrame(cfg)
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if err := df.Unpack(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkConfigFramePack(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		cfg := newBenchConfig(stations)
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := cfg.Pack(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkConfigFrameUnpack(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		data, err := newBenchConfig(stations).Pack()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if err := NewConfigFrame().Unpack(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkUnpackFrame(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		cfg := newBenchConfig(stations)
+		data, err := NewDataFrame(cfg).Pack()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if _, err := UnpackFrame(data, cfg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCalcCRC(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		data, err := NewDataFrame(newBenchConfig(stations)).Pack()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+
+		for i := 0; i < b.N; i++ {
+			CalcCRC(data)
+		}
+	})
+}
+
+func BenchmarkGetMeasurements(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		df := NewDataFrame(newBenchConfig(stations))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			df.GetMeasurements()
+		}
+	})
+}
+
+func BenchmarkFillMeasurements(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		df := NewDataFrame(newBenchConfig(stations))
+		var m Measurements
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			df.FillMeasurements(&m)
+		}
+	})
+}
+
+func BenchmarkDataFrameUnpackParallel(b *testing.B) {
+	benchSizes(b, func(b *testing.B, stations int) {
+		cfg := newBenchConfig(stations)
+		data, err := NewDataFrame(cfg).Pack()
+		if err != nil {
+			b.Fatal(err)
+		}
+		df := NewDataFrame(cfg)
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			if err := df.UnpackParallel(data, 4); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package synchrophasor
 
-import "time"
+import (
+	"encoding/binary"
+	"time"
+)
 
 // C37118 is the base structure for all frame types
 type C37118 struct {
@@ -67,3 +70,21 @@ func (c *C37118) SetTimeWithQuality(
 	c.FracSec <<= 24
 	c.FracSec |= frSeconds & 0x00FFFFFF
 }
+
+// appendHeader appends SYNC, FRAMESIZE, IDCODE, SOC and FRACSEC to dst
+func (c *C37118) appendHeader(dst []byte) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, c.Sync)
+	dst = binary.BigEndian.AppendUint16(dst, c.FrameSize)
+	dst = binary.BigEndian.AppendUint16(dst, c.IDCode)
+	dst = binary.BigEndian.AppendUint32(dst, c.SOC)
+	return binary.BigEndian.AppendUint32(dst, c.FracSec)
+}
+
+// readHeader reads SYNC, FRAMESIZE, IDCODE, SOC and FRACSEC
+func (c *C37118) readHeader(r *frameReader) {
+	c.Sync = r.uint16()
+	c.FrameSize = r.uint16()
+	c.IDCode = r.uint16()
+	c.SOC = r.uint32()
+	c.FracSec = r.uint32()
+}
@@ -0,0 +1,130 @@
+package synchrophasor
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+)
+
+// ChannelKind is the quantity of a named channel
+type ChannelKind uint8
+
+// Channel kinds
+const (
+	// ChannelStat is the STAT word
+	ChannelStat ChannelKind = iota
+	ChannelFrequency
+	ChannelROCOF
+	// ChannelMagnitude and ChannelAngle are the magnitude and the angle in
+	// degrees of a phasor
+	ChannelMagnitude
+	ChannelAngle
+	ChannelAnalog
+	// ChannelDigital is a status bit, 1 while set
+	ChannelDigital
+)
+
+// ChannelRef locates a named channel in the measurement sets of a
+// configuration
+type ChannelRef struct {
+	Station int
+	Kind    ChannelKind
+	// Index is the phasor, analog or digital channel, counting the 16 bits
+	// of every status word
+	Index int
+}
+
+// PhasorRef locates a phasor in the measurement sets of a configuration
+type PhasorRef struct {
+	// Name is the phasor name prefixed by the station name, e.g. "Sub 1.VA"
+	Name    string
+	Station int
+	Index   int
+}
+
+// Phasors returns the phasors of all stations in configuration order, named
+// "<station>.<phasor>" after the trimmed station and channel names
+func (c *ConfigFrame) Phasors() []PhasorRef {
+	var refs []PhasorRef
+	for i, pmu := range c.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN) + "."
+		for j := range pmu.CHNAMPhasor {
+			refs = append(refs, PhasorRef{Name: stn + pmu.PhasorName(j), Station: i, Index: j})
+		}
+	}
+	return refs
+}
+
+// FindPhasor returns the phasor named "<station>.<phasor>", e.g. "Sub 1.VA",
+// and false if there is none
+func (c *ConfigFrame) FindPhasor(name string) (PhasorRef, bool) {
+	for _, ref := range c.Phasors() {
+		if ref.Name == name {
+			return ref, true
+		}
+	}
+	return PhasorRef{}, false
+}
+
+// Channels returns the channels of the configuration by name: for a station
+// "Sub 1" these are "Sub 1.stat", "Sub 1.freq", "Sub 1.rocof", the phasor
+// magnitudes and angles "Sub 1.<phasor>.mag" and "Sub 1.<phasor>.ang", and
+// the analog and named digital channels "Sub 1.<channel>"
+func (c *ConfigFrame) Channels() map[string]ChannelRef {
+	m := make(map[string]ChannelRef)
+	for i, pmu := range c.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN) + "."
+		m[stn+"stat"] = ChannelRef{i, ChannelStat, 0}
+		m[stn+"freq"] = ChannelRef{i, ChannelFrequency, 0}
+		m[stn+"rocof"] = ChannelRef{i, ChannelROCOF, 0}
+		for j := range pmu.CHNAMPhasor {
+			name := stn + pmu.PhasorName(j)
+			m[name+".mag"] = ChannelRef{i, ChannelMagnitude, j}
+			m[name+".ang"] = ChannelRef{i, ChannelAngle, j}
+		}
+		for j := range pmu.CHNAMAnalog {
+			m[stn+pmu.AnalogName(j)] = ChannelRef{i, ChannelAnalog, j}
+		}
+		for j := range pmu.CHNAMDigital {
+			if name := pmu.DigitalName(j); name != "" {
+				m[stn+name] = ChannelRef{i, ChannelDigital, j}
+			}
+		}
+	}
+	return m
+}
+
+// Value returns the value of the channel in the measurements of its station,
+// false if st lacks the channel
+func (r ChannelRef) Value(st *StationMeasurement) (float64, bool) {
+	switch r.Kind {
+	case ChannelStat:
+		return float64(st.Stat), true
+	case ChannelFrequency:
+		return float64(st.Frequency), true
+	case ChannelROCOF:
+		return float64(st.ROCOF), true
+	case ChannelMagnitude, ChannelAngle:
+		if r.Index >= len(st.Phasors) {
+			return 0, false
+		}
+		if r.Kind == ChannelAngle {
+			return cmplx.Phase(st.Phasors[r.Index]) * 180 / math.Pi, true
+		}
+		return cmplx.Abs(st.Phasors[r.Index]), true
+	case ChannelAnalog:
+		if r.Index >= len(st.Analog) {
+			return 0, false
+		}
+		return float64(st.Analog[r.Index]), true
+	default:
+		word, bit := r.Index/16, r.Index%16
+		if word >= len(st.Digital) || bit >= len(st.Digital[word]) {
+			return 0, false
+		}
+		if st.Digital[word][bit] {
+			return 1, true
+		}
+		return 0, true
+	}
+}
@@ -0,0 +1,50 @@
+package synchrophasor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFramePhasors(t *testing.T) {
+	cfg := newBenchConfig(2)
+	phasors := cfg.Phasors()
+	require.Len(t, phasors, 8)
+	require.Equal(t, PhasorRef{Name: "Station 1.VB", Station: 1, Index: 1}, phasors[5])
+
+	ref, ok := cfg.FindPhasor("Station 0.I1")
+	require.True(t, ok)
+	require.Equal(t, PhasorRef{Name: "Station 0.I1", Station: 0, Index: 3}, ref)
+	_, ok = cfg.FindPhasor("Station 0.ANALOG1")
+	require.False(t, ok)
+	_, ok = cfg.FindPhasor("VA")
+	require.False(t, ok)
+}
+
+func TestConfigFrameChannels(t *testing.T) {
+	cfg := newBenchConfig(2)
+	channels := cfg.Channels()
+	require.Len(t, channels, 2*(3+2*4+1+1))
+	require.Equal(t, ChannelRef{Station: 1, Kind: ChannelAngle, Index: 3}, channels["Station 1.I1.ang"])
+	require.Equal(t, ChannelRef{Station: 0, Kind: ChannelDigital, Index: 0}, channels["Station 0.BREAKER 1 STATUS"])
+
+	st := &StationMeasurement{
+		Stat: 0x0200, Frequency: 50, Phasors: []complex128{0, 0, 0, complex(0, 2)}, Analog: []float32{7},
+		Digital: [][]bool{make([]bool, 16)},
+	}
+	st.Digital[0][0] = true
+	for name, want := range map[string]float64{
+		"Station 0.stat": 0x0200, "Station 0.freq": 50, "Station 0.rocof": 0, "Station 0.I1.mag": 2,
+		"Station 0.I1.ang": 90, "Station 0.ANALOG1": 7, "Station 0.BREAKER 1 STATUS": 1,
+	} {
+		v, ok := channels[name].Value(st)
+		require.True(t, ok, name)
+		require.InDelta(t, want, v, 1e-9, name)
+	}
+
+	// Channels missing from the measurements are reported
+	_, ok := channels["Station 0.ANALOG1"].Value(&StationMeasurement{})
+	require.False(t, ok)
+	_, ok = channels["Station 0.BREAKER 1 STATUS"].Value(&StationMeasurement{})
+	require.False(t, ok)
+}
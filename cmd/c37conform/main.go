@@ -0,0 +1,66 @@
+// c37conform connects to a PMU or PDC and runs the C37.118.2 conformance
+// checks of the conformance package, printing a pass/fail report. It exits
+// with 1 if a check failed and 2 if the device could not be reached.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor/conformance"
+)
+
+func main() {
+	idCode := flag.Uint("id", 1, "IDCODE sent in the command frames")
+	timeout := flag.Duration("timeout", 2*time.Second, "wait for every response")
+	duration := flag.Duration("duration", 5*time.Second, "observe the data stream this long")
+	tolerance := flag.Float64("tolerance", 0.02, "relative deviation from DATA_RATE accepted")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] host:port\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	report, err := conformance.Run(ctx, flag.Arg(0), conformance.Options{
+		IDCode:        uint16(*idCode),
+		Timeout:       *timeout,
+		Duration:      *duration,
+		RateTolerance: *tolerance,
+	})
+	if err != nil {
+		log.Printf("Failed to connect: %v", err)
+		os.Exit(2)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(struct {
+			*conformance.Report
+			Passed bool `json:"passed"`
+		}{report, report.Passed()})
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,470 @@
+// c37dump decodes C37.118 frames from a hex string, a binary or hex file or
+// stdin and prints their fields with CRC verification
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/cmplx"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+func main() {
+	hexString := flag.String("x", "", "decode this hex string instead of a file")
+	configFile := flag.String("config", "", "decode data frames with the CFG-2 frame in this binary or hex file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config cfg2.bin] [-x hex | file | -]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(),
+			"Files holding only hex digits and whitespace are decoded as hex. Reads stdin without a file or with -.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var data []byte
+	var err error
+	switch {
+	case *hexString != "":
+		data, err = decodeHex([]byte(*hexString))
+	case flag.NArg() == 0 || flag.Arg(0) == "-":
+		data, err = readInput(os.Stdin)
+	default:
+		data, err = readFile(flag.Arg(0))
+	}
+	if err != nil {
+		log.Fatalf("Failed to read frames: %v", err)
+	}
+
+	d := &dumper{out: os.Stdout}
+	if *configFile != "" {
+		raw, err := readFile(*configFile)
+		if err != nil {
+			log.Fatalf("Failed to read configuration: %v", err)
+		}
+		frame, err := synchrophasor.UnpackFrame(raw, nil)
+		if err != nil {
+			log.Fatalf("Failed to decode configuration: %v", err)
+		}
+		switch cfg := frame.(type) {
+		case *synchrophasor.ConfigFrame:
+			d.cfg = cfg
+		case *synchrophasor.Config1Frame:
+			d.cfg = &cfg.ConfigFrame
+		default:
+			log.Fatalf("%s holds no configuration frame", *configFile)
+		}
+	}
+
+	if !d.dump(data) {
+		os.Exit(1)
+	}
+}
+
+// readFile reads a binary or hex file
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return readInput(f)
+}
+
+// readInput reads binary data or, if r holds only hex digits and
+// whitespace, the bytes they encode
+func readInput(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if isHex(data) {
+		return decodeHex(data)
+	}
+	return data, nil
+}
+
+// isHex reports whether data is hex text, allowing whitespace, colons, 0x
+// prefixes and comment lines
+func isHex(data []byte) bool {
+	text := strings.ReplaceAll(stripComments(string(data)), "0x", "")
+	digits := 0
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r) || r == ':':
+		case strings.ContainsRune("0123456789abcdefABCDEF", r):
+			digits++
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// decodeHex decodes hex text, ignoring whitespace, colons, 0x prefixes and
+// comment lines
+func decodeHex(text []byte) ([]byte, error) {
+	clean := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == ':' {
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(stripComments(string(text)), "0x", ""))
+	return hex.DecodeString(clean)
+}
+
+// stripComments removes the lines starting with #, e.g. the provenance notes
+// of the golden test vectors
+func stripComments(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// dumper prints frames, decoding data frames with the latest configuration
+type dumper struct {
+	out io.Writer
+	cfg *synchrophasor.ConfigFrame
+}
+
+// dump prints the frames in data and returns whether all of them were
+// complete and passed the CRC check
+func (d *dumper) dump(data []byte) bool {
+	ok := true
+	count := 0
+	for offset := 0; offset < len(data); {
+		// Skip to the next SYNC byte
+		start := bytes.IndexByte(data[offset:], synchrophasor.SyncAA)
+		if start < 0 {
+			fmt.Fprintf(d.out, "%d trailing bytes without SYNC at offset %d\n", len(data)-offset, offset)
+			return false
+		}
+		if start > 0 {
+			fmt.Fprintf(d.out, "Skipped %d bytes without SYNC at offset %d\n\n", start, offset)
+			ok = false
+			offset += start
+		}
+
+		rest := data[offset:]
+		if len(rest) < 4 {
+			fmt.Fprintf(d.out, "Truncated frame at offset %d: %d bytes\n", offset, len(rest))
+			return false
+		}
+		size := int(binary.BigEndian.Uint16(rest[2:4]))
+		if size < 16 || size > len(rest) {
+			fmt.Fprintf(d.out, "Frame at offset %d has FRAMESIZE %d with %d bytes left\n\n", offset, size, len(rest))
+			ok = false
+			offset++
+			continue
+		}
+
+		count++
+		if !d.frame(count, offset, rest[:size]) {
+			ok = false
+		}
+		fmt.Fprintln(d.out)
+		offset += size
+	}
+	if count == 0 {
+		fmt.Fprintln(d.out, "No frames found")
+		return false
+	}
+	return ok
+}
+
+// frameNames names the frame types
+var frameNames = [...]string{"data", "header", "CFG-1", "CFG-2", "command", "CFG-3"}
+
+// frame prints one frame and returns whether its CRC matched and it decoded
+func (d *dumper) frame(n, offset int, frame []byte) bool {
+	sync := binary.BigEndian.Uint16(frame[0:2])
+	kind := int(sync>>4) & 0x07
+	name := "unknown"
+	if kind < len(frameNames) {
+		name = frameNames[kind]
+	}
+	soc := binary.BigEndian.Uint32(frame[6:10])
+	fracSec := binary.BigEndian.Uint32(frame[10:14])
+	chk := binary.BigEndian.Uint16(frame[len(frame)-2:])
+	crc := synchrophasor.CalcCRC(frame[:len(frame)-2])
+
+	fmt.Fprintf(d.out, "Frame %d at offset %d: %s, %d bytes\n", n, offset, name, len(frame))
+	field := func(label, format string, args ...any) {
+		fmt.Fprintf(d.out, "  %-10s %s\n", label, fmt.Sprintf(format, args...))
+	}
+	field("SYNC", "0x%04X (version %d)", sync, sync&0x0F)
+	field("FRAMESIZE", "%d", len(frame))
+	field("IDCODE", "%d", binary.BigEndian.Uint16(frame[4:6]))
+	field("SOC", "%d (%s)", soc, time.Unix(int64(soc), 0).UTC().Format(time.RFC3339))
+	field("FRACSEC", "0x%08X (%s)", fracSec, timeQuality(fracSec>>24))
+	if chk == crc {
+		field("CHK", "0x%04X OK", chk)
+	} else {
+		field("CHK", "0x%04X MISMATCH, computed 0x%04X", chk, crc)
+	}
+
+	// Decode a copy with a valid CRC, so that corrupted frames still show
+	// their contents
+	fixed := bytes.Clone(frame)
+	binary.BigEndian.PutUint16(fixed[len(fixed)-2:], crc)
+	decoded, err := synchrophasor.UnpackFrame(fixed, d.cfg)
+	if err != nil {
+		switch {
+		case kind == synchrophasor.FrameTypeData && d.cfg == nil:
+			fmt.Fprintln(d.out, "  Data frame not decoded, no configuration (see -config)")
+		case errors.Is(err, synchrophasor.ErrNotImpl):
+			fmt.Fprintf(d.out, "  %s frames are not decoded\n", name)
+		default:
+			fmt.Fprintf(d.out, "  Decoding failed: %v\n", err)
+			return false
+		}
+		return chk == crc
+	}
+
+	switch f := decoded.(type) {
+	case *synchrophasor.ConfigFrame:
+		d.cfg = f
+		d.config(f)
+	case *synchrophasor.Config1Frame:
+		d.config(&f.ConfigFrame)
+	case *synchrophasor.DataFrame:
+		d.data(f, fracSec)
+	case *synchrophasor.HeaderFrame:
+		field("DATA", "%q", f.Data)
+	case *synchrophasor.CommandFrame:
+		field("CMD", "0x%04X (%s)", f.CMD, commandName(f.CMD))
+		if len(f.ExtraFrame) > 0 {
+			field("EXTRAFRAME", "% X", f.ExtraFrame)
+		}
+	}
+	return chk == crc
+}
+
+// timeQuality describes the time quality byte of FRACSEC
+func timeQuality(q uint32) string {
+	var flags []string
+	if q&0x40 != 0 {
+		flags = append(flags, "leap second direction -")
+	}
+	if q&0x20 != 0 {
+		flags = append(flags, "leap second occurred")
+	}
+	if q&0x10 != 0 {
+		flags = append(flags, "leap second pending")
+	}
+	code := q & 0x0F
+	switch {
+	case code == 0:
+		flags = append(flags, "locked to UTC")
+	case code == 0x0F:
+		flags = append(flags, "clock failure, time unreliable")
+	default:
+		flags = append(flags, fmt.Sprintf("time within 10^%d s", int(code)-10))
+	}
+	return strings.Join(flags, ", ")
+}
+
+// commandName names a command code
+func commandName(cmd uint16) string {
+	switch cmd {
+	case synchrophasor.CmdStop:
+		return "turn off transmission"
+	case synchrophasor.CmdStart:
+		return "turn on transmission"
+	case synchrophasor.CmdHeader:
+		return "send header"
+	case synchrophasor.CmdCfg1:
+		return "send CFG-1"
+	case synchrophasor.CmdCfg2:
+		return "send CFG-2"
+	case synchrophasor.CmdCfg3:
+		return "send CFG-3"
+	case synchrophasor.CmdExt:
+		return "extended frame"
+	}
+	return "user defined or reserved"
+}
+
+// config prints the fields of a configuration frame
+func (d *dumper) config(cfg *synchrophasor.ConfigFrame) {
+	fmt.Fprintf(d.out, "  %-10s %d\n", "TIME_BASE", cfg.TimeBase&0xFFFFFF)
+	fmt.Fprintf(d.out, "  %-10s %d\n", "NUM_PMU", cfg.NumPMU)
+	for i, pmu := range cfg.PMUStationList {
+		fmt.Fprintf(d.out, "  Station %d\n", i+1)
+		fmt.Fprintf(d.out, "    %-8s %q\n", "STN", strings.TrimSpace(pmu.STN))
+		fmt.Fprintf(d.out, "    %-8s %d\n", "IDCODE", pmu.IDCode)
+		fmt.Fprintf(d.out, "    %-8s 0x%04X (%s)\n", "FORMAT", pmu.Format, formatName(pmu))
+		fmt.Fprintf(d.out, "    %-8s %d phasors, %d analogs, %d digital words\n", "COUNTS", pmu.Phnmr, pmu.Annmr, pmu.Dgnmr)
+		for j, name := range pmu.CHNAMPhasor {
+			unit := "?"
+			if j < len(pmu.Phunit) {
+				kind := "voltage"
+				if pmu.Phunit[j]>>24 == synchrophasor.PhunitCurrent {
+					kind = "current"
+				}
+				unit = fmt.Sprintf("%s, factor %d", kind, pmu.Phunit[j]&0xFFFFFF)
+			}
+			fmt.Fprintf(d.out, "    Phasor %-2d %-16s %s\n", j+1, strings.TrimSpace(name), unit)
+		}
+		for j, name := range pmu.CHNAMAnalog {
+			unit := "?"
+			if j < len(pmu.Anunit) {
+				unit = fmt.Sprintf("%s, factor %d", analogKind(pmu.Anunit[j]>>24), int32(pmu.Anunit[j]<<8)>>8)
+			}
+			fmt.Fprintf(d.out, "    Analog %-2d %-16s %s\n", j+1, strings.TrimSpace(name), unit)
+		}
+		for w := 0; w < int(pmu.Dgnmr); w++ {
+			var names []string
+			for b := 0; b < 16; b++ {
+				if name := channel(pmu.CHNAMDigital, w*16+b); name != "" {
+					names = append(names, name)
+				}
+			}
+			unit := ""
+			if w < len(pmu.Dgunit) {
+				unit = fmt.Sprintf("normal 0x%04X, valid 0x%04X  ", pmu.Dgunit[w]>>16, pmu.Dgunit[w]&0xFFFF)
+			}
+			fmt.Fprintf(d.out, "    Digital word %d: %s%s\n", w+1, unit, strings.Join(names, " "))
+		}
+		fnom := 60
+		if pmu.Fnom&1 == synchrophasor.FreqNom50Hz {
+			fnom = 50
+		}
+		fmt.Fprintf(d.out, "    %-8s %d Hz\n", "FNOM", fnom)
+		fmt.Fprintf(d.out, "    %-8s %d\n", "CFGCNT", pmu.CfgCnt)
+	}
+	rate := fmt.Sprintf("%d frames per second", cfg.DataRate)
+	if cfg.DataRate < 0 {
+		rate = fmt.Sprintf("one frame every %d seconds", -int(cfg.DataRate))
+	}
+	fmt.Fprintf(d.out, "  %-10s %d (%s)\n", "DATA_RATE", cfg.DataRate, rate)
+}
+
+// formatName describes the FORMAT word of a station
+func formatName(pmu *synchrophasor.PMUStation) string {
+	kind := func(float bool) string {
+		if float {
+			return "float"
+		}
+		return "int"
+	}
+	coord := "rectangular"
+	if pmu.FormatCoord() {
+		coord = "polar"
+	}
+	return fmt.Sprintf("phasors %s %s, analogs %s, frequency %s",
+		kind(pmu.FormatPhasorType()), coord, kind(pmu.FormatAnalogType()), kind(pmu.FormatFreqType()))
+}
+
+// analogKind names the type of an analog channel
+func analogKind(t uint32) string {
+	switch t {
+	case synchrophasor.AnunitPow:
+		return "single point-on-wave"
+	case synchrophasor.AnunitRMS:
+		return "RMS"
+	case synchrophasor.AnunitPeak:
+		return "peak"
+	}
+	return fmt.Sprintf("type %d", t)
+}
+
+// data prints the station blocks of a data frame
+func (d *dumper) data(df *synchrophasor.DataFrame, fracSec uint32) {
+	cfg := df.AssociatedConfig
+	if cfg.TimeBase&0xFFFFFF > 0 {
+		seconds := float64(fracSec&0xFFFFFF) / float64(cfg.TimeBase&0xFFFFFF)
+		stamp := time.Unix(int64(df.SOC), int64(seconds*1e9)).UTC()
+		fmt.Fprintf(d.out, "  %-10s %s\n", "TIME", stamp.Format("2006-01-02 15:04:05.000000 UTC"))
+	}
+	for i, pmu := range cfg.PMUStationList {
+		fmt.Fprintf(d.out, "  Station %d %s (%d)\n", i+1, strings.TrimSpace(pmu.STN), pmu.IDCode)
+		fmt.Fprintf(d.out, "    %-8s 0x%04X (%s)\n", "STAT", pmu.Stat, statName(pmu.Stat))
+		for j, ph := range pmu.PhasorValues {
+			fmt.Fprintf(d.out, "    %-16s %14.4f ∠ %9.4f°\n",
+				channel(pmu.CHNAMPhasor, j), cmplx.Abs(ph), cmplx.Phase(ph)*180/math.Pi)
+		}
+		fmt.Fprintf(d.out, "    %-16s %14.4f Hz\n", "FREQ", pmu.Freq)
+		fmt.Fprintf(d.out, "    %-16s %14.4f Hz/s\n", "DFREQ", pmu.DFreq)
+		for j, v := range pmu.AnalogValues {
+			fmt.Fprintf(d.out, "    %-16s %14.4f\n", channel(pmu.CHNAMAnalog, j), v)
+		}
+		for w, word := range pmu.DigitalValues {
+			var raw uint16
+			var bits []string
+			for b, v := range word {
+				state := "0"
+				if v {
+					raw |= 1 << b
+					state = "1"
+				}
+				if name := channel(pmu.CHNAMDigital, w*16+b); name != "" {
+					bits = append(bits, name+"="+state)
+				}
+			}
+			fmt.Fprintf(d.out, "    Digital word %d: 0x%04X %s\n", w+1, raw, strings.Join(bits, " "))
+		}
+	}
+}
+
+// statName describes the flags of a STAT word
+func statName(stat uint16) string {
+	var flags []string
+	switch stat >> 14 {
+	case 0:
+		flags = append(flags, "good data")
+	case 1:
+		flags = append(flags, "PMU error")
+	case 2:
+		flags = append(flags, "test mode")
+	case 3:
+		flags = append(flags, "data invalid")
+	}
+	for _, f := range []struct {
+		bit  uint16
+		name string
+	}{
+		{0x2000, "sync lost"},
+		{0x1000, "sorted by arrival"},
+		{0x0800, "trigger"},
+		{0x0400, "configuration change"},
+		{0x0200, "data modified"},
+	} {
+		if stat&f.bit != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	if q := stat >> 6 & 0x07; q != 0 {
+		flags = append(flags, fmt.Sprintf("time quality %d", q))
+	}
+	if u := stat >> 4 & 0x03; u != 0 {
+		flags = append(flags, fmt.Sprintf("unlocked time %d", u))
+	}
+	if stat&0x0800 != 0 {
+		flags = append(flags, fmt.Sprintf("trigger reason %d", stat&0x0F))
+	}
+	return strings.Join(flags, ", ")
+}
+
+// channel returns the trimmed name of channel i, empty if unnamed
+func channel(names []string, i int) string {
+	if i >= len(names) {
+		return ""
+	}
+	return strings.TrimSpace(names[i])
+}
@@ -0,0 +1,79 @@
+// c37load opens many concurrent PDC connections to a PMU server, turns the
+// data stream on for all of them and reports the frame rates, latencies and
+// errors seen per connection. Thousands of connections need a raised open
+// files limit (ulimit -n). It exits with 1 if a connection failed or a frame
+// was corrupted and 2 if no connection could be made.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor/loadgen"
+)
+
+func main() {
+	connections := flag.Int("n", 100, "number of concurrent connections")
+	ramp := flag.Duration("ramp", 0, "spread opening the connections over this time")
+	duration := flag.Duration("duration", 30*time.Second, "measure the streams this long after the ramp")
+	idCode := flag.Uint("id", 1, "IDCODE sent in the command frames")
+	timeout := flag.Duration("timeout", 5*time.Second, "fail connections silent for this long")
+	decode := flag.Bool("decode", false, "decode every data frame instead of checking only framing and CRC")
+	interval := flag.Duration("progress", 5*time.Second, "log the progress this often, 0 disables")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] host:port\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	opts := loadgen.Options{
+		Connections: *connections,
+		Ramp:        *ramp,
+		Duration:    *duration,
+		IDCode:      uint16(*idCode),
+		Timeout:     *timeout,
+		Decode:      *decode,
+	}
+	if *interval > 0 {
+		opts.Interval = *interval
+		opts.Progress = func(s loadgen.Snapshot) {
+			log.Printf("%5.0fs  %d connected, %d frames, %.0f fps, %d errors",
+				s.Elapsed.Seconds(), s.Connected, s.Frames, s.FPS, s.Errors)
+		}
+	}
+	log.Printf("Opening %d connections to %s", *connections, flag.Arg(0))
+	report := loadgen.Run(ctx, flag.Arg(0), opts)
+
+	var err error
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = report.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	switch {
+	case report.Connected == 0:
+		os.Exit(2)
+	case report.Failed():
+		os.Exit(1)
+	}
+}
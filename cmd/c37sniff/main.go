@@ -0,0 +1,246 @@
+// c37sniff captures C37.118 traffic on a network interface or reads it from
+// a pcap file, follows the TCP and UDP conversations and prints the decoded
+// frames as they arrive
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/cmplx"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/pcap"
+)
+
+// frameTypes maps the -type names to frame types
+var frameTypes = map[string]synchrophasor.FrameType{
+	"data":   synchrophasor.FrameTypeData,
+	"header": synchrophasor.FrameTypeHeader,
+	"cfg1":   synchrophasor.FrameTypeCfg1,
+	"cfg2":   synchrophasor.FrameTypeCfg2,
+	"cmd":    synchrophasor.FrameTypeCmd,
+	"cfg3":   synchrophasor.FrameTypeCfg3,
+}
+
+// frameNames names the frame types in the output
+var frameNames = [...]string{"DATA", "HEADER", "CFG-1", "CFG-2", "CMD", "CFG-3"}
+
+func main() {
+	iface := flag.String("i", "any", "capture on this network interface")
+	file := flag.String("r", "", "read this pcap or pcapng file instead of capturing")
+	ports := flag.String("ports", "4712,4713", "comma-separated TCP and UDP ports carrying C37.118")
+	ids := flag.String("id", "", "comma-separated IDCODEs to show, all if empty")
+	types := flag.String("type", "",
+		"comma-separated frame types to show (data, header, cfg1, cfg2, cfg3, cmd), all if empty")
+	verbose := flag.Bool("v", false, "print the channel values of data frames and the stations of configuration frames")
+	dump := flag.Bool("x", false, "print the raw bytes of every frame")
+	flag.Parse()
+
+	opts := pcap.Options{}
+	for _, p := range splitList(*ports) {
+		port, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			log.Fatalf("Invalid port %q", p)
+		}
+		opts.Ports = append(opts.Ports, uint16(port))
+	}
+	idFilter := make(map[uint16]bool)
+	for _, s := range splitList(*ids) {
+		id, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			log.Fatalf("Invalid IDCODE %q", s)
+		}
+		idFilter[uint16(id)] = true
+	}
+	typeFilter := make(map[synchrophasor.FrameType]bool)
+	for _, s := range splitList(*types) {
+		t, ok := frameTypes[strings.ToLower(s)]
+		if !ok {
+			log.Fatalf("Invalid frame type %q", s)
+		}
+		typeFilter[t] = true
+	}
+
+	var d *pcap.Decoder
+	var err error
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Failed to open capture: %v", err)
+		}
+		defer func() { _ = f.Close() }()
+		d, err = pcap.NewDecoder(f, opts)
+		if err != nil {
+			log.Fatalf("Failed to read capture: %v", err)
+		}
+	} else {
+		d, err = pcap.NewLiveDecoder(*iface, opts)
+		if err != nil {
+			log.Fatalf("Failed to capture on %s: %v", *iface, err)
+		}
+		log.Printf("Capturing on %s, ports %s", *iface, *ports)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		_ = d.Close()
+	}()
+
+	shown, total, failed := 0, 0, 0
+	for {
+		frame, err := d.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Failed to read frame: %v", err)
+		}
+		total++
+		if frame.Err != nil {
+			failed++
+		}
+
+		kind, _ := synchrophasor.GetFrameType(frame.Data)
+		id := uint16(frame.Data[4])<<8 | uint16(frame.Data[5])
+		if len(typeFilter) > 0 && !typeFilter[kind] || len(idFilter) > 0 && !idFilter[id] {
+			continue
+		}
+		shown++
+		printFrame(os.Stdout, frame, kind, id, *verbose)
+		if *dump {
+			fmt.Print(hex.Dump(frame.Data))
+		}
+	}
+	log.Printf("%d frames, %d shown, %d failed to decode", total, shown, failed)
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printFrame writes a one-line summary of a frame, followed by its stations or
+// channels if verbose
+func printFrame(w io.Writer, frame *pcap.Decoded, kind synchrophasor.FrameType, id uint16, verbose bool) {
+	name := "UNKNOWN"
+	if int(kind) < len(frameNames) {
+		name = frameNames[kind]
+	}
+	fmt.Fprintf(w, "%s %s > %s %s %-6s id=%d len=%d",
+		frame.Time.Local().Format("15:04:05.000000"), frame.Src, frame.Dst, frame.Transport, name, id, len(frame.Data))
+	if frame.Err != nil {
+		fmt.Fprintf(w, " error: %v\n", frame.Err)
+		return
+	}
+
+	switch f := frame.Value.(type) {
+	case *synchrophasor.DataFrame:
+		data(w, f, verbose)
+	case *synchrophasor.ConfigFrame:
+		config(w, f, verbose)
+	case *synchrophasor.Config1Frame:
+		config(w, &f.ConfigFrame, verbose)
+	case *synchrophasor.CommandFrame:
+		fmt.Fprintf(w, " %s\n", commandName(f.CMD))
+	case *synchrophasor.HeaderFrame:
+		fmt.Fprintf(w, " %q\n", f.Data)
+	default:
+		fmt.Fprintln(w)
+	}
+}
+
+// data prints the timestamp and station summaries of a data frame
+func data(w io.Writer, df *synchrophasor.DataFrame, verbose bool) {
+	cfg := df.AssociatedConfig
+	if base := cfg.TimeBase & 0xFFFFFF; base > 0 {
+		frac := float64(df.FracSec&0xFFFFFF) / float64(base)
+		stamp := time.Unix(int64(df.SOC), int64(frac*1e9)).UTC()
+		fmt.Fprintf(w, " %s", stamp.Format("2006-01-02T15:04:05.000000Z"))
+	}
+	for _, pmu := range cfg.PMUStationList {
+		fmt.Fprintf(w, " | %s %.3f Hz stat=0x%04X", strings.TrimSpace(pmu.STN), pmu.Freq, pmu.Stat)
+	}
+	fmt.Fprintln(w)
+	if !verbose {
+		return
+	}
+	for _, pmu := range cfg.PMUStationList {
+		fmt.Fprintf(w, "    %s (%d) ROCOF %.4f Hz/s\n", strings.TrimSpace(pmu.STN), pmu.IDCode, pmu.DFreq)
+		for j, ph := range pmu.PhasorValues {
+			fmt.Fprintf(w, "      %-16s %14.4f ∠ %9.4f°\n",
+				channel(pmu.CHNAMPhasor, j), cmplx.Abs(ph), cmplx.Phase(ph)*180/math.Pi)
+		}
+		for j, v := range pmu.AnalogValues {
+			fmt.Fprintf(w, "      %-16s %14.4f\n", channel(pmu.CHNAMAnalog, j), v)
+		}
+		for i, word := range pmu.DigitalValues {
+			var bits []string
+			for b, v := range word {
+				if name := channel(pmu.CHNAMDigital, i*16+b); name != "" && v {
+					bits = append(bits, name)
+				}
+			}
+			fmt.Fprintf(w, "      digital %d set: %s\n", i+1, strings.Join(bits, " "))
+		}
+	}
+}
+
+// config prints the layout of a configuration frame
+func config(w io.Writer, cfg *synchrophasor.ConfigFrame, verbose bool) {
+	fmt.Fprintf(w, " %d stations, %d fps, time base %d\n", cfg.NumPMU, cfg.DataRate, cfg.TimeBase&0xFFFFFF)
+	if !verbose {
+		return
+	}
+	for _, pmu := range cfg.PMUStationList {
+		fmt.Fprintf(w, "    %s (%d) cfgcnt %d: %d phasors, %d analogs, %d digital words\n",
+			strings.TrimSpace(pmu.STN), pmu.IDCode, pmu.CfgCnt, pmu.Phnmr, pmu.Annmr, pmu.Dgnmr)
+	}
+}
+
+// commandName names a command code
+func commandName(cmd uint16) string {
+	switch cmd {
+	case synchrophasor.CmdStop:
+		return "turn off transmission"
+	case synchrophasor.CmdStart:
+		return "turn on transmission"
+	case synchrophasor.CmdHeader:
+		return "send header"
+	case synchrophasor.CmdCfg1:
+		return "send CFG-1"
+	case synchrophasor.CmdCfg2:
+		return "send CFG-2"
+	case synchrophasor.CmdCfg3:
+		return "send CFG-3"
+	case synchrophasor.CmdExt:
+		return "extended frame"
+	}
+	return fmt.Sprintf("command 0x%04X", cmd)
+}
+
+// channel returns the trimmed name of channel i, empty if unnamed
+func channel(names []string, i int) string {
+	if i >= len(names) {
+		return ""
+	}
+	return strings.TrimSpace(names[i])
+}
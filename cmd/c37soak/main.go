@@ -0,0 +1,83 @@
+// c37soak runs simulated PMUs, a gateway and PDCs in one process for hours
+// and checks the goroutine, heap and latency trends for leaks and slow
+// degradation. It prints a report of the checks, optionally writes the full
+// report with every sample as JSON, and exits with 1 if a check failed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor/soak"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	pmus := flag.Int("pmus", 4, "number of simulated PMU servers")
+	rate := flag.Int("rate", 50, "frames per second of the simulated PMUs")
+	consumers := flag.Int("consumers", 2, "number of PDCs reading every republished stream")
+	duration := flag.Duration("duration", time.Hour, "length of the run")
+	interval := flag.Duration("interval", 10*time.Second, "sampling period")
+	warmup := flag.Duration("warmup", 0, "time excluded from the trends, defaults to a tenth of the duration")
+	goroutines := flag.Float64("max-goroutine-growth", 0, "accepted goroutines per hour (default 10)")
+	heap := flag.Float64("max-heap-growth", 0, "accepted live heap MB per hour (default 16)")
+	leaked := flag.Int("max-leaked", 0, "accepted goroutines remaining after shutdown (default 5)")
+	gaps := flag.Float64("max-gap-ratio", 0, "accepted share of missed frames (default 0.001)")
+	drift := flag.Float64("max-drift", 0, "accepted latency growth in ms per hour (default 50)")
+	reportPath := flag.String("report", "", "write the report as JSON to this file")
+	verbose := flag.Bool("v", false, "log the servers and the gateway")
+	flag.Parse()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	opts := soak.Options{
+		PMUs:      *pmus,
+		DataRate:  int16(*rate),
+		Consumers: *consumers,
+		Duration:  *duration,
+		Interval:  *interval,
+		Warmup:    *warmup,
+		Limits: soak.Limits{
+			GoroutinesPerHour: *goroutines,
+			HeapMBPerHour:     *heap,
+			LeakedGoroutines:  *leaked,
+			GapRatio:          *gaps,
+			DriftMsPerHour:    *drift,
+		},
+		Progress: func(s soak.Sample) {
+			log.Printf("%6.0fs  %d goroutines, heap %.1f MB, %d frames, %d gaps, %d reconnects, latency %.1f ms",
+				s.Elapsed, s.Goroutines, float64(s.HeapAlloc)/1e6, s.Frames, s.Gaps, s.Reconnects, s.LatencyMean)
+		},
+	}
+	if *verbose {
+		opts.Logger = logrus.StandardLogger()
+	}
+	log.Printf("Soaking %d PMUs at %d fps with %d consumers for %s", *pmus, *rate, *consumers, *duration)
+	report, err := soak.Run(ctx, opts)
+	if err != nil {
+		log.Fatalf("Failed to run: %v", err)
+	}
+
+	if err := report.WriteText(os.Stdout); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode report: %v", err)
+		}
+		if err := os.WriteFile(*reportPath, append(data, '\n'), 0o644); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,7 @@ package synchrophasor
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 )
 
 // CommandFrame represents a command frame
@@ -22,26 +23,30 @@ func NewCommandFrame() *CommandFrame {
 
 // Pack converts command frame to bytes
 func (c *CommandFrame) Pack() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	return c.AppendTo(nil)
+}
+
+// AppendTo appends the packed command frame to dst and returns the extended slice
+func (c *CommandFrame) AppendTo(dst []byte) ([]byte, error) {
+	// Update frame size
+	c.FrameSize = uint16(18 + len(c.ExtraFrame))
+
+	start := len(dst)
 
 	// Write header and command
-	if err := writeBinary(buf, c.Sync, c.FrameSize, c.IDCode, c.SOC, c.FracSec, c.CMD); err != nil {
-		return nil, err
-	}
+	dst = c.appendHeader(dst)
+	dst = binary.BigEndian.AppendUint16(dst, c.CMD)
 
 	// Write extra frame if exists
-	if c.ExtraFrame != nil {
-		buf.Write(c.ExtraFrame)
-	}
+	dst = append(dst, c.ExtraFrame...)
 
-	// Calculate and write CRC
-	data := buf.Bytes()
-	crc := CalcCRC(data)
-	if err := binary.Write(buf, binary.BigEndian, crc); err != nil {
-		return nil, err
-	}
+	// Write CRC
+	return appendCRC(dst, start), nil
+}
 
-	return buf.Bytes(), nil
+// PackTo writes the command frame to w in a single call using a pooled buffer and returns the number of bytes written
+func (c *CommandFrame) PackTo(w io.Writer) (int, error) {
+	return packTo(w, c)
 }
 
 // Unpack parses bytes into command frame
@@ -57,7 +62,7 @@ func (c *CommandFrame) Unpack(data []byte) error {
 		return err
 	}
 
-	if c.FrameSize < 18 {
+	if c.FrameSize < 18 || int(c.FrameSize) > len(data) {
 		return ErrInvalidSize
 	}
 
@@ -66,8 +71,9 @@ func (c *CommandFrame) Unpack(data []byte) error {
 	}
 
 	// Read extra frame if exists
+	c.ExtraFrame = nil
 	extraSize := int(c.FrameSize) - 18
-	if extraSize > 0 && extraSize < 65518 {
+	if extraSize > 0 {
 		c.ExtraFrame = make([]byte, extraSize)
 		if _, err := buf.Read(c.ExtraFrame); err != nil {
 			return err
@@ -0,0 +1,540 @@
+// Package comtrade reads IEEE C37.111 (COMTRADE) records so recorded disturbances
+// can be streamed through a synchrophasor PMU server
+package comtrade
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Data file formats
+const (
+	FormatASCII    = "ASCII"
+	FormatBinary   = "BINARY"
+	FormatBinary32 = "BINARY32"
+	FormatFloat32  = "FLOAT32"
+)
+
+// Custom error types
+var (
+	ErrInvalidConfig = errors.New("invalid COMTRADE configuration")
+	ErrInvalidData   = errors.New("invalid COMTRADE data")
+)
+
+// AnalogChannel describes an analog channel of a record
+type AnalogChannel struct {
+	Index     int
+	Name      string
+	Phase     string
+	Component string
+	Unit      string
+	A         float64
+	B         float64
+	Skew      float64
+	Min       float64
+	Max       float64
+	Primary   float64
+	Secondary float64
+	PS        string
+}
+
+// DigitalChannel describes a digital (status) channel of a record
+type DigitalChannel struct {
+	Index     int
+	Name      string
+	Phase     string
+	Component string
+	Normal    bool
+}
+
+// SampleRate is a sampling rate valid up to and including EndSample
+type SampleRate struct {
+	Rate      float64
+	EndSample int
+}
+
+// Sample is one row of the data file, with analog values already scaled
+type Sample struct {
+	Number  int
+	Time    time.Duration // offset from the record start
+	Analog  []float64
+	Digital []bool
+}
+
+// Record is a parsed COMTRADE configuration together with its samples
+type Record struct {
+	StationName string
+	DeviceID    string
+	Revision    int
+	Analog      []AnalogChannel
+	Digital     []DigitalChannel
+	LineFreq    float64
+	SampleRates []SampleRate
+	StartTime   time.Time
+	TriggerTime time.Time
+	Format      string
+	TimeMult    float64
+	Samples     []Sample
+}
+
+// Load reads a record from a .cfg file and the .dat file next to it
+func Load(cfgPath string) (*Record, error) {
+	cfgFile, err := os.Open(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = cfgFile.Close() }()
+
+	datPath := strings.TrimSuffix(cfgPath, filepath.Ext(cfgPath))
+	datFile, err := openDat(datPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = datFile.Close() }()
+
+	return Parse(cfgFile, datFile)
+}
+
+// openDat opens the data file, accepting upper and lower case extensions
+func openDat(base string) (*os.File, error) {
+	f, err := os.Open(base + ".dat")
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(base + ".DAT")
+	}
+	return f, err
+}
+
+// Parse reads a record from its configuration and data
+func Parse(cfg io.Reader, dat io.Reader) (*Record, error) {
+	rec, err := ParseConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rec.readData(dat); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// ParseConfig reads a .cfg file without any samples
+func ParseConfig(cfg io.Reader) (*Record, error) {
+	lines, err := readLines(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &cfgParser{lines: lines}
+	rec := &Record{Revision: 1991, TimeMult: 1}
+
+	// Station name, device and revision year
+	fields := p.next()
+	if len(fields) < 2 {
+		return nil, p.errorf("station line")
+	}
+	rec.StationName = fields[0]
+	rec.DeviceID = fields[1]
+	if len(fields) > 2 && fields[2] != "" {
+		if rec.Revision, err = strconv.Atoi(fields[2]); err != nil {
+			return nil, p.errorf("revision year")
+		}
+	}
+
+	// Channel counts: TT,##A,##D
+	fields = p.next()
+	if len(fields) < 3 {
+		return nil, p.errorf("channel counts")
+	}
+	numAnalog, err1 := strconv.Atoi(strings.TrimSuffix(strings.ToUpper(fields[1]), "A"))
+	numDigital, err2 := strconv.Atoi(strings.TrimSuffix(strings.ToUpper(fields[2]), "D"))
+	if err1 != nil || err2 != nil {
+		return nil, p.errorf("channel counts")
+	}
+
+	for i := 0; i < numAnalog; i++ {
+		ch, err := p.analogChannel()
+		if err != nil {
+			return nil, err
+		}
+		rec.Analog = append(rec.Analog, ch)
+	}
+
+	for i := 0; i < numDigital; i++ {
+		ch, err := p.digitalChannel()
+		if err != nil {
+			return nil, err
+		}
+		rec.Digital = append(rec.Digital, ch)
+	}
+
+	// Line frequency
+	if rec.LineFreq, err = p.float(p.next(), 0); err != nil {
+		return nil, err
+	}
+
+	// Sample rates
+	nrates, err := p.float(p.next(), 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < int(nrates); i++ {
+		fields := p.next()
+		rate, err := p.float(fields, 0)
+		if err != nil {
+			return nil, err
+		}
+		end, err := p.float(fields, 1)
+		if err != nil {
+			return nil, err
+		}
+		rec.SampleRates = append(rec.SampleRates, SampleRate{Rate: rate, EndSample: int(end)})
+	}
+	// A single "0" rate line is present when the timestamps are authoritative
+	if nrates == 0 {
+		p.next()
+	}
+
+	if rec.StartTime, err = p.timestamp(); err != nil {
+		return nil, err
+	}
+	if rec.TriggerTime, err = p.timestamp(); err != nil {
+		return nil, err
+	}
+
+	fields = p.next()
+	if len(fields) < 1 {
+		return nil, p.errorf("file type")
+	}
+	rec.Format = strings.ToUpper(fields[0])
+	switch rec.Format {
+	case FormatASCII, FormatBinary, FormatBinary32, FormatFloat32:
+	default:
+		return nil, p.errorf("file type %q", rec.Format)
+	}
+
+	// Time multiplier, absent in 1991 files
+	if fields := p.next(); len(fields) > 0 && fields[0] != "" {
+		if rec.TimeMult, err = p.float(fields, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+// Duration returns the time of the last sample
+func (r *Record) Duration() time.Duration {
+	if len(r.Samples) == 0 {
+		return 0
+	}
+	return r.Samples[len(r.Samples)-1].Time
+}
+
+// SampleAt returns the last sample at or before offset
+func (r *Record) SampleAt(offset time.Duration) *Sample {
+	if len(r.Samples) == 0 {
+		return nil
+	}
+
+	lo, hi := 0, len(r.Samples)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if r.Samples[mid].Time <= offset {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return &r.Samples[lo]
+}
+
+// AnalogIndex returns the position of the analog channel with the given name, or -1
+func (r *Record) AnalogIndex(name string) int {
+	for i, ch := range r.Analog {
+		if ch.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// sampleTime returns the offset of sample n (1-based) from the sample rates,
+// or false if the data file timestamps have to be used
+func (r *Record) sampleTime(n int) (time.Duration, bool) {
+	if len(r.SampleRates) == 0 {
+		return 0, false
+	}
+
+	var offset float64
+	prevEnd := 0
+	for _, rate := range r.SampleRates {
+		if rate.Rate <= 0 {
+			return 0, false
+		}
+		if n <= rate.EndSample {
+			offset += float64(n-1-prevEnd) / rate.Rate
+			return time.Duration(offset * float64(time.Second)), true
+		}
+		offset += float64(rate.EndSample-prevEnd) / rate.Rate
+		prevEnd = rate.EndSample
+	}
+	return 0, false
+}
+
+// readData reads the samples of the data file
+func (r *Record) readData(dat io.Reader) error {
+	if r.Format == FormatASCII {
+		return r.readASCII(dat)
+	}
+	return r.readBinary(dat)
+}
+
+// readASCII reads an ASCII data file
+func (r *Record) readASCII(dat io.Reader) error {
+	scanner := bufio.NewScanner(dat)
+	want := 2 + len(r.Analog) + len(r.Digital)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line == "\x1a" {
+			continue
+		}
+
+		fields := strings.Split(line, ",")
+		if len(fields) < want {
+			return fmt.Errorf("%w: sample has %d fields, want %d", ErrInvalidData, len(fields), want)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return fmt.Errorf("%w: sample number %q", ErrInvalidData, fields[0])
+		}
+		ts, err := parseOptionalFloat(fields[1])
+		if err != nil {
+			return fmt.Errorf("%w: timestamp %q", ErrInvalidData, fields[1])
+		}
+
+		sample := r.newSample(n, ts)
+		for i := range r.Analog {
+			raw, err := parseOptionalFloat(fields[2+i])
+			if err != nil {
+				return fmt.Errorf("%w: analog value %q", ErrInvalidData, fields[2+i])
+			}
+			sample.Analog[i] = r.Analog[i].A*raw + r.Analog[i].B
+		}
+		for i := range r.Digital {
+			sample.Digital[i] = strings.TrimSpace(fields[2+len(r.Analog)+i]) == "1"
+		}
+		r.Samples = append(r.Samples, sample)
+	}
+
+	return scanner.Err()
+}
+
+// readBinary reads a BINARY, BINARY32 or FLOAT32 data file
+func (r *Record) readBinary(dat io.Reader) error {
+	analogSize := 2
+	if r.Format != FormatBinary {
+		analogSize = 4
+	}
+	digitalWords := (len(r.Digital) + 15) / 16
+	row := make([]byte, 8+analogSize*len(r.Analog)+2*digitalWords)
+	br := bufio.NewReader(dat)
+
+	for {
+		if _, err := io.ReadFull(br, row); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("%w: %v", ErrInvalidData, err)
+		}
+
+		n := int(binary.LittleEndian.Uint32(row[0:4]))
+		rawTS := binary.LittleEndian.Uint32(row[4:8])
+		ts := float64(rawTS)
+		if rawTS == 0xFFFFFFFF {
+			ts = math.NaN()
+		}
+
+		sample := r.newSample(n, ts)
+		off := 8
+		for i := range r.Analog {
+			var raw float64
+			switch r.Format {
+			case FormatBinary:
+				raw = float64(int16(binary.LittleEndian.Uint16(row[off:])))
+			case FormatBinary32:
+				raw = float64(int32(binary.LittleEndian.Uint32(row[off:])))
+			case FormatFloat32:
+				raw = float64(math.Float32frombits(binary.LittleEndian.Uint32(row[off:])))
+			}
+			sample.Analog[i] = r.Analog[i].A*raw + r.Analog[i].B
+			off += analogSize
+		}
+		for i := range r.Digital {
+			word := binary.LittleEndian.Uint16(row[off+2*(i/16):])
+			sample.Digital[i] = word&(1<<uint(i%16)) != 0
+		}
+		r.Samples = append(r.Samples, sample)
+	}
+}
+
+// newSample creates a sample, timing it from the sample rates or the raw timestamp
+func (r *Record) newSample(n int, rawTS float64) Sample {
+	offset, ok := r.sampleTime(n)
+	if !ok && !math.IsNaN(rawTS) {
+		offset = time.Duration(rawTS * r.TimeMult * float64(time.Microsecond))
+	}
+
+	return Sample{
+		Number:  n,
+		Time:    offset,
+		Analog:  make([]float64, len(r.Analog)),
+		Digital: make([]bool, len(r.Digital)),
+	}
+}
+
+// cfgParser walks the lines of a configuration file
+type cfgParser struct {
+	lines []string
+	pos   int
+}
+
+// next returns the comma separated fields of the next line
+func (p *cfgParser) next() []string {
+	if p.pos >= len(p.lines) {
+		p.pos++
+		return nil
+	}
+	fields := strings.Split(p.lines[p.pos], ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	p.pos++
+	return fields
+}
+
+// errorf reports a configuration error at the current line
+func (p *cfgParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: line %d: %s", ErrInvalidConfig, p.pos, fmt.Sprintf(format, args...))
+}
+
+// float parses field i of fields
+func (p *cfgParser) float(fields []string, i int) (float64, error) {
+	if i >= len(fields) {
+		return 0, p.errorf("missing field %d", i+1)
+	}
+	v, err := strconv.ParseFloat(fields[i], 64)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", fields[i])
+	}
+	return v, nil
+}
+
+// analogChannel parses An,ch_id,ph,ccbm,uu,a,b,skew,min,max[,primary,secondary,PS]
+func (p *cfgParser) analogChannel() (AnalogChannel, error) {
+	fields := p.next()
+	if len(fields) < 10 {
+		return AnalogChannel{}, p.errorf("analog channel")
+	}
+
+	ch := AnalogChannel{
+		Name:      fields[1],
+		Phase:     fields[2],
+		Component: fields[3],
+		Unit:      fields[4],
+		Primary:   1,
+		Secondary: 1,
+		PS:        "P",
+	}
+
+	var err error
+	if ch.Index, err = strconv.Atoi(fields[0]); err != nil {
+		return ch, p.errorf("analog channel index %q", fields[0])
+	}
+	values := []*float64{&ch.A, &ch.B, &ch.Skew, &ch.Min, &ch.Max}
+	for i, v := range values {
+		if *v, err = parseOptionalFloat(fields[5+i]); err != nil {
+			return ch, p.errorf("analog channel %s field %d", ch.Name, 6+i)
+		}
+	}
+	if len(fields) >= 13 {
+		if ch.Primary, err = p.float(fields, 10); err != nil {
+			return ch, err
+		}
+		if ch.Secondary, err = p.float(fields, 11); err != nil {
+			return ch, err
+		}
+		ch.PS = strings.ToUpper(fields[12])
+	}
+
+	return ch, nil
+}
+
+// digitalChannel parses Dn,ch_id,ph,ccbm,y (1999+) or Dn,ch_id,y (1991)
+func (p *cfgParser) digitalChannel() (DigitalChannel, error) {
+	fields := p.next()
+	if len(fields) < 3 {
+		return DigitalChannel{}, p.errorf("digital channel")
+	}
+
+	ch := DigitalChannel{Name: fields[1]}
+	var err error
+	if ch.Index, err = strconv.Atoi(fields[0]); err != nil {
+		return ch, p.errorf("digital channel index %q", fields[0])
+	}
+	if len(fields) >= 5 {
+		ch.Phase = fields[2]
+		ch.Component = fields[3]
+	}
+	ch.Normal = fields[len(fields)-1] == "1"
+
+	return ch, nil
+}
+
+// timestamp parses dd/mm/yyyy,hh:mm:ss.ssssss
+func (p *cfgParser) timestamp() (time.Time, error) {
+	fields := p.next()
+	if len(fields) < 2 {
+		return time.Time{}, p.errorf("timestamp")
+	}
+
+	value := fields[0] + "," + fields[1]
+	for _, layout := range []string{"02/01/2006,15:04:05.999999999", "01/02/06,15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, p.errorf("timestamp %q", value)
+}
+
+// readLines reads all non-empty lines
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// parseOptionalFloat parses a number, treating an empty field as zero
+func parseOptionalFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
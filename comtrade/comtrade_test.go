@@ -0,0 +1,109 @@
+package comtrade
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `SUBSTATION A,REC1,1999
+3,2A,1D
+1,VA_MAG,A,,kV,0.5,0,0,-32767,32767,1,1,P
+2,VA_ANG,A,,deg,0.01,0,0,-32767,32767,1,1,P
+1,BRK1,,,0
+50
+1
+1000,4
+15/10/2026,12:00:00.000000
+15/10/2026,12:00:00.002000
+ASCII
+1
+`
+
+const testData = `1,0,200,0,0
+2,1000,202,1000,0
+3,2000,204,2000,1
+4,3000,206,3000,1
+`
+
+func TestParseASCII(t *testing.T) {
+	rec, err := Parse(strings.NewReader(testConfig), strings.NewReader(testData))
+	require.NoError(t, err)
+
+	require.Equal(t, "SUBSTATION A", rec.StationName)
+	require.Equal(t, 1999, rec.Revision)
+	require.Len(t, rec.Analog, 2)
+	require.Len(t, rec.Digital, 1)
+	require.Equal(t, 50.0, rec.LineFreq)
+	require.Equal(t, 2*time.Millisecond, rec.TriggerTime.Sub(rec.StartTime))
+
+	require.Len(t, rec.Samples, 4)
+	require.Equal(t, 3*time.Millisecond, rec.Duration())
+	require.InDelta(t, 101.0, rec.Samples[1].Analog[0], 1e-9)
+	require.InDelta(t, 10.0, rec.Samples[1].Analog[1], 1e-9)
+	require.True(t, rec.Samples[2].Digital[0])
+
+	require.Equal(t, 3, rec.SampleAt(2500*time.Microsecond).Number)
+	require.Equal(t, 4, rec.SampleAt(time.Second).Number)
+}
+
+func TestParseBinary(t *testing.T) {
+	cfg := strings.Replace(testConfig, "ASCII", "BINARY", 1)
+
+	var dat bytes.Buffer
+	for i := 0; i < 4; i++ {
+		_ = binary.Write(&dat, binary.LittleEndian, uint32(i+1))
+		_ = binary.Write(&dat, binary.LittleEndian, uint32(i*1000))
+		_ = binary.Write(&dat, binary.LittleEndian, int16(200+2*i))
+		_ = binary.Write(&dat, binary.LittleEndian, int16(-1000*i))
+		_ = binary.Write(&dat, binary.LittleEndian, uint16(i/2))
+	}
+
+	rec, err := Parse(strings.NewReader(cfg), &dat)
+	require.NoError(t, err)
+	require.Len(t, rec.Samples, 4)
+	require.InDelta(t, 103.0, rec.Samples[3].Analog[0], 1e-9)
+	require.InDelta(t, -30.0, rec.Samples[3].Analog[1], 1e-9)
+	require.False(t, rec.Samples[1].Digital[0])
+	require.True(t, rec.Samples[3].Digital[0])
+}
+
+func TestPlayerUpdate(t *testing.T) {
+	rec, err := Parse(strings.NewReader(testConfig), strings.NewReader(testData))
+	require.NoError(t, err)
+
+	player, err := NewPlayer(rec, PlayerOptions{
+		Phasors: []PhasorMapping{{Name: "VA", Magnitude: 0, Angle: 1}},
+		Analogs: []int{},
+		Loop:    true,
+	})
+	require.NoError(t, err)
+
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.AddPMUStation(player.NewStation("Playback", 1))
+	station := cfg.PMUStationList[0]
+	require.Equal(t, uint16(1), station.Phnmr)
+	require.Equal(t, uint16(1), station.Dgnmr)
+	require.Equal(t, float32(50), station.GetNominalFrequency())
+
+	start := time.Now()
+	require.NoError(t, player.Update(cfg, start))
+	require.InDelta(t, 100.0, real(station.PhasorValues[0]), 1e-6)
+
+	require.NoError(t, player.Update(cfg, start.Add(2*time.Millisecond)))
+	require.InDelta(t, 102.0, math.Hypot(real(station.PhasorValues[0]), imag(station.PhasorValues[0])), 1e-6)
+	require.True(t, station.DigitalValues[0][0])
+
+	// Loops back to the start of the record
+	require.NoError(t, player.Update(cfg, start.Add(4*time.Millisecond)))
+	require.InDelta(t, 101.0, math.Hypot(real(station.PhasorValues[0]), imag(station.PhasorValues[0])), 1e-6)
+
+	_, err = cfg.Pack()
+	require.NoError(t, err)
+}
@@ -0,0 +1,196 @@
+package comtrade
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// PhasorMapping builds a phasor from a magnitude and an angle channel
+type PhasorMapping struct {
+	Name      string
+	Magnitude int // analog channel index
+	Angle     int // analog channel index, angle in degrees
+	Current   bool
+}
+
+// PlayerOptions configures how a record is mapped onto a PMU station
+type PlayerOptions struct {
+	// Station is the index of the station in the configuration frame to update
+	Station int
+	// Phasors maps analog channel pairs to phasor values
+	Phasors []PhasorMapping
+	// Analogs lists the analog channels sent as analog values; nil sends all
+	Analogs []int
+	// Frequency names the analog channel carrying frequency in Hz; empty sends nominal
+	Frequency string
+	// Loop restarts playback at the end of the record instead of holding the last sample
+	Loop bool
+}
+
+// Player replays a record as a synchrophasor.DataProvider
+type Player struct {
+	record  *Record
+	options PlayerOptions
+	analogs []int
+	freq    int
+	mu      sync.Mutex
+	start   time.Time
+	prev    *Sample
+}
+
+// NewPlayer creates a player for the record
+func NewPlayer(record *Record, options PlayerOptions) (*Player, error) {
+	if len(record.Samples) == 0 {
+		return nil, fmt.Errorf("%w: record has no samples", ErrInvalidData)
+	}
+
+	check := func(index int) error {
+		if index < 0 || index >= len(record.Analog) {
+			return fmt.Errorf("%w: analog channel %d out of range", ErrInvalidConfig, index)
+		}
+		return nil
+	}
+	for _, ph := range options.Phasors {
+		if err := check(ph.Magnitude); err != nil {
+			return nil, err
+		}
+		if err := check(ph.Angle); err != nil {
+			return nil, err
+		}
+	}
+	for _, index := range options.Analogs {
+		if err := check(index); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &Player{record: record, options: options, analogs: options.Analogs, freq: -1}
+	if p.analogs == nil {
+		p.analogs = make([]int, len(record.Analog))
+		for i := range p.analogs {
+			p.analogs[i] = i
+		}
+	}
+	if options.Frequency != "" {
+		if p.freq = record.AnalogIndex(options.Frequency); p.freq < 0 {
+			return nil, fmt.Errorf("%w: no analog channel %q", ErrInvalidConfig, options.Frequency)
+		}
+	}
+
+	return p, nil
+}
+
+// NewStation creates a PMU station whose channels match the player options.
+// Values are sent as floating point polar phasors so no scaling is needed.
+func (p *Player) NewStation(name string, idCode uint16) *synchrophasor.PMUStation {
+	station := synchrophasor.NewPMUStation(name, idCode, true, true, true, true)
+	if p.record.LineFreq == 50 {
+		station.Fnom = synchrophasor.FreqNom50Hz
+	}
+
+	for _, ph := range p.options.Phasors {
+		phType := uint8(synchrophasor.PhunitVoltage)
+		if ph.Current {
+			phType = synchrophasor.PhunitCurrent
+		}
+		station.AddPhasor(ph.Name, 1, phType)
+	}
+	for _, index := range p.analogs {
+		station.AddAnalog(p.record.Analog[index].Name, 1, synchrophasor.AnunitPow)
+	}
+	for i := 0; i < len(p.record.Digital); i += 16 {
+		end := min(i+16, len(p.record.Digital))
+		names := make([]string, 16)
+		for j := i; j < end; j++ {
+			names[j-i] = p.record.Digital[j].Name
+		}
+		station.AddDigital(names, 0x0000, 0xFFFF)
+	}
+
+	return station
+}
+
+// Reset restarts playback on the next update
+func (p *Player) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = time.Time{}
+	p.prev = nil
+}
+
+// Update implements synchrophasor.DataProvider
+func (p *Player) Update(cfg *synchrophasor.ConfigFrame, t time.Time) error {
+	if p.options.Station >= len(cfg.PMUStationList) {
+		return fmt.Errorf("%w: station %d not configured", synchrophasor.ErrInvalidParameter, p.options.Station)
+	}
+	station := cfg.PMUStationList[p.options.Station]
+
+	p.mu.Lock()
+	sample, prev := p.sampleAt(t)
+	p.prev = sample
+	p.mu.Unlock()
+
+	for i, ph := range p.options.Phasors {
+		if i >= len(station.PhasorValues) {
+			break
+		}
+		mag := sample.Analog[ph.Magnitude]
+		ang := sample.Analog[ph.Angle] * math.Pi / 180
+		station.PhasorValues[i] = cmplx.Rect(mag, ang)
+	}
+
+	for i, index := range p.analogs {
+		if i >= len(station.AnalogValues) {
+			break
+		}
+		station.AnalogValues[i] = float32(sample.Analog[index])
+	}
+
+	for i, value := range sample.Digital {
+		word := i / 16
+		if word >= len(station.DigitalValues) {
+			break
+		}
+		station.DigitalValues[word][i%16] = value
+	}
+
+	if p.freq >= 0 {
+		freq := float32(sample.Analog[p.freq])
+		station.DFreq = 0
+		if prev != nil && sample.Time > prev.Time {
+			dt := float32((sample.Time - prev.Time).Seconds())
+			station.DFreq = (freq - float32(prev.Analog[p.freq])) / dt
+		}
+		station.Freq = freq
+	} else {
+		station.Freq = station.GetNominalFrequency()
+		station.DFreq = 0
+	}
+
+	return nil
+}
+
+// sampleAt returns the sample for t and the previously played sample
+func (p *Player) sampleAt(t time.Time) (sample, prev *Sample) {
+	if p.start.IsZero() {
+		p.start = t
+	}
+
+	offset := t.Sub(p.start)
+	if duration := p.record.Duration(); p.options.Loop && duration > 0 && offset > duration {
+		offset %= duration
+	}
+
+	sample = p.record.SampleAt(offset)
+	prev = p.prev
+	if prev != nil && prev.Time > sample.Time {
+		// Wrapped around, the difference to the previous sample is meaningless
+		prev = nil
+	}
+	return sample, prev
+}
@@ -0,0 +1,454 @@
+// Package concentrator reads the data frames of several PMUs and aligns them
+// by timestamp into measurement sets holding the stations of all of them,
+// reconnecting to PMUs that go away
+package concentrator
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Endpoint is a PMU read by a Concentrator
+type Endpoint struct {
+	// Address of the PMU, or the local address receiving a spontaneous UDP
+	// stream
+	Address string
+	// IDCode is sent in the commands to the PMU, defaults to 1
+	IDCode uint16
+	// Transport is "tcp", "udp" for commands and data over UDP or
+	// "udp_listen" to receive a spontaneous UDP stream on Address, defaults
+	// to "tcp"
+	Transport string
+}
+
+// Options configures a Concentrator
+type Options struct {
+	// IDCode of the aligned measurement sets
+	IDCode uint16
+	// Wait is how long a measurement set waits for late PMUs, defaults to
+	// 100 ms
+	Wait time.Duration
+	// UDPTimeout is the silence after which a PMU reached over UDP, which
+	// reports no disconnects, is redialed, defaults to five seconds
+	UDPTimeout time.Duration
+	// Backoff schedules the reconnects of failed PMUs
+	Backoff synchrophasor.Backoff
+	// OnError is called with the errors of single frames of the PMU with
+	// the given index, which are skipped
+	OnError func(pmu int, err error)
+	// Notify is called with the progress of connecting and the disconnects
+	// and reconnects of the PMUs
+	Notify func(msg string)
+}
+
+// Concentrator aligns the data frames of several PMUs
+type Concentrator struct {
+	endpoints []Endpoint
+	opts      Options
+	// mu guards pdcs, which are replaced on reconnects
+	mu   sync.Mutex
+	pdcs []*synchrophasor.PDC
+	// cfgs holds the configuration of every PMU, which must not change on
+	// reconnects
+	cfgs []*synchrophasor.ConfigFrame
+	stop chan struct{}
+	// cfg lists the stations of all PMUs in the order of the endpoints,
+	// offsets the index of the first station of each PMU in it
+	cfg     *synchrophasor.ConfigFrame
+	offsets []int
+	// interval is the time between frames in seconds, the width of the
+	// slots the frames are aligned to
+	interval float64
+}
+
+// arrival is a data frame or read error of the PMU with the given index
+type arrival struct {
+	pmu int
+	m   *synchrophasor.Measurements
+	err error
+}
+
+// alignedSet is a measurement set waiting for the frames of all PMUs
+type alignedSet struct {
+	m       synchrophasor.Measurements
+	have    []bool
+	count   int
+	created time.Time
+}
+
+// New connects to the endpoints and fetches their configurations. The data
+// rate of the first PMU sets the slots the frames are aligned to.
+func New(endpoints []Endpoint, opts Options) (*Concentrator, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%w: no endpoints", synchrophasor.ErrInvalidParameter)
+	}
+	if opts.Wait <= 0 {
+		opts.Wait = 100 * time.Millisecond
+	}
+	if opts.UDPTimeout <= 0 {
+		opts.UDPTimeout = 5 * time.Second
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(int, error) {}
+	}
+	if opts.Notify == nil {
+		opts.Notify = func(string) {}
+	}
+	endpoints = append([]Endpoint(nil), endpoints...)
+	for i := range endpoints {
+		e := &endpoints[i]
+		switch e.Transport {
+		case "":
+			e.Transport = "tcp"
+		case "tcp", "udp", "udp_listen":
+		default:
+			return nil, fmt.Errorf("%w: pmu %d: unknown transport %q",
+				synchrophasor.ErrInvalidParameter, i+1, e.Transport)
+		}
+		if e.Address == "" {
+			return nil, fmt.Errorf("%w: pmu %d: no address", synchrophasor.ErrInvalidParameter, i+1)
+		}
+		if e.IDCode == 0 {
+			e.IDCode = 1
+		}
+	}
+
+	c := &Concentrator{endpoints: endpoints, opts: opts, cfg: synchrophasor.NewConfigFrame(), stop: make(chan struct{})}
+	c.cfg.IDCode = opts.IDCode
+	for i, e := range endpoints {
+		opts.Notify(fmt.Sprintf("Connecting to PMU %d at %s over %s...", i+1, e.Address, e.Transport))
+		pdc, err := dial(e)
+		if err != nil {
+			c.Disconnect()
+			return nil, fmt.Errorf("pmu %d: %w", i+1, err)
+		}
+		c.pdcs = append(c.pdcs, pdc)
+
+		if e.Transport == "udp_listen" {
+			opts.Notify("Waiting for the configuration in the stream...")
+		}
+		cfg, err := config(e, pdc)
+		if err != nil {
+			c.Disconnect()
+			return nil, fmt.Errorf("pmu %d: %w", i+1, err)
+		}
+		c.cfgs = append(c.cfgs, cfg)
+
+		if i == 0 {
+			c.cfg.TimeBase, c.cfg.DataRate = cfg.TimeBase, cfg.DataRate
+			if c.interval = frameInterval(cfg.DataRate); c.interval == 0 {
+				c.Disconnect()
+				return nil, fmt.Errorf("pmu %d: no data rate", i+1)
+			}
+		} else if cfg.DataRate != c.cfg.DataRate {
+			opts.Notify(fmt.Sprintf("PMU %d sends %d fps instead of %d, only common timestamps align",
+				i+1, cfg.DataRate, c.cfg.DataRate))
+		}
+		c.offsets = append(c.offsets, len(c.cfg.PMUStationList))
+		for _, pmu := range cfg.PMUStationList {
+			c.cfg.AddPMUStation(pmu.Clone())
+		}
+	}
+	return c, nil
+}
+
+// Config returns the configuration of the aligned measurement sets, listing
+// the stations of all PMUs in the order of the endpoints
+func (c *Concentrator) Config() *synchrophasor.ConfigFrame {
+	return c.cfg
+}
+
+// frameInterval returns the time between frames in seconds for DATA_RATE,
+// negative for seconds per frame, zero if unset
+func frameInterval(dataRate int16) float64 {
+	switch {
+	case dataRate > 0:
+		return 1 / float64(dataRate)
+	case dataRate < 0:
+		return -float64(dataRate)
+	}
+	return 0
+}
+
+// dial opens the connection to an endpoint
+func dial(e Endpoint) (*synchrophasor.PDC, error) {
+	pdc := synchrophasor.NewPDC(e.IDCode)
+	if e.Transport == "tcp" {
+		return pdc, pdc.Connect(e.Address)
+	}
+
+	var conn net.Conn
+	if e.Transport == "udp_listen" {
+		addr, err := net.ResolveUDPAddr("udp", e.Address)
+		if err != nil {
+			return nil, err
+		}
+		if conn, err = net.ListenUDP("udp", addr); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if conn, err = net.Dial("udp", e.Address); err != nil {
+			return nil, err
+		}
+	}
+	pdc.Socket = conn
+	return pdc, nil
+}
+
+// config requests the configuration of an endpoint or, for a spontaneous
+// stream, waits for it
+func config(e Endpoint, pdc *synchrophasor.PDC) (*synchrophasor.ConfigFrame, error) {
+	if e.Transport == "udp_listen" {
+		return streamConfig(pdc)
+	}
+	return pdc.GetConfig(2)
+}
+
+// streamConfig reads a spontaneous stream until its configuration arrives
+func streamConfig(pdc *synchrophasor.PDC) (*synchrophasor.ConfigFrame, error) {
+	for {
+		frame, err := pdc.ReadFrame()
+		if err != nil && !synchrophasor.IsFrameError(err) {
+			return nil, err
+		}
+		if cfg, ok := frame.(*synchrophasor.ConfigFrame); ok {
+			pdc.PMUConfig2 = cfg
+			return cfg, nil
+		}
+	}
+}
+
+// Start requests the data frames of the PMUs not streaming spontaneously
+func (c *Concentrator) Start() error {
+	for i, pdc := range c.pdcs {
+		if err := start(c.endpoints[i], pdc); err != nil {
+			return fmt.Errorf("pmu %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// start requests the data frames of an endpoint unless it streams
+// spontaneously
+func start(e Endpoint, pdc *synchrophasor.PDC) error {
+	if e.Transport == "udp_listen" {
+		return nil
+	}
+	return pdc.Start()
+}
+
+// Stop closes the connections to the PMUs and ends the reconnects, ending
+// Run. It may be called from another goroutine.
+func (c *Concentrator) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.stop:
+		return
+	default:
+	}
+	close(c.stop)
+	for _, pdc := range c.pdcs {
+		if pdc.Socket != nil {
+			_ = pdc.Socket.Close()
+		}
+	}
+}
+
+// redial replaces the connection to the PMU with the given index
+func (c *Concentrator) redial(i int) error {
+	e := c.endpoints[i]
+	pdc, err := dial(e)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	old := c.pdcs[i]
+	c.pdcs[i] = pdc
+	select {
+	case <-c.stop:
+		_ = pdc.Socket.Close()
+	default:
+	}
+	c.mu.Unlock()
+	old.Disconnect()
+
+	cfg, err := config(e, pdc)
+	if err != nil {
+		return err
+	}
+	if err := c.cfgs[i].SameLayout(cfg); err != nil {
+		return err
+	}
+	return start(e, pdc)
+}
+
+// Disconnect releases the connections once Run has returned
+func (c *Concentrator) Disconnect() {
+	for _, pdc := range c.pdcs {
+		pdc.Disconnect()
+	}
+}
+
+// Run passes the aligned measurement sets to handle in timestamp order until
+// Stop is called, reconnecting to failed PMUs. Frames are aligned to the
+// nearest slot of the data rate of the first PMU. A set is passed once all
+// PMUs contributed or it waited longer than Options.Wait, the stations of
+// missing PMUs are then flagged invalid with NaN values. Frames arriving
+// after a later set was passed are dropped. The set passed to handle is only
+// valid during the call.
+func (c *Concentrator) Run(handle func(m *synchrophasor.Measurements)) {
+	arrivals := make(chan arrival, 16*len(c.pdcs))
+	var wg sync.WaitGroup
+	for i := range c.pdcs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.read(i, arrivals)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(arrivals)
+	}()
+
+	pending := make(map[int64]*alignedSet)
+	var passed int64
+	flush := func(all bool) {
+		for len(pending) > 0 {
+			oldest := int64(math.MaxInt64)
+			for key := range pending {
+				oldest = min(oldest, key)
+			}
+			set := pending[oldest]
+			if !all && set.count < len(c.pdcs) && time.Since(set.created) < c.opts.Wait {
+				return
+			}
+			delete(pending, oldest)
+			passed = oldest
+			handle(&set.m)
+		}
+	}
+
+	ticker := time.NewTicker(c.opts.Wait / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case a, ok := <-arrivals:
+			if !ok {
+				flush(true)
+				return
+			}
+			if a.err != nil {
+				c.opts.OnError(a.pmu, a.err)
+				continue
+			}
+			key := int64(math.Round(a.m.Time / c.interval))
+			if key <= passed {
+				continue
+			}
+			set := pending[key]
+			if set == nil {
+				set = c.newSet(key)
+				pending[key] = set
+			}
+			if !set.have[a.pmu] {
+				set.have[a.pmu] = true
+				set.count++
+				copy(set.m.Stations[c.offsets[a.pmu]:], a.m.Stations)
+			}
+			flush(false)
+		case <-ticker.C:
+			flush(false)
+		}
+	}
+}
+
+// read sends the data frames and errors of a PMU to arrivals, reconnecting
+// when its connection fails, until Stop is called
+func (c *Concentrator) read(i int, arrivals chan<- arrival) {
+	c.mu.Lock()
+	pdc := c.pdcs[i]
+	c.mu.Unlock()
+	e := c.endpoints[i]
+
+	for {
+		if e.Transport == "udp" {
+			_ = pdc.Socket.SetReadDeadline(time.Now().Add(c.opts.UDPTimeout))
+		}
+		frame, err := pdc.ReadFrame()
+		if err != nil && synchrophasor.IsFrameError(err) {
+			arrivals <- arrival{pmu: i, err: err}
+			continue
+		}
+		if err != nil {
+			select {
+			case <-c.stop:
+				return
+			default:
+			}
+
+			c.opts.Notify(fmt.Sprintf("Disconnected from PMU %d at %s: %v, reconnecting", i+1, e.Address, err))
+			down := time.Now()
+			ok := c.opts.Backoff.Retry(c.stop, func() error { return c.redial(i) }, func(err error, retry time.Duration) {
+				c.opts.Notify(fmt.Sprintf("Reconnecting to PMU %d at %s failed: %v, retrying in %s",
+					i+1, e.Address, err, retry))
+			})
+			if !ok {
+				return
+			}
+			c.mu.Lock()
+			pdc = c.pdcs[i]
+			c.mu.Unlock()
+			c.opts.Notify(fmt.Sprintf("Reconnected to PMU %d at %s after %s",
+				i+1, e.Address, time.Since(down).Round(time.Millisecond)))
+			continue
+		}
+		if df, ok := frame.(*synchrophasor.DataFrame); ok {
+			m := &synchrophasor.Measurements{}
+			df.FillMeasurements(m)
+			arrivals <- arrival{pmu: i, m: m}
+		}
+	}
+}
+
+// newSet returns a set for the slot key, with all stations invalid until
+// their PMU contributes
+func (c *Concentrator) newSet(key int64) *alignedSet {
+	set := &alignedSet{have: make([]bool, len(c.pdcs)), created: time.Now()}
+	set.m.PMUID = c.cfg.IDCode
+	set.m.Time = float64(key) * c.interval
+	nan := float32(math.NaN())
+	for _, pmu := range c.cfg.PMUStationList {
+		st := synchrophasor.StationMeasurement{
+			StreamID:  pmu.IDCode,
+			Stat:      synchrophasor.StatDataError,
+			Frequency: nan,
+			ROCOF:     nan,
+			Phasors:   make([]complex128, pmu.Phnmr),
+			Analog:    make([]float32, pmu.Annmr),
+			Digital:   make([][]bool, pmu.Dgnmr),
+		}
+		for j := range st.Phasors {
+			st.Phasors[j] = cmplxNaN
+		}
+		for j := range st.Analog {
+			st.Analog[j] = nan
+		}
+		for j := range st.Digital {
+			st.Digital[j] = make([]bool, 16)
+		}
+		set.m.Stations = append(set.m.Stations, st)
+	}
+	return set
+}
+
+// cmplxNaN fills the phasors of missing stations
+var cmplxNaN = complex(math.NaN(), math.NaN())
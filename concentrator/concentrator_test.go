@@ -0,0 +1,96 @@
+package concentrator
+
+import (
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// serve starts a PMU server with one station of the given ID code at 50
+// frames per second
+func serve(t *testing.T, idCode uint16) (*synchrophasor.PMU, string) {
+	pmu := synchrophasor.NewPMU()
+	pmu.Config2 = testutil.NewConfig(50, 1, func(station *synchrophasor.PMUStation) {
+		station.IDCode = idCode
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+	pmu.Config2.PMUStationList[0].Freq = 50
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = pmu.Serve(l) }()
+	t.Cleanup(pmu.Stop)
+	return pmu, l.Addr().String()
+}
+
+func TestConcentrator(t *testing.T) {
+	_, first := serve(t, 10)
+	second, addr := serve(t, 11)
+
+	var (
+		mu       sync.Mutex
+		messages []string
+	)
+	notify := func(msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		messages = append(messages, msg)
+	}
+	c, err := New([]Endpoint{{Address: first}, {Address: addr}}, Options{IDCode: 7, Notify: notify})
+	require.NoError(t, err)
+	defer c.Disconnect()
+	cfg := c.Config()
+	require.Equal(t, int16(50), cfg.DataRate)
+	require.Len(t, cfg.PMUStationList, 2)
+	require.Equal(t, uint16(11), cfg.PMUStationList[1].IDCode)
+	require.NoError(t, c.Start())
+
+	sets := make(chan synchrophasor.Measurements, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(func(m *synchrophasor.Measurements) {
+			sets <- *m.Clone()
+		})
+	}()
+
+	// Both stations are aligned into one set
+	valid := func(st *synchrophasor.StationMeasurement) bool { return st.Stat&synchrophasor.StatDataError == 0 }
+	require.Eventually(t, func() bool {
+		m := <-sets
+		return valid(&m.Stations[0]) && valid(&m.Stations[1])
+	}, 5*time.Second, time.Millisecond)
+	m := <-sets
+	require.Equal(t, uint16(7), m.PMUID)
+	require.InDelta(t, math.Round(m.Time*50), m.Time*50, 1e-6)
+
+	// The stations of a PMU that went away are flagged invalid
+	second.Stop()
+	require.Eventually(t, func() bool {
+		m := <-sets
+		return valid(&m.Stations[0]) && !valid(&m.Stations[1])
+	}, 5*time.Second, time.Millisecond)
+
+	c.Stop()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	require.True(t, strings.HasPrefix(messages[0], "Connecting to PMU 1"))
+	require.Contains(t, strings.Join(messages, "\n"), "Disconnected from PMU 2")
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(nil, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New([]Endpoint{{Address: "localhost:4712", Transport: "sctp"}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New([]Endpoint{{}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
@@ -0,0 +1,785 @@
+// Package conformance connects to a PMU or PDC over TCP and runs a battery
+// of IEEE C37.118.2 checks on its responses and data stream: framing, CRC,
+// configuration fields, data frame sizes against FORMAT, timestamp
+// monotonicity and alignment, rate accuracy and the handling of every
+// command code. The result is a pass/fail report for devices under test and
+// for this package's own server.
+package conformance
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Status is the outcome of a check
+type Status string
+
+// Check outcomes. Warnings flag deviations that PDCs usually tolerate and do
+// not fail the report.
+const (
+	Pass Status = "PASS"
+	Warn Status = "WARN"
+	Fail Status = "FAIL"
+	Skip Status = "SKIP"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Report holds the results of a run in the order the checks were made
+type Report struct {
+	Address string    `json:"address"`
+	IDCode  uint16    `json:"idcode"`
+	Start   time.Time `json:"start"`
+	Results []Result  `json:"results"`
+}
+
+// Options configures a run
+type Options struct {
+	// IDCode is sent in the command frames, defaults to 1
+	IDCode uint16
+	// Timeout bounds the wait for every response, defaults to 2 s
+	Timeout time.Duration
+	// Duration is how long the data stream is observed, defaults to 5 s
+	Duration time.Duration
+	// RateTolerance is the relative deviation from DATA_RATE accepted for the
+	// timestamp and arrival rates, defaults to 0.02
+	RateTolerance float64
+}
+
+// settle is the pause after commands that are not answered, so that the
+// next command does not share a TCP segment with them
+const settle = 200 * time.Millisecond
+
+// Reserved bits of the configuration and data frame words
+const (
+	formatReserved  = 0xFFF0
+	fnomReserved    = 0xFFFE
+	timeBaseFlags   = 0xFF000000
+	fracSecReserved = 0x80000000
+)
+
+// cmdReserved is a command code reserved by C37.118.2
+const cmdReserved = 0x0007
+
+// Passed reports whether no check failed
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if res.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// Count returns the number of checks with status s
+func (r *Report) Count(s Status) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Status == s {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes the report as a table with a verdict line
+func (r *Report) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "C37.118.2 conformance of %s (IDCODE %d), %s\n\n",
+		r.Address, r.IDCode, r.Start.UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	width := 0
+	for _, res := range r.Results {
+		width = max(width, len(res.Name))
+	}
+	for _, res := range r.Results {
+		if _, err := fmt.Fprintf(w, "%-4s  %-*s  %s\n", res.Status, width, res.Name, res.Detail); err != nil {
+			return err
+		}
+	}
+	verdict := "PASS"
+	if !r.Passed() {
+		verdict = "FAIL"
+	}
+	_, err := fmt.Fprintf(w, "\nResult: %s (%d passed, %d failed, %d warnings, %d skipped)\n",
+		verdict, r.Count(Pass), r.Count(Fail), r.Count(Warn), r.Count(Skip))
+	return err
+}
+
+// checker runs the checks over one connection
+type checker struct {
+	ctx    context.Context
+	conn   net.Conn
+	opts   Options
+	report *Report
+	buf    []byte
+	cfg    *synchrophasor.ConfigFrame
+	// streaming is set once data frames were requested
+	streaming bool
+}
+
+// findings collects the problems found by a check
+type findings struct {
+	fails, warns []string
+}
+
+func (f *findings) fail(format string, args ...any) {
+	f.fails = append(f.fails, fmt.Sprintf(format, args...))
+}
+
+func (f *findings) warn(format string, args ...any) {
+	f.warns = append(f.warns, fmt.Sprintf(format, args...))
+}
+
+// Run connects to address and runs all checks. It returns an error only if
+// the connection cannot be established; failed checks are part of the
+// report.
+func Run(ctx context.Context, address string, opts Options) (*Report, error) {
+	if opts.IDCode == 0 {
+		opts.IDCode = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = 5 * time.Second
+	}
+	if opts.RateTolerance <= 0 {
+		opts.RateTolerance = 0.02
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	// Cancelling ctx wakes up a pending read
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	c := &checker{
+		ctx:    ctx,
+		conn:   conn,
+		opts:   opts,
+		report: &Report{Address: address, IDCode: opts.IDCode, Start: time.Now()},
+	}
+	c.run()
+	return c.report, nil
+}
+
+// add records a result
+func (c *checker) add(name string, status Status, format string, args ...any) {
+	c.report.Results = append(c.report.Results, Result{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+}
+
+// conclude records a check passing with detail unless it has findings
+func (c *checker) conclude(name string, f findings, detail string) {
+	switch {
+	case len(f.fails) > 0:
+		c.add(name, Fail, "%s", summarize(append(f.fails, f.warns...)))
+	case len(f.warns) > 0:
+		c.add(name, Warn, "%s", summarize(f.warns))
+	default:
+		c.add(name, Pass, "%s", detail)
+	}
+}
+
+// summarize joins the first problems and counts the rest
+func summarize(problems []string) string {
+	const shown = 3
+	if len(problems) <= shown {
+		return strings.Join(problems, "; ")
+	}
+	return fmt.Sprintf("%s; and %d more", strings.Join(problems[:shown], "; "), len(problems)-shown)
+}
+
+// run makes the checks in order, skipping those that depend on a failed one
+func (c *checker) run() {
+	if !c.checkConfig2() {
+		for _, name := range []string{"cfg1", "header", "cfg3", "data", "stop", "commands"} {
+			c.add(name, Skip, "no CFG-2 frame")
+		}
+		return
+	}
+	c.checkConfig1()
+	c.checkHeader()
+	c.checkConfig3()
+	if c.checkData() {
+		c.checkStop()
+	} else {
+		c.add("stop", Skip, "no data stream")
+	}
+	c.checkCommands()
+}
+
+// send writes a command frame, corrupting its CRC if badCRC is set
+func (c *checker) send(code uint16, badCRC bool) error {
+	cmd := synchrophasor.NewCommandFrame()
+	cmd.IDCode = c.opts.IDCode
+	cmd.CMD = code
+	cmd.SetTime(nil, nil)
+	data, err := cmd.Pack()
+	if err != nil {
+		return err
+	}
+	if badCRC {
+		data[len(data)-1] ^= 0xFF
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout)); err != nil {
+		return err
+	}
+	_, err = c.conn.Write(data)
+	return err
+}
+
+// read returns the next frame, waiting at most until deadline
+func (c *checker) read(deadline time.Time) ([]byte, error) {
+	if d, ok := c.ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	for {
+		if len(c.buf) >= 4 {
+			if c.buf[0] != synchrophasor.SyncAA {
+				return nil, fmt.Errorf("%w: stream does not start with SYNC, got 0x%02X", synchrophasor.ErrInvalidFrame, c.buf[0])
+			}
+			size := int(binary.BigEndian.Uint16(c.buf[2:4]))
+			if size < 16 {
+				return nil, fmt.Errorf("%w: FRAMESIZE %d", synchrophasor.ErrInvalidSize, size)
+			}
+			if len(c.buf) >= size {
+				frame := append([]byte(nil), c.buf[:size]...)
+				c.buf = c.buf[size:]
+				return frame, nil
+			}
+		}
+		chunk := make([]byte, 64*1024)
+		n, err := c.conn.Read(chunk)
+		c.buf = append(c.buf, chunk[:n]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// await reads frames until one of type kind arrives, discarding data
+// frames, and returns nil on timeout
+func (c *checker) await(kind synchrophasor.FrameType) ([]byte, error) {
+	deadline := time.Now().Add(c.opts.Timeout)
+	for {
+		frame, err := c.read(deadline)
+		if isTimeout(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t, _ := synchrophasor.GetFrameType(frame); t == kind {
+			return frame, nil
+		}
+	}
+}
+
+// isTimeout reports whether err is a read deadline
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// request sends a command and awaits a response of type kind, recording a
+// failure under name if sending or reading breaks
+func (c *checker) request(name string, code uint16, kind synchrophasor.FrameType) ([]byte, bool) {
+	if err := c.send(code, false); err != nil {
+		c.add(name, Fail, "sending command 0x%04X failed: %v", code, err)
+		return nil, false
+	}
+	frame, err := c.await(kind)
+	if err != nil {
+		c.add(name, Fail, "reading response failed: %v", err)
+		return nil, false
+	}
+	return frame, true
+}
+
+// checkFrame checks the common fields of a frame: SYNC, CRC, IDCODE and
+// FRACSEC
+func (c *checker) checkFrame(f *findings, frame []byte) {
+	if v := frame[1] & 0x0F; v < 1 || v > 2 {
+		f.fail("SYNC version %d, expected 1 or 2", v)
+	}
+	chk := binary.BigEndian.Uint16(frame[len(frame)-2:])
+	if crc := synchrophasor.CalcCRC(frame[:len(frame)-2]); chk != crc {
+		f.fail("CHK 0x%04X, computed 0x%04X", chk, crc)
+	}
+	if c.cfg != nil {
+		if id := binary.BigEndian.Uint16(frame[4:6]); id != c.cfg.IDCode {
+			f.fail("IDCODE %d, stream IDCODE %d", id, c.cfg.IDCode)
+		}
+	}
+	fracSec := binary.BigEndian.Uint32(frame[10:14])
+	if fracSec&fracSecReserved != 0 {
+		f.warn("reserved FRACSEC bit 31 set")
+	}
+	if c.cfg != nil {
+		if base := c.cfg.TimeBase & 0xFFFFFF; base > 0 && fracSec&0xFFFFFF >= base {
+			f.fail("FRACSEC fraction %d not below TIME_BASE %d", fracSec&0xFFFFFF, base)
+		}
+	}
+}
+
+// checkConfig2 requests CFG-2 and checks its fields. It returns false if no
+// usable CFG-2 was received.
+func (c *checker) checkConfig2() bool {
+	frame, ok := c.request("cfg2", synchrophasor.CmdCfg2, synchrophasor.FrameTypeCfg2)
+	if !ok {
+		return false
+	}
+	if frame == nil {
+		c.add("cfg2", Fail, "no CFG-2 frame within %s", c.opts.Timeout)
+		return false
+	}
+
+	var f findings
+	c.checkFrame(&f, frame)
+	value, err := synchrophasor.UnpackFrame(fixCRC(frame), nil)
+	cfg, _ := value.(*synchrophasor.ConfigFrame)
+	if err != nil || cfg == nil {
+		c.add("cfg2", Fail, "CFG-2 frame does not decode: %v", err)
+		return false
+	}
+	c.checkConfigFields(&f, cfg)
+	c.cfg = cfg
+	c.conclude("cfg2", f, fmt.Sprintf("%d stations, %d frames per second, TIME_BASE %d",
+		cfg.NumPMU, cfg.DataRate, cfg.TimeBase&0xFFFFFF))
+	return cfg.DataRate != 0 && cfg.TimeBase&0xFFFFFF != 0 && len(cfg.PMUStationList) > 0
+}
+
+// fixCRC returns a copy of frame with a valid CRC, so that a corrupted frame
+// is still decoded after its CRC failure was recorded
+func fixCRC(frame []byte) []byte {
+	fixed := append([]byte(nil), frame...)
+	binary.BigEndian.PutUint16(fixed[len(fixed)-2:], synchrophasor.CalcCRC(fixed[:len(fixed)-2]))
+	return fixed
+}
+
+// checkConfigFields checks TIME_BASE, NUM_PMU, DATA_RATE and the station
+// blocks of a configuration frame
+func (c *checker) checkConfigFields(f *findings, cfg *synchrophasor.ConfigFrame) {
+	if cfg.TimeBase&timeBaseFlags != 0 {
+		f.fail("reserved TIME_BASE flags 0x%02X set", cfg.TimeBase>>24)
+	}
+	if cfg.TimeBase&0xFFFFFF == 0 {
+		f.fail("TIME_BASE is 0")
+	}
+	if cfg.DataRate == 0 {
+		f.fail("DATA_RATE is 0")
+	}
+	if cfg.NumPMU == 0 || int(cfg.NumPMU) != len(cfg.PMUStationList) {
+		f.fail("NUM_PMU %d with %d station blocks", cfg.NumPMU, len(cfg.PMUStationList))
+	}
+
+	ids := make(map[uint16]bool)
+	for _, pmu := range cfg.PMUStationList {
+		name := strings.TrimSpace(pmu.STN)
+		if name == "" {
+			f.warn("station %d has an empty STN", pmu.IDCode)
+		}
+		if ids[pmu.IDCode] {
+			f.fail("IDCODE %d used by several stations", pmu.IDCode)
+		}
+		ids[pmu.IDCode] = true
+		if pmu.Format&formatReserved != 0 {
+			f.fail("station %s: reserved FORMAT bits 0x%04X set", name, pmu.Format&formatReserved)
+		}
+		if pmu.Fnom&fnomReserved != 0 {
+			f.fail("station %s: reserved FNOM bits 0x%04X set", name, pmu.Fnom&fnomReserved)
+		}
+		for j, unit := range pmu.Phunit {
+			if t := unit >> 24; t != uint32(synchrophasor.PhunitVoltage) && t != uint32(synchrophasor.PhunitCurrent) {
+				f.fail("station %s: PHUNIT %d has type %d", name, j+1, t)
+			}
+		}
+		for j, unit := range pmu.Anunit {
+			if t := unit >> 24; t > uint32(synchrophasor.AnunitPeak) && t < 64 {
+				f.fail("station %s: ANUNIT %d has reserved type %d", name, j+1, t)
+			}
+		}
+		for _, ch := range slices.Concat([]string{pmu.STN}, pmu.CHNAMPhasor, pmu.CHNAMAnalog, pmu.CHNAMDigital) {
+			if !printable(ch) {
+				f.fail("station %s: name %q is not printable ASCII", name, ch)
+			}
+		}
+	}
+}
+
+// printable reports whether s holds only printable ASCII and NUL padding
+func printable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if (s[i] < 0x20 || s[i] > 0x7E) && s[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkConfig1 requests CFG-1, which describes the PMU's capabilities and
+// must be provided alongside CFG-2
+func (c *checker) checkConfig1() {
+	frame, ok := c.request("cfg1", synchrophasor.CmdCfg1, synchrophasor.FrameTypeCfg1)
+	if !ok {
+		return
+	}
+	if frame == nil {
+		c.add("cfg1", Fail, "no CFG-1 frame within %s", c.opts.Timeout)
+		return
+	}
+
+	var f findings
+	c.checkFrame(&f, frame)
+	value, err := synchrophasor.UnpackFrame(fixCRC(frame), nil)
+	cfg1, _ := value.(*synchrophasor.Config1Frame)
+	if err != nil || cfg1 == nil {
+		c.add("cfg1", Fail, "CFG-1 frame does not decode: %v", err)
+		return
+	}
+	c.checkConfigFields(&f, &cfg1.ConfigFrame)
+	if cfg1.NumPMU != c.cfg.NumPMU {
+		f.warn("CFG-1 lists %d stations, CFG-2 %d", cfg1.NumPMU, c.cfg.NumPMU)
+	}
+	c.conclude("cfg1", f, fmt.Sprintf("%d stations", cfg1.NumPMU))
+}
+
+// checkHeader requests the header frame and checks that it is ASCII
+func (c *checker) checkHeader() {
+	frame, ok := c.request("header", synchrophasor.CmdHeader, synchrophasor.FrameTypeHeader)
+	if !ok {
+		return
+	}
+	if frame == nil {
+		c.add("header", Fail, "no header frame within %s", c.opts.Timeout)
+		return
+	}
+
+	var f findings
+	c.checkFrame(&f, frame)
+	text := string(frame[14 : len(frame)-2])
+	if !printable(strings.NewReplacer("\r", "", "\n", "", "\t", "").Replace(text)) {
+		f.warn("header is not printable ASCII")
+	}
+	c.conclude("header", f, fmt.Sprintf("%d bytes of text", len(text)))
+}
+
+// checkConfig3 requests CFG-3, which is optional
+func (c *checker) checkConfig3() {
+	frame, ok := c.request("cfg3", synchrophasor.CmdCfg3, synchrophasor.FrameTypeCfg3)
+	if !ok {
+		return
+	}
+	if frame == nil {
+		c.add("cfg3", Skip, "no CFG-3 frame, optional")
+		return
+	}
+
+	var f findings
+	c.checkFrame(&f, frame)
+	if frame[1]&0x0F != 2 {
+		f.fail("CFG-3 requires SYNC version 2")
+	}
+	c.conclude("cfg3", f, fmt.Sprintf("%d bytes, framing and CRC only", len(frame)))
+}
+
+// sample is a received data frame with its arrival time
+type sample struct {
+	at    time.Time
+	frame []byte
+}
+
+// checkData starts the stream, observes it for the configured duration and
+// checks the data frames. It returns false if no data arrived.
+func (c *checker) checkData() bool {
+	if err := c.send(synchrophasor.CmdStart, false); err != nil {
+		c.add("data", Fail, "sending start failed: %v", err)
+		return false
+	}
+	c.streaming = true
+
+	var samples []sample
+	first := time.Now().Add(c.opts.Timeout)
+	end := time.Time{}
+	other := 0
+	for {
+		deadline := first
+		if !end.IsZero() {
+			deadline = end
+		}
+		frame, err := c.read(deadline)
+		if isTimeout(err) {
+			break
+		}
+		if err != nil {
+			c.add("data", Fail, "reading data failed after %d frames: %v", len(samples), err)
+			return false
+		}
+		if t, _ := synchrophasor.GetFrameType(frame); t != synchrophasor.FrameTypeData {
+			other++
+			continue
+		}
+		now := time.Now()
+		if end.IsZero() {
+			end = now.Add(c.opts.Duration)
+		}
+		samples = append(samples, sample{at: now, frame: frame})
+	}
+	if len(samples) == 0 {
+		c.add("data", Fail, "no data frame within %s of the start command", c.opts.Timeout)
+		return false
+	}
+	c.add("data", Pass, "%d data frames in %s", len(samples), c.opts.Duration)
+
+	c.checkDataFrames(samples)
+	c.checkTimestamps(samples)
+	c.checkRate(samples)
+	return true
+}
+
+// checkDataFrames checks the framing, size and decoding of every data frame
+func (c *checker) checkDataFrames(samples []sample) {
+	want := 16
+	for _, pmu := range c.cfg.PMUStationList {
+		want += int(pmu.DataSize())
+	}
+
+	var framing, size, decode findings
+	df := synchrophasor.NewDataFrame(c.cfg)
+	for i, s := range samples {
+		var f findings
+		c.checkFrame(&f, s.frame)
+		for _, p := range f.fails {
+			framing.fail("frame %d: %s", i+1, p)
+		}
+		for _, p := range f.warns {
+			framing.warn("%s", p)
+		}
+		if len(s.frame) != want {
+			size.fail("frame %d has %d bytes", i+1, len(s.frame))
+			continue
+		}
+		if err := df.Unpack(fixCRC(s.frame)); err != nil {
+			decode.fail("frame %d: %v", i+1, err)
+		}
+	}
+
+	framing.warns = dedupe(framing.warns)
+	c.conclude("data.framing", framing, "SYNC, CHK, IDCODE and FRACSEC valid in every frame")
+	if len(size.fails) > 0 {
+		size.fails = append([]string{fmt.Sprintf("FORMAT and channel counts of CFG-2 give %d bytes", want)}, size.fails...)
+	}
+	c.conclude("data.size", size, fmt.Sprintf("every frame has the %d bytes given by FORMAT and the channel counts", want))
+	c.conclude("data.decode", decode, "every frame decodes with CFG-2")
+}
+
+// dedupe removes repeated problems, keeping the first occurrence
+func dedupe(problems []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range problems {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// timestamp returns the time of a frame in seconds
+func (c *checker) timestamp(frame []byte) float64 {
+	soc := binary.BigEndian.Uint32(frame[6:10])
+	frac := binary.BigEndian.Uint32(frame[10:14]) & 0xFFFFFF
+	return float64(soc) + float64(frac)/float64(c.cfg.TimeBase&0xFFFFFF)
+}
+
+// interval returns the nominal time between data frames in seconds
+func (c *checker) interval() float64 {
+	if c.cfg.DataRate < 0 {
+		return float64(-int(c.cfg.DataRate))
+	}
+	return 1 / float64(c.cfg.DataRate)
+}
+
+// checkTimestamps checks that timestamps increase and lie on the reporting
+// slots of the data rate
+func (c *checker) checkTimestamps(samples []sample) {
+	interval := c.interval()
+	var order, align findings
+	worst := 0.0
+	for i, s := range samples {
+		t := c.timestamp(s.frame)
+		if i > 0 {
+			if prev := c.timestamp(samples[i-1].frame); t <= prev {
+				order.fail("frame %d at %.6f s not after frame %d at %.6f s", i+1, t, i, prev)
+			}
+		}
+		slots := t / interval
+		offset := math.Abs(slots-math.Round(slots)) * interval
+		worst = max(worst, offset)
+	}
+	c.conclude("data.monotonic", order, "timestamps strictly increase")
+
+	// Reporting times are multiples of the interval; allow for the
+	// resolution of TIME_BASE
+	limit := max(1/float64(c.cfg.TimeBase&0xFFFFFF), 1e-6) + interval*0.01
+	if worst > limit {
+		align.warn("timestamps up to %.3f ms off the reporting slots of %.3f ms", worst*1e3, interval*1e3)
+	}
+	c.conclude("data.alignment", align, fmt.Sprintf("timestamps within %.3f ms of the reporting slots", worst*1e3))
+}
+
+// checkRate compares the frame rate by timestamps and by arrival with
+// DATA_RATE and counts the frames missing from the sequence
+func (c *checker) checkRate(samples []sample) {
+	nominal := 1 / c.interval()
+	if len(samples) < 3 {
+		c.add("data.rate", Skip, "%d frames are too few", len(samples))
+		c.add("data.arrival", Skip, "%d frames are too few", len(samples))
+		return
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	span := c.timestamp(last.frame) - c.timestamp(first.frame)
+	var rate findings
+	missing := 0
+	for i := 1; i < len(samples); i++ {
+		step := (c.timestamp(samples[i].frame) - c.timestamp(samples[i-1].frame)) / c.interval()
+		if n := int(math.Round(step)) - 1; n > 0 {
+			missing += n
+		}
+	}
+	byTime := 0.0
+	if span > 0 {
+		byTime = float64(len(samples)-1) / span
+	}
+	if math.Abs(byTime-nominal) > nominal*c.opts.RateTolerance {
+		rate.fail("%.3f frames per second by timestamps, DATA_RATE %.3f", byTime, nominal)
+	}
+	if missing > 0 {
+		rate.fail("%d frames missing from the timestamp sequence", missing)
+	}
+	c.conclude("data.rate", rate, fmt.Sprintf("%.3f frames per second by timestamps, DATA_RATE %.3f", byTime, nominal))
+
+	var arrival findings
+	byArrival := float64(len(samples)-1) / last.at.Sub(first.at).Seconds()
+	if math.Abs(byArrival-nominal) > nominal*c.opts.RateTolerance {
+		arrival.fail("%.3f frames per second arrived, DATA_RATE %.3f", byArrival, nominal)
+	}
+	c.conclude("data.arrival", arrival, fmt.Sprintf("%.3f frames per second arrived", byArrival))
+}
+
+// quiet waits until no data frame arrived for a few intervals. It returns
+// the number of data frames seen and whether the stream went quiet before
+// the timeout.
+func (c *checker) quiet(wait time.Duration) (int, bool, error) {
+	silence := max(time.Duration(3*c.interval()*float64(time.Second)), wait)
+	end := time.Now().Add(c.opts.Timeout)
+	frames := 0
+	for time.Now().Before(end) {
+		deadline := time.Now().Add(silence)
+		if deadline.After(end) {
+			deadline = end
+		}
+		frame, err := c.read(deadline)
+		if isTimeout(err) {
+			return frames, time.Now().Before(end), nil
+		}
+		if err != nil {
+			return frames, false, err
+		}
+		if t, _ := synchrophasor.GetFrameType(frame); t == synchrophasor.FrameTypeData {
+			frames++
+		}
+	}
+	return frames, false, nil
+}
+
+// checkStop sends the stop command and checks that the stream ends
+func (c *checker) checkStop() {
+	if err := c.send(synchrophasor.CmdStop, false); err != nil {
+		c.add("stop", Fail, "sending stop failed: %v", err)
+		return
+	}
+	frames, stopped, err := c.quiet(100 * time.Millisecond)
+	switch {
+	case err != nil:
+		c.add("stop", Fail, "reading after stop failed: %v", err)
+	case !stopped:
+		c.add("stop", Fail, "data frames still arriving %s after the stop command", c.opts.Timeout)
+	default:
+		c.streaming = false
+		c.add("stop", Pass, "stream ended, %d frames in flight", frames)
+	}
+}
+
+// checkCommands checks that the extended frame command, a reserved command
+// and a start command with a corrupted CRC are ignored without dropping
+// the connection
+func (c *checker) checkCommands() {
+	if c.streaming {
+		c.add("commands", Skip, "stream could not be stopped")
+		return
+	}
+	for _, check := range []struct {
+		name   string
+		code   uint16
+		badCRC bool
+	}{
+		{"cmd.extended", synchrophasor.CmdExt, false},
+		{"cmd.reserved", cmdReserved, false},
+		{"cmd.bad_crc", synchrophasor.CmdStart, true},
+	} {
+		if err := c.send(check.code, check.badCRC); err != nil {
+			c.add(check.name, Fail, "sending command failed: %v", err)
+			return
+		}
+		frames, _, err := c.quiet(settle)
+		if err != nil {
+			c.add(check.name, Fail, "connection broken: %v", err)
+			return
+		}
+		if frames > 0 {
+			c.add(check.name, Fail, "%d data frames sent in response", frames)
+			c.streaming = true
+			return
+		}
+		frame, ok := c.request(check.name, synchrophasor.CmdCfg2, synchrophasor.FrameTypeCfg2)
+		if !ok {
+			return
+		}
+		if frame == nil {
+			c.add(check.name, Fail, "no CFG-2 response afterwards")
+			continue
+		}
+		c.add(check.name, Pass, "ignored, connection kept")
+	}
+}
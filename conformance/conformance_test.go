@@ -0,0 +1,125 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// serve starts a PMU server with one station at 50 frames per second
+func serve(t *testing.T) string {
+	pmu := synchrophasor.NewPMU()
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+	station := synchrophasor.NewPMUStation("Station A", 7, true, true, true, true)
+	station.AddPhasor("VA", 915527, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+	station.AddDigital([]string{"BREAKER"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+	pmu.SetConfig(cfg)
+	pmu.Header = synchrophasor.NewHeaderFrame(7, "Conformance test PMU")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	t.Cleanup(pmu.Stop)
+	return listener.Addr().String()
+}
+
+// status returns the status of the named check
+func status(t *testing.T, r *Report, name string) Status {
+	for _, res := range r.Results {
+		if res.Name == name {
+			return res.Status
+		}
+	}
+	t.Fatalf("no result %s in %+v", name, r.Results)
+	return ""
+}
+
+func TestRunOwnServer(t *testing.T) {
+	addr := serve(t)
+	report, err := Run(context.Background(), addr,
+		Options{Timeout: 500 * time.Millisecond, Duration: time.Second, RateTolerance: 0.1})
+	require.NoError(t, err)
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	require.True(t, report.Passed(), text.String())
+	require.Contains(t, text.String(), "Result: PASS")
+
+	for _, name := range []string{"data", "data.size", "data.decode", "data.monotonic", "data.rate",
+		"stop", "cmd.extended", "cmd.reserved", "cmd.bad_crc"} {
+		require.Equal(t, Pass, status(t, report, name), name)
+	}
+	// SetTime marks frames with the reserved FRACSEC bit
+	require.Equal(t, Warn, status(t, report, "cfg2"))
+	require.Contains(t, report.Results[0].Detail, "FRACSEC bit 31")
+	// CFG-3 is optional and not served
+	require.Equal(t, Skip, status(t, report, "cfg3"))
+}
+
+func TestRunBrokenDevice(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	// Answers every command with a CFG-2 frame carrying a bad CRC and
+	// reserved FORMAT bits
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		cfg := synchrophasor.NewConfigFrame()
+		cfg.IDCode = 3
+		cfg.TimeBase = 1000000
+		cfg.DataRate = 10
+		station := synchrophasor.NewPMUStation("Bad", 3, true, true, true, true)
+		station.Format |= 0x0100
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		cfg.AddPMUStation(station)
+		frame, _ := cfg.Pack()
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], 0)
+
+		buf := make([]byte, 1024)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+			if _, err := conn.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	report, err := Run(context.Background(), listener.Addr().String(),
+		Options{Timeout: 200 * time.Millisecond, Duration: 200 * time.Millisecond})
+	require.NoError(t, err)
+	require.False(t, report.Passed())
+	require.Equal(t, Fail, status(t, report, "cfg2"))
+	require.Contains(t, report.Results[0].Detail, "CHK")
+	require.Contains(t, report.Results[0].Detail, "FORMAT")
+	require.Equal(t, Fail, status(t, report, "data"))
+}
+
+func TestRunUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	_, err = Run(context.Background(), addr, Options{})
+	require.Error(t, err)
+}
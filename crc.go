@@ -1,19 +1,73 @@
 package synchrophasor
 
-import "github.com/sigurn/crc16"
-
-var ieeeC37118Params = crc16.Params{
-	Poly:   0x1021,
-	Init:   0xFFFF,
-	RefIn:  false,
-	RefOut: false,
-	XorOut: 0x0000,
-	Name:   "CRC-16/IEEE-C37.118",
+import "encoding/binary"
+
+// CRC-CCITT as used by IEEE C37.118: polynomial 0x1021, initial value 0xFFFF,
+// no reflection and no final XOR.
+const (
+	crcPoly = 0x1021
+	crcInit = 0xFFFF
+)
+
+// crcTables holds the slice-by-8 lookup tables. crcTables[0] is the classic
+// byte-wise table, crcTables[k] advances a byte followed by k zero bytes.
+var crcTables = makeCRCTables()
+
+// makeCRCTables builds the slice-by-8 lookup tables
+func makeCRCTables() *[8][256]uint16 {
+	var t [8][256]uint16
+
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ crcPoly
+			} else {
+				crc <<= 1
+			}
+		}
+		t[0][i] = crc
+	}
+
+	for k := 1; k < 8; k++ {
+		for i := 0; i < 256; i++ {
+			prev := t[k-1][i]
+			t[k][i] = prev<<8 ^ t[0][prev>>8]
+		}
+	}
+
+	return &t
 }
 
-var crcTable = crc16.MakeTable(ieeeC37118Params)
+// updateCRC continues a CRC computation over data, processing eight bytes per step
+func updateCRC(crc uint16, data []byte) uint16 {
+	t := crcTables
+
+	for len(data) >= 8 {
+		crc = t[7][data[0]^byte(crc>>8)] ^
+			t[6][data[1]^byte(crc)] ^
+			t[5][data[2]] ^
+			t[4][data[3]] ^
+			t[3][data[4]] ^
+			t[2][data[5]] ^
+			t[1][data[6]] ^
+			t[0][data[7]]
+		data = data[8:]
+	}
+
+	for _, b := range data {
+		crc = crc<<8 ^ t[0][byte(crc>>8)^b]
+	}
+
+	return crc
+}
 
 // CalcCRC calculates CRC-CCITT for the given data
 func CalcCRC(data []byte) uint16 {
-	return crc16.Checksum(data, crcTable)
+	return updateCRC(crcInit, data)
+}
+
+// appendCRC appends the CRC of frame[start:] to frame
+func appendCRC(frame []byte, start int) []byte {
+	return binary.BigEndian.AppendUint16(frame, CalcCRC(frame[start:]))
 }
@@ -0,0 +1,36 @@
+package synchrophasor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bitwiseCRC is the straightforward bit-at-a-time reference implementation
+func bitwiseCRC(data []byte) uint16 {
+	crc := uint16(crcInit)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ crcPoly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func TestCalcCRC(t *testing.T) {
+	// CRC-16/CCITT-FALSE check value
+	require.Equal(t, uint16(0x29B1), CalcCRC([]byte("123456789")))
+
+	data := make([]byte, 300)
+	for i := range data {
+		data[i] = byte(i*7 + 3)
+	}
+	for n := 0; n <= len(data); n++ {
+		require.Equal(t, bitwiseCRC(data[:n]), CalcCRC(data[:n]), "length %d", n)
+	}
+}
@@ -0,0 +1,244 @@
+// Package csvsink writes synchrophasor measurements to rotating CSV files
+package csvsink
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures a CSV sink
+type Options struct {
+	// Dir is the directory files are created in
+	Dir string
+	// Prefix starts every file name, followed by the time of the first row
+	Prefix string
+	// MaxSize rotates the file once it has grown beyond this many bytes; zero disables
+	MaxSize int64
+	// MaxAge rotates the file once its rows span this duration; zero disables
+	MaxAge time.Duration
+	// File writes all rows to this path instead, replacing an existing file.
+	// Dir, Prefix and the rotation limits are then ignored.
+	File string
+}
+
+// Sink writes one CSV row per measurement set with one column per channel.
+// Phasors are written as magnitude and angle in degrees. A Sink is not safe
+// for concurrent use.
+type Sink struct {
+	opts    Options
+	columns []string
+	row     []string
+	file    *os.File
+	buf     *bufio.Writer
+	count   *countingWriter
+	csv     *csv.Writer
+	opened  time.Time
+}
+
+// New creates a sink for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Sink, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "synchrophasor"
+	}
+	if opts.Dir != "" {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	columns := Columns(cfg)
+	return &Sink{
+		opts:    opts,
+		columns: columns,
+		row:     make([]string, len(columns)),
+	}, nil
+}
+
+// Columns returns the CSV header for a configuration
+func Columns(cfg *synchrophasor.ConfigFrame) []string {
+	columns := []string{"time"}
+	for _, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN)
+		columns = append(columns, stn+".stat", stn+".freq", stn+".rocof")
+		for _, name := range pmu.CHNAMPhasor {
+			name = strings.TrimSpace(name)
+			columns = append(columns, stn+"."+name+".mag", stn+"."+name+".ang")
+		}
+		for _, name := range pmu.CHNAMAnalog {
+			columns = append(columns, stn+"."+strings.TrimSpace(name))
+		}
+		for word := 0; word < int(pmu.Dgnmr); word++ {
+			for bit := 0; bit < 16; bit++ {
+				name := ""
+				if i := word*16 + bit; i < len(pmu.CHNAMDigital) {
+					name = strings.TrimSpace(pmu.CHNAMDigital[i])
+				}
+				if name == "" {
+					name = fmt.Sprintf("D%d.%d", word, bit)
+				}
+				columns = append(columns, stn+"."+name)
+			}
+		}
+	}
+	return columns
+}
+
+// Write appends a row, rotating the file first if a limit has been reached
+func (s *Sink) Write(m *synchrophasor.Measurements) error {
+	t := time.Unix(0, m.UnixNano()).UTC()
+
+	if s.shouldRotate(t) {
+		if err := s.rotate(t); err != nil {
+			return err
+		}
+	}
+
+	row := s.row[:0]
+	row = append(row, t.Format(time.RFC3339Nano))
+	for i := range m.Stations {
+		st := &m.Stations[i]
+		row = append(row,
+			strconv.FormatUint(uint64(st.Stat), 10),
+			formatFloat(float64(st.Frequency)),
+			formatFloat(float64(st.ROCOF)))
+		for _, ph := range st.Phasors {
+			row = append(row, formatFloat(cmplx.Abs(ph)), formatFloat(cmplx.Phase(ph)*180/math.Pi))
+		}
+		for _, v := range st.Analog {
+			row = append(row, formatFloat(float64(v)))
+		}
+		for _, word := range st.Digital {
+			for _, bit := range word {
+				if bit {
+					row = append(row, "1")
+				} else {
+					row = append(row, "0")
+				}
+			}
+		}
+	}
+	if len(row) != len(s.columns) {
+		return fmt.Errorf("%w: row has %d columns, want %d", synchrophasor.ErrInvalidParameter, len(row), len(s.columns))
+	}
+	s.row = row
+
+	if err := s.csv.Write(row); err != nil {
+		return err
+	}
+	// Push the row into the file buffer so the size limit is exact
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// Flush writes buffered rows to the current file
+func (s *Sink) Flush() error {
+	if s.buf == nil {
+		return nil
+	}
+	return s.buf.Flush()
+}
+
+// Close flushes and closes the current file
+func (s *Sink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := errors.Join(s.buf.Flush(), s.file.Close())
+	s.file, s.buf, s.csv = nil, nil, nil
+	return err
+}
+
+// FileName returns the path of the current file, or "" before the first write
+func (s *Sink) FileName() string {
+	if s.file == nil {
+		return ""
+	}
+	return s.file.Name()
+}
+
+// shouldRotate reports whether a row at t needs a new file
+func (s *Sink) shouldRotate(t time.Time) bool {
+	if s.file == nil {
+		return true
+	}
+	if s.opts.File != "" {
+		return false
+	}
+	if s.opts.MaxSize > 0 && s.count.n >= s.opts.MaxSize {
+		return true
+	}
+	return s.opts.MaxAge > 0 && t.Sub(s.opened) >= s.opts.MaxAge
+}
+
+// rotate closes the current file and opens a new one named after t
+func (s *Sink) rotate(t time.Time) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	var file *os.File
+	var err error
+	if s.opts.File != "" {
+		file, err = os.Create(s.opts.File)
+	} else {
+		file, err = s.create(t)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.file = file
+	s.buf = bufio.NewWriterSize(file, 64*1024)
+	s.count = &countingWriter{w: s.buf}
+	s.csv = csv.NewWriter(s.count)
+	s.opened = t
+
+	if err := s.csv.Write(s.columns); err != nil {
+		return err
+	}
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+// create creates a new file named after t, numbering it if the name is taken
+func (s *Sink) create(t time.Time) (*os.File, error) {
+	base := filepath.Join(s.opts.Dir, s.opts.Prefix+"-"+t.Format("20060102T150405.000Z"))
+	name := base + ".csv"
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if !errors.Is(err, os.ErrExist) {
+			return file, err
+		}
+		name = fmt.Sprintf("%s-%d.csv", base, i)
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write implements io.Writer
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// formatFloat formats v with the fewest digits that round-trip a float32
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 32)
+}
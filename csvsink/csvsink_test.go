@@ -0,0 +1,97 @@
+package csvsink
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFrame() *synchrophasor.DataFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Station A", 1, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+	station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+
+	station.PhasorValues[0] = complex(0, 230)
+	station.AnalogValues[0] = 1.5
+	station.DigitalValues[0][0] = true
+	station.Freq = 50.01
+
+	return synchrophasor.NewDataFrame(cfg)
+}
+
+func TestSinkWrite(t *testing.T) {
+	df := newTestFrame()
+	dir := t.TempDir()
+	sink, err := New(df.AssociatedConfig, Options{Dir: dir})
+	require.NoError(t, err)
+
+	var m synchrophasor.Measurements
+	df.SOC = 1760529600
+	df.FillMeasurements(&m)
+	require.NoError(t, sink.Write(&m))
+	name := sink.FileName()
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, rows, 2)
+	require.Equal(t, []string{"time", "Station A.stat", "Station A.freq", "Station A.rocof",
+		"Station A.VA.mag", "Station A.VA.ang", "Station A.P", "Station A.BRK1"}, rows[0][:8])
+	require.Len(t, rows[0], 4+2+1+16)
+	require.Equal(t, []string{"2025-10-15T12:00:00Z", "0", "50.01", "0", "230", "90", "1.5", "1"}, rows[1][:8])
+}
+
+func TestSinkRotate(t *testing.T) {
+	df := newTestFrame()
+	dir := t.TempDir()
+	sink, err := New(df.AssociatedConfig, Options{Dir: dir, Prefix: "pmu", MaxAge: time.Second})
+	require.NoError(t, err)
+
+	var m synchrophasor.Measurements
+	for i := 0; i < 5; i++ {
+		df.SOC = uint32(1760529600 + i/2)
+		df.FillMeasurements(&m)
+		require.NoError(t, sink.Write(&m))
+	}
+	require.NoError(t, sink.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "pmu-*.csv"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+}
+
+func TestSinkFile(t *testing.T) {
+	df := newTestFrame()
+	name := filepath.Join(t.TempDir(), "capture.csv")
+	sink, err := New(df.AssociatedConfig, Options{File: name, MaxAge: time.Second})
+	require.NoError(t, err)
+
+	var m synchrophasor.Measurements
+	for i := 0; i < 5; i++ {
+		df.SOC = uint32(1760529600 + i)
+		df.FillMeasurements(&m)
+		require.NoError(t, sink.Write(&m))
+	}
+	require.Equal(t, name, sink.FileName())
+	require.NoError(t, sink.Close())
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 6)
+}
@@ -1,10 +1,13 @@
 package synchrophasor
 
 import (
-	"bytes"
 	"encoding/binary"
+	"errors"
 	"io"
+	"math"
 	"math/cmplx"
+	"sync"
+	"time"
 )
 
 // DataFrame represents a data frame
@@ -24,53 +27,63 @@ func NewDataFrame(cfg *ConfigFrame) *DataFrame {
 
 // Pack converts data frame to bytes
 func (d *DataFrame) Pack() ([]byte, error) {
-	if d.AssociatedConfig == nil {
-		return nil, ErrInvalidParameter
-	}
+	return d.AppendTo(nil)
+}
 
-	// Calculate frame size
-	size := uint16(14)
+// Reset prepares the frame for reuse with cfg instead of allocating a new one.
+// The header is cleared and the per-station value slices of cfg are resized and
+// zeroed in place, reusing their existing capacity.
+func (d *DataFrame) Reset(cfg *ConfigFrame) {
+	d.C37118 = C37118{Sync: (SyncAA << 8) | SyncData}
+	d.AssociatedConfig = cfg
 
-	for _, pmu := range d.AssociatedConfig.PMUStationList {
-		size += 2
+	if cfg == nil {
+		return
+	}
+	for _, pmu := range cfg.PMUStationList {
+		pmu.ResetValues()
+	}
+}
 
-		if pmu.FormatPhasorType() {
-			size += 8 * pmu.Phnmr
-		} else {
-			size += 4 * pmu.Phnmr
-		}
+// PackTo writes the data frame to w in a single call using a pooled buffer and returns the number of bytes written
+func (d *DataFrame) PackTo(w io.Writer) (int, error) {
+	return packTo(w, d)
+}
 
-		if pmu.FormatFreqType() {
-			size += 8
-		} else {
-			size += 4
-		}
+// AppendTo appends the packed data frame to dst and returns the extended slice.
+// Reusing dst across ticks avoids allocating a new frame buffer each time.
+func (d *DataFrame) AppendTo(dst []byte) ([]byte, error) {
+	if d.AssociatedConfig == nil {
+		return dst, ErrInvalidParameter
+	}
 
-		if pmu.FormatAnalogType() {
-			size += 4 * pmu.Annmr
-		} else {
-			size += 2 * pmu.Annmr
-		}
+	// Calculate frame size
+	size := 14
 
-		// Digital data
-		size += 2 * pmu.Dgnmr
+	for _, pmu := range d.AssociatedConfig.PMUStationList {
+		size += pmu.dataSize()
 	}
 
 	size += 2 // CRC
-	d.FrameSize = size
+	if size > math.MaxUint16 {
+		return dst, ErrInvalidSize
+	}
+	d.FrameSize = uint16(size)
 
-	buf := new(bytes.Buffer)
+	start := len(dst)
+	if cap(dst)-start < size {
+		grown := make([]byte, start, start+size)
+		copy(grown, dst)
+		dst = grown
+	}
 
 	// Write header
-	if err := writeBinary(buf, d.Sync, d.FrameSize, d.IDCode, d.SOC, d.FracSec); err != nil {
-		return nil, err
-	}
+	dst = d.appendHeader(dst)
 
 	// Write data for each PMU
 	for _, pmu := range d.AssociatedConfig.PMUStationList {
-		if err := binary.Write(buf, binary.BigEndian, pmu.Stat); err != nil {
-			return nil, err
-		}
+		pmu.sizeValues()
+		dst = binary.BigEndian.AppendUint16(dst, pmu.Stat)
 
 		// Phasors
 		for j := 0; j < int(pmu.Phnmr); j++ {
@@ -78,18 +91,12 @@ func (d *DataFrame) Pack() ([]byte, error) {
 				// Float format
 				if pmu.FormatCoord() {
 					// Polar
-					mag := float32(cmplx.Abs(pmu.PhasorValues[j]))
-					ang := float32(cmplx.Phase(pmu.PhasorValues[j]))
-					if err := writeBinary(buf, mag, ang); err != nil {
-						return nil, err
-					}
+					dst = appendFloat32(dst, float32(cmplx.Abs(pmu.PhasorValues[j])))
+					dst = appendFloat32(dst, float32(cmplx.Phase(pmu.PhasorValues[j])))
 				} else {
 					// Rectangular
-					re := float32(real(pmu.PhasorValues[j]))
-					im := float32(imag(pmu.PhasorValues[j]))
-					if err := writeBinary(buf, re, im); err != nil {
-						return nil, err
-					}
+					dst = appendFloat32(dst, float32(real(pmu.PhasorValues[j])))
+					dst = appendFloat32(dst, float32(imag(pmu.PhasorValues[j])))
 				}
 			} else {
 				// Integer format
@@ -97,20 +104,18 @@ func (d *DataFrame) Pack() ([]byte, error) {
 					// Polar
 					mag := cmplx.Abs(pmu.PhasorValues[j])
 					ang := cmplx.Phase(pmu.PhasorValues[j])
-					magInt := uint16(mag * 1e5 / float64(pmu.GetPhasorFactor(j)))
-					angInt := int16(ang * 1e4)
-					if err := writeBinary(buf, magInt, angInt); err != nil {
-						return nil, err
-					}
+					magInt := uint16(math.Round(mag * 1e5 / float64(pmu.GetPhasorFactor(j))))
+					angInt := int16(math.Round(ang * 1e4))
+					dst = binary.BigEndian.AppendUint16(dst, magInt)
+					dst = binary.BigEndian.AppendUint16(dst, uint16(angInt))
 				} else {
 					// Rectangular
 					re := real(pmu.PhasorValues[j])
 					im := imag(pmu.PhasorValues[j])
-					reInt := int16(re * 1e5 / float64(pmu.GetPhasorFactor(j)))
-					imInt := int16(im * 1e5 / float64(pmu.GetPhasorFactor(j)))
-					if err := writeBinary(buf, reInt, imInt); err != nil {
-						return nil, err
-					}
+					reInt := int16(math.Round(re * 1e5 / float64(pmu.GetPhasorFactor(j))))
+					imInt := int16(math.Round(im * 1e5 / float64(pmu.GetPhasorFactor(j))))
+					dst = binary.BigEndian.AppendUint16(dst, uint16(reInt))
+					dst = binary.BigEndian.AppendUint16(dst, uint16(imInt))
 				}
 			}
 		}
@@ -118,32 +123,26 @@ func (d *DataFrame) Pack() ([]byte, error) {
 		// Freq and DFreq
 		if pmu.FormatFreqType() {
 			// Float format
-			if err := writeBinary(buf, pmu.Freq, pmu.DFreq); err != nil {
-				return nil, err
-			}
+			dst = appendFloat32(dst, pmu.Freq)
+			dst = appendFloat32(dst, pmu.DFreq)
 		} else {
-			// Integer format
+			// Integer format, rounded so that decoded values encode to the same bytes
 			freqOffset := pmu.Freq - pmu.GetNominalFrequency()
-			freqInt := int16(freqOffset * 1000)
-			dfreqInt := int16(pmu.DFreq * 100)
-			if err := writeBinary(buf, freqInt, dfreqInt); err != nil {
-				return nil, err
-			}
+			freqInt := int16(math.Round(float64(freqOffset) * 1000))
+			dfreqInt := int16(math.Round(float64(pmu.DFreq) * 100))
+			dst = binary.BigEndian.AppendUint16(dst, uint16(freqInt))
+			dst = binary.BigEndian.AppendUint16(dst, uint16(dfreqInt))
 		}
 
 		// Analog values
 		for j := 0; j < int(pmu.Annmr); j++ {
 			if pmu.FormatAnalogType() {
 				// Float format
-				if err := binary.Write(buf, binary.BigEndian, pmu.AnalogValues[j]); err != nil {
-					return nil, err
-				}
+				dst = appendFloat32(dst, pmu.AnalogValues[j])
 			} else {
 				// Integer format
-				analogInt := int16(pmu.AnalogValues[j])
-				if err := binary.Write(buf, binary.BigEndian, analogInt); err != nil {
-					return nil, err
-				}
+				analogInt := int16(math.Round(float64(pmu.AnalogValues[j])))
+				dst = binary.BigEndian.AppendUint16(dst, uint16(analogInt))
 			}
 		}
 
@@ -155,153 +154,219 @@ func (d *DataFrame) Pack() ([]byte, error) {
 					digWord |= 1 << uint(k)
 				}
 			}
-			if err := binary.Write(buf, binary.BigEndian, digWord); err != nil {
-				return nil, err
-			}
+			dst = binary.BigEndian.AppendUint16(dst, digWord)
 		}
 	}
 
-	data := buf.Bytes()
-	crc := CalcCRC(data)
-	if err := binary.Write(buf, binary.BigEndian, crc); err != nil {
-		return nil, err
-	}
-
-	return buf.Bytes(), nil
+	// Write CRC
+	return appendCRC(dst, start), nil
 }
 
 // Unpack parses bytes into data frame
 func (d *DataFrame) Unpack(data []byte) error {
-	if d.AssociatedConfig == nil {
-		return ErrInvalidParameter
+	if err := d.unpackHeader(data); err != nil {
+		return err
 	}
 
-	if len(data) < 16 {
+	r := &frameReader{data: data[:d.FrameSize-2]}
+	r.off = 14
+
+	for _, pmu := range d.AssociatedConfig.PMUStationList {
+		if err := pmu.unpackData(r); err != nil {
+			return err
+		}
+	}
+
+	// The station blocks have to end right before the CRC
+	if r.off != len(r.data) {
 		return ErrInvalidSize
 	}
 
-	buf := bytes.NewReader(data)
+	return d.verifyCRC(data)
+}
 
-	// Read header
-	if err := readBinary(buf, &d.Sync, &d.FrameSize); err != nil {
+// UnpackParallel parses bytes into data frame like Unpack, but decodes the
+// station blocks of large super-PDC frames on up to workers goroutines. Block
+// offsets are derived from the configuration, so the frame size has to match it
+// exactly. The CRC is verified before any station values are written.
+func (d *DataFrame) UnpackParallel(data []byte, workers int) error {
+	if err := d.unpackHeader(data); err != nil {
 		return err
 	}
 
-	if d.FrameSize < 16 {
+	stations := d.AssociatedConfig.PMUStationList
+	if workers > len(stations) {
+		workers = len(stations)
+	}
+	if workers <= 1 {
+		return d.Unpack(data)
+	}
+
+	// Compute block offsets from the configuration
+	offsets := make([]int, len(stations)+1)
+	offsets[0] = 14
+	for i, pmu := range stations {
+		offsets[i+1] = offsets[i] + pmu.dataSize()
+	}
+	if offsets[len(stations)]+2 != int(d.FrameSize) {
 		return ErrInvalidSize
 	}
 
-	if err := readBinary(buf, &d.IDCode, &d.SOC, &d.FracSec); err != nil {
+	if err := d.verifyCRC(data); err != nil {
 		return err
 	}
 
-	for _, pmu := range d.AssociatedConfig.PMUStationList {
-		// STAT
-		if err := binary.Read(buf, binary.BigEndian, &pmu.Stat); err != nil {
-			return err
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	chunk := (len(stations) + workers - 1) / workers
+
+	for w := 0; w < workers; w++ {
+		first := w * chunk
+		last := min(first+chunk, len(stations))
+		if first >= last {
+			break
 		}
 
-		// Phasors
-		for j := 0; j < int(pmu.Phnmr); j++ {
-			if pmu.FormatPhasorType() {
-				// Float format
-				var val1, val2 float32
-				if err := readBinary(buf, &val1, &val2); err != nil {
-					return err
-				}
+		wg.Add(1)
+		go func(w, first, last int) {
+			defer wg.Done()
 
-				if pmu.FormatCoord() {
-					// Polar: val1=magnitude, val2=angle
-					pmu.PhasorValues[j] = cmplx.Rect(float64(val1), float64(val2))
-				} else {
-					// Rectangular: val1=real, val2=imaginary
-					pmu.PhasorValues[j] = complex(float64(val1), float64(val2))
-				}
-			} else {
-				// Integer format
-				if pmu.FormatCoord() {
-					// Polar
-					var mag uint16
-					var ang int16
-					if err := readBinary(buf, &mag, &ang); err != nil {
-						return err
-					}
-
-					magFloat := float64(mag) * float64(pmu.GetPhasorFactor(j)) / 1e5
-					angFloat := float64(ang) / 1e4
-					pmu.PhasorValues[j] = cmplx.Rect(magFloat, angFloat)
-				} else {
-					// Rectangular
-					var re, im int16
-					if err := readBinary(buf, &re, &im); err != nil {
-						return err
-					}
-
-					reFloat := float64(re) * float64(pmu.GetPhasorFactor(j)) / 1e5
-					imFloat := float64(im) * float64(pmu.GetPhasorFactor(j)) / 1e5
-					pmu.PhasorValues[j] = complex(reFloat, imFloat)
+			r := &frameReader{data: data[:offsets[last]], off: offsets[first]}
+			for _, pmu := range stations[first:last] {
+				if err := pmu.unpackData(r); err != nil {
+					errs[w] = err
+					return
 				}
 			}
-		}
+		}(w, first, last)
+	}
+	wg.Wait()
 
-		// Freq and DFreq
-		if pmu.FormatFreqType() {
+	return errors.Join(errs...)
+}
+
+// unpackData decodes the station's data block of a data frame
+func (p *PMUStation) unpackData(r *frameReader) error {
+	p.sizeValues()
+
+	// STAT
+	p.Stat = r.uint16()
+
+	// Phasors
+	for j := 0; j < int(p.Phnmr); j++ {
+		if p.FormatPhasorType() {
 			// Float format
-			if err := readBinary(buf, &pmu.Freq, &pmu.DFreq); err != nil {
-				return err
+			val1 := r.float32()
+			val2 := r.float32()
+
+			if p.FormatCoord() {
+				// Polar: val1=magnitude, val2=angle
+				p.PhasorValues[j] = cmplx.Rect(float64(val1), float64(val2))
+			} else {
+				// Rectangular: val1=real, val2=imaginary
+				p.PhasorValues[j] = complex(float64(val1), float64(val2))
 			}
 		} else {
 			// Integer format
-			var freqInt int16
-			var dfreqInt int16
-			if err := readBinary(buf, &freqInt, &dfreqInt); err != nil {
-				return err
+			if p.FormatCoord() {
+				// Polar
+				mag := r.uint16()
+				ang := int16(r.uint16())
+
+				magFloat := float64(mag) * float64(p.GetPhasorFactor(j)) / 1e5
+				angFloat := float64(ang) / 1e4
+				p.PhasorValues[j] = cmplx.Rect(magFloat, angFloat)
+			} else {
+				// Rectangular
+				re := int16(r.uint16())
+				im := int16(r.uint16())
+
+				reFloat := float64(re) * float64(p.GetPhasorFactor(j)) / 1e5
+				imFloat := float64(im) * float64(p.GetPhasorFactor(j)) / 1e5
+				p.PhasorValues[j] = complex(reFloat, imFloat)
 			}
+		}
+	}
+
+	// Freq and DFreq
+	if p.FormatFreqType() {
+		// Float format
+		p.Freq = r.float32()
+		p.DFreq = r.float32()
+	} else {
+		// Integer format
+		freqInt := int16(r.uint16())
+		dfreqInt := int16(r.uint16())
+
+		p.Freq = p.GetNominalFrequency() + float32(freqInt)/1000.0
+		p.DFreq = float32(dfreqInt) / 100.0
+	}
 
-			pmu.Freq = pmu.GetNominalFrequency() + float32(freqInt)/1000.0
-			pmu.DFreq = float32(dfreqInt) / 100.0
+	// Analog values
+	for j := 0; j < int(p.Annmr); j++ {
+		if p.FormatAnalogType() {
+			// Float format
+			p.AnalogValues[j] = r.float32()
+		} else {
+			// Integer format
+			p.AnalogValues[j] = float32(int16(r.uint16()))
 		}
+	}
 
-		// Analog values
-		for j := 0; j < int(pmu.Annmr); j++ {
-			if pmu.FormatAnalogType() {
-				// Float format
-				if err := binary.Read(buf, binary.BigEndian, &pmu.AnalogValues[j]); err != nil {
-					return err
-				}
-			} else {
-				// Integer format
-				var analogInt int16
-				if err := binary.Read(buf, binary.BigEndian, &analogInt); err != nil {
-					return err
-				}
-				pmu.AnalogValues[j] = float32(analogInt)
-			}
+	// Digital values
+	for j := 0; j < int(p.Dgnmr); j++ {
+		digWord := r.uint16()
+		for k := 0; k < 16; k++ {
+			p.DigitalValues[j][k] = (digWord & (1 << uint(k))) != 0
 		}
+	}
 
-		// Digital values
-		for j := 0; j < int(pmu.Dgnmr); j++ {
-			var digWord uint16
-			if err := binary.Read(buf, binary.BigEndian, &digWord); err != nil {
-				return err
-			}
-			for k := 0; k < 16; k++ {
-				pmu.DigitalValues[j][k] = (digWord & (1 << uint(k))) != 0
-			}
+	return r.err
+}
+
+// sizeValues makes the value slices match the channel counts, which
+// stations built without AddPhasor and friends do not
+func (p *PMUStation) sizeValues() {
+	if len(p.PhasorValues) != int(p.Phnmr) {
+		p.PhasorValues = resize(p.PhasorValues, int(p.Phnmr))
+	}
+	if len(p.AnalogValues) != int(p.Annmr) {
+		p.AnalogValues = resize(p.AnalogValues, int(p.Annmr))
+	}
+	if len(p.DigitalValues) != int(p.Dgnmr) {
+		p.DigitalValues = resize(p.DigitalValues, int(p.Dgnmr))
+	}
+	for j, word := range p.DigitalValues {
+		if len(word) != 16 {
+			p.DigitalValues[j] = resize(word, 16)
 		}
 	}
+}
 
-	// Read CRC
-	if _, err := buf.Seek(int64(d.FrameSize-2), io.SeekStart); err != nil {
-		return err
+// unpackHeader reads and validates the common header of a data frame
+func (d *DataFrame) unpackHeader(data []byte) error {
+	if d.AssociatedConfig == nil {
+		return ErrInvalidParameter
 	}
-	if err := binary.Read(buf, binary.BigEndian, &d.CHK); err != nil {
-		return err
+
+	if len(data) < 16 {
+		return ErrInvalidSize
+	}
+
+	d.readHeader(&frameReader{data: data})
+
+	if d.FrameSize < 16 || int(d.FrameSize) > len(data) {
+		return ErrInvalidSize
 	}
 
-	// Verify CRC
-	crcData := data[:d.FrameSize-2]
-	if CalcCRC(crcData) != d.CHK {
+	return nil
+}
+
+// verifyCRC reads the frame CRC into CHK and checks it against the frame contents
+func (d *DataFrame) verifyCRC(data []byte) error {
+	d.CHK = binary.BigEndian.Uint16(data[d.FrameSize-2:])
+
+	if CalcCRC(data[:d.FrameSize-2]) != d.CHK {
 		return ErrCRCFailed
 	}
 
@@ -333,3 +398,127 @@ func (d *DataFrame) GetMeasurements() map[string]interface{} {
 		"measurements": measurements,
 	}
 }
+
+// SetMeasurements copies m into the station values of the associated
+// configuration and sets IDCODE, SOC and FRACSEC from m with a clear time
+// quality, the inverse of FillMeasurements
+func (d *DataFrame) SetMeasurements(m *Measurements) error {
+	cfg := d.AssociatedConfig
+	if cfg == nil || len(m.Stations) != len(cfg.PMUStationList) {
+		return ErrInvalidParameter
+	}
+	for i, pmu := range cfg.PMUStationList {
+		s := &m.Stations[i]
+		if len(s.Phasors) != len(pmu.PhasorValues) || len(s.Analog) != len(pmu.AnalogValues) ||
+			len(s.Digital) != len(pmu.DigitalValues) {
+			return ErrInvalidParameter
+		}
+	}
+
+	d.IDCode = m.PMUID
+	sec, frac := math.Modf(m.Time)
+	d.SOC = uint32(sec)
+	d.FracSec = uint32(math.Round(frac*float64(cfg.TimeBase&0x00FFFFFF))) & 0x00FFFFFF
+	for i, pmu := range cfg.PMUStationList {
+		s := &m.Stations[i]
+		pmu.Stat = s.Stat
+		pmu.Freq = s.Frequency
+		pmu.DFreq = s.ROCOF
+		copy(pmu.PhasorValues, s.Phasors)
+		copy(pmu.AnalogValues, s.Analog)
+		for j, word := range s.Digital {
+			copy(pmu.DigitalValues[j], word)
+		}
+	}
+	return nil
+}
+
+// Measurements is a typed view of the values carried by a data frame
+type Measurements struct {
+	PMUID    uint16               `json:"pmu_id"`
+	Time     float64              `json:"time"`
+	Stations []StationMeasurement `json:"stations"`
+}
+
+// StationMeasurement holds the values of one PMU station
+type StationMeasurement struct {
+	StreamID  uint16       `json:"stream_id"`
+	Stat      uint16       `json:"stat"`
+	Phasors   []complex128 `json:"phasors"`
+	Analog    []float32    `json:"analog"`
+	Digital   [][]bool     `json:"digital"`
+	Frequency float32      `json:"frequency"`
+	ROCOF     float32      `json:"rocof"`
+	// Quality is the data-quality score from 0 for unusable to 1 for good
+	// data set by the quality package, zero unless scored
+	Quality float32 `json:"quality"`
+}
+
+// UnixNano returns the measurement time in nanoseconds since the epoch,
+// rounded to microseconds to drop the float noise below the usual TIME_BASE
+// resolution
+func (m *Measurements) UnixNano() int64 {
+	sec, frac := math.Modf(m.Time)
+	return int64(sec)*int64(time.Second) + int64(math.Round(frac*1e6))*int64(time.Microsecond)
+}
+
+// CopyTo copies m into dst, reusing the slices already held by dst
+func (m *Measurements) CopyTo(dst *Measurements) {
+	dst.PMUID = m.PMUID
+	dst.Time = m.Time
+	dst.Stations = resize(dst.Stations, len(m.Stations))
+	for i := range m.Stations {
+		m.Stations[i].CopyTo(&dst.Stations[i])
+	}
+}
+
+// Clone returns a deep copy of m
+func (m *Measurements) Clone() *Measurements {
+	c := &Measurements{}
+	m.CopyTo(c)
+	return c
+}
+
+// CopyTo copies s into dst, reusing the slices already held by dst
+func (s *StationMeasurement) CopyTo(dst *StationMeasurement) {
+	dst.StreamID, dst.Stat, dst.Quality = s.StreamID, s.Stat, s.Quality
+	dst.Frequency, dst.ROCOF = s.Frequency, s.ROCOF
+	dst.Phasors = append(dst.Phasors[:0], s.Phasors...)
+	dst.Analog = append(dst.Analog[:0], s.Analog...)
+	dst.Digital = resize(dst.Digital, len(s.Digital))
+	for j, word := range s.Digital {
+		dst.Digital[j] = append(dst.Digital[j][:0], word...)
+	}
+}
+
+// FillMeasurements copies the frame's measurements into m, reusing the slices
+// already held by m. Once m has grown to the configuration's size no further
+// allocations are made, unlike GetMeasurements.
+func (d *DataFrame) FillMeasurements(m *Measurements) {
+	cfg := d.AssociatedConfig
+
+	m.PMUID = d.IDCode
+	m.Time = float64(d.SOC) + float64(d.FracSec&0x00FFFFFF)/float64(cfg.TimeBase)
+	m.Stations = resize(m.Stations, len(cfg.PMUStationList))
+
+	for i, pmu := range cfg.PMUStationList {
+		s := &m.Stations[i]
+		s.StreamID = pmu.IDCode
+		s.Stat = pmu.Stat
+		s.Frequency = pmu.Freq
+		s.ROCOF = pmu.DFreq
+		s.Quality = 0
+
+		s.Phasors = resize(s.Phasors, len(pmu.PhasorValues))
+		copy(s.Phasors, pmu.PhasorValues)
+
+		s.Analog = resize(s.Analog, len(pmu.AnalogValues))
+		copy(s.Analog, pmu.AnalogValues)
+
+		s.Digital = resize(s.Digital, len(pmu.DigitalValues))
+		for j, word := range pmu.DigitalValues {
+			s.Digital[j] = resize(s.Digital[j], len(word))
+			copy(s.Digital[j], word)
+		}
+	}
+}
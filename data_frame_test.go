@@ -0,0 +1,267 @@
+package synchrophasor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataFrameReset(t *testing.T) {
+	src := newBenchConfig(2)
+	for i, station := range src.PMUStationList {
+		station.Stat = 0x0010
+		station.PhasorValues[0] = complex(float64(230+i), 0)
+		station.AnalogValues[0] = float32(100 + i)
+		station.DigitalValues[0][3] = true
+		station.Freq = 50.01
+	}
+
+	data, err := NewDataFrame(src).Pack()
+	require.NoError(t, err)
+
+	// Decode into a config copy, as a PDC would
+	cfgBytes, err := src.Pack()
+	require.NoError(t, err)
+	dst := NewConfigFrame()
+	require.NoError(t, dst.Unpack(cfgBytes))
+
+	df := &DataFrame{}
+	for round := 0; round < 2; round++ {
+		df.Reset(dst)
+		require.Zero(t, dst.PMUStationList[0].Freq)
+		require.False(t, dst.PMUStationList[0].DigitalValues[0][3])
+
+		require.NoError(t, df.Unpack(data))
+		for i, station := range dst.PMUStationList {
+			require.Equal(t, uint16(0x0010), station.Stat)
+			require.InDelta(t, float64(230+i), real(station.PhasorValues[0]), 1e-3)
+			require.Equal(t, float32(100+i), station.AnalogValues[0])
+			require.True(t, station.DigitalValues[0][3])
+			require.InDelta(t, 50.01, station.Freq, 1e-4)
+		}
+	}
+}
+
+func TestDataFrameAppendTo(t *testing.T) {
+	df := NewDataFrame(newBenchConfig(3))
+	df.IDCode = 7734
+
+	packed, err := df.Pack()
+	require.NoError(t, err)
+
+	prefix := []byte{0x01, 0x02}
+	appended, err := df.AppendTo(prefix)
+	require.NoError(t, err)
+	require.Equal(t, prefix, appended[:2])
+	require.Equal(t, packed, appended[2:])
+
+	var buf bytes.Buffer
+	n, err := df.PackTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, len(packed), n)
+	require.Equal(t, packed, buf.Bytes())
+
+	require.NoError(t, NewDataFrame(newBenchConfig(3)).Unpack(packed))
+	require.ErrorIs(t, NewDataFrame(newBenchConfig(3)).Unpack(packed[:len(packed)-4]), ErrInvalidSize)
+}
+
+func TestDataFrameFillMeasurements(t *testing.T) {
+	cfg := newBenchConfig(2)
+	cfg.PMUStationList[1].PhasorValues[2] = complex(230, 10)
+	cfg.PMUStationList[1].DigitalValues[0][5] = true
+	cfg.PMUStationList[1].Freq = 49.98
+
+	df := NewDataFrame(cfg)
+	df.IDCode = 7734
+	df.SOC = 1149591600
+	df.FracSec = 500000
+
+	var m Measurements
+	df.FillMeasurements(&m)
+
+	require.Equal(t, uint16(7734), m.PMUID)
+	require.InDelta(t, 1149591600.5, m.Time, 1e-6)
+	require.Len(t, m.Stations, 2)
+	require.Equal(t, uint16(2), m.Stations[1].StreamID)
+	require.Equal(t, complex(230, 10), m.Stations[1].Phasors[2])
+	require.True(t, m.Stations[1].Digital[0][5])
+	require.Equal(t, float32(49.98), m.Stations[1].Frequency)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		df.FillMeasurements(&m)
+	})
+	require.Zero(t, allocs)
+}
+
+func TestMeasurementsCopyTo(t *testing.T) {
+	cfg := newBenchConfig(2)
+	cfg.PMUStationList[1].PhasorValues[2] = complex(230, 10)
+	cfg.PMUStationList[1].DigitalValues[0][5] = true
+	df := NewDataFrame(cfg)
+	df.SOC = 1149591600
+	df.FracSec = 250000
+	var m Measurements
+	df.FillMeasurements(&m)
+	require.Equal(t, int64(1149591600250000000), m.UnixNano())
+
+	c := m.Clone()
+	require.Equal(t, &m, c)
+	c.Stations[1].Phasors[2] = 0
+	c.Stations[1].Digital[0][5] = false
+	require.Equal(t, complex(230, 10), m.Stations[1].Phasors[2])
+	require.True(t, m.Stations[1].Digital[0][5])
+
+	m.CopyTo(c)
+	require.Equal(t, &m, c)
+	allocs := testing.AllocsPerRun(100, func() {
+		m.CopyTo(c)
+	})
+	require.Zero(t, allocs)
+}
+
+func TestDataFrameSetMeasurements(t *testing.T) {
+	src := newBenchConfig(2)
+	src.PMUStationList[1].PhasorValues[2] = complex(230, 10)
+	src.PMUStationList[1].DigitalValues[0][5] = true
+	src.PMUStationList[0].Stat = 0x0200
+	df := NewDataFrame(src)
+	df.IDCode = 7734
+	df.SOC = 1149591600
+	df.FracSec = 250000
+	var m Measurements
+	df.FillMeasurements(&m)
+
+	dst := NewDataFrame(newBenchConfig(2))
+	require.NoError(t, dst.SetMeasurements(&m))
+	require.Equal(t, df.C37118.IDCode, dst.IDCode)
+	require.Equal(t, uint32(1149591600), dst.SOC)
+	require.Equal(t, uint32(250000), dst.FracSec)
+	want, err := df.Pack()
+	require.NoError(t, err)
+	got, err := dst.Pack()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	m.Stations = m.Stations[:1]
+	require.ErrorIs(t, dst.SetMeasurements(&m), ErrInvalidParameter)
+}
+
+func TestDataFrameUnpackParallel(t *testing.T) {
+	src := newBenchConfig(100)
+	for i, station := range src.PMUStationList {
+		station.Stat = uint16(i)
+		station.PhasorValues[1] = complex(float64(i), 1)
+		station.AnalogValues[0] = float32(i)
+		station.Freq = 50 + float32(i)/1000
+	}
+	data, err := NewDataFrame(src).Pack()
+	require.NoError(t, err)
+
+	for _, workers := range []int{0, 1, 4, 7, 100, 200} {
+		dst := newBenchConfig(100)
+		require.NoError(t, NewDataFrame(dst).UnpackParallel(data, workers))
+		for i, station := range dst.PMUStationList {
+			require.Equal(t, uint16(i), station.Stat)
+			require.InDelta(t, float64(i), real(station.PhasorValues[1]), 1e-3)
+			require.Equal(t, float32(i), station.AnalogValues[0])
+			require.InDelta(t, 50+float64(i)/1000, station.Freq, 1e-4)
+		}
+	}
+
+	corrupted := append([]byte(nil), data...)
+	corrupted[20] ^= 0xFF
+	require.ErrorIs(t, NewDataFrame(newBenchConfig(100)).UnpackParallel(corrupted, 4), ErrCRCFailed)
+	require.ErrorIs(t, NewDataFrame(newBenchConfig(99)).UnpackParallel(data, 4), ErrInvalidSize)
+}
+
+func TestDataFrameIntegerRoundTrip(t *testing.T) {
+	// Integer values decoded from another device encode to the same bytes
+	for _, polar := range []bool{false, true} {
+		cfg := NewConfigFrame()
+		cfg.TimeBase = 1000000
+		station := NewPMUStation("Station A", 1, false, false, false, polar)
+		station.AddPhasor("VA", 915527, PhunitVoltage)
+		station.AddAnalog("P", 1, AnunitPow)
+		cfg.AddPMUStation(station)
+
+		frame := make([]byte, 28)
+		binary.BigEndian.PutUint16(frame, uint16(SyncAA)<<8|SyncData)
+		binary.BigEndian.PutUint16(frame[2:], 28)
+		for x := -32768; x < 32768; x++ {
+			v := uint16(int16(x))
+			first, second := v, v
+			if polar {
+				// Magnitude without a zero losing the angle, angle within +-pi
+				first = v | 1
+				second = uint16(int16(x % 31415))
+			}
+			binary.BigEndian.PutUint16(frame[16:], first)
+			binary.BigEndian.PutUint16(frame[18:], second)
+			binary.BigEndian.PutUint16(frame[20:], v)
+			binary.BigEndian.PutUint16(frame[22:], v)
+			binary.BigEndian.PutUint16(frame[24:], v)
+			binary.BigEndian.PutUint16(frame[26:], CalcCRC(frame[:26]))
+
+			df := NewDataFrame(cfg)
+			require.NoError(t, df.Unpack(frame))
+			packed, err := df.Pack()
+			require.NoError(t, err)
+			if !bytes.Equal(frame, packed) {
+				t.Fatalf("polar %v, value %d: % x packed as % x", polar, x, frame[14:26], packed[14:26])
+			}
+		}
+	}
+}
+
+func TestDataFrameIntegerRounding(t *testing.T) {
+	// Scaled values are rounded half away from zero, not truncated
+	tests := []struct {
+		name          string
+		polar         bool
+		phasor        complex128
+		freq, dfreq   float32
+		analog        float32
+		first, second int16
+		freqInt       int16
+		dfreqInt      int16
+		analogInt     int16
+	}{
+		{name: "below half", phasor: complex(1.49, -1.49), freq: 0.0024, dfreq: 0.014, analog: 2.49,
+			first: 1, second: -1, freqInt: 2, dfreqInt: 1, analogInt: 2},
+		{name: "half", phasor: complex(1.5, -1.5), freq: 0.0026, dfreq: 0.016, analog: 2.5,
+			first: 2, second: -2, freqInt: 3, dfreqInt: 2, analogInt: 3},
+		{name: "negative half", phasor: complex(-2.5, 2.5), freq: -0.0026, dfreq: -0.016, analog: -2.5,
+			first: -3, second: 3, freqInt: -3, dfreqInt: -2, analogInt: -3},
+		{name: "polar below half", polar: true, phasor: cmplx.Rect(2.49, 0.000149),
+			first: 2, second: 1},
+		{name: "polar above half", polar: true, phasor: cmplx.Rect(2.51, 0.000151),
+			first: 3, second: 2},
+		{name: "polar negative angle", polar: true, phasor: cmplx.Rect(2.5, -0.000151),
+			first: 3, second: -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfigFrame()
+			station := NewPMUStation("Station A", 1, false, false, false, tt.polar)
+			station.AddPhasor("VA", 100000, PhunitVoltage)
+			station.AddAnalog("P", 1, AnunitPow)
+			cfg.AddPMUStation(station)
+			station.PhasorValues[0] = tt.phasor
+			station.Freq = station.GetNominalFrequency() + tt.freq
+			station.DFreq = tt.dfreq
+			station.AnalogValues[0] = tt.analog
+
+			data, err := NewDataFrame(cfg).Pack()
+			require.NoError(t, err)
+			word := func(offset int) int16 { return int16(binary.BigEndian.Uint16(data[offset:])) }
+			require.Equal(t, tt.first, word(16))
+			require.Equal(t, tt.second, word(18))
+			require.Equal(t, tt.freqInt, word(20))
+			require.Equal(t, tt.dfreqInt, word(22))
+			require.Equal(t, tt.analogInt, word(24))
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package synchrophasor
+
+// DerivedStream is a stream that extends another one by analog channels, as
+// the analytics packages append their results. Its configuration can be
+// served like any other, e.g. through downsample.NewOutput.
+type DerivedStream struct {
+	// Config is the configuration of the derived stream
+	Config *ConfigFrame
+	idCode uint16
+	// modified flags the stations that received channels
+	modified []bool
+}
+
+// NewDerivedStream returns a derived stream of cfg without channels of its
+// own. A nonzero idCode replaces the ID code of cfg.
+func NewDerivedStream(cfg *ConfigFrame, idCode uint16) *DerivedStream {
+	d := &DerivedStream{Config: cfg.Clone(), idCode: idCode, modified: make([]bool, len(cfg.PMUStationList))}
+	if idCode != 0 {
+		d.Config.IDCode = idCode
+	}
+	return d
+}
+
+// AddAnalog appends an analog channel to a station. Analog values of the
+// station are sent as floating point from then on.
+func (d *DerivedStream) AddAnalog(station int, name string) {
+	pmu := d.Config.PMUStationList[station]
+	pmu.Format |= 0x04
+	pmu.AddAnalog(name, 1, AnunitPow)
+	d.modified[station] = true
+}
+
+// CopyTo copies a measurement set of the original stream into dst, with the
+// ID code of the derived stream and the stations receiving channels flagged
+// as modified. The values of the channels are then appended to the analog
+// values of dst in the order they were added.
+func (d *DerivedStream) CopyTo(m, dst *Measurements) {
+	m.CopyTo(dst)
+	if d.idCode != 0 {
+		dst.PMUID = d.idCode
+	}
+	for i, modified := range d.modified {
+		if modified {
+			dst.Stations[i].Stat |= StatDataModified
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package synchrophasor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivedStream(t *testing.T) {
+	cfg := newBenchConfig(2)
+	cfg.PMUStationList[1].SetFormat(true, false, true, true)
+	d := NewDerivedStream(cfg, 99)
+	d.AddAnalog(1, "P")
+
+	require.Equal(t, uint16(99), d.Config.IDCode)
+	require.Equal(t, uint16(7734), cfg.IDCode)
+	require.Equal(t, "P               ", d.Config.PMUStationList[1].CHNAMAnalog[1])
+	require.True(t, d.Config.PMUStationList[1].FormatAnalogType())
+	require.Len(t, cfg.PMUStationList[1].CHNAMAnalog, 1)
+	require.False(t, cfg.PMUStationList[1].FormatAnalogType())
+
+	m := &Measurements{PMUID: 7734, Stations: []StationMeasurement{{Stat: 0x8000}, {Analog: []float32{1}}}}
+	var set Measurements
+	d.CopyTo(m, &set)
+	require.Equal(t, uint16(99), set.PMUID)
+	require.Equal(t, uint16(0x8000), set.Stations[0].Stat)
+	require.Equal(t, uint16(StatDataModified), set.Stations[1].Stat)
+	require.Zero(t, m.Stations[1].Stat)
+}
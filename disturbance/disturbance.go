@@ -0,0 +1,377 @@
+// Package disturbance detects voltage sags and swells, frequency excursions
+// and step changes on measurement streams and reports them as classified
+// events with start and end times and magnitudes, e.g. to raise alarms or to
+// tag archive ranges for later extraction
+package disturbance
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Kind classifies a disturbance
+type Kind uint8
+
+const (
+	// Sag is a voltage magnitude below SagLimit
+	Sag Kind = iota
+	// Swell is a voltage magnitude above SwellLimit
+	Swell
+	// UnderFrequency is a frequency below nominal by more than
+	// FrequencyLimit
+	UnderFrequency
+	// OverFrequency is a frequency above nominal by more than FrequencyLimit
+	OverFrequency
+	// Step is a sudden change of a voltage magnitude or angle between
+	// consecutive sets
+	Step
+)
+
+// String returns the name of the kind, e.g. for archive tags
+func (k Kind) String() string {
+	switch k {
+	case Sag:
+		return "sag"
+	case Swell:
+		return "swell"
+	case UnderFrequency:
+		return "underfrequency"
+	case OverFrequency:
+		return "overfrequency"
+	case Step:
+		return "step"
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Event reports a disturbance
+type Event struct {
+	Kind Kind
+	// Channel is "Sub 1.VA" for sags and swells, "Sub 1.freq" for frequency
+	// excursions and "Sub 1.VA.mag" or "Sub 1.VA.ang" for steps
+	Channel string
+	// Start and End are the measurement times of the first and last set of
+	// the disturbance, equal for steps
+	Start, End time.Time
+	// Magnitude is the lowest voltage of sags and highest of swells in per
+	// unit of the reference voltage, the extreme frequency in Hz, or the step
+	// in per unit or degrees
+	Magnitude float64
+}
+
+// Duration returns the length of the disturbance
+func (e Event) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// Options configures a Detector
+type Options struct {
+	// Voltages lists the monitored phasors, named "Sub 1.VA", defaulting to
+	// all voltage phasors
+	Voltages []string
+	// Nominal fixes the reference voltage of phasors by name. Phasors without
+	// one use a sliding reference following the magnitude with the time
+	// constant ReferenceTime, frozen during sags and swells.
+	Nominal map[string]float64
+	// ReferenceTime defaults to one minute
+	ReferenceTime time.Duration
+	// SagLimit and SwellLimit in per unit default to 0.9 and 1.1
+	SagLimit, SwellLimit float64
+	// Hysteresis in per unit the voltage must return by to end a sag or
+	// swell, defaults to 0.02
+	Hysteresis float64
+	// FrequencyLimit is the deviation from nominal frequency in Hz starting
+	// an excursion, defaults to 0.2, FrequencyHysteresis defaults to 0.02
+	FrequencyLimit, FrequencyHysteresis float64
+	// StepLimit is the change of a voltage magnitude in per unit between
+	// consecutive sets reported as step, defaults to 0.05, and StepAngle the
+	// change of its angle in degrees, defaults to 10. Steps are not reported
+	// during sags and swells.
+	StepLimit, StepAngle float64
+	// OnEvent is called from Write with every disturbance that ended and
+	// every step
+	OnEvent func(e Event)
+}
+
+// voltage is the state of a monitored phasor
+type voltage struct {
+	name           string
+	station, index int
+	nominal        float64
+	ref            float64
+	// mag and angle are the magnitude and angle of the previous valid set,
+	// last its time
+	mag, angle float64
+	last       int64
+	excursion
+}
+
+// excursion is an ongoing sag, swell or frequency excursion
+type excursion struct {
+	active    bool
+	kind      Kind
+	start     int64
+	end       int64
+	magnitude float64
+}
+
+// frequency is the state of the frequency of a station
+type frequency struct {
+	name    string
+	nominal float64
+	excursion
+}
+
+// Detector detects disturbances on a stream. Write must be called from a
+// single goroutine, Active may be called concurrently.
+type Detector struct {
+	opts     Options
+	mu       sync.Mutex
+	cfg      *synchrophasor.ConfigFrame
+	voltages []*voltage
+	freqs    []*frequency
+}
+
+// New creates a detector for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Detector, error) {
+	if opts.ReferenceTime <= 0 {
+		opts.ReferenceTime = time.Minute
+	}
+	if opts.SagLimit <= 0 {
+		opts.SagLimit = 0.9
+	}
+	if opts.SwellLimit <= 0 {
+		opts.SwellLimit = 1.1
+	}
+	if opts.Hysteresis <= 0 {
+		opts.Hysteresis = 0.02
+	}
+	if opts.FrequencyLimit <= 0 {
+		opts.FrequencyLimit = 0.2
+	}
+	if opts.FrequencyHysteresis <= 0 {
+		opts.FrequencyHysteresis = 0.02
+	}
+	if opts.StepLimit <= 0 {
+		opts.StepLimit = 0.05
+	}
+	if opts.StepAngle <= 0 {
+		opts.StepAngle = 10
+	}
+	d := &Detector{opts: opts}
+	if err := d.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetConfig replaces the configuration, restarting the detection
+func (d *Detector) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.setConfig(cfg)
+}
+
+// setConfig resolves the monitored channels in cfg, d.mu must be held
+func (d *Detector) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	phasors := make(map[string]*voltage)
+	var all []*voltage
+	freqs := make([]*frequency, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN)
+		freqs[i] = &frequency{name: stn + ".freq", nominal: float64(pmu.GetNominalFrequency())}
+		for j, name := range pmu.CHNAMPhasor {
+			v := &voltage{name: stn + "." + strings.TrimSpace(name), station: i, index: j}
+			phasors[v.name] = v
+			if j < len(pmu.Phunit) && pmu.Phunit[j]>>24 == synchrophasor.PhunitVoltage {
+				all = append(all, v)
+			}
+		}
+	}
+
+	voltages := all
+	if len(d.opts.Voltages) > 0 {
+		voltages = make([]*voltage, len(d.opts.Voltages))
+		for i, name := range d.opts.Voltages {
+			v, ok := phasors[name]
+			if !ok {
+				return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, name)
+			}
+			voltages[i] = v
+		}
+	}
+	for name, nominal := range d.opts.Nominal {
+		v, ok := phasors[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		v.nominal = nominal
+	}
+
+	d.cfg, d.voltages, d.freqs = cfg, voltages, freqs
+	return nil
+}
+
+// Write evaluates a measurement set, calling OnEvent for the disturbances it
+// ends. Stations with invalid data are skipped, so disturbances span data
+// gaps.
+func (d *Detector) Write(m *synchrophasor.Measurements) error {
+	d.mu.Lock()
+	if len(m.Stations) != len(d.cfg.PMUStationList) {
+		d.mu.Unlock()
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(d.cfg.PMUStationList))
+	}
+	for i, pmu := range d.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			d.mu.Unlock()
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := m.UnixNano()
+	var events []Event
+	for _, v := range d.voltages {
+		st := &m.Stations[v.station]
+		p := st.Phasors[v.index]
+		if st.Stat&synchrophasor.StatDataError != 0 || cmplx.IsNaN(p) || cmplx.IsInf(p) {
+			continue
+		}
+		events = append(events, d.voltage(v, t, cmplx.Abs(p), cmplx.Phase(p)*180/math.Pi)...)
+	}
+	for i, f := range d.freqs {
+		st := &m.Stations[i]
+		freq := float64(st.Frequency)
+		if st.Stat&synchrophasor.StatDataError != 0 || math.IsNaN(freq) || math.IsInf(freq, 0) {
+			continue
+		}
+		if ev, ok := d.frequency(f, t, freq); ok {
+			events = append(events, ev)
+		}
+	}
+	d.mu.Unlock()
+
+	if d.opts.OnEvent != nil {
+		for _, ev := range events {
+			d.opts.OnEvent(ev)
+		}
+	}
+	return nil
+}
+
+// voltage advances the state of a phasor with its magnitude and angle at
+// time t, returning the events
+func (d *Detector) voltage(v *voltage, t int64, mag, angle float64) []Event {
+	prev, prevMag, prevAngle := v.last, v.mag, v.angle
+	v.mag, v.angle, v.last = mag, angle, t
+
+	ref := v.nominal
+	if ref <= 0 {
+		if v.ref <= 0 {
+			v.ref = mag
+		}
+		ref = v.ref
+	}
+	if ref <= 0 {
+		return nil
+	}
+	pu := mag / ref
+
+	var events []Event
+	if !v.active && prev != 0 {
+		if step := (mag - prevMag) / ref; math.Abs(step) > d.opts.StepLimit {
+			events = append(events, d.step(v.name+".mag", t, step))
+		}
+		if step := math.Remainder(angle-prevAngle, 360); math.Abs(step) > d.opts.StepAngle {
+			events = append(events, d.step(v.name+".ang", t, step))
+		}
+	}
+
+	switch {
+	case !v.active && pu < d.opts.SagLimit:
+		v.excursion = excursion{active: true, kind: Sag, start: t, magnitude: pu}
+	case !v.active && pu > d.opts.SwellLimit:
+		v.excursion = excursion{active: true, kind: Swell, start: t, magnitude: pu}
+	case v.active && v.kind == Sag && pu < d.opts.SagLimit+d.opts.Hysteresis:
+		v.magnitude = min(v.magnitude, pu)
+	case v.active && v.kind == Swell && pu > d.opts.SwellLimit-d.opts.Hysteresis:
+		v.magnitude = max(v.magnitude, pu)
+	case v.active:
+		v.active = false
+		events = append(events, v.event(v.name))
+	}
+	v.excursion.end = t
+
+	if v.nominal <= 0 && !v.active {
+		// First-order filter for the interval since the previous set
+		alpha := 1 - math.Exp(-float64(t-prev)/float64(d.opts.ReferenceTime))
+		v.ref += alpha * (mag - v.ref)
+	}
+	return events
+}
+
+// frequency advances the state of a station frequency at time t, returning
+// the event if an excursion ended
+func (d *Detector) frequency(f *frequency, t int64, freq float64) (Event, bool) {
+	dev := freq - f.nominal
+	limit, hyst := d.opts.FrequencyLimit, d.opts.FrequencyHysteresis
+	var ev Event
+	ended := false
+	switch {
+	case !f.active && dev < -limit:
+		f.excursion = excursion{active: true, kind: UnderFrequency, start: t, magnitude: freq}
+	case !f.active && dev > limit:
+		f.excursion = excursion{active: true, kind: OverFrequency, start: t, magnitude: freq}
+	case f.active && f.kind == UnderFrequency && dev < -limit+hyst:
+		f.magnitude = min(f.magnitude, freq)
+	case f.active && f.kind == OverFrequency && dev > limit-hyst:
+		f.magnitude = max(f.magnitude, freq)
+	case f.active:
+		f.active = false
+		ev, ended = f.event(f.name), true
+	}
+	f.excursion.end = t
+	return ev, ended
+}
+
+// step returns the event of a step at time t
+func (d *Detector) step(channel string, t int64, step float64) Event {
+	at := time.Unix(0, t).UTC()
+	return Event{Kind: Step, Channel: channel, Start: at, End: at, Magnitude: step}
+}
+
+// event returns the event of the excursion, ending with the previous set
+func (e *excursion) event(channel string) Event {
+	return Event{
+		Kind:      e.kind,
+		Channel:   channel,
+		Start:     time.Unix(0, e.start).UTC(),
+		End:       time.Unix(0, e.end).UTC(),
+		Magnitude: e.magnitude,
+	}
+}
+
+// Active returns the ongoing sags, swells and frequency excursions, ending
+// with the latest set
+func (d *Detector) Active() []Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var active []Event
+	for _, v := range d.voltages {
+		if v.active {
+			active = append(active, v.event(v.name))
+		}
+	}
+	for _, f := range d.freqs {
+		if f.active {
+			active = append(active, f.event(f.name))
+		}
+	}
+	return active
+}
@@ -0,0 +1,113 @@
+package disturbance
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.Fnom = synchrophasor.FreqNom50Hz
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// VA magnitudes and the frequencies of the stations
+func set(cfg *synchrophasor.ConfigFrame, i int, mags, freqs []float64) *synchrophasor.Measurements {
+	for j, pmu := range cfg.PMUStationList {
+		pmu.PhasorValues[0] = complex(mags[j], 0)
+		pmu.PhasorValues[1] = cmplx.Rect(100, -math.Pi/6)
+		pmu.Freq = float32(freqs[j])
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+func at(i int) time.Time {
+	return testutil.FrameTime(10, i).UTC()
+}
+
+func TestDetector(t *testing.T) {
+	cfg := testConfig()
+	var events []Event
+	d, err := New(cfg, Options{
+		Nominal: map[string]float64{"Sub 2.VA": 230},
+		OnEvent: func(e Event) { events = append(events, e) },
+	})
+	require.NoError(t, err)
+
+	write := func(from, to int, mags, freqs []float64) {
+		for i := from; i < to; i++ {
+			require.NoError(t, d.Write(set(cfg, i, mags, freqs)))
+		}
+	}
+	// Sub 1 follows its own level with the sliding reference
+	write(0, 10, []float64{63500, 230}, []float64{50, 50})
+	require.Empty(t, events)
+
+	// A sag at Sub 1 starting with a step, and a swell and underfrequency at
+	// Sub 2
+	write(10, 13, []float64{50800, 260}, []float64{50, 49.75})
+	require.Equal(t, []Event{
+		{Kind: Step, Channel: "Sub 1.VA.mag", Start: at(10), End: at(10), Magnitude: -0.2},
+		{Kind: Step, Channel: "Sub 2.VA.mag", Start: at(10), End: at(10), Magnitude: 0.1304},
+	}, roundAll(events))
+	require.NoError(t, d.Write(set(cfg, 13, []float64{44450, 255}, []float64{50, 49.7})))
+	active := d.Active()
+	require.Len(t, active, 3)
+	require.Equal(t, Sag, active[0].Kind)
+	require.Equal(t, Swell, active[1].Kind)
+	require.Equal(t, UnderFrequency, active[2].Kind)
+	require.Equal(t, "Sub 2.freq", active[2].Channel)
+
+	// Invalid data does not end them, the hysteresis does
+	invalid := set(cfg, 14, []float64{0, 0}, []float64{0, 0})
+	invalid.Stations[0].Stat = 0x8000
+	invalid.Stations[1].Stat = 0x8000
+	require.NoError(t, d.Write(invalid))
+	write(15, 16, []float64{57800, 250}, []float64{50, 49.79})
+	require.Len(t, events, 2)
+	write(16, 17, []float64{63500, 230}, []float64{50, 49.9})
+	require.Equal(t, []Event{
+		{Kind: Sag, Channel: "Sub 1.VA", Start: at(10), End: at(15), Magnitude: 0.7},
+		{Kind: Swell, Channel: "Sub 2.VA", Start: at(10), End: at(15), Magnitude: 1.1304},
+		{Kind: UnderFrequency, Channel: "Sub 2.freq", Start: at(10), End: at(15), Magnitude: 49.7},
+	}, roundAll(events[2:]))
+	require.Equal(t, 500*time.Millisecond, events[2].Duration())
+	require.Empty(t, d.Active())
+
+	// Angle steps
+	m := set(cfg, 17, []float64{63500, 230}, []float64{50, 50})
+	m.Stations[0].Phasors[0] = cmplx.Rect(63500, 15*math.Pi/180)
+	require.NoError(t, d.Write(m))
+	require.Equal(t, Event{Kind: Step, Channel: "Sub 1.VA.ang", Start: at(17), End: at(17), Magnitude: 15},
+		round(events[5]))
+	require.Equal(t, "overfrequency", OverFrequency.String())
+
+	require.ErrorIs(t, d.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Voltages: []string{"Sub 3.VA"}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Nominal: map[string]float64{"Sub 1.VB": 230}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
+
+// round rounds the magnitude of an event to four decimals
+func round(e Event) Event {
+	e.Magnitude = math.Round(e.Magnitude*1e4) / 1e4
+	return e
+}
+
+func roundAll(events []Event) []Event {
+	out := make([]Event, len(events))
+	for i, e := range events {
+		out[i] = round(e)
+	}
+	return out
+}
@@ -0,0 +1,271 @@
+package dnp3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/cmplx"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.Freq = 50
+		station.PhasorValues[0] = cmplx.Rect(230, 30*math.Pi/180)
+	})
+}
+
+var testPoints = []Point{
+	{Index: 0, Kind: KindFrequency, Class: Class1, Deadband: 0.01},
+	{Index: 1, Kind: KindMagnitude, Channel: "VA", Class: Class2, Deadband: 1},
+	{Index: 2, Kind: KindAngle, Station: "Sub 2", Channel: "va"},
+	{Index: 5, Kind: KindAnalog, Station: "11", Channel: "P", Class: Class3},
+}
+
+func measurements(cfg *synchrophasor.ConfigFrame, soc uint32) *synchrophasor.Measurements {
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = soc
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return &m
+}
+
+// master is a minimal DNP3 master with link address 1 polling address 10
+type master struct {
+	t    *testing.T
+	conn net.Conn
+	seq  byte
+}
+
+func dial(t *testing.T, o *Outstation) *master {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = o.Serve(l) }()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &master{t: t, conn: conn}
+}
+
+// request sends an application fragment and returns the response
+func (m *master) request(function byte, objects ...byte) (control byte, iin uint16, body []byte) {
+	fragment := append([]byte{appFIR | appFIN | m.seq, function}, objects...)
+	var seq byte
+	m.write(appendSegments(nil, 10, 1, &seq, fragment))
+	m.seq = (m.seq + 1) & 0x0F
+	if function == fcConfirm {
+		return 0, 0, nil
+	}
+	return m.response()
+}
+
+func (m *master) write(b []byte) {
+	// Frames from the master carry the direction bit
+	b[3] |= ctrlDir
+	binary.LittleEndian.PutUint16(b[8:], crc(b[:8]))
+	_, err := m.conn.Write(b)
+	require.NoError(m.t, err)
+}
+
+func (m *master) response() (byte, uint16, []byte) {
+	var fragment []byte
+	for {
+		f := m.frame()
+		require.Equal(m.t, byte(ctrlPrm|linkUnconfirmedData), f.ctrl)
+		fragment = append(fragment, f.data[1:]...)
+		if f.data[0]&transportFIN != 0 {
+			break
+		}
+	}
+	require.Equal(m.t, byte(fcResponse), fragment[1])
+	return fragment[0], binary.LittleEndian.Uint16(fragment[2:]), fragment[4:]
+}
+
+func (m *master) frame() linkFrame {
+	require.NoError(m.t, m.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	f, err := readLinkFrame(m.conn)
+	require.NoError(m.t, err)
+	require.Equal(m.t, uint16(1), f.dest)
+	require.Equal(m.t, uint16(10), f.src)
+	return f
+}
+
+// value is a decoded analog input
+type value struct {
+	index uint16
+	flags byte
+	value float32
+}
+
+// parseStatic decodes g30v5 objects with start/stop ranges
+func parseStatic(t *testing.T, b []byte) []value {
+	var out []value
+	for len(b) > 0 {
+		require.Equal(t, []byte{groupAnalogInput, variationFloatFlag, qualifierRange16}, b[:3])
+		start, stop := binary.LittleEndian.Uint16(b[3:]), binary.LittleEndian.Uint16(b[5:])
+		b = b[7:]
+		for i := start; i <= stop; i++ {
+			out = append(out, value{i, b[0], math.Float32frombits(binary.LittleEndian.Uint32(b[1:]))})
+			b = b[5:]
+		}
+	}
+	return out
+}
+
+func TestOutstation(t *testing.T) {
+	cfg := testConfig()
+	o, err := New(cfg, Options{Points: testPoints, Address: 10, Decimation: 2})
+	require.NoError(t, err)
+	defer func() { _ = o.Close() }()
+	m := dial(t, o)
+
+	// Link status and reset
+	m.write(appendLinkFrame(nil, ctrlPrm|linkRequestLinkStatus, 10, 1, nil))
+	require.Equal(t, byte(linkStatus), m.frame().ctrl)
+	m.write(appendLinkFrame(nil, ctrlPrm|linkResetLinkStates, 10, 1, nil))
+	require.Equal(t, byte(linkAck), m.frame().ctrl)
+
+	// Before any measurement the points report a restart
+	_, iin, body := m.request(fcRead, groupClassData, 1, 0x06)
+	require.Equal(t, uint16(iin1DeviceRestart), iin)
+	require.Equal(t, []value{{0, flagRestart, 0}, {1, flagRestart, 0}, {2, flagRestart, 0}, {5, flagRestart, 0}},
+		parseStatic(t, body))
+
+	_, iin, body = m.request(fcWrite, groupInternalIndications, 1, 0x00, 7, 7, 0)
+	require.Zero(t, iin)
+	require.Empty(t, body)
+
+	// Every second set updates the points, each with a class generates one
+	// event
+	require.NoError(t, o.Write(measurements(cfg, 1700000000)))
+	cfg.PMUStationList[0].Freq = 51
+	require.NoError(t, o.Write(measurements(cfg, 1700000001)))
+
+	_, iin, body = m.request(fcRead, groupAnalogInput, 0, 0x01, 1, 0, 2, 0)
+	require.Equal(t, uint16(0x02|0x04|0x08), iin)
+	static := parseStatic(t, body)
+	require.Len(t, static, 2)
+	require.Equal(t, byte(flagOnline), static[0].flags)
+	require.InDelta(t, 230, static[0].value, 1e-3)
+	require.InDelta(t, 30, static[1].value, 1e-3)
+
+	// Class 1 and 3 events, confirmed by the master
+	control, _, body := m.request(fcRead, groupClassData, 2, 0x06, groupClassData, 4, 0x06)
+	require.NotZero(t, control&appCON)
+	require.Equal(t, []byte{groupAnalogInputEvent, variationFloatTime, qualifierCountIndex16, 2, 0}, body[:5])
+	require.Equal(t, uint16(0), binary.LittleEndian.Uint16(body[5:]))
+	require.Equal(t, byte(flagOnline), body[7])
+	require.Equal(t, float32(50), math.Float32frombits(binary.LittleEndian.Uint32(body[8:])))
+	require.Equal(t, appendTime(nil, time.Unix(1700000000, 0)), body[12:18])
+	require.Equal(t, uint16(5), binary.LittleEndian.Uint16(body[18:]))
+
+	m.seq--
+	m.request(fcConfirm)
+	_, iin, body = m.request(fcRead, groupClassData, 2, 0x06, groupClassData, 4, 0x06)
+	require.Equal(t, uint16(0x04), iin)
+	require.Empty(t, body)
+
+	// Changes within the deadband generate no event, beyond it one. The
+	// unconfirmed class 2 event is sent again.
+	cfg.PMUStationList[0].Freq = 50.005
+	require.NoError(t, o.Write(measurements(cfg, 1700000002)))
+	require.NoError(t, o.Write(measurements(cfg, 1700000003)))
+	cfg.PMUStationList[0].PhasorValues[0] = cmplx.Rect(232, 30*math.Pi/180)
+	require.NoError(t, o.Write(measurements(cfg, 1700000004)))
+	control, _, body = m.request(fcRead, groupAnalogInputEvent, 0, 0x06)
+	require.NotZero(t, control&appCON)
+	require.Equal(t, byte(2), body[3])
+	require.Equal(t, uint16(1), binary.LittleEndian.Uint16(body[5:]))
+
+	// Unsupported functions and objects
+	_, iin, _ = m.request(13)
+	require.Equal(t, uint16(iin2NoFuncCodeSupport)<<8, iin&0xFF00)
+	_, iin, _ = m.request(fcRead, 1, 2, 0x06)
+	require.Equal(t, uint16(iin2ObjectUnknown)<<8, iin&0xFF00)
+
+	require.ErrorIs(t, o.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+}
+
+func TestOutstationEvents(t *testing.T) {
+	cfg := testConfig()
+	o, err := New(cfg, Options{Points: testPoints[:1], EventBuffer: 3, MaxFragment: 4 + 5 + 2*eventSize})
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		cfg.PMUStationList[0].Freq = 50 + float32(i)
+		require.NoError(t, o.Write(measurements(cfg, uint32(1700000000+i))))
+	}
+	require.Len(t, o.events, 3)
+	require.Equal(t, uint64(3), o.events[0].id)
+
+	// Responses are limited to the fragment size
+	b, ids := o.read(nil, &readRequest{classes: 1 << Class1})
+	require.Equal(t, []uint64{3, 4}, ids)
+	require.Len(t, b, 5+2*eventSize)
+	_, iin2 := o.iin()
+	require.Equal(t, byte(iin2EventBufferOverflow), iin2)
+
+	o.confirm(ids)
+	require.Len(t, o.events, 1)
+	require.Equal(t, uint64(5), o.events[0].id)
+	_, iin2 = o.iin()
+	require.Zero(t, iin2)
+
+	// Lost synchronization sets the reference error flag
+	cfg.PMUStationList[0].Stat = statSyncLost
+	require.NoError(t, o.Write(measurements(cfg, 1700000005)))
+	require.Equal(t, byte(flagOnline|flagReferenceErr), o.events[1].flags)
+
+	for _, points := range [][]Point{
+		{{Station: "Sub 3"}},
+		{{Kind: KindMagnitude, Channel: "VB"}},
+		{{Kind: KindAnalog, Channel: "VA"}},
+		{{Index: 1}, {Index: 1, Kind: KindROCOF}},
+		{{Class: 4}},
+		{{Kind: 9}},
+	} {
+		_, err := New(cfg, Options{Points: points})
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+	_, err = New(cfg, Options{Address: 0xFFFF})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Points: testPoints, MaxFragment: 20})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
+
+func TestLink(t *testing.T) {
+	// Reset link states request from master 1024 to outstation 1
+	header := []byte{0x05, 0x64, 0x05, 0xC0, 0x01, 0x00, 0x00, 0x04}
+	require.Equal(t, uint16(0x21E9), crc(header))
+
+	// Long fragments are split into segments
+	data := make([]byte, 600)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	var seq byte
+	b := appendSegments(nil, 1, 10, &seq, data)
+	require.Equal(t, byte(3), seq)
+
+	var out []byte
+	for len(b) > 0 {
+		n := 10 + int(b[2]) - 5 + 2*((int(b[2])-5+15)/16)
+		f, err := readLinkFrame(bytes.NewReader(b[:n]))
+		require.NoError(t, err)
+		out = append(out, f.data[1:]...)
+		b = b[n:]
+	}
+	require.Equal(t, data, out)
+
+	bad := appendLinkFrame(nil, 0, 1, 2, []byte{1, 2, 3})
+	bad[10]++
+	_, err := readLinkFrame(bytes.NewReader(bad))
+	require.ErrorIs(t, err, ErrProtocol)
+}
@@ -0,0 +1,147 @@
+package dnp3
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrProtocol is returned for malformed frames
+var ErrProtocol = errors.New("dnp3 protocol error")
+
+// Link layer constants
+const (
+	startByte0 = 0x05
+	startByte1 = 0x64
+	// maxLinkData is the user data of a link frame
+	maxLinkData = 250
+	// ctrlDir is set on frames from the master, ctrlPrm on primary frames
+	ctrlDir = 0x80
+	ctrlPrm = 0x40
+)
+
+// Link layer function codes
+const (
+	linkResetLinkStates   = 0
+	linkConfirmedData     = 3
+	linkUnconfirmedData   = 4
+	linkRequestLinkStatus = 9
+	linkAck               = 0
+	linkStatus            = 11
+)
+
+// Transport header bits
+const (
+	transportFIN = 0x80
+	transportFIR = 0x40
+)
+
+// crcTable is the DNP3 CRC-16 table, polynomial 0x3D65 reflected
+var crcTable = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA6BC
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// crc returns the DNP3 CRC of b
+func crc(b []byte) uint16 {
+	var c uint16
+	for _, v := range b {
+		c = c>>8 ^ crcTable[byte(c)^v]
+	}
+	return ^c
+}
+
+// linkFrame is a received link layer frame
+type linkFrame struct {
+	ctrl byte
+	dest uint16
+	src  uint16
+	data []byte
+}
+
+// readLinkFrame reads one link frame and verifies its CRCs
+func readLinkFrame(r io.Reader) (linkFrame, error) {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return linkFrame{}, err
+	}
+	if header[0] != startByte0 || header[1] != startByte1 || header[2] < 5 {
+		return linkFrame{}, fmt.Errorf("%w: invalid link header", ErrProtocol)
+	}
+	if crc(header[:8]) != binary.LittleEndian.Uint16(header[8:]) {
+		return linkFrame{}, fmt.Errorf("%w: link header CRC mismatch", ErrProtocol)
+	}
+
+	f := linkFrame{
+		ctrl: header[3],
+		dest: binary.LittleEndian.Uint16(header[4:]),
+		src:  binary.LittleEndian.Uint16(header[6:]),
+	}
+	// User data follows in blocks of 16 bytes, each with a CRC
+	n := int(header[2]) - 5
+	block := make([]byte, 18)
+	for n > 0 {
+		size := min(n, 16)
+		if _, err := io.ReadFull(r, block[:size+2]); err != nil {
+			return linkFrame{}, err
+		}
+		if crc(block[:size]) != binary.LittleEndian.Uint16(block[size:]) {
+			return linkFrame{}, fmt.Errorf("%w: data block CRC mismatch", ErrProtocol)
+		}
+		f.data = append(f.data, block[:size]...)
+		n -= size
+	}
+	return f, nil
+}
+
+// appendLinkFrame appends a link frame with the user data
+func appendLinkFrame(b []byte, ctrl byte, dest, src uint16, data []byte) []byte {
+	start := len(b)
+	b = append(b, startByte0, startByte1, byte(5+len(data)), ctrl)
+	b = binary.LittleEndian.AppendUint16(b, dest)
+	b = binary.LittleEndian.AppendUint16(b, src)
+	b = binary.LittleEndian.AppendUint16(b, crc(b[start:]))
+	for len(data) > 0 {
+		size := min(len(data), 16)
+		b = append(b, data[:size]...)
+		b = binary.LittleEndian.AppendUint16(b, crc(data[:size]))
+		data = data[size:]
+	}
+	return b
+}
+
+// appendSegments appends an application fragment as unconfirmed user data
+// frames of transport segments
+func appendSegments(b []byte, dest, src uint16, seq *byte, fragment []byte) []byte {
+	segment := make([]byte, 0, maxLinkData)
+	first := true
+	for {
+		size := min(len(fragment), maxLinkData-1)
+		header := *seq & 0x3F
+		if first {
+			header |= transportFIR
+		}
+		if size == len(fragment) {
+			header |= transportFIN
+		}
+		*seq++
+		segment = append(append(segment[:0], header), fragment[:size]...)
+		b = appendLinkFrame(b, ctrlPrm|linkUnconfirmedData, dest, src, segment)
+		fragment = fragment[size:]
+		first = false
+		if len(fragment) == 0 {
+			return b
+		}
+	}
+}
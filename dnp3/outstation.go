@@ -0,0 +1,289 @@
+// Package dnp3 serves derived synchrophasor values, such as decimated phasor
+// magnitudes, angles and frequency, as DNP3 analog inputs with event classes
+// for RTU and SCADA masters without PMU support
+package dnp3
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// DefaultPort is the TCP port assigned to DNP3
+const DefaultPort = 20000
+
+// Options configures an Outstation
+type Options struct {
+	// Points maps derived values to analog input indexes
+	Points []Point
+	// Address is the link layer address of the outstation
+	Address uint16
+	// Decimation updates the points from every n-th measurement set only,
+	// defaults to 1
+	Decimation int
+	// EventBuffer is the number of buffered events, defaults to 1000. The
+	// oldest events are dropped on overflow.
+	EventBuffer int
+	// MaxFragment is the largest response fragment in bytes, defaults to 2048
+	MaxFragment int
+}
+
+// Outstation is a DNP3 outstation over TCP. Every Decimation-th measurement
+// set passed to Write updates the analog inputs, changes beyond the deadband
+// of points with a class generate events. Masters poll the static values
+// (g30v5, class 0) and the events (g32v7, classes 1 to 3), events are
+// removed when the master confirms the response. Data errors in STAT or
+// missing values clear the online flag, lost synchronization sets the
+// reference error flag. Unsolicited responses are not supported.
+type Outstation struct {
+	opts      Options
+	mu        sync.Mutex
+	stations  int
+	points    []point
+	events    []event
+	eventID   uint64
+	overflow  bool
+	restart   bool
+	sets      int
+	listeners map[net.Listener]struct{}
+	sessions  map[*session]struct{}
+	closed    bool
+}
+
+// New creates an outstation for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Outstation, error) {
+	if opts.Decimation <= 0 {
+		opts.Decimation = 1
+	}
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = 1000
+	}
+	if opts.MaxFragment <= 0 {
+		opts.MaxFragment = 2048
+	}
+	if opts.Address > 0xFFEF {
+		return nil, fmt.Errorf("%w: reserved address %d", synchrophasor.ErrInvalidParameter, opts.Address)
+	}
+
+	points, err := resolvePoints(cfg, opts.Points)
+	if err != nil {
+		return nil, err
+	}
+	// The static values are returned in a single fragment
+	if size := 4 + staticSize(points); size > opts.MaxFragment {
+		return nil, fmt.Errorf("%w: static values of %d bytes exceed the fragment size %d",
+			synchrophasor.ErrInvalidParameter, size, opts.MaxFragment)
+	}
+	return &Outstation{
+		opts:      opts,
+		stations:  len(cfg.PMUStationList),
+		points:    points,
+		restart:   true,
+		listeners: make(map[net.Listener]struct{}),
+		sessions:  make(map[*session]struct{}),
+	}, nil
+}
+
+// SetConfig maps the points to a new configuration. The current values
+// are kept until the next Write.
+func (o *Outstation) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	points, err := resolvePoints(cfg, o.opts.Points)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Both are sorted by index
+	for i := range points {
+		old := &o.points[i]
+		points[i].value, points[i].flags, points[i].reported = old.value, old.flags, old.reported
+	}
+	o.stations, o.points = len(cfg.PMUStationList), points
+	return nil
+}
+
+// Write updates the analog inputs from every Decimation-th measurement set
+func (o *Outstation) Write(m *synchrophasor.Measurements) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(m.Stations) != o.stations {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), o.stations)
+	}
+	o.sets++
+	if (o.sets-1)%o.opts.Decimation != 0 {
+		return nil
+	}
+
+	t := time.Unix(0, m.UnixNano())
+	for i := range o.points {
+		p := &o.points[i]
+		if !p.update(m) || p.Class == ClassNone {
+			continue
+		}
+		o.eventID++
+		o.events = append(o.events, event{
+			id: o.eventID, index: p.Index, class: p.Class, value: p.value, flags: p.flags, time: t,
+		})
+	}
+	if n := len(o.events) - o.opts.EventBuffer; n > 0 {
+		o.events = append(o.events[:0], o.events[n:]...)
+		o.overflow = true
+	}
+	return nil
+}
+
+// readRequest selects the data of a READ request
+type readRequest struct {
+	// static holds the requested index ranges of static values
+	static [][2]uint16
+	// classes is the mask of requested event classes, bit n for class n
+	classes uint8
+}
+
+// read appends the objects of a READ response to b and returns the IDs of
+// the events included
+func (o *Outstation) read(b []byte, req *readRequest) ([]byte, []uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, r := range req.static {
+		b = appendStatic(b, o.points, r[0], r[1])
+	}
+
+	var selected []event
+	var ids []uint64
+	room := o.opts.MaxFragment - len(b) - 5
+	for _, e := range o.events {
+		if req.classes&(1<<e.class) == 0 {
+			continue
+		}
+		if room -= eventSize; room < 0 {
+			break
+		}
+		selected = append(selected, e)
+		ids = append(ids, e.id)
+	}
+	return appendEvents(b, selected), ids
+}
+
+// confirm removes the confirmed events
+func (o *Outstation) confirm(ids []uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	events := o.events[:0]
+	for _, e := range o.events {
+		if len(ids) > 0 && e.id == ids[0] {
+			ids = ids[1:]
+			continue
+		}
+		events = append(events, e)
+	}
+	clear(o.events[len(events):])
+	o.events = events
+	o.overflow = false
+}
+
+// iin returns the internal indications
+func (o *Outstation) iin() (byte, byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var iin1, iin2 byte
+	for _, e := range o.events {
+		iin1 |= 1 << e.class
+	}
+	if o.restart {
+		iin1 |= iin1DeviceRestart
+	}
+	if o.overflow {
+		iin2 |= iin2EventBufferOverflow
+	}
+	return iin1, iin2
+}
+
+// ListenAndServe listens on addr, ":20000" when empty, and calls Serve
+func (o *Outstation) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return o.Serve(l)
+}
+
+// Serve accepts master connections on l until the outstation is closed
+func (o *Outstation) Serve(l net.Listener) error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		_ = l.Close()
+		return net.ErrClosed
+	}
+	o.listeners[l] = struct{}{}
+	o.mu.Unlock()
+
+	defer func() {
+		o.mu.Lock()
+		delete(o.listeners, l)
+		o.mu.Unlock()
+		_ = l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			o.mu.Lock()
+			closed := o.closed
+			o.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s := &session{o: o, conn: conn}
+		o.mu.Lock()
+		if o.closed {
+			o.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		o.sessions[s] = struct{}{}
+		o.mu.Unlock()
+
+		go func() {
+			_ = s.run()
+			_ = conn.Close()
+			o.mu.Lock()
+			delete(o.sessions, s)
+			o.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops all listeners and closes all connections
+func (o *Outstation) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+	var errs []error
+	for l := range o.listeners {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	for s := range o.sessions {
+		_ = s.conn.Close()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,274 @@
+package dnp3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Kind selects the value an analog input is derived from
+type Kind uint8
+
+// Analog input kinds
+const (
+	// KindFrequency is the station frequency in Hz
+	KindFrequency Kind = iota
+	// KindROCOF is the rate of change of frequency in Hz/s
+	KindROCOF
+	// KindMagnitude is the magnitude of a phasor
+	KindMagnitude
+	// KindAngle is the angle of a phasor in degrees
+	KindAngle
+	// KindAnalog is an analog value
+	KindAnalog
+)
+
+// Class is the event class of an analog input, ClassNone for static only
+type Class uint8
+
+// Event classes
+const (
+	ClassNone Class = iota
+	Class1
+	Class2
+	Class3
+)
+
+// STAT bits of a C37.118 station mapped to the analog input flags
+const (
+	statSyncLost = 0x2000
+)
+
+// Analog input flags
+const (
+	flagOnline       = 0x01
+	flagRestart      = 0x02
+	flagReferenceErr = 0x40
+)
+
+// Point maps a derived value to an analog input index
+type Point struct {
+	Index uint16
+	Kind  Kind
+	// Station is the station name or ID code, the first station when empty
+	Station string
+	// Channel is the phasor or analog channel name
+	Channel string
+	// Class assigns the events of the point
+	Class Class
+	// Deadband is the absolute change that generates an event, 0 generates
+	// one for every change
+	Deadband float64
+}
+
+// point is a Point resolved against the configuration
+type point struct {
+	Point
+	station, channel int
+
+	value    float64
+	flags    byte
+	reported float64
+}
+
+// event is a change of an analog input
+type event struct {
+	id    uint64
+	index uint16
+	class Class
+	value float64
+	flags byte
+	time  time.Time
+}
+
+// resolvePoints maps the points to station and channel indexes, sorted by
+// index
+func resolvePoints(cfg *synchrophasor.ConfigFrame, points []Point) ([]point, error) {
+	out := make([]point, len(points))
+	for i, pt := range points {
+		if pt.Class > Class3 {
+			return nil, fmt.Errorf("%w: point %d: invalid class %d", synchrophasor.ErrInvalidParameter, pt.Index, pt.Class)
+		}
+
+		p := point{Point: pt, flags: flagRestart}
+		var err error
+		if p.station, err = findStation(cfg, pt.Station); err != nil {
+			return nil, fmt.Errorf("point %d: %w", pt.Index, err)
+		}
+		pmu := cfg.PMUStationList[p.station]
+		switch pt.Kind {
+		case KindFrequency, KindROCOF:
+		case KindMagnitude, KindAngle:
+			p.channel, err = findChannel(pmu.CHNAMPhasor, "phasor", pt.Channel)
+		case KindAnalog:
+			p.channel, err = findChannel(pmu.CHNAMAnalog, "analog", pt.Channel)
+		default:
+			err = fmt.Errorf("%w: unknown kind %d", synchrophasor.ErrInvalidParameter, pt.Kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %w", pt.Index, err)
+		}
+		out[i] = p
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Index < out[j].Index })
+	for i := 1; i < len(out); i++ {
+		if out[i].Index == out[i-1].Index {
+			return nil, fmt.Errorf("%w: duplicate point %d", synchrophasor.ErrInvalidParameter, out[i].Index)
+		}
+	}
+	return out, nil
+}
+
+// findStation returns the index of the station with the given name or ID code
+func findStation(cfg *synchrophasor.ConfigFrame, name string) (int, error) {
+	if len(cfg.PMUStationList) == 0 {
+		return 0, fmt.Errorf("%w: configuration has no stations", synchrophasor.ErrInvalidParameter)
+	}
+	if name == "" {
+		return 0, nil
+	}
+	for i, pmu := range cfg.PMUStationList {
+		if strings.TrimSpace(pmu.STN) == name || strconv.Itoa(int(pmu.IDCode)) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no station %q", synchrophasor.ErrInvalidParameter, name)
+}
+
+// findChannel returns the index of a channel name
+func findChannel(names []string, kind, name string) (int, error) {
+	for i, n := range names {
+		if strings.EqualFold(strings.TrimSpace(n), name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no %s channel %q", synchrophasor.ErrInvalidParameter, kind, name)
+}
+
+// update derives the point value from m and reports whether it generates an
+// event
+func (p *point) update(m *synchrophasor.Measurements) bool {
+	st := &m.Stations[p.station]
+	v := math.NaN()
+	switch p.Kind {
+	case KindFrequency:
+		v = float64(st.Frequency)
+	case KindROCOF:
+		v = float64(st.ROCOF)
+	case KindMagnitude:
+		if p.channel < len(st.Phasors) {
+			v = cmplx.Abs(st.Phasors[p.channel])
+		}
+	case KindAngle:
+		if p.channel < len(st.Phasors) {
+			v = cmplx.Phase(st.Phasors[p.channel]) * 180 / math.Pi
+		}
+	case KindAnalog:
+		if p.channel < len(st.Analog) {
+			v = float64(st.Analog[p.channel])
+		}
+	}
+
+	flags := byte(flagOnline)
+	switch {
+	case st.Stat&synchrophasor.StatDataError != 0 || math.IsNaN(v) || math.IsInf(v, 0):
+		// Offline points keep their last value
+		flags = 0
+		v = p.value
+	case st.Stat&statSyncLost != 0:
+		flags |= flagReferenceErr
+	}
+
+	changed := flags != p.flags
+	if !changed {
+		if p.Deadband <= 0 {
+			changed = v != p.reported
+		} else {
+			changed = math.Abs(v-p.reported) >= p.Deadband
+		}
+	}
+	p.value, p.flags = v, flags
+	if changed {
+		p.reported = v
+	}
+	return changed
+}
+
+// Object groups, variations and qualifiers
+const (
+	groupClassData           = 60
+	groupInternalIndications = 80
+	groupAnalogInput         = 30
+	groupAnalogInputEvent    = 32
+	variationFloatFlag       = 5 // g30v5 single-precision with flag
+	variationFloatTime       = 7 // g32v7 single-precision with time
+	qualifierRange16         = 0x01
+	qualifierCountIndex16    = 0x28
+)
+
+// staticSize returns the size of the static objects of points
+func staticSize(points []point) int {
+	size := 0
+	for i := range points {
+		if i == 0 || points[i].Index != points[i-1].Index+1 {
+			size += 7
+		}
+		size += 5
+	}
+	return size
+}
+
+// appendStatic appends g30v5 objects of the points with an index within
+// [start, stop], one range header per contiguous run
+func appendStatic(b []byte, points []point, start, stop uint16) []byte {
+	var countAt int
+	for i := range points {
+		p := &points[i]
+		if p.Index < start || p.Index > stop {
+			continue
+		}
+		if countAt == 0 || p.Index != binary.LittleEndian.Uint16(b[countAt:])+1 {
+			b = append(b, groupAnalogInput, variationFloatFlag, qualifierRange16)
+			b = binary.LittleEndian.AppendUint16(b, p.Index)
+			countAt = len(b)
+			b = binary.LittleEndian.AppendUint16(b, p.Index)
+		}
+		binary.LittleEndian.PutUint16(b[countAt:], p.Index)
+		b = append(b, p.flags)
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(p.value)))
+	}
+	return b
+}
+
+// eventSize is the size of one g32v7 object with its index prefix
+const eventSize = 2 + 1 + 4 + 6
+
+// appendEvents appends the events as one g32v7 header
+func appendEvents(b []byte, events []event) []byte {
+	if len(events) == 0 {
+		return b
+	}
+	b = append(b, groupAnalogInputEvent, variationFloatTime, qualifierCountIndex16)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(events)))
+	for _, e := range events {
+		b = binary.LittleEndian.AppendUint16(b, e.index)
+		b = append(b, e.flags)
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(e.value)))
+		b = appendTime(b, e.time)
+	}
+	return b
+}
+
+// appendTime appends a DNP3 absolute time, milliseconds since the epoch
+func appendTime(b []byte, t time.Time) []byte {
+	ms := uint64(t.UnixMilli())
+	return append(b, byte(ms), byte(ms>>8), byte(ms>>16), byte(ms>>24), byte(ms>>32), byte(ms>>40))
+}
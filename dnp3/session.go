@@ -0,0 +1,229 @@
+package dnp3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Application layer control bits
+const (
+	appFIR = 0x80
+	appFIN = 0x40
+	appCON = 0x20
+	appUNS = 0x10
+)
+
+// Application layer function codes
+const (
+	fcConfirm            = 0
+	fcRead               = 1
+	fcWrite              = 2
+	fcDisableUnsolicited = 21
+	fcResponse           = 0x81
+)
+
+// maxRequestFragmentLen bounds the reassembled requests
+const maxRequestFragmentLen = 4096
+
+// Internal indication bits
+const (
+	iin1DeviceRestart       = 0x80
+	iin2NoFuncCodeSupport   = 0x01
+	iin2ObjectUnknown       = 0x02
+	iin2ParameterError      = 0x04
+	iin2EventBufferOverflow = 0x08
+	// iinIndexDeviceRestart is the index of IIN1.7 in g80v1
+	iinIndexDeviceRestart = 7
+)
+
+// session is a master connection
+type session struct {
+	o    *Outstation
+	conn net.Conn
+
+	// fragment reassembles the transport segments of a request
+	fragment []byte
+	// segmentSeq is the transport sequence of the next segment sent
+	segmentSeq byte
+	// confirmSeq and confirmIDs identify the response awaiting a confirm
+	confirmSeq byte
+	confirmIDs []uint64
+	buf        []byte
+}
+
+// run serves the connection until it fails or is closed
+func (s *session) run() error {
+	for {
+		f, err := readLinkFrame(s.conn)
+		if err != nil {
+			return err
+		}
+		// Frames to other outstations and secondary frames are ignored,
+		// broadcasts are not answered
+		if f.dest != s.o.opts.Address || f.ctrl&ctrlPrm == 0 {
+			continue
+		}
+
+		switch f.ctrl & 0x0F {
+		case linkResetLinkStates:
+			err = s.write(appendLinkFrame(s.buf[:0], linkAck, f.src, f.dest, nil))
+		case linkRequestLinkStatus:
+			err = s.write(appendLinkFrame(s.buf[:0], linkStatus, f.src, f.dest, nil))
+		case linkConfirmedData:
+			if err = s.write(appendLinkFrame(s.buf[:0], linkAck, f.src, f.dest, nil)); err == nil {
+				err = s.segment(f)
+			}
+		case linkUnconfirmedData:
+			err = s.segment(f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write sends frames to the master
+func (s *session) write(b []byte) error {
+	s.buf = b
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// segment adds a transport segment to the request and answers complete
+// requests
+func (s *session) segment(f linkFrame) error {
+	if len(f.data) == 0 {
+		return nil
+	}
+	header := f.data[0]
+	if header&transportFIR != 0 {
+		s.fragment = s.fragment[:0]
+	}
+	s.fragment = append(s.fragment, f.data[1:]...)
+	if len(s.fragment) > maxRequestFragmentLen {
+		return fmt.Errorf("%w: request fragment exceeds %d bytes", ErrProtocol, maxRequestFragmentLen)
+	}
+	if header&transportFIN == 0 {
+		return nil
+	}
+
+	response := s.request(s.fragment)
+	if response == nil {
+		return nil
+	}
+	return s.write(appendSegments(s.buf[:0], f.src, f.dest, &s.segmentSeq, response))
+}
+
+// request answers an application fragment, nil when no response is due
+func (s *session) request(fragment []byte) []byte {
+	if len(fragment) < 2 {
+		return nil
+	}
+	control, function := fragment[0], fragment[1]
+	seq := control & 0x0F
+	objects := fragment[2:]
+
+	if function == fcConfirm {
+		if control&appUNS == 0 && seq == s.confirmSeq && s.confirmIDs != nil {
+			s.o.confirm(s.confirmIDs)
+			s.confirmIDs = nil
+		}
+		return nil
+	}
+
+	// Header with the internal indications filled in below
+	response := []byte{appFIR | appFIN | seq, fcResponse, 0, 0}
+	var iin2 byte
+	switch function {
+	case fcRead:
+		var req readRequest
+		iin2 = parseRead(objects, &req)
+		var ids []uint64
+		response, ids = s.o.read(response, &req)
+		if len(ids) > 0 {
+			response[0] |= appCON
+			s.confirmSeq, s.confirmIDs = seq, ids
+		}
+	case fcWrite:
+		iin2 = s.clearRestart(objects)
+	case fcDisableUnsolicited:
+		// Unsolicited responses are never sent
+	default:
+		iin2 = iin2NoFuncCodeSupport
+	}
+
+	iin1, overflow := s.o.iin()
+	response[2], response[3] = iin1, iin2|overflow
+	return response
+}
+
+// parseRead reads the object headers of a READ request and returns the IIN2
+// bits of unsupported ones
+func parseRead(b []byte, req *readRequest) byte {
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return iin2ParameterError
+		}
+		group, variation, qualifier := b[0], b[1], b[2]
+		b = b[3:]
+
+		// Ranges select static values, counts are ignored
+		start, stop := uint16(0), uint16(0xFFFF)
+		switch qualifier {
+		case 0x06:
+		case 0x00:
+			if len(b) < 2 {
+				return iin2ParameterError
+			}
+			start, stop, b = uint16(b[0]), uint16(b[1]), b[2:]
+		case 0x01:
+			if len(b) < 4 {
+				return iin2ParameterError
+			}
+			start, stop, b = binary.LittleEndian.Uint16(b), binary.LittleEndian.Uint16(b[2:]), b[4:]
+		case 0x07:
+			if len(b) < 1 {
+				return iin2ParameterError
+			}
+			b = b[1:]
+		case 0x08:
+			if len(b) < 2 {
+				return iin2ParameterError
+			}
+			b = b[2:]
+		default:
+			return iin2ParameterError
+		}
+
+		switch {
+		case group == groupClassData && variation == 1:
+			req.static = append(req.static, [2]uint16{0, 0xFFFF})
+		case group == groupClassData && variation >= 2 && variation <= 4:
+			req.classes |= 1 << (variation - 1)
+		case group == groupAnalogInput && (variation == 0 || variation == variationFloatFlag):
+			req.static = append(req.static, [2]uint16{start, stop})
+		case group == groupAnalogInputEvent && (variation == 0 || variation == variationFloatTime):
+			req.classes |= 1<<Class1 | 1<<Class2 | 1<<Class3
+		default:
+			return iin2ObjectUnknown
+		}
+	}
+	return 0
+}
+
+// clearRestart handles a WRITE request clearing the device restart indication
+func (s *session) clearRestart(b []byte) byte {
+	// g80v1, start/stop 8 bit qualifier, index 7, one packed bit
+	if len(b) != 6 || b[0] != groupInternalIndications || b[1] != 1 || b[2] != 0x00 ||
+		b[3] != iinIndexDeviceRestart || b[4] != iinIndexDeviceRestart {
+		return iin2ObjectUnknown
+	}
+	if b[5]&0x01 != 0 {
+		return iin2ParameterError
+	}
+	s.o.mu.Lock()
+	s.o.restart = false
+	s.o.mu.Unlock()
+	return 0
+}
@@ -0,0 +1,230 @@
+// Package downsample derives streams at lower reporting rates from aligned
+// measurement sets, e.g. 60 to 10 to 1 frames per second, by selecting or
+// averaging the sets around every output timestamp, and serves them as
+// additional C37.118 streams
+package downsample
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Method selects how the sets of an output period are combined
+type Method uint8
+
+const (
+	// MethodSelect passes the set closest to the output timestamp
+	MethodSelect Method = iota
+	// MethodAverage averages the valid sets of the period centred on the
+	// output timestamp. Phasors are averaged by magnitude and unwrapped
+	// angle, so rotating phasors at off-nominal frequency keep their
+	// magnitude.
+	MethodAverage
+)
+
+// Options configures a Downsampler
+type Options struct {
+	// Rate is the output rate in frames per second, lower than the input rate
+	Rate int
+	// Method defaults to MethodSelect
+	Method Method
+}
+
+// Downsampler reduces the rate of a measurement stream. Output timestamps are
+// aligned to the second, the output period centred on each of them. A
+// Downsampler is not safe for concurrent use.
+type Downsampler struct {
+	opts Options
+	cfg  *synchrophasor.ConfigFrame
+	// slot is the output period of the pending sets, -1 if none are pending,
+	// and flushed the latest output period passed on
+	slot, flushed int64
+	// sets holds the pending sets, closest the index of the one closest to
+	// the slot time
+	sets    []synchrophasor.Measurements
+	n       int
+	closest int
+	out     synchrophasor.Measurements
+}
+
+// New creates a downsampler for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Downsampler, error) {
+	d := &Downsampler{opts: opts}
+	if err := d.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetConfig replaces the configuration, discarding the pending sets. The
+// caller should pass any output still pending to Flush first.
+func (d *Downsampler) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	if d.opts.Rate <= 0 || int(cfg.DataRate) <= d.opts.Rate {
+		return fmt.Errorf("%w: output rate %d not below the input rate %d",
+			synchrophasor.ErrInvalidParameter, d.opts.Rate, cfg.DataRate)
+	}
+	d.cfg = Config(cfg, d.opts.Rate)
+	d.slot, d.flushed, d.n = -1, -1, 0
+	return nil
+}
+
+// Config returns the configuration of the output stream
+func (d *Downsampler) Config() *synchrophasor.ConfigFrame {
+	return d.cfg
+}
+
+// Config returns a copy of cfg at the given data rate, with station values of
+// its own
+func Config(cfg *synchrophasor.ConfigFrame, rate int) *synchrophasor.ConfigFrame {
+	out := *cfg
+	out.DataRate = int16(rate)
+	out.PMUStationList = make([]*synchrophasor.PMUStation, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		p := *pmu
+		p.PhasorValues = make([]complex128, len(pmu.PhasorValues))
+		p.AnalogValues = make([]float32, len(pmu.AnalogValues))
+		p.DigitalValues = make([][]bool, len(pmu.DigitalValues))
+		for j, word := range pmu.DigitalValues {
+			p.DigitalValues[j] = make([]bool, len(word))
+		}
+		out.PMUStationList[i] = &p
+	}
+	return &out
+}
+
+// slotOf returns the output period of time t in nanoseconds and its
+// timestamp
+func (d *Downsampler) slotOf(t int64) (int64, int64) {
+	rate := int64(d.opts.Rate)
+	sec, ns := t/int64(time.Second), t%int64(time.Second)
+	k := (ns*rate + int64(time.Second)/2) / int64(time.Second)
+	if k == rate {
+		sec, k = sec+1, 0
+	}
+	return sec*rate + k, sec*int64(time.Second) + k*int64(time.Second)/rate
+}
+
+// Write adds a measurement set, calling fn with the output of the previous
+// period once m starts a new one. The set passed to fn is only valid during
+// the call.
+func (d *Downsampler) Write(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	if len(m.Stations) != len(d.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(d.cfg.PMUStationList))
+	}
+	for i, pmu := range d.cfg.PMUStationList {
+		if st := &m.Stations[i]; len(st.Phasors) != len(pmu.PhasorValues) || len(st.Analog) != len(pmu.AnalogValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+	t := m.UnixNano()
+	slot, at := d.slotOf(t)
+	if slot < d.slot || slot <= d.flushed {
+		return fmt.Errorf("%w: measurement time %v before the pending output",
+			synchrophasor.ErrInvalidParameter, time.Unix(0, t).UTC())
+	}
+	if d.slot >= 0 && slot != d.slot {
+		if err := d.Flush(fn); err != nil {
+			return err
+		}
+	}
+
+	d.slot = slot
+	if d.n == len(d.sets) {
+		d.sets = append(d.sets, synchrophasor.Measurements{})
+	}
+	m.CopyTo(&d.sets[d.n])
+	if d.n == 0 || abs(t-at) < abs(d.sets[d.closest].UnixNano()-at) {
+		d.closest = d.n
+	}
+	d.n++
+	return nil
+}
+
+// Flush calls fn with the output of the pending sets, if any
+func (d *Downsampler) Flush(fn func(m *synchrophasor.Measurements) error) error {
+	if d.slot < 0 {
+		return nil
+	}
+	rate := int64(d.opts.Rate)
+	sec, k := d.slot/rate, d.slot%rate
+	sets := d.sets[:d.n]
+	d.flushed, d.slot, d.n = d.slot, -1, 0
+
+	closest := &sets[d.closest]
+	closest.CopyTo(&d.out)
+	d.out.Time = float64(sec) + float64(k)/float64(rate)
+	if d.opts.Method == MethodAverage {
+		for i := range d.out.Stations {
+			average(&d.out.Stations[i], sets, i)
+		}
+	}
+	return fn(&d.out)
+}
+
+// average sets the values of station i of dst to the average of the valid
+// samples of the sets, and its STAT to the combined STAT of all of them
+func average(dst *synchrophasor.StationMeasurement, sets []synchrophasor.Measurements, i int) {
+	var stat uint16
+	ref := -1
+	for s := range sets {
+		st := &sets[s].Stations[i]
+		stat |= st.Stat
+		if ref < 0 && st.Stat&synchrophasor.StatDataError == 0 {
+			ref = s
+		}
+	}
+	dst.Stat = stat
+	if ref < 0 {
+		return
+	}
+
+	// Angles are averaged relative to the first valid sample, unwrapped
+	phases := make([]float64, len(dst.Phasors))
+	for j, p := range sets[ref].Stations[i].Phasors {
+		phases[j] = cmplx.Phase(p)
+	}
+	var freq, rocof float64
+	mags := make([]float64, len(dst.Phasors))
+	angles := make([]float64, len(dst.Phasors))
+	analog := make([]float64, len(dst.Analog))
+	var n int
+	for s := range sets {
+		st := &sets[s].Stations[i]
+		if st.Stat&synchrophasor.StatDataError != 0 {
+			continue
+		}
+		n++
+		freq += float64(st.Frequency)
+		rocof += float64(st.ROCOF)
+		for j, p := range st.Phasors {
+			mags[j] += cmplx.Abs(p)
+			angles[j] += math.Remainder(cmplx.Phase(p)-phases[j], 2*math.Pi)
+		}
+		for j, v := range st.Analog {
+			analog[j] += float64(v)
+		}
+	}
+
+	count := float64(n)
+	dst.Frequency = float32(freq / count)
+	dst.ROCOF = float32(rocof / count)
+	for j := range dst.Phasors {
+		dst.Phasors[j] = cmplx.Rect(mags[j]/count, phases[j]+angles[j]/count)
+	}
+	for j := range dst.Analog {
+		dst.Analog[j] = float32(analog[j] / count)
+	}
+}
+
+// abs returns the absolute value of v
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
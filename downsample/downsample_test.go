@@ -0,0 +1,165 @@
+package downsample
+
+import (
+	"math"
+	"math/cmplx"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := testutil.NewConfig(50, 1, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	})
+	cfg.IDCode = 7
+	return cfg
+}
+
+// set returns the measurements of frame i at 50 frames per second with the
+// VA angle turning by 10 degrees per frame from 0 degrees and P = i
+func set(cfg *synchrophasor.ConfigFrame, i int, stat uint16) *synchrophasor.Measurements {
+	sub := cfg.PMUStationList[0]
+	sub.Stat = stat
+	sub.Freq = 50 + float32(i)/100
+	sub.PhasorValues[0] = cmplx.Rect(100, float64(10*i)*math.Pi/180)
+	sub.AnalogValues[0] = float32(i)
+	sub.DigitalValues[0][0] = i == 5
+	return testutil.Measurements(cfg, i)
+}
+
+// collect returns a callback appending copies of the sets passed to it
+func collect(out *[]synchrophasor.Measurements) func(*synchrophasor.Measurements) error {
+	return func(m *synchrophasor.Measurements) error {
+		var c synchrophasor.Measurements
+		m.CopyTo(&c)
+		*out = append(*out, c)
+		return nil
+	}
+}
+
+func angle(p complex128) float64 {
+	return cmplx.Phase(p) * 180 / math.Pi
+}
+
+func TestDownsample(t *testing.T) {
+	cfg := testConfig()
+	d, err := New(cfg, Options{Rate: 10, Method: MethodAverage})
+	require.NoError(t, err)
+	require.Equal(t, int16(10), d.Config().DataRate)
+	require.Equal(t, int16(50), cfg.DataRate)
+
+	var out []synchrophasor.Measurements
+	for i := 0; i < 50; i++ {
+		stat := uint16(0)
+		if i == 13 {
+			stat = 0xC000
+		}
+		require.NoError(t, d.Write(set(cfg, i, stat), collect(&out)))
+	}
+	require.Len(t, out, 10)
+	require.NoError(t, d.Flush(collect(&out)))
+	require.Len(t, out, 11)
+	require.InDelta(t, 1700000001, out[10].Time, 1e-6)
+	require.InDelta(t, 48.5, out[10].Stations[0].Analog[0], 1e-6)
+
+	// The first period holds frames 0 to 2, the others five frames centred
+	// on the output time
+	require.InDelta(t, 1700000000, out[0].Time, 1e-6)
+	require.InDelta(t, 1, out[0].Stations[0].Analog[0], 1e-6)
+	require.InDelta(t, 1700000000.2, out[2].Time, 1e-6)
+	require.InDelta(t, 10, out[2].Stations[0].Analog[0], 1e-6)
+	// Frames 3 to 7 turn from 30 to 70 degrees, frames 18 to 22 across 180
+	require.InDelta(t, 50, angle(out[1].Stations[0].Phasors[0]), 1e-9)
+	require.InDelta(t, 100, cmplx.Abs(out[1].Stations[0].Phasors[0]), 1e-9)
+	require.InDelta(t, -160, angle(out[4].Stations[0].Phasors[0]), 1e-9)
+	require.True(t, out[1].Stations[0].Digital[0][0])
+
+	// Invalid frame 13 is left out but flagged
+	require.InDelta(t, 15.5, out[3].Stations[0].Analog[0], 1e-6)
+	require.Equal(t, uint16(0xC000), out[3].Stations[0].Stat)
+
+	require.ErrorIs(t, d.Write(set(cfg, 10, 0), collect(&out)), synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Rate: 50})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
+
+func TestDownsampleSelect(t *testing.T) {
+	// 50 to 10 to 1 frames per second
+	cfg := testConfig()
+	tenth, err := New(cfg, Options{Rate: 10})
+	require.NoError(t, err)
+	second, err := New(tenth.Config(), Options{Rate: 1})
+	require.NoError(t, err)
+
+	var out []synchrophasor.Measurements
+	for i := 0; i < 150; i++ {
+		require.NoError(t, tenth.Write(set(cfg, i, 0), func(m *synchrophasor.Measurements) error {
+			return second.Write(m, collect(&out))
+		}))
+	}
+	require.Len(t, out, 3)
+	require.InDelta(t, 1700000001, out[1].Time, 1e-6)
+	require.InDelta(t, 50, out[1].Stations[0].Analog[0], 1e-6)
+}
+
+// commands notes the start command of the PDC
+type commands struct {
+	synchrophasor.MetricsRecorder
+	started atomic.Bool
+}
+
+func (c *commands) RecordCommand(cmdType string) {
+	if cmdType == "START" {
+		c.started.Store(true)
+	}
+}
+
+func (c *commands) RecordClientConnected()    {}
+func (c *commands) RecordClientDisconnected() {}
+func (c *commands) RecordBytesReceived(int)   {}
+func (c *commands) RecordConfigFrameSent(int) {}
+func (c *commands) RecordDataFrameSent(int)   {}
+
+func TestOutput(t *testing.T) {
+	cfg := testConfig()
+	d, err := New(cfg, Options{Rate: 10})
+	require.NoError(t, err)
+	pmu := synchrophasor.NewPMU()
+	cmds := &commands{}
+	pmu.SetMetrics(cmds)
+	out := NewOutput(pmu, d.Config())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	defer pmu.Stop()
+	pdc := synchrophasor.NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+	received, err := pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.Equal(t, int16(10), received.DataRate)
+	require.NoError(t, pdc.Start())
+
+	require.Eventually(t, cmds.started.Load, 5*time.Second, time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Write(set(cfg, i, 0), out.Write))
+	}
+	frame, err := pdc.ReadFrame()
+	require.NoError(t, err)
+	df := frame.(*synchrophasor.DataFrame)
+	require.Equal(t, uint16(7), df.IDCode)
+	require.Equal(t, uint32(0), df.FracSec)
+	require.InDelta(t, 50, df.AssociatedConfig.PMUStationList[0].Freq, 1e-5)
+}
@@ -0,0 +1,44 @@
+package downsample
+
+import (
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Output serves a derived stream as an additional C37.118 stream through its
+// own PMU server
+type Output struct {
+	pmu *synchrophasor.PMU
+	df  *synchrophasor.DataFrame
+	buf []byte
+}
+
+// NewOutput sets the PMU to publish only with the configuration of the
+// derived stream, typically Downsampler.Config, so it must be called before
+// the PMU is started
+func NewOutput(pmu *synchrophasor.PMU, cfg *synchrophasor.ConfigFrame) *Output {
+	pmu.SetPublishOnly(true)
+	pmu.SetConfig(cfg)
+	return &Output{pmu: pmu, df: synchrophasor.NewDataFrame(cfg)}
+}
+
+// SetConfig replaces the configuration of the derived stream
+func (o *Output) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	o.pmu.SetConfig(cfg)
+	o.df.Reset(cfg)
+}
+
+// Write publishes a set of the derived stream under the ID code of its
+// configuration. It matches the callback of Downsampler.Write.
+func (o *Output) Write(m *synchrophasor.Measurements) error {
+	if err := o.df.SetMeasurements(m); err != nil {
+		return err
+	}
+	o.df.IDCode = o.df.AssociatedConfig.IDCode
+
+	var err error
+	o.buf, err = o.df.AppendTo(o.buf[:0])
+	if err != nil {
+		return err
+	}
+	return o.pmu.Publish(o.buf)
+}
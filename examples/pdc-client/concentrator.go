@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor/concentrator"
+	"github.com/spf13/viper"
+)
+
+// endpoint is a PMU listed in the -pmus file
+type endpoint struct {
+	Address string `mapstructure:"address"`
+	IDCode  uint16 `mapstructure:"idcode"`
+	// Transport is "tcp", "udp" for commands and data over UDP or
+	// "udp_listen" to receive a spontaneous UDP stream on Address
+	Transport string `mapstructure:"transport"`
+}
+
+// endpointFile is the layout of the -pmus file
+type endpointFile struct {
+	PMUs []endpoint `mapstructure:"pmus"`
+	// Wait is how long a measurement set waits for late PMUs
+	Wait string `mapstructure:"wait"`
+}
+
+// loadEndpoints reads the PMUs and the alignment wait from a YAML file
+func loadEndpoints(path string) ([]concentrator.Endpoint, time.Duration, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetDefault("wait", "100ms")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, 0, err
+	}
+	var file endpointFile
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, 0, err
+	}
+
+	if len(file.PMUs) == 0 {
+		return nil, 0, fmt.Errorf("no pmus in %s", path)
+	}
+	wait, err := time.ParseDuration(file.Wait)
+	if err != nil || wait <= 0 {
+		return nil, 0, fmt.Errorf("invalid wait %q", file.Wait)
+	}
+	endpoints := make([]concentrator.Endpoint, len(file.PMUs))
+	for i, e := range file.PMUs {
+		endpoints[i] = concentrator.Endpoint{Address: e.Address, IDCode: e.IDCode, Transport: e.Transport}
+	}
+	return endpoints, wait, nil
+}
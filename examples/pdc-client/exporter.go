@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// exporter publishes the received measurements as Prometheus gauges, named
+// as by the remotewrite package and labeled by station and channel
+type exporter struct {
+	registry *prometheus.Registry
+	stations []exportedStation
+	latency  prometheus.Gauge
+	frames   prometheus.Counter
+	gaps     prometheus.Counter
+	missing  prometheus.Counter
+	errors   prometheus.Counter
+	stats    *linkStats
+	seen     linkStats
+}
+
+// exportedStation holds the gauges of one station, indexed as its channels
+type exportedStation struct {
+	frequency prometheus.Gauge
+	rocof     prometheus.Gauge
+	stat      prometheus.Gauge
+	magnitude []prometheus.Gauge
+	angle     []prometheus.Gauge
+	analog    []prometheus.Gauge
+	// digital is indexed by word*16+bit, nil for unnamed bits
+	digital []prometheus.Gauge
+}
+
+// newExporter creates the gauges of every channel of cfg and the link
+// statistics taken from stats
+func newExporter(cfg *synchrophasor.ConfigFrame, stats *linkStats) *exporter {
+	stationLabels := []string{"station", "idcode"}
+	channelLabels := []string{"station", "idcode", "channel"}
+	gauge := func(name, help string, labels []string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "synchrophasor_" + name, Help: help}, labels)
+	}
+	counter := func(name, help string) prometheus.Counter {
+		return prometheus.NewCounter(prometheus.CounterOpts{Name: "synchrophasor_pdc_" + name, Help: help})
+	}
+
+	frequency := gauge("frequency_hz", "Frequency of the station", stationLabels)
+	rocof := gauge("rocof_hz_per_second", "Rate of change of frequency of the station", stationLabels)
+	stat := gauge("stat", "STAT word of the station", stationLabels)
+	voltage := gauge("voltage_magnitude_volts", "Magnitude of a voltage phasor", channelLabels)
+	current := gauge("current_magnitude_amperes", "Magnitude of a current phasor", channelLabels)
+	angle := gauge("phase_angle_degrees", "Angle of a phasor", channelLabels)
+	analog := gauge("analog_value", "Value of an analog channel", channelLabels)
+	digital := gauge("digital_state", "State of a named digital channel, 0 or 1", channelLabels)
+
+	e := &exporter{
+		registry: prometheus.NewRegistry(),
+		latency: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "synchrophasor_pdc_latency_seconds",
+			Help: "Delay of the arrival of the last data frame after its timestamp",
+		}),
+		frames:  counter("frames_total", "Data frames received"),
+		gaps:    counter("gaps_total", "Interruptions of the frame sequence"),
+		missing: counter("missing_frames_total", "Data frames lost in the gaps"),
+		errors:  counter("errors_total", "Frames that could not be read"),
+		stats:   stats,
+	}
+	e.registry.MustRegister(frequency, rocof, stat, voltage, current, angle, analog, digital,
+		e.latency, e.frames, e.gaps, e.missing, e.errors)
+
+	for _, pmu := range cfg.PMUStationList {
+		name := strings.TrimSpace(pmu.STN)
+		id := strconv.Itoa(int(pmu.IDCode))
+		st := exportedStation{
+			frequency: frequency.WithLabelValues(name, id),
+			rocof:     rocof.WithLabelValues(name, id),
+			stat:      stat.WithLabelValues(name, id),
+		}
+		for j := range pmu.CHNAMPhasor {
+			channel := pmu.PhasorName(j)
+			if j < len(pmu.Phunit) && pmu.Phunit[j]>>24 == synchrophasor.PhunitCurrent {
+				st.magnitude = append(st.magnitude, current.WithLabelValues(name, id, channel))
+			} else {
+				st.magnitude = append(st.magnitude, voltage.WithLabelValues(name, id, channel))
+			}
+			st.angle = append(st.angle, angle.WithLabelValues(name, id, channel))
+		}
+		for j := range pmu.CHNAMAnalog {
+			st.analog = append(st.analog, analog.WithLabelValues(name, id, pmu.AnalogName(j)))
+		}
+		for j := range pmu.CHNAMDigital {
+			var g prometheus.Gauge
+			if channel := pmu.DigitalName(j); channel != "" {
+				g = digital.WithLabelValues(name, id, channel)
+			}
+			st.digital = append(st.digital, g)
+		}
+		e.stations = append(e.stations, st)
+	}
+	return e
+}
+
+// Handler returns the handler serving the metrics
+func (e *exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{})
+}
+
+// update sets the gauges to the measurements m and advances the counters to
+// the link statistics
+func (e *exporter) update(m *synchrophasor.Measurements) {
+	for i := range m.Stations {
+		if i >= len(e.stations) {
+			break
+		}
+		st, g := &m.Stations[i], &e.stations[i]
+		g.frequency.Set(float64(st.Frequency))
+		g.rocof.Set(float64(st.ROCOF))
+		g.stat.Set(float64(st.Stat))
+		for j, ph := range st.Phasors {
+			if j < len(g.magnitude) {
+				g.magnitude[j].Set(cmplx.Abs(ph))
+				g.angle[j].Set(cmplx.Phase(ph) * 180 / math.Pi)
+			}
+		}
+		for j, v := range st.Analog {
+			if j < len(g.analog) {
+				g.analog[j].Set(float64(v))
+			}
+		}
+		for w, word := range st.Digital {
+			for bit, v := range word {
+				if j := w*16 + bit; j < len(g.digital) && g.digital[j] != nil {
+					state := 0.0
+					if v {
+						state = 1
+					}
+					g.digital[j].Set(state)
+				}
+			}
+		}
+	}
+	e.count()
+}
+
+// count advances the counters by the link statistics gathered since the
+// previous call
+func (e *exporter) count() {
+	s := e.stats
+	e.latency.Set(s.latency)
+	e.frames.Add(float64(s.frames - e.seen.frames))
+	e.gaps.Add(float64(s.gaps - e.seen.gaps))
+	e.missing.Add(float64(s.missing - e.seen.missing))
+	e.errors.Add(float64(s.errors - e.seen.errors))
+	e.seen = *s
+}
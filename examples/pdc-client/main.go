@@ -2,120 +2,461 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/concentrator"
+	"github.com/JSchlarb/synchrophasor/csvsink"
+	"github.com/JSchlarb/synchrophasor/grpcserver"
+	"github.com/JSchlarb/synchrophasor/openpdc"
+	"github.com/JSchlarb/synchrophasor/pb"
+	"github.com/JSchlarb/synchrophasor/pcap"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	pdc := synchrophasor.NewPDC(1) // PDC ID = 1
+	ndjson := flag.Bool("ndjson", false, "write every data frame as newline-delimited JSON to stdout")
+	jsonSets := flag.Bool("json", false, "write every aligned measurement set as a JSON line to stdout")
+	capture := flag.String("pcap", "", "record the PMU traffic to this pcap file")
+	grpcAddr := flag.String("grpc", "", "serve the data frames with the Synchrophasor gRPC service on this address")
+	openPDC := flag.String("openpdc", "",
+		"connect to a device of this openPDC configuration cache (SystemConfiguration.xml)")
+	deviceName := flag.String("device", "", "acronym of the openPDC device, defaults to the first TCP device")
+	fullScreen := flag.Bool("tui", false, "show the live values, frame rate, latency and gaps full screen")
+	csvFile := flag.String("csv", "", "write the measurements to this CSV file, one column per channel")
+	metricsAddr := flag.String("metrics", "", "serve the received values as Prometheus gauges at /metrics on this address")
+	pmusFile := flag.String("pmus", "",
+		"concentrate the PMUs listed in this YAML file, aligning their frames by timestamp")
+	validate := flag.String("validate", "",
+		"check the stream against this simulator configuration and exit nonzero on deviations")
+	duration := flag.Duration("duration", 10*time.Second, "how long -validate checks the stream")
+	tolerance := flag.Float64("tolerance", 0.001, "widening of the ranges checked by -validate as a fraction of the base")
+	flag.Parse()
 
-	address := "localhost:4712"
-	if len(os.Args) > 1 {
-		address = os.Args[1]
+	if *fullScreen && *ndjson || *fullScreen && *jsonSets || *ndjson && *jsonSets {
+		log.Fatal("only one of -tui, -ndjson and -json can write to stdout")
+	}
+	if *pmusFile != "" && (*ndjson || *capture != "" || *openPDC != "" || *validate != "") {
+		log.Fatal("-ndjson, -pcap, -openpdc and -validate need a single PMU")
 	}
 
-	fmt.Printf("Connecting to PMU at %s...\n", address)
-	err := pdc.Connect(address)
-	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+	var checker *validator
+	if *validate != "" {
+		var err error
+		if checker, err = newValidator(*validate, *tolerance); err != nil {
+			log.Fatalf("Failed to read simulator configuration: %v", err)
+		}
 	}
-	defer pdc.Disconnect()
-	fmt.Println("Connected!")
 
-	fmt.Println("\n1. Requesting Header Frame...")
-	header, err := pdc.GetHeader()
-	if err != nil {
-		log.Printf("Failed to get header: %v", err)
-	} else {
-		fmt.Printf("Header: %s\n", header.Data)
+	idCode := uint16(1) // PDC ID = 1
+	address := "localhost:4712"
+	if flag.NArg() > 0 {
+		address = flag.Arg(0)
 	}
 
-	fmt.Println("\n2. Requesting Configuration Frame...")
-	cfg, err := pdc.GetConfig(2)
-	if err != nil {
-		log.Fatalf("Failed to get config: %v", err)
+	// Keep stdout clean for the JSON stream
+	var info io.Writer = os.Stdout
+	if *ndjson || *jsonSets {
+		info = os.Stderr
 	}
+	jsonOut := synchrophasor.NewNDJSONWriter(os.Stdout)
+
+	var (
+		pdc      *synchrophasor.PDC
+		conc     *concentrator.Concentrator
+		cfg      *synchrophasor.ConfigFrame
+		recorder *pcap.Writer
+	)
+	// concError and concNotify report the errors and reconnects of the
+	// concentrated PMUs, printing to info until the outputs are set up
+	concError := func(int, error) {}
+	concNotify := func(msg string) { fmt.Fprintln(info, msg) }
+	if *pmusFile != "" {
+		endpoints, wait, err := loadEndpoints(*pmusFile)
+		if err != nil {
+			log.Fatalf("Failed to read PMU list: %v", err)
+		}
+		conc, err = concentrator.New(endpoints, concentrator.Options{
+			IDCode:  idCode,
+			Wait:    wait,
+			OnError: func(i int, err error) { concError(i, err) },
+			Notify:  func(msg string) { concNotify(msg) },
+		})
+		if err != nil {
+			log.Fatalf("Failed to connect: %v", err)
+		}
+		defer conc.Disconnect()
+		fmt.Fprintln(info, "Connected!")
+		address = *pmusFile
+		cfg = conc.Config()
+	} else {
+		var device *openpdc.Device
+		if *openPDC != "" {
+			devices, err := openpdc.Load(*openPDC)
+			if err != nil {
+				log.Fatalf("Failed to import openPDC configuration: %v", err)
+			}
+			for _, d := range devices {
+				if strings.EqualFold(d.Acronym, *deviceName) || *deviceName == "" && d.Transport == "tcp" && !d.Listener {
+					device = d
+					break
+				}
+			}
+			if device == nil {
+				log.Fatalf("No matching device in %s", *openPDC)
+			}
+			if device.Transport != "tcp" || device.Listener {
+				log.Fatalf("Device %s is not a TCP server", device.Acronym)
+			}
+			idCode, address = device.AccessID, device.Address()
+		}
+
+		pdc = synchrophasor.NewPDC(idCode)
+
+		fmt.Fprintf(info, "Connecting to PMU at %s...\n", address)
+		err := pdc.Connect(address)
+		if err != nil {
+			log.Fatalf("Failed to connect: %v", err)
+		}
+		defer pdc.Disconnect()
+		fmt.Fprintln(info, "Connected!")
+
+		if *capture != "" {
+			file, err := os.Create(*capture)
+			if err != nil {
+				log.Fatalf("Failed to create capture: %v", err)
+			}
+			defer func() { _ = file.Close() }()
+
+			recorder, err = pcap.NewWriter(file)
+			if err != nil {
+				log.Fatalf("Failed to write capture: %v", err)
+			}
+			pdc.Socket = recorder.Conn(pdc.Socket)
+		}
+
+		fmt.Fprintln(info, "\n1. Requesting Header Frame...")
+		header, err := pdc.GetHeader()
+		if err != nil {
+			log.Printf("Failed to get header: %v", err)
+		} else {
+			fmt.Fprintf(info, "Header: %s\n", header.Data)
+		}
+
+		fmt.Fprintln(info, "\n2. Requesting Configuration Frame...")
+		cfg, err = pdc.GetConfig(2)
+		if err != nil {
+			log.Fatalf("Failed to get config: %v", err)
+		}
+
+		fmt.Fprintf(info, "Config: %v\n", cfg)
 
-	fmt.Printf("Config: %v\n", cfg)
+		// Name the station and channels as in openPDC
+		if device != nil && !device.Apply(cfg) {
+			log.Printf("Device %s not found in the configuration", device.Acronym)
+		}
+	}
 
-	fmt.Printf("Configuration received:\n")
-	fmt.Printf("  PMU Count: %d\n", cfg.NumPMU)
-	fmt.Printf("  Data Rate: %d fps\n", cfg.DataRate)
-	fmt.Printf("  Time Base: %d\n", cfg.TimeBase)
+	fmt.Fprintf(info, "Configuration received:\n")
+	fmt.Fprintf(info, "  PMU Count: %d\n", cfg.NumPMU)
+	fmt.Fprintf(info, "  Data Rate: %d fps\n", cfg.DataRate)
+	fmt.Fprintf(info, "  Time Base: %d\n", cfg.TimeBase)
 
 	for i, pmu := range cfg.PMUStationList {
-		fmt.Printf("\n  PMU Station %d:\n", i+1)
-		fmt.Printf("    Name: %s\n", pmu.STN)
-		fmt.Printf("    ID: %d\n", pmu.IDCode)
-		fmt.Printf("    Phasors: %d\n", pmu.Phnmr)
-		fmt.Printf("    Analog: %d\n", pmu.Annmr)
-		fmt.Printf("    Digital: %d\n", pmu.Dgnmr)
-		fmt.Printf("    Format: 0x%04X\n", pmu.Format)
+		fmt.Fprintf(info, "\n  PMU Station %d:\n", i+1)
+		fmt.Fprintf(info, "    Name: %s\n", pmu.STN)
+		fmt.Fprintf(info, "    ID: %d\n", pmu.IDCode)
+		fmt.Fprintf(info, "    Phasors: %d\n", pmu.Phnmr)
+		fmt.Fprintf(info, "    Analog: %d\n", pmu.Annmr)
+		fmt.Fprintf(info, "    Digital: %d\n", pmu.Dgnmr)
+		fmt.Fprintf(info, "    Format: 0x%04X\n", pmu.Format)
 
 		if len(pmu.CHNAMPhasor) > 0 {
-			fmt.Printf("    Phasor channels:\n")
+			fmt.Fprintf(info, "    Phasor channels:\n")
 			for j, name := range pmu.CHNAMPhasor {
-				fmt.Printf("      %d: %s\n", j+1, name)
+				fmt.Fprintf(info, "      %d: %s\n", j+1, name)
 			}
 		}
 	}
 
-	fmt.Println("\n3. Starting data transmission...")
-	err = pdc.Start()
+	var stream *grpcserver.Server
+	if *grpcAddr != "" {
+		listener, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		stream = grpcserver.New(cfg, grpcserver.Options{})
+		server := grpc.NewServer()
+		pb.RegisterSynchrophasorServer(server, stream)
+		go func() {
+			if err := server.Serve(listener); err != nil {
+				log.Printf("gRPC server stopped: %v", err)
+			}
+		}()
+		fmt.Fprintf(info, "Serving gRPC on %s\n", listener.Addr())
+	}
+
+	fmt.Fprintln(info, "\n3. Starting data transmission...")
+	var err error
+	if conc != nil {
+		err = conc.Start()
+	} else {
+		err = pdc.Start()
+	}
 	if err != nil {
 		log.Fatalf("Failed to start: %v", err)
 	}
 
-	fmt.Println("\n4. Reading data frames (press Ctrl+C to stop)...")
+	fmt.Fprintln(info, "\n4. Reading data frames (press Ctrl+C to stop)...")
 	frameCount := 0
 	startTime := time.Now()
+	stats := newLinkStats(cfg.DataRate)
+	if checker != nil {
+		checker.setConfig(cfg)
+		// Runs last, after the outputs are closed
+		defer func() {
+			if !checker.report(info, stats) {
+				os.Exit(1)
+			}
+		}()
+	}
+	defer stats.report(info)
+	var measurements synchrophasor.Measurements
+
+	var sink *csvsink.Sink
+	if *csvFile != "" {
+		if sink, err = csvsink.New(cfg, csvsink.Options{File: *csvFile}); err != nil {
+			log.Fatalf("Failed to create CSV file: %v", err)
+		}
+		defer func() {
+			if err := sink.Close(); err != nil {
+				log.Printf("Error closing CSV file: %v", err)
+			}
+		}()
+	}
+
+	var metrics *exporter
+	if *metricsAddr != "" {
+		listener, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		metrics = newExporter(cfg, stats)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go func() {
+			if err := http.Serve(listener, mux); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+		fmt.Fprintf(info, "Serving metrics on http://%s/metrics\n", listener.Addr())
+	}
+
+	var screen *tui
+	if *fullScreen {
+		screen = newTUI(os.Stdout, address, cfg, stats)
+		defer screen.Close()
+	}
+
+	// Ctrl+C closes the connections and ends the reconnects, ending the loop
+	// so that the outputs are closed. connMu guards the connection, which
+	// is replaced on reconnects.
+	var connMu sync.Mutex
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	if checker != nil {
+		time.AfterFunc(*duration, func() { signals <- os.Interrupt })
+	}
+	go func() {
+		<-signals
+		if conc != nil {
+			conc.Stop()
+			return
+		}
+		connMu.Lock()
+		close(stop)
+		if pdc.Socket != nil {
+			_ = pdc.Socket.Close()
+		}
+		connMu.Unlock()
+	}()
+
+	notify := func(msg string) {
+		if screen != nil {
+			screen.setStatus(msg)
+		} else {
+			log.Print(msg)
+		}
+	}
+
+	readError := func(err error) {
+		stats.errors++
+		if errors.Is(err, synchrophasor.ErrCRCFailed) {
+			stats.crc++
+		}
+		if metrics != nil {
+			metrics.count()
+		}
+		if screen != nil {
+			screen.setError(err)
+		} else {
+			log.Printf("Error reading frame: %v", err)
+		}
+	}
+
+	// output passes a measurement set to the enabled outputs
+	output := func(m *synchrophasor.Measurements) {
+		frameCount++
+		stats.add(m.Time, time.Now())
+
+		if sink != nil {
+			if err := sink.Write(m); err != nil {
+				log.Printf("Error writing CSV row: %v", err)
+			}
+		}
+
+		if metrics != nil {
+			metrics.update(m)
+		}
+
+		if checker != nil {
+			checker.add(m)
+		}
+
+		if stream != nil {
+			if err := stream.Write(m); err != nil {
+				log.Printf("Error streaming frame: %v", err)
+			}
+		}
+
+		if *jsonSets {
+			if err := jsonOut.Write(m); err != nil {
+				log.Printf("Error writing measurement set: %v", err)
+			}
+			return
+		}
+
+		if *ndjson {
+			return
+		}
+
+		if screen != nil {
+			screen.draw(m)
+			return
+		}
+
+		// Print summary every 10 frames
+		if frameCount%10 == 0 {
+			elapsed := time.Since(startTime).Seconds()
+			fps := float64(frameCount) / elapsed
+			micros := int64(math.Round(m.Time * 1e6))
+
+			fmt.Fprintf(info, "\n--- Frame %d (%.1f fps) ---\n", frameCount, fps)
+			fmt.Fprintf(info, "Timestamp: %d.%06d\n", micros/1e6, micros%1e6)
+
+			for i, meas := range m.Stations {
+				fmt.Fprintf(info, "\nStation %d:\n", i+1)
+				fmt.Fprintf(info, "  Frequency: %.3f Hz\n", meas.Frequency)
+				fmt.Fprintf(info, "  ROCOF: %.3f Hz/s\n", meas.ROCOF)
+
+				if len(meas.Phasors) > 0 {
+					mag := abs(meas.Phasors[0])
+					angle := phase(meas.Phasors[0]) * 180 / 3.14159
+					fmt.Fprintf(info, "  VA: %.1f V @ %.1f°\n", mag, angle)
+				}
+
+				if len(meas.Digital) > 0 {
+					fmt.Fprintf(info, "  Breaker 1: %v\n", meas.Digital[0][0])
+				}
+			}
+		}
+	}
+
+	if conc != nil {
+		concError = func(i int, err error) {
+			readError(fmt.Errorf("PMU %d: %w", i+1, err))
+		}
+		concNotify = notify
+		conc.Run(output)
+		return
+	}
+
+	// redial replaces the connection and restarts the stream
+	redial := func() error {
+		connMu.Lock()
+		pdc.Disconnect()
+		err := pdc.Connect(address)
+		if err == nil {
+			if recorder != nil {
+				pdc.Socket = recorder.Conn(pdc.Socket)
+			}
+			select {
+			case <-stop:
+				_ = pdc.Socket.Close()
+			default:
+			}
+		}
+		connMu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		fresh, err := pdc.GetConfig(2)
+		if err != nil {
+			return err
+		}
+		if err := cfg.SameLayout(fresh); err != nil {
+			return err
+		}
+		return pdc.Start()
+	}
 
 	for {
 		frame, err := pdc.ReadFrame()
+		if err != nil && synchrophasor.IsFrameError(err) {
+			readError(err)
+			continue
+		}
 		if err != nil {
-			log.Printf("Error reading frame: %v", err)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			notify(fmt.Sprintf("Disconnected from PMU at %s: %v, reconnecting", address, err))
+			down := time.Now()
+			ok := synchrophasor.Backoff{}.Retry(stop, redial, func(err error, retry time.Duration) {
+				notify(fmt.Sprintf("Reconnecting to PMU at %s failed: %v, retrying in %s", address, err, retry))
+			})
+			if !ok {
+				return
+			}
+			notify(fmt.Sprintf("Reconnected to PMU at %s after %s", address, time.Since(down).Round(time.Millisecond)))
 			continue
 		}
 
 		if df, ok := frame.(*synchrophasor.DataFrame); ok {
-			frameCount++
-
-			// Print summary every 10 frames
-			if frameCount%10 == 0 {
-				elapsed := time.Since(startTime).Seconds()
-				fps := float64(frameCount) / elapsed
-
-				fmt.Printf("\n--- Frame %d (%.1f fps) ---\n", frameCount, fps)
-				fmt.Printf("Timestamp: %d.%06d\n", df.SOC, df.FracSec&0xFFFFFF)
-
-				measurements := df.GetMeasurements()
-				if measList, ok := measurements["measurements"].([]map[string]interface{}); ok {
-					for i, meas := range measList {
-						fmt.Printf("\nStation %d:\n", i+1)
-
-						if freq, ok := meas["frequency"].(float32); ok {
-							fmt.Printf("  Frequency: %.3f Hz\n", freq)
-						}
-
-						if rocof, ok := meas["rocof"].(float32); ok {
-							fmt.Printf("  ROCOF: %.3f Hz/s\n", rocof)
-						}
-
-						if phasors, ok := meas["phasors"].([]complex128); ok && len(phasors) > 0 {
-							mag := abs(phasors[0])
-							angle := phase(phasors[0]) * 180 / 3.14159
-							fmt.Printf("  VA: %.1f V @ %.1f°\n", mag, angle)
-						}
-
-						if digital, ok := meas["digital"].([][]bool); ok && len(digital) > 0 {
-							fmt.Printf("  Breaker 1: %v\n", digital[0][0])
-						}
-					}
+			df.FillMeasurements(&measurements)
+			output(&measurements)
+
+			if *ndjson {
+				if err := jsonOut.Write(df); err != nil {
+					log.Printf("Error writing frame: %v", err)
 				}
 			}
 		}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// linkStats tracks the frame rate, gaps and latency of the received stream
+type linkStats struct {
+	// interval is the configured time between frames in seconds
+	interval float64
+	dataRate int16
+	start    time.Time
+	frames   int
+	errors   int
+	// crc counts the errors that are CRC failures
+	crc int
+	// gaps counts the interruptions of the frame sequence, missing the
+	// frames lost in them
+	gaps    int
+	missing int
+	// last is the time of the previous frame, latency the delay of its
+	// arrival after it in seconds
+	last    float64
+	latency float64
+	// minLatency, maxLatency and sumLatency summarize the latencies of all
+	// frames
+	minLatency float64
+	maxLatency float64
+	sumLatency float64
+}
+
+// newLinkStats returns the statistics of a stream with the given DATA_RATE,
+// negative for seconds per frame
+func newLinkStats(dataRate int16) *linkStats {
+	return &linkStats{interval: frameInterval(dataRate), dataRate: dataRate, start: time.Now()}
+}
+
+// frameInterval returns the time between frames in seconds for DATA_RATE,
+// negative for seconds per frame, zero if unset
+func frameInterval(dataRate int16) float64 {
+	switch {
+	case dataRate > 0:
+		return 1 / float64(dataRate)
+	case dataRate < 0:
+		return -float64(dataRate)
+	}
+	return 0
+}
+
+// add records a frame stamped with frameTime in seconds received at received
+func (s *linkStats) add(frameTime float64, received time.Time) {
+	s.frames++
+	s.latency = float64(received.UnixNano())/1e9 - frameTime
+	if s.frames == 1 {
+		s.minLatency, s.maxLatency = s.latency, s.latency
+	}
+	s.minLatency = min(s.minLatency, s.latency)
+	s.maxLatency = max(s.maxLatency, s.latency)
+	s.sumLatency += s.latency
+	if s.last != 0 && s.interval > 0 {
+		if lost := int(math.Round((frameTime-s.last)/s.interval)) - 1; lost > 0 {
+			s.gaps++
+			s.missing += lost
+		}
+	}
+	s.last = frameTime
+}
+
+// fps returns the mean frame rate since the start
+func (s *linkStats) fps() float64 {
+	elapsed := time.Since(s.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(s.frames) / elapsed
+}
+
+// report writes the summary of the run to w
+func (s *linkStats) report(w io.Writer) {
+	fmt.Fprintln(w, "\n--- Link summary ---")
+	fmt.Fprintf(w, "Duration: %s\n", time.Since(s.start).Round(time.Millisecond))
+	fmt.Fprintf(w, "Frames:   %d (%.2f fps, %d configured)\n", s.frames, s.fps(), s.dataRate)
+	fmt.Fprintf(w, "Errors:   %d (%d CRC failures)\n", s.errors, s.crc)
+	fmt.Fprintf(w, "Gaps:     %d (%d frames missing)\n", s.gaps, s.missing)
+	if s.frames > 0 {
+		fmt.Fprintf(w, "Latency:  min %.1f ms, mean %.1f ms, max %.1f ms\n",
+			s.minLatency*1000, s.sumLatency/float64(s.frames)*1000, s.maxLatency*1000)
+	}
+}
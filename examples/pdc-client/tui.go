@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// tuiRefresh is the interval between redraws
+const tuiRefresh = 100 * time.Millisecond
+
+// ANSI sequences switching to the alternate screen and back, and redrawing
+// from the top left
+const (
+	ansiEnter  = "\x1b[?1049h\x1b[?25l"
+	ansiLeave  = "\x1b[?25h\x1b[?1049l"
+	ansiHome   = "\x1b[H"
+	ansiClear  = "\x1b[K"
+	ansiBottom = "\x1b[J"
+)
+
+// tui shows the live values of the stations and the link statistics full
+// screen, updating them in place
+type tui struct {
+	mu      sync.Mutex
+	out     io.Writer
+	address string
+	cfg     *synchrophasor.ConfigFrame
+	stats   *linkStats
+	buf     bytes.Buffer
+	drawn   time.Time
+	status  string
+	closed  bool
+}
+
+// newTUI switches out to the alternate screen
+func newTUI(out io.Writer, address string, cfg *synchrophasor.ConfigFrame, stats *linkStats) *tui {
+	t := &tui{out: out, address: address, cfg: cfg, stats: stats}
+	_, _ = io.WriteString(out, ansiEnter)
+	return t
+}
+
+// setError shows the last read error
+func (t *tui) setError(err error) {
+	t.setStatus("Last error: " + err.Error())
+}
+
+// setStatus shows msg, e.g. on disconnects and reconnects
+func (t *tui) setStatus(msg string) {
+	t.mu.Lock()
+	t.status = msg
+	t.mu.Unlock()
+}
+
+// draw redraws the screen with the measurements m, at most every
+// tuiRefresh
+func (t *tui) draw(m *synchrophasor.Measurements) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || time.Since(t.drawn) < tuiRefresh {
+		return
+	}
+	t.drawn = time.Now()
+
+	b := &t.buf
+	b.Reset()
+	b.WriteString(ansiHome)
+	line := func(format string, args ...any) {
+		fmt.Fprintf(b, format, args...)
+		b.WriteString(ansiClear + "\n")
+	}
+
+	s := t.stats
+	stamp := time.Unix(0, int64(m.Time*1e9)).UTC().Format("2006-01-02 15:04:05.000")
+	line("PDC client  %s  IDCODE %d  %s UTC", t.address, m.PMUID, stamp)
+	line("Frames %d  %.1f fps (%d configured)  Latency %.1f ms  Gaps %d (%d frames missing)  Errors %d",
+		s.frames, s.fps(), t.cfg.DataRate, s.latency*1000, s.gaps, s.missing, s.errors)
+	if t.status != "" {
+		line("%s", t.status)
+	}
+
+	for i, st := range m.Stations {
+		if i >= len(t.cfg.PMUStationList) {
+			break
+		}
+		pmu := t.cfg.PMUStationList[i]
+		line("")
+		line("%s (%d)  STAT 0x%04X  %.4f Hz  %.4f Hz/s",
+			strings.TrimSpace(pmu.STN), st.StreamID, st.Stat, st.Frequency, st.ROCOF)
+		for j, ph := range st.Phasors {
+			unit := "V"
+			if j < len(pmu.Phunit) && pmu.Phunit[j]>>24 == 1 {
+				unit = "A"
+			}
+			line("  %-16s %12.3f %s  %8.2f°", pmu.PhasorName(j), cmplx.Abs(ph), unit, cmplx.Phase(ph)*180/math.Pi)
+		}
+		for j, v := range st.Analog {
+			line("  %-16s %12.3f", pmu.AnalogName(j), v)
+		}
+		var digitals []string
+		for w, word := range st.Digital {
+			for bit, v := range word {
+				name := pmu.DigitalName(w*16 + bit)
+				if name == "" {
+					continue
+				}
+				state := "0"
+				if v {
+					state = "1"
+				}
+				digitals = append(digitals, name+"="+state)
+			}
+		}
+		if len(digitals) > 0 {
+			line("  %s", strings.Join(digitals, "  "))
+		}
+	}
+	b.WriteString(ansiBottom)
+	_, _ = t.out.Write(b.Bytes())
+}
+
+// Close restores the screen
+func (t *tui) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		_, _ = io.WriteString(t.out, ansiLeave)
+	}
+}
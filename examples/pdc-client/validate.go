@@ -0,0 +1,452 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/spf13/viper"
+)
+
+// simPhasor is the part of a simulator phasor or three-phase set that
+// determines its magnitude
+type simPhasor struct {
+	Name       string    `mapstructure:"name"`
+	Type       uint8     `mapstructure:"type"`
+	BaseValue  string    `mapstructure:"base_value"`
+	Magnitude  float64   `mapstructure:"magnitude"`
+	Magnitudes []float64 `mapstructure:"magnitudes"`
+	Faults     []any     `mapstructure:"faults"`
+	Modulation struct {
+		Frequency float64 `mapstructure:"frequency"`
+	} `mapstructure:"modulation"`
+	Load struct {
+		Voltage string `mapstructure:"voltage"`
+	} `mapstructure:"load"`
+}
+
+// simAnalog is a simulator analog channel
+type simAnalog struct {
+	Name            string         `mapstructure:"name"`
+	Unit            string         `mapstructure:"unit"`
+	BaseValue       float64        `mapstructure:"base_value"`
+	Variation       float64        `mapstructure:"variation"`
+	GeneratorType   string         `mapstructure:"generator_type"`
+	GeneratorParams map[string]any `mapstructure:"generator_params"`
+}
+
+// simDigital is a simulator digital channel
+type simDigital struct {
+	Name string `mapstructure:"name"`
+}
+
+// simStation is the part of a simulator station checked by -validate. The
+// scenario lists are only counted, as they move the values on purpose.
+type simStation struct {
+	Name                string       `mapstructure:"name"`
+	ID                  uint16       `mapstructure:"id"`
+	VoltageBase         float64      `mapstructure:"voltage_base"`
+	CurrentBase         float64      `mapstructure:"current_base"`
+	FrequencyBase       float64      `mapstructure:"frequency_base"`
+	VoltageVariation    float64      `mapstructure:"voltage_variation"`
+	CurrentVariation    float64      `mapstructure:"current_variation"`
+	FrequencyVariation  float64      `mapstructure:"frequency_variation"`
+	DFreqVariation      float64      `mapstructure:"dfreq_variation"`
+	Phasors             []simPhasor  `mapstructure:"phasors"`
+	ThreePhaseSets      []simPhasor  `mapstructure:"three_phase_sets"`
+	AnalogChannels      []simAnalog  `mapstructure:"analog_channels"`
+	DigitalChannels     []simDigital `mapstructure:"digital_channels"`
+	FrequencyExcursions []any        `mapstructure:"frequency_excursions"`
+	Oscillations        []any        `mapstructure:"oscillations"`
+	AngleDrift          float64      `mapstructure:"angle_drift"`
+	AngleRamps          []any        `mapstructure:"angle_ramps"`
+	BreakerTrips        []any        `mapstructure:"breaker_trips"`
+	ComplianceTests     []any        `mapstructure:"compliance_tests"`
+	// LoadProfile scales the currents and power channels, adding its noise
+	// even when disabled
+	LoadProfile struct {
+		Enabled bool    `mapstructure:"enabled"`
+		Noise   float64 `mapstructure:"noise"`
+	} `mapstructure:"load_profile"`
+}
+
+// simConfig is the part of the simulator configuration checked by -validate
+type simConfig struct {
+	PMU struct {
+		simStation  `mapstructure:",squash"`
+		NamePrefix  string `mapstructure:"name_prefix"`
+		IncrementID uint16 `mapstructure:"increment_id"`
+		TimeBase    uint32 `mapstructure:"time_base"`
+		DataRate    int16  `mapstructure:"data_rate"`
+		Playback    struct {
+			File string `mapstructure:"file"`
+		} `mapstructure:"playback"`
+		Network struct {
+			Enabled bool `mapstructure:"enabled"`
+		} `mapstructure:"network"`
+		Stations []simStation `mapstructure:"stations"`
+	} `mapstructure:"pmu"`
+}
+
+// loadSimConfig reads a simulator configuration with the defaults of the
+// simulator and fills in the stations as it does
+func loadSimConfig(path string) (*simConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetDefault("pmu.name_prefix", "PMU")
+	v.SetDefault("pmu.id", 1)
+	v.SetDefault("pmu.voltage_base", 230)
+	v.SetDefault("pmu.current_base", 2000)
+	v.SetDefault("pmu.frequency_base", 50)
+	v.SetDefault("pmu.voltage_variation", 0.005)
+	v.SetDefault("pmu.current_variation", 0.005)
+	v.SetDefault("pmu.frequency_variation", 0.001)
+	v.SetDefault("pmu.dfreq_variation", 0.01)
+	v.SetDefault("pmu.time_base", 1000000)
+	v.SetDefault("pmu.data_rate", 50)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var c simConfig
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+
+	p := &c.PMU
+	p.ID += p.IncrementID
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("%s_%d", p.NamePrefix, p.ID)
+	}
+	if len(p.Stations) == 0 {
+		p.Stations = []simStation{p.simStation}
+	}
+	for i := range p.Stations {
+		s := &p.Stations[i]
+		if s.ID == 0 {
+			s.ID = p.ID + uint16(i)
+		}
+		if s.Name == "" {
+			s.Name = fmt.Sprintf("%s_%d", p.NamePrefix, s.ID)
+		}
+		if !s.LoadProfile.Enabled {
+			s.LoadProfile = p.LoadProfile
+		}
+		for _, f := range []struct{ value, fallback *float64 }{
+			{&s.VoltageBase, &p.VoltageBase},
+			{&s.CurrentBase, &p.CurrentBase},
+			{&s.FrequencyBase, &p.FrequencyBase},
+			{&s.VoltageVariation, &p.VoltageVariation},
+			{&s.CurrentVariation, &p.CurrentVariation},
+			{&s.FrequencyVariation, &p.FrequencyVariation},
+			{&s.DFreqVariation, &p.DFreqVariation},
+		} {
+			if *f.value == 0 {
+				*f.value = *f.fallback
+			}
+		}
+	}
+	return &c, nil
+}
+
+// expectation is a channel whose values must stay within lo and hi
+type expectation struct {
+	name   string
+	lo, hi float64
+	value  func(st *synchrophasor.StationMeasurement) float64
+	// station is the index of the station in the stream
+	station int
+	// outside counts the values out of range, worst is the one furthest
+	// from it
+	outside int
+	worst   float64
+}
+
+// check records v
+func (e *expectation) check(v float64) {
+	if v >= e.lo && v <= e.hi {
+		return
+	}
+	if e.outside == 0 || math.Abs(v-(e.lo+e.hi)/2) > math.Abs(e.worst-(e.lo+e.hi)/2) {
+		e.worst = v
+	}
+	e.outside++
+}
+
+// validator checks a stream against the configuration of the simulator
+// sending it
+type validator struct {
+	sim *simConfig
+	// tolerance widens the ranges by this fraction of the base
+	tolerance    float64
+	expectations []*expectation
+	failures     []string
+	skipped      []string
+}
+
+// newValidator loads the simulator configuration at path
+func newValidator(path string, tolerance float64) (*validator, error) {
+	sim, err := loadSimConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return &validator{sim: sim, tolerance: tolerance}, nil
+}
+
+// fail records a deviation
+func (v *validator) fail(format string, args ...any) {
+	v.failures = append(v.failures, fmt.Sprintf(format, args...))
+}
+
+// expect checks the values of a channel against base ± base·variation,
+// widened by the resolution of its format
+func (v *validator) expect(station int, name string, base, variation, resolution float64,
+	value func(st *synchrophasor.StationMeasurement) float64) {
+	margin := math.Abs(base)*(variation+v.tolerance) + resolution
+	v.expectations = append(v.expectations, &expectation{
+		name: name, lo: base - margin, hi: base + margin, value: value, station: station,
+	})
+}
+
+// setConfig checks the configuration of the stream and sets up the checks
+// of the values of its channels
+func (v *validator) setConfig(cfg *synchrophasor.ConfigFrame) {
+	p := &v.sim.PMU
+	if cfg.DataRate != p.DataRate {
+		v.fail("DATA_RATE is %d, expected %d", cfg.DataRate, p.DataRate)
+	}
+	if cfg.TimeBase != p.TimeBase {
+		v.fail("TIME_BASE is %d, expected %d", cfg.TimeBase, p.TimeBase)
+	}
+	if len(cfg.PMUStationList) != len(p.Stations) {
+		v.fail("%d stations, expected %d", len(cfg.PMUStationList), len(p.Stations))
+	}
+	if p.Playback.File != "" {
+		v.skipped = append(v.skipped, "values played back from "+p.Playback.File)
+	}
+
+	for i, pmu := range cfg.PMUStationList {
+		if i >= len(p.Stations) {
+			break
+		}
+		s := &p.Stations[i]
+		name := strings.TrimSpace(pmu.STN)
+		if want := truncate(s.Name, 16); name != want {
+			v.fail("station %d is named %q, expected %q", i+1, name, want)
+		}
+		if pmu.IDCode != s.ID {
+			v.fail("station %s has IDCODE %d, expected %d", name, pmu.IDCode, s.ID)
+		}
+		if p.Playback.File == "" {
+			v.expectStation(i, name, pmu, s)
+		}
+	}
+}
+
+// expectStation sets up the checks of the values of a station
+func (v *validator) expectStation(i int, name string, pmu *synchrophasor.PMUStation, s *simStation) {
+	if len(s.FrequencyExcursions)+len(s.Oscillations)+len(s.AngleRamps)+len(s.BreakerTrips)+len(s.ComplianceTests) > 0 ||
+		s.AngleDrift != 0 || modulated(s) {
+		v.skipped = append(v.skipped, name+" frequency and ROCOF, moved by the scenarios")
+	} else {
+		freqRes, rocofRes := 0.0, 0.0
+		if !pmu.FormatFreqType() {
+			freqRes, rocofRes = 0.001, 0.01
+		}
+		v.expect(i, name+" frequency", s.FrequencyBase, s.FrequencyVariation, freqRes,
+			func(st *synchrophasor.StationMeasurement) float64 {
+				return float64(st.Frequency)
+			})
+		v.expect(i, name+" ROCOF", s.FrequencyBase/100, s.DFreqVariation, rocofRes,
+			func(st *synchrophasor.StationMeasurement) float64 {
+				return float64(st.ROCOF)
+			})
+	}
+
+	phasors := s.Phasors
+	for _, set := range s.ThreePhaseSets {
+		for k, phase := range []string{"A", "B", "C"} {
+			ph := set
+			ph.Name = set.Name + phase
+			ph.Magnitude = 0
+			if len(set.Magnitudes) == 3 {
+				ph.Magnitude = set.Magnitudes[k]
+			}
+			phasors = append(phasors, ph)
+		}
+	}
+	for _, ph := range phasors {
+		j := channelIndex(pmu.CHNAMPhasor, ph.Name)
+		if j < 0 {
+			v.fail("station %s has no phasor %s", name, ph.Name)
+			continue
+		}
+		current := ph.BaseValue == "current" || ph.BaseValue == "" && ph.Type != 0
+		switch {
+		case len(ph.Faults) > 0 || ph.Modulation.Frequency > 0 || ph.Load.Voltage != "" || len(s.ComplianceTests) > 0:
+			v.skipped = append(v.skipped, name+" "+ph.Name+", moved by faults, modulation, load or tests")
+			continue
+		case current && (s.LoadProfile.Enabled || len(s.BreakerTrips) > 0):
+			v.skipped = append(v.skipped, name+" "+ph.Name+", moved by the load profile or breaker trips")
+			continue
+		}
+		base, variation := s.VoltageBase, s.VoltageVariation
+		if current {
+			base, variation = s.CurrentBase, withNoise(s.CurrentVariation, s.LoadProfile.Noise)
+		}
+		if ph.Magnitude > 0 {
+			base *= ph.Magnitude
+		}
+		resolution := 0.0
+		if !pmu.FormatPhasorType() {
+			resolution = float64(pmu.GetPhasorFactor(j)) / 1e5
+		}
+		v.expect(i, name+" "+ph.Name+" magnitude", base, variation, resolution,
+			func(st *synchrophasor.StationMeasurement) float64 {
+				if j >= len(st.Phasors) {
+					return math.NaN()
+				}
+				return cmplx.Abs(st.Phasors[j])
+			})
+	}
+
+	for _, an := range s.AnalogChannels {
+		j := channelIndex(pmu.CHNAMAnalog, an.Name)
+		if j < 0 {
+			v.fail("station %s has no analog channel %s", name, an.Name)
+			continue
+		}
+		if s.LoadProfile.Enabled {
+			v.skipped = append(v.skipped, name+" "+an.Name+", moved by the load profile")
+			continue
+		}
+		base, variation := an.BaseValue, an.Variation
+		switch an.GeneratorType {
+		case "constant":
+			variation = 0
+		case "sine":
+			amplitude := an.BaseValue * an.Variation
+			if o, ok := an.GeneratorParams["offset"].(float64); ok {
+				base = o
+			}
+			if a, ok := an.GeneratorParams["amplitude"].(float64); ok {
+				amplitude = a
+			}
+			variation = 0
+			if base != 0 {
+				variation = math.Abs(amplitude / base)
+			}
+		}
+		if isPowerUnit(an.Unit) {
+			variation = withNoise(variation, s.LoadProfile.Noise)
+		}
+		resolution := 0.0
+		if !pmu.FormatAnalogType() {
+			resolution = 1
+		}
+		v.expect(i, name+" "+an.Name, base, variation, resolution, func(st *synchrophasor.StationMeasurement) float64 {
+			if j >= len(st.Analog) {
+				return math.NaN()
+			}
+			return float64(st.Analog[j])
+		})
+	}
+
+	for _, dg := range s.DigitalChannels {
+		if channelIndex(pmu.CHNAMDigital, dg.Name) < 0 {
+			v.fail("station %s has no digital channel %s", name, dg.Name)
+		}
+	}
+}
+
+// withNoise returns the relative variation of a value varying by variation
+// and then scaled by a factor varying by noise
+func withNoise(variation, noise float64) float64 {
+	return (1+variation)*(1+noise) - 1
+}
+
+// isPowerUnit reports whether an analog channel is a power, following the
+// simulator
+func isPowerUnit(unit string) bool {
+	switch strings.ToLower(unit) {
+	case "w", "kw", "mw", "var", "kvar", "mvar", "va", "kva", "mva":
+		return true
+	}
+	return false
+}
+
+// modulated reports whether a phasor of s is modulated, which moves the
+// frequency
+func modulated(s *simStation) bool {
+	for _, ph := range append(s.Phasors, s.ThreePhaseSets...) {
+		if ph.Modulation.Frequency > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// channelIndex returns the index of the channel named name, -1 if missing
+func channelIndex(names []string, name string) int {
+	for i := range names {
+		if strings.TrimSpace(names[i]) == truncate(name, 16) {
+			return i
+		}
+	}
+	return -1
+}
+
+// truncate cuts s to the n bytes of a C37.118 name
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// add checks the values of a measurement set
+func (v *validator) add(m *synchrophasor.Measurements) {
+	for _, e := range v.expectations {
+		if e.station < len(m.Stations) {
+			e.check(e.value(&m.Stations[e.station]))
+		}
+	}
+}
+
+// report checks the frame rate, writes the result to w and returns whether
+// the stream matched the configuration
+func (v *validator) report(w io.Writer, stats *linkStats) bool {
+	if stats.frames == 0 {
+		v.fail("no data frames received")
+	} else if want := 1 / stats.interval; math.Abs(stats.fps()-want) > 0.02*want {
+		v.fail("%.2f fps, expected %.2f", stats.fps(), want)
+	}
+	if v.sim.PMU.Network.Enabled {
+		v.skipped = append(v.skipped, "gaps, caused by the network impairment")
+	} else if stats.missing > 0 {
+		v.fail("%d frames missing in %d gaps", stats.missing, stats.gaps)
+	}
+	for _, e := range v.expectations {
+		if e.outside > 0 {
+			v.fail("%s: %d of %d values outside %.6g … %.6g, worst %.6g",
+				e.name, e.outside, stats.frames, e.lo, e.hi, e.worst)
+		}
+	}
+
+	fmt.Fprintln(w, "\n--- Validation ---")
+	fmt.Fprintf(w, "Checked %d channels over %d frames\n", len(v.expectations), stats.frames)
+	for _, s := range v.skipped {
+		fmt.Fprintf(w, "Skipped %s\n", s)
+	}
+	for _, f := range v.failures {
+		fmt.Fprintf(w, "FAIL %s\n", f)
+	}
+	if len(v.failures) > 0 {
+		fmt.Fprintf(w, "%d deviations\n", len(v.failures))
+		return false
+	}
+	fmt.Fprintln(w, "PASS")
+	return true
+}
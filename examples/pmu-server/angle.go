@@ -0,0 +1,41 @@
+package main
+
+import "math"
+
+// AngleRamp describes a linear change of the phasor angles between two
+// setpoints, holding the final one until the next repetition
+type AngleRamp struct {
+	From     float64 `mapstructure:"from"`     // angle offset at the start in degrees
+	To       float64 `mapstructure:"to"`       // angle offset at the end in degrees
+	Start    string  `mapstructure:"start"`    // offset from the simulator start
+	Duration string  `mapstructure:"duration"` // ramp time, "0s" for a step
+	Period   string  `mapstructure:"period"`   // repetition interval, "0s" for once
+}
+
+// angleDriftAt returns the angle offset in radians and the frequency offset
+// in Hz of a constant drift in degrees per second
+func angleDriftAt(drift, timeOffset float64) (float64, float64) {
+	if drift == 0 {
+		return 0, 0
+	}
+	return math.Remainder(drift*timeOffset*math.Pi/180, 2*math.Pi), drift / 360
+}
+
+// angleRampAt returns the angle offset in radians and the frequency
+// deviation in Hz of the active ramps
+func angleRampAt(ramps []AngleRamp, timeOffset float64) (float64, float64) {
+	var angle, dev float64
+	for _, r := range ramps {
+		t, ok := cycleTime(timeOffset, r.Start, r.Period)
+		if !ok {
+			continue
+		}
+		if d := seconds(r.Duration); t < d {
+			angle += r.From + (r.To-r.From)*t/d
+			dev += (r.To - r.From) / d / 360
+		} else {
+			angle += r.To
+		}
+	}
+	return angle * math.Pi / 180, dev
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BreakerTrip correlates a breaker with its currents and the frequency:
+// while the digital channel of the breaker is open (0) the currents drop to
+// a residual, and every operation perturbs the frequency, rising on opening
+// as load is lost and falling on closing
+type BreakerTrip struct {
+	Breaker  string   `mapstructure:"breaker"`  // digital channel, 1 = closed
+	Currents []string `mapstructure:"currents"` // current phasors through the breaker
+	// Residual is the current left while open relative to the closed one,
+	// defaults to 0.01
+	Residual float64 `mapstructure:"residual"`
+	// FrequencyDeviation is the peak frequency deviation of an operation in
+	// Hz, decaying exponentially over Recovery
+	FrequencyDeviation float64 `mapstructure:"frequency_deviation"`
+	Recovery           string  `mapstructure:"recovery"` // defaults to "5s"
+}
+
+// tripState tracks a breaker trip of a station
+type tripState struct {
+	cfg      *BreakerTrip
+	breaker  int
+	currents []int
+	closed   bool
+	// changed is the time of the last operation, zero before the first
+	changed time.Time
+}
+
+// newTripStates resolves the channels of the breaker trips of a station
+func newTripStates(sc *StationConfig, digitalStates []DigitalChannelState) []*tripState {
+	trips := make([]*tripState, 0, len(sc.BreakerTrips))
+	for i := range sc.BreakerTrips {
+		bt := &sc.BreakerTrips[i]
+		t := &tripState{cfg: bt}
+		t.breaker = slices.IndexFunc(sc.DigitalChannels, func(ch DigitalChannel) bool { return ch.Name == bt.Breaker })
+		t.closed = digitalStates[t.breaker].CurrentValue
+		for j, ph := range sc.Phasors {
+			if slices.Contains(bt.Currents, ph.Name) {
+				t.currents = append(t.currents, j)
+			}
+		}
+		trips = append(trips, t)
+	}
+	return trips
+}
+
+// update follows the breaker state, returning the frequency deviation in Hz
+// and its rate of change in Hz/s at currentTime
+func (t *tripState) update(digitalStates []DigitalChannelState, currentTime time.Time) (float64, float64) {
+	if closed := digitalStates[t.breaker].CurrentValue; closed != t.closed {
+		t.closed = closed
+		t.changed = currentTime
+	}
+	if t.changed.IsZero() || t.cfg.FrequencyDeviation == 0 {
+		return 0, 0
+	}
+	// Five time constants settle within 1 %
+	tau := seconds(t.cfg.Recovery) / 5
+	dev := t.cfg.FrequencyDeviation * math.Exp(-currentTime.Sub(t.changed).Seconds()/tau)
+	if t.closed {
+		dev = -dev
+	}
+	return dev, -dev / tau
+}
+
+// validateTrips disables the breaker trips of a station naming unknown
+// channels and fills their defaults
+func (s *StationConfig) validateTrips() {
+	trips := s.BreakerTrips[:0]
+	for _, bt := range s.BreakerTrips {
+		if !slices.ContainsFunc(s.DigitalChannels, func(ch DigitalChannel) bool { return ch.Name == bt.Breaker }) {
+			log.WithField("breaker", bt.Breaker).Warn("Unknown breaker channel, disabling its trip")
+			continue
+		}
+		for _, name := range bt.Currents {
+			if !slices.ContainsFunc(s.Phasors, func(ph PhasorDefinition) bool { return ph.Name == name }) {
+				log.WithField("breaker", bt.Breaker).Warnf("Unknown current phasor %q, ignoring it", name)
+			}
+		}
+		if bt.Residual <= 0 {
+			bt.Residual = 0.01
+		}
+		if bt.Recovery == "" {
+			bt.Recovery = "5s"
+		}
+		if validDurations("breaker", bt.Breaker, bt.Recovery) && seconds(bt.Recovery) > 0 {
+			trips = append(trips, bt)
+		}
+	}
+	s.BreakerTrips = trips
+}
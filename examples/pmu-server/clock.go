@@ -0,0 +1,20 @@
+package main
+
+import "time"
+
+// ClockSkew offsets the time stamped into the frames from the wall time, as
+// a PMU with a misconfigured or free-running clock that still reports being
+// synchronized. The ground truth keeps the wall time.
+type ClockSkew struct {
+	Enabled  bool    `mapstructure:"enabled"`
+	Offset   string  `mapstructure:"offset"`    // constant offset, negative to stamp early
+	DriftPPM float64 `mapstructure:"drift_ppm"` // error growth since the simulator start
+}
+
+// at returns the clock error elapsed after the simulator start
+func (c *ClockSkew) at(elapsed time.Duration) time.Duration {
+	if !c.Enabled {
+		return 0
+	}
+	return time.Duration((seconds(c.Offset) + c.DriftPPM*1e-6*elapsed.Seconds()) * float64(time.Second))
+}
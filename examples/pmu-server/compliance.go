@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ComplianceTest is a step or frequency ramp test signal of IEEE
+// C37.118.1, applied to all phasors of a station
+type ComplianceTest struct {
+	// Type is "magnitude_step", "phase_step" or "frequency_ramp"
+	Type  string `mapstructure:"type"`
+	Start string `mapstructure:"start"` // offset from the simulator start
+	// Duration holds a step before stepping back, "0s" to keep it. A ramp
+	// lasts 2·Range/|Rate|.
+	Duration string `mapstructure:"duration"`
+	Period   string `mapstructure:"period"` // repetition interval, "0s" for once
+	// Step is the magnitude step relative to the base, defaults to 0.1, or
+	// the phase step in degrees, defaults to 10
+	Step float64 `mapstructure:"step"`
+	// Rate is the ramp rate in Hz/s, defaults to 1, negative ramps down
+	Rate float64 `mapstructure:"rate"`
+	// Range is the frequency deviation at both ends of a ramp in Hz,
+	// defaults to 2 (class P, 5 for class M)
+	Range float64 `mapstructure:"range"`
+}
+
+// complianceAt returns the magnitude factor, the angle offset in radians,
+// the frequency deviation in Hz and its rate of change in Hz/s of the active
+// tests. A ramp jumps to its lower end on the start and back to the nominal
+// frequency after passing the upper one, where its angle offset returns to
+// zero.
+func complianceAt(tests []ComplianceTest, timeOffset float64) (magnitude, angle, dev, rate float64) {
+	magnitude = 1
+	for _, c := range tests {
+		t, ok := cycleTime(timeOffset, c.Start, c.Period)
+		if !ok {
+			continue
+		}
+		switch c.Type {
+		case "magnitude_step", "phase_step":
+			if d := seconds(c.Duration); d > 0 && t >= d {
+				continue
+			}
+			if c.Type == "magnitude_step" {
+				magnitude *= 1 + c.Step
+			} else {
+				angle += c.Step * math.Pi / 180
+			}
+		case "frequency_ramp":
+			if t >= 2*c.Range/math.Abs(c.Rate) {
+				continue
+			}
+			from := math.Copysign(c.Range, -c.Rate)
+			dev += from + c.Rate*t
+			rate += c.Rate
+			angle += 2 * math.Pi * (from*t + c.Rate*t*t/2)
+		}
+	}
+	return magnitude, math.Remainder(angle, 2*math.Pi), dev, rate
+}
+
+// validateComplianceTests disables the compliance tests of a station with
+// an unknown type and fills their defaults
+func (s *StationConfig) validateComplianceTests() {
+	tests := s.ComplianceTests[:0]
+	for i, c := range s.ComplianceTests {
+		name := s.Name + "/" + strconv.Itoa(i)
+		switch c.Type {
+		case "magnitude_step":
+			if c.Step == 0 {
+				c.Step = 0.1
+			}
+		case "phase_step":
+			if c.Step == 0 {
+				c.Step = 10
+			}
+		case "frequency_ramp":
+			if c.Rate == 0 {
+				c.Rate = 1
+			}
+			if c.Range <= 0 {
+				c.Range = 2
+			}
+		default:
+			log.WithField("compliance_test", name).Warnf("Unknown test type %q, disabling it", c.Type)
+			continue
+		}
+		if validDurations("compliance_test", name, c.Start, c.Duration, c.Period) {
+			tests = append(tests, c)
+		}
+	}
+	s.ComplianceTests = tests
+}
+
+// truthLog writes the noise-free values of the stations at every update in
+// the csvsink layout, the reference for evaluating a PMU or PDC
+type truthLog struct {
+	file *os.File
+	buf  *bufio.Writer
+	w    *csv.Writer
+	row  []string
+}
+
+// truthPath returns the ground truth file of the configuration with the
+// given CFGCNT, path itself for the first one
+func truthPath(path string, cfgCnt uint16) string {
+	if cfgCnt <= 1 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), cfgCnt, ext)
+}
+
+// newTruthLog creates the ground truth file at path for the stations
+func newTruthLog(path string, stations []*stationState) (*truthLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ground truth file: %w", err)
+	}
+	l := &truthLog{file: f, buf: bufio.NewWriter(f)}
+	l.w = csv.NewWriter(l.buf)
+
+	columns := []string{"time"}
+	for _, st := range stations {
+		stn := st.cfg.Name
+		columns = append(columns, stn+".freq", stn+".rocof")
+		for _, ph := range st.cfg.Phasors {
+			columns = append(columns, stn+"."+ph.Name+".mag", stn+"."+ph.Name+".ang")
+		}
+	}
+	if err := l.w.Write(columns); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// write appends the ground truth of the stations at t
+func (l *truthLog) write(t time.Time, stations []*stationState) error {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	l.row = append(l.row[:0], t.UTC().Format(time.RFC3339Nano))
+	for _, st := range stations {
+		l.row = append(l.row, format(st.truth.freq), format(st.truth.rocof))
+		for _, ph := range st.truth.phasors {
+			l.row = append(l.row, format(cmplx.Abs(ph)), format(cmplx.Phase(ph)*180/math.Pi))
+		}
+	}
+	if err := l.w.Write(l.row); err != nil {
+		return err
+	}
+	l.w.Flush()
+	if err := l.w.Error(); err != nil {
+		return err
+	}
+	return l.buf.Flush()
+}
+
+// Close closes the ground truth file
+func (l *truthLog) Close() error {
+	l.w.Flush()
+	if err := l.buf.Flush(); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
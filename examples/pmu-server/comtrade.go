@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/comtrade"
+	"github.com/JSchlarb/synchrophasor/softpmu"
+)
+
+// loadComtrade resamples a COMTRADE record to rate reports per second. The
+// waveforms among its analog channels are estimated as P class phasors
+// "<name>.mag" and "<name>.ang" with the frequency and ROCOF of the first
+// voltage waveform, the other analog and digital channels are sampled at
+// the report times.
+func loadComtrade(pc PlaybackConfig, rate int, nominal float64) (*recording, error) {
+	record, err := comtrade.Load(pc.File)
+	if err != nil {
+		return nil, err
+	}
+	if len(record.Samples) == 0 {
+		return nil, fmt.Errorf("%s has no samples", pc.File)
+	}
+	if record.LineFreq == 50 || record.LineFreq == 60 {
+		nominal = record.LineFreq
+	}
+
+	rec := &recording{columns: make(map[string]int), loop: pc.Loop}
+	waveforms := make([]int, len(pc.Waveforms))
+	for i, name := range pc.Waveforms {
+		if waveforms[i] = record.AnalogIndex(name); waveforms[i] < 0 {
+			return nil, fmt.Errorf("%s has no analog channel %q", pc.File, name)
+		}
+		rec.columns[name+".mag"] = 2 * i
+		rec.columns[name+".ang"] = 2*i + 1
+	}
+	width := 2 * len(waveforms)
+	if len(waveforms) > 0 {
+		rec.columns["freq"], rec.columns["rocof"] = width, width+1
+		width += 2
+	}
+	sampled := width
+	var analogs []int
+	for i, ch := range record.Analog {
+		if !slices.Contains(waveforms, i) {
+			analogs = append(analogs, i)
+			rec.columns[strings.TrimSpace(ch.Name)] = width
+			width++
+		}
+	}
+	for _, ch := range record.Digital {
+		rec.columns[strings.TrimSpace(ch.Name)] = width
+		width++
+	}
+
+	// addRow adds the report at offset with the estimated phasors of m
+	addRow := func(offset time.Duration, m *synchrophasor.Measurements) {
+		row := make([]float64, width)
+		if m != nil {
+			st := &m.Stations[0]
+			for i, p := range st.Phasors {
+				row[2*i], row[2*i+1] = cmplx.Abs(p), cmplx.Phase(p)*180/math.Pi
+			}
+			row[2*len(st.Phasors)], row[2*len(st.Phasors)+1] = float64(st.Frequency), float64(st.ROCOF)
+		}
+		sample := record.SampleAt(offset)
+		column := sampled
+		for _, i := range analogs {
+			row[column] = sample.Analog[i]
+			column++
+		}
+		for _, v := range sample.Digital {
+			if v {
+				row[column] = 1
+			}
+			column++
+		}
+		rec.times = append(rec.times, offset.Seconds())
+		rec.rows = append(rec.rows, row)
+	}
+
+	if len(waveforms) == 0 {
+		period := time.Second / time.Duration(rate)
+		for offset := time.Duration(0); offset <= record.Duration(); offset += period {
+			addRow(offset, nil)
+		}
+	} else if err := estimate(record, waveforms, rate, nominal, addRow); err != nil {
+		return nil, fmt.Errorf("%s: %w", pc.File, err)
+	}
+	if len(rec.rows) == 0 {
+		return nil, fmt.Errorf("%s is too short for a report", pc.File)
+	}
+
+	// Reports start once the first filter window is complete
+	first := rec.times[0]
+	for i := range rec.times {
+		rec.times[i] -= first
+	}
+	rec.span = float64(len(rec.times)) / float64(rate)
+	return rec, nil
+}
+
+// estimate passes the waveforms of a record through a soft PMU, calling fn
+// with every report and its offset from the record start
+func estimate(record *comtrade.Record, waveforms []int, rate int, nominal float64,
+	fn func(offset time.Duration, m *synchrophasor.Measurements)) error {
+	sampleRate := 0.0
+	if len(record.SampleRates) > 0 {
+		sampleRate = record.SampleRates[0].Rate
+	}
+	if sampleRate <= 0 && len(record.Samples) > 1 {
+		sampleRate = 1 / (record.Samples[1].Time - record.Samples[0].Time).Seconds()
+	}
+
+	opts := softpmu.Options{
+		Station:    "COMTRADE",
+		SampleRate: sampleRate,
+		Nominal:    nominal,
+		Rate:       rate,
+		Class:      softpmu.ClassP,
+	}
+	frequency := -1
+	for i, index := range waveforms {
+		ch := record.Analog[index]
+		unit := uint8(synchrophasor.PhunitVoltage)
+		if strings.HasSuffix(strings.TrimSpace(ch.Unit), "A") {
+			unit = synchrophasor.PhunitCurrent
+		} else if frequency < 0 {
+			frequency = i
+		}
+		opts.Channels = append(opts.Channels, softpmu.Channel{Name: fmt.Sprintf("W%d", i), Unit: unit})
+	}
+	opts.FrequencyChannel = max(frequency, 0)
+
+	est, err := softpmu.New(opts)
+	if err != nil {
+		return err
+	}
+	// The record starts at the epoch so report times are offsets
+	values := make([]float64, len(waveforms))
+	for _, s := range record.Samples {
+		for i, index := range waveforms {
+			values[i] = s.Analog[index]
+		}
+		err := est.Write(time.Unix(0, 0).Add(s.Time), values, func(m *synchrophasor.Measurements) error {
+			fn(time.Duration(math.Round(m.Time*1e9)), m)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,11 +14,16 @@ import (
 
 // PhasorDefinition contains all information for a single phasor channel
 type PhasorDefinition struct {
-	Name       string  `mapstructure:"name"`
-	Type       uint8   `mapstructure:"type"` //0 = Voltage, 1= current
-	Scale      uint32  `mapstructure:"scale"`
-	PhaseAngle float64 `mapstructure:"phase_angle"` // in radians
-	BaseValue  string  `mapstructure:"base_value"`  // "voltage" or "current"
+	Name       string            `mapstructure:"name"`
+	Type       uint8             `mapstructure:"type"` //0 = Voltage, 1= current
+	Scale      uint32            `mapstructure:"scale"`
+	PhaseAngle float64           `mapstructure:"phase_angle"` // in radians
+	BaseValue  string            `mapstructure:"base_value"`  // "voltage" or "current"
+	Magnitude  float64           `mapstructure:"magnitude"`   // relative to the base, 1 if unset
+	Faults     []FaultDefinition `mapstructure:"faults"`
+	Modulation Modulation        `mapstructure:"modulation"`
+	// Load derives a current from a voltage and the power drawn
+	Load PhasorLoad `mapstructure:"load"`
 }
 
 // AnalogChannel represents an analog channel configuration
@@ -38,6 +44,44 @@ type DigitalChannel struct {
 	Interval     string `mapstructure:"interval"`
 }
 
+// StationConfig holds the channels and signal parameters of a PMU station
+// in the served stream. Zero bases and variations are taken from the pmu
+// section.
+type StationConfig struct {
+	Name               string             `mapstructure:"name"`
+	ID                 uint16             `mapstructure:"id"`
+	VoltageBase        float64            `mapstructure:"voltage_base"`
+	CurrentBase        float64            `mapstructure:"current_base"`
+	FrequencyBase      float64            `mapstructure:"frequency_base"`
+	VoltageVariation   float64            `mapstructure:"voltage_variation"`
+	CurrentVariation   float64            `mapstructure:"current_variation"`
+	FrequencyVariation float64            `mapstructure:"frequency_variation"`
+	DFreqVariation     float64            `mapstructure:"dfreq_variation"`
+	Phasors            []PhasorDefinition `mapstructure:"phasors"`
+	AnalogChannels     []AnalogChannel    `mapstructure:"analog_channels"`
+	DigitalChannels    []DigitalChannel   `mapstructure:"digital_channels"`
+	// ThreePhaseSets add their phasors after the individual ones
+	ThreePhaseSets []ThreePhaseSet `mapstructure:"three_phase_sets"`
+	// FrequencyExcursions shift the frequency and rotate all phasors
+	FrequencyExcursions []FrequencyExcursion `mapstructure:"frequency_excursions"`
+	// Oscillations superimpose damped modes on the angles and frequency
+	Oscillations []Oscillation `mapstructure:"oscillations"`
+	// AngleDrift rotates all phasors in degrees per second, as a slight
+	// frequency offset, and AngleRamps move them between setpoints
+	AngleDrift float64     `mapstructure:"angle_drift"`
+	AngleRamps []AngleRamp `mapstructure:"angle_ramps"`
+	// BreakerTrips drop the currents of open breakers and perturb the
+	// frequency on their operation
+	BreakerTrips []BreakerTrip `mapstructure:"breaker_trips"`
+	// ComplianceTests apply the step and ramp test signals of C37.118.1
+	ComplianceTests []ComplianceTest `mapstructure:"compliance_tests"`
+	// StatEvents set STAT flags for a while
+	StatEvents []StatEvent `mapstructure:"stat_events"`
+	// LoadProfile scales the currents and powers over the day, taken from
+	// the pmu section unless enabled
+	LoadProfile LoadProfile `mapstructure:"load_profile"`
+}
+
 // Config holds the PMU configuration
 type Config struct {
 	PMU struct {
@@ -65,67 +109,125 @@ type Config struct {
 			AnalogFloat bool `mapstructure:"analog_float"`
 			FreqFloat   bool `mapstructure:"freq_float"`
 		} `mapstructure:"data_format"`
-		Phasors         []PhasorDefinition `mapstructure:"phasors"`
-		AnalogChannels  []AnalogChannel    `mapstructure:"analog_channels"`
-		DigitalChannels []DigitalChannel   `mapstructure:"digital_channels"`
-		Header          string             `mapstructure:"header"`
-		LogLevel        string             `mapstructure:"log_level"`
+		TLS struct {
+			Enabled  bool   `mapstructure:"enabled"`
+			Port     int    `mapstructure:"port"`
+			CertFile string `mapstructure:"cert_file"`
+			KeyFile  string `mapstructure:"key_file"`
+		} `mapstructure:"tls"`
+		// Phasors, channels, excursions and oscillations of a single station
+		// stream, used unless Stations is set
+		Phasors             []PhasorDefinition   `mapstructure:"phasors"`
+		ThreePhaseSets      []ThreePhaseSet      `mapstructure:"three_phase_sets"`
+		AnalogChannels      []AnalogChannel      `mapstructure:"analog_channels"`
+		DigitalChannels     []DigitalChannel     `mapstructure:"digital_channels"`
+		FrequencyExcursions []FrequencyExcursion `mapstructure:"frequency_excursions"`
+		Oscillations        []Oscillation        `mapstructure:"oscillations"`
+		AngleDrift          float64              `mapstructure:"angle_drift"`
+		AngleRamps          []AngleRamp          `mapstructure:"angle_ramps"`
+		LoadProfile         LoadProfile          `mapstructure:"load_profile"`
+		BreakerTrips        []BreakerTrip        `mapstructure:"breaker_trips"`
+		ComplianceTests     []ComplianceTest     `mapstructure:"compliance_tests"`
+		StatEvents          []StatEvent          `mapstructure:"stat_events"`
+		// Stations lists the stations of the stream (NUM_PMU > 1), e.g. to
+		// simulate the output of a PDC
+		Stations []StationConfig `mapstructure:"stations"`
+		GPSLoss  GPSLoss         `mapstructure:"gps_loss"`
+		// Clock offsets and drifts the frame timestamps
+		Clock ClockSkew `mapstructure:"clock"`
+		// Playback replays recorded values instead of the synthetic ones
+		Playback PlaybackConfig `mapstructure:"playback"`
+		// Fleet serves copies of the stream on consecutive ports
+		Fleet FleetConfig `mapstructure:"fleet"`
+		// GroundTruth is the CSV file logging the values without noise at
+		// every data frame, empty for none
+		GroundTruth string `mapstructure:"ground_truth"`
+		// SOELog is the CSV file logging the digital transitions with the
+		// time of the first frame carrying them, empty for none
+		SOELog string `mapstructure:"soe_log"`
+		// Seed makes runs reproducible, deriving the noise and network
+		// impairment from it and snapping the updates to their interval;
+		// 0 for random runs
+		Seed int64 `mapstructure:"seed"`
+		// Network degrades the output to the PDCs
+		Network NetworkImpairment `mapstructure:"network"`
+		// UDP serves the stream over UDP in addition to or instead of TCP
+		UDP UDPConfig `mapstructure:"udp"`
+		// Dashboard serves a live web UI at /dashboard/ on the metrics port
+		Dashboard bool `mapstructure:"dashboard"`
+		// WatchConfig reloads the configuration on file changes, as SIGHUP
+		// does
+		WatchConfig bool   `mapstructure:"watch_config"`
+		Header      string `mapstructure:"header"`
+		LogLevel    string `mapstructure:"log_level"`
 	} `mapstructure:"pmu"`
 }
 
-// GetPhasorCount returns the number of phasor channels
+// GetPhasorCount returns the number of phasor channels of all stations
 func (c *Config) GetPhasorCount() int {
-	return len(c.PMU.Phasors)
+	n := 0
+	for _, st := range c.PMU.Stations {
+		n += len(st.Phasors)
+	}
+	return n
 }
 
-// GetAnalogCount returns the number of analog channels
+// GetAnalogCount returns the number of analog channels of all stations
 func (c *Config) GetAnalogCount() int {
-	return len(c.PMU.AnalogChannels)
+	n := 0
+	for _, st := range c.PMU.Stations {
+		n += len(st.AnalogChannels)
+	}
+	return n
 }
 
-// GetDigitalCount returns the number of digital channels
+// GetDigitalCount returns the number of digital channels of all stations
 func (c *Config) GetDigitalCount() int {
-	return len(c.PMU.DigitalChannels)
+	n := 0
+	for _, st := range c.PMU.Stations {
+		n += len(st.DigitalChannels)
+	}
+	return n
 }
 
 // GetDigitalWordCount returns the number of 16-bit words needed for digital channels
-func (c *Config) GetDigitalWordCount() int {
-	if len(c.PMU.DigitalChannels) == 0 {
+func (s *StationConfig) GetDigitalWordCount() int {
+	if len(s.DigitalChannels) == 0 {
 		return 0
 	}
 	// Calculate how many 16-bit words are needed
-	return (len(c.PMU.DigitalChannels) + 15) / 16
+	return (len(s.DigitalChannels) + 15) / 16
 }
 
 // GetBaseValue returns the base value for a phasor based on its type
-func (c *Config) GetBaseValue(phasor PhasorDefinition) float64 {
+func (s *StationConfig) GetBaseValue(phasor PhasorDefinition) float64 {
 	switch phasor.BaseValue {
 	case "voltage":
-		return c.PMU.VoltageBase
+		return s.VoltageBase
 	case "current":
-		return c.PMU.CurrentBase
+		return s.CurrentBase
 	default:
 		// Fallback to type-based detection
 		if phasor.Type == 0 {
-			return c.PMU.VoltageBase
+			return s.VoltageBase
 		}
-		return c.PMU.CurrentBase
+		return s.CurrentBase
 	}
 }
 
 // GetVariation returns the variation for a phasor based on its type
-func (c *Config) GetVariation(phasor PhasorDefinition) float64 {
+func (s *StationConfig) GetVariation(phasor PhasorDefinition) float64 {
 	switch phasor.BaseValue {
 	case "voltage":
-		return c.PMU.VoltageVariation
+		return s.VoltageVariation
 	case "current":
-		return c.PMU.CurrentVariation
+		return s.CurrentVariation
 	default:
 		// Fallback to type-based detection
 		if phasor.Type == 0 {
-			return c.PMU.VoltageVariation
+			return s.VoltageVariation
 		}
-		return c.PMU.CurrentVariation
+		return s.CurrentVariation
 	}
 }
 
@@ -162,6 +264,8 @@ func loadConfig() (*Config, error) {
 	_ = viper.BindEnv("pmu.log_level")
 	_ = viper.BindEnv("pmu.id")
 	_ = viper.BindEnv("pmu.increment_id")
+	_ = viper.BindEnv("pmu.fleet.size")
+	_ = viper.BindEnv("pmu.playback.file")
 
 	// Set defaults
 	viper.SetDefault("pmu.dropTicks", true)
@@ -171,6 +275,8 @@ func loadConfig() (*Config, error) {
 	viper.SetDefault("pmu.id", 1)
 	viper.SetDefault("pmu.increment_id", 0)
 	viper.SetDefault("pmu.port", 4712)
+	viper.SetDefault("pmu.tls.enabled", false)
+	viper.SetDefault("pmu.tls.port", 4713)
 	viper.SetDefault("pmu.metrics_port", 9090)
 	viper.SetDefault("pmu.voltage_base", 230)
 	viper.SetDefault("pmu.current_base", 2000)
@@ -184,8 +290,23 @@ func loadConfig() (*Config, error) {
 	viper.SetDefault("pmu.log_level", "INFO")
 	viper.SetDefault("pmu.header", "PMU Simulator")
 	viper.SetDefault("pmu.phasors", []PhasorDefinition{})
+	viper.SetDefault("pmu.three_phase_sets", []ThreePhaseSet{})
 	viper.SetDefault("pmu.analog_channels", []AnalogChannel{})
 	viper.SetDefault("pmu.digital_channels", []DigitalChannel{})
+	viper.SetDefault("pmu.frequency_excursions", []FrequencyExcursion{})
+	viper.SetDefault("pmu.oscillations", []Oscillation{})
+	viper.SetDefault("pmu.angle_ramps", []AngleRamp{})
+	viper.SetDefault("pmu.breaker_trips", []BreakerTrip{})
+	viper.SetDefault("pmu.stat_events", []StatEvent{})
+	viper.SetDefault("pmu.stations", []StationConfig{})
+	viper.SetDefault("pmu.gps_loss.enabled", false)
+	viper.SetDefault("pmu.load_profile.enabled", false)
+	viper.SetDefault("pmu.load_profile.day_length", "24h")
+	viper.SetDefault("pmu.playback.loop", true)
+	viper.SetDefault("pmu.udp.config_interval", "1m")
+	viper.SetDefault("pmu.fleet.size", 1)
+	viper.SetDefault("pmu.fleet.variation", 0.02)
+	viper.SetDefault("pmu.fleet.angle_spread", 5)
 
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
@@ -197,8 +318,91 @@ func loadConfig() (*Config, error) {
 		cfg.PMU.Name = fmt.Sprintf("%s_%d", cfg.PMU.NamePrefix, cfg.PMU.ID)
 	}
 
-	for i := range cfg.PMU.DigitalChannels {
-		ch := &cfg.PMU.DigitalChannels[i]
+	if len(cfg.PMU.Stations) == 0 {
+		cfg.PMU.Stations = []StationConfig{{
+			Name:                cfg.PMU.Name,
+			ID:                  cfg.PMU.ID,
+			Phasors:             cfg.PMU.Phasors,
+			ThreePhaseSets:      cfg.PMU.ThreePhaseSets,
+			AnalogChannels:      cfg.PMU.AnalogChannels,
+			DigitalChannels:     cfg.PMU.DigitalChannels,
+			FrequencyExcursions: cfg.PMU.FrequencyExcursions,
+			Oscillations:        cfg.PMU.Oscillations,
+			AngleDrift:          cfg.PMU.AngleDrift,
+			AngleRamps:          cfg.PMU.AngleRamps,
+			LoadProfile:         cfg.PMU.LoadProfile,
+			BreakerTrips:        cfg.PMU.BreakerTrips,
+			ComplianceTests:     cfg.PMU.ComplianceTests,
+			StatEvents:          cfg.PMU.StatEvents,
+		}}
+	}
+	for i := range cfg.PMU.Stations {
+		cfg.applyDefaults(&cfg.PMU.Stations[i], i)
+		cfg.PMU.Stations[i].expandSets()
+		cfg.PMU.Stations[i].validate()
+	}
+
+	if g := &cfg.PMU.GPSLoss; g.Enabled && !validDurations("setting", "gps_loss", g.Start, g.Duration, g.Period) {
+		g.Enabled = false
+	}
+
+	if c := &cfg.PMU.Clock; c.Enabled && !validDurations("setting", "clock", c.Offset) {
+		c.Enabled = false
+	}
+
+	if n := &cfg.PMU.Network; n.Enabled && !validDurations("setting", "network", n.Latency, n.Jitter) {
+		n.Enabled = false
+	}
+
+	if err := cfg.PMU.UDP.validate(); err != nil {
+		return nil, err
+	}
+
+	if f := cfg.PMU.Fleet; f.Size > 1 && cfg.PMU.TLS.Enabled &&
+		cfg.PMU.TLS.Port < cfg.PMU.Port+f.Size && cfg.PMU.Port < cfg.PMU.TLS.Port+f.Size {
+		return nil, fmt.Errorf("TLS ports %d-%d of the fleet overlap the ports %d-%d",
+			cfg.PMU.TLS.Port, cfg.PMU.TLS.Port+f.Size-1, cfg.PMU.Port, cfg.PMU.Port+f.Size-1)
+	}
+
+	return &cfg, nil
+}
+
+// applyDefaults fills the unset name, ID, bases, variations and load
+// profile of the station at index i from the pmu section
+func (c *Config) applyDefaults(s *StationConfig, i int) {
+	if s.ID == 0 {
+		s.ID = c.PMU.ID + uint16(i)
+	}
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("%s_%d", c.PMU.NamePrefix, s.ID)
+	}
+	if !s.LoadProfile.Enabled {
+		s.LoadProfile = c.PMU.LoadProfile
+	}
+	for _, v := range []struct {
+		value    *float64
+		fallback float64
+	}{
+		{&s.VoltageBase, c.PMU.VoltageBase},
+		{&s.CurrentBase, c.PMU.CurrentBase},
+		{&s.FrequencyBase, c.PMU.FrequencyBase},
+		{&s.VoltageVariation, c.PMU.VoltageVariation},
+		{&s.CurrentVariation, c.PMU.CurrentVariation},
+		{&s.FrequencyVariation, c.PMU.FrequencyVariation},
+		{&s.DFreqVariation, c.PMU.DFreqVariation},
+	} {
+		if *v.value == 0 {
+			*v.value = v.fallback
+		}
+	}
+}
+
+// validate disables the invalid intervals, faults, excursions, oscillations,
+// modulations, angle ramps, breaker trips, compliance tests and load profile
+// of a station with a warning
+func (s *StationConfig) validate() {
+	for i := range s.DigitalChannels {
+		ch := &s.DigitalChannels[i]
 		if ch.Interval == "" {
 			ch.Interval = "0s"
 		}
@@ -208,5 +412,52 @@ func loadConfig() (*Config, error) {
 		}
 	}
 
-	return &cfg, nil
+	for i := range s.Phasors {
+		ph := &s.Phasors[i]
+		faults := ph.Faults[:0]
+		for _, f := range ph.Faults {
+			if f.Type != "sag" && f.Type != "swell" {
+				log.WithField("phasor", ph.Name).Warnf("Unknown fault type %q, disabling it", f.Type)
+				continue
+			}
+			if validDurations("phasor", ph.Name, f.Start, f.Duration, f.Period) {
+				faults = append(faults, f)
+			}
+		}
+		ph.Faults = faults
+		ph.validateModulation()
+	}
+	s.validateLoads()
+
+	excursions := s.FrequencyExcursions[:0]
+	for i, e := range s.FrequencyExcursions {
+		if validDurations("excursion", s.Name+"/"+strconv.Itoa(i), e.Start, e.Onset, e.Hold, e.Recovery, e.Period) {
+			excursions = append(excursions, e)
+		}
+	}
+	s.FrequencyExcursions = excursions
+
+	oscillations := s.Oscillations[:0]
+	for i, o := range s.Oscillations {
+		if validDurations("oscillation", s.Name+"/"+strconv.Itoa(i), o.Start, o.Duration, o.Period) {
+			oscillations = append(oscillations, o)
+		}
+	}
+	s.Oscillations = oscillations
+
+	ramps := s.AngleRamps[:0]
+	for i, r := range s.AngleRamps {
+		if validDurations("angle_ramp", s.Name+"/"+strconv.Itoa(i), r.Start, r.Duration, r.Period) {
+			ramps = append(ramps, r)
+		}
+	}
+	s.AngleRamps = ramps
+
+	s.validateTrips()
+	s.validateComplianceTests()
+	s.validateStatEvents()
+
+	if l := &s.LoadProfile; l.Enabled && !validDurations("load_profile", s.Name, l.DayLength) {
+		l.Enabled = false
+	}
 }
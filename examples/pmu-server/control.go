@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// activeFault is a sag or swell triggered through the control API
+type activeFault struct {
+	phasors []int
+	factor  float64
+	// until is the end in seconds since the simulator start
+	until float64
+}
+
+// stationParameters is the state of a station returned by the control API
+type stationParameters struct {
+	Name               string          `json:"name"`
+	ID                 uint16          `json:"id"`
+	Frequency          float64         `json:"frequency"`
+	VoltageVariation   float64         `json:"voltage_variation"`
+	CurrentVariation   float64         `json:"current_variation"`
+	FrequencyVariation float64         `json:"frequency_variation"`
+	DFreqVariation     float64         `json:"dfreq_variation"`
+	Digitals           map[string]bool `json:"digitals"`
+	ActiveFaults       int             `json:"active_faults"`
+}
+
+// frequencyRequest sets the frequency, zero returns to the base
+type frequencyRequest struct {
+	Frequency float64 `json:"frequency"`
+}
+
+// faultRequest triggers a sag or swell on the given phasors, all voltages
+// if none
+type faultRequest struct {
+	Type     string   `json:"type"`
+	Depth    float64  `json:"depth"`
+	Duration string   `json:"duration"`
+	Phasors  []string `json:"phasors"`
+}
+
+// digitalRequest sets a digital channel
+type digitalRequest struct {
+	Value bool `json:"value"`
+}
+
+// noiseRequest changes the given variations
+type noiseRequest struct {
+	VoltageVariation   *float64 `json:"voltage_variation"`
+	CurrentVariation   *float64 `json:"current_variation"`
+	FrequencyVariation *float64 `json:"frequency_variation"`
+	DFreqVariation     *float64 `json:"dfreq_variation"`
+}
+
+// controlHandler serves
+//
+//	GET  /stations/{id}                  signal parameters of a station
+//	PUT  /stations/{id}/frequency        {"frequency": 49.8}, 0 for the base
+//	POST /stations/{id}/faults           {"type": "sag", "depth": 0.3, "duration": "200ms", "phasors": ["VA"]}
+//	PUT  /stations/{id}/digitals/{name}  {"value": false}
+//	PUT  /stations/{id}/noise            {"voltage_variation": 0.01, ...}
+//
+// Every request returns the resulting parameters of the station.
+func (s *simulator) controlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stations/{id}", s.station(func(*http.Request, *stationState) error { return nil }))
+	mux.HandleFunc("PUT /stations/{id}/frequency", s.station(s.setFrequency))
+	mux.HandleFunc("POST /stations/{id}/faults", s.station(s.triggerFault))
+	mux.HandleFunc("PUT /stations/{id}/digitals/{name}", s.station(s.setDigital))
+	mux.HandleFunc("PUT /stations/{id}/noise", s.station(s.setNoise))
+	return mux
+}
+
+// station returns a handler applying fn to the station named by the path
+// under the simulator lock and writing its parameters
+func (s *simulator) station(fn func(r *http.Request, st *stationState) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 16)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid station ID")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		i := slices.IndexFunc(s.stations, func(st *stationState) bool { return st.cfg.ID == uint16(id) })
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "unknown station")
+			return
+		}
+		st := s.stations[i]
+		if err := fn(r, st); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if r.Method != http.MethodGet {
+			log.WithFields(log.Fields{
+				"station": st.cfg.Name,
+				"request": r.Method + " " + r.URL.Path,
+			}).Info("Changed simulation by control API")
+		}
+		writeJSON(w, http.StatusOK, st.parameters())
+	}
+}
+
+// setFrequency sets the frequency of a station
+func (s *simulator) setFrequency(r *http.Request, st *stationState) error {
+	var req frequencyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	if req.Frequency < 0 {
+		return fmt.Errorf("negative frequency %g", req.Frequency)
+	}
+	st.frequencyOffset = 0
+	if req.Frequency > 0 {
+		st.frequencyOffset = req.Frequency - st.cfg.FrequencyBase
+	}
+	return nil
+}
+
+// triggerFault starts a sag or swell on a station now
+func (s *simulator) triggerFault(r *http.Request, st *stationState) error {
+	var req faultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		return err
+	}
+
+	f := activeFault{until: time.Since(s.startTime).Seconds() + duration.Seconds()}
+	switch req.Type {
+	case "sag":
+		f.factor = 1 - req.Depth
+	case "swell":
+		f.factor = 1 + req.Depth
+	default:
+		return fmt.Errorf("unknown fault type %q", req.Type)
+	}
+	for _, name := range req.Phasors {
+		if !slices.ContainsFunc(st.cfg.Phasors, func(ph PhasorDefinition) bool { return ph.Name == name }) {
+			return fmt.Errorf("unknown phasor %q", name)
+		}
+	}
+	for i, ph := range st.cfg.Phasors {
+		if slices.Contains(req.Phasors, ph.Name) || len(req.Phasors) == 0 && !ph.isCurrent() {
+			f.phasors = append(f.phasors, i)
+		}
+	}
+	st.faults = append(st.faults, f)
+	return nil
+}
+
+// setDigital sets a digital channel of a station
+func (s *simulator) setDigital(r *http.Request, st *stationState) error {
+	var req digitalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	name := r.PathValue("name")
+	i := slices.IndexFunc(st.cfg.DigitalChannels, func(ch DigitalChannel) bool { return ch.Name == name })
+	if i < 0 {
+		return fmt.Errorf("unknown digital channel %q", name)
+	}
+	if state := &st.digitalStates[i]; state.CurrentValue != req.Value {
+		state.CurrentValue = req.Value
+		state.LastChange = time.Now()
+	}
+	return nil
+}
+
+// setNoise changes the variations of a station
+func (s *simulator) setNoise(r *http.Request, st *stationState) error {
+	var req noiseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return err
+	}
+	variations := []struct {
+		value  *float64
+		target *float64
+	}{
+		{req.VoltageVariation, &st.cfg.VoltageVariation},
+		{req.CurrentVariation, &st.cfg.CurrentVariation},
+		{req.FrequencyVariation, &st.cfg.FrequencyVariation},
+		{req.DFreqVariation, &st.cfg.DFreqVariation},
+	}
+	for _, v := range variations {
+		if v.value != nil && *v.value < 0 {
+			return fmt.Errorf("negative variation %g", *v.value)
+		}
+	}
+	for _, v := range variations {
+		if v.value != nil {
+			*v.target = *v.value
+		}
+	}
+	return nil
+}
+
+// parameters returns the signal parameters of a station
+func (s *stationState) parameters() stationParameters {
+	sc := s.cfg
+	p := stationParameters{
+		Name:               sc.Name,
+		ID:                 sc.ID,
+		Frequency:          sc.FrequencyBase + s.frequencyOffset,
+		VoltageVariation:   sc.VoltageVariation,
+		CurrentVariation:   sc.CurrentVariation,
+		FrequencyVariation: sc.FrequencyVariation,
+		DFreqVariation:     sc.DFreqVariation,
+		Digitals:           make(map[string]bool, len(sc.DigitalChannels)),
+		ActiveFaults:       len(s.faults),
+	}
+	for i, ch := range sc.DigitalChannels {
+		p.Digitals[ch.Name] = s.digitalStates[i].CurrentValue
+	}
+	return p
+}
+
+// writeJSON writes v with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error message
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// dashboardPage plots the WebSocket stream served next to it
+//
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// serveDashboard serves the live dashboard page
+func serveDashboard(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(dashboardPage)
+}
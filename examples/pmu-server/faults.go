@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FaultDefinition describes a recurring voltage sag or swell of a phasor
+type FaultDefinition struct {
+	Type     string  `mapstructure:"type"`     // "sag" or "swell"
+	Depth    float64 `mapstructure:"depth"`    // magnitude change as fraction of the base, e.g. 0.3
+	Start    string  `mapstructure:"start"`    // offset from the simulator start, e.g. "10s"
+	Duration string  `mapstructure:"duration"` // e.g. "200ms"
+	Period   string  `mapstructure:"period"`   // repetition interval, "0s" for once
+}
+
+// FrequencyExcursion describes a frequency deviation from the base with its
+// onset, hold and recovery
+type FrequencyExcursion struct {
+	Deviation    float64 `mapstructure:"deviation"`     // Hz, negative for under-frequency
+	Start        string  `mapstructure:"start"`         // offset from the simulator start
+	Onset        string  `mapstructure:"onset"`         // linear change to the deviation
+	Hold         string  `mapstructure:"hold"`          // time at the deviation
+	Recovery     string  `mapstructure:"recovery"`      // time back to the base
+	RecoveryType string  `mapstructure:"recovery_type"` // "linear" or "exponential"
+	Period       string  `mapstructure:"period"`        // repetition interval, "0s" for once
+}
+
+// seconds parses a duration in seconds, zero if empty or invalid
+func seconds(s string) float64 {
+	d, _ := time.ParseDuration(s)
+	return d.Seconds()
+}
+
+// validDurations reports whether all non-empty durations parse, warning
+// about the first invalid one
+func validDurations(kind, name string, durations ...string) bool {
+	for _, s := range durations {
+		if s == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			log.WithError(err).WithField(kind, name).Warn("Invalid duration, disabling it")
+			return false
+		}
+	}
+	return true
+}
+
+// cycleTime returns the time since the start of the current repetition at
+// timeOffset seconds since the simulator start, false before the start
+func cycleTime(timeOffset float64, start, period string) (float64, bool) {
+	t := timeOffset - seconds(start)
+	if t < 0 {
+		return 0, false
+	}
+	if p := seconds(period); p > 0 {
+		t = math.Mod(t, p)
+	}
+	return t, true
+}
+
+// magnitudeFactor returns the factor applied to the magnitude of a phasor by
+// its active faults
+func magnitudeFactor(faults []FaultDefinition, timeOffset float64) float64 {
+	factor := 1.0
+	for _, f := range faults {
+		t, ok := cycleTime(timeOffset, f.Start, f.Period)
+		if !ok || t >= seconds(f.Duration) {
+			continue
+		}
+		switch f.Type {
+		case "sag":
+			factor *= 1 - f.Depth
+		case "swell":
+			factor *= 1 + f.Depth
+		}
+	}
+	return factor
+}
+
+// excursionAt returns the frequency deviation in Hz and its rate of change in
+// Hz/s of the active excursions
+func excursionAt(excursions []FrequencyExcursion, timeOffset float64) (float64, float64) {
+	var dev, rate float64
+	for _, e := range excursions {
+		t, ok := cycleTime(timeOffset, e.Start, e.Period)
+		if !ok {
+			continue
+		}
+		onset, hold, recovery := seconds(e.Onset), seconds(e.Hold), seconds(e.Recovery)
+		switch {
+		case t < onset:
+			dev += e.Deviation * t / onset
+			rate += e.Deviation / onset
+		case t < onset+hold:
+			dev += e.Deviation
+		case t < onset+hold+recovery:
+			r := t - onset - hold
+			if e.RecoveryType == "exponential" {
+				// Five time constants settle within 1 %
+				tau := recovery / 5
+				dev += e.Deviation * math.Exp(-r/tau)
+				rate -= e.Deviation / tau * math.Exp(-r/tau)
+			} else {
+				dev += e.Deviation * (1 - r/recovery)
+				rate -= e.Deviation / recovery
+			}
+		}
+	}
+	return dev, rate
+}
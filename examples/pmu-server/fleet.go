@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strings"
+)
+
+// FleetConfig runs several independent PMU servers in one process
+type FleetConfig struct {
+	// Size is the number of servers, one if unset
+	Size int `mapstructure:"size"`
+	// Variation is the relative spread of the voltage and current bases
+	// between the servers, e.g. 0.02
+	Variation float64 `mapstructure:"variation"`
+	// AngleSpread is the spread of the phase angles between the servers in
+	// degrees
+	AngleSpread float64 `mapstructure:"angle_spread"`
+}
+
+// fleet returns the configurations of the servers of the fleet. Server i
+// listens on the port plus i, and its stream and station IDs count up by i
+// and the number of stations. Default names follow the new IDs, others get
+// the server number appended. The bases and angles are varied reproducibly
+// per server.
+func (c *Config) fleet() []*Config {
+	size := max(c.PMU.Fleet.Size, 1)
+	configs := []*Config{c}
+	for i := 1; i < size; i++ {
+		n := *c
+		n.PMU.ID = c.PMU.ID + uint16(i)
+		n.PMU.Port = c.PMU.Port + i
+		n.PMU.TLS.Port = c.PMU.TLS.Port + i
+		n.PMU.UDP = c.PMU.UDP.offset(i)
+		n.PMU.Name = c.fleetName(c.PMU.Name, c.PMU.ID, n.PMU.ID, i)
+		n.PMU.GroundTruth = fleetPath(c.PMU.GroundTruth, n.PMU.ID)
+		n.PMU.SOELog = fleetPath(c.PMU.SOELog, n.PMU.ID)
+
+		rng := rand.New(rand.NewSource(int64(i)))
+		spread := func(v float64) float64 {
+			return v * (1 + c.PMU.Fleet.Variation*(2*rng.Float64()-1))
+		}
+
+		n.PMU.Stations = make([]StationConfig, len(c.PMU.Stations))
+		for j, st := range c.PMU.Stations {
+			id := st.ID + uint16(i*len(c.PMU.Stations))
+			st.Name = c.fleetName(st.Name, st.ID, id, i)
+			st.ID = id
+			st.VoltageBase = spread(st.VoltageBase)
+			st.CurrentBase = spread(st.CurrentBase)
+
+			shift := c.PMU.Fleet.AngleSpread * math.Pi / 180 * (2*rng.Float64() - 1)
+			st.Phasors = append([]PhasorDefinition(nil), st.Phasors...)
+			for k := range st.Phasors {
+				st.Phasors[k].PhaseAngle += shift
+			}
+			n.PMU.Stations[j] = st
+		}
+		configs = append(configs, &n)
+	}
+	return configs
+}
+
+// fleetName returns the name of a stream or station of server i, following
+// the ID if the name is the default one
+func (c *Config) fleetName(name string, id, fleetID uint16, i int) string {
+	if name == fmt.Sprintf("%s_%d", c.PMU.NamePrefix, id) {
+		return fmt.Sprintf("%s_%d", c.PMU.NamePrefix, fleetID)
+	}
+	suffix := fmt.Sprintf("_%d", i)
+	// Station names are limited to 16 characters
+	return name[:min(len(name), 16-len(suffix))] + suffix
+}
+
+// fleetPath returns the log file path of the fleet server with the given ID,
+// empty for no log
+func fleetPath(path string, id uint16) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), id, ext)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// STAT bits of the time synchronization
+const (
+	// statSyncLost flags a PMU not synchronized to the time source
+	statSyncLost = 0x2000
+	// statUnlockedShift positions the unlocked time: 0 below 10 s, 1 below
+	// 100 s, 2 below 1000 s and 3 beyond
+	statUnlockedShift = 4
+	// statTimeQualityShift positions the estimated time error: 1 below
+	// 100 ns up to 7 beyond 10 ms
+	statTimeQualityShift = 6
+)
+
+// holdoverError is the time error assumed right after the loss of the time
+// source, before any drift accumulates
+const holdoverError = 1e-6
+
+// GPSLoss describes a loss of the time source, after which the time quality
+// degrades and the clock optionally drifts
+type GPSLoss struct {
+	Enabled  bool    `mapstructure:"enabled"`
+	Start    string  `mapstructure:"start"`     // offset from the simulator start
+	Duration string  `mapstructure:"duration"`  // "0s" for no recovery
+	Period   string  `mapstructure:"period"`    // repetition interval, "0s" for once
+	DriftPPM float64 `mapstructure:"drift_ppm"` // clock error growth while unlocked, 0 for none
+}
+
+// unlockedAt returns how long the time source has been lost at timeOffset
+// seconds since the simulator start, false while it is locked
+func (g *GPSLoss) unlockedAt(timeOffset float64) (float64, bool) {
+	if !g.Enabled {
+		return 0, false
+	}
+	t, ok := cycleTime(timeOffset, g.Start, g.Period)
+	if !ok {
+		return 0, false
+	}
+	if d := seconds(g.Duration); d > 0 && t >= d {
+		return 0, false
+	}
+	return t, true
+}
+
+// clockError returns the clock error in seconds after being unlocked for t
+func (g *GPSLoss) clockError(t float64) float64 {
+	return g.DriftPPM * 1e-6 * t
+}
+
+// estimate returns the estimated time error in seconds after being unlocked
+// for t
+func (g *GPSLoss) estimate(t float64) float64 {
+	return holdoverError + math.Abs(g.clockError(t))
+}
+
+// timeQuality returns the FRACSEC message time quality code of an estimated
+// time error in seconds while unlocked: code n is within 10^(n-10) s up to
+// 0xB within 10 s, beyond that the clock is unreliable
+func timeQuality(estimate float64) uint8 {
+	code := math.Ceil(math.Log10(estimate)) + 10
+	switch {
+	case code < 1:
+		return 1
+	case code > 0xB:
+		return 0xF
+	}
+	return uint8(code)
+}
+
+// syncStat returns the STAT bits of the time synchronization after being
+// unlocked for t seconds
+func (g *GPSLoss) syncStat(t float64) uint16 {
+	estimate := g.estimate(t)
+	unlocked := uint16(3)
+	switch {
+	case t < 10:
+		unlocked = 0
+	case t < 100:
+		unlocked = 1
+	case t < 1000:
+		unlocked = 2
+	}
+	quality := uint16(7)
+	if estimate < 10e-3 {
+		quality = uint16(max(1, math.Ceil(math.Log10(estimate))+8))
+	}
+	return statSyncLost | unlocked<<statUnlockedShift | quality<<statTimeQualityShift
+}
+
+// clock returns the time stamped at the wall time now with its time quality,
+// start being the simulator start
+func (g *GPSLoss) clock(start, now time.Time) (time.Time, uint8) {
+	t, unlocked := g.unlockedAt(now.Sub(start).Seconds())
+	if !unlocked {
+		return now, 0
+	}
+	stamp := now.Add(time.Duration(g.clockError(t) * float64(time.Second)))
+	return stamp, timeQuality(g.estimate(t))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PhasorLoad derives a current phasor from a voltage phasor of the station
+// and the power drawn, I = conj(S/V), so that the power computed downstream
+// matches the configured one. Voltages are in V and currents in A.
+type PhasorLoad struct {
+	Voltage string  `mapstructure:"voltage"` // voltage phasor, empty for an independent current
+	P       float64 `mapstructure:"p"`       // active power in MW
+	Q       float64 `mapstructure:"q"`       // reactive power in MVAr
+	// PowerFactor sets the reactive power from P if Q is 0, negative for a
+	// leading (capacitive) load
+	PowerFactor float64 `mapstructure:"power_factor"`
+}
+
+// current returns the current drawn at the voltage v with the noise of the
+// given variation, and without
+func (l PhasorLoad) current(rng *rand.Rand, v complex128, variation float64) (complex128, complex128) {
+	if v == 0 {
+		return 0, 0
+	}
+	ideal := cmplx.Conj(complex(l.P, l.Q) * 1e6 / v)
+	return ideal * complex(randomValue(rng, 1, variation), 0), ideal
+}
+
+// loadVoltages returns the index of the voltage of each phasor with a load,
+// -1 for the others
+func (s *StationConfig) loadVoltages() []int {
+	voltages := make([]int, len(s.Phasors))
+	for i, ph := range s.Phasors {
+		voltages[i] = -1
+		if ph.Load.Voltage != "" {
+			voltages[i] = slices.IndexFunc(s.Phasors, func(v PhasorDefinition) bool { return v.Name == ph.Load.Voltage })
+		}
+	}
+	return voltages
+}
+
+// validateLoads disables the loads of a station on voltages or on phasors
+// that are no currents, or naming unknown voltages, and sets the reactive
+// power of those given by their power factor
+func (s *StationConfig) validateLoads() {
+	for i := range s.Phasors {
+		ph := &s.Phasors[i]
+		l := &ph.Load
+		if l.Voltage == "" {
+			continue
+		}
+		j := slices.IndexFunc(s.Phasors, func(v PhasorDefinition) bool { return v.Name == l.Voltage })
+		switch {
+		case !ph.isCurrent():
+			log.WithField("phasor", ph.Name).Warn("Load on a voltage phasor, disabling it")
+			*l = PhasorLoad{}
+			continue
+		case j < 0 || s.Phasors[j].isCurrent():
+			log.WithField("phasor", ph.Name).Warnf("Unknown voltage phasor %q, disabling the load", l.Voltage)
+			*l = PhasorLoad{}
+			continue
+		}
+		if pf := l.PowerFactor; pf != 0 {
+			if math.Abs(pf) > 1 {
+				log.WithField("phasor", ph.Name).Warnf("Power factor %g beyond 1, using 1", pf)
+				pf = math.Copysign(1, pf)
+			}
+			if l.Q != 0 {
+				log.WithField("phasor", ph.Name).Warn("Both q and power_factor set, using q")
+				continue
+			}
+			l.Q = math.Copysign(l.P*math.Tan(math.Acos(math.Abs(pf))), pf)
+		}
+	}
+}
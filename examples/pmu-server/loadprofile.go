@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultLoadCurve is a typical daily load relative to the base by hour,
+// low at night with morning and evening peaks
+var defaultLoadCurve = []float64{
+	0.55, 0.50, 0.48, 0.47, 0.48, 0.55, 0.70, 0.85, 0.95, 1.00, 1.00, 0.98,
+	0.95, 0.93, 0.92, 0.93, 0.97, 1.05, 1.10, 1.05, 0.95, 0.80, 0.68, 0.60,
+}
+
+// powerUnits are the analog channel units following the load
+var powerUnits = []string{"w", "kw", "mw", "var", "kvar", "mvar", "va", "kva", "mva"}
+
+// LoadProfile scales the current phasors and the power analog channels
+// along a daily load curve
+type LoadProfile struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Curve holds the load relative to the base at evenly spaced times of
+	// the day, interpolated linearly; a typical curve by hour if empty
+	Curve []float64 `mapstructure:"curve"`
+	// DayLength compresses the day, e.g. "1h", defaults to "24h". The day
+	// follows the local wall clock, scaled by the compression.
+	DayLength string `mapstructure:"day_length"`
+	// Noise is the relative variation of the load per channel
+	Noise float64 `mapstructure:"noise"`
+}
+
+// factor returns the load relative to the base at t
+func (l *LoadProfile) factor(t time.Time) float64 {
+	if !l.Enabled {
+		return 1
+	}
+	curve := l.Curve
+	if len(curve) == 0 {
+		curve = defaultLoadCurve
+	}
+
+	day := 24 * time.Hour.Seconds()
+	if length := seconds(l.DayLength); length > 0 {
+		day = length
+	}
+	_, zone := t.Zone()
+	local := float64(t.UnixNano())/1e9 + float64(zone)
+	position := math.Mod(local, day) / day * float64(len(curve))
+
+	i := int(position) % len(curve)
+	next := curve[(i+1)%len(curve)]
+	return curve[i] + (next-curve[i])*(position-math.Floor(position))
+}
+
+// isPowerUnit reports whether an analog channel unit is a power
+func isPowerUnit(unit string) bool {
+	for _, u := range powerUnits {
+		if strings.EqualFold(unit, u) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCurrent reports whether a phasor is a current, following GetBaseValue
+func (p PhasorDefinition) isCurrent() bool {
+	switch p.BaseValue {
+	case "voltage":
+		return false
+	case "current":
+		return true
+	default:
+		return p.Type != 0
+	}
+}
@@ -7,11 +7,15 @@ import (
 	"math/cmplx"
 	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/JSchlarb/synchrophasor"
+	"github.com/fsnotify/fsnotify"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 const appVersion = "dev"
@@ -23,22 +27,31 @@ type DigitalChannelState struct {
 	Interval     time.Duration
 }
 
-func randomValue(base, variation float64) float64 {
+func randomValue(rng *rand.Rand, base, variation float64) float64 {
 	rMin := base - (base * variation)
 	rMax := base + (base * variation)
-	return rMin + rand.Float64()*(rMax-rMin)
+	return rMin + rng.Float64()*(rMax-rMin)
 }
 
-// generatePhasorValue generates a phasor value based on the definition
-func generatePhasorValue(cfg *Config, phasor PhasorDefinition) complex128 {
-	baseValue := cfg.GetBaseValue(phasor)
-	variation := cfg.GetVariation(phasor)
-	magnitude := randomValue(baseValue, variation)
-	return cmplx.Rect(magnitude, phasor.PhaseAngle)
+// generatePhasorValue generates a phasor value based on the definition,
+// applying its active faults and modulation and rotating it by the given
+// angle offset. The second value is the same phasor without noise.
+func generatePhasorValue(rng *rand.Rand, sc *StationConfig, phasor PhasorDefinition,
+	timeOffset, angleOffset float64) (complex128, complex128) {
+	baseValue := sc.GetBaseValue(phasor)
+	variation := sc.GetVariation(phasor)
+	if phasor.Magnitude > 0 {
+		baseValue *= phasor.Magnitude
+	}
+	modulation, modulationAngle, _, _ := phasor.Modulation.at(timeOffset)
+	magnitude := baseValue * magnitudeFactor(phasor.Faults, timeOffset) * modulation
+	angle := phasor.PhaseAngle + angleOffset + modulationAngle
+	ideal := cmplx.Rect(magnitude, math.Remainder(angle, 2*math.Pi))
+	return ideal * complex(randomValue(rng, 1, variation), 0), ideal
 }
 
 // generateAnalogValue generates an analog value based on the channel definition
-func generateAnalogValue(channel AnalogChannel, timeOffset float64) float32 {
+func generateAnalogValue(rng *rand.Rand, channel AnalogChannel, timeOffset float64) float32 {
 	switch channel.GeneratorType {
 	case "sine":
 		freq := 0.1
@@ -63,13 +76,11 @@ func generateAnalogValue(channel AnalogChannel, timeOffset float64) float32 {
 		return float32(channel.BaseValue)
 
 	default: // "random"
-		return float32(randomValue(channel.BaseValue, channel.Variation))
+		return float32(randomValue(rng, channel.BaseValue, channel.Variation))
 	}
 }
 
 func main() {
-	rand.New(rand.NewSource(time.Now().UnixNano()))
-
 	// Load configuration
 	cfg, err := loadConfig()
 	if err != nil {
@@ -79,19 +90,20 @@ func main() {
 	// Setup logging
 	setupLogging(cfg.PMU.LogLevel)
 
+	fleet := cfg.fleet()
+
 	log.WithFields(log.Fields{
 		"version":       appVersion,
 		"pmu_name":      cfg.PMU.Name,
 		"pmu_id":        cfg.PMU.ID,
 		"station":       cfg.PMU.Station,
+		"station_count": len(cfg.PMU.Stations),
+		"fleet_size":    len(fleet),
 		"phasor_count":  cfg.GetPhasorCount(),
 		"analog_count":  cfg.GetAnalogCount(),
 		"digital_count": cfg.GetDigitalCount(),
 	}).Info("Starting PMU simulator")
 
-	// Initialize metrics
-	initMetrics(appVersion, cfg)
-
 	// Start metrics HTTP server
 	go func() {
 		metricsAddr := fmt.Sprintf(":%d", cfg.PMU.MetricsPort)
@@ -108,149 +120,83 @@ func main() {
 		}
 	}()
 
-	pmu := synchrophasor.NewPMU()
-	pmu.SetLogger(log.StandardLogger())
-
-	// Create configuration frame
-	configFrame := synchrophasor.NewConfigFrame()
-	configFrame.IDCode = cfg.PMU.ID
-	configFrame.TimeBase = cfg.PMU.TimeBase
-	configFrame.DataRate = cfg.PMU.DataRate
-
-	station := synchrophasor.NewPMUStation(
-		cfg.PMU.Name,
-		cfg.PMU.ID,
-		cfg.PMU.DataFormat.FreqFloat,
-		cfg.PMU.DataFormat.AnalogFloat,
-		cfg.PMU.DataFormat.PhasorFloat,
-		cfg.PMU.DataFormat.Polar,
-	)
-
-	for _, phasor := range cfg.PMU.Phasors {
-		station.AddPhasor(phasor.Name, phasor.Scale, phasor.Type)
-	}
-
-	for _, analog := range cfg.PMU.AnalogChannels {
-		station.AddAnalog(analog.Name, uint32(analog.Scale), 0)
-	}
-
-	if cfg.GetDigitalCount() > 0 {
-		// Create channel names array
-		digitalNames := make([]string, 0, cfg.GetDigitalCount())
-		for _, ch := range cfg.PMU.DigitalChannels {
-			digitalNames = append(digitalNames, ch.Name)
+	// The first server is also served at the root, the servers of a fleet
+	// under /fleet/<id>
+	startTime := time.Now()
+	simulators := make([]*simulator, len(fleet))
+	for i, c := range fleet {
+		var prefixes []string
+		if i == 0 {
+			prefixes = append(prefixes, "")
 		}
-
-		// For now, use simple masks - the actual values will be set during runtime
-		normalMask := uint16(0x0000)
-		validMask := uint16(0xFFFF)
-		station.AddDigital(digitalNames, normalMask, validMask)
-	}
-
-	// Set nominal frequency
-	if cfg.PMU.FrequencyBase == 50 {
-		station.Fnom = synchrophasor.FreqNom50Hz
-	} else {
-		station.Fnom = synchrophasor.FreqNom60Hz
-	}
-	station.CfgCnt = 1
-
-	// Add station to configuration
-	configFrame.AddPMUStation(station)
-
-	// Set configuration and header
-	pmu.Config2 = configFrame
-	pmu.Config1 = &synchrophasor.Config1Frame{ConfigFrame: *configFrame}
-	pmu.Config1.Sync = (synchrophasor.SyncAA << 8) | synchrophasor.SyncCfg1
-	pmu.Header = synchrophasor.NewHeaderFrame(cfg.PMU.ID, cfg.PMU.Header)
-
-	pmu.LogConfiguration()
-
-	// Start PMU server
-	address := fmt.Sprintf("%s:%d", cfg.PMU.IP, cfg.PMU.Port)
-	if err := pmu.Start(address); err != nil {
-		log.WithError(err).Fatal("Failed to start PMU")
+		if len(fleet) > 1 {
+			prefixes = append(prefixes, fmt.Sprintf("/fleet/%d", c.PMU.ID))
+		}
+		sim, err := newSimulator(c, startTime, prefixes...)
+		if err != nil {
+			log.WithError(err).WithField("pmu_id", c.PMU.ID).Fatal("Failed to start simulator")
+		}
+		defer sim.Stop()
+		simulators[i] = sim
 	}
-	defer pmu.Stop()
-
-	log.WithField("address", address).Info("PMU server started, waiting for PDC connections")
+	simulators[0].breaker = true
 
 	// Calculate cycle duration
 	cycleDuration := time.Duration(float64(time.Second) / cfg.PMU.FrequencyBase)
 	ticker := newWallTicker(cycleDuration, 0, cfg.PMU.DropTicks)
 	defer ticker.Stop()
 
-	digitalStates := make([]DigitalChannelState, cfg.GetDigitalCount())
-	for i, ch := range cfg.PMU.DigitalChannels {
-		interval, _ := time.ParseDuration(ch.Interval)
-		digitalStates[i] = DigitalChannelState{
-			LastChange:   time.Now(),
-			CurrentValue: ch.InitialValue,
-			Interval:     interval,
-		}
+	// Reload the configuration on SIGHUP or, if enabled, on file changes
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	if cfg.PMU.WatchConfig {
+		viper.OnConfigChange(func(fsnotify.Event) {
+			select {
+			case reload <- syscall.SIGHUP:
+			default:
+			}
+		})
+		viper.WatchConfig()
+		log.Info("Watching the configuration file for changes")
 	}
 
-	startTime := time.Now()
-
-	for range ticker.C {
-		currentTime := time.Now()
-		timeOffset := currentTime.Sub(startTime).Seconds()
-
-		for i, phasor := range cfg.PMU.Phasors {
-			station.PhasorValues[i] = generatePhasorValue(cfg, phasor)
-		}
-
-		for i, analog := range cfg.PMU.AnalogChannels {
-			station.AnalogValues[i] = generateAnalogValue(analog, timeOffset)
-		}
-
-		station.Freq = float32(randomValue(cfg.PMU.FrequencyBase, cfg.PMU.FrequencyVariation))
-		dfreqBase := cfg.PMU.FrequencyBase / 100
-		station.DFreq = float32(randomValue(dfreqBase, cfg.PMU.DFreqVariation))
-
-		UpdateFrequencyMetrics(float64(station.Freq), float64(station.DFreq))
-
-		UpdateAnalogMetrics(cfg, station.AnalogValues)
-
-		digitalValues := make([]uint16, cfg.GetDigitalCount())
-		wordIndex := 0
-		bitIndex := 0
-
-		for chIdx := range cfg.PMU.DigitalChannels {
-			state := &digitalStates[chIdx]
-
-			if state.Interval > 0 {
-				elapsed := currentTime.Sub(state.LastChange)
-				if elapsed >= state.Interval {
-					state.LastChange = currentTime
-					state.CurrentValue = !state.CurrentValue
+	for {
+		select {
+		case <-ticker.C:
+			currentTime := time.Now()
+			for _, sim := range simulators {
+				// Aligned simulators update at their frame times
+				if !sim.aligned {
+					sim.tick(currentTime)
 				}
 			}
-
-			if wordIndex < len(station.DigitalValues) {
-				station.DigitalValues[wordIndex][bitIndex] = state.CurrentValue
-			}
-
-			if state.CurrentValue {
-				digitalValues[chIdx] = 1
-			} else {
-				digitalValues[chIdx] = 0
-			}
-
-			bitIndex++
-			if bitIndex >= 16 {
-				bitIndex = 0
-				wordIndex++
-			}
+		case <-reload:
+			reloadConfig(simulators)
 		}
+	}
+}
 
-		UpdateDigitalMetrics(cfg, digitalValues)
+// reloadConfig reloads the configuration into the running simulators,
+// keeping the old one if it is invalid
+func reloadConfig(simulators []*simulator) {
+	log.Info("Reloading configuration")
+	cfg, err := loadConfig()
+	if err != nil {
+		log.WithError(err).Error("Failed to reload configuration, keeping the old one")
+		return
+	}
+	setupLogging(cfg.PMU.LogLevel)
 
-		if len(digitalStates) > 0 {
-			UpdateBreakerStatus(digitalStates[0].CurrentValue)
+	fleet := cfg.fleet()
+	if len(fleet) != len(simulators) {
+		log.WithField("fleet_size", len(simulators)).Warn("Fleet size changed, keeping the old size until restart")
+	}
+	for i, sim := range simulators {
+		if i >= len(fleet) {
+			break
+		}
+		if err := sim.reload(fleet[i]); err != nil {
+			log.WithError(err).WithField("pmu_id", sim.cfg.PMU.ID).Error("Failed to reload simulator")
 		}
-
-		// Set status - all good
-		station.Stat = 0x0000
 	}
 }
@@ -44,25 +44,30 @@ var (
 		Help: "Breaker status (1=on, 0=off)",
 	})
 
-	frequencyValue = promauto.NewGauge(prometheus.GaugeOpts{
+	frequencyValue = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pmu_frequency_hz",
 		Help: "Current frequency value in Hz",
-	})
+	}, []string{"station"})
 
-	rocofValue = promauto.NewGauge(prometheus.GaugeOpts{
+	rocofValue = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pmu_rocof_hz_per_sec",
 		Help: "Rate of change of frequency in Hz/s",
-	})
+	}, []string{"station"})
 
 	analogGauges = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pmu_analog_value",
 		Help: "Analog channel values",
-	}, []string{"channel", "unit"})
+	}, []string{"station", "channel", "unit"})
 
 	digitalGauges = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "pmu_digital_value",
 		Help: "Digital channel values",
-	}, []string{"channel"})
+	}, []string{"station", "channel"})
+
+	impairedFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pmu_impaired_frames_total",
+		Help: "Data frames dropped, duplicated or corrupted by the network impairment",
+	}, []string{"action"})
 )
 
 // initMetrics initializes the metrics with static values
@@ -86,14 +91,16 @@ func initMetrics(version string, cfg *Config) {
 	pmuChannels.WithLabelValues("analog").Set(float64(cfg.GetAnalogCount()))
 	pmuChannels.WithLabelValues("digital").Set(float64(cfg.GetDigitalCount()))
 
-	// Initialize analog channel metrics
-	for _, analog := range cfg.PMU.AnalogChannels {
-		analogGauges.WithLabelValues(analog.Name, analog.Unit).Set(0)
-	}
+	for _, st := range cfg.PMU.Stations {
+		// Initialize analog channel metrics
+		for _, analog := range st.AnalogChannels {
+			analogGauges.WithLabelValues(st.Name, analog.Name, analog.Unit).Set(0)
+		}
 
-	// Initialize digital channel metrics
-	for _, digital := range cfg.PMU.DigitalChannels {
-		digitalGauges.WithLabelValues(digital.Name).Set(0)
+		// Initialize digital channel metrics
+		for _, digital := range st.DigitalChannels {
+			digitalGauges.WithLabelValues(st.Name, digital.Name).Set(0)
+		}
 	}
 }
 
@@ -112,26 +119,26 @@ func UpdateBreakerStatus(on bool) {
 	}
 }
 
-// UpdateFrequencyMetrics updates frequency and ROCOF metrics
-func UpdateFrequencyMetrics(freq, rocof float64) {
-	frequencyValue.Set(freq)
-	rocofValue.Set(rocof)
+// UpdateFrequencyMetrics updates frequency and ROCOF metrics of a station
+func UpdateFrequencyMetrics(st *StationConfig, freq, rocof float64) {
+	frequencyValue.WithLabelValues(st.Name).Set(freq)
+	rocofValue.WithLabelValues(st.Name).Set(rocof)
 }
 
-// UpdateAnalogMetrics updates analog channel metrics
-func UpdateAnalogMetrics(cfg *Config, values []float32) {
-	for i, analog := range cfg.PMU.AnalogChannels {
+// UpdateAnalogMetrics updates analog channel metrics of a station
+func UpdateAnalogMetrics(st *StationConfig, values []float32) {
+	for i, analog := range st.AnalogChannels {
 		if i < len(values) {
-			analogGauges.WithLabelValues(analog.Name, analog.Unit).Set(float64(values[i]))
+			analogGauges.WithLabelValues(st.Name, analog.Name, analog.Unit).Set(float64(values[i]))
 		}
 	}
 }
 
-// UpdateDigitalMetrics updates digital channel metrics
-func UpdateDigitalMetrics(cfg *Config, states []uint16) {
-	for i, ch := range cfg.PMU.DigitalChannels {
+// UpdateDigitalMetrics updates digital channel metrics of a station
+func UpdateDigitalMetrics(st *StationConfig, states []uint16) {
+	for i, ch := range st.DigitalChannels {
 		if i < len(states) {
-			digitalGauges.WithLabelValues(ch.Name).Set(float64(states[i]))
+			digitalGauges.WithLabelValues(st.Name, ch.Name).Set(float64(states[i]))
 		}
 	}
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modulation is the sinusoidal amplitude and phase modulation of the
+// measurement bandwidth test of IEEE C37.118.1,
+// Xm·(1 + kx·cos ωt)·cos(ω0·t + ka·cos(ωt − π))
+type Modulation struct {
+	Frequency      float64 `mapstructure:"frequency"`       // modulation frequency in Hz, 0 for none
+	AmplitudeDepth float64 `mapstructure:"amplitude_depth"` // kx, 0.1 in the standard
+	PhaseDepth     float64 `mapstructure:"phase_depth"`     // ka in radians, 0.1 in the standard
+}
+
+// at returns the magnitude factor, the angle offset in radians, the
+// frequency deviation in Hz and its rate of change in Hz/s at timeOffset
+func (m Modulation) at(timeOffset float64) (magnitude, angle, dev, rate float64) {
+	if m.Frequency == 0 {
+		return 1, 0, 0, 0
+	}
+	w := 2 * math.Pi * m.Frequency
+	phase := w*timeOffset - math.Pi
+	magnitude = 1 + m.AmplitudeDepth*math.Cos(w*timeOffset)
+	angle = m.PhaseDepth * math.Cos(phase)
+	dev = -m.PhaseDepth * m.Frequency * math.Sin(phase)
+	rate = -m.PhaseDepth * m.Frequency * w * math.Cos(phase)
+	return magnitude, angle, dev, rate
+}
+
+// frequencyModulation returns the modulation of the first voltage phasor
+// with a phase modulation, which the frequency and ROCOF follow
+func (s *StationConfig) frequencyModulation() Modulation {
+	for _, ph := range s.Phasors {
+		if !ph.isCurrent() && ph.Modulation.Frequency > 0 && ph.Modulation.PhaseDepth != 0 {
+			return ph.Modulation
+		}
+	}
+	return Modulation{}
+}
+
+// validateModulation disables a modulation of a phasor with a negative
+// frequency
+func (p *PhasorDefinition) validateModulation() {
+	if p.Modulation.Frequency < 0 {
+		log.WithField("phasor", p.Name).Warnf("Negative modulation frequency %g, disabling it", p.Modulation.Frequency)
+		p.Modulation = Modulation{}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// impairedQueueSize is the number of frames delayed per PDC before
+	// writes block
+	impairedQueueSize = 1024
+	// impairedWriteTimeout bounds a delayed write to a PDC
+	impairedWriteTimeout = time.Second
+)
+
+// NetworkImpairment degrades the output to every PDC independently, to test
+// the alignment, gap handling and resynchronization of PDCs without network
+// emulation tooling. Loss, duplication and corruption only affect data
+// frames. TCP keeps the order, so a jittered frame is never sent before the
+// previous one.
+type NetworkImpairment struct {
+	Enabled   bool    `mapstructure:"enabled"`
+	Loss      float64 `mapstructure:"loss"`      // probability of dropping a data frame
+	Duplicate float64 `mapstructure:"duplicate"` // probability of sending a data frame twice
+	Latency   string  `mapstructure:"latency"`   // added delay of every frame
+	Jitter    string  `mapstructure:"jitter"`    // uniformly distributed delay on top of the latency
+	// CorruptCRC is the probability of inverting the CRC of a data frame
+	CorruptCRC float64 `mapstructure:"corrupt_crc"`
+	// Truncate is the probability of cutting a data frame short, so that
+	// the PDC reads into the next frame
+	Truncate float64 `mapstructure:"truncate"`
+	// WrongSize is the probability of a wrong FRAMESIZE in a data frame
+	WrongSize float64 `mapstructure:"wrong_size"`
+}
+
+// corrupt returns a data frame with its CRC inverted, cut short or with a
+// wrong FRAMESIZE, or the frame itself, and the corruption applied
+func (n *NetworkImpairment) corrupt(rng *rand.Rand, frame []byte) ([]byte, string) {
+	switch {
+	case len(frame) < 6:
+	case rng.Float64() < n.CorruptCRC:
+		frame[len(frame)-2] ^= 0xFF
+		frame[len(frame)-1] ^= 0xFF
+		return frame, "crc_corrupted"
+	case rng.Float64() < n.Truncate:
+		return frame[:1+rng.Intn(len(frame)-1)], "truncated"
+	case rng.Float64() < n.WrongSize:
+		size := binary.BigEndian.Uint16(frame[2:4])
+		binary.BigEndian.PutUint16(frame[2:4], size+uint16(1+rng.Intn(int(size)-1)))
+		return frame, "wrong_size"
+	}
+	return frame, ""
+}
+
+// delay returns the delay of a frame
+func (n *NetworkImpairment) delay(rng *rand.Rand) time.Duration {
+	d := seconds(n.Latency) + rng.Float64()*seconds(n.Jitter)
+	return time.Duration(d * float64(time.Second))
+}
+
+// impairedListener wraps the connections accepted by a listener in
+// impairedConns reading the impairment from settings
+type impairedListener struct {
+	net.Listener
+	settings func() NetworkImpairment
+	// seed, if not 0, seeds the impairment of the n-th connection with
+	// seed + n
+	seed     int64
+	accepted atomic.Int64
+}
+
+// Accept waits for the next connection and wraps it
+func (l *impairedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	seed := time.Now().UnixNano()
+	if l.seed != 0 {
+		seed = l.seed + l.accepted.Add(1)
+	}
+	c := &impairedConn{
+		Conn:     conn,
+		settings: l.settings,
+		rng:      rand.New(rand.NewSource(seed)),
+		queue:    make(chan delayedFrame, impairedQueueSize),
+		done:     make(chan struct{}),
+	}
+	go c.writer()
+	return c, nil
+}
+
+// delayedFrame is a frame waiting to be written
+type delayedFrame struct {
+	data []byte
+	due  time.Time
+}
+
+// impairedConn drops, duplicates, corrupts and delays the frames written to
+// a PDC
+type impairedConn struct {
+	net.Conn
+	settings func() NetworkImpairment
+
+	mu  sync.Mutex
+	rng *rand.Rand
+	// last is the due time of the last queued frame
+	last time.Time
+
+	queue     chan delayedFrame
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Write queues a frame for the writer, dropping, duplicating or corrupting
+// data frames.
+// The PMU writes every frame separately, so b holds exactly one frame.
+func (c *impairedConn) Write(b []byte) (int, error) {
+	n := c.settings()
+
+	// The caller reuses b
+	data := append([]byte(nil), b...)
+
+	c.mu.Lock()
+	copies := 1
+	corruption := ""
+	if frameType, err := synchrophasor.GetFrameType(b); err == nil && frameType == synchrophasor.FrameTypeData {
+		if c.rng.Float64() < n.Loss {
+			copies = 0
+		} else if c.rng.Float64() < n.Duplicate {
+			copies = 2
+		}
+		if copies > 0 {
+			data, corruption = n.corrupt(c.rng, data)
+		}
+	}
+	due := time.Now().Add(n.delay(c.rng))
+	if due.Before(c.last) {
+		due = c.last
+	}
+	c.last = due
+	c.mu.Unlock()
+
+	switch copies {
+	case 0:
+		impairedFrames.WithLabelValues("dropped").Inc()
+	case 2:
+		impairedFrames.WithLabelValues("duplicated").Inc()
+	}
+	if corruption != "" {
+		impairedFrames.WithLabelValues(corruption).Inc()
+	}
+
+	for range copies {
+		select {
+		case c.queue <- delayedFrame{data: data, due: due}:
+		case <-c.done:
+			return 0, net.ErrClosed
+		}
+	}
+	return len(b), nil
+}
+
+// SetWriteDeadline is ignored, writes only queue the frame and the writer
+// bounds the delayed ones
+func (c *impairedConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// Close stops the writer and closes the connection
+func (c *impairedConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
+// writer writes the queued frames once they are due
+func (c *impairedConn) writer() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		var f delayedFrame
+		select {
+		case f = <-c.queue:
+		case <-c.done:
+			return
+		}
+
+		if wait := time.Until(f.due); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-timer.C:
+			case <-c.done:
+				return
+			}
+		}
+
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(impairedWriteTimeout)); err != nil {
+			return
+		}
+		if _, err := c.Conn.Write(f.data); err != nil {
+			log.WithField("client", c.RemoteAddr().String()).WithError(err).Debug("Error sending delayed frame")
+		}
+	}
+}
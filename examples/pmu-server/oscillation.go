@@ -0,0 +1,42 @@
+package main
+
+import "math"
+
+// Oscillation describes a damped oscillation mode modulating the phasor
+// angles and, consistently with them, the frequency
+type Oscillation struct {
+	Frequency float64 `mapstructure:"frequency"` // mode frequency in Hz, e.g. 0.25
+	Amplitude float64 `mapstructure:"amplitude"` // initial angle amplitude in degrees
+	Damping   float64 `mapstructure:"damping"`   // damping ratio, e.g. 0.05, negative for a growing mode
+	Phase     float64 `mapstructure:"phase"`     // mode phase in degrees, e.g. 180 for a station swinging against another
+	Start     string  `mapstructure:"start"`     // offset from the simulator start
+	Duration  string  `mapstructure:"duration"`  // "0s" for no end
+	Period    string  `mapstructure:"period"`    // repetition interval, "0s" for once
+}
+
+// oscillationAt returns the angle offset in radians, the frequency deviation
+// in Hz and its rate of change in Hz/s of the active oscillations
+func oscillationAt(oscillations []Oscillation, timeOffset float64) (float64, float64, float64) {
+	var angle, dev, rate float64
+	for _, o := range oscillations {
+		t, ok := cycleTime(timeOffset, o.Start, o.Period)
+		if !ok || o.Frequency <= 0 {
+			continue
+		}
+		if d := seconds(o.Duration); d > 0 && t >= d {
+			continue
+		}
+		// delta(t) = A exp(-sigma t) sin(omega t + phi) with the decay of the
+		// damping ratio, the frequency deviation is its derivative over 2 pi
+		omega := 2 * math.Pi * o.Frequency
+		zeta := max(min(o.Damping, 0.99), -0.99)
+		sigma := zeta * omega / math.Sqrt(1-zeta*zeta)
+		a := o.Amplitude * math.Pi / 180 * math.Exp(-sigma*t)
+		phi := omega*t + o.Phase*math.Pi/180
+		sin, cos := math.Sincos(phi)
+		angle += a * sin
+		dev += a * (omega*cos - sigma*sin) / (2 * math.Pi)
+		rate += a * ((sigma*sigma-omega*omega)*sin - 2*sigma*omega*cos) / (2 * math.Pi)
+	}
+	return angle, dev, rate
+}
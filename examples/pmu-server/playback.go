@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// PlaybackConfig replays recorded values from a CSV file instead of the
+// synthetic ones. The file has a "time" column, either RFC 3339 or seconds,
+// and one column per channel in the layout of the csvsink package:
+// "<station>.freq", "<station>.rocof", "<station>.stat",
+// "<station>.<phasor>.mag", "<station>.<phasor>.ang" in degrees and
+// "<station>.<channel>" for analog and digital channels. Columns without the
+// station prefix apply to every station. Channels without a column and empty
+// cells keep their synthetic values.
+//
+// A COMTRADE record (.cfg next to its .dat) is resampled to the reporting
+// rate, its channels matching by name like the columns.
+type PlaybackConfig struct {
+	File string `mapstructure:"file"`
+	// Loop restarts the recording at its end instead of holding the last row
+	Loop bool `mapstructure:"loop"`
+	// Waveforms lists the analog channels of a COMTRADE record holding
+	// instantaneous values, played back as the phasors of the same name
+	Waveforms []string `mapstructure:"waveforms"`
+}
+
+// recording holds the rows of a playback file
+type recording struct {
+	columns map[string]int
+	// times holds the time of every row in seconds since the first one
+	times []float64
+	// rows holds the values of every row, NaN for empty cells
+	rows [][]float64
+	// span is the duration of a loop, one mean row interval past the last row
+	span float64
+	loop bool
+}
+
+// loadRecording reads a playback file, resampling COMTRADE records to rate
+// reports per second at the nominal frequency unless the record has one
+func loadRecording(pc PlaybackConfig, rate int, nominal float64) (*recording, error) {
+	if strings.EqualFold(filepath.Ext(pc.File), ".cfg") {
+		return loadComtrade(pc, rate, nominal)
+	}
+
+	f, err := os.Open(pc.File)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of %s: %w", pc.File, err)
+	}
+	rec := &recording{columns: make(map[string]int, len(header)), loop: pc.Loop}
+	timeColumn := -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "time" {
+			timeColumn = i
+		}
+		rec.columns[name] = i
+	}
+	if timeColumn < 0 {
+		return nil, fmt.Errorf("%s has no time column", pc.File)
+	}
+
+	var first float64
+	for line := 2; ; line++ {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", pc.File, err)
+		}
+		t, err := parseTime(fields[timeColumn])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", pc.File, line, err)
+		}
+		if len(rec.times) == 0 {
+			first = t
+		}
+		t -= first
+		if n := len(rec.times); n > 0 && t < rec.times[n-1] {
+			return nil, fmt.Errorf("%s line %d: time goes backwards", pc.File, line)
+		}
+
+		row := make([]float64, len(fields))
+		for i, field := range fields {
+			row[i] = math.NaN()
+			if field = strings.TrimSpace(field); field != "" && i != timeColumn {
+				if row[i], err = strconv.ParseFloat(field, 64); err != nil {
+					return nil, fmt.Errorf("%s line %d column %s: %w", pc.File, line, header[i], err)
+				}
+			}
+		}
+		rec.times = append(rec.times, t)
+		rec.rows = append(rec.rows, row)
+	}
+	if len(rec.rows) == 0 {
+		return nil, fmt.Errorf("%s has no rows", pc.File)
+	}
+
+	n := len(rec.times)
+	rec.span = rec.times[n-1]
+	if n > 1 {
+		rec.span += rec.times[n-1] / float64(n-1)
+	}
+	return rec, nil
+}
+
+// parseTime parses an RFC 3339 time or seconds into seconds
+func parseTime(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return float64(t.UnixNano()) / 1e9, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return v, nil
+}
+
+// at returns the latest row at or before timeOffset seconds since the start
+// of the playback
+func (r *recording) at(timeOffset float64) []float64 {
+	if r.loop && r.span > 0 {
+		timeOffset = math.Mod(timeOffset, r.span)
+	}
+	i := sort.SearchFloat64s(r.times, timeOffset)
+	if i == len(r.times) || r.times[i] > timeOffset {
+		i--
+	}
+	return r.rows[max(i, 0)]
+}
+
+// column returns the index of the column of a channel of a station, -1 if
+// the file has none
+func (r *recording) column(station, channel string) int {
+	if i, ok := r.columns[station+"."+channel]; ok {
+		return i
+	}
+	if i, ok := r.columns[channel]; ok {
+		return i
+	}
+	return -1
+}
+
+// stationPlayback holds the playback columns of a station, -1 for channels
+// without one
+type stationPlayback struct {
+	stat, freq, rocof int
+	mag, ang          []int
+	analog, digital   []int
+}
+
+// bind returns the playback columns of a station
+func (r *recording) bind(sc *StationConfig) *stationPlayback {
+	p := &stationPlayback{
+		stat:  r.column(sc.Name, "stat"),
+		freq:  r.column(sc.Name, "freq"),
+		rocof: r.column(sc.Name, "rocof"),
+	}
+	for _, ph := range sc.Phasors {
+		p.mag = append(p.mag, r.column(sc.Name, ph.Name+".mag"))
+		p.ang = append(p.ang, r.column(sc.Name, ph.Name+".ang"))
+	}
+	for _, ch := range sc.AnalogChannels {
+		p.analog = append(p.analog, r.column(sc.Name, ch.Name))
+	}
+	for _, ch := range sc.DigitalChannels {
+		p.digital = append(p.digital, r.column(sc.Name, ch.Name))
+	}
+	return p
+}
+
+// apply replaces the values of a station and their ground truth by those of
+// row. Phasors without an angle column keep their synthetic angle and vice
+// versa.
+func (p *stationPlayback) apply(station *synchrophasor.PMUStation, truth *stationTruth, row []float64) {
+	if v, ok := value(row, p.stat); ok {
+		station.Stat |= uint16(v)
+	}
+	if v, ok := value(row, p.freq); ok {
+		station.Freq = float32(v)
+		truth.freq = v
+	}
+	if v, ok := value(row, p.rocof); ok {
+		station.DFreq = float32(v)
+		truth.rocof = v
+	}
+	for i := range station.PhasorValues {
+		mag, ang := cmplx.Polar(station.PhasorValues[i])
+		trueMag, trueAng := cmplx.Polar(truth.phasors[i])
+		if v, ok := value(row, p.mag[i]); ok {
+			mag, trueMag = v, v
+		}
+		if v, ok := value(row, p.ang[i]); ok {
+			ang = v * math.Pi / 180
+			trueAng = ang
+		}
+		station.PhasorValues[i] = cmplx.Rect(mag, ang)
+		truth.phasors[i] = cmplx.Rect(trueMag, trueAng)
+	}
+	for i := range station.AnalogValues {
+		if v, ok := value(row, p.analog[i]); ok {
+			station.AnalogValues[i] = float32(v)
+		}
+	}
+}
+
+// digitalValue returns the value of digital channel i in row, false if it
+// has none
+func (p *stationPlayback) digitalValue(row []float64, i int) (bool, bool) {
+	if p == nil {
+		return false, false
+	}
+	v, ok := value(row, p.digital[i])
+	return v != 0, ok
+}
+
+// value returns the value of a column of row, false if it is empty or the
+// file has no such column
+func value(row []float64, column int) (float64, bool) {
+	if row == nil || column < 0 || column >= len(row) || math.IsNaN(row[column]) {
+		return 0, false
+	}
+	return row[column], true
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/httpapi"
+	"github.com/JSchlarb/synchrophasor/wsserver"
+	log "github.com/sirupsen/logrus"
+)
+
+// configChangeHold is how long the STAT configuration change bit is set
+// after a reload, giving PDCs time to request the new configuration
+const configChangeHold = time.Minute
+
+// simulator is a PMU server with its simulated stations
+type simulator struct {
+	// mu guards the configuration and stations against the control API and
+	// reloads
+	mu           sync.Mutex
+	cfg          *Config
+	pmu          *synchrophasor.PMU
+	stations     []*stationState
+	api          *httpapi.Handler
+	stream       *wsserver.Server
+	frame        *synchrophasor.DataFrame
+	measurements synchrophasor.Measurements
+	startTime    time.Time
+	lastOffset   float64
+	// recording is the played back file, nil without playback
+	recording *recording
+	// breaker reports the first digital channel as breaker status metric
+	breaker bool
+	// cfgCnt is the CFGCNT of the stations, changed the time of the last
+	// reload
+	cfgCnt  uint16
+	changed time.Time
+	// truth logs the ground truth and soe the digital transitions, nil
+	// without
+	truth *truthLog
+	soe   *soeLog
+	// aligned updates the stations at the data frame times instead of the
+	// cycles, so that the logs match the frames exactly
+	aligned bool
+}
+
+// build creates the configuration frame and stations of cfg with the given
+// CFGCNT, loading the playback file if set
+func build(cfg *Config, startTime time.Time, cfgCnt uint16) (
+	*synchrophasor.ConfigFrame, []*stationState, *recording, error) {
+	var rec *recording
+	if cfg.PMU.Playback.File != "" {
+		var err error
+		if rec, err = loadRecording(cfg.PMU.Playback, max(int(cfg.PMU.DataRate), 1), cfg.PMU.FrequencyBase); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load playback file: %w", err)
+		}
+		log.WithFields(log.Fields{
+			"file": cfg.PMU.Playback.File,
+			"rows": len(rec.rows),
+		}).Info("Playing back recorded values")
+	}
+
+	// Create configuration frame
+	configFrame := synchrophasor.NewConfigFrame()
+	configFrame.IDCode = cfg.PMU.ID
+	configFrame.TimeBase = cfg.PMU.TimeBase
+	configFrame.DataRate = cfg.PMU.DataRate
+
+	stations := make([]*stationState, len(cfg.PMU.Stations))
+	for i := range cfg.PMU.Stations {
+		stations[i] = newStationState(cfg, &cfg.PMU.Stations[i], startTime)
+		stations[i].station.CfgCnt = cfgCnt
+		if rec != nil {
+			stations[i].playback = rec.bind(&cfg.PMU.Stations[i])
+		}
+		configFrame.AddPMUStation(stations[i].station)
+	}
+	return configFrame, stations, rec, nil
+}
+
+// newSimulator creates the PMU server of cfg and registers its REST API and
+// WebSocket stream under each of the given path prefixes
+func newSimulator(cfg *Config, startTime time.Time, prefixes ...string) (*simulator, error) {
+	initMetrics(appVersion, cfg)
+
+	configFrame, stations, rec, err := build(cfg, startTime, 1)
+	if err != nil {
+		return nil, err
+	}
+	sim := &simulator{
+		cfg:       cfg,
+		stations:  stations,
+		frame:     synchrophasor.NewDataFrame(configFrame),
+		startTime: startTime,
+		recording: rec,
+		cfgCnt:    1,
+	}
+	if cfg.PMU.GroundTruth != "" {
+		if sim.truth, err = newTruthLog(truthPath(cfg.PMU.GroundTruth, 1), stations); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PMU.SOELog != "" {
+		if sim.soe, err = newSOELog(cfg.PMU.SOELog); err != nil {
+			if sim.truth != nil {
+				_ = sim.truth.Close()
+			}
+			return nil, err
+		}
+	}
+	sim.aligned = sim.truth != nil || sim.soe != nil
+
+	pmu := synchrophasor.NewPMU()
+	pmu.SetLogger(log.StandardLogger())
+	sim.pmu = pmu
+
+	// Set configuration and header
+	pmu.Config2 = configFrame
+	pmu.Config1 = &synchrophasor.Config1Frame{ConfigFrame: *configFrame}
+	pmu.Config1.Sync = (synchrophasor.SyncAA << 8) | synchrophasor.SyncCfg1
+	pmu.Header = synchrophasor.NewHeaderFrame(cfg.PMU.ID, cfg.PMU.Header)
+
+	pmu.LogConfiguration()
+
+	if cfg.PMU.GPSLoss.Enabled || cfg.PMU.Clock.Enabled {
+		pmu.SetClock(func(now time.Time) (time.Time, uint8) {
+			sim.mu.Lock()
+			defer sim.mu.Unlock()
+			return sim.clock(now)
+		})
+	} else if sim.aligned {
+		pmu.SetClock(func(now time.Time) (time.Time, uint8) {
+			return sim.frameTime(now), 0
+		})
+	}
+	if sim.aligned {
+		// Updating at the frame times lets the logs match the frames
+		// exactly
+		pmu.SetDataProvider(synchrophasor.DataProviderFunc(func(_ *synchrophasor.ConfigFrame, now time.Time) error {
+			sim.tick(sim.frameTime(now))
+			return nil
+		}))
+	}
+
+	// Serve the live state next to the metrics
+	api := httpapi.New(configFrame, httpapi.Options{})
+	stream, err := wsserver.New(configFrame, wsserver.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WebSocket server: %w", err)
+	}
+	for _, prefix := range prefixes {
+		http.Handle(prefix+"/api/", http.StripPrefix(prefix+"/api", api))
+		http.Handle(prefix+"/ws", stream)
+		log.Infof("REST API started at %s/api/, WebSocket stream at %s/ws", prefix, prefix)
+		if cfg.PMU.Dashboard {
+			http.HandleFunc(prefix+"/dashboard/", serveDashboard)
+			log.Infof("Dashboard started at %s/dashboard/", prefix)
+		}
+	}
+
+	// Start PMU server
+	pmu.SetUDPDataPort(cfg.PMU.UDP.DataPort)
+	address := fmt.Sprintf("%s:%d", cfg.PMU.IP, cfg.PMU.Port)
+	if !cfg.PMU.UDP.Only {
+		if err := sim.serve(address, nil); err != nil {
+			_ = stream.Close()
+			return nil, fmt.Errorf("failed to start PMU: %w", err)
+		}
+	}
+
+	if cfg.PMU.TLS.Enabled && !cfg.PMU.UDP.Only {
+		cert, err := tls.LoadX509KeyPair(cfg.PMU.TLS.CertFile, cfg.PMU.TLS.KeyFile)
+		if err != nil {
+			pmu.Stop()
+			_ = stream.Close()
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+
+		tlsAddress := fmt.Sprintf("%s:%d", cfg.PMU.IP, cfg.PMU.TLS.Port)
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		if err := sim.serve(tlsAddress, tlsConfig); err != nil {
+			pmu.Stop()
+			_ = stream.Close()
+			return nil, fmt.Errorf("failed to start PMU TLS listener: %w", err)
+		}
+	}
+
+	if err := sim.serveUDP(cfg.PMU.IP); err != nil {
+		pmu.Stop()
+		_ = stream.Close()
+		return nil, fmt.Errorf("failed to start PMU UDP transport: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"address": address,
+		"pmu_id":  cfg.PMU.ID,
+	}).Info("PMU server started, waiting for PDC connections")
+
+	sim.api, sim.stream = api, stream
+	control := sim.controlHandler()
+	for _, prefix := range prefixes {
+		http.Handle(prefix+"/control/", http.StripPrefix(prefix+"/control", control))
+		log.Infof("Control API started at %s/control/", prefix)
+	}
+	return sim, nil
+}
+
+// serve starts a PMU listener on address, over TLS if tlsConfig is set,
+// impairing its connections if the network impairment is enabled
+func (s *simulator) serve(address string, tlsConfig *tls.Config) error {
+	if !s.cfg.PMU.Network.Enabled {
+		if tlsConfig != nil {
+			return s.pmu.StartTLS(address, tlsConfig)
+		}
+		return s.pmu.Start(address)
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	// Impair the frames, not the TLS records carrying them
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	impaired := &impairedListener{Listener: listener, seed: s.cfg.PMU.Seed, settings: func() NetworkImpairment {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.cfg.PMU.Network
+	}}
+	go func() {
+		if err := s.pmu.Serve(impaired); !errors.Is(err, synchrophasor.ErrPMUStopped) {
+			log.WithError(err).WithField("address", address).Error("PMU listener failed")
+		}
+	}()
+	return nil
+}
+
+// clock returns the time stamped into the frames at the wall time now with
+// its time quality, following the time source and clock settings
+func (s *simulator) clock(now time.Time) (time.Time, uint8) {
+	stamp, quality := s.cfg.PMU.GPSLoss.clock(s.startTime, now)
+	return stamp.Add(s.cfg.PMU.Clock.at(now.Sub(s.startTime))), quality
+}
+
+// frameTime returns t at the resolution of the time base, the time carried
+// by a data frame stamped at t
+func (s *simulator) frameTime(t time.Time) time.Time {
+	s.mu.Lock()
+	timeBase := s.cfg.PMU.TimeBase
+	s.mu.Unlock()
+	return carriedTime(t, timeBase)
+}
+
+// carriedTime returns t at the resolution of timeBase
+func carriedTime(t time.Time, timeBase uint32) time.Time {
+	base := int64(timeBase & 0x00FFFFFF)
+	if base == 0 {
+		return t
+	}
+	fraction := int64(t.Nanosecond()) * base / int64(time.Second)
+	// Round up, so that the frame yields the same fraction again
+	return time.Unix(t.Unix(), (fraction*int64(time.Second)+base-1)/base)
+}
+
+// updateInterval returns the seconds between the updates, the frame interval
+// when aligned to the frames and the cycle otherwise
+func (s *simulator) updateInterval() float64 {
+	if s.aligned {
+		return 1 / float64(s.cfg.PMU.DataRate)
+	}
+	return 1 / s.cfg.PMU.FrequencyBase
+}
+
+// updateSeed returns the noise seed of a station for the given update,
+// mixing the inputs with the SplitMix64 finalizer
+func updateSeed(seed int64, id uint16, update int64) int64 {
+	x := uint64(seed) ^ uint64(id)<<48 ^ uint64(update)
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return int64(x ^ x>>31)
+}
+
+// tick updates the stations at currentTime and publishes the new values
+func (s *simulator) tick(currentTime time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timeOffset := currentTime.Sub(s.startTime).Seconds()
+
+	// With a seed the values only depend on the time since the start,
+	// snapped to the update interval, not on late or dropped ticks
+	simTime, update := currentTime, int64(0)
+	if s.cfg.PMU.Seed != 0 {
+		step := s.updateInterval()
+		update = int64(math.Round(timeOffset / step))
+		timeOffset = float64(update) * step
+		simTime = s.startTime.Add(time.Duration(timeOffset * float64(time.Second)))
+	}
+
+	// Set status - all good unless the time source is lost, the
+	// configuration changed or a STAT event is active
+	stat := uint16(0x0000)
+	stamp, _ := s.clock(currentTime)
+	if unlocked, ok := s.cfg.PMU.GPSLoss.unlockedAt(timeOffset); ok {
+		stat |= s.cfg.PMU.GPSLoss.syncStat(unlocked)
+	}
+	if !s.changed.IsZero() && currentTime.Sub(s.changed) < configChangeHold {
+		stat |= 0x0400
+	}
+
+	var row []float64
+	if s.recording != nil {
+		row = s.recording.at(timeOffset)
+	}
+
+	reported := !s.breaker
+	for _, st := range s.stations {
+		st.station.Stat = stat | statEventsAt(st.cfg.StatEvents, timeOffset)
+		if s.cfg.PMU.Seed != 0 {
+			st.rng.Seed(updateSeed(s.cfg.PMU.Seed, st.cfg.ID, update))
+		}
+		st.update(simTime, timeOffset, timeOffset-s.lastOffset, row)
+		if !reported && len(st.digitalStates) > 0 {
+			UpdateBreakerStatus(st.digitalStates[0].CurrentValue)
+			reported = true
+		}
+	}
+	s.lastOffset = timeOffset
+	if s.truth != nil {
+		if err := s.truth.write(currentTime, s.stations); err != nil {
+			log.WithError(err).Warn("Failed to write ground truth")
+		}
+	}
+	if s.soe != nil {
+		if err := s.soe.write(carriedTime(stamp, s.cfg.PMU.TimeBase), s.stations); err != nil {
+			log.WithError(err).Warn("Failed to write SOE log")
+		}
+	}
+
+	s.frame.FillMeasurements(&s.measurements)
+	s.measurements.Time = float64(stamp.UnixNano()) / 1e9
+	if err := s.api.Write(&s.measurements); err != nil {
+		log.WithError(err).Warn("Failed to update REST API")
+	}
+	if err := s.stream.Write(&s.measurements); err != nil {
+		log.WithError(err).Warn("Failed to update WebSocket stream")
+	}
+}
+
+// Stop stops the PMU server and closes the WebSocket stream, the ground
+// truth and the SOE log
+func (s *simulator) Stop() {
+	s.pmu.Stop()
+	_ = s.stream.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.truth != nil {
+		_ = s.truth.Close()
+	}
+	if s.soe != nil {
+		_ = s.soe.Close()
+	}
+}
+
+// reload replaces the stations by those of cfg, bumping CFGCNT and setting
+// the STAT configuration change bit so PDCs request the new configuration.
+// Listener, data rate, time source, ground truth, SOE log, dashboard and
+// fleet settings are kept, they need a restart. The ground truth continues in
+// a new file named after the CFGCNT, as its columns may change, while the SOE
+// log continues with the new stations.
+func (s *simulator) reload(cfg *Config) error {
+	s.mu.Lock()
+	old := s.cfg
+	cfgCnt := s.cfgCnt + 1
+	s.mu.Unlock()
+
+	for _, setting := range []struct {
+		name    string
+		changed bool
+	}{
+		{"ip", cfg.PMU.IP != old.PMU.IP},
+		{"port", cfg.PMU.Port != old.PMU.Port},
+		{"tls", cfg.PMU.TLS != old.PMU.TLS},
+		{"metrics_port", cfg.PMU.MetricsPort != old.PMU.MetricsPort},
+		{"data_rate", cfg.PMU.DataRate != old.PMU.DataRate},
+		{"gps_loss.enabled", cfg.PMU.GPSLoss.Enabled != old.PMU.GPSLoss.Enabled},
+		{"network.enabled", cfg.PMU.Network.Enabled != old.PMU.Network.Enabled},
+		{"clock.enabled", cfg.PMU.Clock.Enabled != old.PMU.Clock.Enabled},
+		{"ground_truth", cfg.PMU.GroundTruth != old.PMU.GroundTruth},
+		{"soe_log", cfg.PMU.SOELog != old.PMU.SOELog},
+		{"dashboard", cfg.PMU.Dashboard != old.PMU.Dashboard},
+		{"fleet", cfg.PMU.Fleet.Size != old.PMU.Fleet.Size},
+		{"udp", cfg.PMU.UDP != old.PMU.UDP},
+	} {
+		if setting.changed {
+			log.WithField("setting", setting.name).Warn("Setting changed, keeping the old value until restart")
+		}
+	}
+	cfg.PMU.IP, cfg.PMU.Port, cfg.PMU.TLS = old.PMU.IP, old.PMU.Port, old.PMU.TLS
+	cfg.PMU.MetricsPort, cfg.PMU.DataRate = old.PMU.MetricsPort, old.PMU.DataRate
+	cfg.PMU.GPSLoss.Enabled, cfg.PMU.Fleet = old.PMU.GPSLoss.Enabled, old.PMU.Fleet
+	cfg.PMU.Network.Enabled, cfg.PMU.GroundTruth = old.PMU.Network.Enabled, old.PMU.GroundTruth
+	cfg.PMU.Clock.Enabled, cfg.PMU.SOELog = old.PMU.Clock.Enabled, old.PMU.SOELog
+	cfg.PMU.Dashboard, cfg.PMU.UDP = old.PMU.Dashboard, old.PMU.UDP
+
+	configFrame, stations, rec, err := build(cfg, time.Now(), cfgCnt)
+	if err != nil {
+		return err
+	}
+	var truth *truthLog
+	if cfg.PMU.GroundTruth != "" {
+		if truth, err = newTruthLog(truthPath(cfg.PMU.GroundTruth, cfgCnt), stations); err != nil {
+			return err
+		}
+	}
+	initMetrics(appVersion, cfg)
+
+	s.mu.Lock()
+	if s.truth != nil {
+		_ = s.truth.Close()
+	}
+	s.cfg, s.stations, s.recording, s.truth = cfg, stations, rec, truth
+	s.frame = synchrophasor.NewDataFrame(configFrame)
+	s.cfgCnt, s.changed = cfgCnt, time.Now()
+	s.pmu.SetConfig(configFrame)
+	s.api.SetConfig(configFrame)
+	err = s.stream.SetConfig(configFrame)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"pmu_id":        cfg.PMU.ID,
+		"config_count":  cfgCnt,
+		"station_count": len(stations),
+	}).Info("Configuration reloaded")
+	return nil
+}
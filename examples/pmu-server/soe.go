@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// soeLog writes a sequence of events record of the digital channels, one
+// row per transition stamped with the time of the first data frame carrying
+// it, to diff event processing downstream against
+type soeLog struct {
+	file *os.File
+	buf  *bufio.Writer
+	w    *csv.Writer
+}
+
+// newSOELog creates the sequence of events file at path
+func newSOELog(path string) (*soeLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOE log: %w", err)
+	}
+	l := &soeLog{file: f, buf: bufio.NewWriter(f)}
+	l.w = csv.NewWriter(l.buf)
+	if err := l.w.Write([]string{"time", "id_code", "station", "channel", "value"}); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// write appends the digital transitions of the stations since their last
+// update, stamped with t. The first update of a station only records its
+// states.
+func (l *soeLog) write(t time.Time, stations []*stationState) error {
+	written := false
+	for _, st := range stations {
+		if st.soeValues == nil {
+			st.soeValues = make([]bool, len(st.digitalStates))
+			for i := range st.digitalStates {
+				st.soeValues[i] = st.digitalStates[i].CurrentValue
+			}
+			continue
+		}
+		for i := range st.digitalStates {
+			v := st.digitalStates[i].CurrentValue
+			if v == st.soeValues[i] {
+				continue
+			}
+			st.soeValues[i] = v
+			value := "0"
+			if v {
+				value = "1"
+			}
+			row := []string{t.UTC().Format(time.RFC3339Nano), strconv.Itoa(int(st.cfg.ID)), st.cfg.Name,
+				st.cfg.DigitalChannels[i].Name, value}
+			if err := l.w.Write(row); err != nil {
+				return err
+			}
+			written = true
+		}
+	}
+	if !written {
+		return nil
+	}
+	l.w.Flush()
+	if err := l.w.Error(); err != nil {
+		return err
+	}
+	return l.buf.Flush()
+}
+
+// Close closes the sequence of events file
+func (l *soeLog) Close() error {
+	l.w.Flush()
+	if err := l.buf.Flush(); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
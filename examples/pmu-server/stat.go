@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// statFlags are the STAT bits of the flags of a StatEvent, following IEEE
+// C37.118.2
+var statFlags = map[string]uint16{
+	"data_invalid":    0xC000, // PMU error, values not to be used
+	"test_mode":       0x8000,
+	"pmu_error":       0x4000, // PMU error, no information about the data
+	"sync_loss":       0x2000,
+	"sort_by_arrival": 0x1000,
+	"trigger":         0x0800,
+	"data_modified":   0x0200,
+}
+
+// StatEvent sets STAT flags of a station for a while, to exercise the
+// quality handling and alarming of PDCs
+type StatEvent struct {
+	// Flags are "data_invalid", "test_mode", "pmu_error", "sync_loss",
+	// "sort_by_arrival", "trigger" or "data_modified"
+	Flags []string `mapstructure:"flags"`
+	// TriggerReason is the trigger reason code of the low STAT bits, e.g.
+	// 1 for magnitude low, set with the trigger flag
+	TriggerReason uint16 `mapstructure:"trigger_reason"`
+	Start         string `mapstructure:"start"`    // offset from the simulator start
+	Duration      string `mapstructure:"duration"` // "0s" for no end
+	Period        string `mapstructure:"period"`   // repetition interval, "0s" for once
+}
+
+// statEventsAt returns the STAT bits of the active events
+func statEventsAt(events []StatEvent, timeOffset float64) uint16 {
+	var stat uint16
+	for _, e := range events {
+		t, ok := cycleTime(timeOffset, e.Start, e.Period)
+		if !ok {
+			continue
+		}
+		if d := seconds(e.Duration); d > 0 && t >= d {
+			continue
+		}
+		for _, f := range e.Flags {
+			stat |= statFlags[f]
+			if f == "trigger" {
+				stat |= e.TriggerReason
+			}
+		}
+	}
+	return stat
+}
+
+// validateStatEvents drops the unknown flags of the STAT events of a station
+func (s *StationConfig) validateStatEvents() {
+	events := s.StatEvents[:0]
+	for i, e := range s.StatEvents {
+		name := s.Name + "/" + strconv.Itoa(i)
+		flags := make([]string, 0, len(e.Flags))
+		for _, f := range e.Flags {
+			if _, ok := statFlags[f]; !ok {
+				log.WithField("stat_event", name).Warnf("Unknown STAT flag %q, ignoring it", f)
+				continue
+			}
+			flags = append(flags, f)
+		}
+		e.Flags = flags
+		if e.TriggerReason > 0x000F {
+			log.WithField("stat_event", name).Warnf("Trigger reason %d beyond 15, using 0", e.TriggerReason)
+			e.TriggerReason = 0
+		}
+		if validDurations("stat_event", name, e.Start, e.Duration, e.Period) {
+			events = append(events, e)
+		}
+	}
+	s.StatEvents = events
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// stationState is a simulated station with its runtime state
+type stationState struct {
+	cfg           *StationConfig
+	station       *synchrophasor.PMUStation
+	digitalStates []DigitalChannelState
+	// loadVoltages holds the index of the voltage of each current derived
+	// from a load, -1 for the other phasors
+	loadVoltages []int
+	// soeValues are the digital values last seen by the SOE log, nil before
+	// its first update
+	soeValues []bool
+	// angleOffset integrates the frequency deviation of the excursions
+	angleOffset float64
+	// playback holds the columns of the played back file, nil without one
+	playback *stationPlayback
+	trips    []*tripState
+	// frequencyOffset and faults are set through the control API
+	frequencyOffset float64
+	faults          []activeFault
+	// truth holds the values of the last update without noise
+	truth stationTruth
+	// rng draws the noise, reseeded at every update with a seed
+	rng *rand.Rand
+}
+
+// stationTruth is the ground truth of a station
+type stationTruth struct {
+	freq    float64
+	rocof   float64
+	phasors []complex128
+}
+
+// newStationState creates the PMU station of a station configuration
+func newStationState(cfg *Config, sc *StationConfig, now time.Time) *stationState {
+	station := synchrophasor.NewPMUStation(
+		sc.Name,
+		sc.ID,
+		cfg.PMU.DataFormat.FreqFloat,
+		cfg.PMU.DataFormat.AnalogFloat,
+		cfg.PMU.DataFormat.PhasorFloat,
+		cfg.PMU.DataFormat.Polar,
+	)
+
+	for _, phasor := range sc.Phasors {
+		station.AddPhasor(phasor.Name, phasor.Scale, phasor.Type)
+	}
+
+	for _, analog := range sc.AnalogChannels {
+		station.AddAnalog(analog.Name, uint32(analog.Scale), 0)
+	}
+
+	if len(sc.DigitalChannels) > 0 {
+		// Create channel names array
+		digitalNames := make([]string, 0, len(sc.DigitalChannels))
+		for _, ch := range sc.DigitalChannels {
+			digitalNames = append(digitalNames, ch.Name)
+		}
+
+		// For now, use simple masks - the actual values will be set during runtime
+		normalMask := uint16(0x0000)
+		validMask := uint16(0xFFFF)
+		station.AddDigital(digitalNames, normalMask, validMask)
+	}
+
+	// Set nominal frequency
+	if sc.FrequencyBase == 50 {
+		station.Fnom = synchrophasor.FreqNom50Hz
+	} else {
+		station.Fnom = synchrophasor.FreqNom60Hz
+	}
+	station.CfgCnt = 1
+
+	digitalStates := make([]DigitalChannelState, len(sc.DigitalChannels))
+	for i, ch := range sc.DigitalChannels {
+		interval, _ := time.ParseDuration(ch.Interval)
+		digitalStates[i] = DigitalChannelState{
+			LastChange:   now,
+			CurrentValue: ch.InitialValue,
+			Interval:     interval,
+		}
+	}
+
+	return &stationState{
+		cfg:           sc,
+		station:       station,
+		digitalStates: digitalStates,
+		loadVoltages:  sc.loadVoltages(),
+		trips:         newTripStates(sc, digitalStates),
+		truth:         stationTruth{phasors: make([]complex128, len(sc.Phasors))},
+		rng:           rand.New(rand.NewSource(now.UnixNano() + int64(sc.ID))),
+	}
+}
+
+// update generates the station values at currentTime, timeOffset seconds
+// after the simulator start and dt seconds after the previous update,
+// replacing them by the values of the played back row if set
+func (s *stationState) update(currentTime time.Time, timeOffset, dt float64, row []float64) {
+	sc, station := s.cfg, s.station
+
+	// Breaker operations act on the currents and frequency of the same set
+	s.updateDigitals(currentTime, row)
+
+	deviation, deviationRate := excursionAt(sc.FrequencyExcursions, timeOffset)
+	deviation += s.frequencyOffset
+	for _, t := range s.trips {
+		dev, rate := t.update(s.digitalStates, currentTime)
+		deviation += dev
+		deviationRate += rate
+	}
+	s.angleOffset = math.Remainder(s.angleOffset+2*math.Pi*deviation*dt, 2*math.Pi)
+	swing, swingDeviation, swingRate := oscillationAt(sc.Oscillations, timeOffset)
+	deviation += swingDeviation
+	deviationRate += swingRate
+	drift, driftDeviation := angleDriftAt(sc.AngleDrift, timeOffset)
+	ramp, rampDeviation := angleRampAt(sc.AngleRamps, timeOffset)
+	step, test, testDeviation, testRate := complianceAt(sc.ComplianceTests, timeOffset)
+	swing += drift + ramp + test
+	deviation += driftDeviation + rampDeviation + testDeviation
+	deviationRate += testRate
+	_, _, modulationDeviation, modulationRate := sc.frequencyModulation().at(timeOffset)
+	deviation += modulationDeviation
+	deviationRate += modulationRate
+
+	// Scaling applies to the values and their ground truth alike
+	scale := func(i int, factor float64) {
+		station.PhasorValues[i] *= complex(factor, 0)
+		s.truth.phasors[i] *= complex(factor, 0)
+	}
+	load := sc.LoadProfile.factor(currentTime)
+	// Currents of loads follow their voltage, so they come last. They keep
+	// drawing the same power through magnitude steps.
+	for _, derived := range []bool{false, true} {
+		for i, phasor := range sc.Phasors {
+			v := s.loadVoltages[i]
+			if (v >= 0) != derived {
+				continue
+			}
+			if derived {
+				station.PhasorValues[i], s.truth.phasors[i] =
+					phasor.Load.current(s.rng, s.truth.phasors[v], sc.GetVariation(phasor))
+				scale(i, magnitudeFactor(phasor.Faults, timeOffset))
+			} else {
+				station.PhasorValues[i], s.truth.phasors[i] =
+					generatePhasorValue(s.rng, sc, phasor, timeOffset, s.angleOffset+swing)
+				scale(i, step)
+			}
+			if phasor.isCurrent() {
+				scale(i, load)
+				station.PhasorValues[i] *= complex(randomValue(s.rng, 1, sc.LoadProfile.Noise), 0)
+			}
+		}
+	}
+	faults := s.faults[:0]
+	for _, f := range s.faults {
+		if timeOffset < f.until {
+			for _, i := range f.phasors {
+				scale(i, f.factor)
+			}
+			faults = append(faults, f)
+		}
+	}
+	s.faults = faults
+	for _, t := range s.trips {
+		if !t.closed {
+			for _, i := range t.currents {
+				scale(i, t.cfg.Residual)
+			}
+		}
+	}
+
+	for i, analog := range sc.AnalogChannels {
+		station.AnalogValues[i] = generateAnalogValue(s.rng, analog, timeOffset)
+		if isPowerUnit(analog.Unit) {
+			station.AnalogValues[i] *= float32(randomValue(s.rng, load, sc.LoadProfile.Noise))
+		}
+	}
+
+	station.Freq = float32(randomValue(s.rng, sc.FrequencyBase, sc.FrequencyVariation) + deviation)
+	dfreqBase := sc.FrequencyBase / 100
+	station.DFreq = float32(randomValue(s.rng, dfreqBase, sc.DFreqVariation) + deviationRate)
+	s.truth.freq = sc.FrequencyBase + deviation
+	s.truth.rocof = dfreqBase + deviationRate
+
+	if p := s.playback; p != nil && row != nil {
+		p.apply(station, &s.truth, row)
+	}
+
+	UpdateFrequencyMetrics(sc, float64(station.Freq), float64(station.DFreq))
+
+	UpdateAnalogMetrics(sc, station.AnalogValues)
+}
+
+// updateDigitals updates the digital channels at currentTime, taking the
+// values of the played back row if set
+func (s *stationState) updateDigitals(currentTime time.Time, row []float64) {
+	sc, station := s.cfg, s.station
+
+	digitalValues := make([]uint16, len(sc.DigitalChannels))
+	wordIndex := 0
+	bitIndex := 0
+
+	for chIdx := range sc.DigitalChannels {
+		state := &s.digitalStates[chIdx]
+
+		if v, ok := s.playback.digitalValue(row, chIdx); ok {
+			if v != state.CurrentValue {
+				state.LastChange = currentTime
+				state.CurrentValue = v
+			}
+		} else if state.Interval > 0 {
+			elapsed := currentTime.Sub(state.LastChange)
+			if elapsed >= state.Interval {
+				state.LastChange = currentTime
+				state.CurrentValue = !state.CurrentValue
+			}
+		}
+
+		if wordIndex < len(station.DigitalValues) {
+			station.DigitalValues[wordIndex][bitIndex] = state.CurrentValue
+		}
+
+		if state.CurrentValue {
+			digitalValues[chIdx] = 1
+		} else {
+			digitalValues[chIdx] = 0
+		}
+
+		bitIndex++
+		if bitIndex >= 16 {
+			bitIndex = 0
+			wordIndex++
+		}
+	}
+
+	UpdateDigitalMetrics(sc, digitalValues)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ThreePhaseSet generates the phasors of phases A, B and C, named "<name>A",
+// "<name>B" and "<name>C", spaced by 120° with an optional unbalance
+type ThreePhaseSet struct {
+	Name       string  `mapstructure:"name"` // e.g. "V" for VA, VB, VC
+	Type       uint8   `mapstructure:"type"` // 0 = Voltage, 1 = current
+	Scale      uint32  `mapstructure:"scale"`
+	PhaseAngle float64 `mapstructure:"phase_angle"` // of phase A in radians
+	BaseValue  string  `mapstructure:"base_value"`  // "voltage" or "current"
+	// Sequence is "positive" (A, B, C) or "negative" (A, C, B)
+	Sequence string `mapstructure:"sequence"`
+	// Magnitudes holds the magnitude of each phase relative to the base,
+	// balanced if empty
+	Magnitudes []float64 `mapstructure:"magnitudes"`
+	// Angles holds the deviation of each phase from the 120° spacing in
+	// degrees, balanced if empty
+	Angles []float64 `mapstructure:"angles"`
+	// Faults and Modulation apply to all three phases
+	Faults     []FaultDefinition `mapstructure:"faults"`
+	Modulation Modulation        `mapstructure:"modulation"`
+	// Load derives the currents from the voltages of the set named by
+	// Load.Voltage phase by phase, each phase drawing a third of the power
+	Load PhasorLoad `mapstructure:"load"`
+}
+
+// phasors returns the phasor definitions of the set
+func (s ThreePhaseSet) phasors() []PhasorDefinition {
+	spacing := -2 * math.Pi / 3
+	if s.Sequence == "negative" {
+		spacing = -spacing
+	}
+	phasors := make([]PhasorDefinition, 3)
+	for i, phase := range []string{"A", "B", "C"} {
+		p := PhasorDefinition{
+			Name:       s.Name + phase,
+			Type:       s.Type,
+			Scale:      s.Scale,
+			PhaseAngle: math.Remainder(s.PhaseAngle+float64(i)*spacing, 2*math.Pi),
+			BaseValue:  s.BaseValue,
+			Faults:     s.Faults,
+			Modulation: s.Modulation,
+		}
+		if s.Load.Voltage != "" {
+			p.Load = PhasorLoad{
+				Voltage: s.Load.Voltage + phase, P: s.Load.P / 3, Q: s.Load.Q / 3, PowerFactor: s.Load.PowerFactor,
+			}
+		}
+		if len(s.Magnitudes) == 3 {
+			p.Magnitude = s.Magnitudes[i]
+		}
+		if len(s.Angles) == 3 {
+			p.PhaseAngle += s.Angles[i] * math.Pi / 180
+		}
+		phasors[i] = p
+	}
+	return phasors
+}
+
+// expandSets appends the phasors of the three-phase sets of a station to its
+// phasors, ignoring unbalances not given for all three phases
+func (s *StationConfig) expandSets() {
+	for _, set := range s.ThreePhaseSets {
+		if set.Sequence != "" && set.Sequence != "positive" && set.Sequence != "negative" {
+			log.WithField("set", set.Name).Warnf("Unknown sequence %q, using positive", set.Sequence)
+			set.Sequence = "positive"
+		}
+		if n := len(set.Magnitudes); n != 0 && n != 3 {
+			log.WithField("set", set.Name).Warnf("%d magnitudes instead of 3, using balanced ones", n)
+			set.Magnitudes = nil
+		}
+		if n := len(set.Angles); n != 0 && n != 3 {
+			log.WithField("set", set.Name).Warnf("%d angles instead of 3, using balanced ones", n)
+			set.Angles = nil
+		}
+		s.Phasors = append(s.Phasors, set.phasors()...)
+	}
+}
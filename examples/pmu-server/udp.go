@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// UDPConfig serves the stream over UDP, as field PMUs streaming only UDP
+// do. The listeners, the data port and the destination may be combined.
+type UDPConfig struct {
+	Port int `mapstructure:"port"` // UDP port answering commands, 0 for none
+	// DataPort sends the data frames of TCP clients to this UDP port on the
+	// client, keeping the commands on TCP; 0 for TCP
+	DataPort int `mapstructure:"data_port"`
+	// Destination is the unicast or multicast host:port streamed to without
+	// commands, empty for none
+	Destination string `mapstructure:"destination"`
+	// ConfigInterval repeats CFG-2 on the destination stream, "0s" for once
+	ConfigInterval string `mapstructure:"config_interval"`
+	Only           bool   `mapstructure:"only"` // disables the TCP listeners
+}
+
+// validate checks the UDP settings
+func (u *UDPConfig) validate() error {
+	if u.Only && u.Port == 0 && u.Destination == "" {
+		return fmt.Errorf("udp.only needs a UDP port or destination")
+	}
+	if u.Only && u.DataPort != 0 {
+		return fmt.Errorf("udp.data_port needs the TCP listeners, which udp.only disables")
+	}
+	if u.Destination != "" {
+		if _, _, err := net.SplitHostPort(u.Destination); err != nil {
+			return fmt.Errorf("invalid udp.destination: %w", err)
+		}
+	}
+	if _, err := time.ParseDuration(u.ConfigInterval); err != nil {
+		return fmt.Errorf("invalid udp.config_interval: %w", err)
+	}
+	return nil
+}
+
+// offset returns the settings of fleet server i, with the UDP port and the
+// destination port counting up by i. The data port belongs to the PDC and
+// is shared.
+func (u UDPConfig) offset(i int) UDPConfig {
+	if u.Port != 0 {
+		u.Port += i
+	}
+	if host, port, err := net.SplitHostPort(u.Destination); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			u.Destination = net.JoinHostPort(host, strconv.Itoa(p+i))
+		}
+	}
+	return u
+}
+
+// serveUDP starts the UDP listener and stream of the simulator
+func (s *simulator) serveUDP(ip string) error {
+	u := s.cfg.PMU.UDP
+	if u.Port != 0 {
+		if err := s.pmu.StartUDP(fmt.Sprintf("%s:%d", ip, u.Port)); err != nil {
+			return err
+		}
+	}
+	if u.Destination != "" {
+		interval := time.Duration(seconds(u.ConfigInterval) * float64(time.Second))
+		if err := s.pmu.StreamUDP(u.Destination, interval); err != nil {
+			return err
+		}
+	}
+	return nil
+}
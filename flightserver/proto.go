@@ -0,0 +1,177 @@
+package flightserver
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The Flight messages are few and small, so instead of generating code from
+// Flight.proto they are encoded with protowire and passed through a codec
+// handling raw bytes.
+
+// codec passes messages as *[]byte, already encoded by the handlers
+type codec struct{}
+
+// Marshal returns the encoded message
+func (codec) Marshal(v any) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("flightserver: cannot marshal %T", v)
+	}
+	return *b, nil
+}
+
+// Unmarshal stores a copy of the encoded message
+func (codec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("flightserver: cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+// Name returns the content subtype clients send
+func (codec) Name() string {
+	return "proto"
+}
+
+// Descriptor types of FlightDescriptor
+const (
+	descriptorPath = 1
+	descriptorCmd  = 2
+)
+
+// descriptor is a FlightDescriptor
+type descriptor struct {
+	typ  uint64
+	cmd  []byte
+	path []string
+}
+
+// endpoint is a FlightEndpoint without locations, served by this server
+type endpoint struct {
+	ticket []byte
+}
+
+// flightInfo is a FlightInfo
+type flightInfo struct {
+	schema     []byte
+	descriptor descriptor
+	endpoints  []endpoint
+}
+
+// parseFields calls fn for every field of a message
+func parseFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		fn(num, typ, v, data)
+	}
+	return nil
+}
+
+// parseDescriptor decodes a FlightDescriptor
+func parseDescriptor(b []byte) (descriptor, error) {
+	var d descriptor
+	err := parseFields(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			d.typ = v
+		case num == 2 && typ == protowire.BytesType:
+			d.cmd = data
+		case num == 3 && typ == protowire.BytesType:
+			d.path = append(d.path, string(data))
+		}
+	})
+	return d, err
+}
+
+// parseTicket decodes a Ticket
+func parseTicket(b []byte) ([]byte, error) {
+	var ticket []byte
+	err := parseFields(b, func(num protowire.Number, typ protowire.Type, _ uint64, data []byte) {
+		if num == 1 && typ == protowire.BytesType {
+			ticket = data
+		}
+	})
+	return ticket, err
+}
+
+// appendDescriptor encodes a FlightDescriptor
+func appendDescriptor(b []byte, d *descriptor) []byte {
+	if d.typ != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, d.typ)
+	}
+	if len(d.cmd) > 0 {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, d.cmd)
+	}
+	for _, p := range d.path {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendString(b, p)
+	}
+	return b
+}
+
+// appendFlightInfo encodes a FlightInfo. The record and byte totals are
+// unknown, the endpoints are ordered by time.
+func appendFlightInfo(b []byte, info *flightInfo) []byte {
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, info.schema)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, appendDescriptor(nil, &info.descriptor))
+	for _, ep := range info.endpoints {
+		// FlightEndpoint holding a Ticket
+		ticket := protowire.AppendTag(nil, 1, protowire.BytesType)
+		ticket = protowire.AppendBytes(ticket, ep.ticket)
+		endpoint := protowire.AppendTag(nil, 1, protowire.BytesType)
+		endpoint = protowire.AppendBytes(endpoint, ticket)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, endpoint)
+	}
+	// total_records and total_bytes of -1
+	b = protowire.AppendTag(b, 4, protowire.VarintType)
+	b = protowire.AppendVarint(b, ^uint64(0))
+	b = protowire.AppendTag(b, 5, protowire.VarintType)
+	b = protowire.AppendVarint(b, ^uint64(0))
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+// appendSchemaResult encodes a SchemaResult
+func appendSchemaResult(b []byte, schema []byte) []byte {
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, schema)
+}
+
+// appendFlightData encodes a FlightData message
+func appendFlightData(b []byte, header, body []byte) []byte {
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, header)
+	if len(body) > 0 {
+		b = protowire.AppendTag(b, 1000, protowire.BytesType)
+		b = protowire.AppendBytes(b, body)
+	}
+	return b
+}
@@ -0,0 +1,311 @@
+// Package flightserver serves archived measurements over Arrow Flight, so
+// analysis clusters can pull large historical windows as columnar record
+// batches, fetching the endpoints of a flight in parallel
+package flightserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/archive"
+	"github.com/JSchlarb/synchrophasor/arrowipc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultPort is the port used by ListenAndServe without an address
+const DefaultPort = 8815
+
+// Options configures a Server
+type Options struct {
+	// Chunk is the time span of each endpoint of a flight, defaults to one
+	// minute
+	Chunk time.Duration
+	// Window aligns the record batches, defaults to one second
+	Window time.Duration
+}
+
+// Command selects a time range in the CMD descriptor of GetFlightInfo and
+// GetSchema, encoded as JSON, e.g. {"from":"2025-01-01T00:00:00Z"}. Zero
+// times leave the range open, an empty command selects the whole archive.
+type Command struct {
+	From time.Time `json:"from,omitzero"`
+	To   time.Time `json:"to,omitzero"`
+}
+
+// ticket identifies the frames of one configuration within a time range
+type ticket struct {
+	Config int   `json:"config"`
+	From   int64 `json:"from"`
+	To     int64 `json:"to"`
+}
+
+// Server implements the Arrow Flight service for an archive file. Every
+// request opens the archive, so frames appended by a running writer become
+// visible once their block is written.
+type Server struct {
+	name string
+	opts Options
+	grpc *grpc.Server
+}
+
+// New creates a server for the archive file name
+func New(name string, opts Options) (*Server, error) {
+	if opts.Chunk <= 0 {
+		opts.Chunk = time.Minute
+	}
+	if opts.Window <= 0 {
+		opts.Window = time.Second
+	}
+	r, err := archive.OpenFile(name)
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Close()
+
+	s := &Server{name: name, opts: opts}
+	s.grpc = grpc.NewServer(grpc.ForceServerCodec(codec{}))
+	s.grpc.RegisterService(&serviceDesc, s)
+	return s, nil
+}
+
+// ListenAndServe listens on addr, DefaultPort on all interfaces if empty
+func (s *Server) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts Flight clients on l until the server is closed
+func (s *Server) Serve(l net.Listener) error {
+	err := s.grpc.Serve(l)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return net.ErrClosed
+	}
+	return err
+}
+
+// Close stops the server and ends all requests
+func (s *Server) Close() error {
+	s.grpc.Stop()
+	return nil
+}
+
+// getFlightInfo returns the endpoints of the range selected by the descriptor
+func (s *Server) getFlightInfo(req []byte) ([]byte, error) {
+	d, r, segments, err := s.open(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+
+	info := flightInfo{descriptor: d}
+	if len(segments) > 0 {
+		info.schema = schema(segments[0].Config)
+	}
+	for _, seg := range segments {
+		config := slices.Index(r.Configs(), seg.Config)
+		chunk := int64(s.opts.Chunk)
+		from, to := seg.First.UnixNano(), seg.Last.UnixNano()+1
+		for start := from; start < to; start = (start/chunk + 1) * chunk {
+			end := min((start/chunk+1)*chunk, to)
+			t, _ := json.Marshal(ticket{Config: config, From: start, To: end})
+			info.endpoints = append(info.endpoints, endpoint{ticket: t})
+		}
+	}
+	return appendFlightInfo(nil, &info), nil
+}
+
+// getSchema returns the schema of the first configuration in the range
+func (s *Server) getSchema(req []byte) ([]byte, error) {
+	_, r, segments, err := s.open(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	if len(segments) == 0 {
+		return nil, status.Error(codes.NotFound, "no data in range")
+	}
+	return appendSchemaResult(nil, schema(segments[0].Config)), nil
+}
+
+// open parses a descriptor, opens the archive and returns its segments
+// clipped to the selected range
+func (s *Server) open(req []byte) (descriptor, *archive.Reader, []archive.Segment, error) {
+	d, err := parseDescriptor(req)
+	if err != nil {
+		return d, nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if d.typ != descriptorCmd {
+		return d, nil, nil, status.Error(codes.InvalidArgument, "only CMD descriptors are supported")
+	}
+	var cmd Command
+	if len(d.cmd) > 0 {
+		if err := json.Unmarshal(d.cmd, &cmd); err != nil {
+			return d, nil, nil, status.Errorf(codes.InvalidArgument, "command: %v", err)
+		}
+	}
+
+	r, err := archive.OpenFile(s.name)
+	if err != nil {
+		return d, nil, nil, status.Error(codes.Unavailable, err.Error())
+	}
+	var segments []archive.Segment
+	for _, seg := range r.Segments() {
+		if !cmd.From.IsZero() && seg.Last.Before(cmd.From) || !cmd.To.IsZero() && !seg.First.Before(cmd.To) {
+			continue
+		}
+		if !cmd.From.IsZero() && seg.First.Before(cmd.From) {
+			seg.First = cmd.From
+		}
+		if !cmd.To.IsZero() && !seg.Last.Before(cmd.To) {
+			seg.Last = cmd.To.Add(-1)
+		}
+		segments = append(segments, seg)
+	}
+	return d, r, segments, nil
+}
+
+// doGet streams the frames of a ticket as record batches
+func (s *Server) doGet(req []byte, stream grpc.ServerStream) error {
+	b, err := parseTicket(req)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	var t ticket
+	if err := json.Unmarshal(b, &t); err != nil {
+		return status.Errorf(codes.InvalidArgument, "ticket: %v", err)
+	}
+
+	r, err := archive.OpenFile(s.name)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer func() { _ = r.Close() }()
+	if t.Config < 0 || t.Config >= len(r.Configs()) {
+		return status.Error(codes.NotFound, "unknown configuration")
+	}
+	cfg := r.Configs()[t.Config]
+
+	w := arrowipc.NewWriter(&flightWriter{stream: stream}, cfg, arrowipc.Options{Window: s.opts.Window})
+	// The schema is sent even for empty ranges
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	df := synchrophasor.NewDataFrame(cfg)
+	var m synchrophasor.Measurements
+	it := r.Range(time.Unix(0, t.From), time.Unix(0, t.To))
+	for {
+		f, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		// Frames of other configurations overlapping in time
+		if f.Config != cfg {
+			continue
+		}
+		if err := df.Unpack(f.Data); err != nil {
+			return status.Error(codes.DataLoss, err.Error())
+		}
+		df.FillMeasurements(&m)
+		if err := w.Write(&m); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// schema returns the encapsulated Arrow schema message of a configuration
+func schema(cfg *synchrophasor.ConfigFrame) []byte {
+	var buf bytes.Buffer
+	_ = arrowipc.NewWriter(&buf, cfg, arrowipc.Options{}).Flush()
+	return buf.Bytes()
+}
+
+// flightWriter sends Arrow IPC messages as FlightData
+type flightWriter struct {
+	stream grpc.ServerStream
+}
+
+// Write is unused, all messages go through WriteMessage
+func (w *flightWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteMessage sends one message
+func (w *flightWriter) WriteMessage(metadata, body []byte) error {
+	// The transport may hold the encoded message after SendMsg returns
+	b := appendFlightData(nil, metadata, body)
+	return w.stream.SendMsg(&b)
+}
+
+// serviceDesc describes the supported methods of arrow.flight.protocol.FlightService.
+// Handshake, uploads and actions are answered with codes.Unimplemented.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "arrow.flight.protocol.FlightService",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetFlightInfo", Handler: unaryHandler((*Server).getFlightInfo)},
+		{MethodName: "GetSchema", Handler: unaryHandler((*Server).getSchema)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ListFlights", Handler: listFlights, ServerStreams: true},
+		{StreamName: "DoGet", Handler: doGet, ServerStreams: true},
+	},
+}
+
+// unaryHandler adapts a method taking and returning encoded messages. The
+// server has no interceptors.
+func unaryHandler(fn func(*Server, []byte) ([]byte, error)) grpc.MethodHandler {
+	return func(srv any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+		var req []byte
+		if err := dec(&req); err != nil {
+			return nil, err
+		}
+		resp, err := fn(srv.(*Server), req)
+		if err != nil {
+			return nil, err
+		}
+		return &resp, nil
+	}
+}
+
+// listFlights returns the flight of the whole archive
+func listFlights(srv any, stream grpc.ServerStream) error {
+	var criteria []byte
+	if err := stream.RecvMsg(&criteria); err != nil {
+		return err
+	}
+	req := appendDescriptor(nil, &descriptor{typ: descriptorCmd})
+	info, err := srv.(*Server).getFlightInfo(req)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(&info)
+}
+
+// doGet receives the ticket of a DoGet call
+func doGet(srv any, stream grpc.ServerStream) error {
+	var req []byte
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	return srv.(*Server).doGet(req, stream)
+}
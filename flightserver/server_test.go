@@ -0,0 +1,206 @@
+package flightserver
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/archive"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const service = "/arrow.flight.protocol.FlightService/"
+
+func testConfig(name string) *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation(name, 7, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+// writeArchive writes three seconds of frames of one configuration followed
+// by two seconds of another, at 50 frames per second
+func writeArchive(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "test.c37a")
+	file, err := os.Create(name)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, file.Close()) }()
+
+	w, err := archive.NewWriter(file, archive.Options{BlockSize: 4096})
+	require.NoError(t, err)
+	for i, cfg := range []*synchrophasor.ConfigFrame{testConfig("Sub 1"), testConfig("Sub 2")} {
+		require.NoError(t, w.WriteConfig(cfg))
+		df := synchrophasor.NewDataFrame(cfg)
+		for j := 0; j < 150-50*i; j++ {
+			n := uint32(150*i + j)
+			df.SOC = 1700000000 + n/50
+			df.FracSec = n % 50 * 20000
+			frame, err := df.Pack()
+			require.NoError(t, err)
+			require.NoError(t, w.Write(frame))
+		}
+	}
+	require.NoError(t, w.Close())
+	return name
+}
+
+func serve(t *testing.T, s *Server) *grpc.ClientConn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(l) }()
+	t.Cleanup(func() { _ = s.Close() })
+
+	conn, err := grpc.NewClient(l.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func cmdDescriptor(cmd string) []byte {
+	return appendDescriptor(nil, &descriptor{typ: descriptorCmd, cmd: []byte(cmd)})
+}
+
+// tickets returns the tickets of the endpoints of a FlightInfo
+func tickets(t *testing.T, info []byte) [][]byte {
+	var out [][]byte
+	require.NoError(t, parseFields(info, func(num protowire.Number, _ protowire.Type, _ uint64, data []byte) {
+		if num != 3 {
+			return
+		}
+		require.NoError(t, parseFields(data, func(num protowire.Number, _ protowire.Type, _ uint64, data []byte) {
+			if num == 1 {
+				ticket, err := parseTicket(data)
+				require.NoError(t, err)
+				out = append(out, ticket)
+			}
+		}))
+	}))
+	return out
+}
+
+// fetch returns the number of rows of a ticket
+func fetch(t *testing.T, conn *grpc.ClientConn, ticket []byte) int {
+	stream, err := conn.NewStream(context.Background(), &grpc.StreamDesc{ServerStreams: true}, service+"DoGet")
+	require.NoError(t, err)
+	req := protowire.AppendTag(nil, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, ticket)
+	require.NoError(t, stream.SendMsg(&req))
+	require.NoError(t, stream.CloseSend())
+
+	rows, messages := 0, 0
+	for {
+		var data []byte
+		err := stream.RecvMsg(&data)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		var header []byte
+		require.NoError(t, parseFields(data, func(num protowire.Number, _ protowire.Type, _ uint64, b []byte) {
+			if num == 2 {
+				header = b
+			}
+		}))
+		messages++
+		if messages > 1 {
+			rows += batchLength(header)
+		}
+	}
+	require.Positive(t, messages)
+	return rows
+}
+
+// batchLength reads the length of the RecordBatch in a Message FlatBuffer
+func batchLength(b []byte) int {
+	field := func(table, id int) int {
+		vtable := table - int(int32(binary.LittleEndian.Uint32(b[table:])))
+		return table + int(binary.LittleEndian.Uint16(b[vtable+4+2*id:]))
+	}
+	msg := int(binary.LittleEndian.Uint32(b))
+	header := field(msg, 2)
+	batch := header + int(binary.LittleEndian.Uint32(b[header:]))
+	return int(binary.LittleEndian.Uint64(b[field(batch, 0):]))
+}
+
+func TestServer(t *testing.T) {
+	s, err := New(writeArchive(t), Options{Chunk: time.Second})
+	require.NoError(t, err)
+	conn := serve(t, s)
+	ctx := context.Background()
+
+	// The whole archive, one endpoint per second
+	var info []byte
+	require.NoError(t, conn.Invoke(ctx, service+"GetFlightInfo", ptr(cmdDescriptor("")), &info))
+	all := tickets(t, info)
+	require.Len(t, all, 5)
+	rows := 0
+	for _, ticket := range all {
+		rows += fetch(t, conn, ticket)
+	}
+	require.Equal(t, 250, rows)
+
+	// A window spanning both configurations
+	cmd := `{"from":"2023-11-14T22:13:21.5Z","to":"2023-11-14T22:13:24Z"}`
+	require.NoError(t, conn.Invoke(ctx, service+"GetFlightInfo", ptr(cmdDescriptor(cmd)), &info))
+	window := tickets(t, info)
+	require.Len(t, window, 3)
+	require.Equal(t, []int{25, 50, 50},
+		[]int{fetch(t, conn, window[0]), fetch(t, conn, window[1]), fetch(t, conn, window[2])})
+
+	var schema []byte
+	require.NoError(t, conn.Invoke(ctx, service+"GetSchema", ptr(cmdDescriptor(cmd)), &schema))
+	require.NotEmpty(t, schema)
+
+	// ListFlights returns the whole archive
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, service+"ListFlights")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(ptr([]byte{})))
+	require.NoError(t, stream.CloseSend())
+	require.NoError(t, stream.RecvMsg(&info))
+	require.Len(t, tickets(t, info), 5)
+}
+
+func TestServerErrors(t *testing.T) {
+	s, err := New(writeArchive(t), Options{})
+	require.NoError(t, err)
+	conn := serve(t, s)
+	ctx := context.Background()
+
+	var resp []byte
+	path := appendDescriptor(nil, &descriptor{typ: descriptorPath, path: []string{"x"}})
+	err = conn.Invoke(ctx, service+"GetFlightInfo", &path, &resp)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	err = conn.Invoke(ctx, service+"GetSchema", ptr(cmdDescriptor(`{"from":"2030-01-01T00:00:00Z"}`)), &resp)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	err = conn.Invoke(ctx, service+"DoAction", ptr([]byte{}), &resp)
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, service+"DoGet")
+	require.NoError(t, err)
+	ticket := protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), []byte("x"))
+	require.NoError(t, stream.SendMsg(ptr(ticket)))
+	require.Equal(t, codes.InvalidArgument, status.Code(stream.RecvMsg(&resp)))
+
+	_, err = New(filepath.Join(t.TempDir(), "missing.c37a"), Options{})
+	require.Error(t, err)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -5,7 +5,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"strings"
 )
 
@@ -60,6 +62,14 @@ const (
 	AnunitPeak = 2
 )
 
+// STAT word bits of a station in a data frame
+const (
+	// StatDataError is the 2 bit data error code, nonzero unless the data is good
+	StatDataError = 0xC000
+	// StatDataModified flags data modified by post processing
+	StatDataModified = 0x0200
+)
+
 // Custom error types
 var (
 	ErrInvalidFrame     = errors.New("invalid frame")
@@ -67,6 +77,7 @@ var (
 	ErrInvalidParameter = errors.New("invalid parameter")
 	ErrInvalidSize      = errors.New("invalid size")
 	ErrNotImpl          = errors.New("function not implemented")
+	ErrPMUStopped       = errors.New("PMU stopped")
 )
 
 // HeaderFrame represents a header frame
@@ -88,27 +99,27 @@ func NewHeaderFrame(idCode uint16, info string) *HeaderFrame {
 
 // Pack converts header frame to bytes
 func (h *HeaderFrame) Pack() ([]byte, error) {
+	return h.AppendTo(nil)
+}
+
+// AppendTo appends the packed header frame to dst and returns the extended slice
+func (h *HeaderFrame) AppendTo(dst []byte) ([]byte, error) {
 	// Update frame size
 	h.FrameSize = uint16(16 + len(h.Data))
 
-	buf := new(bytes.Buffer)
-
-	// Write header
-	if err := writeBinary(buf, h.Sync, h.FrameSize, h.IDCode, h.SOC, h.FracSec); err != nil {
-		return nil, err
-	}
+	start := len(dst)
 
-	// Write data
-	buf.WriteString(h.Data)
+	// Write header and data
+	dst = h.appendHeader(dst)
+	dst = append(dst, h.Data...)
 
-	// Calculate and write CRC
-	data := buf.Bytes()
-	crc := CalcCRC(data)
-	if err := binary.Write(buf, binary.BigEndian, crc); err != nil {
-		return nil, err
-	}
+	// Write CRC
+	return appendCRC(dst, start), nil
+}
 
-	return buf.Bytes(), nil
+// PackTo writes the header frame to w in a single call using a pooled buffer and returns the number of bytes written
+func (h *HeaderFrame) PackTo(w io.Writer) (int, error) {
+	return packTo(w, h)
 }
 
 // Unpack parses bytes into header frame
@@ -124,7 +135,7 @@ func (h *HeaderFrame) Unpack(data []byte) error {
 		return err
 	}
 
-	if h.FrameSize < 16 {
+	if h.FrameSize < 16 || int(h.FrameSize) > len(data) {
 		return ErrInvalidSize
 	}
 
@@ -133,8 +144,9 @@ func (h *HeaderFrame) Unpack(data []byte) error {
 	}
 
 	// Read data
+	h.Data = ""
 	dataSize := int(h.FrameSize) - 16
-	if dataSize > 0 && dataSize < 65000 {
+	if dataSize > 0 {
 		dataBytes := make([]byte, dataSize)
 		if _, err := buf.Read(dataBytes); err != nil {
 			return err
@@ -194,89 +206,97 @@ func (c *ConfigFrame) GetPMUStationByIDCode(idCode uint16) *PMUStation {
 	return nil
 }
 
+// Clone returns a deep copy of c, whose stations, channel lists and values
+// may be changed without affecting c
+func (c *ConfigFrame) Clone() *ConfigFrame {
+	out := *c
+	out.PMUStationList = make([]*PMUStation, len(c.PMUStationList))
+	for i, pmu := range c.PMUStationList {
+		out.PMUStationList[i] = pmu.Clone()
+	}
+	return &out
+}
+
 // Pack converts configuration frame to bytes
 func (c *ConfigFrame) Pack() ([]byte, error) {
+	return c.AppendTo(nil)
+}
+
+// AppendTo appends the packed configuration frame to dst and returns the extended slice
+func (c *ConfigFrame) AppendTo(dst []byte) ([]byte, error) {
 	// Calculate frame size
-	size := uint16(24) // Base size
+	size := 24 // Base size
 
 	for _, pmu := range c.PMUStationList {
-		size += 30                                          // PMU header
-		size += 16 * (pmu.Phnmr + pmu.Annmr + 16*pmu.Dgnmr) // Channel names
-		size += 4 * (pmu.Phnmr + pmu.Annmr + pmu.Dgnmr)     // Units
+		phnmr, annmr, dgnmr := int(pmu.Phnmr), int(pmu.Annmr), int(pmu.Dgnmr)
+		size += 30                              // PMU header
+		size += 16 * (phnmr + annmr + 16*dgnmr) // Channel names
+		size += 4 * (phnmr + annmr + dgnmr)     // Units
+	}
+	if size > math.MaxUint16 {
+		return dst, ErrInvalidSize
 	}
 
-	c.FrameSize = size
+	c.FrameSize = uint16(size)
+	c.NumPMU = uint16(len(c.PMUStationList))
 
-	buf := new(bytes.Buffer)
+	start := len(dst)
 
 	// Write common header
-	if err := writeBinary(buf, c.Sync, c.FrameSize, c.IDCode, c.SOC, c.FracSec, c.TimeBase, c.NumPMU); err != nil {
-		return nil, err
-	}
+	dst = c.appendHeader(dst)
+	dst = binary.BigEndian.AppendUint32(dst, c.TimeBase)
+	dst = binary.BigEndian.AppendUint16(dst, c.NumPMU)
 
 	// Write PMU stations
 	for _, pmu := range c.PMUStationList {
 		// Station name (16 bytes)
-		stnName := padString(pmu.STN)
-		buf.WriteString(stnName)
+		dst = append(dst, padString(pmu.STN)...)
 
 		// PMU fields
-		if err := writeBinary(buf, pmu.IDCode, pmu.Format, pmu.Phnmr, pmu.Annmr, pmu.Dgnmr); err != nil {
-			return nil, err
-		}
-
-		// Channel names
-		for _, name := range pmu.CHNAMPhasor {
-			buf.WriteString(padString(name))
+		dst = binary.BigEndian.AppendUint16(dst, pmu.IDCode)
+		dst = binary.BigEndian.AppendUint16(dst, pmu.Format)
+		dst = binary.BigEndian.AppendUint16(dst, pmu.Phnmr)
+		dst = binary.BigEndian.AppendUint16(dst, pmu.Annmr)
+		dst = binary.BigEndian.AppendUint16(dst, pmu.Dgnmr)
+
+		// Channel names and units, as many as the counts announce
+		for i := 0; i < int(pmu.Phnmr); i++ {
+			dst = append(dst, padString(at(pmu.CHNAMPhasor, i))...)
 		}
-		for _, name := range pmu.CHNAMAnalog {
-			buf.WriteString(padString(name))
+		for i := 0; i < int(pmu.Annmr); i++ {
+			dst = append(dst, padString(at(pmu.CHNAMAnalog, i))...)
 		}
 		// Digital: 16 names per digital word
-		for i := 0; i < int(pmu.Dgnmr*16); i++ {
-			if i < len(pmu.CHNAMDigital) {
-				buf.WriteString(padString(pmu.CHNAMDigital[i]))
-			} else {
-				buf.WriteString(padString(""))
-			}
+		for i := 0; i < 16*int(pmu.Dgnmr); i++ {
+			dst = append(dst, padString(at(pmu.CHNAMDigital, i))...)
 		}
 
-		// Units
-		for _, unit := range pmu.Phunit {
-			if err := binary.Write(buf, binary.BigEndian, unit); err != nil {
-				return nil, err
-			}
+		for i := 0; i < int(pmu.Phnmr); i++ {
+			dst = binary.BigEndian.AppendUint32(dst, at(pmu.Phunit, i))
 		}
-		for _, unit := range pmu.Anunit {
-			if err := binary.Write(buf, binary.BigEndian, unit); err != nil {
-				return nil, err
-			}
+		for i := 0; i < int(pmu.Annmr); i++ {
+			dst = binary.BigEndian.AppendUint32(dst, at(pmu.Anunit, i))
 		}
-		for _, unit := range pmu.Dgunit {
-			if err := binary.Write(buf, binary.BigEndian, unit); err != nil {
-				return nil, err
-			}
+		for i := 0; i < int(pmu.Dgnmr); i++ {
+			dst = binary.BigEndian.AppendUint32(dst, at(pmu.Dgunit, i))
 		}
 
 		// Nominal frequency and config count
-		if err := writeBinary(buf, pmu.Fnom, pmu.CfgCnt); err != nil {
-			return nil, err
-		}
+		dst = binary.BigEndian.AppendUint16(dst, pmu.Fnom)
+		dst = binary.BigEndian.AppendUint16(dst, pmu.CfgCnt)
 	}
 
 	// Data rate
-	if err := binary.Write(buf, binary.BigEndian, c.DataRate); err != nil {
-		return nil, err
-	}
+	dst = binary.BigEndian.AppendUint16(dst, uint16(c.DataRate))
 
-	// Calculate and write CRC
-	data := buf.Bytes()
-	crc := CalcCRC(data)
-	if err := binary.Write(buf, binary.BigEndian, crc); err != nil {
-		return nil, err
-	}
+	// Write CRC
+	return appendCRC(dst, start), nil
+}
 
-	return buf.Bytes(), nil
+// PackTo writes the configuration frame to w in a single call using a pooled
+// buffer and returns the number of bytes written
+func (c *ConfigFrame) PackTo(w io.Writer) (int, error) {
+	return packTo(w, c)
 }
 
 // unpackPMUStation reads a single PMU station from the buffer
@@ -284,11 +304,11 @@ func (c *ConfigFrame) unpackPMUStation(buf *bytes.Reader) (*PMUStation, error) {
 	pmu := &PMUStation{}
 
 	// Station name
-	stnBytes := make([]byte, 16)
-	if _, err := buf.Read(stnBytes); err != nil {
+	var stnBytes [16]byte
+	if _, err := buf.Read(stnBytes[:]); err != nil {
 		return nil, err
 	}
-	pmu.STN = strings.TrimSpace(string(stnBytes))
+	pmu.STN = strings.TrimSpace(string(stnBytes[:]))
 
 	// PMU fields
 	if err := readBinary(buf, &pmu.IDCode, &pmu.Format); err != nil {
@@ -375,45 +395,52 @@ func (c *ConfigFrame) unpackPMUStation(buf *bytes.Reader) (*PMUStation, error) {
 
 // readChannelNames reads channel names for a PMU station
 func (c *ConfigFrame) readChannelNames(buf *bytes.Reader, pmu *PMUStation, phnmr, annmr, dgnmr uint16) error {
+	var err error
+
 	// Read phasor channel names
-	pmu.CHNAMPhasor = make([]string, phnmr)
-	for j := 0; j < int(phnmr); j++ {
-		nameBytes := make([]byte, 16)
-		if _, err := buf.Read(nameBytes); err != nil {
-			return err
-		}
-		pmu.CHNAMPhasor[j] = strings.TrimSpace(string(nameBytes))
+	if pmu.CHNAMPhasor, err = readNames(buf, int(phnmr)); err != nil {
+		return err
 	}
 
 	// Read analog channel names
-	pmu.CHNAMAnalog = make([]string, annmr)
-	for j := 0; j < int(annmr); j++ {
-		nameBytes := make([]byte, 16)
-		if _, err := buf.Read(nameBytes); err != nil {
-			return err
-		}
-		pmu.CHNAMAnalog[j] = strings.TrimSpace(string(nameBytes))
+	if pmu.CHNAMAnalog, err = readNames(buf, int(annmr)); err != nil {
+		return err
 	}
 
 	// Read digital channel names
-	pmu.CHNAMDigital = make([]string, 16*dgnmr)
-	for j := 0; j < int(16*dgnmr); j++ {
-		nameBytes := make([]byte, 16)
-		if _, err := buf.Read(nameBytes); err != nil {
-			return err
-		}
-		pmu.CHNAMDigital[j] = strings.TrimSpace(string(nameBytes))
+	if pmu.CHNAMDigital, err = readNames(buf, int(16*dgnmr)); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+// readNames reads count space padded 16 byte names
+func readNames(buf *bytes.Reader, count int) ([]string, error) {
+	var nameBytes [16]byte
+	names := make([]string, count)
+	for j := 0; j < count; j++ {
+		if _, err := buf.Read(nameBytes[:]); err != nil {
+			return nil, err
+		}
+		names[j] = strings.TrimSpace(string(nameBytes[:]))
+	}
+	return names, nil
+}
+
 // Unpack parses bytes into configuration frame
 func (c *ConfigFrame) Unpack(data []byte) error {
 	if len(data) < 24 {
 		return ErrInvalidSize
 	}
 
+	// Parse only this frame, so that stations cannot extend into the bytes
+	// following it
+	frameSize := binary.BigEndian.Uint16(data[2:4])
+	if frameSize < 24 || int(frameSize) > len(data) {
+		return ErrInvalidSize
+	}
+	data = data[:frameSize]
 	buf := bytes.NewReader(data)
 
 	// Read common header
@@ -421,10 +448,6 @@ func (c *ConfigFrame) Unpack(data []byte) error {
 		return err
 	}
 
-	if c.FrameSize < 24 {
-		return ErrInvalidSize
-	}
-
 	if err := readBinary(buf, &c.IDCode, &c.SOC, &c.FracSec, &c.TimeBase); err != nil {
 		return err
 	}
@@ -438,23 +461,25 @@ func (c *ConfigFrame) Unpack(data []byte) error {
 		return ErrInvalidSize
 	}
 
-	// Read PMU stations
+	// Read PMU stations, replacing those of a previous Unpack
+	c.PMUStationList = make([]*PMUStation, 0, numPMU)
+	c.NumPMU = 0
 	for i := 0; i < int(numPMU); i++ {
 		pmu, err := c.unpackPMUStation(buf)
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: station %d: %v", ErrInvalidSize, i+1, err)
 		}
 		c.AddPMUStation(pmu)
 	}
 
 	// Data rate
 	if err := binary.Read(buf, binary.BigEndian, &c.DataRate); err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrInvalidSize, err)
 	}
 
-	// Read CRC
-	if _, err := buf.Seek(int64(c.FrameSize-2), io.SeekStart); err != nil {
-		return err
+	// The stations have to end right before the CRC
+	if buf.Len() != 2 {
+		return ErrInvalidSize
 	}
 	if err := binary.Read(buf, binary.BigEndian, &c.CHK); err != nil {
 		return err
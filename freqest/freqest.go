@@ -0,0 +1,239 @@
+// Package freqest estimates frequency and ROCOF from the rotation of phasor
+// angles across frames, to validate or replace the FREQ and DFREQ reported by
+// devices. A quadratic is fitted to the unwrapped angle of one phasor per
+// station over a sliding window: its slope at the newest frame is the
+// frequency deviation and its curvature the ROCOF.
+package freqest
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures an Estimator
+type Options struct {
+	// Window is the number of frames fitted, at least 3, defaults to 5.
+	// Longer windows reduce noise but delay the response to changes.
+	Window int
+	// Phasors lists the phasors tracked, named "Sub 1.VA", at most one per
+	// station. Stations not listed use their first phasor.
+	Phasors []string
+	// MaxGap is the longest gap between frames the angle is unwrapped
+	// across, defaults to three frames at the configured data rate. The
+	// window restarts after longer gaps.
+	MaxGap time.Duration
+}
+
+// Estimate is the frequency and ROCOF of a station derived from its phasor
+type Estimate struct {
+	// Frequency in Hz
+	Frequency float64
+	// ROCOF in Hz/s
+	ROCOF float64
+	// Valid is false until the window is filled
+	Valid bool
+}
+
+// sample is an unwrapped angle in radians at a time in nanoseconds
+type sample struct {
+	time  int64
+	angle float64
+}
+
+// station is the window of a station
+type station struct {
+	phasor  int
+	nominal float64
+	samples []sample
+	// raw is the wrapped angle of the newest sample
+	raw float64
+}
+
+// Estimator estimates the frequency of the stations of a stream. It is not
+// safe for concurrent use.
+type Estimator struct {
+	opts      Options
+	cfg       *synchrophasor.ConfigFrame
+	stations  []station
+	estimates []Estimate
+	out       synchrophasor.Measurements
+}
+
+// New creates an estimator for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Estimator, error) {
+	if opts.Window <= 0 {
+		opts.Window = 5
+	}
+	if opts.Window < 3 {
+		return nil, fmt.Errorf("%w: window of %d frames, at least 3 needed", synchrophasor.ErrInvalidParameter, opts.Window)
+	}
+	e := &Estimator{opts: opts}
+	if err := e.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetConfig replaces the configuration, restarting the windows
+func (e *Estimator) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	stations := make([]station, len(cfg.PMUStationList))
+	phasors := make(map[string][2]int)
+	for i, pmu := range cfg.PMUStationList {
+		st := &stations[i]
+		st.nominal = float64(pmu.GetNominalFrequency())
+		st.phasor = -1
+		if len(pmu.CHNAMPhasor) > 0 {
+			st.phasor = 0
+		}
+		stn := strings.TrimSpace(pmu.STN) + "."
+		for j, name := range pmu.CHNAMPhasor {
+			phasors[stn+strings.TrimSpace(name)] = [2]int{i, j}
+		}
+	}
+
+	selected := make([]bool, len(stations))
+	for _, name := range e.opts.Phasors {
+		ref, ok := phasors[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		if selected[ref[0]] {
+			return fmt.Errorf("%w: more than one phasor of the station of %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		selected[ref[0]] = true
+		stations[ref[0]].phasor = ref[1]
+	}
+
+	e.cfg, e.stations = cfg, stations
+	e.estimates = make([]Estimate, len(stations))
+	return nil
+}
+
+// maxGap returns the longest gap in nanoseconds the angle is unwrapped across
+func (e *Estimator) maxGap() int64 {
+	if e.opts.MaxGap > 0 {
+		return int64(e.opts.MaxGap)
+	}
+	switch rate := int64(e.cfg.DataRate); {
+	case rate > 0:
+		return 3 * int64(time.Second) / rate
+	case rate < 0:
+		// Negative data rates are seconds per frame
+		return -3 * rate * int64(time.Second)
+	}
+	return int64(time.Second)
+}
+
+// Estimate adds a measurement set to the windows and returns the estimates of
+// the stations at its time. The estimates are only valid until the next call.
+// Stations with invalid data restart their window.
+func (e *Estimator) Estimate(m *synchrophasor.Measurements) ([]Estimate, error) {
+	if len(m.Stations) != len(e.stations) {
+		return nil, fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(e.stations))
+	}
+	for i, pmu := range e.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			return nil, fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := m.UnixNano()
+	gap := e.maxGap()
+	for i := range e.stations {
+		st, sm := &e.stations[i], &m.Stations[i]
+		e.estimates[i] = Estimate{}
+		if st.phasor < 0 {
+			continue
+		}
+		p := sm.Phasors[st.phasor]
+		if sm.Stat&synchrophasor.StatDataError != 0 || cmplx.IsNaN(p) || cmplx.IsInf(p) || p == 0 {
+			st.samples = st.samples[:0]
+			continue
+		}
+
+		raw := cmplx.Phase(p)
+		angle := raw
+		if n := len(st.samples); n > 0 {
+			last := st.samples[n-1]
+			if t <= last.time || t-last.time > gap {
+				st.samples = st.samples[:0]
+			} else {
+				angle = last.angle + math.Remainder(raw-st.raw, 2*math.Pi)
+			}
+		}
+		st.raw = raw
+		if len(st.samples) == e.opts.Window {
+			copy(st.samples, st.samples[1:])
+			st.samples = st.samples[:e.opts.Window-1]
+		}
+		st.samples = append(st.samples, sample{t, angle})
+		if len(st.samples) == e.opts.Window {
+			e.estimates[i] = st.estimate()
+		}
+	}
+	return e.estimates, nil
+}
+
+// estimate fits a quadratic to the window, relative to the newest sample
+func (st *station) estimate() Estimate {
+	newest := st.samples[len(st.samples)-1]
+	var s [5]float64
+	var r [3]float64
+	for _, smp := range st.samples {
+		x := float64(smp.time-newest.time) / float64(time.Second)
+		y := smp.angle - newest.angle
+		xk := 1.0
+		for k := range s {
+			s[k] += xk
+			if k < 3 {
+				r[k] += y * xk
+			}
+			xk *= x
+		}
+	}
+
+	// Normal equations of y = a + b x + c x², solved by Cramer's rule
+	det := det3(s[0], s[1], s[2], s[1], s[2], s[3], s[2], s[3], s[4])
+	if det == 0 {
+		return Estimate{}
+	}
+	b := det3(s[0], r[0], s[2], s[1], r[1], s[3], s[2], r[2], s[4]) / det
+	c := det3(s[0], s[1], r[0], s[1], s[2], r[1], s[2], s[3], r[2]) / det
+	return Estimate{
+		Frequency: st.nominal + b/(2*math.Pi),
+		ROCOF:     c / math.Pi,
+		Valid:     true,
+	}
+}
+
+// det3 returns the determinant of the 3x3 matrix given row by row
+func det3(a, b, c, d, e, f, g, h, i float64) float64 {
+	return a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+}
+
+// Replace calls fn with m whose frequency and ROCOF are replaced by the
+// estimates, flagging the modified stations. Stations without a valid
+// estimate keep their reported values. The set passed to fn is only valid
+// during the call and m is not modified.
+func (e *Estimator) Replace(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	estimates, err := e.Estimate(m)
+	if err != nil {
+		return err
+	}
+	m.CopyTo(&e.out)
+	for i, est := range estimates {
+		if !est.Valid {
+			continue
+		}
+		st := &e.out.Stations[i]
+		st.Frequency, st.ROCOF = float32(est.Frequency), float32(est.ROCOF)
+		st.Stat |= synchrophasor.StatDataModified
+	}
+	return fn(&e.out)
+}
@@ -0,0 +1,106 @@
+package freqest
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.Fnom = synchrophasor.FreqNom50Hz
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("VB", 1, synchrophasor.PhunitVoltage)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second with the VA
+// angles of the stations in radians
+func set(cfg *synchrophasor.ConfigFrame, i int, angles ...float64) *synchrophasor.Measurements {
+	for j, pmu := range cfg.PMUStationList {
+		pmu.PhasorValues[0] = cmplx.Rect(230, angles[j])
+		pmu.PhasorValues[1] = cmplx.Rect(230, angles[j]-2*math.Pi/3)
+		pmu.Freq = 50
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+// rotation returns the angle at t seconds of a phasor starting at 50.2 Hz
+// with a ROCOF of -0.5 Hz/s, relative to 50 Hz
+func rotation(t float64) float64 {
+	return 2 * math.Pi * (0.2*t - 0.25*t*t)
+}
+
+func TestEstimator(t *testing.T) {
+	cfg := testConfig()
+	e, err := New(cfg, Options{})
+	require.NoError(t, err)
+
+	for i := 0; i < 40; i++ {
+		tt := float64(i) / 10
+		est, err := e.Estimate(set(cfg, i, rotation(tt), 0.3))
+		require.NoError(t, err)
+		if i < 4 {
+			require.False(t, est[0].Valid)
+			continue
+		}
+		// The angle wraps every 5 s at 0.2 Hz, and the fit is exact for a
+		// constant ROCOF
+		require.True(t, est[0].Valid)
+		require.InDelta(t, 50.2-0.5*tt, est[0].Frequency, 1e-9)
+		require.InDelta(t, -0.5, est[0].ROCOF, 1e-6)
+		require.InDelta(t, 50, est[1].Frequency, 1e-9)
+		require.InDelta(t, 0, est[1].ROCOF, 1e-6)
+	}
+
+	// Invalid data and gaps restart the window
+	m := set(cfg, 40, 0, 0)
+	m.Stations[1].Stat = 0x8000
+	est, err := e.Estimate(m)
+	require.NoError(t, err)
+	require.True(t, est[0].Valid)
+	require.False(t, est[1].Valid)
+	est, err = e.Estimate(set(cfg, 45, 0, 0))
+	require.NoError(t, err)
+	require.False(t, est[0].Valid)
+
+	require.ErrorIs(t, func() error { _, err := e.Estimate(&synchrophasor.Measurements{}); return err }(),
+		synchrophasor.ErrInvalidParameter)
+}
+
+func TestReplace(t *testing.T) {
+	cfg := testConfig()
+	e, err := New(cfg, Options{Window: 3, Phasors: []string{"Sub 2.VB"}})
+	require.NoError(t, err)
+
+	var out *synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		out = m
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		// Sub 2 VB turns at 49.9 Hz, one turn every 10 s
+		in := set(cfg, i, 0, -2*math.Pi*0.1*float64(i)/10+2*math.Pi/3)
+		if i == 2 {
+			in.Stations[0].Stat = 0x8000
+		}
+		require.NoError(t, e.Replace(in, keep))
+		require.Equal(t, float32(50), in.Stations[1].Frequency)
+	}
+	require.Equal(t, float32(50), out.Stations[0].Frequency)
+	require.Equal(t, uint16(0x8000), out.Stations[0].Stat)
+	require.InDelta(t, 49.9, out.Stations[1].Frequency, 1e-4)
+	require.InDelta(t, 0, out.Stations[1].ROCOF, 1e-4)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), out.Stations[1].Stat)
+
+	_, err = New(cfg, Options{Window: 2})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Phasors: []string{"Sub 3.VA"}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{Phasors: []string{"Sub 1.VA", "Sub 1.VB"}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
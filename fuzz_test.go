@@ -0,0 +1,232 @@
+package synchrophasor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzConfigs builds the configurations data frames are fuzzed against,
+// covering every FORMAT combination, several stations and empty stations
+func fuzzConfigs() []*ConfigFrame {
+	var configs []*ConfigFrame
+	for format := uint16(0); format < 16; format++ {
+		cfg := NewConfigFrame()
+		cfg.IDCode = 7734
+		cfg.TimeBase = 1000000
+		cfg.DataRate = 50
+		station := NewPMUStation("Station A", 1, format&8 != 0, format&4 != 0, format&2 != 0, format&1 != 0)
+		station.AddPhasor("VA", 915527, PhunitVoltage)
+		station.AddPhasor("IA", 45776, PhunitCurrent)
+		station.AddAnalog("P", 1, AnunitPow)
+		station.AddDigital([]string{"BREAKER"}, 0, 0xFFFF)
+		cfg.AddPMUStation(station)
+		configs = append(configs, cfg)
+	}
+
+	empty := NewConfigFrame()
+	empty.TimeBase = 1000000
+	empty.DataRate = 50
+	empty.AddPMUStation(NewPMUStation("Empty", 2, false, false, false, false))
+	configs = append(configs, empty)
+
+	// Stations built without AddPhasor and friends have no value slices
+	bare := NewConfigFrame()
+	bare.TimeBase = 1000000
+	bare.DataRate = 50
+	bare.AddPMUStation(&PMUStation{STN: "Bare", Format: 0x000F, Phnmr: 2, Annmr: 1, Dgnmr: 1})
+	configs = append(configs, bare)
+
+	return append(configs, newBenchConfig(4))
+}
+
+// fuzzSeeds returns packed frames of every type
+func fuzzSeeds() [][]byte {
+	var seeds [][]byte
+	for _, cfg := range fuzzConfigs() {
+		data, _ := cfg.Pack()
+		seeds = append(seeds, data)
+		data, _ = NewDataFrame(cfg).Pack()
+		seeds = append(seeds, data)
+	}
+	header, _ := NewHeaderFrame(7734, "Header").Pack()
+	cmd := NewCommandFrame()
+	cmd.CMD = CmdExt
+	cmd.ExtraFrame = []byte{1, 2, 3, 4}
+	command, _ := cmd.Pack()
+	return append(seeds, header, command, []byte{SyncAA, 0x31, 0x00, 0x02})
+}
+
+func FuzzUnpackFrame(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	cfg := newBenchConfig(2)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = UnpackFrame(data, nil)
+		_, _ = UnpackFrame(data, cfg)
+	})
+}
+
+func FuzzConfigUnpack(f *testing.F) {
+	for _, cfg := range fuzzConfigs() {
+		data, _ := cfg.Pack()
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cfg := NewConfigFrame()
+		if err := cfg.Unpack(data); err != nil {
+			return
+		}
+
+		// A decoded configuration packs and decodes data frames consistently
+		packed, err := cfg.Pack()
+		if err != nil {
+			t.Fatalf("decoded configuration does not pack: %v", err)
+		}
+		again := NewConfigFrame()
+		if err := again.Unpack(packed); err != nil {
+			t.Fatalf("packed configuration does not decode: %v", err)
+		}
+		if len(again.PMUStationList) != len(cfg.PMUStationList) {
+			t.Fatalf("%d stations decoded as %d", len(cfg.PMUStationList), len(again.PMUStationList))
+		}
+		frame, err := NewDataFrame(cfg).Pack()
+		if err != nil {
+			t.Fatalf("data frame of decoded configuration does not pack: %v", err)
+		}
+		if err := NewDataFrame(again).Unpack(frame); err != nil {
+			t.Fatalf("data frame of decoded configuration does not decode: %v", err)
+		}
+	})
+}
+
+func FuzzDataUnpack(f *testing.F) {
+	configs := fuzzConfigs()
+	for i, cfg := range configs {
+		data, _ := NewDataFrame(cfg).Pack()
+		f.Add(uint8(i), data)
+	}
+
+	f.Fuzz(func(t *testing.T, index uint8, data []byte) {
+		serial := configs[int(index)%len(configs)]
+		// The parallel decoder writes into its own copy of the configuration
+		packed, err := serial.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parallel := NewConfigFrame()
+		if err := parallel.Unpack(packed); err != nil {
+			t.Fatal(err)
+		}
+
+		serialErr := NewDataFrame(serial).Unpack(data)
+		parallelErr := NewDataFrame(parallel).UnpackParallel(data, 4)
+		if serialErr != nil || parallelErr != nil {
+			return
+		}
+
+		// Both decoders agree on frames they accept
+		for i, station := range serial.PMUStationList {
+			want := fmt.Sprint(station.Stat, station.PhasorValues, station.Freq, station.DFreq,
+				station.AnalogValues, station.DigitalValues)
+			other := parallel.PMUStationList[i]
+			got := fmt.Sprint(other.Stat, other.PhasorValues, other.Freq, other.DFreq, other.AnalogValues, other.DigitalValues)
+			if want != got {
+				t.Fatalf("station %d decoded as %s serially and %s in parallel", i, want, got)
+			}
+		}
+	})
+}
+
+// withCRC returns frame with FRAMESIZE and CHK recomputed
+func withCRC(frame []byte) []byte {
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(frame)))
+	binary.BigEndian.PutUint16(frame[len(frame)-2:], CalcCRC(frame[:len(frame)-2]))
+	return frame
+}
+
+// padded inserts n zero bytes before the CHK of frame
+func padded(frame []byte, n int) []byte {
+	out := append([]byte(nil), frame[:len(frame)-2]...)
+	out = append(out, make([]byte, n+2)...)
+	return withCRC(out)
+}
+
+func TestUnpackMalformed(t *testing.T) {
+	cfg := newBenchConfig(2)
+	cfgBytes, err := cfg.Pack()
+	require.NoError(t, err)
+	dataBytes, err := NewDataFrame(cfg).Pack()
+	require.NoError(t, err)
+	header, err := NewHeaderFrame(1, "Header").Pack()
+	require.NoError(t, err)
+	command, err := NewCommandFrame().Pack()
+	require.NoError(t, err)
+
+	// FRAMESIZE ends before the stations
+	short := append([]byte(nil), cfgBytes...)
+	binary.BigEndian.PutUint16(short[2:], 24)
+	require.ErrorIs(t, NewConfigFrame().Unpack(short), ErrInvalidSize)
+
+	// Bytes between the stations and the CRC
+	require.ErrorIs(t, NewConfigFrame().Unpack(padded(cfgBytes, 4)), ErrInvalidSize)
+	require.ErrorIs(t, NewDataFrame(cfg).Unpack(padded(dataBytes, 4)), ErrInvalidSize)
+	require.ErrorIs(t, NewDataFrame(cfg).UnpackParallel(padded(dataBytes, 4), 2), ErrInvalidSize)
+
+	// FRAMESIZE beyond the data
+	for _, frame := range [][]byte{header, command} {
+		long := append([]byte(nil), frame...)
+		binary.BigEndian.PutUint16(long[2:], uint16(len(frame)+10))
+		_, err := UnpackFrame(long, nil)
+		require.ErrorIs(t, err, ErrInvalidSize)
+	}
+}
+
+func TestConfigUnpackReuse(t *testing.T) {
+	data, err := newBenchConfig(2).Pack()
+	require.NoError(t, err)
+
+	cfg := NewConfigFrame()
+	require.NoError(t, cfg.Unpack(data))
+	require.NoError(t, cfg.Unpack(data))
+	require.Len(t, cfg.PMUStationList, 2)
+	require.Equal(t, uint16(2), cfg.NumPMU)
+}
+
+func TestPackCounts(t *testing.T) {
+	// A station whose counts exceed its names, units and values
+	cfg := NewConfigFrame()
+	cfg.TimeBase = 1000000
+	cfg.AddPMUStation(&PMUStation{STN: "Bare", Format: 0x000F, Phnmr: 2, Annmr: 1, Dgnmr: 1})
+
+	data, err := cfg.Pack()
+	require.NoError(t, err)
+	decoded := NewConfigFrame()
+	require.NoError(t, decoded.Unpack(data))
+	require.Equal(t, uint16(2), decoded.PMUStationList[0].Phnmr)
+
+	frame, err := NewDataFrame(cfg).Pack()
+	require.NoError(t, err)
+	bare := NewConfigFrame()
+	bare.AddPMUStation(&PMUStation{Format: 0x000F, Phnmr: 2, Annmr: 1, Dgnmr: 1})
+	require.NoError(t, NewDataFrame(bare).Unpack(frame))
+	require.Len(t, bare.PMUStationList[0].PhasorValues, 2)
+	require.Len(t, bare.PMUStationList[0].DigitalValues[0], 16)
+
+	// Channel counts that do not fit a frame
+	huge := NewConfigFrame()
+	huge.AddPMUStation(&PMUStation{Phnmr: 5000})
+	_, err = huge.Pack()
+	require.ErrorIs(t, err, ErrInvalidSize)
+	_, err = NewDataFrame(huge).Pack()
+	require.NoError(t, err)
+	huge.PMUStationList[0].Phnmr = 9000
+	huge.PMUStationList[0].Format = 0x0002
+	_, err = NewDataFrame(huge).Pack()
+	require.ErrorIs(t, err, ErrInvalidSize)
+}
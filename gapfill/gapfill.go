@@ -0,0 +1,342 @@
+// Package gapfill fills the gaps of aligned measurement streams: measurement
+// sets missing at the configured data rate are inserted and the values of
+// stations flagged invalid are replaced, holding the last value,
+// interpolating or marking them NaN per channel
+package gapfill
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Policy selects how missing samples of a channel are filled
+type Policy uint8
+
+const (
+	// PolicyHold repeats the last valid sample
+	PolicyHold Policy = iota
+	// PolicyLinear interpolates between the valid samples around missing
+	// sets, phasors by magnitude and shortest angle. Invalid samples of
+	// received sets are held, as the next valid sample is not known yet.
+	PolicyLinear
+	// PolicyNaN marks missing samples as NaN
+	PolicyNaN
+)
+
+// STAT bits of filled stations
+const (
+	// statAbsentData flags inserted absent data that must not be used
+	statAbsentData = 0x8000
+)
+
+// Options configures a Filler
+type Options struct {
+	// Policy applies to the channels without an entry in Policies, defaults
+	// to PolicyHold
+	Policy Policy
+	// Policies selects the policy of single channels named like "Sub 1.freq",
+	// "Sub 1.rocof" or "Sub 1.<phasor>" and "Sub 1.<analog>" by channel name.
+	// Digital channels always hold their last value.
+	Policies map[string]Policy
+	// MaxGap is the longest gap filled, defaults to one second. Longer gaps
+	// are passed on unfilled, and samples after them marked NaN until a
+	// valid one arrives.
+	MaxGap time.Duration
+}
+
+// Stats counts the filled samples
+type Stats struct {
+	// Sets is the number of inserted measurement sets
+	Sets uint64
+	// Skipped is the number of missing sets not inserted because the gap
+	// exceeded MaxGap
+	Skipped uint64
+	// Filled is the number of filled samples by channel name
+	Filled map[string]uint64
+}
+
+// station is the last valid sample of a station
+type station struct {
+	m     synchrophasor.StationMeasurement
+	time  int64
+	valid bool
+	// first is the index of the station's first channel, which are the
+	// frequency, ROCOF, phasors and analogs in this order
+	first int
+}
+
+// Filler fills the gaps of a stream of measurement sets. Fill must be called
+// from a single goroutine, Stats may be called concurrently.
+type Filler struct {
+	opts     Options
+	mu       sync.Mutex
+	cfg      *synchrophasor.ConfigFrame
+	stations []station
+	names    []string
+	policies []Policy
+	filled   []uint64
+	sets     uint64
+	skipped  uint64
+	// last is the time of the latest set, zero before the first one
+	last int64
+	// gap and cur hold inserted sets and repaired received sets
+	gap, cur synchrophasor.Measurements
+}
+
+// New creates a filler for measurements of the given configuration. Policies
+// of channels not in the configuration are rejected.
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Filler, error) {
+	if opts.MaxGap <= 0 {
+		opts.MaxGap = time.Second
+	}
+	f := &Filler{opts: opts}
+	if err := f.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetConfig replaces the configuration, restarting the gap detection. The
+// counters of channels kept by name are carried over.
+func (f *Filler) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.setConfig(cfg)
+}
+
+// setConfig builds the channel table of cfg, f.mu must be held
+func (f *Filler) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	var names []string
+	stations := make([]station, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN) + "."
+		stations[i].first = len(names)
+		names = append(names, stn+"freq", stn+"rocof")
+		for _, name := range pmu.CHNAMPhasor {
+			names = append(names, stn+strings.TrimSpace(name))
+		}
+		for _, name := range pmu.CHNAMAnalog {
+			names = append(names, stn+strings.TrimSpace(name))
+		}
+	}
+
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	policies := make([]Policy, len(names))
+	for i := range policies {
+		policies[i] = f.opts.Policy
+	}
+	for name, policy := range f.opts.Policies {
+		i, ok := index[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown channel %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		policies[i] = policy
+	}
+
+	filled := make([]uint64, len(names))
+	for i, name := range f.names {
+		if j, ok := index[name]; ok {
+			filled[j] = f.filled[i]
+		}
+	}
+
+	f.cfg, f.stations, f.names, f.policies, f.filled = cfg, stations, names, policies, filled
+	f.last = 0
+	return nil
+}
+
+// Stats returns the counters of filled samples
+func (f *Filler) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := Stats{Sets: f.sets, Skipped: f.skipped, Filled: make(map[string]uint64, len(f.names))}
+	for i, name := range f.names {
+		s.Filled[name] = f.filled[i]
+	}
+	return s
+}
+
+// interval returns the time between sets at the configured data rate, zero
+// if it is not set
+func (f *Filler) interval() int64 {
+	switch rate := int64(f.cfg.DataRate); {
+	case rate > 0:
+		return int64(time.Second) / rate
+	case rate < 0:
+		// Negative data rates are seconds per frame
+		return -rate * int64(time.Second)
+	}
+	return 0
+}
+
+// Fill passes m to fn, preceded by the sets inserted for the sets missing
+// before it. Stations of m flagged invalid are passed filled. The sets passed
+// to fn are only valid during the call and m is not modified.
+func (f *Filler) Fill(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(m.Stations) != len(f.stations) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(f.stations))
+	}
+	for i, pmu := range f.cfg.PMUStationList {
+		if st := &m.Stations[i]; len(st.Phasors) != len(pmu.CHNAMPhasor) || len(st.Analog) != len(pmu.CHNAMAnalog) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+	t := m.UnixNano()
+	if f.last != 0 && t <= f.last {
+		return fmt.Errorf("%w: measurement time %v not after the latest one",
+			synchrophasor.ErrInvalidParameter, time.Unix(0, t).UTC())
+	}
+
+	// Insert the missing sets
+	if interval := f.interval(); f.last != 0 && interval > 0 && t-f.last > interval*3/2 {
+		missing := (t-f.last+interval/2)/interval - 1
+		if time.Duration(missing*interval) > f.opts.MaxGap {
+			f.skipped += uint64(missing)
+		} else {
+			f.gap.PMUID = m.PMUID
+			f.gap.Stations = slices.Grow(f.gap.Stations[:0], len(m.Stations))[:len(m.Stations)]
+			for k := int64(1); k <= missing; k++ {
+				tk := f.last + k*interval
+				f.gap.Time = float64(tk) / 1e9
+				for i := range m.Stations {
+					f.fillStation(&f.gap.Stations[i], i, tk, &m.Stations[i], t, valid(&m.Stations[i]))
+				}
+				f.sets++
+				f.mu.Unlock()
+				err := fn(&f.gap)
+				f.mu.Lock()
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	f.last = t
+
+	// Repair the invalid stations of m
+	out := m
+	for i := range m.Stations {
+		if valid(&m.Stations[i]) {
+			continue
+		}
+		if out == m {
+			m.CopyTo(&f.cur)
+			out = &f.cur
+		}
+		f.fillStation(&f.cur.Stations[i], i, t, &m.Stations[i], t, false)
+	}
+	for i := range m.Stations {
+		if st := &m.Stations[i]; valid(st) {
+			s := &f.stations[i]
+			st.CopyTo(&s.m)
+			s.time, s.valid = t, true
+		}
+	}
+
+	f.mu.Unlock()
+	err := fn(out)
+	f.mu.Lock()
+	return err
+}
+
+// fillStation fills the sample of station i at time t into dst from the last
+// valid sample and next, the sample received at time nextT
+func (f *Filler) fillStation(dst *synchrophasor.StationMeasurement, i int, t int64,
+	next *synchrophasor.StationMeasurement, nextT int64, nextValid bool) {
+	s := &f.stations[i]
+	held := s.valid && t-s.time <= int64(f.opts.MaxGap)
+	if held {
+		(&s.m).CopyTo(dst)
+	} else {
+		next.CopyTo(dst)
+	}
+
+	// w is the weight of next for linear interpolation
+	w := -1.0
+	if held && nextValid && nextT > s.time {
+		w = float64(t-s.time) / float64(nextT-s.time)
+	}
+
+	nan := false
+	channels := 2 + len(dst.Phasors) + len(dst.Analog)
+	for j := 0; j < channels; j++ {
+		policy := f.policies[s.first+j]
+		switch {
+		case !held:
+			policy = PolicyNaN
+		case policy == PolicyLinear && w < 0:
+			policy = PolicyHold
+		}
+		switch policy {
+		case PolicyLinear:
+			interpolate(dst, next, j, w)
+		case PolicyNaN:
+			setNaN(dst, j)
+			nan = true
+		}
+		f.filled[s.first+j]++
+	}
+
+	if !held {
+		dst.Stat = next.Stat
+	}
+	dst.Stat = dst.Stat&^synchrophasor.StatDataError | synchrophasor.StatDataModified
+	if nan {
+		dst.Stat |= statAbsentData
+	}
+}
+
+// interpolate moves channel j of dst, holding the last valid sample, towards
+// next by the weight w
+func interpolate(dst, next *synchrophasor.StationMeasurement, j int, w float64) {
+	lerp := func(a, b float64) float64 { return a + (b-a)*w }
+	switch {
+	case j == 0:
+		dst.Frequency = float32(lerp(float64(dst.Frequency), float64(next.Frequency)))
+	case j == 1:
+		dst.ROCOF = float32(lerp(float64(dst.ROCOF), float64(next.ROCOF)))
+	case j-2 < len(dst.Phasors):
+		a, b := dst.Phasors[j-2], next.Phasors[j-2]
+		// Interpolate the angle along the shorter arc
+		phase := cmplx.Phase(a)
+		diff := math.Remainder(cmplx.Phase(b)-phase, 2*math.Pi)
+		dst.Phasors[j-2] = cmplx.Rect(lerp(cmplx.Abs(a), cmplx.Abs(b)), phase+diff*w)
+	default:
+		k := j - 2 - len(dst.Phasors)
+		dst.Analog[k] = float32(lerp(float64(dst.Analog[k]), float64(next.Analog[k])))
+	}
+}
+
+// setNaN marks channel j of dst as NaN
+func setNaN(dst *synchrophasor.StationMeasurement, j int) {
+	nan := math.NaN()
+	switch {
+	case j == 0:
+		dst.Frequency = float32(nan)
+	case j == 1:
+		dst.ROCOF = float32(nan)
+	case j-2 < len(dst.Phasors):
+		dst.Phasors[j-2] = complex(nan, nan)
+	default:
+		dst.Analog[j-2-len(dst.Phasors)] = float32(nan)
+	}
+}
+
+// valid reports whether the data error bits of a station are clear
+func valid(st *synchrophasor.StationMeasurement) bool {
+	return st.Stat&synchrophasor.StatDataError == 0
+}
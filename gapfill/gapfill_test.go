@@ -0,0 +1,122 @@
+package gapfill
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second, Sub 1
+// at 50 + i/100 Hz with its VA angle at 170 + 10i degrees
+func set(cfg *synchrophasor.ConfigFrame, i int, stat uint16) *synchrophasor.Measurements {
+	sub := cfg.PMUStationList[0]
+	sub.Stat = stat
+	sub.Freq = 50 + float32(i)/100
+	sub.PhasorValues[0] = cmplx.Rect(100+float64(i), float64(170+10*i)*math.Pi/180)
+	sub.AnalogValues[0] = float32(i)
+	sub.DigitalValues[0][0] = i%2 == 1
+	return testutil.Measurements(cfg, i)
+}
+
+// collect returns a callback appending copies of the sets passed to it
+func collect(out *[]synchrophasor.Measurements) func(*synchrophasor.Measurements) error {
+	return func(m *synchrophasor.Measurements) error {
+		var c synchrophasor.Measurements
+		m.CopyTo(&c)
+		*out = append(*out, c)
+		return nil
+	}
+}
+
+func angle(p complex128) float64 {
+	return cmplx.Phase(p) * 180 / math.Pi
+}
+
+func TestFill(t *testing.T) {
+	cfg := testConfig()
+	f, err := New(cfg, Options{
+		Policy:   PolicyLinear,
+		Policies: map[string]Policy{"Sub 1.P": PolicyNaN, "Sub 2.freq": PolicyHold},
+	})
+	require.NoError(t, err)
+
+	// Frames 1 and 2 are missing
+	var out []synchrophasor.Measurements
+	require.NoError(t, f.Fill(set(cfg, 0, 0), collect(&out)))
+	require.NoError(t, f.Fill(set(cfg, 3, 0), collect(&out)))
+	require.Len(t, out, 4)
+
+	first := out[1].Stations[0]
+	require.InDelta(t, 1700000000.1, out[1].Time, 1e-6)
+	require.InDelta(t, 50.01, first.Frequency, 1e-5)
+	require.InDelta(t, 101, cmplx.Abs(first.Phasors[0]), 1e-9)
+	// The angle passes 180 degrees along the shorter arc
+	require.InDelta(t, 180, math.Abs(angle(first.Phasors[0])), 1e-9)
+	require.InDelta(t, -170, angle(out[2].Stations[0].Phasors[0]), 1e-9)
+	require.True(t, math.IsNaN(float64(first.Analog[0])))
+	require.Equal(t, []bool{false}, first.Digital[0][:1])
+	require.Equal(t, uint16(statAbsentData|synchrophasor.StatDataModified), first.Stat)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), out[1].Stations[1].Stat)
+	require.Equal(t, uint16(0), out[3].Stations[0].Stat)
+
+	// An invalid station of a received set is held, linear falling back
+	out = out[:0]
+	invalid := set(cfg, 4, 0x4000)
+	require.NoError(t, f.Fill(invalid, collect(&out)))
+	require.Len(t, out, 1)
+	require.InDelta(t, 50.03, out[0].Stations[0].Frequency, 1e-5)
+	require.Equal(t, uint16(0x4000), invalid.Stations[0].Stat)
+	require.Equal(t, uint16(statAbsentData|synchrophasor.StatDataModified), out[0].Stations[0].Stat)
+
+	// Gaps beyond MaxGap are not filled and the stale samples not held
+	out = out[:0]
+	require.NoError(t, f.Fill(set(cfg, 30, 0xC000), collect(&out)))
+	require.Len(t, out, 1)
+	require.True(t, math.IsNaN(float64(out[0].Stations[0].Frequency)))
+
+	stats := f.Stats()
+	require.Equal(t, uint64(2), stats.Sets)
+	require.Equal(t, uint64(25), stats.Skipped)
+	require.Equal(t, uint64(4), stats.Filled["Sub 1.freq"])
+	require.Equal(t, uint64(2), stats.Filled["Sub 2.VA"])
+
+	require.ErrorIs(t, f.Fill(set(cfg, 30, 0), collect(&out)), synchrophasor.ErrInvalidParameter)
+	require.ErrorIs(t, f.Fill(&synchrophasor.Measurements{}, collect(&out)), synchrophasor.ErrInvalidParameter)
+	require.NoError(t, f.SetConfig(cfg))
+	require.Equal(t, uint64(4), f.Stats().Filled["Sub 1.freq"])
+}
+
+func TestFillHold(t *testing.T) {
+	cfg := testConfig()
+	slow := cfg.Clone()
+	slow.DataRate = -2
+	f, err := New(slow, Options{MaxGap: 10 * time.Second})
+	require.NoError(t, err)
+
+	// One frame every two seconds
+	var out []synchrophasor.Measurements
+	require.NoError(t, f.Fill(set(cfg, 0, 0), collect(&out)))
+	require.NoError(t, f.Fill(set(cfg, 60, 0), collect(&out)))
+	require.Len(t, out, 4)
+	for _, m := range out[1:3] {
+		require.InDelta(t, 50, m.Stations[0].Frequency, 1e-5)
+		require.InDelta(t, 170, angle(m.Stations[0].Phasors[0]), 1e-9)
+	}
+	require.InDelta(t, 1700000004, out[2].Time, 1e-6)
+
+	_, err = New(cfg, Options{Policies: map[string]Policy{"Sub 3.freq": PolicyNaN}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
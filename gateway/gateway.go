@@ -0,0 +1,271 @@
+// Package gateway republishes upstream C37.118 streams downstream, e.g. to
+// bridge a UDP stream onto TLS, renumbering ID codes and renaming or
+// filtering stations and channels on the way
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Upstream is the stream consumed by a route
+type Upstream struct {
+	// Network is "tcp", "tls" or "udp", defaults to "tcp"
+	Network string
+	// Address of the PMU or PDC, or the local address receiving the
+	// datagrams of a spontaneous UDP stream
+	Address string
+	// TLS configures the "tls" network
+	TLS *tls.Config
+	// Listen receives a spontaneous UDP stream on Address instead of
+	// requesting it. The configuration is taken from the stream.
+	Listen bool
+	// IDCode is sent in the commands to the upstream PMU
+	IDCode uint16
+}
+
+// Downstream is the server republishing a route
+type Downstream struct {
+	// PMU serves the stream, created if nil. It is set to publish only and
+	// started once the upstream configuration is known.
+	PMU *synchrophasor.PMU
+	// Address to listen on for PDCs
+	Address string
+	// TLS serves TLS instead of plain TCP on Address
+	TLS *tls.Config
+	// Listener is used instead of Address if set
+	Listener net.Listener
+}
+
+// Route connects an upstream stream to a downstream server
+type Route struct {
+	Upstream   Upstream
+	Downstream Downstream
+	// IDCode renumbers the stream, zero keeps the upstream ID code
+	IDCode uint16
+	// Stations selects the republished stations in their downstream order,
+	// all of them if empty
+	Stations []Station
+}
+
+// Options configures a Gateway
+type Options struct {
+	// Retry is the delay before reconnecting a failed upstream, defaults to
+	// five seconds
+	Retry time.Duration
+	// OnError is called with the errors of the routes, identified by their
+	// index
+	OnError func(route int, err error)
+}
+
+// Gateway runs routes
+type Gateway struct {
+	routes []*route
+	opts   Options
+}
+
+// route is a running Route
+type route struct {
+	Route
+	pmu     *synchrophasor.PMU
+	started bool
+	mapping *mapping
+}
+
+// New creates a gateway for the routes and sets their downstream PMUs to
+// publish only, so it must be called before they are started
+func New(routes []Route, opts Options) (*Gateway, error) {
+	if opts.Retry <= 0 {
+		opts.Retry = 5 * time.Second
+	}
+	g := &Gateway{opts: opts}
+	for i, rt := range routes {
+		switch rt.Upstream.Network {
+		case "":
+			rt.Upstream.Network = "tcp"
+		case "tcp", "tls", "udp":
+		default:
+			return nil, fmt.Errorf("%w: route %d: unknown network %q",
+				synchrophasor.ErrInvalidParameter, i, rt.Upstream.Network)
+		}
+		if rt.Upstream.Listen && rt.Upstream.Network != "udp" {
+			return nil, fmt.Errorf("%w: route %d: only UDP streams can be received spontaneously",
+				synchrophasor.ErrInvalidParameter, i)
+		}
+		if rt.Downstream.Address == "" && rt.Downstream.Listener == nil {
+			return nil, fmt.Errorf("%w: route %d: no downstream address", synchrophasor.ErrInvalidParameter, i)
+		}
+
+		pmu := rt.Downstream.PMU
+		if pmu == nil {
+			pmu = synchrophasor.NewPMU()
+		}
+		pmu.SetPublishOnly(true)
+		g.routes = append(g.routes, &route{Route: rt, pmu: pmu})
+	}
+	return g, nil
+}
+
+// Run streams all routes until ctx is done, reconnecting failed upstreams,
+// and stops the downstream servers
+func (g *Gateway) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i, rt := range g.routes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.run(ctx, i, rt)
+		}()
+	}
+	wg.Wait()
+
+	for _, rt := range g.routes {
+		if rt.started {
+			rt.pmu.Stop()
+		}
+	}
+	return ctx.Err()
+}
+
+// run streams a route until ctx is done
+func (g *Gateway) run(ctx context.Context, i int, rt *route) {
+	for {
+		err := g.stream(ctx, rt)
+		if ctx.Err() != nil {
+			return
+		}
+		if g.opts.OnError != nil {
+			g.opts.OnError(i, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(g.opts.Retry):
+		}
+	}
+}
+
+// stream republishes the upstream of a route until it fails or ctx is done
+func (g *Gateway) stream(ctx context.Context, rt *route) error {
+	pdc, err := connect(&rt.Upstream)
+	if err != nil {
+		return err
+	}
+	defer pdc.Disconnect()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = pdc.Socket.Close()
+		case <-done:
+		}
+	}()
+
+	if !rt.Upstream.Listen {
+		cfg, err := pdc.GetConfig(2)
+		if err != nil {
+			return err
+		}
+		if err := rt.setConfig(cfg); err != nil {
+			return err
+		}
+		if err := pdc.Start(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		frame, err := pdc.ReadFrame()
+		if synchrophasor.IsFrameError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		switch f := frame.(type) {
+		case *synchrophasor.ConfigFrame:
+			pdc.PMUConfig2 = f
+			if err := rt.setConfig(f); err != nil {
+				return err
+			}
+		case *synchrophasor.DataFrame:
+			if rt.mapping == nil || f.AssociatedConfig != rt.mapping.up {
+				continue
+			}
+			data, err := rt.mapping.frame(f)
+			if err != nil {
+				return err
+			}
+			if err := rt.pmu.Publish(data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// connect opens the upstream stream
+func connect(up *Upstream) (*synchrophasor.PDC, error) {
+	pdc := synchrophasor.NewPDC(up.IDCode)
+	switch {
+	case up.Network == "tls":
+		return pdc, pdc.ConnectTLS(up.Address, up.TLS)
+	case up.Network == "tcp":
+		return pdc, pdc.Connect(up.Address)
+	}
+
+	var conn net.Conn
+	if up.Listen {
+		addr, err := net.ResolveUDPAddr("udp", up.Address)
+		if err != nil {
+			return nil, err
+		}
+		if conn, err = net.ListenUDP("udp", addr); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if conn, err = net.Dial("udp", up.Address); err != nil {
+			return nil, err
+		}
+	}
+	pdc.Socket = conn
+	return pdc, nil
+}
+
+// setConfig switches the route to a new upstream configuration, starting the
+// downstream server on the first one
+func (rt *route) setConfig(up *synchrophasor.ConfigFrame) error {
+	m, err := newMapping(up, &rt.Route)
+	if err != nil {
+		return err
+	}
+	rt.mapping = m
+	rt.pmu.SetConfig(m.cfg)
+	if rt.started {
+		return nil
+	}
+
+	if rt.pmu.Header == nil {
+		rt.pmu.Header = synchrophasor.NewHeaderFrame(m.cfg.IDCode, "synchrophasor gateway")
+	}
+	ds := &rt.Downstream
+	switch {
+	case ds.Listener != nil:
+		go func() { _ = rt.pmu.Serve(ds.Listener) }()
+	case ds.TLS != nil:
+		err = rt.pmu.StartTLS(ds.Address, ds.TLS)
+	default:
+		err = rt.pmu.Start(ds.Address)
+	}
+	rt.started = err == nil
+	return err
+}
@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 10
+	for i, name := range []string{"Sub 1", "Sub 2"} {
+		station := synchrophasor.NewPMUStation(name, uint16(10+i), true, true, true, true)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("VB", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.AddAnalog("Q", 1, 0)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+		cfg.AddPMUStation(station)
+	}
+	return cfg
+}
+
+// dataFrame returns a data frame of cfg at 1700000000 with VB of Sub 2 at
+// 230 V and its Q at 5
+func dataFrame(t *testing.T, cfg *synchrophasor.ConfigFrame) []byte {
+	sub := cfg.PMUStationList[1]
+	sub.Freq = 50.01
+	sub.PhasorValues[1] = 230
+	sub.AnalogValues[1] = 5
+	df := synchrophasor.NewDataFrame(cfg)
+	df.IDCode = cfg.IDCode
+	df.SOC = 1700000000
+	frame, err := df.Pack()
+	require.NoError(t, err)
+	return frame
+}
+
+// commands notes the start command of a PDC
+type commands struct {
+	synchrophasor.MetricsRecorder
+	started atomic.Bool
+}
+
+func (c *commands) RecordCommand(cmdType string) {
+	if cmdType == "START" {
+		c.started.Store(true)
+	}
+}
+
+func (c *commands) RecordClientConnected()    {}
+func (c *commands) RecordClientDisconnected() {}
+func (c *commands) RecordBytesReceived(int)   {}
+func (c *commands) RecordConfigFrameSent(int) {}
+func (c *commands) RecordDataFrameSent(int)   {}
+
+// testRoute returns a route republishing VB and Q of Sub 2 renamed
+func testRoute(t *testing.T, up Upstream) (Route, *commands) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	pmu := synchrophasor.NewPMU()
+	cmds := &commands{}
+	pmu.SetMetrics(cmds)
+	return Route{
+		Upstream:   up,
+		Downstream: Downstream{PMU: pmu, Listener: listener},
+		IDCode:     99,
+		Stations: []Station{{
+			IDCode:    11,
+			NewIDCode: 21,
+			Name:      "Bay 2",
+			Keep:      []string{"VB", "Q"},
+			Channels:  map[string]string{"VB": "V2"},
+		}},
+	}, cmds
+}
+
+// receive connects a PDC to the downstream of rt, checks the republished
+// configuration and returns its first data frame, publishing upstream frames
+// with publish until then
+func receive(t *testing.T, rt Route, cmds *commands, publish func()) *synchrophasor.DataFrame {
+	pdc := synchrophasor.NewPDC(1)
+	require.NoError(t, pdc.Connect(rt.Downstream.Listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	cfg, err := pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.Equal(t, uint16(99), cfg.IDCode)
+	require.Len(t, cfg.PMUStationList, 1)
+	station := cfg.PMUStationList[0]
+	require.Equal(t, uint16(21), station.IDCode)
+	require.Equal(t, "Bay 2", strings.TrimSpace(station.STN))
+	require.Len(t, station.CHNAMPhasor, 1)
+	require.Equal(t, "V2", strings.TrimSpace(station.CHNAMPhasor[0]))
+	require.Len(t, station.CHNAMAnalog, 1)
+	require.Equal(t, "Q", strings.TrimSpace(station.CHNAMAnalog[0]))
+	require.Equal(t, uint16(0), station.Dgnmr)
+
+	require.NoError(t, pdc.Start())
+	require.Eventually(t, cmds.started.Load, 5*time.Second, time.Millisecond)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(10 * time.Millisecond):
+				publish()
+			}
+		}
+	}()
+
+	for {
+		frame, err := pdc.ReadFrame()
+		require.NoError(t, err)
+		if df, ok := frame.(*synchrophasor.DataFrame); ok {
+			require.Equal(t, uint16(99), df.IDCode)
+			require.Equal(t, uint32(1700000000), df.SOC)
+			return df
+		}
+	}
+}
+
+func TestGatewayTCP(t *testing.T) {
+	upCfg := testConfig()
+	frame := dataFrame(t, upCfg)
+	upstream := synchrophasor.NewPMU()
+	upstream.SetPublishOnly(true)
+	upstream.SetConfig(testConfig())
+	upCmds := &commands{}
+	upstream.SetMetrics(upCmds)
+	require.NoError(t, upstream.Start("127.0.0.1:0"))
+	defer upstream.Stop()
+
+	rt, cmds := testRoute(t, Upstream{Address: upstream.Socket.Addr().String()})
+	var errs atomic.Int32
+	g, err := New([]Route{rt}, Options{OnError: func(int, error) { errs.Add(1) }})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- g.Run(ctx) }()
+	require.Eventually(t, upCmds.started.Load, 5*time.Second, time.Millisecond)
+
+	df := receive(t, rt, cmds, func() { _ = upstream.Publish(frame) })
+	station := df.AssociatedConfig.PMUStationList[0]
+	require.InDelta(t, 50.01, station.Freq, 1e-4)
+	require.InDelta(t, 230, real(station.PhasorValues[0]), 1e-3)
+	require.InDelta(t, 5, station.AnalogValues[0], 1e-6)
+
+	cancel()
+	require.ErrorIs(t, <-result, context.Canceled)
+	require.Zero(t, errs.Load())
+}
+
+func TestGatewayUDP(t *testing.T) {
+	// Reserve a local port for the spontaneous stream
+	probe, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	addr := probe.LocalAddr().String()
+	require.NoError(t, probe.Close())
+
+	rt, cmds := testRoute(t, Upstream{Network: "udp", Address: addr, Listen: true})
+	g, err := New([]Route{rt}, Options{Retry: 10 * time.Millisecond})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- g.Run(ctx) }()
+
+	upCfg := testConfig()
+	cfgFrame, err := upCfg.Pack()
+	require.NoError(t, err)
+	frame := dataFrame(t, upCfg)
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The configuration is repeated until the downstream server is up
+	require.Eventually(t, func() bool {
+		_, _ = conn.Write(cfgFrame)
+		return rt.Downstream.PMU.IsRunning()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	df := receive(t, rt, cmds, func() { _, _ = conn.Write(frame) })
+	require.InDelta(t, 230, real(df.AssociatedConfig.PMUStationList[0].PhasorValues[0]), 1e-3)
+
+	cancel()
+	require.ErrorIs(t, <-result, context.Canceled)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New([]Route{{Upstream: Upstream{Network: "sctp"}, Downstream: Downstream{Address: ":4712"}}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New([]Route{{Upstream: Upstream{Listen: true}, Downstream: Downstream{Address: ":4712"}}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = New([]Route{{}}, Options{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+
+	_, err = newMapping(testConfig(), &Route{Stations: []Station{{IDCode: 12}}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
@@ -0,0 +1,181 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Station selects an upstream station for republishing
+type Station struct {
+	// IDCode of the upstream station
+	IDCode uint16
+	// NewIDCode renumbers the station, zero keeps its ID code
+	NewIDCode uint16
+	// Name renames the station, empty keeps its name
+	Name string
+	// Keep lists the phasor, analog and digital channels republished by
+	// upstream name, all if empty. Digital words are kept if any of their
+	// channels is.
+	Keep []string
+	// Channels renames channels by upstream name
+	Channels map[string]string
+}
+
+// stationMap locates the republished channels of a station upstream
+type stationMap struct {
+	src                        int
+	phasors, analogs, digitals []int
+}
+
+// mapping translates the frames of an upstream configuration
+type mapping struct {
+	up, cfg  *synchrophasor.ConfigFrame
+	stations []stationMap
+	df       *synchrophasor.DataFrame
+	buf      []byte
+}
+
+// newMapping derives the downstream configuration of a route from the
+// upstream one
+func newMapping(up *synchrophasor.ConfigFrame, rt *Route) (*mapping, error) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = up.IDCode
+	if rt.IDCode != 0 {
+		cfg.IDCode = rt.IDCode
+	}
+	cfg.TimeBase = up.TimeBase
+	cfg.DataRate = up.DataRate
+	m := &mapping{up: up, cfg: cfg}
+
+	selected := rt.Stations
+	if len(selected) == 0 {
+		for _, pmu := range up.PMUStationList {
+			selected = append(selected, Station{IDCode: pmu.IDCode})
+		}
+	}
+	for _, sel := range selected {
+		src := -1
+		for i, pmu := range up.PMUStationList {
+			if pmu.IDCode == sel.IDCode {
+				src = i
+				break
+			}
+		}
+		if src < 0 {
+			return nil, fmt.Errorf("%w: station %d not in the upstream configuration",
+				synchrophasor.ErrInvalidParameter, sel.IDCode)
+		}
+		pmu, sm := mapStation(up.PMUStationList[src], &sel)
+		sm.src = src
+		cfg.AddPMUStation(pmu)
+		m.stations = append(m.stations, sm)
+	}
+
+	m.df = synchrophasor.NewDataFrame(cfg)
+	m.df.IDCode = cfg.IDCode
+	return m, nil
+}
+
+// mapStation returns the republished station and its channel indices
+func mapStation(src *synchrophasor.PMUStation, sel *Station) (*synchrophasor.PMUStation, stationMap) {
+	keep := func(name string) bool {
+		if len(sel.Keep) == 0 {
+			return true
+		}
+		name = strings.TrimSpace(name)
+		for _, k := range sel.Keep {
+			if k == name {
+				return true
+			}
+		}
+		return false
+	}
+	rename := func(name string) string {
+		if to, ok := sel.Channels[strings.TrimSpace(name)]; ok {
+			return to
+		}
+		return name
+	}
+
+	dst := &synchrophasor.PMUStation{
+		STN:    src.STN,
+		Format: src.Format,
+		Fnom:   src.Fnom,
+		CfgCnt: src.CfgCnt,
+	}
+	dst.IDCode = src.IDCode
+	if sel.NewIDCode != 0 {
+		dst.IDCode = sel.NewIDCode
+	}
+	if sel.Name != "" {
+		dst.STN = sel.Name
+	}
+
+	var sm stationMap
+	for j, name := range src.CHNAMPhasor {
+		if keep(name) {
+			dst.CHNAMPhasor = append(dst.CHNAMPhasor, rename(name))
+			dst.Phunit = append(dst.Phunit, src.Phunit[j])
+			sm.phasors = append(sm.phasors, j)
+		}
+	}
+	for j, name := range src.CHNAMAnalog {
+		if keep(name) {
+			dst.CHNAMAnalog = append(dst.CHNAMAnalog, rename(name))
+			dst.Anunit = append(dst.Anunit, src.Anunit[j])
+			sm.analogs = append(sm.analogs, j)
+		}
+	}
+	for k := 0; k < int(src.Dgnmr); k++ {
+		names := make([]string, 16)
+		kept := false
+		for b := range names {
+			if i := 16*k + b; i < len(src.CHNAMDigital) {
+				names[b] = rename(src.CHNAMDigital[i])
+				kept = kept || strings.TrimSpace(src.CHNAMDigital[i]) != "" && keep(src.CHNAMDigital[i])
+			}
+		}
+		if kept {
+			dst.CHNAMDigital = append(dst.CHNAMDigital, names...)
+			dst.Dgunit = append(dst.Dgunit, src.Dgunit[k])
+			sm.digitals = append(sm.digitals, k)
+		}
+	}
+
+	dst.Phnmr = uint16(len(sm.phasors))
+	dst.Annmr = uint16(len(sm.analogs))
+	dst.Dgnmr = uint16(len(sm.digitals))
+	dst.PhasorValues = make([]complex128, dst.Phnmr)
+	dst.AnalogValues = make([]float32, dst.Annmr)
+	dst.DigitalValues = make([][]bool, dst.Dgnmr)
+	for k := range dst.DigitalValues {
+		dst.DigitalValues[k] = make([]bool, 16)
+	}
+	return dst, sm
+}
+
+// frame packs an upstream data frame, decoded into the upstream
+// configuration, as a downstream data frame
+func (m *mapping) frame(df *synchrophasor.DataFrame) ([]byte, error) {
+	m.df.SOC, m.df.FracSec = df.SOC, df.FracSec
+	for i, sm := range m.stations {
+		src, dst := m.up.PMUStationList[sm.src], m.cfg.PMUStationList[i]
+		dst.Stat = src.Stat
+		dst.Freq, dst.DFreq = src.Freq, src.DFreq
+		for j, k := range sm.phasors {
+			dst.PhasorValues[j] = src.PhasorValues[k]
+		}
+		for j, k := range sm.analogs {
+			dst.AnalogValues[j] = src.AnalogValues[k]
+		}
+		for j, k := range sm.digitals {
+			copy(dst.DigitalValues[j], src.DigitalValues[k])
+		}
+	}
+
+	var err error
+	m.buf, err = m.df.AppendTo(m.buf[:0])
+	return m.buf, err
+}
@@ -0,0 +1,189 @@
+package synchrophasor
+
+import (
+	"encoding/hex"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// goldenVector is a frame of testdata/golden, produced by pypmu, with the
+// values it must decode to. The files are hex dumps whose # lines note where
+// the frame comes from, and can be decoded with cmd/c37dump.
+type goldenVector struct {
+	file string
+	// config is the vector holding the configuration of a data frame
+	config string
+	// reencode requires packing the decoded frame to reproduce the file
+	reencode bool
+	check    func(t *testing.T, frame interface{})
+}
+
+var goldenVectors = []goldenVector{
+	{
+		file:     "annex_cfg2.hex",
+		reencode: true,
+		check: func(t *testing.T, frame interface{}) {
+			cfg := frame.(*ConfigFrame)
+			require.Equal(t, uint16(7734), cfg.IDCode)
+			require.Equal(t, uint32(1149577200), cfg.SOC)
+			require.Equal(t, uint32(0x56071098), cfg.FracSec)
+			require.Equal(t, uint32(1000000), cfg.TimeBase)
+			require.Equal(t, int16(30), cfg.DataRate)
+			require.Len(t, cfg.PMUStationList, 1)
+			requireAnnexStation(t, cfg.PMUStationList[0])
+		},
+	},
+	{
+		file:     "annex_data.hex",
+		config:   "annex_cfg2.hex",
+		reencode: true,
+		check: func(t *testing.T, frame interface{}) {
+			df := frame.(*DataFrame)
+			require.Equal(t, uint16(7734), df.IDCode)
+			require.Equal(t, uint32(1149580800), df.SOC)
+			require.Equal(t, uint32(16817), df.FracSec)
+
+			station := df.AssociatedConfig.PMUStationList[0]
+			require.Equal(t, uint16(0), station.Stat)
+			// Integer phasors are scaled by PHUNIT, 915527 and 45776 x 10^-5
+			want := []complex128{
+				complex(14635*9.15527, 0),
+				complex(-7318*9.15527, -12676*9.15527),
+				complex(-7318*9.15527, 12675*9.15527),
+				complex(1092*0.45776, 0),
+			}
+			for i, v := range want {
+				require.InDelta(t, 0, cmplx.Abs(station.PhasorValues[i]-v), 1e-6, "phasor %d", i)
+			}
+			// FREQ is the deviation from the 60 Hz nominal in mHz
+			require.InDelta(t, 62.5, station.Freq, 1e-6)
+			require.Zero(t, station.DFreq)
+			require.Equal(t, []float32{100, 1000, 10000}, station.AnalogValues)
+
+			var word uint16
+			for bit, set := range station.DigitalValues[0] {
+				if set {
+					word |= 1 << bit
+				}
+			}
+			require.Equal(t, uint16(0x3C12), word)
+		},
+	},
+	{
+		file:     "pypmu_cfg2_multistream.hex",
+		reencode: true,
+		check: func(t *testing.T, frame interface{}) {
+			cfg := frame.(*ConfigFrame)
+			require.Equal(t, uint16(2), cfg.NumPMU)
+			require.Len(t, cfg.PMUStationList, 2)
+			for _, station := range cfg.PMUStationList {
+				requireAnnexStation(t, station)
+			}
+		},
+	},
+	{
+		file:     "pypmu_header.hex",
+		reencode: true,
+		check: func(t *testing.T, frame interface{}) {
+			header := frame.(*HeaderFrame)
+			require.Equal(t, uint16(7734), header.IDCode)
+			require.Equal(t, uint32(1149591600), header.SOC)
+			require.Equal(t, "Hello I'm Header Frame.", header.Data)
+		},
+	},
+	{
+		file:     "pypmu_command_start.hex",
+		reencode: true,
+		check: func(t *testing.T, frame interface{}) {
+			cmd := frame.(*CommandFrame)
+			require.Equal(t, uint16(7734), cmd.IDCode)
+			require.Equal(t, uint16(CmdStart), cmd.CMD)
+			require.Empty(t, cmd.ExtraFrame)
+		},
+	},
+}
+
+// requireAnnexStation checks the station of the C37.118.2 example configuration
+func requireAnnexStation(t *testing.T, station *PMUStation) {
+	t.Helper()
+	require.Equal(t, "Station A", strings.TrimSpace(station.STN))
+	require.Equal(t, uint16(7734), station.IDCode)
+	require.Equal(t, uint16(0x0004), station.Format)
+	require.Equal(t, uint16(4), station.Phnmr)
+	require.Equal(t, uint16(3), station.Annmr)
+	require.Equal(t, uint16(1), station.Dgnmr)
+	require.Equal(t, uint16(FreqNom60Hz), station.Fnom)
+	require.Equal(t, uint16(22), station.CfgCnt)
+
+	names := make([]string, 0, len(station.CHNAMPhasor)+len(station.CHNAMAnalog))
+	for _, name := range append(append([]string(nil), station.CHNAMPhasor...), station.CHNAMAnalog...) {
+		names = append(names, strings.TrimSpace(name))
+	}
+	require.Equal(t, []string{"VA", "VB", "VC", "I1", "ANALOG1", "ANALOG2", "ANALOG3"}, names)
+	require.Len(t, station.CHNAMDigital, 16)
+	require.Equal(t, "BREAKER G STATUS", strings.TrimSpace(station.CHNAMDigital[15]))
+	require.Equal(t, []uint32{915527, 915527, 915527, 0x0100b2d0}, station.Phunit)
+	require.Equal(t, []uint32{1, 0x01000001, 0x02000001}, station.Anunit)
+	require.Equal(t, []uint32{0x0000FFFF}, station.Dgunit)
+}
+
+// readGolden reads a hex vector of testdata/golden, skipping # lines
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+	text, err := os.ReadFile(filepath.Join("testdata", "golden", name))
+	require.NoError(t, err)
+
+	var digits strings.Builder
+	for _, line := range strings.Split(string(text), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			digits.WriteString(strings.Join(strings.Fields(line), ""))
+		}
+	}
+	data, err := hex.DecodeString(digits.String())
+	require.NoError(t, err)
+	return data
+}
+
+func TestGoldenVectors(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.hex"))
+	require.NoError(t, err)
+	require.Len(t, files, len(goldenVectors), "every vector needs an entry in goldenVectors")
+
+	for _, v := range goldenVectors {
+		t.Run(strings.TrimSuffix(v.file, ".hex"), func(t *testing.T) {
+			data := readGolden(t, v.file)
+
+			var cfg *ConfigFrame
+			if v.config != "" {
+				cfg = NewConfigFrame()
+				require.NoError(t, cfg.Unpack(readGolden(t, v.config)))
+			}
+
+			frame, err := UnpackFrame(data, cfg)
+			require.NoError(t, err)
+			v.check(t, frame)
+
+			// The parallel decoder agrees with the serial one
+			if df, ok := frame.(*DataFrame); ok {
+				parallel := NewConfigFrame()
+				require.NoError(t, parallel.Unpack(readGolden(t, v.config)))
+				require.NoError(t, NewDataFrame(parallel).UnpackParallel(data, 2))
+				v.check(t, &DataFrame{C37118: df.C37118, AssociatedConfig: parallel})
+			}
+
+			if !v.reencode {
+				return
+			}
+			packer, ok := frame.(interface{ Pack() ([]byte, error) })
+			require.True(t, ok)
+			packed, err := packer.Pack()
+			require.NoError(t, err)
+			require.Equal(t, hex.Dump(data), hex.Dump(packed))
+		})
+	}
+}
@@ -0,0 +1,214 @@
+// Package grpcserver implements the Synchrophasor gRPC service of package pb,
+// streaming measurement sets fed by a PDC or PMU to subscribed clients
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures a Server
+type Options struct {
+	// Buffer is the number of measurement sets queued per subscriber,
+	// defaults to 64. Sets are dropped for subscribers with a full queue.
+	Buffer int
+}
+
+// subscriber is an active Subscribe call
+type subscriber struct {
+	stations   []int
+	decimation uint32
+	count      uint32
+	sets       chan *pb.MeasurementSet
+	done       chan error
+}
+
+// Server implements pb.SynchrophasorServer. Measurements are passed to Write,
+// typically from a PDC read loop, and fanned out to all subscribers without
+// blocking on slow clients.
+type Server struct {
+	pb.UnimplementedSynchrophasorServer
+
+	opts   Options
+	mu     sync.RWMutex
+	config *pb.Configuration
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// New creates a server for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) *Server {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	return &Server{
+		opts:   opts,
+		config: pb.FromConfig(cfg),
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+// SetConfig replaces the configuration. Active subscriptions end with
+// codes.Aborted, as their station selection may no longer apply.
+func (s *Server) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	config := pb.FromConfig(cfg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+	s.endAll(status.Error(codes.Aborted, "configuration changed"))
+}
+
+// Write sends a measurement set to all subscribers
+func (s *Server) Write(m *synchrophasor.Measurements) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(m.Stations) != len(s.config.Stations) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.config.Stations))
+	}
+	if len(s.subs) == 0 {
+		return nil
+	}
+
+	set := pb.FromMeasurements(m)
+	for sub := range s.subs {
+		sub.count++
+		if (sub.count-1)%sub.decimation != 0 {
+			continue
+		}
+
+		out := set
+		if sub.stations != nil {
+			out = &pb.MeasurementSet{
+				IdCode:   set.IdCode,
+				Soc:      set.Soc,
+				FracSec:  set.FracSec,
+				Time:     set.Time,
+				Stations: make([]*pb.StationMeasurement, len(sub.stations)),
+			}
+			for i, j := range sub.stations {
+				out.Stations[i] = set.Stations[j]
+			}
+		}
+
+		select {
+		case sub.sets <- out:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close ends all subscriptions with codes.Unavailable and rejects new ones
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.endAll(status.Error(codes.Unavailable, "server closed"))
+	return nil
+}
+
+// endAll ends all subscriptions with err, s.mu must be held
+func (s *Server) endAll(err error) {
+	for sub := range s.subs {
+		sub.done <- err
+		delete(s.subs, sub)
+	}
+}
+
+// GetConfiguration returns the configuration of the selected stations
+func (s *Server) GetConfiguration(_ context.Context, req *pb.ConfigurationRequest) (*pb.Configuration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stations, err := s.selectStations(req.GetFilter())
+	if err != nil {
+		return nil, err
+	}
+	if stations == nil {
+		return s.config, nil
+	}
+
+	out := &pb.Configuration{
+		IdCode:   s.config.IdCode,
+		TimeBase: s.config.TimeBase,
+		DataRate: s.config.DataRate,
+		Stations: make([]*pb.StationConfig, len(stations)),
+	}
+	for i, j := range stations {
+		out.Stations[i] = s.config.Stations[j]
+	}
+	return out, nil
+}
+
+// Subscribe streams measurement sets of the selected stations
+func (s *Server) Subscribe(req *pb.SubscribeRequest, stream pb.Synchrophasor_SubscribeServer) error {
+	sub := &subscriber{
+		decimation: max(req.GetDecimation(), 1),
+		sets:       make(chan *pb.MeasurementSet, s.opts.Buffer),
+		done:       make(chan error, 1),
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return status.Error(codes.Unavailable, "server closed")
+	}
+	stations, err := s.selectStations(req.GetFilter())
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	sub.stations = stations
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, sub)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case set := <-sub.sets:
+			if err := stream.Send(set); err != nil {
+				return err
+			}
+		case err := <-sub.done:
+			return err
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// selectStations returns the indexes of the stations matching filter, or nil
+// if the filter is empty. s.mu must be held.
+func (s *Server) selectStations(filter *pb.StationFilter) ([]int, error) {
+	if len(filter.GetIdCodes()) == 0 && len(filter.GetNames()) == 0 {
+		return nil, nil
+	}
+
+	stations := []int{}
+	for i, st := range s.config.Stations {
+		if slices.Contains(filter.GetIdCodes(), st.IdCode) ||
+			slices.ContainsFunc(filter.GetNames(), func(name string) bool { return strings.EqualFold(name, st.Name) }) {
+			stations = append(stations, i)
+		}
+	}
+	if len(stations) == 0 {
+		return nil, status.Error(codes.NotFound, "no station matches the filter")
+	}
+	return stations, nil
+}
@@ -0,0 +1,120 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	for i, name := range []string{"Station A", "Station B"} {
+		station := synchrophasor.NewPMUStation(name, uint16(10+i), true, true, true, true)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		cfg.AddPMUStation(station)
+	}
+	return cfg
+}
+
+// serve starts a gRPC server for srv and returns a connected client
+func serve(t *testing.T, srv *Server) pb.SynchrophasorClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	gs := grpc.NewServer()
+	pb.RegisterSynchrophasorServer(gs, srv)
+	go func() { _ = gs.Serve(l) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewSynchrophasorClient(conn)
+}
+
+// subscribers returns the number of active subscriptions
+func (s *Server) subscribers() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.subs)
+}
+
+func TestGetConfiguration(t *testing.T) {
+	client := serve(t, New(testConfig(), Options{}))
+	ctx := context.Background()
+
+	cfg, err := client.GetConfiguration(ctx, &pb.ConfigurationRequest{})
+	require.NoError(t, err)
+	require.Len(t, cfg.Stations, 2)
+
+	cfg, err = client.GetConfiguration(ctx,
+		&pb.ConfigurationRequest{Filter: &pb.StationFilter{Names: []string{"station b"}}})
+	require.NoError(t, err)
+	require.Len(t, cfg.Stations, 1)
+	require.Equal(t, uint32(11), cfg.Stations[0].IdCode)
+
+	_, err = client.GetConfiguration(ctx, &pb.ConfigurationRequest{Filter: &pb.StationFilter{IdCodes: []uint32{99}}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSubscribe(t *testing.T) {
+	cfg := testConfig()
+	srv := New(cfg, Options{})
+	client := serve(t, srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	all, err := client.Subscribe(ctx, &pb.SubscribeRequest{})
+	require.NoError(t, err)
+	filtered, err := client.Subscribe(ctx,
+		&pb.SubscribeRequest{Filter: &pb.StationFilter{IdCodes: []uint32{11}}, Decimation: 2})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return srv.subscribers() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SetTime(nil, nil)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	for i := 0; i < 4; i++ {
+		m.Time = float64(1700000000 + i)
+		require.NoError(t, srv.Write(&m))
+	}
+
+	for i := 0; i < 4; i++ {
+		set, err := all.Recv()
+		require.NoError(t, err)
+		require.Len(t, set.Stations, 2)
+		require.Equal(t, float64(1700000000+i), set.Time)
+	}
+	for i := 0; i < 4; i += 2 {
+		set, err := filtered.Recv()
+		require.NoError(t, err)
+		require.Len(t, set.Stations, 1)
+		require.Equal(t, uint32(11), set.Stations[0].IdCode)
+		require.Equal(t, float64(1700000000+i), set.Time)
+	}
+
+	// A configuration change ends the subscriptions
+	srv.SetConfig(cfg)
+	_, err = all.Recv()
+	require.Equal(t, codes.Aborted, status.Code(err))
+	_, err = filtered.Recv()
+	require.Equal(t, codes.Aborted, status.Code(err))
+
+	require.NoError(t, srv.Close())
+	closed, err := client.Subscribe(ctx, &pb.SubscribeRequest{})
+	require.NoError(t, err)
+	_, err = closed.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	require.ErrorIs(t, srv.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+}
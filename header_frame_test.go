@@ -1,6 +1,8 @@
 package synchrophasor
 
 import (
+	"bytes"
+	"io"
 	"strings"
 	"testing"
 	"time"
@@ -239,3 +241,87 @@ func TestConfigFrame2_Multistreaming(t *testing.T) {
 
 	require.Equal(t, expectedBytes, cfgBytes)
 }
+
+// frameEncoder is a frame with the three encoders that must agree
+type frameEncoder interface {
+	Pack() ([]byte, error)
+	AppendTo(dst []byte) ([]byte, error)
+	PackTo(w io.Writer) (int, error)
+}
+
+// requireEncodersAgree checks that AppendTo and PackTo produce the bytes of
+// Pack, AppendTo after an existing prefix
+func requireEncodersAgree(t *testing.T, f frameEncoder) []byte {
+	packed, err := f.Pack()
+	require.NoError(t, err)
+
+	prefix := []byte{0x01, 0x02, 0x03}
+	appended, err := f.AppendTo(prefix)
+	require.NoError(t, err)
+	require.Equal(t, prefix, appended[:len(prefix)])
+	require.Equal(t, packed, appended[len(prefix):])
+
+	var buf bytes.Buffer
+	n, err := f.PackTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, len(packed), n)
+	require.Equal(t, packed, buf.Bytes())
+	return packed
+}
+
+func TestFrameEncoders(t *testing.T) {
+	header := NewHeaderFrame(7734, "Hello I'm Header Frame.")
+	header.SetTimeWithQuality(1149591600, 770000, "+", false, false, 15)
+	command := NewCommandFrame()
+	command.IDCode = 7734
+	command.CMD = CmdStart
+	command.SetTimeWithQuality(1149591600, 770000, "+", false, false, 15)
+	extended := NewCommandFrame()
+	extended.IDCode = 7734
+	extended.CMD = CmdExt
+	extended.ExtraFrame = []byte{0xde, 0xad, 0xbe, 0xef}
+	cfg2 := newBenchConfig(3)
+	cfg2.SetTimeWithQuality(1149577200, 463000, "-", false, true, 6)
+	cfg1 := NewConfig1Frame()
+	cfg1.TimeBase, cfg1.DataRate = cfg2.TimeBase, cfg2.DataRate
+	for _, station := range newBenchConfig(2).PMUStationList {
+		cfg1.AddPMUStation(station)
+	}
+
+	tests := []struct {
+		name   string
+		sync   byte
+		frame  frameEncoder
+		unpack func(data []byte) (frameEncoder, error)
+	}{
+		{"header", SyncHdr, header, func(data []byte) (frameEncoder, error) {
+			f := &HeaderFrame{}
+			return f, f.Unpack(data)
+		}},
+		{"command", SyncCmd, command, func(data []byte) (frameEncoder, error) {
+			f := &CommandFrame{}
+			return f, f.Unpack(data)
+		}},
+		{"extended command", SyncCmd, extended, func(data []byte) (frameEncoder, error) {
+			f := &CommandFrame{}
+			return f, f.Unpack(data)
+		}},
+		{"CFG-2", SyncCfg2, cfg2, func(data []byte) (frameEncoder, error) {
+			f := NewConfigFrame()
+			return f, f.Unpack(data)
+		}},
+		{"CFG-1", SyncCfg1, cfg1, func(data []byte) (frameEncoder, error) {
+			f := NewConfig1Frame()
+			return f, f.Unpack(data)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed := requireEncodersAgree(t, tt.frame)
+			require.Equal(t, []byte{SyncAA, tt.sync}, packed[:2])
+			decoded, err := tt.unpack(packed)
+			require.NoError(t, err)
+			require.Equal(t, packed, requireEncodersAgree(t, decoded))
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Package historian retains the most recent aligned measurement sets in
+// memory and answers time-range queries on single channels and point-in-time
+// lookups of whole sets, e.g. for HTTP APIs and replay
+package historian
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures a Historian
+type Options struct {
+	// Retention is the time span kept, defaults to five minutes
+	Retention time.Duration
+	// Capacity is the number of measurement sets kept, defaults to the
+	// retention at the configured data rate. Sets beyond it are dropped even
+	// if younger than the retention.
+	Capacity int
+}
+
+// Sample is a channel value at a point in time
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Historian keeps measurement sets in a ring buffer. Sets are passed to
+// Write, typically from a PDC read loop, and queried concurrently.
+type Historian struct {
+	opts     Options
+	mu       sync.RWMutex
+	cfg      *synchrophasor.ConfigFrame
+	channels map[string]synchrophasor.ChannelRef
+	sets     []synchrophasor.Measurements
+	times    []int64
+	// start is the ring position of the oldest set, n the number of sets
+	start, n int
+}
+
+// New creates a historian for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) *Historian {
+	if opts.Retention <= 0 {
+		opts.Retention = 5 * time.Minute
+	}
+	h := &Historian{opts: opts}
+	h.setConfig(cfg)
+	return h
+}
+
+// SetConfig replaces the configuration and discards the retained sets
+func (h *Historian) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.setConfig(cfg)
+}
+
+// setConfig resets the historian for cfg, h.mu must be held
+func (h *Historian) setConfig(cfg *synchrophasor.ConfigFrame) {
+	capacity := h.opts.Capacity
+	if capacity <= 0 {
+		// Negative data rates are seconds per frame
+		rate := float64(cfg.DataRate)
+		if rate < 0 {
+			rate = -1 / rate
+		}
+		capacity = max(int(math.Ceil(h.opts.Retention.Seconds()*rate)), 1)
+	}
+
+	h.cfg = cfg
+	h.channels = cfg.Channels()
+	if len(h.sets) != capacity {
+		h.sets = make([]synchrophasor.Measurements, capacity)
+		h.times = make([]int64, capacity)
+	}
+	h.start, h.n = 0, 0
+}
+
+// Write appends a measurement set, replacing the oldest one when full. Sets
+// must be written in time order.
+func (h *Historian) Write(m *synchrophasor.Measurements) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(m.Stations) != len(h.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(h.cfg.PMUStationList))
+	}
+	for i, pmu := range h.cfg.PMUStationList {
+		st := &m.Stations[i]
+		if len(st.Phasors) != len(pmu.CHNAMPhasor) || len(st.Analog) != len(pmu.CHNAMAnalog) ||
+			16*len(st.Digital) < len(pmu.CHNAMDigital) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+	t := m.UnixNano()
+	if h.n > 0 && t <= h.times[h.index(h.n-1)] {
+		return fmt.Errorf("%w: measurement time %v not after the latest one",
+			synchrophasor.ErrInvalidParameter, time.Unix(0, t).UTC())
+	}
+
+	var i int
+	if h.n < len(h.sets) {
+		i = h.index(h.n)
+		h.n++
+	} else {
+		i = h.start
+		h.start = h.index(1)
+	}
+	m.CopyTo(&h.sets[i])
+	h.times[i] = t
+	return nil
+}
+
+// index returns the ring position of the ith oldest set
+func (h *Historian) index(i int) int {
+	return (h.start + i) % len(h.sets)
+}
+
+// search returns the number of retained sets older than t, h.mu must be held
+func (h *Historian) search(t int64) int {
+	return sort.Search(h.n, func(i int) bool { return h.times[h.index(i)] >= t })
+}
+
+// retained returns the logical index of the oldest set within the retention,
+// h.mu must be held
+func (h *Historian) retained() int {
+	if h.n == 0 {
+		return 0
+	}
+	return h.search(h.times[h.index(h.n-1)] - int64(h.opts.Retention) + 1)
+}
+
+// bounds returns the logical index range of the sets with from <= time < to,
+// zero times leaving the range open, h.mu must be held
+func (h *Historian) bounds(from, to time.Time) (int, int) {
+	first, last := h.retained(), h.n
+	if !from.IsZero() {
+		first = max(first, h.search(from.UnixNano()))
+	}
+	if !to.IsZero() {
+		last = h.search(to.UnixNano())
+	}
+	return first, last
+}
+
+// Channels returns the names of the queryable channels, sorted
+func (h *Historian) Channels() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	names := make([]string, 0, len(h.channels))
+	for name := range h.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Span returns the time of the oldest and latest retained sets, zero times
+// if none are retained
+func (h *Historian) Span() (time.Time, time.Time) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.n == 0 {
+		return time.Time{}, time.Time{}
+	}
+	return time.Unix(0, h.times[h.index(h.retained())]), time.Unix(0, h.times[h.index(h.n-1)])
+}
+
+// Query returns the samples of a channel with from <= time < to. Zero times
+// leave the range open. Channels are named as returned by Channels.
+func (h *Historian) Query(channel string, from, to time.Time) ([]Sample, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ref, ok := h.channels[channel]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown channel %q", synchrophasor.ErrInvalidParameter, channel)
+	}
+	first, last := h.bounds(from, to)
+	samples := make([]Sample, 0, max(last-first, 0))
+	for i := first; i < last; i++ {
+		j := h.index(i)
+		samples = append(samples, Sample{Time: time.Unix(0, h.times[j]), Value: value(&h.sets[j], ref)})
+	}
+	return samples, nil
+}
+
+// GetAt copies the latest set at or before t into m, reusing the slices held
+// by m. It reports false if no retained set is that old.
+func (h *Historian) GetAt(t time.Time, m *synchrophasor.Measurements) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	i := h.search(t.UnixNano() + 1)
+	if i == 0 || i <= h.retained() {
+		return false
+	}
+	h.sets[h.index(i-1)].CopyTo(m)
+	return true
+}
+
+// Range calls fn for the sets with from <= time < to in time order until fn
+// returns false. Zero times leave the range open. The set passed to fn is
+// only valid during the call, and fn must not call Write.
+func (h *Historian) Range(from, to time.Time, fn func(m *synchrophasor.Measurements) bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	first, last := h.bounds(from, to)
+	for i := first; i < last; i++ {
+		if !fn(&h.sets[h.index(i)]) {
+			return
+		}
+	}
+}
+
+// value returns a channel value of a measurement set
+func value(m *synchrophasor.Measurements, ref synchrophasor.ChannelRef) float64 {
+	v, _ := ref.Value(&m.Stations[ref.Station])
+	return v
+}
@@ -0,0 +1,126 @@
+package historian
+
+import (
+	"math"
+	"math/cmplx"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	})
+}
+
+// write writes n sets at 10 frames per second starting at 1700000000, the
+// frequency of Sub 1 counting up from 50 Hz in steps of 0.01 Hz
+func write(t *testing.T, h *Historian, cfg *synchrophasor.ConfigFrame, first, n int) {
+	df := synchrophasor.NewDataFrame(cfg)
+	var m synchrophasor.Measurements
+	for i := first; i < first+n; i++ {
+		testutil.SetFrame(df, i)
+		cfg.PMUStationList[0].Freq = 50 + float32(i)/100
+		cfg.PMUStationList[0].PhasorValues[0] = cmplx.Rect(230, float64(i)*math.Pi/180)
+		cfg.PMUStationList[1].DigitalValues[0][0] = i%2 == 1
+		df.FillMeasurements(&m)
+		require.NoError(t, h.Write(&m))
+	}
+}
+
+func at(i int) time.Time {
+	return testutil.FrameTime(10, i)
+}
+
+func TestHistorian(t *testing.T) {
+	cfg := testConfig()
+	h := New(cfg, Options{Retention: 10 * time.Second})
+	require.Len(t, h.sets, 100)
+	require.Contains(t, h.Channels(), "Sub 1.VA.ang")
+	require.Contains(t, h.Channels(), "Sub 2.BRK1")
+
+	// Fifteen seconds overflow the ring, the first five are dropped
+	write(t, h, cfg, 0, 150)
+	first, last := h.Span()
+	require.Equal(t, at(50), first)
+	require.Equal(t, at(149), last)
+
+	samples, err := h.Query("Sub 1.freq", at(60), at(65))
+	require.NoError(t, err)
+	require.Len(t, samples, 5)
+	require.Equal(t, at(60), samples[0].Time)
+	require.InDelta(t, 50.6, samples[0].Value, 1e-4)
+
+	samples, err = h.Query("Sub 1.VA.ang", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, samples, 100)
+	require.InDelta(t, 50, samples[0].Value, 1e-9)
+	samples, err = h.Query("Sub 2.BRK1", at(148), time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, []Sample{{at(148), 0}, {at(149), 1}}, samples)
+
+	_, err = h.Query("Sub 3.freq", time.Time{}, time.Time{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+
+	// GetAt returns the latest set at or before the time
+	var m synchrophasor.Measurements
+	require.True(t, h.GetAt(at(70).Add(50*time.Millisecond), &m))
+	require.InDelta(t, 50.7, m.Stations[0].Frequency, 1e-4)
+	require.True(t, h.GetAt(at(70), &m))
+	require.InDelta(t, 50.7, m.Stations[0].Frequency, 1e-4)
+	require.False(t, h.GetAt(at(49), &m))
+
+	var n int
+	h.Range(at(100), time.Time{}, func(m *synchrophasor.Measurements) bool {
+		n++
+		return n < 3
+	})
+	require.Equal(t, 3, n)
+
+	// Sets older than the latest one are rejected
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000001
+	df.FillMeasurements(&m)
+	require.ErrorIs(t, h.Write(&m), synchrophasor.ErrInvalidParameter)
+	require.ErrorIs(t, h.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+
+	h.SetConfig(cfg)
+	first, _ = h.Span()
+	require.True(t, first.IsZero())
+}
+
+func TestHistorianRetention(t *testing.T) {
+	cfg := testConfig()
+	h := New(cfg, Options{Retention: time.Second, Capacity: 50})
+
+	// A gap leaves sets in the ring that are older than the retention
+	write(t, h, cfg, 0, 20)
+	write(t, h, cfg, 100, 5)
+	first, last := h.Span()
+	require.Equal(t, at(100), first)
+	require.Equal(t, at(104), last)
+	samples, err := h.Query("Sub 1.freq", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, samples, 5)
+	var m synchrophasor.Measurements
+	require.False(t, h.GetAt(at(19), &m))
+
+	// Queries run concurrently with writes
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_, _ = h.Query("Sub 1.VA.mag", time.Time{}, time.Time{})
+		}
+	}()
+	write(t, h, cfg, 105, 100)
+	wg.Wait()
+}
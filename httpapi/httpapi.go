@@ -0,0 +1,296 @@
+// Package httpapi provides an embeddable HTTP handler exposing the
+// configuration and latest measurements of a running PDC or PMU as JSON
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures a Handler
+type Options struct {
+	// StaleAfter is the age of the latest measurements after which /health
+	// reports the stream as stale, defaults to five seconds
+	StaleAfter time.Duration
+}
+
+// Handler serves
+//
+//	GET /config                  configuration frame
+//	GET /stations                station names, ID codes and channel names
+//	GET /stations/{id}/latest    latest values of the station with ID code id
+//	GET /health                  200 while measurements arrive, 503 otherwise
+//
+// Measurements are passed to Write, typically from a PDC read loop, or
+// recorded from a PMU data provider wrapped with Provider. Mount it under a
+// prefix with http.StripPrefix.
+type Handler struct {
+	opts     Options
+	mux      *http.ServeMux
+	mu       sync.RWMutex
+	cfg      *synchrophasor.ConfigFrame
+	latest   synchrophasor.Measurements
+	received time.Time
+	frame    *synchrophasor.DataFrame
+}
+
+// New creates a handler for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) *Handler {
+	if opts.StaleAfter <= 0 {
+		opts.StaleAfter = 5 * time.Second
+	}
+	h := &Handler{opts: opts, mux: http.NewServeMux(), cfg: cfg}
+	h.mux.HandleFunc("GET /config", h.serveConfig)
+	h.mux.HandleFunc("GET /stations", h.serveStations)
+	h.mux.HandleFunc("GET /stations/{id}/latest", h.serveLatest)
+	h.mux.HandleFunc("GET /health", h.serveHealth)
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// SetConfig replaces the configuration and discards the latest measurements
+func (h *Handler) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+	h.latest.Stations = h.latest.Stations[:0]
+	h.received = time.Time{}
+	h.frame = nil
+}
+
+// Write records m as the latest measurement set
+func (h *Handler) Write(m *synchrophasor.Measurements) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.record(m)
+}
+
+// record copies m into latest, h.mu must be held
+func (h *Handler) record(m *synchrophasor.Measurements) error {
+	if len(m.Stations) != len(h.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(h.cfg.PMUStationList))
+	}
+
+	m.CopyTo(&h.latest)
+	h.received = time.Now()
+	return nil
+}
+
+// Provider wraps a PMU data provider, recording the station values it sets
+// as the latest measurements. The configuration passed to Update must be the
+// one of the handler.
+func (h *Handler) Provider(next synchrophasor.DataProvider) synchrophasor.DataProvider {
+	return synchrophasor.DataProviderFunc(func(cfg *synchrophasor.ConfigFrame, t time.Time) error {
+		if err := next.Update(cfg, t); err != nil {
+			return err
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if cfg != h.cfg {
+			return nil
+		}
+		if h.frame == nil {
+			h.frame = synchrophasor.NewDataFrame(cfg)
+		}
+		h.frame.FillMeasurements(&h.latest)
+		h.latest.Time = float64(t.UnixNano()) / 1e9
+		h.received = time.Now()
+		return nil
+	})
+}
+
+// station is an entry of /stations
+type station struct {
+	STN     string   `json:"stn"`
+	IDCode  uint16   `json:"id_code"`
+	Fnom    float32  `json:"fnom"`
+	Phasors []string `json:"phasors"`
+	Analog  []string `json:"analog"`
+	Digital []string `json:"digital"`
+}
+
+// phasor is a phasor value in polar form with the angle in degrees
+type phasor struct {
+	Name      string          `json:"name"`
+	Magnitude json.RawMessage `json:"magnitude"`
+	Angle     json.RawMessage `json:"angle"`
+}
+
+// value is a named analog or digital value
+type value struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// latest is the response of /stations/{id}/latest
+type latest struct {
+	STN       string          `json:"stn"`
+	IDCode    uint16          `json:"id_code"`
+	Time      float64         `json:"time"`
+	Stat      uint16          `json:"stat"`
+	Frequency json.RawMessage `json:"frequency"`
+	ROCOF     json.RawMessage `json:"rocof"`
+	Phasors   []phasor        `json:"phasors"`
+	Analog    []value         `json:"analog"`
+	Digital   []value         `json:"digital"`
+}
+
+// serveConfig writes the configuration frame
+func (h *Handler) serveConfig(w http.ResponseWriter, _ *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	writeJSON(w, http.StatusOK, h.cfg)
+}
+
+// serveStations writes the stations and their channel names
+func (h *Handler) serveStations(w http.ResponseWriter, _ *http.Request) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stations := make([]station, len(h.cfg.PMUStationList))
+	for i, pmu := range h.cfg.PMUStationList {
+		stations[i] = station{
+			STN:     strings.TrimSpace(pmu.STN),
+			IDCode:  pmu.IDCode,
+			Fnom:    pmu.GetNominalFrequency(),
+			Phasors: trim(pmu.CHNAMPhasor),
+			Analog:  trim(pmu.CHNAMAnalog),
+			Digital: trim(pmu.CHNAMDigital),
+		}
+	}
+	writeJSON(w, http.StatusOK, stations)
+}
+
+// serveLatest writes the latest values of one station
+func (h *Handler) serveLatest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 16)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid station ID code")
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	index := -1
+	for i, pmu := range h.cfg.PMUStationList {
+		if pmu.IDCode == uint16(id) {
+			index = i
+			break
+		}
+	}
+	switch {
+	case index < 0:
+		writeError(w, http.StatusNotFound, "unknown station")
+		return
+	case index >= len(h.latest.Stations):
+		writeError(w, http.StatusServiceUnavailable, "no measurements received")
+		return
+	}
+
+	pmu, m := h.cfg.PMUStationList[index], &h.latest.Stations[index]
+	out := latest{
+		STN:       strings.TrimSpace(pmu.STN),
+		IDCode:    pmu.IDCode,
+		Time:      h.latest.Time,
+		Stat:      m.Stat,
+		Frequency: number(float64(m.Frequency), 32),
+		ROCOF:     number(float64(m.ROCOF), 32),
+		Phasors:   make([]phasor, len(m.Phasors)),
+		Analog:    make([]value, len(m.Analog)),
+		Digital:   make([]value, 0, 16*len(m.Digital)),
+	}
+	for j, v := range m.Phasors {
+		out.Phasors[j] = phasor{
+			Name:      pmu.PhasorName(j),
+			Magnitude: number(cmplx.Abs(v), 64),
+			Angle:     number(cmplx.Phase(v)*180/math.Pi, 64),
+		}
+	}
+	for j, v := range m.Analog {
+		out.Analog[j] = value{Name: pmu.AnalogName(j), Value: number(float64(v), 32)}
+	}
+	for j, word := range m.Digital {
+		for k, bit := range word {
+			out.Digital = append(out.Digital, value{Name: pmu.DigitalName(j*16 + k), Value: bit})
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// serveHealth reports whether measurements are arriving
+func (h *Handler) serveHealth(w http.ResponseWriter, _ *http.Request) {
+	h.mu.RLock()
+	received := h.received
+	h.mu.RUnlock()
+
+	health := struct {
+		Status     string     `json:"status"`
+		LastUpdate *time.Time `json:"last_update"`
+		AgeSeconds *float64   `json:"age_seconds"`
+	}{Status: "ok"}
+
+	code := http.StatusOK
+	if received.IsZero() {
+		health.Status = "waiting"
+		code = http.StatusServiceUnavailable
+	} else {
+		age := time.Since(received)
+		health.LastUpdate = &received
+		seconds := age.Seconds()
+		health.AgeSeconds = &seconds
+		if age > h.opts.StaleAfter {
+			health.Status = "stale"
+			code = http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, health)
+}
+
+// writeJSON writes v with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error message
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+// number encodes v in the shortest form of the given bit size, or as null
+// for NaN and infinities, which mark missing data
+func number(v float64, bitSize int) json.RawMessage {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return json.RawMessage("null")
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, bitSize)
+}
+
+// trim returns the names without padding
+func trim(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = strings.TrimSpace(name)
+	}
+	return out
+}
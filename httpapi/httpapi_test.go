@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Sub 1", 7734, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, 0)
+	station.AddDigital([]string{"BRK"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+// get requests path and decodes the JSON response into v
+func get(t *testing.T, h http.Handler, path string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	cfg := testConfig()
+	h := New(cfg, Options{StaleAfter: time.Hour})
+
+	var health map[string]interface{}
+	require.Equal(t, http.StatusServiceUnavailable, get(t, h, "/health", &health))
+	require.Equal(t, "waiting", health["status"])
+
+	var errResp map[string]string
+	require.Equal(t, http.StatusServiceUnavailable, get(t, h, "/stations/7734/latest", &errResp))
+	require.Equal(t, http.StatusNotFound, get(t, h, "/stations/1/latest", &errResp))
+	require.Equal(t, http.StatusBadRequest, get(t, h, "/stations/x/latest", &errResp))
+
+	var config map[string]interface{}
+	require.Equal(t, http.StatusOK, get(t, h, "/config", &config))
+	require.Equal(t, "cfg2", config["frame"])
+
+	var stations []station
+	require.Equal(t, http.StatusOK, get(t, h, "/stations", &stations))
+	require.Len(t, stations, 1)
+	require.Equal(t, "Sub 1", stations[0].STN)
+	require.Equal(t, []string{"VA"}, stations[0].Phasors)
+
+	pmu := cfg.PMUStationList[0]
+	pmu.PhasorValues[0] = complex(0, 230)
+	pmu.AnalogValues[0] = float32(math.NaN())
+	pmu.Freq = 50.01
+	pmu.DigitalValues[0][0] = true
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000000
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	require.NoError(t, h.Write(&m))
+	require.ErrorIs(t, h.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stations/7734/latest", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"frequency":50.01,`)
+	require.Contains(t, rec.Body.String(), `"analog":[{"name":"P","value":null}]`)
+
+	var values latest
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &values))
+	require.Equal(t, 1700000000.0, values.Time)
+	require.Equal(t, "VA", values.Phasors[0].Name)
+	require.JSONEq(t, "230", string(values.Phasors[0].Magnitude))
+	require.JSONEq(t, "90", string(values.Phasors[0].Angle))
+	require.Equal(t, value{Name: "BRK", Value: true}, values.Digital[0])
+
+	require.Equal(t, http.StatusOK, get(t, h, "/health", &health))
+	require.Equal(t, "ok", health["status"])
+
+	// The measurements are discarded with the configuration
+	h.SetConfig(cfg)
+	require.Equal(t, http.StatusServiceUnavailable, get(t, h, "/stations/7734/latest", &errResp))
+}
+
+func TestProvider(t *testing.T) {
+	cfg := testConfig()
+	h := New(cfg, Options{StaleAfter: time.Millisecond})
+
+	provider := h.Provider(synchrophasor.DataProviderFunc(func(cfg *synchrophasor.ConfigFrame, _ time.Time) error {
+		cfg.PMUStationList[0].Freq = 49.9
+		return nil
+	}))
+	now := time.Unix(1700000000, 0)
+	require.NoError(t, provider.Update(cfg, now))
+
+	var values latest
+	require.Equal(t, http.StatusOK, get(t, h, "/stations/7734/latest", &values))
+	require.JSONEq(t, "49.9", string(values.Frequency))
+	require.Equal(t, 1700000000.0, values.Time)
+
+	time.Sleep(5 * time.Millisecond)
+	var health map[string]interface{}
+	require.Equal(t, http.StatusServiceUnavailable, get(t, h, "/health", &health))
+	require.Equal(t, "stale", health["status"])
+}
@@ -0,0 +1,164 @@
+package iec104
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrProtocol is returned for malformed APDUs
+var ErrProtocol = errors.New("iec 104 protocol error")
+
+// APCI start byte and U-frame functions
+const (
+	startByte  = 0x68
+	startDTAct = 0x07
+	startDTCon = 0x0B
+	stopDTAct  = 0x13
+	stopDTCon  = 0x23
+	testFRAct  = 0x43
+	testFRCon  = 0x83
+)
+
+// maxASDU is the largest ASDU fitting an APDU
+const maxASDU = 253 - 4
+
+// Type identifications used by the gateway
+const (
+	typeSinglePoint     = 1   // M_SP_NA_1
+	typeFloat           = 13  // M_ME_NC_1
+	typeSinglePointTime = 30  // M_SP_TB_1
+	typeFloatTime       = 36  // M_ME_TF_1
+	typeInterrogation   = 100 // C_IC_NA_1
+	typeClockSync       = 103 // C_CS_NA_1
+)
+
+// Causes of transmission
+const (
+	causeSpontaneous    = 3
+	causeActivation     = 6
+	causeActivationCon  = 7
+	causeActivationTerm = 10
+	causeInterrogated   = 20
+	causeUnknownType    = 44
+	causeUnknownCause   = 45
+	causeUnknownAddress = 46
+	causeNegative       = 0x40
+)
+
+// Quality descriptor bits
+const (
+	qualityInvalid    = 0x80
+	qualityNotTopical = 0x40
+)
+
+// frame is a received APDU
+type frame struct {
+	// format is 'I', 'S' or 'U'
+	format   byte
+	function byte
+	sendSeq  uint16
+	recvSeq  uint16
+	asdu     []byte
+}
+
+// readFrame reads one APDU
+func readFrame(r io.Reader) (frame, error) {
+	var header [6]byte
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return frame{}, err
+	}
+	if header[0] != startByte || header[1] < 4 {
+		return frame{}, fmt.Errorf("%w: invalid APCI", ErrProtocol)
+	}
+	body := make([]byte, header[1])
+	if _, err := io.ReadFull(r, body); err != nil {
+		return frame{}, err
+	}
+
+	switch {
+	case body[0]&0x01 == 0:
+		return frame{
+			format:  'I',
+			sendSeq: binary.LittleEndian.Uint16(body[0:]) >> 1,
+			recvSeq: binary.LittleEndian.Uint16(body[2:]) >> 1,
+			asdu:    body[4:],
+		}, nil
+	case body[0]&0x03 == 0x01:
+		return frame{format: 'S', recvSeq: binary.LittleEndian.Uint16(body[2:]) >> 1}, nil
+	default:
+		return frame{format: 'U', function: body[0]}, nil
+	}
+}
+
+// appendI appends an I-format APDU
+func appendI(b []byte, sendSeq, recvSeq uint16, asdu []byte) []byte {
+	b = append(b, startByte, byte(4+len(asdu)))
+	b = binary.LittleEndian.AppendUint16(b, sendSeq<<1)
+	b = binary.LittleEndian.AppendUint16(b, recvSeq<<1)
+	return append(b, asdu...)
+}
+
+// appendS appends an S-format APDU
+func appendS(b []byte, recvSeq uint16) []byte {
+	b = append(b, startByte, 4, 0x01, 0x00)
+	return binary.LittleEndian.AppendUint16(b, recvSeq<<1)
+}
+
+// appendU appends a U-format APDU
+func appendU(b []byte, function byte) []byte {
+	return append(b, startByte, 4, function, 0, 0, 0)
+}
+
+// asduHeader is the data unit identifier of an ASDU
+type asduHeader struct {
+	typeID uint8
+	count  int
+	cause  uint8
+	origin uint8
+	common uint16
+}
+
+// appendHeader appends the data unit identifier
+func appendHeader(b []byte, h asduHeader) []byte {
+	b = append(b, h.typeID, byte(h.count), h.cause, h.origin)
+	return binary.LittleEndian.AppendUint16(b, h.common)
+}
+
+// parseHeader reads the data unit identifier
+func parseHeader(asdu []byte) (asduHeader, error) {
+	if len(asdu) < 6 {
+		return asduHeader{}, fmt.Errorf("%w: short ASDU", ErrProtocol)
+	}
+	return asduHeader{
+		typeID: asdu[0],
+		count:  int(asdu[1] & 0x7F),
+		cause:  asdu[2],
+		origin: asdu[3],
+		common: binary.LittleEndian.Uint16(asdu[4:]),
+	}, nil
+}
+
+// appendIOA appends a three byte information object address
+func appendIOA(b []byte, ioa uint32) []byte {
+	return append(b, byte(ioa), byte(ioa>>8), byte(ioa>>16))
+}
+
+// appendCP56 appends a CP56Time2a time tag in UTC
+func appendCP56(b []byte, t time.Time, invalid bool) []byte {
+	t = t.UTC()
+	ms := uint16(t.Second()*1000 + t.Nanosecond()/1e6)
+	minute := byte(t.Minute())
+	if invalid {
+		minute |= 0x80
+	}
+	b = binary.LittleEndian.AppendUint16(b, ms)
+	return append(b,
+		minute,
+		byte(t.Hour()),
+		byte(t.Day())|byte((int(t.Weekday())+6)%7+1)<<5,
+		byte(t.Month()),
+		byte(t.Year()%100))
+}
@@ -0,0 +1,245 @@
+// Package iec104 exposes derived synchrophasor values such as frequency,
+// voltage magnitudes, angle differences and breaker positions as an
+// IEC 60870-5-104 controlled station (slave) toward SCADA masters
+package iec104
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// DefaultPort is the TCP port assigned to IEC 60870-5-104
+const DefaultPort = 2404
+
+// Options configures a Gateway
+type Options struct {
+	// Points maps derived values to information object addresses
+	Points []Point
+	// CommonAddress is the common address of ASDU of the station, defaults to 1
+	CommonAddress uint16
+	// K is the maximum number of unacknowledged I-frames, defaults to 12
+	K int
+	// W is the number of received I-frames acknowledged at the latest,
+	// defaults to 8
+	W int
+	// T1 is the acknowledgement timeout, defaults to 15 seconds
+	T1 time.Duration
+	// T2 is the delay of supervisory acknowledgements, defaults to 10 seconds
+	T2 time.Duration
+	// T3 is the idle time before a test frame, defaults to 20 seconds
+	T3 time.Duration
+	// Buffer is the number of ASDUs queued per connection, defaults to 1024.
+	// A connection with a full queue is closed, the master recovers the
+	// current state by a general interrogation after reconnecting.
+	Buffer int
+}
+
+// Gateway is an IEC 60870-5-104 server. Measurements passed to Write update
+// the mapped points, changes beyond the deadband are sent spontaneously with
+// CP56Time2a time tags (M_ME_TF_1, M_SP_TB_1) to every started connection,
+// and a station interrogation returns all points without time tags
+// (M_ME_NC_1, M_SP_NA_1). Data errors in STAT or missing values set the
+// invalid flag, lost synchronization the not topical flag.
+type Gateway struct {
+	opts      Options
+	mu        sync.Mutex
+	stations  int
+	points    []point
+	listeners map[net.Listener]struct{}
+	sessions  map[*session]struct{}
+	closed    bool
+}
+
+// New creates a gateway for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Gateway, error) {
+	if opts.CommonAddress == 0 {
+		opts.CommonAddress = 1
+	}
+	if opts.K <= 0 {
+		opts.K = 12
+	}
+	if opts.W <= 0 {
+		opts.W = 8
+	}
+	if opts.W > opts.K {
+		return nil, fmt.Errorf("%w: w %d exceeds k %d", synchrophasor.ErrInvalidParameter, opts.W, opts.K)
+	}
+	if opts.T1 <= 0 {
+		opts.T1 = 15 * time.Second
+	}
+	if opts.T2 <= 0 {
+		opts.T2 = 10 * time.Second
+	}
+	if opts.T3 <= 0 {
+		opts.T3 = 20 * time.Second
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 1024
+	}
+
+	points, err := resolvePoints(cfg, opts.Points)
+	if err != nil {
+		return nil, err
+	}
+	return &Gateway{
+		opts:      opts,
+		stations:  len(cfg.PMUStationList),
+		points:    points,
+		listeners: make(map[net.Listener]struct{}),
+		sessions:  make(map[*session]struct{}),
+	}, nil
+}
+
+// SetConfig maps the points to a new configuration. The current values
+// are kept until the next Write.
+func (g *Gateway) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	points, err := resolvePoints(cfg, g.opts.Points)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i := range points {
+		old := &g.points[i]
+		points[i].valid, points[i].value, points[i].quality = old.valid, old.value, old.quality
+		points[i].reported, points[i].time = old.reported, old.time
+	}
+	g.stations, g.points = len(cfg.PMUStationList), points
+	return nil
+}
+
+// Write updates the points and sends the changes to all connections
+func (g *Gateway) Write(m *synchrophasor.Measurements) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(m.Stations) != g.stations {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), g.stations)
+	}
+
+	t := time.Unix(0, m.UnixNano())
+	var changed []*point
+	for i := range g.points {
+		if p := &g.points[i]; p.update(m, t) {
+			changed = append(changed, p)
+		}
+	}
+	if len(changed) == 0 || len(g.sessions) == 0 {
+		return nil
+	}
+
+	asdus := appendASDUs(nil, changed, g.opts.CommonAddress, causeSpontaneous, true)
+	for s := range g.sessions {
+		for _, asdu := range asdus {
+			select {
+			case s.queue <- asdu:
+				continue
+			default:
+			}
+			s.close()
+			break
+		}
+	}
+	return nil
+}
+
+// interrogation returns the ASDUs answering a station interrogation
+func (g *Gateway) interrogation() [][]byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	points := make([]*point, len(g.points))
+	for i := range g.points {
+		points[i] = &g.points[i]
+	}
+	return appendASDUs(nil, points, g.opts.CommonAddress, causeInterrogated, false)
+}
+
+// ListenAndServe listens on addr, ":2404" when empty, and calls Serve
+func (g *Gateway) ListenAndServe(addr string) error {
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", DefaultPort)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(l)
+}
+
+// Serve accepts master connections on l until the gateway is closed
+func (g *Gateway) Serve(l net.Listener) error {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		_ = l.Close()
+		return net.ErrClosed
+	}
+	g.listeners[l] = struct{}{}
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.listeners, l)
+		g.mu.Unlock()
+		_ = l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			g.mu.Lock()
+			closed := g.closed
+			g.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s := &session{
+			g:     g,
+			conn:  conn,
+			queue: make(chan []byte, g.opts.Buffer),
+			done:  make(chan struct{}),
+		}
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			_ = conn.Close()
+			return nil
+		}
+		g.sessions[s] = struct{}{}
+		g.mu.Unlock()
+
+		go func() {
+			_ = s.run()
+			g.mu.Lock()
+			delete(g.sessions, s)
+			g.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops all listeners and closes all connections
+func (g *Gateway) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	var errs []error
+	for l := range g.listeners {
+		if err := l.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	for s := range g.sessions {
+		s.close()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,279 @@
+package iec104
+
+import (
+	"encoding/binary"
+	"math"
+	"math/cmplx"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddDigital([]string{"BRK"}, 0, 0xFFFF)
+		station.Freq = 50
+	})
+	cfg.PMUStationList[0].PhasorValues[0] = cmplx.Rect(230, 20*math.Pi/180)
+	cfg.PMUStationList[1].PhasorValues[0] = cmplx.Rect(230, -30*math.Pi/180)
+	cfg.PMUStationList[0].DigitalValues[0][0] = true
+	return cfg
+}
+
+var testPoints = []Point{
+	{IOA: 100, Kind: KindFrequency, Deadband: 0.01},
+	{IOA: 101, Kind: KindMagnitude, Channel: "VA", Deadband: 1},
+	{IOA: 102, Kind: KindAngleDifference, Station: "11", Channel: "VA", RefStation: "Sub 1", RefChannel: "VA"},
+	{IOA: 200, Kind: KindSinglePoint, Station: "Sub 1", Channel: "BRK"},
+}
+
+// master is a minimal controlling station
+type master struct {
+	t                *testing.T
+	conn             net.Conn
+	sendSeq, recvSeq uint16
+}
+
+func dial(t *testing.T, addr string) *master {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &master{t: t, conn: conn}
+}
+
+func (m *master) write(b []byte) {
+	_, err := m.conn.Write(b)
+	require.NoError(m.t, err)
+}
+
+func (m *master) read() frame {
+	require.NoError(m.t, m.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	f, err := readFrame(m.conn)
+	require.NoError(m.t, err)
+	if f.format == 'I' {
+		require.Equal(m.t, m.recvSeq, f.sendSeq)
+		m.recvSeq++
+	}
+	return f
+}
+
+// command sends an ASDU with an IOA of 0 and one element byte
+func (m *master) command(typeID uint8, common uint16, element byte) {
+	asdu := appendHeader(nil, asduHeader{typeID: typeID, count: 1, cause: causeActivation, common: common})
+	asdu = appendIOA(asdu, 0)
+	asdu = append(asdu, element)
+	m.write(appendI(nil, m.sendSeq, m.recvSeq, asdu))
+	m.sendSeq++
+}
+
+// object is a decoded information object
+type object struct {
+	ioa     uint32
+	value   float64
+	quality byte
+	time    []byte
+}
+
+func (m *master) asdu() (asduHeader, []object) {
+	f := m.read()
+	require.Equal(m.t, byte('I'), f.format)
+	h, err := parseHeader(f.asdu)
+	require.NoError(m.t, err)
+
+	// Mirrored commands are not decoded
+	if h.typeID >= typeInterrogation || h.cause&causeNegative != 0 {
+		return h, nil
+	}
+	var objects []object
+	b := f.asdu[6:]
+	for i := 0; i < h.count; i++ {
+		o := object{ioa: uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16}
+		b = b[3:]
+		switch h.typeID {
+		case typeFloat, typeFloatTime:
+			o.value = float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+			o.quality = b[4]
+			b = b[5:]
+		case typeSinglePoint, typeSinglePointTime:
+			o.value = float64(b[0] & 0x01)
+			o.quality = b[0] &^ 0x01
+			b = b[1:]
+		}
+		if h.typeID == typeFloatTime || h.typeID == typeSinglePointTime {
+			o.time, b = b[:7], b[7:]
+		}
+		objects = append(objects, o)
+	}
+	require.Empty(m.t, b)
+	return h, objects
+}
+
+func measurements(cfg *synchrophasor.ConfigFrame, soc uint32) *synchrophasor.Measurements {
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = soc
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return &m
+}
+
+func serve(t *testing.T, g *Gateway) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = g.Serve(l) }()
+	return l.Addr().String()
+}
+
+func TestGateway(t *testing.T) {
+	cfg := testConfig()
+	g, err := New(cfg, Options{Points: testPoints})
+	require.NoError(t, err)
+	addr := serve(t, g)
+	require.NoError(t, g.Write(measurements(cfg, 1700000000)))
+
+	m := dial(t, addr)
+	m.write(appendU(nil, startDTAct))
+	require.Equal(t, frame{format: 'U', function: startDTCon}, m.read())
+
+	// Station interrogation returns all points without time tags
+	m.command(typeInterrogation, 1, causeInterrogated)
+	h, _ := m.asdu()
+	require.Equal(t, uint8(typeInterrogation), h.typeID)
+	require.Equal(t, uint8(causeActivationCon), h.cause)
+
+	h, objects := m.asdu()
+	require.Equal(t, asduHeader{typeID: typeFloat, count: 3, cause: causeInterrogated, common: 1}, h)
+	require.Equal(t, uint32(100), objects[0].ioa)
+	require.InDelta(t, 50, objects[0].value, 1e-6)
+	require.InDelta(t, 230, objects[1].value, 1e-3)
+	require.InDelta(t, -50, objects[2].value, 1e-3)
+	require.Zero(t, objects[2].quality)
+
+	h, objects = m.asdu()
+	require.Equal(t, uint8(typeSinglePoint), h.typeID)
+	require.Equal(t, []object{{ioa: 200, value: 1}}, objects)
+
+	h, _ = m.asdu()
+	require.Equal(t, uint8(causeActivationTerm), h.cause)
+
+	// Changes within the deadband are not sent, the breaker opening is
+	cfg.PMUStationList[0].Freq = 50.005
+	cfg.PMUStationList[0].DigitalValues[0][0] = false
+	require.NoError(t, g.Write(measurements(cfg, 1700000001)))
+	h, objects = m.asdu()
+	require.Equal(t, asduHeader{typeID: typeSinglePointTime, count: 1, cause: causeSpontaneous, common: 1}, h)
+	require.Equal(t, uint32(200), objects[0].ioa)
+	require.Zero(t, objects[0].value)
+	require.Equal(t, appendCP56(nil, time.Unix(1700000001, 0), false), objects[0].time)
+
+	cfg.PMUStationList[0].Freq = 50.02
+	require.NoError(t, g.Write(measurements(cfg, 1700000002)))
+	h, objects = m.asdu()
+	require.Equal(t, uint8(typeFloatTime), h.typeID)
+	require.Len(t, objects, 1)
+	require.InDelta(t, 50.02, objects[0].value, 1e-4)
+
+	// Lost synchronization marks the values not topical
+	cfg.PMUStationList[0].Stat = statSyncLost
+	require.NoError(t, g.Write(measurements(cfg, 1700000003)))
+	_, objects = m.asdu()
+	require.Len(t, objects, 2)
+	require.Equal(t, byte(qualityNotTopical), objects[0].quality)
+	_, objects = m.asdu()
+	require.Equal(t, byte(qualityNotTopical), objects[0].quality)
+
+	// Unknown types and common addresses are rejected
+	m.command(45, 1, 0)
+	h, _ = m.asdu()
+	require.Equal(t, uint8(causeUnknownType|causeNegative), h.cause)
+	m.command(typeInterrogation, 7, causeInterrogated)
+	h, _ = m.asdu()
+	require.Equal(t, uint8(causeUnknownAddress|causeNegative), h.cause)
+
+	m.write(appendS(nil, m.recvSeq))
+	m.write(appendU(nil, testFRAct))
+	require.Equal(t, frame{format: 'U', function: testFRCon}, m.read())
+
+	m.write(appendU(nil, stopDTAct))
+	require.Equal(t, frame{format: 'U', function: stopDTCon}, m.read())
+
+	require.ErrorIs(t, g.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+	require.NoError(t, g.Close())
+	require.NoError(t, m.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = readFrame(m.conn)
+	require.Error(t, err)
+}
+
+func TestGatewayTimers(t *testing.T) {
+	cfg := testConfig()
+	g, err := New(cfg, Options{
+		Points: testPoints, T1: 400 * time.Millisecond, T2: 100 * time.Millisecond, T3: 200 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer func() { _ = g.Close() }()
+	m := dial(t, serve(t, g))
+
+	m.write(appendU(nil, startDTAct))
+	require.Equal(t, frame{format: 'U', function: startDTCon}, m.read())
+
+	// A clock synchronization is confirmed, the I-frame acknowledged by it
+	m.command(typeClockSync, 1, 0)
+	h, _ := m.asdu()
+	require.Equal(t, uint8(causeActivationCon), h.cause)
+	m.write(appendS(nil, m.recvSeq))
+
+	// An idle connection is tested after t3
+	require.Equal(t, frame{format: 'U', function: testFRAct}, m.read())
+	m.write(appendU(nil, testFRCon))
+
+	// Unacknowledged I-frames close the connection after t1
+	require.NoError(t, g.Write(measurements(cfg, 1700000000)))
+	m.asdu()
+	m.asdu()
+	require.NoError(t, m.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		f, err := readFrame(m.conn)
+		if err != nil {
+			break
+		}
+		require.Equal(t, byte('U'), f.format)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	cfg := testConfig()
+	for _, points := range [][]Point{
+		{{IOA: 1, Station: "Sub 3"}},
+		{{IOA: 1, Kind: KindMagnitude, Channel: "VB"}},
+		{{IOA: 1, Kind: KindAngleDifference, Channel: "VA", RefStation: "Sub 2"}},
+		{{IOA: 1}, {IOA: 1, Kind: KindROCOF}},
+		{{IOA: 1 << 24}},
+		{{IOA: 1, Kind: 99}},
+	} {
+		_, err := New(cfg, Options{Points: points})
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+
+	_, err := New(cfg, Options{W: 13})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+
+	// 2023-11-14 22:13:20.250 UTC is a Tuesday
+	tm := time.Date(2023, 11, 14, 22, 13, 20, 250e6, time.UTC)
+	require.Equal(t, []byte{0x1A, 0x4F, 13, 22, 14 | 2<<5, 11, 23}, appendCP56(nil, tm, false))
+
+	// Many points are split over several ASDUs
+	points := make([]*point, 40)
+	for i := range points {
+		points[i] = &point{Point: Point{IOA: uint32(i)}}
+	}
+	asdus := appendASDUs(nil, points, 1, causeSpontaneous, true)
+	require.Len(t, asdus, 3)
+	for _, asdu := range asdus {
+		require.LessOrEqual(t, len(asdu), maxASDU)
+		require.Equal(t, byte(qualityInvalid), asdu[6+3+4])
+	}
+}
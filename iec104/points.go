@@ -0,0 +1,293 @@
+package iec104
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Kind selects the value a point is derived from
+type Kind uint8
+
+// Point kinds. Single points are sent as M_SP_NA_1/M_SP_TB_1, all others as
+// short floats M_ME_NC_1/M_ME_TF_1.
+const (
+	// KindFrequency is the station frequency in Hz
+	KindFrequency Kind = iota
+	// KindROCOF is the rate of change of frequency in Hz/s
+	KindROCOF
+	// KindMagnitude is the magnitude of a phasor
+	KindMagnitude
+	// KindAngle is the angle of a phasor in degrees
+	KindAngle
+	// KindAngleDifference is the angle of a phasor relative to a reference
+	// phasor in degrees, wrapped to (-180, 180]
+	KindAngleDifference
+	// KindAnalog is an analog value
+	KindAnalog
+	// KindSinglePoint is a digital status bit such as a breaker position
+	KindSinglePoint
+)
+
+// STAT bits of a C37.118 station mapped to the quality descriptor
+const (
+	statSyncLost = 0x2000
+)
+
+// Point maps a derived value to an information object address
+type Point struct {
+	// IOA is the information object address, at most 0xFFFFFF
+	IOA  uint32
+	Kind Kind
+	// Station is the station name or ID code, the first station when empty
+	Station string
+	// Channel is the phasor, analog or digital channel name
+	Channel string
+	// RefStation and RefChannel name the reference phasor of
+	// KindAngleDifference, RefStation defaults to Station
+	RefStation string
+	RefChannel string
+	// Deadband is the absolute change of a measured value that triggers a
+	// spontaneous transmission, 0 sends every change
+	Deadband float64
+}
+
+// point is a Point resolved against the configuration
+type point struct {
+	Point
+	station, channel       int
+	refStation, refChannel int
+
+	// current value and quality, and the value last sent spontaneously
+	valid    bool
+	value    float64
+	quality  byte
+	reported float64
+	time     time.Time
+}
+
+// single reports whether the point is a single point information
+func (p *point) single() bool {
+	return p.Kind == KindSinglePoint
+}
+
+// resolvePoints maps the points to station and channel indexes
+func resolvePoints(cfg *synchrophasor.ConfigFrame, points []Point) ([]point, error) {
+	out := make([]point, len(points))
+	seen := make(map[uint32]bool, len(points))
+	for i, pt := range points {
+		if pt.IOA > 0xFFFFFF {
+			return nil, fmt.Errorf("%w: IOA %d exceeds 24 bits", synchrophasor.ErrInvalidParameter, pt.IOA)
+		}
+		if seen[pt.IOA] {
+			return nil, fmt.Errorf("%w: duplicate IOA %d", synchrophasor.ErrInvalidParameter, pt.IOA)
+		}
+		seen[pt.IOA] = true
+
+		p := point{Point: pt, channel: -1, refChannel: -1}
+		var err error
+		if p.station, err = findStation(cfg, pt.Station); err != nil {
+			return nil, fmt.Errorf("IOA %d: %w", pt.IOA, err)
+		}
+		pmu := cfg.PMUStationList[p.station]
+		switch pt.Kind {
+		case KindFrequency, KindROCOF:
+		case KindMagnitude, KindAngle:
+			p.channel, err = findChannel(pmu.CHNAMPhasor, "phasor", pt.Channel)
+		case KindAngleDifference:
+			if p.channel, err = findChannel(pmu.CHNAMPhasor, "phasor", pt.Channel); err != nil {
+				break
+			}
+			ref := pt.RefStation
+			if ref == "" {
+				ref = pt.Station
+			}
+			if p.refStation, err = findStation(cfg, ref); err != nil {
+				break
+			}
+			p.refChannel, err = findChannel(cfg.PMUStationList[p.refStation].CHNAMPhasor, "phasor", pt.RefChannel)
+		case KindAnalog:
+			p.channel, err = findChannel(pmu.CHNAMAnalog, "analog", pt.Channel)
+		case KindSinglePoint:
+			p.channel, err = findChannel(pmu.CHNAMDigital, "digital", pt.Channel)
+		default:
+			err = fmt.Errorf("%w: unknown kind %d", synchrophasor.ErrInvalidParameter, pt.Kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("IOA %d: %w", pt.IOA, err)
+		}
+		out[i] = p
+	}
+	return out, nil
+}
+
+// findStation returns the index of the station with the given name or ID code
+func findStation(cfg *synchrophasor.ConfigFrame, name string) (int, error) {
+	if len(cfg.PMUStationList) == 0 {
+		return 0, fmt.Errorf("%w: configuration has no stations", synchrophasor.ErrInvalidParameter)
+	}
+	if name == "" {
+		return 0, nil
+	}
+	for i, pmu := range cfg.PMUStationList {
+		if strings.TrimSpace(pmu.STN) == name || strconv.Itoa(int(pmu.IDCode)) == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no station %q", synchrophasor.ErrInvalidParameter, name)
+}
+
+// findChannel returns the index of a channel name
+func findChannel(names []string, kind, name string) (int, error) {
+	for i, n := range names {
+		if strings.EqualFold(strings.TrimSpace(n), name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no %s channel %q", synchrophasor.ErrInvalidParameter, kind, name)
+}
+
+// update derives the point value from m and reports whether it has to be
+// sent spontaneously
+func (p *point) update(m *synchrophasor.Measurements, t time.Time) bool {
+	st := &m.Stations[p.station]
+	var v float64
+	switch p.Kind {
+	case KindFrequency:
+		v = float64(st.Frequency)
+	case KindROCOF:
+		v = float64(st.ROCOF)
+	case KindMagnitude:
+		v = phasor(st, p.channel, cmplx.Abs)
+	case KindAngle:
+		v = phasor(st, p.channel, angle)
+	case KindAngleDifference:
+		v = phasor(st, p.channel, angle) - phasor(&m.Stations[p.refStation], p.refChannel, angle)
+		v = math.Mod(v, 360)
+		switch {
+		case v > 180:
+			v -= 360
+		case v <= -180:
+			v += 360
+		}
+	case KindAnalog:
+		v = math.NaN()
+		if p.channel < len(st.Analog) {
+			v = float64(st.Analog[p.channel])
+		}
+	case KindSinglePoint:
+		v = math.NaN()
+		if word, bit := p.channel/16, p.channel%16; word < len(st.Digital) && bit < len(st.Digital[word]) {
+			v = 0
+			if st.Digital[word][bit] {
+				v = 1
+			}
+		}
+	}
+
+	var quality byte
+	switch {
+	case st.Stat&synchrophasor.StatDataError != 0 || math.IsNaN(v) || math.IsInf(v, 0):
+		quality = qualityInvalid
+	case st.Stat&statSyncLost != 0:
+		quality = qualityNotTopical
+	}
+	if quality&qualityInvalid != 0 && math.IsNaN(v) {
+		// Keep the last value so that the invalid flag carries it
+		v = p.value
+	}
+
+	changed := !p.valid || quality != p.quality
+	if !changed {
+		if p.single() || p.Deadband <= 0 {
+			changed = v != p.reported
+		} else {
+			changed = math.Abs(v-p.reported) >= p.Deadband
+		}
+	}
+	p.valid, p.value, p.quality, p.time = true, v, quality, t
+	if changed {
+		p.reported = v
+	}
+	return changed
+}
+
+// phasor applies f to the phasor at index i, NaN when missing
+func phasor(st *synchrophasor.StationMeasurement, i int, f func(complex128) float64) float64 {
+	if i >= len(st.Phasors) {
+		return math.NaN()
+	}
+	return f(st.Phasors[i])
+}
+
+// angle returns the phasor angle in degrees
+func angle(ph complex128) float64 {
+	return cmplx.Phase(ph) * 180 / math.Pi
+}
+
+// appendASDUs encodes the points in as few ASDUs as fit an APDU. Points
+// without a value are sent invalid.
+func appendASDUs(asdus [][]byte, points []*point, common uint16, cause uint8, timeTag bool) [][]byte {
+	for _, single := range []bool{false, true} {
+		var typeID uint8
+		var size int
+		switch {
+		case !single && !timeTag:
+			typeID, size = typeFloat, 3+5
+		case !single:
+			typeID, size = typeFloatTime, 3+5+7
+		case !timeTag:
+			typeID, size = typeSinglePoint, 3+1
+		default:
+			typeID, size = typeSinglePointTime, 3+1+7
+		}
+
+		var asdu []byte
+		count := 0
+		flush := func() {
+			if count > 0 {
+				asdu[1] = byte(count)
+				asdus = append(asdus, asdu)
+			}
+			asdu, count = nil, 0
+		}
+		for _, p := range points {
+			if p.single() != single {
+				continue
+			}
+			if count > 0 && len(asdu)+size > maxASDU || count == 0x7F {
+				flush()
+			}
+			if count == 0 {
+				asdu = appendHeader(make([]byte, 0, maxASDU), asduHeader{typeID: typeID, cause: cause, common: common})
+			}
+
+			quality := p.quality
+			if !p.valid {
+				quality = qualityInvalid
+			}
+			asdu = appendIOA(asdu, p.IOA)
+			if single {
+				if p.value == 1 {
+					quality |= 0x01
+				}
+				asdu = append(asdu, quality)
+			} else {
+				asdu = binary.LittleEndian.AppendUint32(asdu, math.Float32bits(float32(p.value)))
+				asdu = append(asdu, quality)
+			}
+			if timeTag {
+				asdu = appendCP56(asdu, p.time, !p.valid)
+			}
+			count++
+		}
+		flush()
+	}
+	return asdus
+}
@@ -0,0 +1,267 @@
+package iec104
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// session is a master connection
+type session struct {
+	g     *Gateway
+	conn  net.Conn
+	queue chan []byte
+	done  chan struct{}
+	once  sync.Once
+
+	// started is set by STARTDT, spontaneous ASDUs are dropped before
+	started bool
+	// sendSeq and recvSeq are the next send and expected receive sequence
+	// numbers, ackSeq the oldest unacknowledged sent one
+	sendSeq, recvSeq, ackSeq uint16
+	// sentAt holds the send times of unacknowledged I-frames
+	sentAt []time.Time
+	// unacked counts received I-frames not acknowledged yet, the first
+	// received at recvAt
+	unacked int
+	recvAt  time.Time
+	// lastRecv is the time of the last received frame, testAt the time of
+	// an unconfirmed TESTFR act
+	lastRecv time.Time
+	testAt   time.Time
+	pending  [][]byte
+	buf      []byte
+}
+
+// close ends the session
+func (s *session) close() {
+	s.once.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
+
+// run serves the connection until it fails or the session is closed
+func (s *session) run() error {
+	defer s.close()
+
+	frames := make(chan frame)
+	go func() {
+		defer close(frames)
+		for {
+			f, err := readFrame(s.conn)
+			if err != nil {
+				return
+			}
+			select {
+			case frames <- f:
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	opts := &s.g.opts
+	tick := time.NewTicker(min(opts.T1, opts.T2, opts.T3) / 4)
+	defer tick.Stop()
+	s.lastRecv = time.Now()
+
+	for {
+		if err := s.flush(); err != nil {
+			return err
+		}
+
+		// Stop taking spontaneous ASDUs while too many are pending so that
+		// the queue overflows for masters not acknowledging
+		queue := s.queue
+		if len(s.pending) >= opts.Buffer {
+			queue = nil
+		}
+
+		select {
+		case f, ok := <-frames:
+			if !ok {
+				return nil
+			}
+			if err := s.handle(f); err != nil {
+				return err
+			}
+		case asdu := <-queue:
+			if s.started {
+				s.pending = append(s.pending, asdu)
+			}
+		case now := <-tick.C:
+			if err := s.timers(now); err != nil {
+				return err
+			}
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+// flush sends pending ASDUs while the send window is open
+func (s *session) flush() error {
+	for s.started && len(s.pending) > 0 && len(s.sentAt) < s.g.opts.K {
+		asdu := s.pending[0]
+		s.pending[0] = nil
+		s.pending = s.pending[1:]
+		if err := s.send(appendI(s.buf[:0], s.sendSeq, s.recvSeq, asdu)); err != nil {
+			return err
+		}
+		s.sendSeq = (s.sendSeq + 1) & 0x7FFF
+		s.sentAt = append(s.sentAt, time.Now())
+		// I-frames acknowledge all received ones
+		s.unacked = 0
+	}
+	return nil
+}
+
+// send writes one APDU
+func (s *session) send(b []byte) error {
+	s.buf = b
+	if err := s.conn.SetWriteDeadline(time.Now().Add(s.g.opts.T1)); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// handle processes a received frame
+func (s *session) handle(f frame) error {
+	now := time.Now()
+	s.lastRecv = now
+
+	switch f.format {
+	case 'U':
+		switch f.function {
+		case startDTAct:
+			s.started = true
+			return s.send(appendU(s.buf[:0], startDTCon))
+		case stopDTAct:
+			s.started = false
+			s.pending = nil
+			if s.unacked > 0 {
+				if err := s.ack(); err != nil {
+					return err
+				}
+			}
+			return s.send(appendU(s.buf[:0], stopDTCon))
+		case testFRAct:
+			return s.send(appendU(s.buf[:0], testFRCon))
+		case testFRCon:
+			s.testAt = time.Time{}
+			return nil
+		}
+		return fmt.Errorf("%w: unknown U-frame function 0x%02X", ErrProtocol, f.function)
+	case 'S':
+		return s.acknowledged(f.recvSeq)
+	}
+
+	if !s.started {
+		return fmt.Errorf("%w: I-frame before STARTDT", ErrProtocol)
+	}
+	if f.sendSeq != s.recvSeq {
+		return fmt.Errorf("%w: received sequence %d, expected %d", ErrProtocol, f.sendSeq, s.recvSeq)
+	}
+	s.recvSeq = (s.recvSeq + 1) & 0x7FFF
+	if s.unacked == 0 {
+		s.recvAt = now
+	}
+	s.unacked++
+	if err := s.acknowledged(f.recvSeq); err != nil {
+		return err
+	}
+	if err := s.command(f.asdu); err != nil {
+		return err
+	}
+	if s.unacked >= s.g.opts.W {
+		return s.ack()
+	}
+	return nil
+}
+
+// acknowledged releases the sent I-frames before seq
+func (s *session) acknowledged(seq uint16) error {
+	n := int((seq - s.ackSeq) & 0x7FFF)
+	if n > len(s.sentAt) {
+		return fmt.Errorf("%w: acknowledged sequence %d not sent", ErrProtocol, seq)
+	}
+	s.sentAt = s.sentAt[n:]
+	s.ackSeq = seq
+	return nil
+}
+
+// ack sends an S-frame acknowledging all received I-frames
+func (s *session) ack() error {
+	s.unacked = 0
+	return s.send(appendS(s.buf[:0], s.recvSeq))
+}
+
+// command answers a received ASDU
+func (s *session) command(asdu []byte) error {
+	h, err := parseHeader(asdu)
+	if err != nil {
+		return err
+	}
+
+	// Replies mirror the command with another cause
+	mirror := func(cause uint8) {
+		reply := append([]byte(nil), asdu...)
+		reply[2] = cause | h.cause&0x80
+		s.pending = append(s.pending, reply)
+	}
+
+	if h.common != s.g.opts.CommonAddress && h.common != 0xFFFF {
+		mirror(causeUnknownAddress | causeNegative)
+		return nil
+	}
+	switch h.typeID {
+	case typeInterrogation:
+		if h.cause&0x3F != causeActivation || len(asdu) < 10 {
+			mirror(causeUnknownCause | causeNegative)
+			return nil
+		}
+		mirror(causeActivationCon)
+		// Only the station group holds points, group interrogations
+		// are confirmed empty
+		if asdu[9] == causeInterrogated {
+			s.pending = append(s.pending, s.g.interrogation()...)
+		}
+		mirror(causeActivationTerm)
+	case typeClockSync:
+		// The station time follows the PMUs, the command is confirmed
+		// without setting a clock
+		if h.cause&0x3F != causeActivation {
+			mirror(causeUnknownCause | causeNegative)
+			return nil
+		}
+		mirror(causeActivationCon)
+	default:
+		mirror(causeUnknownType | causeNegative)
+	}
+	return nil
+}
+
+// timers checks the T1 timeout and sends S-frames after T2 and test frames
+// after T3
+func (s *session) timers(now time.Time) error {
+	opts := &s.g.opts
+	if len(s.sentAt) > 0 && now.Sub(s.sentAt[0]) >= opts.T1 {
+		return fmt.Errorf("%w: I-frame not acknowledged within t1", ErrProtocol)
+	}
+	if !s.testAt.IsZero() && now.Sub(s.testAt) >= opts.T1 {
+		return fmt.Errorf("%w: TESTFR not confirmed within t1", ErrProtocol)
+	}
+	if s.unacked > 0 && now.Sub(s.recvAt) >= opts.T2 {
+		if err := s.ack(); err != nil {
+			return err
+		}
+	}
+	if s.testAt.IsZero() && now.Sub(s.lastRecv) >= opts.T3 {
+		s.testAt = now
+		return s.send(appendU(s.buf[:0], testFRAct))
+	}
+	return nil
+}
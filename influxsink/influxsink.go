@@ -0,0 +1,397 @@
+// Package influxsink writes synchrophasor measurements to InfluxDB using the
+// line protocol and the HTTP v2 write API
+package influxsink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ErrWrite is returned when the server rejects a batch
+var ErrWrite = errors.New("influxdb write failed")
+
+// Options configures an InfluxDB sink
+type Options struct {
+	// URL is the server base URL, e.g. http://localhost:8086
+	URL    string
+	Org    string
+	Bucket string
+	// Token is sent as "Authorization: Token <Token>"
+	Token string
+	// Measurement defaults to "synchrophasor"
+	Measurement string
+	// BatchSize is the number of lines sent per request, defaults to 5000
+	BatchSize int
+	// FlushInterval sends a partial batch once it is this old, defaults to one second
+	FlushInterval time.Duration
+	// MaxPending bounds the lines kept while the server is slow or
+	// unavailable, defaults to ten batches. The oldest lines are dropped
+	// beyond it.
+	MaxPending int
+	// MinBackoff and MaxBackoff bound the doubling delay before Write sends
+	// again after a failed request, defaulting to one and 30 seconds
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Gzip compresses request bodies
+	Gzip bool
+	// Client defaults to an http.Client with a 10 second timeout
+	Client *http.Client
+}
+
+// Sink batches measurements as line protocol and posts them to /api/v2/write.
+// Batches are sent from Write once full or older than FlushInterval, so a
+// Sink is not safe for concurrent use. When the server answers 429 or 5xx or
+// cannot be reached, the lines are kept and Write sends them again after a
+// backoff; other failures drop the batch.
+type Sink struct {
+	opts     Options
+	endpoint string
+	encoder  *Encoder
+	batch    []byte
+	lines    int
+	first    time.Time
+	gzipBuf  bytes.Buffer
+	// backoff is the delay after the last failed request, zero once a
+	// request succeeded, and Write does not send before retryAt
+	backoff time.Duration
+	retryAt time.Time
+	dropped uint64
+}
+
+// New creates a sink for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Sink, error) {
+	if opts.URL == "" || opts.Bucket == "" {
+		return nil, fmt.Errorf("%w: URL and bucket are required", synchrophasor.ErrInvalidParameter)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 5000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 10 * opts.BatchSize
+	}
+	opts.MaxPending = max(opts.MaxPending, opts.BatchSize)
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(30*time.Second, opts.MinBackoff)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	query := url.Values{}
+	query.Set("bucket", opts.Bucket)
+	query.Set("precision", "ns")
+	if opts.Org != "" {
+		query.Set("org", opts.Org)
+	}
+
+	return &Sink{
+		opts:     opts,
+		endpoint: strings.TrimSuffix(opts.URL, "/") + "/api/v2/write?" + query.Encode(),
+		encoder:  NewEncoder(cfg, opts.Measurement),
+	}, nil
+}
+
+// Write adds the measurement set to the batch and sends the batch if it is
+// full or older than the flush interval. After a failed request, the lines
+// are kept and sent again once the backoff has passed.
+func (s *Sink) Write(m *synchrophasor.Measurements) error {
+	if len(s.batch) == 0 {
+		s.first = time.Now()
+	}
+
+	var (
+		n   int
+		err error
+	)
+	s.batch, n, err = s.encoder.Append(s.batch, m)
+	if err != nil {
+		return err
+	}
+	s.lines += n
+	s.trim()
+
+	if s.backoff > 0 && time.Now().Before(s.retryAt) {
+		return nil
+	}
+	if s.lines >= s.opts.BatchSize || time.Since(s.first) >= s.opts.FlushInterval {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the pending lines in batches of BatchSize, regardless of the
+// backoff. On a retryable failure the unsent lines are kept for the next
+// Write or Flush.
+func (s *Sink) Flush() error {
+	for s.lines > 0 {
+		n := min(s.lines, s.opts.BatchSize)
+		end := lineEnd(s.batch, n)
+
+		retry, err := s.post(s.batch[:end])
+		if err != nil && retry {
+			s.backoff = min(max(2*s.backoff, s.opts.MinBackoff), s.opts.MaxBackoff)
+			s.retryAt = time.Now().Add(s.backoff)
+			return err
+		}
+		if err != nil {
+			s.dropped += uint64(n)
+		}
+		s.backoff = 0
+		s.batch = s.batch[:copy(s.batch, s.batch[end:])]
+		s.lines -= n
+		if err != nil {
+			return err
+		}
+	}
+	s.first = time.Now()
+	return nil
+}
+
+// Dropped returns the number of lines dropped because the server rejected
+// them or more than MaxPending were kept
+func (s *Sink) Dropped() uint64 {
+	return s.dropped
+}
+
+// trim drops the oldest lines beyond MaxPending
+func (s *Sink) trim() {
+	if s.lines <= s.opts.MaxPending {
+		return
+	}
+	n := s.lines - s.opts.MaxPending
+	s.batch = s.batch[:copy(s.batch, s.batch[lineEnd(s.batch, n):])]
+	s.lines -= n
+	s.dropped += uint64(n)
+}
+
+// lineEnd returns the offset after the first n lines of b
+func lineEnd(b []byte, n int) int {
+	end := 0
+	for ; n > 0; n-- {
+		i := bytes.IndexByte(b[end:], '\n')
+		if i < 0 {
+			return len(b)
+		}
+		end += i + 1
+	}
+	return end
+}
+
+// post sends lines of line protocol and reports whether a failure is
+// retryable
+func (s *Sink) post(body []byte) (bool, error) {
+	if s.opts.Gzip {
+		s.gzipBuf.Reset()
+		zw := gzip.NewWriter(&s.gzipBuf)
+		if _, err := zw.Write(body); err != nil {
+			return false, err
+		}
+		if err := zw.Close(); err != nil {
+			return false, err
+		}
+		body = s.gzipBuf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.opts.Token)
+	}
+	if s.opts.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%w: %s: %s", ErrWrite, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return false, nil
+}
+
+// Close sends the pending lines. Lines the server did not take are dropped.
+func (s *Sink) Close() error {
+	err := s.Flush()
+	s.dropped += uint64(s.lines)
+	s.batch, s.lines = nil, 0
+	return err
+}
+
+// Encoder formats measurements as line protocol. Every station produces a
+// line with freq, rocof and stat fields, every phasor a line with magnitude
+// and angle (degrees) fields and every analog channel a line with a value
+// field, tagged with station and channel. Digital words are written as
+// integer fields of the station line.
+type Encoder struct {
+	measurement string
+	stations    []encoderStation
+}
+
+// encoderStation holds the escaped line prefixes of one station
+type encoderStation struct {
+	station  string
+	phasors  []string
+	analogs  []string
+	digitals []string
+}
+
+// NewEncoder creates an encoder for the given configuration. The measurement
+// name defaults to "synchrophasor".
+func NewEncoder(cfg *synchrophasor.ConfigFrame, measurement string) *Encoder {
+	if measurement == "" {
+		measurement = "synchrophasor"
+	}
+	e := &Encoder{measurement: escape(measurement, ", ")}
+
+	for _, pmu := range cfg.PMUStationList {
+		prefix := e.measurement + ",station=" + escape(strings.TrimSpace(pmu.STN), ",= ")
+		st := encoderStation{station: prefix + " "}
+		for _, name := range pmu.CHNAMPhasor {
+			st.phasors = append(st.phasors, prefix+",channel="+escape(strings.TrimSpace(name), ",= ")+" ")
+		}
+		for _, name := range pmu.CHNAMAnalog {
+			st.analogs = append(st.analogs, prefix+",channel="+escape(strings.TrimSpace(name), ",= ")+" ")
+		}
+		for word := 0; word < int(pmu.Dgnmr); word++ {
+			st.digitals = append(st.digitals, fmt.Sprintf("digital%d=", word))
+		}
+		e.stations = append(e.stations, st)
+	}
+	return e
+}
+
+// Append appends the lines for m to b and returns the number of lines added.
+// Fields that are NaN or infinite are omitted, as InfluxDB rejects them.
+func (e *Encoder) Append(b []byte, m *synchrophasor.Measurements) ([]byte, int, error) {
+	if len(m.Stations) != len(e.stations) {
+		return b, 0, fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(e.stations))
+	}
+
+	ts := m.UnixNano()
+	lines := 0
+
+	for i := range m.Stations {
+		st, enc := &m.Stations[i], &e.stations[i]
+
+		// Station line: the stat field is always present
+		b = append(b, enc.station...)
+		b = appendField(b, "freq=", float64(st.Frequency))
+		b = appendField(b, "rocof=", float64(st.ROCOF))
+		b = append(b, "stat="...)
+		b = strconv.AppendUint(b, uint64(st.Stat), 10)
+		b = append(b, 'i')
+		for w, word := range st.Digital {
+			if w >= len(enc.digitals) {
+				break
+			}
+			var bits uint64
+			for bit, v := range word {
+				if v {
+					bits |= 1 << uint(bit)
+				}
+			}
+			b = append(b, ',')
+			b = append(b, enc.digitals[w]...)
+			b = strconv.AppendUint(b, bits, 10)
+			b = append(b, 'i')
+		}
+		b = appendTimestamp(b, ts)
+		lines++
+
+		for j, ph := range st.Phasors {
+			if j >= len(enc.phasors) {
+				break
+			}
+			mag, ang := cmplx.Abs(ph), cmplx.Phase(ph)*180/math.Pi
+			if !finite(mag) || !finite(ang) {
+				continue
+			}
+			b = append(b, enc.phasors[j]...)
+			b = append(b, "magnitude="...)
+			b = strconv.AppendFloat(b, mag, 'g', -1, 64)
+			b = append(b, ",angle="...)
+			b = strconv.AppendFloat(b, ang, 'g', -1, 64)
+			b = appendTimestamp(b, ts)
+			lines++
+		}
+
+		for j, v := range st.Analog {
+			if j >= len(enc.analogs) || !finite(float64(v)) {
+				continue
+			}
+			b = append(b, enc.analogs[j]...)
+			b = append(b, "value="...)
+			b = strconv.AppendFloat(b, float64(v), 'g', -1, 32)
+			b = appendTimestamp(b, ts)
+			lines++
+		}
+	}
+	return b, lines, nil
+}
+
+// appendField appends a float field followed by a comma, skipping NaN and Inf
+func appendField(b []byte, key string, v float64) []byte {
+	if !finite(v) {
+		return b
+	}
+	b = append(b, key...)
+	b = strconv.AppendFloat(b, v, 'g', -1, 32)
+	return append(b, ',')
+}
+
+// appendTimestamp appends the timestamp and line terminator
+func appendTimestamp(b []byte, ts int64) []byte {
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, ts, 10)
+	return append(b, '\n')
+}
+
+// finite reports whether v is neither NaN nor infinite
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// escape backslash-escapes the characters in special
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,132 @@
+package influxsink
+
+import (
+	"compress/gzip"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func testMeasurements() (*synchrophasor.ConfigFrame, *synchrophasor.Measurements) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Sub 1", 7734, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P,Q", 1, 0)
+	station.AddDigital([]string{"BRK"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+
+	station.PhasorValues[0] = complex(0, 230)
+	station.AnalogValues[0] = float32(math.NaN())
+	station.Freq = 50
+	station.DigitalValues[0][0] = true
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000000
+	df.FracSec = 500000
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return cfg, &m
+}
+
+func TestEncoder(t *testing.T) {
+	cfg, m := testMeasurements()
+	b, n, err := NewEncoder(cfg, "").Append(nil, m)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Equal(t,
+		"synchrophasor,station=Sub\\ 1 freq=50,rocof=0,stat=0i,digital0=1i 1700000000500000000\n"+
+			"synchrophasor,station=Sub\\ 1,channel=VA magnitude=230,angle=90 1700000000500000000\n",
+		string(b))
+}
+
+func TestSink(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v2/write", r.URL.Path)
+		require.Equal(t, "grid", r.URL.Query().Get("bucket"))
+		require.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{
+		URL: srv.URL, Bucket: "grid", Token: "secret", BatchSize: 4, FlushInterval: time.Hour, Gzip: true,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Write(m))
+	}
+	require.Len(t, bodies, 1)
+	require.Equal(t, 4, strings.Count(bodies[0], "\n"))
+
+	require.NoError(t, sink.Close())
+	require.Len(t, bodies, 2)
+	require.Equal(t, 2, strings.Count(bodies[1], "\n"))
+}
+
+func TestSinkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"message":"unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{URL: srv.URL, Bucket: "grid", BatchSize: 1})
+	require.NoError(t, err)
+	require.ErrorIs(t, sink.Write(m), ErrWrite)
+}
+
+func TestSinkUnavailable(t *testing.T) {
+	var requests, lines int
+	failing := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		lines += strings.Count(string(body), "\n")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{
+		URL: srv.URL, Bucket: "grid", BatchSize: 2, MaxPending: 6, FlushInterval: time.Hour, MinBackoff: time.Hour,
+	})
+	require.NoError(t, err)
+
+	// The first full batch fails, later writes keep the lines without sending
+	require.ErrorIs(t, sink.Write(m), ErrWrite)
+	for i := 0; i < 9; i++ {
+		require.NoError(t, sink.Write(m))
+	}
+	require.Equal(t, 1, requests)
+	require.Equal(t, 6, sink.lines)
+	require.Equal(t, uint64(14), sink.Dropped())
+
+	// Flush ignores the backoff and sends the kept lines in batches
+	failing = false
+	require.NoError(t, sink.Flush())
+	require.Equal(t, 4, requests)
+	require.Equal(t, 6, lines)
+	require.NoError(t, sink.Close())
+}
@@ -0,0 +1,331 @@
+// Package island detects probable islanding by comparing the frequency and
+// voltage angle of groups of stations: groups whose angle difference or
+// frequency difference stays beyond the limits for the dwell time are
+// considered separated, and every change of the resulting islands is reported
+// as an event carrying the station sets
+package island
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Group is a set of stations expected to stay synchronous, e.g. the
+// substations of one area
+type Group struct {
+	Name string
+	// Stations are station names, each in one group at most
+	Stations []string
+}
+
+// Options configures a Detector
+type Options struct {
+	// Groups defaults to one group per station, named after it
+	Groups []Group
+	// Phasors lists the voltage phasors compared, named "Sub 1.VA", at most
+	// one per station. Stations not listed use their first phasor.
+	Phasors []string
+	// MaxAngle is the angle difference between groups in degrees beyond
+	// which they diverge, defaults to 30
+	MaxAngle float64
+	// MaxFrequency is the frequency difference between groups in Hz beyond
+	// which they diverge, defaults to 0.1
+	MaxFrequency float64
+	// Dwell is how long groups must diverge before they are separated, and
+	// converge before they are joined again, defaults to 1s
+	Dwell time.Duration
+	// OnEvent is called with every change of the islands from Write
+	OnEvent func(e Event)
+}
+
+// Event reports a change of the islands
+type Event struct {
+	// Time is the measurement time of the change
+	Time time.Time
+	// Islands lists the stations of every island, a single one while the
+	// system is connected
+	Islands [][]string
+	// Groups lists the group names of every island
+	Groups [][]string
+}
+
+// Islanded reports whether the system is split into more than one island
+func (e Event) Islanded() bool {
+	return len(e.Islands) > 1
+}
+
+// member is a station of a group
+type member struct {
+	station, phasor int
+}
+
+// pair is the state of two groups
+type pair struct {
+	a, b int
+	// diverged is the confirmed state, pending the start of the opposite
+	// state, zero if none
+	diverged bool
+	pending  int64
+}
+
+// Detector tracks the islands of a stream. Write must be called from a single
+// goroutine, Islands may be called concurrently.
+type Detector struct {
+	opts    Options
+	mu      sync.Mutex
+	cfg     *synchrophasor.ConfigFrame
+	members [][]member
+	pairs   []pair
+	// island is the island index of every group
+	island []int
+	last   Event
+}
+
+// New creates a detector for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Detector, error) {
+	if opts.MaxAngle <= 0 {
+		opts.MaxAngle = 30
+	}
+	if opts.MaxFrequency <= 0 {
+		opts.MaxFrequency = 0.1
+	}
+	if opts.Dwell <= 0 {
+		opts.Dwell = time.Second
+	}
+	if len(opts.Groups) == 0 {
+		for _, pmu := range cfg.PMUStationList {
+			name := strings.TrimSpace(pmu.STN)
+			opts.Groups = append(opts.Groups, Group{Name: name, Stations: []string{name}})
+		}
+	}
+	if len(opts.Groups) < 2 {
+		return nil, fmt.Errorf("%w: %d groups, at least 2 needed", synchrophasor.ErrInvalidParameter, len(opts.Groups))
+	}
+
+	d := &Detector{opts: opts, island: make([]int, len(opts.Groups))}
+	for a := range opts.Groups {
+		for b := a + 1; b < len(opts.Groups); b++ {
+			d.pairs = append(d.pairs, pair{a: a, b: b})
+		}
+	}
+	if err := d.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	d.last = d.event(0)
+	d.last.Time = time.Time{}
+	return d, nil
+}
+
+// SetConfig replaces the configuration, keeping the islands
+func (d *Detector) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.setConfig(cfg)
+}
+
+// setConfig resolves the stations of the groups in cfg, d.mu must be held
+func (d *Detector) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	stations := make(map[string]int, len(cfg.PMUStationList))
+	phasors := make([]int, len(cfg.PMUStationList))
+	refs := make(map[string][2]int)
+	for i, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN)
+		stations[stn] = i
+		phasors[i] = -1
+		if len(pmu.CHNAMPhasor) > 0 {
+			phasors[i] = 0
+		}
+		for j, name := range pmu.CHNAMPhasor {
+			refs[stn+"."+strings.TrimSpace(name)] = [2]int{i, j}
+		}
+	}
+	selected := make([]bool, len(phasors))
+	for _, name := range d.opts.Phasors {
+		ref, ok := refs[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		if selected[ref[0]] {
+			return fmt.Errorf("%w: more than one phasor of the station of %q", synchrophasor.ErrInvalidParameter, name)
+		}
+		selected[ref[0]] = true
+		phasors[ref[0]] = ref[1]
+	}
+
+	members := make([][]member, len(d.opts.Groups))
+	grouped := make(map[string]string)
+	for g, group := range d.opts.Groups {
+		if len(group.Stations) == 0 {
+			return fmt.Errorf("%w: group %q has no stations", synchrophasor.ErrInvalidParameter, group.Name)
+		}
+		for _, name := range group.Stations {
+			i, ok := stations[name]
+			if !ok {
+				return fmt.Errorf("%w: group %q: unknown station %q", synchrophasor.ErrInvalidParameter, group.Name, name)
+			}
+			if other, ok := grouped[name]; ok {
+				return fmt.Errorf("%w: station %q in groups %q and %q",
+					synchrophasor.ErrInvalidParameter, name, other, group.Name)
+			}
+			grouped[name] = group.Name
+			if phasors[i] < 0 {
+				return fmt.Errorf("%w: station %q has no phasors", synchrophasor.ErrInvalidParameter, name)
+			}
+			members[g] = append(members[g], member{i, phasors[i]})
+		}
+	}
+	d.cfg, d.members = cfg, members
+	return nil
+}
+
+// Write evaluates a measurement set, calling OnEvent if the islands changed.
+// Groups without valid stations keep their state. The stations of m must
+// match the configuration.
+func (d *Detector) Write(m *synchrophasor.Measurements) error {
+	t := m.UnixNano()
+	d.mu.Lock()
+	if len(m.Stations) != len(d.cfg.PMUStationList) {
+		d.mu.Unlock()
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(d.cfg.PMUStationList))
+	}
+	for i, pmu := range d.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			d.mu.Unlock()
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	angles := make([]float64, len(d.members))
+	freqs := make([]float64, len(d.members))
+	valid := make([]bool, len(d.members))
+	for g, members := range d.members {
+		angles[g], freqs[g], valid[g] = groupState(m, members)
+	}
+
+	changed := false
+	for i := range d.pairs {
+		p := &d.pairs[i]
+		if !valid[p.a] || !valid[p.b] {
+			continue
+		}
+		angle := math.Abs(math.Remainder(angles[p.a]-angles[p.b], 360))
+		diverged := angle > d.opts.MaxAngle || math.Abs(freqs[p.a]-freqs[p.b]) > d.opts.MaxFrequency
+		if diverged == p.diverged {
+			p.pending = 0
+			continue
+		}
+		if p.pending == 0 {
+			p.pending = t
+		}
+		if t-p.pending >= int64(d.opts.Dwell) {
+			p.diverged, p.pending, changed = diverged, 0, true
+		}
+	}
+
+	var events []Event
+	if changed && d.partition() {
+		d.last = d.event(t)
+		events = append(events, d.last)
+	}
+	d.mu.Unlock()
+
+	if d.opts.OnEvent != nil {
+		for _, ev := range events {
+			d.opts.OnEvent(ev)
+		}
+	}
+	return nil
+}
+
+// groupState returns the mean angle in degrees and frequency of the valid
+// stations of a group, false if there are none
+func groupState(m *synchrophasor.Measurements, members []member) (float64, float64, bool) {
+	var sum complex128
+	var freq float64
+	n := 0
+	for _, mb := range members {
+		st := &m.Stations[mb.station]
+		p := st.Phasors[mb.phasor]
+		if st.Stat&synchrophasor.StatDataError != 0 || cmplx.IsNaN(p) || cmplx.IsInf(p) || p == 0 ||
+			math.IsNaN(float64(st.Frequency)) {
+			continue
+		}
+		// Unit phasors, so every station weighs the same
+		sum += p / complex(cmplx.Abs(p), 0)
+		freq += float64(st.Frequency)
+		n++
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	return cmplx.Phase(sum) * 180 / math.Pi, freq / float64(n), true
+}
+
+// partition groups the groups connected by pairs that did not diverge into
+// islands, reporting whether the islands changed
+func (d *Detector) partition() bool {
+	island := make([]int, len(d.members))
+	for g := range island {
+		island[g] = g
+	}
+	var find func(g int) int
+	find = func(g int) int {
+		if island[g] != g {
+			island[g] = find(island[g])
+		}
+		return island[g]
+	}
+	for _, p := range d.pairs {
+		if !p.diverged {
+			a, b := find(p.a), find(p.b)
+			island[max(a, b)] = min(a, b)
+		}
+	}
+	// Number the islands by their first group
+	index := make(map[int]int)
+	for g := range island {
+		root := find(g)
+		if _, ok := index[root]; !ok {
+			index[root] = len(index)
+		}
+		island[g] = index[root]
+	}
+
+	if slices.Equal(island, d.island) {
+		return false
+	}
+	d.island = island
+	return true
+}
+
+// event returns the islands at time t
+func (d *Detector) event(t int64) Event {
+	n := slices.Max(d.island) + 1
+	ev := Event{
+		Time:    time.Unix(0, t).UTC(),
+		Islands: make([][]string, n),
+		Groups:  make([][]string, n),
+	}
+	for g, i := range d.island {
+		group := d.opts.Groups[g]
+		ev.Groups[i] = append(ev.Groups[i], group.Name)
+		ev.Islands[i] = append(ev.Islands[i], group.Stations...)
+	}
+	return ev
+}
+
+// Islands returns the latest change of the islands, or the connected system
+// at the zero time if none was detected
+func (d *Detector) Islands() Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last
+}
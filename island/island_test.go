@@ -0,0 +1,105 @@
+package island
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 4, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// VA angles in degrees and frequencies of the stations
+func set(cfg *synchrophasor.ConfigFrame, i int, angles, freqs []float64) *synchrophasor.Measurements {
+	for j, pmu := range cfg.PMUStationList {
+		pmu.PhasorValues[0] = cmplx.Rect(10, math.Pi)
+		pmu.PhasorValues[1] = cmplx.Rect(230, angles[j]*math.Pi/180)
+		pmu.Freq = float32(freqs[j])
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+func TestDetector(t *testing.T) {
+	cfg := testConfig()
+	var events []Event
+	d, err := New(cfg, Options{
+		Groups: []Group{
+			{Name: "North", Stations: []string{"Sub 1", "Sub 2"}},
+			{Name: "South", Stations: []string{"Sub 3"}},
+			{Name: "East", Stations: []string{"Sub 4"}},
+		},
+		Phasors: []string{"Sub 1.VA", "Sub 2.VA", "Sub 3.VA", "Sub 4.VA"},
+		Dwell:   300 * time.Millisecond,
+		OnEvent: func(e Event) { events = append(events, e) },
+	})
+	require.NoError(t, err)
+	require.False(t, d.Islands().Islanded())
+	require.True(t, d.Islands().Time.IsZero())
+
+	// Angles wrap around ±180 degrees
+	freqs := []float64{50, 50, 50, 50}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Write(set(cfg, i, []float64{170, -170, 175, 160}, freqs)))
+	}
+	require.Empty(t, events)
+
+	// South drifts away in frequency, East stays within the angle limit of
+	// North
+	freqs = []float64{50, 50, 50.3, 50}
+	for i := 5; i < 8; i++ {
+		require.NoError(t, d.Write(set(cfg, i, []float64{0, 0, 0, 20}, freqs)))
+	}
+	require.Empty(t, events)
+	require.NoError(t, d.Write(set(cfg, 8, []float64{0, 0, 0, 20}, freqs)))
+	require.Len(t, events, 1)
+	require.True(t, events[0].Islanded())
+	require.Equal(t, [][]string{{"North", "East"}, {"South"}}, events[0].Groups)
+	require.Equal(t, [][]string{{"Sub 1", "Sub 2", "Sub 4"}, {"Sub 3"}}, events[0].Islands)
+	require.Equal(t, time.Unix(1700000000, 800000000).UTC(), events[0].Time)
+
+	// Sets without valid stations keep the state, then the groups converge
+	freqs = []float64{50, 50, 50, 50}
+	invalid := set(cfg, 9, []float64{0, 0, 0, 0}, freqs)
+	invalid.Stations[2].Stat = 0x8000
+	for i := 9; i < 13; i++ {
+		require.NoError(t, d.Write(invalid))
+	}
+	require.Len(t, events, 1)
+	for i := 13; i < 17; i++ {
+		require.NoError(t, d.Write(set(cfg, i, []float64{0, 0, 0, 0}, freqs)))
+	}
+	require.Len(t, events, 2)
+	require.False(t, events[1].Islanded())
+	require.Equal(t, [][]string{{"Sub 1", "Sub 2", "Sub 3", "Sub 4"}}, d.Islands().Islands)
+
+	require.ErrorIs(t, d.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+}
+
+func TestNew(t *testing.T) {
+	cfg := testConfig()
+	d, err := New(cfg, Options{})
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"Sub 1", "Sub 2", "Sub 3", "Sub 4"}}, d.Islands().Groups)
+
+	for _, opts := range []Options{
+		{Groups: []Group{{Name: "All", Stations: []string{"Sub 1", "Sub 2"}}}},
+		{Groups: []Group{{Name: "A", Stations: []string{"Sub 1"}}, {Name: "B", Stations: []string{"Sub 5"}}}},
+		{Groups: []Group{{Name: "A", Stations: []string{"Sub 1"}}, {Name: "B", Stations: []string{"Sub 1"}}}},
+		{Groups: []Group{{Name: "A", Stations: []string{"Sub 1"}}, {Name: "B"}}},
+		{Phasors: []string{"Sub 1.VB"}},
+		{Phasors: []string{"Sub 1.VA", "Sub 1.IA"}},
+	} {
+		_, err := New(cfg, opts)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+}
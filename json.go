@@ -0,0 +1,274 @@
+package synchrophasor
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+)
+
+// jsonFloat encodes NaN and infinities, which mark missing data, as null
+type jsonFloat float64
+
+// MarshalJSON implements json.Marshaler
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return []byte("null"), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+// jsonFloat32 is jsonFloat for single precision values, keeping their short form
+type jsonFloat32 float32
+
+// MarshalJSON implements json.Marshaler
+func (f jsonFloat32) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return []byte("null"), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 32), nil
+}
+
+// jsonPhasor is a phasor in polar form with the angle in degrees
+type jsonPhasor struct {
+	Name      string    `json:"name,omitempty"`
+	Magnitude jsonFloat `json:"magnitude"`
+	Angle     jsonFloat `json:"angle"`
+}
+
+// newJSONPhasor converts a phasor value to its JSON form
+func newJSONPhasor(name string, v complex128) jsonPhasor {
+	return jsonPhasor{
+		Name:      strings.TrimSpace(name),
+		Magnitude: jsonFloat(cmplx.Abs(v)),
+		Angle:     jsonFloat(cmplx.Phase(v) * 180 / math.Pi),
+	}
+}
+
+// jsonCommon holds the fields shared by every frame type
+type jsonCommon struct {
+	Frame   string `json:"frame"`
+	IDCode  uint16 `json:"id_code"`
+	SOC     uint32 `json:"soc"`
+	FracSec uint32 `json:"frac_sec"`
+}
+
+// jsonCommonOf returns the common fields of a frame
+func jsonCommonOf(c *C37118) jsonCommon {
+	names := [...]string{"data", "header", "cfg1", "cfg2", "command", "cfg3"}
+	frame := "unknown"
+	if t := int(c.Sync>>4) & 0x07; t < len(names) {
+		frame = names[t]
+	}
+	return jsonCommon{Frame: frame, IDCode: c.IDCode, SOC: c.SOC, FracSec: c.FracSec}
+}
+
+// MarshalJSON implements json.Marshaler
+func (h *HeaderFrame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonCommon
+		Data string `json:"data"`
+	}{jsonCommonOf(&h.C37118), h.Data})
+}
+
+// MarshalJSON implements json.Marshaler
+func (c *CommandFrame) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonCommon
+		CMD        uint16 `json:"cmd"`
+		ExtraFrame []byte `json:"extra_frame,omitempty"`
+	}{jsonCommonOf(&c.C37118), c.CMD, c.ExtraFrame})
+}
+
+// jsonChannel is a configured phasor or analog channel
+type jsonChannel struct {
+	Name   string `json:"name"`
+	Type   uint8  `json:"type"`
+	Factor uint32 `json:"factor"`
+}
+
+// jsonDigitalWord is a configured 16 bit digital word
+type jsonDigitalWord struct {
+	Names  []string `json:"names"`
+	Normal uint16   `json:"normal"`
+	Valid  uint16   `json:"valid"`
+}
+
+// jsonStationConfig is the configuration of one PMU station
+type jsonStationConfig struct {
+	STN     string            `json:"stn"`
+	IDCode  uint16            `json:"id_code"`
+	Format  uint16            `json:"format"`
+	Phasors []jsonChannel     `json:"phasors"`
+	Analog  []jsonChannel     `json:"analog"`
+	Digital []jsonDigitalWord `json:"digital"`
+	Fnom    float32           `json:"fnom"`
+	CfgCnt  uint16            `json:"cfg_cnt"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (c *ConfigFrame) MarshalJSON() ([]byte, error) {
+	stations := make([]jsonStationConfig, len(c.PMUStationList))
+	for i, pmu := range c.PMUStationList {
+		s := &stations[i]
+		s.STN = strings.TrimSpace(pmu.STN)
+		s.IDCode = pmu.IDCode
+		s.Format = pmu.Format
+		s.Fnom = pmu.GetNominalFrequency()
+		s.CfgCnt = pmu.CfgCnt
+
+		s.Phasors = make([]jsonChannel, len(pmu.CHNAMPhasor))
+		for j, name := range pmu.CHNAMPhasor {
+			s.Phasors[j] = jsonChannel{Name: strings.TrimSpace(name)}
+			if j < len(pmu.Phunit) {
+				s.Phasors[j].Type = uint8(pmu.Phunit[j] >> 24)
+				s.Phasors[j].Factor = pmu.Phunit[j] & 0x0FFFFFF
+			}
+		}
+
+		s.Analog = make([]jsonChannel, len(pmu.CHNAMAnalog))
+		for j, name := range pmu.CHNAMAnalog {
+			s.Analog[j] = jsonChannel{Name: strings.TrimSpace(name)}
+			if j < len(pmu.Anunit) {
+				s.Analog[j].Type = uint8(pmu.Anunit[j] >> 24)
+				s.Analog[j].Factor = pmu.Anunit[j] & 0x0FFFFFF
+			}
+		}
+
+		s.Digital = make([]jsonDigitalWord, len(pmu.Dgunit))
+		for j, unit := range pmu.Dgunit {
+			s.Digital[j] = jsonDigitalWord{
+				Names:  digitalNames(pmu, j),
+				Normal: uint16(unit >> 16),
+				Valid:  uint16(unit),
+			}
+		}
+	}
+
+	return json.Marshal(struct {
+		jsonCommon
+		TimeBase uint32              `json:"time_base"`
+		DataRate int16               `json:"data_rate"`
+		Stations []jsonStationConfig `json:"stations"`
+	}{jsonCommonOf(&c.C37118), c.TimeBase, c.DataRate, stations})
+}
+
+// digitalNames returns the trimmed channel names of a digital word
+func digitalNames(pmu *PMUStation, word int) []string {
+	names := make([]string, 0, 16)
+	for i := word * 16; i < (word+1)*16 && i < len(pmu.CHNAMDigital); i++ {
+		names = append(names, strings.TrimSpace(pmu.CHNAMDigital[i]))
+	}
+	return names
+}
+
+// jsonValue is a named analog or digital value
+type jsonValue struct {
+	Name  string      `json:"name,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// jsonStationData holds the values of one PMU station in a data frame
+type jsonStationData struct {
+	STN       string       `json:"stn"`
+	IDCode    uint16       `json:"id_code"`
+	Stat      uint16       `json:"stat"`
+	Frequency jsonFloat32  `json:"frequency"`
+	ROCOF     jsonFloat32  `json:"rocof"`
+	Phasors   []jsonPhasor `json:"phasors"`
+	Analog    []jsonValue  `json:"analog"`
+	Digital   []jsonValue  `json:"digital"`
+}
+
+// MarshalJSON implements json.Marshaler. Values are labelled with the channel
+// names of the associated configuration.
+func (d *DataFrame) MarshalJSON() ([]byte, error) {
+	cfg := d.AssociatedConfig
+	if cfg == nil {
+		return nil, ErrInvalidParameter
+	}
+
+	stations := make([]jsonStationData, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		s := &stations[i]
+		s.STN = strings.TrimSpace(pmu.STN)
+		s.IDCode = pmu.IDCode
+		s.Stat = pmu.Stat
+		s.Frequency = jsonFloat32(pmu.Freq)
+		s.ROCOF = jsonFloat32(pmu.DFreq)
+
+		s.Phasors = make([]jsonPhasor, len(pmu.PhasorValues))
+		for j, v := range pmu.PhasorValues {
+			s.Phasors[j] = newJSONPhasor(pmu.PhasorName(j), v)
+		}
+
+		s.Analog = make([]jsonValue, len(pmu.AnalogValues))
+		for j, v := range pmu.AnalogValues {
+			s.Analog[j] = jsonValue{Name: pmu.AnalogName(j), Value: jsonFloat32(v)}
+		}
+
+		s.Digital = make([]jsonValue, 0, 16*len(pmu.DigitalValues))
+		for j, word := range pmu.DigitalValues {
+			for k, bit := range word {
+				s.Digital = append(s.Digital, jsonValue{Name: pmu.DigitalName(j*16 + k), Value: bit})
+			}
+		}
+	}
+
+	var timestamp jsonFloat
+	if cfg.TimeBase != 0 {
+		timestamp = jsonFloat(float64(d.SOC) + float64(d.FracSec&0x00FFFFFF)/float64(cfg.TimeBase))
+	}
+
+	return json.Marshal(struct {
+		jsonCommon
+		Time     jsonFloat         `json:"time"`
+		Stations []jsonStationData `json:"stations"`
+	}{jsonCommonOf(&d.C37118), timestamp, stations})
+}
+
+// MarshalJSON implements json.Marshaler, encoding phasors in polar form
+func (s StationMeasurement) MarshalJSON() ([]byte, error) {
+	phasors := make([]jsonPhasor, len(s.Phasors))
+	for i, v := range s.Phasors {
+		phasors[i] = newJSONPhasor("", v)
+	}
+	analog := make([]jsonFloat32, len(s.Analog))
+	for i, v := range s.Analog {
+		analog[i] = jsonFloat32(v)
+	}
+
+	return json.Marshal(struct {
+		StreamID  uint16        `json:"stream_id"`
+		Stat      uint16        `json:"stat"`
+		Phasors   []jsonPhasor  `json:"phasors"`
+		Analog    []jsonFloat32 `json:"analog"`
+		Digital   [][]bool      `json:"digital"`
+		Frequency jsonFloat32   `json:"frequency"`
+		ROCOF     jsonFloat32   `json:"rocof"`
+		Quality   jsonFloat32   `json:"quality"`
+	}{s.StreamID, s.Stat, phasors, analog, s.Digital, jsonFloat32(s.Frequency), jsonFloat32(s.ROCOF),
+		jsonFloat32(s.Quality)})
+}
+
+// NDJSONWriter writes frames and measurements as newline-delimited JSON, one
+// value per line, for piping into jq or log pipelines
+type NDJSONWriter struct {
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter creates a writer emitting to w
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &NDJSONWriter{enc: enc}
+}
+
+// Write encodes v, typically a frame or *Measurements, followed by a newline
+func (n *NDJSONWriter) Write(v interface{}) error {
+	return n.enc.Encode(v)
+}
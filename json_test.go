@@ -0,0 +1,80 @@
+package synchrophasor
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataFrameMarshalJSON(t *testing.T) {
+	cfg := newBenchConfig(1)
+	station := cfg.PMUStationList[0]
+	station.PhasorValues[0] = complex(0, 230)
+	station.AnalogValues[0] = float32(math.NaN())
+	station.DigitalValues[0][0] = true
+	station.Freq = 50
+
+	df := NewDataFrame(cfg)
+	df.SOC = 100
+	df.FracSec = 500000
+
+	data, err := json.Marshal(df)
+	require.NoError(t, err)
+
+	var out struct {
+		Frame    string  `json:"frame"`
+		Time     float64 `json:"time"`
+		Stations []struct {
+			STN     string `json:"stn"`
+			Phasors []struct {
+				Name      string  `json:"name"`
+				Magnitude float64 `json:"magnitude"`
+				Angle     float64 `json:"angle"`
+			} `json:"phasors"`
+			Analog []struct {
+				Value *float64 `json:"value"`
+			} `json:"analog"`
+			Digital []struct {
+				Name  string `json:"name"`
+				Value bool   `json:"value"`
+			} `json:"digital"`
+		} `json:"stations"`
+	}
+	require.NoError(t, json.Unmarshal(data, &out))
+
+	require.Equal(t, "data", out.Frame)
+	require.InDelta(t, 100.5, out.Time, 1e-9)
+	require.Equal(t, "Station 0", out.Stations[0].STN)
+	require.Equal(t, "VA", out.Stations[0].Phasors[0].Name)
+	require.InDelta(t, 230, out.Stations[0].Phasors[0].Magnitude, 1e-9)
+	require.InDelta(t, 90, out.Stations[0].Phasors[0].Angle, 1e-9)
+	require.Nil(t, out.Stations[0].Analog[0].Value)
+	require.Equal(t, "BREAKER 1 STATUS", out.Stations[0].Digital[0].Name)
+	require.True(t, out.Stations[0].Digital[0].Value)
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	cfg := newBenchConfig(2)
+	df := NewDataFrame(cfg)
+	var m Measurements
+	df.FillMeasurements(&m)
+	m.Stations[1].Quality = 0.5
+
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	require.NoError(t, w.Write(cfg))
+	require.NoError(t, w.Write(&m))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], `"frame":"cfg2"`)
+	require.Contains(t, lines[1], `"stream_id":2`)
+	require.Contains(t, lines[1], `"quality":0.5}`)
+	for _, line := range lines {
+		require.True(t, json.Valid([]byte(line)))
+	}
+}
@@ -0,0 +1,240 @@
+// Package lineparam estimates the series impedance and shunt admittance of
+// transmission lines from aligned voltage and current phasors measured at
+// both ends, fitting the nominal pi model over a sliding window, for model
+// validation
+package lineparam
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Line configures the phasors of both ends of a line, named "Sub 1.VA". Each
+// end lists one phasor, e.g. a positive sequence phasor, or three phase
+// phasors whose positive sequence is used. Currents flow into the line at
+// both ends.
+type Line struct {
+	Name                               string
+	SendingVoltage, SendingCurrent     []string
+	ReceivingVoltage, ReceivingCurrent []string
+}
+
+// Options configures an Estimator
+type Options struct {
+	Lines []Line
+	// Window is the number of valid sets fitted, defaults to 50. Estimates
+	// are available once the window is filled.
+	Window int
+}
+
+// Estimate holds the parameters of a line in ohm and siemens
+type Estimate struct {
+	Line string
+	// Z is the series impedance R + jX
+	Z complex128
+	// Y is the total shunt admittance G + jB, half of it at each end
+	Y complex128
+	// Time is the time of the latest set of the window
+	Time time.Time
+	// Valid is false until the window is filled or if the ends do not
+	// determine the parameters, e.g. at equal voltages
+	Valid bool
+}
+
+// R returns the series resistance
+func (e Estimate) R() float64 { return real(e.Z) }
+
+// X returns the series reactance
+func (e Estimate) X() float64 { return imag(e.Z) }
+
+// B returns the total shunt susceptance
+func (e Estimate) B() float64 { return imag(e.Y) }
+
+// sample holds the end quantities of a set
+type sample struct {
+	vs, is, vr, ir complex128
+}
+
+// line is a resolved Line with its window
+type line struct {
+	name           string
+	vs, is, vr, ir []synchrophasor.PhasorRef
+	samples        []sample
+	next           int
+	time           int64
+}
+
+// Estimator estimates line parameters from a stream. Write must be called
+// from a single goroutine, Estimates may be called concurrently.
+type Estimator struct {
+	opts  Options
+	mu    sync.Mutex
+	cfg   *synchrophasor.ConfigFrame
+	lines []*line
+}
+
+// New creates an estimator for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Estimator, error) {
+	if opts.Window <= 0 {
+		opts.Window = 50
+	}
+	e := &Estimator{opts: opts}
+	if err := e.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetConfig replaces the configuration, restarting the windows
+func (e *Estimator) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.setConfig(cfg)
+}
+
+// setConfig resolves the lines in cfg, e.mu must be held
+func (e *Estimator) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	resolve := func(l Line, names []string) ([]synchrophasor.PhasorRef, error) {
+		if len(names) != 1 && len(names) != 3 {
+			return nil, fmt.Errorf("%w: line %q needs one or three phasors per quantity",
+				synchrophasor.ErrInvalidParameter, l.Name)
+		}
+		refs := make([]synchrophasor.PhasorRef, len(names))
+		for i, name := range names {
+			ref, ok := cfg.FindPhasor(name)
+			if !ok {
+				return nil, fmt.Errorf("%w: line %q: unknown phasor %q", synchrophasor.ErrInvalidParameter, l.Name, name)
+			}
+			refs[i] = ref
+		}
+		return refs, nil
+	}
+
+	lines := make([]*line, len(e.opts.Lines))
+	for i, l := range e.opts.Lines {
+		ln := &line{name: l.Name, samples: make([]sample, 0, e.opts.Window)}
+		var err error
+		if ln.vs, err = resolve(l, l.SendingVoltage); err != nil {
+			return err
+		}
+		if ln.is, err = resolve(l, l.SendingCurrent); err != nil {
+			return err
+		}
+		if ln.vr, err = resolve(l, l.ReceivingVoltage); err != nil {
+			return err
+		}
+		if ln.ir, err = resolve(l, l.ReceivingCurrent); err != nil {
+			return err
+		}
+		lines[i] = ln
+	}
+	e.cfg, e.lines = cfg, lines
+	return nil
+}
+
+// Write adds the end quantities of a measurement set to the windows of the
+// lines. Lines with invalid phasors skip the set.
+func (e *Estimator) Write(m *synchrophasor.Measurements) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(m.Stations) != len(e.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(e.cfg.PMUStationList))
+	}
+	for i, pmu := range e.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := m.UnixNano()
+	for _, l := range e.lines {
+		var s sample
+		var ok [4]bool
+		s.vs, ok[0] = sequence(m, l.vs)
+		s.is, ok[1] = sequence(m, l.is)
+		s.vr, ok[2] = sequence(m, l.vr)
+		s.ir, ok[3] = sequence(m, l.ir)
+		if ok != [4]bool{true, true, true, true} {
+			continue
+		}
+		if len(l.samples) < cap(l.samples) {
+			l.samples = append(l.samples, s)
+		} else {
+			l.samples[l.next] = s
+			l.next = (l.next + 1) % len(l.samples)
+		}
+		l.time = t
+	}
+	return nil
+}
+
+// rotation is the 120 degree operator of the symmetrical components
+var rotation = cmplx.Rect(1, 2*math.Pi/3)
+
+// sequence returns the single phasor of refs or the positive sequence of
+// three phase phasors, false if any is invalid
+func sequence(m *synchrophasor.Measurements, refs []synchrophasor.PhasorRef) (complex128, bool) {
+	var p [3]complex128
+	for i, ref := range refs {
+		st := &m.Stations[ref.Station]
+		p[i] = st.Phasors[ref.Index]
+		if st.Stat&synchrophasor.StatDataError != 0 || cmplx.IsNaN(p[i]) || cmplx.IsInf(p[i]) {
+			return 0, false
+		}
+	}
+	if len(refs) == 1 {
+		return p[0], true
+	}
+	return (p[0] + rotation*p[1] + rotation*rotation*p[2]) / 3, true
+}
+
+// Estimates returns the parameters of the lines in configuration order
+func (e *Estimator) Estimates() []Estimate {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	estimates := make([]Estimate, len(e.lines))
+	for i, l := range e.lines {
+		estimates[i] = l.estimate(e.opts.Window)
+	}
+	return estimates
+}
+
+// estimate fits the pi model to the window by least squares: the shunt
+// admittance from Is + Ir = (Vs + Vr) Y/2, then the series impedance from
+// Is - Ir = (Vs - Vr) (Y/2 + 2/Z)
+func (l *line) estimate(window int) Estimate {
+	est := Estimate{Line: l.name}
+	if len(l.samples) < window {
+		return est
+	}
+	est.Time = time.Unix(0, l.time).UTC()
+
+	var num, den complex128
+	for _, s := range l.samples {
+		sum := s.vs + s.vr
+		num += cmplx.Conj(sum) * (s.is + s.ir)
+		den += cmplx.Conj(sum) * sum
+	}
+	if den == 0 {
+		return est
+	}
+	y := 2 * num / den
+
+	num, den = 0, 0
+	for _, s := range l.samples {
+		diff := s.vs - s.vr
+		num += cmplx.Conj(diff) * (s.is - s.ir - diff*y/2)
+		den += cmplx.Conj(diff) * diff
+	}
+	if den == 0 || num == 0 {
+		return est
+	}
+	est.Z, est.Y, est.Valid = 2*den/num, y, true
+	return est
+}
@@ -0,0 +1,92 @@
+package lineparam
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// Parameters of the simulated line
+var (
+	lineZ = complex(5, 50)
+	lineY = complex(0, 3e-4)
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		for _, phase := range []string{"A", "B", "C"} {
+			station.AddPhasor("V"+phase, 1, synchrophasor.PhunitVoltage)
+			station.AddPhasor("I"+phase, 1, synchrophasor.PhunitCurrent)
+		}
+	})
+}
+
+// set returns the measurements of frame i of balanced three-phase flows over
+// the line from Sub 1 to Sub 2, with the load changing from frame to frame
+func set(cfg *synchrophasor.ConfigFrame, i int) *synchrophasor.Measurements {
+	vs := cmplx.Rect(230e3, 0)
+	vr := cmplx.Rect(225e3-float64(i)*100, -(5+float64(i%7))*math.Pi/180)
+	is := vs*lineY/2 + (vs-vr)/lineZ
+	ir := vr*lineY/2 + (vr-vs)/lineZ
+	for k := 0; k < 3; k++ {
+		shift := cmplx.Rect(1, -float64(k)*2*math.Pi/3)
+		sub1, sub2 := cfg.PMUStationList[0], cfg.PMUStationList[1]
+		sub1.PhasorValues[2*k], sub1.PhasorValues[2*k+1] = vs*shift, is*shift
+		sub2.PhasorValues[2*k], sub2.PhasorValues[2*k+1] = vr*shift, ir*shift
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+func TestEstimator(t *testing.T) {
+	cfg := testConfig()
+	e, err := New(cfg, Options{Window: 10, Lines: []Line{
+		{
+			Name:             "Line A",
+			SendingVoltage:   []string{"Sub 1.VA"},
+			SendingCurrent:   []string{"Sub 1.IA"},
+			ReceivingVoltage: []string{"Sub 2.VA"},
+			ReceivingCurrent: []string{"Sub 2.IA"},
+		},
+		{
+			Name:             "Line",
+			SendingVoltage:   []string{"Sub 1.VA", "Sub 1.VB", "Sub 1.VC"},
+			SendingCurrent:   []string{"Sub 1.IA", "Sub 1.IB", "Sub 1.IC"},
+			ReceivingVoltage: []string{"Sub 2.VA", "Sub 2.VB", "Sub 2.VC"},
+			ReceivingCurrent: []string{"Sub 2.IA", "Sub 2.IB", "Sub 2.IC"},
+		},
+	}})
+	require.NoError(t, err)
+
+	for i := 0; i < 9; i++ {
+		require.NoError(t, e.Write(set(cfg, i)))
+	}
+	invalid := set(cfg, 9)
+	invalid.Stations[1].Stat = 0x8000
+	require.NoError(t, e.Write(invalid))
+	require.False(t, e.Estimates()[0].Valid)
+
+	for i := 10; i < 20; i++ {
+		require.NoError(t, e.Write(set(cfg, i)))
+	}
+	for _, est := range e.Estimates() {
+		require.True(t, est.Valid, est.Line)
+		require.InDelta(t, 5, est.R(), 1e-3)
+		require.InDelta(t, 50, est.X(), 1e-3)
+		require.InDelta(t, 3e-4, est.B(), 1e-9)
+		require.InDelta(t, 0, real(est.Y), 1e-9)
+		require.Equal(t, int64(1700000001900000000), est.Time.UnixNano())
+	}
+
+	require.ErrorIs(t, e.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+	for _, l := range []Line{
+		{Name: "Two", SendingVoltage: []string{"Sub 1.VA", "Sub 1.VB"}},
+		{Name: "Unknown", SendingVoltage: []string{"Sub 3.VA"}},
+	} {
+		_, err := New(cfg, Options{Lines: []Line{l}})
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+}
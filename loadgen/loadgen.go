@@ -0,0 +1,556 @@
+// Package loadgen opens many concurrent PDC connections to a PMU server,
+// requests its data stream on all of them and measures what every
+// connection receives: frame rate, latency from the frame timestamp to its
+// arrival, corrupted or reordered frames and lost connections. It is meant
+// for capacity testing a server and its per-client writers.
+package loadgen
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures a run
+type Options struct {
+	// Connections is the number of concurrent PDC connections, defaults to 100
+	Connections int
+	// Ramp spreads opening the connections evenly over this time instead of
+	// opening them all at once
+	Ramp time.Duration
+	// Duration is how long the streams are measured after the ramp, defaults
+	// to 30 s
+	Duration time.Duration
+	// IDCode is sent in the command frames, defaults to 1
+	IDCode uint16
+	// Timeout bounds connecting, the configuration response and the silence
+	// between two frames, defaults to 5 s
+	Timeout time.Duration
+	// Decode fully decodes every data frame rather than only checking its
+	// framing and CRC, adding the client's decoding cost to the test
+	Decode bool
+	// Interval is the period of Progress calls, defaults to 1 s
+	Interval time.Duration
+	// Progress is called every Interval while the run is going on
+	Progress func(Snapshot)
+	// Dial opens a connection, defaults to TCP to the address given to Run
+	Dial func(ctx context.Context) (net.Conn, error)
+}
+
+// Snapshot is the state of a run in progress
+type Snapshot struct {
+	Elapsed   time.Duration
+	Connected int
+	Frames    uint64
+	// FPS is the aggregate rate since the previous snapshot
+	FPS    float64
+	Errors int
+}
+
+// Rate summarizes the frame rates of the connections in frames per second
+type Rate struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+}
+
+// Latency summarizes the delay from the frame timestamps to their arrival in
+// milliseconds. It includes the clock offset between server and client.
+type Latency struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+	// Ahead counts frames stamped after they arrived, pointing to an offset
+	// between the clocks. They count as zero latency.
+	Ahead uint64 `json:"ahead"`
+}
+
+// Report is the result of a run
+type Report struct {
+	Address     string    `json:"address"`
+	Start       time.Time `json:"start"`
+	Elapsed     float64   `json:"elapsed_s"`
+	Connections int       `json:"connections"`
+	// Connected is the number of connections that received the configuration
+	Connected int `json:"connected"`
+	// Lost is the number of connections that failed after connecting
+	Lost int `json:"lost"`
+	// DataRate is the configured DATA_RATE in frames per second
+	DataRate     float64 `json:"data_rate"`
+	Frames       uint64  `json:"frames"`
+	Bytes        uint64  `json:"bytes"`
+	CRCErrors    uint64  `json:"crc_errors"`
+	DecodeErrors uint64  `json:"decode_errors"`
+	// OutOfOrder counts data frames not stamped after their predecessor
+	OutOfOrder uint64 `json:"out_of_order"`
+	// FPS is the sum of the connection data frame rates
+	FPS     float64 `json:"fps"`
+	PerConn Rate    `json:"per_connection_fps"`
+	Latency Latency `json:"latency"`
+	// Errors counts the failed connections by stage, e.g. "connect" or
+	// "stalled", with an example message in ErrorSamples
+	Errors       map[string]int    `json:"errors"`
+	ErrorSamples map[string]string `json:"error_samples"`
+}
+
+// Failed reports whether a connection failed or a frame was corrupted
+func (r *Report) Failed() bool {
+	return r.Connected < r.Connections || r.Lost > 0 || r.CRCErrors > 0 || r.DecodeErrors > 0
+}
+
+// WriteText writes the report in a human readable form
+func (r *Report) WriteText(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("Load test of %s, %s, %d connections, %.1f s\n\n",
+		r.Address, r.Start.UTC().Format(time.RFC3339), r.Connections, r.Elapsed)
+	ew.printf("Connections  %d connected, %d failed, %d lost\n", r.Connected, r.Connections-r.Connected, r.Lost)
+	ew.printf("Frames       %d, %.1f MB, %d CRC errors, %d decode errors, %d out of order\n",
+		r.Frames, float64(r.Bytes)/1e6, r.CRCErrors, r.DecodeErrors, r.OutOfOrder)
+	ew.printf("Rate         %.1f fps total, per connection min %.2f mean %.2f max %.2f (DATA_RATE %.2f)\n",
+		r.FPS, r.PerConn.Min, r.PerConn.Mean, r.PerConn.Max, r.DataRate)
+	ew.printf("Latency      p50 %.2f ms, p90 %.2f ms, p99 %.2f ms, max %.2f ms",
+		r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	if r.Latency.Ahead > 0 {
+		ew.printf(", %d frames stamped ahead of the local clock", r.Latency.Ahead)
+	}
+	ew.printf("\n")
+
+	stages := make([]string, 0, len(r.Errors))
+	for stage := range r.Errors {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		ew.printf("Error        %s: %d connections, e.g. %s\n", stage, r.Errors[stage], r.ErrorSamples[stage])
+	}
+	return ew.err
+}
+
+// errWriter keeps the first write error
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+// Stages at which a connection fails
+const (
+	stageConnect      = "connect"
+	stageConfig       = "config"
+	stageStart        = "start"
+	stageStalled      = "stalled"
+	stageDisconnected = "disconnected"
+	stageRead         = "read"
+)
+
+// connResult is what one connection measured
+type connResult struct {
+	connected bool
+	stage     string
+	err       error
+	dataRate  float64
+	frames    uint64
+	bytes     uint64
+	// data counts the intact data frames, first and last their arrival
+	data         uint64
+	crcErrors    uint64
+	decodeErrors uint64
+	outOfOrder   uint64
+	first, last  time.Time
+	latency      histogram
+}
+
+// runner holds the state shared by the connections of a run
+type runner struct {
+	opts      Options
+	connected atomic.Int64
+	frames    atomic.Uint64
+	errors    atomic.Int64
+}
+
+// Run opens the connections to addr, measures their streams until the ramp
+// and Duration are over or ctx is done, and returns the report
+func Run(ctx context.Context, addr string, opts Options) *Report {
+	if opts.Connections <= 0 {
+		opts.Connections = 100
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = 30 * time.Second
+	}
+	if opts.IDCode == 0 {
+		opts.IDCode = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Dial == nil {
+		dialer := &net.Dialer{Timeout: opts.Timeout}
+		opts.Dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithDeadline(ctx, start.Add(opts.Ramp+opts.Duration))
+	defer cancel()
+
+	r := &runner{opts: opts}
+	results := make([]*connResult, opts.Connections)
+	var wg sync.WaitGroup
+	for i := range results {
+		delay := time.Duration(0)
+		if opts.Connections > 1 {
+			delay = opts.Ramp * time.Duration(i) / time.Duration(opts.Connections-1)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = r.connection(ctx, start.Add(delay))
+		}(i)
+	}
+
+	done := make(chan struct{})
+	if opts.Progress != nil {
+		go r.progress(start, done)
+	}
+	wg.Wait()
+	close(done)
+
+	return summarize(addr, start, time.Since(start), results)
+}
+
+// progress reports snapshots until done is closed
+func (r *runner) progress(start time.Time, done <-chan struct{}) {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	var lastFrames uint64
+	last := start
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			frames := r.frames.Load()
+			r.opts.Progress(Snapshot{
+				Elapsed:   now.Sub(start),
+				Connected: int(r.connected.Load()),
+				Frames:    frames,
+				FPS:       float64(frames-lastFrames) / now.Sub(last).Seconds(),
+				Errors:    int(r.errors.Load()),
+			})
+			lastFrames, last = frames, now
+		}
+	}
+}
+
+// fail records the stage a connection failed at
+func (r *runner) fail(res *connResult, stage string, err error) *connResult {
+	res.stage, res.err = stage, err
+	r.errors.Add(1)
+	return res
+}
+
+// connection opens one connection at the given time and reads its stream
+// until ctx is done
+func (r *runner) connection(ctx context.Context, at time.Time) *connResult {
+	res := &connResult{}
+	select {
+	case <-time.After(time.Until(at)):
+	case <-ctx.Done():
+		return r.fail(res, stageConnect, ctx.Err())
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, r.opts.Timeout)
+	conn, err := r.opts.Dial(dialCtx)
+	cancel()
+	if err != nil {
+		return r.fail(res, stageConnect, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Unblock the reads at the end of the run
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	pdc := synchrophasor.NewPDC(r.opts.IDCode)
+	pdc.Attach(conn)
+	defer pdc.Disconnect()
+
+	if err := conn.SetDeadline(time.Now().Add(r.opts.Timeout)); err != nil {
+		return r.fail(res, stageConfig, err)
+	}
+	cfg, err := pdc.GetConfig(2)
+	if err != nil {
+		return r.fail(res, stageConfig, err)
+	}
+	res.connected = true
+	res.dataRate = dataRate(cfg.DataRate)
+	r.connected.Add(1)
+	if err := pdc.Start(); err != nil {
+		return r.fail(res, stageStart, err)
+	}
+
+	r.stream(ctx, conn, cfg, res)
+	if ctx.Err() == nil || res.err != nil {
+		return res
+	}
+
+	// Turn the stream off again, leaving the server with a clean disconnect
+	if err := conn.SetDeadline(time.Now().Add(r.opts.Timeout)); err == nil {
+		_ = pdc.Stop()
+	}
+	return res
+}
+
+// stream reads and checks frames until ctx is done or the connection fails
+func (r *runner) stream(ctx context.Context, conn net.Conn, cfg *synchrophasor.ConfigFrame, res *connResult) {
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	frame := make([]byte, 0, 64*1024)
+	var previous float64
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(r.opts.Timeout)); err != nil {
+			r.fail(res, stageRead, err)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		var err error
+		frame, err = readFrame(reader, frame[:0])
+		if err != nil {
+			switch {
+			case ctx.Err() != nil:
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				r.fail(res, stageStalled, fmt.Errorf("no frame for %v", r.opts.Timeout))
+			case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+				r.fail(res, stageDisconnected, err)
+			default:
+				r.fail(res, stageRead, err)
+			}
+			return
+		}
+		now := time.Now()
+		res.frames++
+		res.bytes += uint64(len(frame))
+		r.frames.Add(1)
+
+		n := len(frame)
+		if synchrophasor.CalcCRC(frame[:n-2]) != binary.BigEndian.Uint16(frame[n-2:]) {
+			res.crcErrors++
+			continue
+		}
+		kind, _ := synchrophasor.GetFrameType(frame)
+		if kind != synchrophasor.FrameTypeData {
+			// A configuration sent while streaming replaces the current one
+			if kind == synchrophasor.FrameTypeCfg2 {
+				next := synchrophasor.NewConfigFrame()
+				if next.Unpack(frame) == nil {
+					cfg = next
+				}
+			}
+			continue
+		}
+		res.data++
+		if res.first.IsZero() {
+			res.first = now
+		}
+		res.last = now
+		if r.opts.Decode {
+			if err := synchrophasor.NewDataFrame(cfg).Unpack(frame); err != nil {
+				res.decodeErrors++
+			}
+		}
+
+		stamp := timestamp(frame, cfg.TimeBase&0xFFFFFF)
+		if previous != 0 && stamp <= previous {
+			res.outOfOrder++
+		}
+		previous = stamp
+		res.latency.add(now, stamp)
+	}
+}
+
+// readFrame appends the next frame of r to buf
+func readFrame(r *bufio.Reader, buf []byte) ([]byte, error) {
+	head, err := r.Peek(4)
+	if err != nil {
+		return buf, err
+	}
+	size := int(binary.BigEndian.Uint16(head[2:]))
+	if head[0] != synchrophasor.SyncAA || size < 16 {
+		return buf, fmt.Errorf("%w: frame starting % x", synchrophasor.ErrInvalidFrame, head)
+	}
+	buf = append(buf, make([]byte, size)...)
+	_, err = io.ReadFull(r, buf[len(buf)-size:])
+	return buf, err
+}
+
+// timestamp returns the time of a frame in seconds since the epoch
+func timestamp(frame []byte, timeBase uint32) float64 {
+	soc := float64(binary.BigEndian.Uint32(frame[6:]))
+	if timeBase == 0 {
+		return soc
+	}
+	frac := binary.BigEndian.Uint32(frame[10:]) & 0xFFFFFF
+	return soc + float64(frac)/float64(timeBase)
+}
+
+// dataRate returns the frames per second of a DATA_RATE
+func dataRate(rate int16) float64 {
+	if rate < 0 {
+		return 1 / float64(-rate)
+	}
+	return float64(rate)
+}
+
+// summarize combines the connection results
+func summarize(addr string, start time.Time, elapsed time.Duration, results []*connResult) *Report {
+	report := &Report{
+		Address:      addr,
+		Start:        start,
+		Elapsed:      elapsed.Seconds(),
+		Connections:  len(results),
+		Errors:       make(map[string]int),
+		ErrorSamples: make(map[string]string),
+	}
+
+	var latency histogram
+	var rates []float64
+	for _, res := range results {
+		if res.connected {
+			report.Connected++
+			report.DataRate = res.dataRate
+		}
+		if res.err != nil {
+			if res.connected {
+				report.Lost++
+			}
+			report.Errors[res.stage]++
+			if _, ok := report.ErrorSamples[res.stage]; !ok {
+				report.ErrorSamples[res.stage] = res.err.Error()
+			}
+		}
+		report.Frames += res.frames
+		report.Bytes += res.bytes
+		report.CRCErrors += res.crcErrors
+		report.DecodeErrors += res.decodeErrors
+		report.OutOfOrder += res.outOfOrder
+		latency.merge(&res.latency)
+
+		if res.data > 1 {
+			rates = append(rates, float64(res.data-1)/res.last.Sub(res.first).Seconds())
+		} else if res.connected {
+			rates = append(rates, 0)
+		}
+	}
+
+	if len(rates) > 0 {
+		report.PerConn.Min = math.Inf(1)
+		for _, rate := range rates {
+			report.FPS += rate
+			report.PerConn.Min = math.Min(report.PerConn.Min, rate)
+			report.PerConn.Max = math.Max(report.PerConn.Max, rate)
+		}
+		report.PerConn.Mean = report.FPS / float64(len(rates))
+	}
+	report.Latency = Latency{
+		P50:   latency.quantile(0.5),
+		P90:   latency.quantile(0.9),
+		P99:   latency.quantile(0.99),
+		Max:   float64(latency.max) / 1e3,
+		Ahead: latency.ahead,
+	}
+	return report
+}
+
+// histogramBuckets cover latencies up to 2^28 µs, about 4.5 minutes, in
+// buckets 9% wide, with one more bucket for the latencies beyond
+const (
+	histogramSteps   = 8
+	histogramBuckets = 28 * histogramSteps
+)
+
+// histogram counts latencies in logarithmic buckets of microseconds
+type histogram struct {
+	counts [histogramBuckets + 1]uint64
+	n      uint64
+	ahead  uint64
+	// max is the largest latency in µs
+	max int64
+}
+
+// add counts the latency of a frame stamped stamp that arrived at now
+func (h *histogram) add(now time.Time, stamp float64) {
+	us := now.UnixMicro() - int64(math.Round(stamp*1e6))
+	if us < 0 {
+		h.ahead++
+		us = 0
+	}
+	bucket := 0
+	if us > 0 {
+		bucket = min(int(math.Log2(float64(us))*histogramSteps)+1, histogramBuckets)
+	}
+	h.counts[bucket]++
+	h.n++
+	h.max = max(h.max, us)
+}
+
+// merge adds the counts of other
+func (h *histogram) merge(other *histogram) {
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	h.n += other.n
+	h.ahead += other.ahead
+	h.max = max(h.max, other.max)
+}
+
+// quantile returns the upper bound of the bucket holding quantile q in ms
+func (h *histogram) quantile(q float64) float64 {
+	if h.n == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.n)))
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank && c > 0 {
+			if i == 0 {
+				return 0
+			}
+			if i == histogramBuckets {
+				// Beyond the range, bounded by the maximum only
+				return float64(h.max) / 1e3
+			}
+			upper := math.Exp2(float64(i) / histogramSteps)
+			return math.Min(upper, float64(h.max)) / 1e3
+		}
+	}
+	return float64(h.max) / 1e3
+}
@@ -0,0 +1,134 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7734
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+	station := synchrophasor.NewPMUStation("Station A", 7734, true, true, true, false)
+	station.AddPhasor("VA", 915527, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+func TestRun(t *testing.T) {
+	pmu := synchrophasor.NewPMU()
+	pmu.SetConfig(testConfig())
+	listener := testutil.ServePMU(t, pmu)
+
+	var snapshots atomic.Int32
+	report := Run(context.Background(), "pmu", Options{
+		Connections: 50,
+		Ramp:        100 * time.Millisecond,
+		Duration:    time.Second,
+		Decode:      true,
+		Interval:    200 * time.Millisecond,
+		Progress:    func(Snapshot) { snapshots.Add(1) },
+		Dial: func(context.Context) (net.Conn, error) {
+			return listener.Dial()
+		},
+	})
+
+	require.False(t, report.Failed(), "%+v", report)
+	require.Equal(t, 50, report.Connected)
+	require.Equal(t, float64(50), report.DataRate)
+	require.Zero(t, report.OutOfOrder)
+	require.Positive(t, report.Frames)
+	require.InDelta(t, 50, report.PerConn.Mean, 10)
+	require.InDelta(t, 50*50, report.FPS, 500)
+	require.Less(t, report.Latency.P50, 100.0)
+	require.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+	require.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+	require.Positive(t, snapshots.Load())
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	require.Contains(t, text.String(), "50 connected, 0 failed, 0 lost")
+}
+
+func TestRunCorruptedStream(t *testing.T) {
+	mock := testutil.NewMockPMU(testConfig())
+	defer mock.Close()
+	require.NoError(t, mock.ScriptData(10, nil))
+	bad, err := synchrophasor.NewDataFrame(mock.Config).Pack()
+	require.NoError(t, err)
+	bad[len(bad)-1] ^= 0xFF
+	mock.Script(bad)
+	// A frame stamped before its predecessor
+	mock.Time = mock.Time.Add(-time.Hour)
+	require.NoError(t, mock.ScriptData(1, nil))
+
+	report := Run(context.Background(), "mock", Options{
+		Connections: 3,
+		Duration:    300 * time.Millisecond,
+		Dial: func(context.Context) (net.Conn, error) {
+			return mock.Dial(), nil
+		},
+	})
+
+	require.True(t, report.Failed())
+	require.Equal(t, 3, report.Connected)
+	require.Equal(t, uint64(3*12), report.Frames)
+	require.Equal(t, uint64(3), report.CRCErrors)
+	require.Equal(t, uint64(3), report.OutOfOrder)
+	// 10 scripted frames 20 ms apart arrive at once
+	require.Greater(t, report.PerConn.Min, 50.0)
+	// The stream stalling is not an error before the timeout
+	require.Empty(t, report.Errors)
+	// The scripted frames are stamped in 2023
+	require.Greater(t, report.Latency.P50, 1e9)
+}
+
+func TestRunStalledAndUnreachable(t *testing.T) {
+	mock := testutil.NewMockPMU(testConfig())
+	defer mock.Close()
+	report := Run(context.Background(), "mock", Options{
+		Connections: 2,
+		Duration:    time.Second,
+		Timeout:     100 * time.Millisecond,
+		Dial: func(context.Context) (net.Conn, error) {
+			return mock.Dial(), nil
+		},
+	})
+	require.True(t, report.Failed())
+	require.Equal(t, 2, report.Lost)
+	require.Equal(t, map[string]int{"stalled": 2}, report.Errors)
+
+	mock.Respond(synchrophasor.CmdCfg2)
+	report = Run(context.Background(), "mock", Options{
+		Connections: 2,
+		Duration:    time.Second,
+		Timeout:     100 * time.Millisecond,
+		Dial: func(context.Context) (net.Conn, error) {
+			return mock.Dial(), nil
+		},
+	})
+	require.Zero(t, report.Connected)
+	require.Equal(t, map[string]int{"config": 2}, report.Errors)
+
+	report = Run(context.Background(), "nowhere", Options{
+		Connections: 4,
+		Duration:    time.Second,
+		Dial: func(context.Context) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	})
+	require.Zero(t, report.Connected)
+	require.Equal(t, map[string]int{"connect": 4}, report.Errors)
+	require.Equal(t, "connection refused", report.ErrorSamples["connect"])
+}
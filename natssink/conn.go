@@ -0,0 +1,382 @@
+package natssink
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by the NATS client
+var (
+	// ErrNoResponders is returned for requests nobody listens to, e.g.
+	// JetStream API calls on a server without JetStream
+	ErrNoResponders = errors.New("nats: no responders")
+	// ErrProtocol is returned for malformed server messages
+	ErrProtocol = errors.New("nats: protocol error")
+	// ErrServer wraps -ERR messages sent by the server
+	ErrServer = errors.New("nats: server error")
+	// ErrTimeout is returned when a request or acknowledgement is not answered in time
+	ErrTimeout = errors.New("nats: timeout")
+)
+
+// serverInfo is the part of the server INFO used by the client
+type serverInfo struct {
+	Headers     bool `json:"headers"`
+	TLSRequired bool `json:"tls_required"`
+	MaxPayload  int  `json:"max_payload"`
+}
+
+// reply is a message received on the connection's inbox
+type reply struct {
+	status  string // header status line, e.g. "503", empty for plain messages
+	payload []byte
+}
+
+// natsConn is a minimal NATS client supporting publishing with headers and
+// request/reply through a single inbox subscription
+type natsConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	mu      sync.Mutex // serializes writes
+	info    serverInfo
+	inbox   string
+	pending sync.Map // inbox token -> chan reply
+	nextID  uint64
+	done    chan struct{}
+	err     error
+}
+
+// dialNATS connects to address, a host:port or nats:// or tls:// URL
+func dialNATS(address string, opts Options) (*natsConn, error) {
+	useTLS := opts.TLS != nil
+	var user *url.Userinfo
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "tls" {
+			useTLS = true
+		}
+		address, user = u.Host, u.User
+	}
+
+	conn, err := net.DialTimeout("tcp", address, opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(opts.Timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	c := &natsConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		done: make(chan struct{}),
+	}
+	if err := c.handshake(address, opts, useTLS, user); err != nil {
+		_ = c.conn.Close()
+		return nil, err
+	}
+	if err := c.conn.SetDeadline(time.Time{}); err != nil {
+		_ = c.conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+	return c, nil
+}
+
+// handshake reads INFO, upgrades to TLS if needed and sends CONNECT
+func (c *natsConn) handshake(address string, opts Options, useTLS bool, user *url.Userinfo) error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("%w: unexpected greeting %q", ErrProtocol, line)
+	}
+	if err := json.Unmarshal([]byte(line[5:]), &c.info); err != nil {
+		return fmt.Errorf("%w: invalid INFO: %v", ErrProtocol, err)
+	}
+
+	if useTLS || c.info.TLSRequired {
+		config := opts.TLS
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(c.conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+	}
+	c.w = bufio.NewWriter(c.conn)
+
+	connect := map[string]interface{}{
+		"verbose":       false,
+		"pedantic":      false,
+		"lang":          "go",
+		"version":       "synchrophasor",
+		"protocol":      1,
+		"headers":       true,
+		"no_responders": true,
+	}
+	if opts.Name != "" {
+		connect["name"] = opts.Name
+	}
+	if opts.Token != "" {
+		connect["auth_token"] = opts.Token
+	}
+	username, password := opts.User, opts.Password
+	if user != nil && username == "" {
+		username = user.Username()
+		password, _ = user.Password()
+	}
+	if username != "" {
+		connect["user"] = username
+		connect["pass"] = password
+	}
+	data, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+
+	// The PONG confirms the CONNECT, errors such as failed authentication
+	// arrive as -ERR before it
+	if _, err := fmt.Fprintf(c.w, "CONNECT %s\r\nPING\r\n", data); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return c.subscribeInbox()
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("%w: %s", ErrServer, strings.TrimSpace(line[4:]))
+		}
+	}
+}
+
+// subscribeInbox subscribes to the wildcard inbox used for replies
+func (c *natsConn) subscribeInbox() error {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	c.inbox = "_INBOX." + hex.EncodeToString(token)
+	if _, err := fmt.Fprintf(c.w, "SUB %s.* 1\r\n", c.inbox); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// publish sends a message with optional headers and reply subject
+func (c *natsConn) publish(subject, replyTo string, headers map[string]string, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(headers) == 0 || !c.info.Headers {
+		if replyTo != "" {
+			_, _ = fmt.Fprintf(c.w, "PUB %s %s %d\r\n", subject, replyTo, len(payload))
+		} else {
+			_, _ = fmt.Fprintf(c.w, "PUB %s %d\r\n", subject, len(payload))
+		}
+	} else {
+		var hdr strings.Builder
+		hdr.WriteString("NATS/1.0\r\n")
+		for k, v := range headers {
+			hdr.WriteString(k + ": " + v + "\r\n")
+		}
+		hdr.WriteString("\r\n")
+		if replyTo != "" {
+			_, _ = fmt.Fprintf(c.w, "HPUB %s %s %d %d\r\n", subject, replyTo, hdr.Len(), hdr.Len()+len(payload))
+		} else {
+			_, _ = fmt.Fprintf(c.w, "HPUB %s %d %d\r\n", subject, hdr.Len(), hdr.Len()+len(payload))
+		}
+		_, _ = c.w.WriteString(hdr.String())
+	}
+	_, _ = c.w.Write(payload)
+	_, err := c.w.WriteString("\r\n")
+	return err
+}
+
+// flush writes buffered messages to the server
+func (c *natsConn) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.w.Flush()
+}
+
+// newInbox returns a unique reply subject and the channel its reply arrives on
+func (c *natsConn) newInbox() (string, chan reply) {
+	c.mu.Lock()
+	c.nextID++
+	token := strconv.FormatUint(c.nextID, 36)
+	c.mu.Unlock()
+
+	ch := make(chan reply, 1)
+	c.pending.Store(token, ch)
+	return c.inbox + "." + token, ch
+}
+
+// cancelInbox stops waiting for a reply
+func (c *natsConn) cancelInbox(subject string) {
+	c.pending.Delete(subject[len(c.inbox)+1:])
+}
+
+// request publishes payload and waits for the reply
+func (c *natsConn) request(subject string, payload []byte, timeout time.Duration) ([]byte, error) {
+	inbox, ch := c.newInbox()
+	defer c.cancelInbox(inbox)
+
+	if err := c.publish(subject, inbox, nil, payload); err != nil {
+		return nil, err
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	return c.wait(ch, timeout)
+}
+
+// wait waits for a reply on ch
+func (c *natsConn) wait(ch chan reply, timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-ch:
+		if r.status == "503" {
+			return nil, ErrNoResponders
+		}
+		return r.payload, nil
+	case <-c.done:
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, net.ErrClosed
+	case <-timer.C:
+		return nil, ErrTimeout
+	}
+}
+
+// close flushes and closes the connection
+func (c *natsConn) close() error {
+	err := c.flush()
+	if closeErr := c.conn.Close(); closeErr != nil && !errors.Is(closeErr, net.ErrClosed) {
+		err = errors.Join(err, closeErr)
+	}
+	<-c.done
+	return err
+}
+
+// readLoop handles server messages until the connection fails
+func (c *natsConn) readLoop() {
+	defer close(c.done)
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		switch {
+		case line == "PING":
+			c.mu.Lock()
+			_, _ = c.w.WriteString("PONG\r\n")
+			err = c.w.Flush()
+			c.mu.Unlock()
+		case strings.HasPrefix(line, "MSG "), strings.HasPrefix(line, "HMSG "):
+			err = c.readMessage(line)
+		case strings.HasPrefix(line, "-ERR"):
+			err = fmt.Errorf("%w: %s", ErrServer, strings.TrimSpace(line[4:]))
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// readMessage reads the payload of a MSG or HMSG and delivers inbox replies
+func (c *natsConn) readMessage(line string) error {
+	// MSG <subject> <sid> [reply-to] <#bytes>
+	// HMSG <subject> <sid> [reply-to] <#header bytes> <#total bytes>
+	fields := strings.Fields(line)
+	headers := fields[0] == "HMSG"
+	minFields := 4
+	if headers {
+		minFields = 5
+	}
+	if len(fields) < minFields || len(fields) > minFields+1 {
+		return fmt.Errorf("%w: malformed %q", ErrProtocol, line)
+	}
+
+	total, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return fmt.Errorf("%w: malformed %q", ErrProtocol, line)
+	}
+	hdrLen := 0
+	if headers {
+		if hdrLen, err = strconv.Atoi(fields[len(fields)-2]); err != nil || hdrLen > total {
+			return fmt.Errorf("%w: malformed %q", ErrProtocol, line)
+		}
+	}
+
+	data := make([]byte, total+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return err
+	}
+
+	var r reply
+	if headers {
+		// NATS/1.0 <status> [description]
+		status := strings.Fields(strings.SplitN(string(data[:hdrLen]), "\r\n", 2)[0])
+		if len(status) > 1 {
+			r.status = status[1]
+		}
+	}
+	r.payload = data[hdrLen:total]
+
+	subject := fields[1]
+	if strings.HasPrefix(subject, c.inbox+".") {
+		if ch, ok := c.pending.LoadAndDelete(subject[len(c.inbox)+1:]); ok {
+			ch.(chan reply) <- r
+		}
+	}
+	return nil
+}
+
+// readLine reads a protocol line without the trailing CRLF
+func (c *natsConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,339 @@
+// Package natssink publishes synchrophasor measurements to NATS, one subject
+// per station, optionally persisted in a JetStream stream
+package natssink
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ErrJetStream wraps errors returned by the JetStream API
+var ErrJetStream = errors.New("jetstream error")
+
+// Options configures a NATS sink
+type Options struct {
+	// URL is the server address, host:port or a nats:// or tls:// URL that
+	// may carry user credentials
+	URL string
+	// Subject is the subject prefix, defaults to "synchrophasor". Data is
+	// published on <Subject>.<station>.data, the configuration once on connect
+	// on <Subject>.<station>.config.
+	Subject string
+	// Name is the client connection name shown by the server
+	Name     string
+	User     string
+	Password string
+	Token    string
+	// TLS enables TLS when set, or when required by the server
+	TLS *tls.Config
+	// Timeout bounds connecting and JetStream API requests, defaults to 10 seconds
+	Timeout time.Duration
+	// JetStream enables acknowledged publishing into a stream when set
+	JetStream *JetStreamOptions
+}
+
+// JetStreamOptions configures persistence
+type JetStreamOptions struct {
+	// Stream is the name of the stream capturing <Subject>.>
+	Stream string
+	// Create creates the stream with the settings below if it does not exist
+	Create bool
+	// Storage is "file" (default) or "memory"
+	Storage string
+	// MaxAge and MaxBytes limit the retained data, zero means unlimited
+	MaxAge   time.Duration
+	MaxBytes int64
+	// Replicas defaults to 1
+	Replicas int
+	// Duplicates is the deduplication window for the Nats-Msg-Id header
+	Duplicates time.Duration
+	// MaxPending bounds the unacknowledged messages, defaults to 256
+	MaxPending int
+	// AckTimeout defaults to 5 seconds
+	AckTimeout time.Duration
+}
+
+// pubAck is a JetStream publish acknowledgement or API error response
+type pubAck struct {
+	Stream string    `json:"stream"`
+	Seq    uint64    `json:"seq"`
+	Error  *apiError `json:"error"`
+}
+
+// apiError is the error of a JetStream API response
+type apiError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+// ack is an outstanding JetStream acknowledgement
+type ack struct {
+	inbox string
+	ch    chan reply
+}
+
+// Sink publishes measurements as JSON, one message per station. It is not
+// safe for concurrent use.
+type Sink struct {
+	cfg      *synchrophasor.ConfigFrame
+	opts     Options
+	conn     *natsConn
+	tokens   []string
+	subjects []string
+	station  synchrophasor.Measurements
+	pending  []ack
+}
+
+// New connects to the server, ensures the JetStream stream if configured and
+// publishes the configuration of every station
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Sink, error) {
+	if opts.Subject == "" {
+		opts.Subject = "synchrophasor"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.JetStream != nil {
+		js := *opts.JetStream
+		opts.JetStream = &js
+		if js.Stream == "" || strings.ContainsAny(js.Stream, ".*> ") {
+			return nil, fmt.Errorf("%w: invalid stream name %q", synchrophasor.ErrInvalidParameter, js.Stream)
+		}
+		if js.MaxPending <= 0 {
+			js.MaxPending = 256
+		}
+		if js.AckTimeout <= 0 {
+			js.AckTimeout = 5 * time.Second
+		}
+	}
+
+	conn, err := dialNATS(opts.URL, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sink{cfg: cfg, opts: opts, conn: conn}
+	s.station.Stations = make([]synchrophasor.StationMeasurement, 1)
+	if opts.JetStream != nil {
+		if err := s.ensureStream(); err != nil {
+			_ = conn.close()
+			return nil, err
+		}
+	}
+
+	for _, pmu := range cfg.PMUStationList {
+		token := subjectToken(pmu)
+		prefix := opts.Subject + "." + token
+		s.tokens = append(s.tokens, token)
+		s.subjects = append(s.subjects, prefix+".data")
+
+		station := *cfg
+		station.NumPMU = 1
+		station.PMUStationList = []*synchrophasor.PMUStation{pmu}
+		data, err := json.Marshal(&station)
+		if err != nil {
+			_ = conn.close()
+			return nil, err
+		}
+		if err := s.publish(prefix+".config", "", data); err != nil {
+			_ = conn.close()
+			return nil, err
+		}
+	}
+	if err := s.Flush(); err != nil {
+		_ = conn.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ensureStream looks up the stream and creates it if requested
+func (s *Sink) ensureStream() error {
+	js := s.opts.JetStream
+	var info pubAck
+	if err := s.jsRequest("$JS.API.STREAM.INFO."+js.Stream, nil, &info); err == nil {
+		return nil
+	} else if info.Error == nil || info.Error.Code != 404 || !js.Create {
+		return err
+	}
+
+	storage := js.Storage
+	if storage == "" {
+		storage = "file"
+	}
+	replicas := js.Replicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+	maxBytes := js.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = -1
+	}
+	config := map[string]interface{}{
+		"name":         js.Stream,
+		"subjects":     []string{s.opts.Subject + ".>"},
+		"retention":    "limits",
+		"storage":      storage,
+		"max_age":      js.MaxAge.Nanoseconds(),
+		"max_bytes":    maxBytes,
+		"num_replicas": replicas,
+		"discard":      "old",
+	}
+	if js.Duplicates > 0 {
+		config["duplicate_window"] = js.Duplicates.Nanoseconds()
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	var created pubAck
+	return s.jsRequest("$JS.API.STREAM.CREATE."+js.Stream, data, &created)
+}
+
+// jsRequest sends a JetStream API request and decodes the response into resp
+func (s *Sink) jsRequest(subject string, payload []byte, resp *pubAck) error {
+	data, err := s.conn.request(subject, payload, s.opts.Timeout)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("%w: %v", ErrJetStream, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%w: %s (%d)", ErrJetStream, resp.Error.Description, resp.Error.ErrCode)
+	}
+	return nil
+}
+
+// Write publishes the values of every station on its data subject. With
+// JetStream, a failed acknowledgement of an earlier message is returned.
+func (s *Sink) Write(m *synchrophasor.Measurements) error {
+	if len(m.Stations) != len(s.subjects) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.subjects))
+	}
+
+	s.station.PMUID = m.PMUID
+	s.station.Time = m.Time
+	for i := range m.Stations {
+		s.station.Stations[0] = m.Stations[i]
+		data, err := json.Marshal(&s.station)
+		if err != nil {
+			return err
+		}
+
+		// Time and station identify the message for JetStream deduplication
+		nanos := m.UnixNano()
+		msgID := fmt.Sprintf("%s-%d.%06d", s.tokens[i], nanos/1e9, nanos%1e9/1e3)
+		if err := s.publish(s.subjects[i], msgID, data); err != nil {
+			return err
+		}
+	}
+	if err := s.conn.flush(); err != nil {
+		return err
+	}
+	return s.collectAcks(false)
+}
+
+// publish sends a message, requesting an acknowledgement with JetStream
+func (s *Sink) publish(subject, msgID string, data []byte) error {
+	if s.opts.JetStream == nil {
+		return s.conn.publish(subject, "", nil, data)
+	}
+
+	if len(s.pending) >= s.opts.JetStream.MaxPending {
+		if err := s.waitAck(); err != nil {
+			return err
+		}
+	}
+
+	var headers map[string]string
+	if msgID != "" {
+		headers = map[string]string{"Nats-Msg-Id": msgID}
+	}
+	inbox, ch := s.conn.newInbox()
+	s.pending = append(s.pending, ack{inbox: inbox, ch: ch})
+	return s.conn.publish(subject, inbox, headers, data)
+}
+
+// collectAcks checks the outstanding acknowledgements in order. Unless all is
+// set it stops at the first one that has not arrived yet.
+func (s *Sink) collectAcks(all bool) error {
+	for len(s.pending) > 0 {
+		if !all {
+			select {
+			case r := <-s.pending[0].ch:
+				// Put it back for waitAck to decode
+				s.pending[0].ch <- r
+			default:
+				return nil
+			}
+		}
+		if err := s.waitAck(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitAck waits for the oldest outstanding acknowledgement
+func (s *Sink) waitAck() error {
+	a := s.pending[0]
+	s.pending = s.pending[1:]
+	defer s.conn.cancelInbox(a.inbox)
+
+	if err := s.conn.flush(); err != nil {
+		return err
+	}
+	data, err := s.conn.wait(a.ch, s.opts.JetStream.AckTimeout)
+	if err != nil {
+		return err
+	}
+	var resp pubAck
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("%w: %v", ErrJetStream, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%w: %s (%d)", ErrJetStream, resp.Error.Description, resp.Error.ErrCode)
+	}
+	return nil
+}
+
+// Flush sends buffered messages and, with JetStream, waits for all
+// outstanding acknowledgements
+func (s *Sink) Flush() error {
+	if err := s.conn.flush(); err != nil {
+		return err
+	}
+	return s.collectAcks(true)
+}
+
+// Close flushes and closes the connection
+func (s *Sink) Close() error {
+	err := s.Flush()
+	return errors.Join(err, s.conn.close())
+}
+
+// subjectToken makes a station name usable as a single subject token
+func subjectToken(pmu *synchrophasor.PMUStation) string {
+	name := strings.TrimSpace(pmu.STN)
+	if name == "" {
+		return fmt.Sprintf("pmu%d", pmu.IDCode)
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t':
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+}
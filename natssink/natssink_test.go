@@ -0,0 +1,203 @@
+package natssink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// published is a message received by the fake server
+type published struct {
+	subject string
+	headers string
+	data    []byte
+}
+
+// server is a fake NATS server with a minimal JetStream API
+type server struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []published
+	streams  map[string][]byte
+}
+
+func newServer(t *testing.T) *server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &server{listener: l, streams: make(map[string][]byte)}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	_, _ = w.WriteString(`INFO {"headers":true,"max_payload":1048576}` + "\r\n")
+	_ = w.Flush()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			_, _ = w.WriteString("PONG\r\n")
+		case "PUB", "HPUB":
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			hdrLen := 0
+			if fields[0] == "HPUB" {
+				hdrLen, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			body := make([]byte, total+2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			replyTo := ""
+			if len(fields) == 4 && fields[0] == "PUB" || len(fields) == 5 && fields[0] == "HPUB" {
+				replyTo = fields[2]
+			}
+			msg := published{subject: fields[1], headers: string(body[:hdrLen]), data: body[hdrLen:total]}
+			if resp := s.handle(msg); replyTo != "" && resp != "" {
+				_, _ = fmt.Fprintf(w, "MSG %s 1 %d\r\n%s\r\n", replyTo, len(resp), resp)
+			}
+		}
+		_ = w.Flush()
+	}
+}
+
+func (s *server) handle(msg published) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(msg.subject, "$JS.API.STREAM.INFO."):
+		name := strings.TrimPrefix(msg.subject, "$JS.API.STREAM.INFO.")
+		if _, ok := s.streams[name]; !ok {
+			return `{"error":{"code":404,"err_code":10059,"description":"stream not found"}}`
+		}
+		return `{"config":{}}`
+	case strings.HasPrefix(msg.subject, "$JS.API.STREAM.CREATE."):
+		s.streams[strings.TrimPrefix(msg.subject, "$JS.API.STREAM.CREATE.")] = msg.data
+		return `{"config":{}}`
+	default:
+		s.messages = append(s.messages, msg)
+		return fmt.Sprintf(`{"stream":"PMU","seq":%d}`, len(s.messages))
+	}
+}
+
+func (s *server) received() []published {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]published(nil), s.messages...)
+}
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 1
+	cfg.TimeBase = 1000000
+	for _, name := range []string{"Station A", "Station.B"} {
+		station := synchrophasor.NewPMUStation(name, 7734, true, true, true, true)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		cfg.AddPMUStation(station)
+	}
+	return cfg
+}
+
+func TestSink(t *testing.T) {
+	srv := newServer(t)
+	cfg := testConfig()
+
+	sink, err := New(cfg, Options{URL: "nats://" + srv.listener.Addr().String(), Subject: "pmu"})
+	require.NoError(t, err)
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SetTime(nil, nil)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	require.NoError(t, sink.Write(&m))
+	require.NoError(t, sink.Close())
+
+	require.Eventually(t, func() bool { return len(srv.received()) == 4 }, 5*time.Second, 10*time.Millisecond)
+	msgs := srv.received()
+	require.Equal(t, "pmu.Station_A.config", msgs[0].subject)
+	require.Equal(t, "pmu.Station_B.config", msgs[1].subject)
+	require.Equal(t, "pmu.Station_A.data", msgs[2].subject)
+	require.Equal(t, "pmu.Station_B.data", msgs[3].subject)
+	require.Empty(t, msgs[2].headers)
+
+	var data struct {
+		Time     float64
+		Stations []map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal(msgs[3].data, &data))
+	require.InDelta(t, m.Time, data.Time, 1e-6)
+	require.Len(t, data.Stations, 1)
+}
+
+func TestSinkJetStream(t *testing.T) {
+	srv := newServer(t)
+	cfg := testConfig()
+
+	opts := Options{
+		URL:       srv.listener.Addr().String(),
+		JetStream: &JetStreamOptions{Stream: "PMU", Create: true, MaxAge: time.Hour, MaxPending: 1},
+	}
+	sink, err := New(cfg, opts)
+	require.NoError(t, err)
+
+	var stream map[string]interface{}
+	srv.mu.Lock()
+	require.NoError(t, json.Unmarshal(srv.streams["PMU"], &stream))
+	srv.mu.Unlock()
+	require.Equal(t, []interface{}{"synchrophasor.>"}, stream["subjects"])
+	require.Equal(t, float64(time.Hour), stream["max_age"])
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SetTime(nil, nil)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.Write(&m))
+	}
+	require.NoError(t, sink.Close())
+
+	msgs := srv.received()
+	require.Len(t, msgs, 2+3*2)
+	require.Contains(t, msgs[2].headers, "Nats-Msg-Id: Station_A-")
+
+	// An existing stream is used as is
+	sink, err = New(cfg, opts)
+	require.NoError(t, err)
+	require.NoError(t, sink.Close())
+
+	// Without Create a missing stream is an error
+	_, err = New(cfg, Options{URL: srv.listener.Addr().String(), JetStream: &JetStreamOptions{Stream: "OTHER"}})
+	require.ErrorIs(t, err, ErrJetStream)
+}
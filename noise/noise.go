@@ -0,0 +1,291 @@
+// Package noise characterizes the measurement noise of a live stream without
+// a reference: it fits a steady state to a sliding window of every channel
+// and reports the spread of the residuals and the resulting TVE bounds, for
+// commissioning PMUs and validating the noise models of simulators
+package noise
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures an Analyzer
+type Options struct {
+	// Window is the number of valid sets fitted per station, defaults to 50.
+	// It should span a steady state, e.g. a few seconds.
+	Window int
+	// Confidence is the probability of the TVE bound, defaults to 0.997
+	Confidence float64
+}
+
+// Result holds the noise of a channel: "Sub 1.freq", "Sub 1.rocof" or a
+// phasor "Sub 1.<phasor>"
+type Result struct {
+	Channel string
+	// Count is the number of sets in the window, the noise is only
+	// estimated once it is filled
+	Count int
+	// Noise is the standard deviation of the residuals in Hz or Hz/s, and
+	// the RMS TVE as a fraction for phasors
+	Noise float64
+	// Max is the largest absolute residual, the largest TVE for phasors
+	Max float64
+	// MagnitudeNoise is the standard deviation of the magnitude relative to
+	// the fitted one and AngleNoise that of the angle in degrees
+	MagnitudeNoise, AngleNoise float64
+	// SNR is the signal to noise ratio of phasors in dB
+	SNR float64
+	// TVEBound is the TVE not exceeded with the configured confidence,
+	// assuming Gaussian noise of equal spread in both components
+	TVEBound float64
+	// Time is the time of the latest set of the window
+	Time time.Time
+}
+
+// sample is a valid set of a station
+type sample struct {
+	time        int64
+	freq, rocof float64
+	phasors     []complex128
+}
+
+// station holds the window of a station
+type station struct {
+	name    string
+	phasors []string
+	samples []sample
+}
+
+// Analyzer estimates the noise of a stream. Write must be called from a
+// single goroutine, Results may be called concurrently.
+type Analyzer struct {
+	opts     Options
+	mu       sync.Mutex
+	cfg      *synchrophasor.ConfigFrame
+	stations []*station
+}
+
+// New creates an analyzer for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Analyzer, error) {
+	if opts.Window <= 0 {
+		opts.Window = 50
+	}
+	if opts.Confidence <= 0 {
+		opts.Confidence = 0.997
+	}
+	if opts.Window < 3 || opts.Confidence >= 1 {
+		return nil, fmt.Errorf("%w: window %d shorter than 3 sets or confidence %g not below 1",
+			synchrophasor.ErrInvalidParameter, opts.Window, opts.Confidence)
+	}
+	a := &Analyzer{opts: opts}
+	a.setConfig(cfg)
+	return a, nil
+}
+
+// SetConfig replaces the configuration, restarting the windows
+func (a *Analyzer) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.setConfig(cfg)
+}
+
+// setConfig resets the windows for cfg, a.mu must be held
+func (a *Analyzer) setConfig(cfg *synchrophasor.ConfigFrame) {
+	a.cfg = cfg
+	a.stations = make([]*station, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		st := &station{name: strings.TrimSpace(pmu.STN)}
+		for _, name := range pmu.CHNAMPhasor {
+			st.phasors = append(st.phasors, strings.TrimSpace(name))
+		}
+		a.stations[i] = st
+	}
+}
+
+// Write adds a measurement set to the windows. Stations with invalid data
+// skip the set.
+func (a *Analyzer) Write(m *synchrophasor.Measurements) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(m.Stations) != len(a.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(a.cfg.PMUStationList))
+	}
+	for i, pmu := range a.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := m.UnixNano()
+	for i, st := range a.stations {
+		ms := &m.Stations[i]
+		if !valid(ms) {
+			continue
+		}
+		// Reuse the phasors of the sample leaving the window
+		var phasors []complex128
+		if len(st.samples) == a.opts.Window {
+			phasors = st.samples[0].phasors
+			st.samples = append(st.samples[:0], st.samples[1:]...)
+		}
+		st.samples = append(st.samples, sample{
+			time:    t,
+			freq:    float64(ms.Frequency),
+			rocof:   float64(ms.ROCOF),
+			phasors: append(phasors[:0], ms.Phasors...),
+		})
+	}
+	return nil
+}
+
+// valid reports whether a station holds finite values without data error
+func valid(st *synchrophasor.StationMeasurement) bool {
+	if st.Stat&synchrophasor.StatDataError != 0 || !finite(float64(st.Frequency)) || !finite(float64(st.ROCOF)) {
+		return false
+	}
+	for _, p := range st.Phasors {
+		if !finite(real(p)) || !finite(imag(p)) || p == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// finite reports whether v is neither NaN nor infinite
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// Results returns the noise of all channels in configuration order: the
+// frequency, ROCOF and phasors of every station
+func (a *Analyzer) Results() []Result {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// TVE of complex Gaussian noise is Rayleigh distributed
+	bound := math.Sqrt(-math.Log(1 - a.opts.Confidence))
+	var results []Result
+	for _, st := range a.stations {
+		results = append(results, st.results(a.opts.Window, bound)...)
+	}
+	return results
+}
+
+// results returns the noise of the channels of a station, scaling the RMS TVE
+// by bound for the TVE bound
+func (st *station) results(window int, bound float64) []Result {
+	results := []Result{{Channel: st.name + ".freq"}, {Channel: st.name + ".rocof"}}
+	for _, name := range st.phasors {
+		results = append(results, Result{Channel: st.name + "." + name})
+	}
+	n := len(st.samples)
+	for i := range results {
+		results[i].Count = n
+		if n > 0 {
+			results[i].Time = time.Unix(0, st.samples[n-1].time).UTC()
+		}
+	}
+	if n < window {
+		return results
+	}
+
+	// Times in seconds relative to the middle of the window
+	ts := make([]float64, n)
+	mid := st.samples[n/2].time
+	for i, s := range st.samples {
+		ts[i] = float64(s.time-mid) / 1e9
+	}
+	ys := make([]float64, n)
+
+	// The frequency may ramp, the ROCOF is constant in a steady state
+	for i, s := range st.samples {
+		ys[i] = s.freq
+	}
+	results[0].Noise, results[0].Max = residuals(ts, ys, true)
+	for i, s := range st.samples {
+		ys[i] = s.rocof
+	}
+	results[1].Noise, results[1].Max = residuals(ts, ys, false)
+
+	for j := range st.phasors {
+		r := &results[2+j]
+		// A constant magnitude rotating at a constant rate
+		var mag, angle float64
+		for i, s := range st.samples {
+			p := s.phasors[j]
+			mag += cmplx.Abs(p)
+			a := cmplx.Phase(p)
+			if i > 0 {
+				a = angle + math.Remainder(a-angle, 2*math.Pi)
+			}
+			ys[i], angle = a, a
+		}
+		mag /= float64(n)
+		offset, slope := fit(ts, ys, true)
+
+		var tve2, magVar, angVar float64
+		for i, s := range st.samples {
+			p := s.phasors[j]
+			ref := cmplx.Rect(mag, offset+slope*ts[i])
+			tve := cmplx.Abs(p-ref) / mag
+			tve2 += tve * tve
+			r.Max = max(r.Max, tve)
+			dm := cmplx.Abs(p)/mag - 1
+			da := (ys[i] - offset - slope*ts[i]) * 180 / math.Pi
+			magVar += dm * dm
+			angVar += da * da
+		}
+		r.Noise = math.Sqrt(tve2 / float64(n))
+		r.MagnitudeNoise = math.Sqrt(magVar / float64(n))
+		r.AngleNoise = math.Sqrt(angVar / float64(n))
+		r.SNR = math.Inf(1)
+		if r.Noise > 0 {
+			r.SNR = -20 * math.Log10(r.Noise)
+		}
+		r.TVEBound = r.Noise * bound
+	}
+	return results
+}
+
+// residuals returns the standard deviation and the largest absolute value of
+// the residuals of ys against their mean, or their line if linear
+func residuals(ts, ys []float64, linear bool) (float64, float64) {
+	offset, slope := fit(ts, ys, linear)
+	var sq, peak float64
+	for i, y := range ys {
+		d := y - offset - slope*ts[i]
+		sq += d * d
+		peak = max(peak, math.Abs(d))
+	}
+	return math.Sqrt(sq / float64(len(ys))), peak
+}
+
+// fit returns the least squares line of ys over ts, or their mean with a zero
+// slope unless linear
+func fit(ts, ys []float64, linear bool) (offset, slope float64) {
+	var mt, my float64
+	for i, y := range ys {
+		mt += ts[i]
+		my += y
+	}
+	mt /= float64(len(ys))
+	my /= float64(len(ys))
+	if !linear {
+		return my, 0
+	}
+	var stt, sty float64
+	for i, y := range ys {
+		stt += (ts[i] - mt) * (ts[i] - mt)
+		sty += (ts[i] - mt) * (y - my)
+	}
+	if stt > 0 {
+		slope = sty / stt
+	}
+	return my - slope*mt, slope
+}
@@ -0,0 +1,93 @@
+package noise
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second: 50.1 Hz
+// with 1 mHz frequency noise, 10 mHz/s ROCOF noise and 0.1 % TVE at Sub 1,
+// without noise at Sub 2
+func set(cfg *synchrophasor.ConfigFrame, i int, rng *rand.Rand) *synchrophasor.Measurements {
+	p := cmplx.Rect(230, 0.3+2*math.Pi*0.1*float64(i)/10)
+	sigma := 230 * 0.001 / math.Sqrt2
+	sub1, sub2 := cfg.PMUStationList[0], cfg.PMUStationList[1]
+	sub1.Freq = float32(50.1 + 0.001*rng.NormFloat64())
+	sub1.DFreq = float32(0.01 * rng.NormFloat64())
+	sub1.PhasorValues[0] = p + complex(sigma*rng.NormFloat64(), sigma*rng.NormFloat64())
+	sub2.Freq = 50.1
+	sub2.DFreq = 0
+	sub2.PhasorValues[0] = p
+	return testutil.Measurements(cfg, i)
+}
+
+func TestAnalyzer(t *testing.T) {
+	cfg := testConfig()
+	a, err := New(cfg, Options{Window: 2000})
+	require.NoError(t, err)
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	require.NoError(t, a.Write(set(cfg, 0, rng)))
+	results := a.Results()
+	require.Len(t, results, 6)
+	require.Equal(t, "Sub 1.freq", results[0].Channel)
+	require.Equal(t, "Sub 2.VA", results[5].Channel)
+	require.Equal(t, 1, results[2].Count)
+	require.Zero(t, results[2].Noise)
+
+	for i := 1; i < 2000; i++ {
+		m := set(cfg, i, rng)
+		if i == 1000 {
+			// Skipped, so Sub 1 lacks a set
+			m.Stations[0].Stat |= 0x8000
+		}
+		require.NoError(t, a.Write(m))
+	}
+	results = a.Results()
+	require.Equal(t, 1999, results[2].Count)
+	require.Zero(t, results[2].Noise)
+
+	require.NoError(t, a.Write(set(cfg, 2000, rng)))
+	results = a.Results()
+	freq, rocof, va := results[0], results[1], results[2]
+	require.Equal(t, 2000, va.Count)
+	require.Equal(t, time.Unix(1700000200, 0).UTC(), va.Time)
+	require.InDelta(t, 0.001, freq.Noise, 0.0001)
+	require.Greater(t, freq.Max, 0.002)
+	require.InDelta(t, 0.01, rocof.Noise, 0.001)
+	require.InDelta(t, 0.001, va.Noise, 0.0001)
+	require.InDelta(t, 60, va.SNR, 1)
+	require.InDelta(t, 0.001/math.Sqrt2, va.MagnitudeNoise, 0.0001)
+	require.InDelta(t, 0.001/math.Sqrt2*180/math.Pi, va.AngleNoise, 0.005)
+	require.InDelta(t, 0.001*math.Sqrt(-math.Log(0.003)), va.TVEBound, 0.0003)
+	require.Less(t, va.Max, 0.005)
+
+	// The rotation and the steady state are fitted exactly
+	for _, r := range results[3:] {
+		require.InDelta(t, 0, r.Noise, 1e-6, r.Channel)
+	}
+
+	m := set(cfg, 2001, rng)
+	m.Stations = m.Stations[:1]
+	require.ErrorIs(t, a.Write(m), synchrophasor.ErrInvalidParameter)
+}
+
+func TestNew(t *testing.T) {
+	for _, opts := range []Options{{Window: 2}, {Confidence: 1}} {
+		_, err := New(testConfig(), opts)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+}
@@ -0,0 +1,138 @@
+package openpdc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Load reads devices from an openPDC configuration cache file
+func Load(path string) ([]*Device, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	return ParseConfiguration(file)
+}
+
+// ParseConfiguration reads the devices from an openPDC configuration cache
+// (SystemConfiguration.xml). Every phasor measurement mapper of the
+// InputAdapters table is a device, the ActiveMeasurements rows of the device
+// label its phasors (PA/PM signal references) and analogs (AV) by their
+// alternate tag.
+func ParseConfiguration(r io.Reader) ([]*Device, error) {
+	tables, err := readTables(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []*Device
+	byAcronym := make(map[string]*Device)
+	for _, row := range tables["inputadapters"] {
+		connectionString := row["connectionstring"]
+		if !strings.Contains(row["typename"], "PhasorMeasurementMapper") &&
+			!strings.Contains(strings.ToLower(connectionString), "phasorprotocol") {
+			continue
+		}
+		d, err := ParseDevice(connectionString)
+		if err != nil {
+			return nil, fmt.Errorf("device %s: %w", row["adaptername"], err)
+		}
+		d.Acronym = row["adaptername"]
+		devices = append(devices, d)
+		byAcronym[strings.ToUpper(d.Acronym)] = d
+	}
+
+	for _, row := range tables["activemeasurements"] {
+		d := byAcronym[strings.ToUpper(row["device"])]
+		if d == nil {
+			continue
+		}
+		if d.FramesPerSecond == 0 {
+			d.FramesPerSecond, _ = strconv.Atoi(row["framespersecond"])
+		}
+
+		// Signal references end in the signal type and a one-based index
+		ref := row["signalreference"]
+		suffix := strings.ToUpper(ref[strings.LastIndexByte(ref, '-')+1:])
+		if len(suffix) < 3 {
+			continue
+		}
+		index, err := strconv.Atoi(suffix[2:])
+		if err != nil || index < 1 {
+			continue
+		}
+		label := strings.TrimSpace(row["alternatetag"])
+		switch suffix[:2] {
+		case "PA", "PM":
+			d.Phasors = setLabel(d.Phasors, index-1, label)
+		case "AV":
+			d.Analogs = setLabel(d.Analogs, index-1, label)
+		}
+	}
+	return devices, nil
+}
+
+// setLabel sets the label at index i, growing labels as needed
+func setLabel(labels []string, i int, label string) []string {
+	for len(labels) <= i {
+		labels = append(labels, "")
+	}
+	if labels[i] == "" {
+		labels[i] = label
+	}
+	return labels
+}
+
+// readTables reads the rows of an XML data set as lower case field names to
+// values per lower case table name
+func readTables(r io.Reader) (map[string][]map[string]string, error) {
+	tables := make(map[string][]map[string]string)
+	decoder := xml.NewDecoder(r)
+
+	var row map[string]string
+	var field strings.Builder
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", synchrophasor.ErrInvalidParameter, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch depth {
+			case 2:
+				row = make(map[string]string)
+				name := strings.ToLower(t.Name.Local)
+				tables[name] = append(tables[name], row)
+			case 3:
+				field.Reset()
+			}
+		case xml.CharData:
+			if depth == 3 {
+				field.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 3 {
+				row[strings.ToLower(t.Name.Local)] = strings.TrimSpace(field.String())
+			}
+			depth--
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: truncated configuration", synchrophasor.ErrInvalidParameter)
+	}
+	return tables, nil
+}
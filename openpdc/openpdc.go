@@ -0,0 +1,214 @@
+// Package openpdc imports openPDC device connection strings and configuration
+// caches to bootstrap PDC connections and station/channel naming when
+// migrating existing deployments
+package openpdc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ParseConnectionString splits an openPDC connection string into its
+// key=value pairs. Pairs are separated by semicolons, values containing
+// semicolons are enclosed in braces, which may nest. Keys are case
+// insensitive and returned in lower case.
+func ParseConnectionString(s string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for len(strings.TrimSpace(s)) > 0 {
+		// Find the end of the pair outside of braces
+		depth, end := 0, len(s)
+		for i, c := range s {
+			if c == '{' {
+				depth++
+			} else if c == '}' {
+				if depth--; depth < 0 {
+					return nil, fmt.Errorf("%w: unbalanced braces in connection string", synchrophasor.ErrInvalidParameter)
+				}
+			} else if c == ';' && depth == 0 {
+				end = i
+				break
+			}
+		}
+		if depth != 0 {
+			return nil, fmt.Errorf("%w: unbalanced braces in connection string", synchrophasor.ErrInvalidParameter)
+		}
+
+		pair := strings.TrimSpace(s[:end])
+		s = s[min(end+1, len(s)):]
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("%w: invalid connection string setting %q", synchrophasor.ErrInvalidParameter, pair)
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			value = value[1 : len(value)-1]
+		}
+		settings[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return settings, nil
+}
+
+// Connection is the transport of a device connection
+type Connection struct {
+	// Transport is the lower case transport protocol, "tcp" or "udp"
+	Transport string
+	// Server is the device host name or address
+	Server string
+	// Port is the remote port, LocalPort the port receiving UDP data
+	Port      int
+	LocalPort int
+	// Interface is the local interface to bind
+	Interface string
+	// Listener is set when the device connects to openPDC
+	Listener bool
+}
+
+// Address returns the host:port of the device
+func (c *Connection) Address() string {
+	return net.JoinHostPort(c.Server, strconv.Itoa(c.Port))
+}
+
+// Device is an openPDC input device
+type Device struct {
+	Connection
+	// Acronym identifies the device, Name is the descriptive name
+	Acronym string
+	Name    string
+	// AccessID is the ID code used to request data from the device
+	AccessID uint16
+	// Protocol is the phasor protocol, e.g. IeeeC37_118V1
+	Protocol string
+	// FramesPerSecond is the configured data rate, 0 when unknown
+	FramesPerSecond int
+	// CommandChannel is the TCP connection sending commands to devices
+	// streaming data over UDP
+	CommandChannel *Connection
+	// Phasors and Analogs hold channel labels by index, empty labels keep
+	// the names of the configuration frame
+	Phasors []string
+	Analogs []string
+}
+
+// ParseDevice reads the connection settings of a device from its openPDC
+// connection string
+func ParseDevice(connectionString string) (*Device, error) {
+	settings, err := ParseConnectionString(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Device{Protocol: settings["phasorprotocol"]}
+	if err := d.Connection.parse(settings); err != nil {
+		return nil, err
+	}
+	if v, ok := settings["accessid"]; ok {
+		id, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid access ID %q", synchrophasor.ErrInvalidParameter, v)
+		}
+		d.AccessID = uint16(id)
+	}
+	if v, ok := settings["framespersecond"]; ok {
+		if d.FramesPerSecond, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("%w: invalid frame rate %q", synchrophasor.ErrInvalidParameter, v)
+		}
+	}
+	if v, ok := settings["commandchannel"]; ok {
+		command, err := ParseConnectionString(v)
+		if err != nil {
+			return nil, err
+		}
+		d.CommandChannel = &Connection{}
+		if err := d.CommandChannel.parse(command); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// parse reads the transport settings of a connection string
+func (c *Connection) parse(settings map[string]string) error {
+	c.Transport = strings.ToLower(settings["transportprotocol"])
+	if c.Transport == "" {
+		c.Transport = "tcp"
+	}
+	c.Server = settings["server"]
+	c.Interface = settings["interface"]
+	c.Listener, _ = strconv.ParseBool(settings["islistener"])
+
+	// The port may be part of the server setting
+	port := settings["port"]
+	if host, p, err := net.SplitHostPort(c.Server); err == nil {
+		c.Server = host
+		if port == "" {
+			port = p
+		}
+	}
+
+	var err error
+	if port != "" {
+		if c.Port, err = parsePort(port); err != nil {
+			return err
+		}
+	}
+	if v, ok := settings["localport"]; ok {
+		if c.LocalPort, err = parsePort(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePort parses a TCP or UDP port number
+func parsePort(s string) (int, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid port %q", synchrophasor.ErrInvalidParameter, s)
+	}
+	return int(port), nil
+}
+
+// Apply names the station of the device in cfg, the station with the access
+// ID as ID code or the only station, after the device and its channels. It
+// reports whether a station was found.
+func (d *Device) Apply(cfg *synchrophasor.ConfigFrame) bool {
+	var station *synchrophasor.PMUStation
+	for _, pmu := range cfg.PMUStationList {
+		if pmu.IDCode == d.AccessID {
+			station = pmu
+			break
+		}
+	}
+	if station == nil && len(cfg.PMUStationList) == 1 {
+		station = cfg.PMUStationList[0]
+	}
+	if station == nil {
+		return false
+	}
+
+	if d.Name != "" {
+		station.STN = d.Name
+	} else if d.Acronym != "" {
+		station.STN = d.Acronym
+	}
+	rename(station.CHNAMPhasor, d.Phasors)
+	rename(station.CHNAMAnalog, d.Analogs)
+	return true
+}
+
+// rename replaces channel names with the non-empty labels, padded to the
+// 16 characters of configuration frame names
+func rename(names, labels []string) {
+	for i, label := range labels {
+		if i < len(names) && label != "" {
+			names[i] = fmt.Sprintf("%-16.16s", label)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package openpdc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	settings, err := ParseConnectionString(" transportProtocol=Udp; localPort=4713;; " +
+		"commandChannel={transportProtocol=Tcp; server={10.0.0.5}:4712}; accessID = 7 ")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"transportprotocol": "Udp",
+		"localport":         "4713",
+		"commandchannel":    "transportProtocol=Tcp; server={10.0.0.5}:4712",
+		"accessid":          "7",
+	}, settings)
+
+	for _, s := range []string{"server", "=1", "a={b", "a=b}"} {
+		_, err = ParseConnectionString(s)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter, s)
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	d, err := ParseDevice("transportProtocol=Tcp; server=192.168.1.10; port=4712; isListener=false; " +
+		"phasorProtocol=IeeeC37_118V1; accessID=2")
+	require.NoError(t, err)
+	require.Equal(t, "tcp", d.Transport)
+	require.Equal(t, "192.168.1.10:4712", d.Address())
+	require.Equal(t, uint16(2), d.AccessID)
+	require.Equal(t, "IeeeC37_118V1", d.Protocol)
+	require.Nil(t, d.CommandChannel)
+
+	d, err = ParseDevice("transportProtocol=Udp; localPort=4713; commandChannel={transportProtocol=Tcp; server=pmu1:4712}")
+	require.NoError(t, err)
+	require.Equal(t, "udp", d.Transport)
+	require.Equal(t, 4713, d.LocalPort)
+	require.Equal(t, "pmu1:4712", d.CommandChannel.Address())
+
+	for _, s := range []string{"accessID=70000", "port=x", "server=h:99999", "commandChannel={port=x}"} {
+		_, err = ParseDevice(s)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter, s)
+	}
+}
+
+const testConfiguration = `<?xml version="1.0" standalone="yes"?>
+<Iaon>
+  <InputAdapters>
+    <ID>1</ID>
+    <AdapterName>SHELBY</AdapterName>
+    <AssemblyName>PhasorProtocolAdapters.dll</AssemblyName>
+    <TypeName>PhasorProtocolAdapters.PhasorMeasurementMapper</TypeName>
+    <ConnectionString>transportProtocol=Tcp; server=10.1.1.20; port=4712;
+      phasorProtocol=IeeeC37_118V1; accessID=235</ConnectionString>
+  </InputAdapters>
+  <InputAdapters>
+    <ID>2</ID>
+    <AdapterName>CSVFILE</AdapterName>
+    <TypeName>CsvAdapters.CsvInputAdapter</TypeName>
+    <ConnectionString>fileName=data.csv</ConnectionString>
+  </InputAdapters>
+  <ActiveMeasurements>
+    <Device>SHELBY</Device>
+    <SignalReference>SHELBY-PM2</SignalReference>
+    <AlternateTag>IA</AlternateTag>
+    <FramesPerSecond>30</FramesPerSecond>
+  </ActiveMeasurements>
+  <ActiveMeasurements>
+    <Device>SHELBY</Device>
+    <SignalReference>SHELBY-PA2</SignalReference>
+    <AlternateTag>IA</AlternateTag>
+  </ActiveMeasurements>
+  <ActiveMeasurements>
+    <Device>SHELBY</Device>
+    <SignalReference>SHELBY-AV1</SignalReference>
+    <AlternateTag>MW</AlternateTag>
+  </ActiveMeasurements>
+  <ActiveMeasurements>
+    <Device>SHELBY</Device>
+    <SignalReference>SHELBY-FQ</SignalReference>
+  </ActiveMeasurements>
+  <ActiveMeasurements>
+    <Device>OTHER</Device>
+    <SignalReference>OTHER-PM1</SignalReference>
+    <AlternateTag>VA</AlternateTag>
+  </ActiveMeasurements>
+</Iaon>`
+
+func TestConfiguration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "SystemConfiguration.xml")
+	require.NoError(t, os.WriteFile(path, []byte(testConfiguration), 0o644))
+	devices, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, devices, 1)
+
+	d := devices[0]
+	require.Equal(t, "SHELBY", d.Acronym)
+	require.Equal(t, uint16(235), d.AccessID)
+	require.Equal(t, "10.1.1.20:4712", d.Address())
+	require.Equal(t, 30, d.FramesPerSecond)
+	require.Equal(t, []string{"", "IA"}, d.Phasors)
+	require.Equal(t, []string{"MW"}, d.Analogs)
+
+	// The station with the access ID is renamed
+	cfg := synchrophasor.NewConfigFrame()
+	for _, id := range []uint16{1, 235} {
+		station := synchrophasor.NewPMUStation("PMU", id, true, true, true, true)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("I1", 1, synchrophasor.PhunitCurrent)
+		station.AddAnalog("A1", 1, 0)
+		cfg.AddPMUStation(station)
+	}
+	require.True(t, d.Apply(cfg))
+	require.Equal(t, "PMU", cfg.PMUStationList[0].STN)
+	station := cfg.PMUStationList[1]
+	require.Equal(t, "SHELBY", station.STN)
+	require.Equal(t, "VA", strings.TrimSpace(station.CHNAMPhasor[0]))
+	require.Equal(t, "IA", strings.TrimSpace(station.CHNAMPhasor[1]))
+	require.Equal(t, "MW", strings.TrimSpace(station.CHNAMAnalog[0]))
+
+	d.AccessID = 3
+	require.False(t, d.Apply(cfg))
+
+	_, err = ParseConfiguration(strings.NewReader("<Iaon><InputAdapters>"))
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
@@ -0,0 +1,164 @@
+// Package otelmetrics implements synchrophasor.MetricsRecorder with
+// OpenTelemetry instruments, for PMU servers exporting through an OTLP
+// pipeline instead of a Prometheus endpoint
+package otelmetrics
+
+import (
+	"context"
+
+	"github.com/JSchlarb/synchrophasor"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Options configures a Recorder
+type Options struct {
+	// Prefix of the instrument names, defaults to "synchrophasor.pmu"
+	Prefix string
+	// Attributes are added to every measurement, e.g. the PMU name
+	Attributes []attribute.KeyValue
+}
+
+// Recorder records the PMU server metrics as OpenTelemetry counters, gauges
+// and histograms:
+//
+//	<prefix>.clients           up-down counter of connected clients
+//	<prefix>.commands          counter of commands by command
+//	<prefix>.frames.sent       counter of sent frames by frame_type
+//	<prefix>.frame.size        histogram of sent frame sizes by frame_type
+//	<prefix>.bytes.received    counter of received bytes
+//	<prefix>.frame.errors      counter of frame errors by error_type
+//	<prefix>.data_frame.rate   gauge of the data frame rate
+type Recorder struct {
+	attrs []attribute.KeyValue
+	base  metric.MeasurementOption
+	// frameType holds the attribute sets of data, configuration and header
+	// frames
+	frameType [3]metric.MeasurementOption
+
+	clients   metric.Int64UpDownCounter
+	commands  metric.Int64Counter
+	frames    metric.Int64Counter
+	frameSize metric.Int64Histogram
+	received  metric.Int64Counter
+	errors    metric.Int64Counter
+	rate      metric.Float64Gauge
+}
+
+var _ synchrophasor.MetricsRecorder = (*Recorder)(nil)
+
+// Frame types of the frameType attribute sets
+const (
+	frameData = iota
+	frameConfig
+	frameHeader
+)
+
+// New creates the instruments with meter, typically obtained from
+// otel.Meter or a MeterProvider
+func New(meter metric.Meter, opts Options) (*Recorder, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "synchrophasor.pmu"
+	}
+	p := opts.Prefix + "."
+
+	r := &Recorder{
+		attrs: opts.Attributes,
+		base:  metric.WithAttributeSet(attribute.NewSet(opts.Attributes...)),
+	}
+	for i, name := range []string{"data", "config", "header"} {
+		attrs := append(append([]attribute.KeyValue(nil), opts.Attributes...), attribute.String("frame_type", name))
+		r.frameType[i] = metric.WithAttributeSet(attribute.NewSet(attrs...))
+	}
+
+	var err error
+	if r.clients, err = meter.Int64UpDownCounter(p+"clients",
+		metric.WithDescription("Connected clients"), metric.WithUnit("{client}")); err != nil {
+		return nil, err
+	}
+	if r.commands, err = meter.Int64Counter(p+"commands",
+		metric.WithDescription("Commands received from clients"), metric.WithUnit("{command}")); err != nil {
+		return nil, err
+	}
+	if r.frames, err = meter.Int64Counter(p+"frames.sent",
+		metric.WithDescription("Frames sent to clients"), metric.WithUnit("{frame}")); err != nil {
+		return nil, err
+	}
+	if r.frameSize, err = meter.Int64Histogram(p+"frame.size",
+		metric.WithDescription("Size of the frames sent to clients"), metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 65535)); err != nil {
+		return nil, err
+	}
+	if r.received, err = meter.Int64Counter(p+"bytes.received",
+		metric.WithDescription("Bytes received from clients"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if r.errors, err = meter.Int64Counter(p+"frame.errors",
+		metric.WithDescription("Invalid frames received"), metric.WithUnit("{error}")); err != nil {
+		return nil, err
+	}
+	if r.rate, err = meter.Float64Gauge(p+"data_frame.rate",
+		metric.WithDescription("Data frame rate"), metric.WithUnit("Hz")); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// with returns the attributes of a measurement with an additional attribute
+func (r *Recorder) with(key, value string) metric.MeasurementOption {
+	attrs := make([]attribute.KeyValue, 0, len(r.attrs)+1)
+	attrs = append(attrs, r.attrs...)
+	return metric.WithAttributes(append(attrs, attribute.String(key, value))...)
+}
+
+// RecordClientConnected counts a connected client
+func (r *Recorder) RecordClientConnected() {
+	r.clients.Add(context.Background(), 1, r.base)
+}
+
+// RecordClientDisconnected counts a disconnected client
+func (r *Recorder) RecordClientDisconnected() {
+	r.clients.Add(context.Background(), -1, r.base)
+}
+
+// RecordCommand counts a command
+func (r *Recorder) RecordCommand(cmdType string) {
+	r.commands.Add(context.Background(), 1, r.with("command", cmdType))
+}
+
+// RecordDataFrameSent counts a data frame and records its size
+func (r *Recorder) RecordDataFrameSent(size int) {
+	r.frameSent(frameData, size)
+}
+
+// RecordConfigFrameSent counts a configuration frame and records its size
+func (r *Recorder) RecordConfigFrameSent(size int) {
+	r.frameSent(frameConfig, size)
+}
+
+// RecordHeaderFrameSent counts a header frame and records its size
+func (r *Recorder) RecordHeaderFrameSent(size int) {
+	r.frameSent(frameHeader, size)
+}
+
+// frameSent records a sent frame
+func (r *Recorder) frameSent(frameType, size int) {
+	ctx := context.Background()
+	r.frames.Add(ctx, 1, r.frameType[frameType])
+	r.frameSize.Record(ctx, int64(size), r.frameType[frameType])
+}
+
+// RecordBytesReceived counts received bytes
+func (r *Recorder) RecordBytesReceived(size int) {
+	r.received.Add(context.Background(), int64(size), r.base)
+}
+
+// RecordFrameError counts a frame error
+func (r *Recorder) RecordFrameError(errorType string) {
+	r.errors.Add(context.Background(), 1, r.with("error_type", errorType))
+}
+
+// UpdateDataFrameRate sets the data frame rate
+func (r *Recorder) UpdateDataFrameRate(rate float64) {
+	r.rate.Record(context.Background(), rate, r.base)
+}
@@ -0,0 +1,152 @@
+package otelmetrics
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// point is a recorded measurement
+type point struct {
+	name  string
+	value float64
+	attrs attribute.Set
+}
+
+// meter records the measurements of its synchronous instruments
+type meter struct {
+	noop.Meter
+	mu     sync.Mutex
+	points []point
+	units  map[string]string
+}
+
+func (m *meter) record(name string, value float64, attrs attribute.Set) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.points = append(m.points, point{name, value, attrs})
+}
+
+// sum returns the sum of the measurements of name with the attribute
+func (m *meter) sum(name string, kv ...attribute.KeyValue) float64 {
+	var sum float64
+	for _, p := range m.points {
+		if p.name != name {
+			continue
+		}
+		match := true
+		for _, want := range kv {
+			if v, ok := p.attrs.Value(want.Key); !ok || v != want.Value {
+				match = false
+			}
+		}
+		if match {
+			sum += p.value
+		}
+	}
+	return sum
+}
+
+type int64Counter struct {
+	noop.Int64Counter
+	m    *meter
+	name string
+}
+
+func (c int64Counter) Add(_ context.Context, v int64, opts ...metric.AddOption) {
+	c.m.record(c.name, float64(v), metric.NewAddConfig(opts).Attributes())
+}
+
+type int64UpDownCounter struct {
+	noop.Int64UpDownCounter
+	m    *meter
+	name string
+}
+
+func (c int64UpDownCounter) Add(_ context.Context, v int64, opts ...metric.AddOption) {
+	c.m.record(c.name, float64(v), metric.NewAddConfig(opts).Attributes())
+}
+
+type int64Histogram struct {
+	noop.Int64Histogram
+	m    *meter
+	name string
+}
+
+func (h int64Histogram) Record(_ context.Context, v int64, opts ...metric.RecordOption) {
+	h.m.record(h.name, float64(v), metric.NewRecordConfig(opts).Attributes())
+}
+
+type float64Gauge struct {
+	noop.Float64Gauge
+	m    *meter
+	name string
+}
+
+func (g float64Gauge) Record(_ context.Context, v float64, opts ...metric.RecordOption) {
+	g.m.record(g.name, v, metric.NewRecordConfig(opts).Attributes())
+}
+
+func (m *meter) Int64Counter(name string, opts ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	m.units[name] = metric.NewInt64CounterConfig(opts...).Unit()
+	return int64Counter{m: m, name: name}, nil
+}
+
+func (m *meter) Int64UpDownCounter(name string,
+	opts ...metric.Int64UpDownCounterOption) (metric.Int64UpDownCounter, error) {
+	m.units[name] = metric.NewInt64UpDownCounterConfig(opts...).Unit()
+	return int64UpDownCounter{m: m, name: name}, nil
+}
+
+func (m *meter) Int64Histogram(name string, opts ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	m.units[name] = metric.NewInt64HistogramConfig(opts...).Unit()
+	return int64Histogram{m: m, name: name}, nil
+}
+
+func (m *meter) Float64Gauge(name string, opts ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+	m.units[name] = metric.NewFloat64GaugeConfig(opts...).Unit()
+	return float64Gauge{m: m, name: name}, nil
+}
+
+func TestRecorder(t *testing.T) {
+	m := &meter{units: map[string]string{}}
+	pmu := attribute.String("pmu", "PMU 1")
+	r, err := New(m, Options{Attributes: []attribute.KeyValue{pmu}})
+	require.NoError(t, err)
+	require.Len(t, m.units, 7)
+	require.Equal(t, "By", m.units["synchrophasor.pmu.frame.size"])
+	require.Equal(t, "Hz", m.units["synchrophasor.pmu.data_frame.rate"])
+
+	r.RecordClientConnected()
+	r.RecordClientConnected()
+	r.RecordClientDisconnected()
+	r.RecordCommand("start")
+	r.RecordCommand("start")
+	r.RecordCommand("config2")
+	r.RecordDataFrameSent(100)
+	r.RecordDataFrameSent(120)
+	r.RecordConfigFrameSent(400)
+	r.RecordHeaderFrameSent(50)
+	r.RecordBytesReceived(18)
+	r.RecordFrameError("crc")
+	r.UpdateDataFrameRate(50)
+
+	require.Equal(t, 1.0, m.sum("synchrophasor.pmu.clients", pmu))
+	require.Equal(t, 2.0, m.sum("synchrophasor.pmu.commands", pmu, attribute.String("command", "start")))
+	require.Equal(t, 3.0, m.sum("synchrophasor.pmu.commands"))
+	require.Equal(t, 2.0, m.sum("synchrophasor.pmu.frames.sent", pmu, attribute.String("frame_type", "data")))
+	require.Equal(t, 220.0, m.sum("synchrophasor.pmu.frame.size", attribute.String("frame_type", "data")))
+	require.Equal(t, 400.0, m.sum("synchrophasor.pmu.frame.size", attribute.String("frame_type", "config")))
+	require.Equal(t, 1.0, m.sum("synchrophasor.pmu.frames.sent", attribute.String("frame_type", "header")))
+	require.Equal(t, 18.0, m.sum("synchrophasor.pmu.bytes.received", pmu))
+	require.Equal(t, 1.0, m.sum("synchrophasor.pmu.frame.errors", attribute.String("error_type", "crc")))
+	require.Equal(t, 50.0, m.sum("synchrophasor.pmu.data_frame.rate", pmu))
+
+	_, err = New(noop.NewMeterProvider().Meter("test"), Options{Prefix: "pdc"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,280 @@
+package parquetsink
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+)
+
+// Parquet enum values from parquet.thrift
+const (
+	typeBoolean = 0
+	typeInt32   = 1
+	typeInt64   = 2
+	typeFloat   = 4
+	typeDouble  = 5
+
+	repetitionRequired = 0
+
+	convertedTimestampMicros = 10
+	convertedUint16          = 12
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageTypeData = 0
+)
+
+// Compression codecs
+const (
+	Uncompressed = 0
+	Gzip         = 2
+)
+
+var magic = []byte("PAR1")
+
+// column is one leaf column of a file with the values of the open row group
+type column struct {
+	name      string
+	typ       int32
+	converted int32 // -1 for none
+	values    []byte
+	rows      int
+}
+
+// chunk is the metadata of a written column chunk
+type chunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+	numValues    int64
+}
+
+// rowGroup is the metadata of a written row group
+type rowGroup struct {
+	rows   int64
+	size   int64
+	chunks []chunk
+}
+
+// fileWriter writes a flat Parquet file with required columns and PLAIN encoding
+type fileWriter struct {
+	file      *os.File
+	w         *bufio.Writer
+	offset    int64
+	codec     int32
+	columns   []column
+	rows      int
+	groups    []rowGroup
+	totalRows int64
+	metadata  [][2]string
+}
+
+// newFileWriter creates the file and writes the leading magic
+func newFileWriter(name string, columns []column, codec int32, metadata [][2]string) (*fileWriter, error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &fileWriter{
+		file:     file,
+		w:        bufio.NewWriterSize(file, 256*1024),
+		codec:    codec,
+		columns:  columns,
+		metadata: metadata,
+	}
+	if err := fw.write(magic); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return fw, nil
+}
+
+// write appends b to the file, tracking the offset
+func (f *fileWriter) write(b []byte) error {
+	n, err := f.w.Write(b)
+	f.offset += int64(n)
+	return err
+}
+
+// appendInt64 appends to a column of INT64 values
+func (c *column) appendInt64(v int64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v))
+	c.rows++
+}
+
+// appendInt32 appends to a column of INT32 values
+func (c *column) appendInt32(v int32) {
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(v))
+	c.rows++
+}
+
+// appendFloat appends to a column of FLOAT values
+func (c *column) appendFloat(v float32) {
+	c.values = binary.LittleEndian.AppendUint32(c.values, math.Float32bits(v))
+	c.rows++
+}
+
+// appendDouble appends to a column of DOUBLE values
+func (c *column) appendDouble(v float64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(v))
+	c.rows++
+}
+
+// appendBool appends to a column of bit-packed BOOLEAN values
+func (c *column) appendBool(v bool) {
+	if c.rows%8 == 0 {
+		c.values = append(c.values, 0)
+	}
+	if v {
+		c.values[c.rows/8] |= 1 << uint(c.rows%8)
+	}
+	c.rows++
+}
+
+// flushRowGroup writes the buffered rows as a row group, one data page per column
+func (f *fileWriter) flushRowGroup() error {
+	if f.rows == 0 {
+		return nil
+	}
+
+	group := rowGroup{rows: int64(f.rows), chunks: make([]chunk, len(f.columns))}
+	for i := range f.columns {
+		col := &f.columns[i]
+		page := col.values
+		if f.codec == Gzip {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			if _, err := zw.Write(page); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			page = buf.Bytes()
+		}
+
+		var e tEncoder
+		e.begin()
+		e.i32Field(1, pageTypeData)
+		e.i32Field(2, int32(len(col.values)))
+		e.i32Field(3, int32(len(page)))
+		e.structField(5)
+		e.i32Field(1, int32(f.rows))
+		e.i32Field(2, encodingPlain)
+		e.i32Field(3, encodingRLE)
+		e.i32Field(4, encodingRLE)
+		e.end()
+		e.end()
+
+		group.chunks[i] = chunk{
+			offset:       f.offset,
+			uncompressed: int64(len(e.buf) + len(col.values)),
+			compressed:   int64(len(e.buf) + len(page)),
+			numValues:    int64(f.rows),
+		}
+		group.size += group.chunks[i].uncompressed
+
+		if err := f.write(e.buf); err != nil {
+			return err
+		}
+		if err := f.write(page); err != nil {
+			return err
+		}
+
+		col.values = col.values[:0]
+		col.rows = 0
+	}
+
+	f.groups = append(f.groups, group)
+	f.totalRows += int64(f.rows)
+	f.rows = 0
+	return nil
+}
+
+// close flushes pending rows, writes the footer and closes the file
+func (f *fileWriter) close() error {
+	err := f.flushRowGroup()
+	if err == nil {
+		footer := f.footer()
+		err = errors.Join(
+			f.write(footer),
+			f.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))),
+			f.write(magic),
+			f.w.Flush())
+	}
+	return errors.Join(err, f.file.Close())
+}
+
+// footer encodes the FileMetaData
+func (f *fileWriter) footer() []byte {
+	var e tEncoder
+	e.begin()
+	e.i32Field(1, 1)
+
+	// Schema: a root group followed by the leaf columns
+	e.listField(2, tcStruct, len(f.columns)+1)
+	e.begin()
+	e.stringField(4, "schema")
+	e.i32Field(5, int32(len(f.columns)))
+	e.end()
+	for _, col := range f.columns {
+		e.begin()
+		e.i32Field(1, col.typ)
+		e.i32Field(3, repetitionRequired)
+		e.stringField(4, col.name)
+		if col.converted >= 0 {
+			e.i32Field(6, col.converted)
+		}
+		e.end()
+	}
+
+	e.i64Field(3, f.totalRows)
+
+	e.listField(4, tcStruct, len(f.groups))
+	for _, group := range f.groups {
+		e.begin()
+		e.listField(1, tcStruct, len(group.chunks))
+		for i, ch := range group.chunks {
+			col := f.columns[i]
+			e.begin()
+			e.i64Field(2, ch.offset)
+			e.structField(3)
+			e.i32Field(1, col.typ)
+			e.listField(2, tcI32, 2)
+			e.writeI32(encodingPlain)
+			e.writeI32(encodingRLE)
+			e.listField(3, tcBinary, 1)
+			e.writeBinary(col.name)
+			e.i32Field(4, f.codec)
+			e.i64Field(5, ch.numValues)
+			e.i64Field(6, ch.uncompressed)
+			e.i64Field(7, ch.compressed)
+			e.i64Field(9, ch.offset)
+			e.end()
+			e.end()
+		}
+		e.i64Field(2, group.size)
+		e.i64Field(3, group.rows)
+		e.end()
+	}
+
+	if len(f.metadata) > 0 {
+		e.listField(5, tcStruct, len(f.metadata))
+		for _, kv := range f.metadata {
+			e.begin()
+			e.stringField(1, kv[0])
+			e.stringField(2, kv[1])
+			e.end()
+		}
+	}
+
+	e.stringField(6, "synchrophasor parquetsink")
+	e.end()
+	return e.buf
+}
@@ -0,0 +1,102 @@
+package parquetsink
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/apache/arrow-go/v18/parquet/schema"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSinkArrowGo reads the files with the Parquet reader of arrow-go,
+// independently of the Thrift field ids assumed by the writer
+func TestSinkArrowGo(t *testing.T) {
+	for _, codec := range []int32{Uncompressed, Gzip} {
+		cfg := newTestConfig()
+		df := synchrophasor.NewDataFrame(cfg)
+		dir := t.TempDir()
+		sink, err := New(cfg, Options{Dir: dir, RowGroupRows: 2, Compression: codec})
+		require.NoError(t, err)
+
+		var m synchrophasor.Measurements
+		station := cfg.PMUStationList[0]
+		for i := 0; i < 3; i++ {
+			df.SOC = 1760572797 + uint32(i)
+			station.Stat = uint16(0x8000 + i)
+			station.Freq = 50 + float32(i)/100
+			station.PhasorValues[0] = complex(0, float64(100+i))
+			station.AnalogValues[0] = float32(math.NaN())
+			station.DigitalValues[0][0] = i == 1
+			df.FillMeasurements(&m)
+			require.NoError(t, sink.Write(&m))
+		}
+		require.NoError(t, sink.Close())
+
+		path := filepath.Join(dir, "date=2025-10-15", "station=Station_A", "part-235957.parquet")
+		r, err := file.OpenParquetFile(path, false)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, r.Close()) }()
+		require.Equal(t, int64(3), r.NumRows())
+		require.Equal(t, 2, r.NumRowGroups())
+		meta := r.MetaData()
+		require.Equal(t, "Station A", *meta.KeyValueMetadata().FindValue("synchrophasor.station"))
+		require.Contains(t, *meta.KeyValueMetadata().FindValue("synchrophasor.config"), `"stn":"Station A"`)
+		require.Equal(t, 4+2+1+16, meta.Schema.NumColumns())
+		require.Equal(t, "time", meta.Schema.Column(0).Name())
+		require.Equal(t, schema.ConvertedTypes.TimestampMicros, meta.Schema.Column(0).ConvertedType())
+		require.Equal(t, "stat", meta.Schema.Column(1).Name())
+		require.Equal(t, schema.ConvertedTypes.Uint16, meta.Schema.Column(1).ConvertedType())
+
+		fr, err := pqarrow.NewFileReader(r, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+		require.NoError(t, err)
+		table, err := fr.ReadTable(context.Background())
+		require.NoError(t, err)
+		defer table.Release()
+
+		fields := table.Schema()
+		types := map[string]arrow.DataType{
+			"time":   &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"},
+			"stat":   arrow.PrimitiveTypes.Uint16,
+			"freq":   arrow.PrimitiveTypes.Float32,
+			"VA_mag": arrow.PrimitiveTypes.Float64,
+			"VA_ang": arrow.PrimitiveTypes.Float64,
+			"P":      arrow.PrimitiveTypes.Float32,
+			"BRK1":   arrow.FixedWidthTypes.Boolean,
+		}
+		column := func(name string) arrow.Array {
+			idx := fields.FieldIndices(name)
+			require.Len(t, idx, 1, name)
+			typ := fields.Field(idx[0]).Type
+			require.True(t, arrow.TypeEqual(types[name], typ), "%s: %s", name, typ)
+			chunked := table.Column(idx[0]).Data()
+			values, err := array.Concatenate(chunked.Chunks(), memory.DefaultAllocator)
+			require.NoError(t, err)
+			t.Cleanup(values.Release)
+			return values
+		}
+		times := column("time").(*array.Timestamp)
+		stat := column("stat").(*array.Uint16)
+		freq := column("freq").(*array.Float32)
+		mag := column("VA_mag").(*array.Float64)
+		ang := column("VA_ang").(*array.Float64)
+		p := column("P").(*array.Float32)
+		brk := column("BRK1").(*array.Boolean)
+		for i := 0; i < 3; i++ {
+			require.Equal(t, arrow.Timestamp((1760572797+int64(i))*1000000), times.Value(i))
+			require.Equal(t, uint16(0x8000+i), stat.Value(i))
+			require.InDelta(t, 50+float64(i)/100, freq.Value(i), 1e-5)
+			require.InDelta(t, 100+float64(i), mag.Value(i), 1e-9)
+			require.InDelta(t, 90, ang.Value(i), 1e-9)
+			require.True(t, math.IsNaN(float64(p.Value(i))))
+			require.Equal(t, i == 1, brk.Value(i))
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Package parquetsink archives synchrophasor measurements as Parquet files
+// partitioned by date and station, so they can be queried with SQL engines
+// such as DuckDB, Spark or Athena
+package parquetsink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures a Parquet sink
+type Options struct {
+	// Dir is the root of the partitioned archive
+	Dir string
+	// RowGroupRows is the number of rows buffered per row group. Defaults to
+	// one minute of data at the configured data rate.
+	RowGroupRows int
+	// Compression is Uncompressed or Gzip
+	Compression int32
+}
+
+// Sink writes one file per station and UTC day to
+// <Dir>/date=YYYY-MM-DD/station=<name>/part-<time>.parquet. Files are only
+// readable once closed, which happens at the day boundary and on Close.
+// A Sink is not safe for concurrent use.
+type Sink struct {
+	cfg      *synchrophasor.ConfigFrame
+	opts     Options
+	stations []*stationWriter
+}
+
+// stationWriter holds the open file of one station
+type stationWriter struct {
+	pmu      *synchrophasor.PMUStation
+	name     string
+	metadata [][2]string
+	date     string
+	file     *fileWriter
+}
+
+// New creates a sink for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Sink, error) {
+	if opts.RowGroupRows <= 0 {
+		rate := int(cfg.DataRate)
+		if rate <= 0 {
+			rate = 1
+		}
+		opts.RowGroupRows = 60 * rate
+	}
+	if opts.Compression != Uncompressed && opts.Compression != Gzip {
+		return nil, fmt.Errorf("%w: compression %d", synchrophasor.ErrInvalidParameter, opts.Compression)
+	}
+
+	s := &Sink{cfg: cfg, opts: opts}
+	for _, pmu := range cfg.PMUStationList {
+		meta, err := stationMetadata(cfg, pmu)
+		if err != nil {
+			return nil, err
+		}
+		s.stations = append(s.stations, &stationWriter{
+			pmu:      pmu,
+			name:     strings.TrimSpace(pmu.STN),
+			metadata: meta,
+		})
+	}
+	return s, nil
+}
+
+// stationMetadata describes the station's channels as file key/value metadata
+func stationMetadata(cfg *synchrophasor.ConfigFrame, pmu *synchrophasor.PMUStation) ([][2]string, error) {
+	station := *cfg
+	station.NumPMU = 1
+	station.PMUStationList = []*synchrophasor.PMUStation{pmu}
+	config, err := json.Marshal(&station)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][2]string{
+		{"synchrophasor.station", strings.TrimSpace(pmu.STN)},
+		{"synchrophasor.id_code", fmt.Sprint(pmu.IDCode)},
+		{"synchrophasor.config", string(config)},
+	}, nil
+}
+
+// Write appends the values of every station to its partition
+func (s *Sink) Write(m *synchrophasor.Measurements) error {
+	if len(m.Stations) != len(s.stations) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.stations))
+	}
+
+	t := time.Unix(0, m.UnixNano()).UTC()
+	micros := t.UnixMicro()
+	date := t.Format(time.DateOnly)
+
+	for i, sw := range s.stations {
+		if sw.file == nil || sw.date != date {
+			if err := sw.open(s.opts, date, t); err != nil {
+				return err
+			}
+		}
+		if err := sw.append(micros, &m.Stations[i]); err != nil {
+			return err
+		}
+		if sw.file.rows >= s.opts.RowGroupRows {
+			if err := sw.file.flushRowGroup(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close finalizes all open files
+func (s *Sink) Close() error {
+	var errs []error
+	for _, sw := range s.stations {
+		errs = append(errs, sw.close())
+	}
+	return errors.Join(errs...)
+}
+
+// open closes the current file and starts a new one in the partition for date
+func (sw *stationWriter) open(opts Options, date string, t time.Time) error {
+	if err := sw.close(); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(opts.Dir, "date="+date, "station="+partitionValue(sw.name))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	base := filepath.Join(dir, "part-"+t.Format("150405"))
+	name := base + ".parquet"
+	for i := 1; ; i++ {
+		file, err := newFileWriter(name, sw.columns(), opts.Compression, sw.metadata)
+		if err == nil {
+			sw.file = file
+			sw.date = date
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		name = fmt.Sprintf("%s-%d.parquet", base, i)
+	}
+}
+
+// close finalizes the open file, if any
+func (sw *stationWriter) close() error {
+	if sw.file == nil {
+		return nil
+	}
+	err := sw.file.close()
+	sw.file = nil
+	return err
+}
+
+// columns returns the station's schema
+func (sw *stationWriter) columns() []column {
+	pmu := sw.pmu
+	columns := []column{
+		{name: "time", typ: typeInt64, converted: convertedTimestampMicros},
+		{name: "stat", typ: typeInt32, converted: convertedUint16},
+		{name: "freq", typ: typeFloat, converted: -1},
+		{name: "rocof", typ: typeFloat, converted: -1},
+	}
+	for _, name := range pmu.CHNAMPhasor {
+		name = strings.TrimSpace(name)
+		columns = append(columns,
+			column{name: name + "_mag", typ: typeDouble, converted: -1},
+			column{name: name + "_ang", typ: typeDouble, converted: -1})
+	}
+	for _, name := range pmu.CHNAMAnalog {
+		columns = append(columns, column{name: strings.TrimSpace(name), typ: typeFloat, converted: -1})
+	}
+	for word := 0; word < int(pmu.Dgnmr); word++ {
+		for bit := 0; bit < 16; bit++ {
+			name := ""
+			if i := word*16 + bit; i < len(pmu.CHNAMDigital) {
+				name = strings.TrimSpace(pmu.CHNAMDigital[i])
+			}
+			if name == "" {
+				name = fmt.Sprintf("D%d_%d", word, bit)
+			}
+			columns = append(columns, column{name: name, typ: typeBoolean, converted: -1})
+		}
+	}
+	return columns
+}
+
+// append adds a row to the open file
+func (sw *stationWriter) append(micros int64, st *synchrophasor.StationMeasurement) error {
+	cols := sw.file.columns
+	n := 4 + 2*len(st.Phasors) + len(st.Analog)
+	for _, word := range st.Digital {
+		n += len(word)
+	}
+	if n != len(cols) {
+		return fmt.Errorf("%w: station %s row has %d columns, want %d",
+			synchrophasor.ErrInvalidParameter, sw.name, n, len(cols))
+	}
+
+	cols[0].appendInt64(micros)
+	cols[1].appendInt32(int32(st.Stat))
+	cols[2].appendFloat(st.Frequency)
+	cols[3].appendFloat(st.ROCOF)
+	col := 4
+	for _, ph := range st.Phasors {
+		cols[col].appendDouble(cmplx.Abs(ph))
+		cols[col+1].appendDouble(cmplx.Phase(ph) * 180 / math.Pi)
+		col += 2
+	}
+	for _, v := range st.Analog {
+		cols[col].appendFloat(v)
+		col++
+	}
+	for _, word := range st.Digital {
+		for _, bit := range word {
+			cols[col].appendBool(bit)
+			col++
+		}
+	}
+
+	sw.file.rows++
+	return nil
+}
+
+// partitionValue makes a station name safe to use as a directory name
+func partitionValue(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
@@ -0,0 +1,174 @@
+package parquetsink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// tDecoder reads Thrift compact structs into maps keyed by field id
+type tDecoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *tDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *tDecoder) zigzag() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *tDecoder) value(typ byte) interface{} {
+	switch typ {
+	case tcTrue:
+		return true
+	case tcFalse:
+		return false
+	case tcI32, tcI64:
+		return d.zigzag()
+	case tcBinary:
+		n := int(d.uvarint())
+		s := string(d.buf[d.pos : d.pos+n])
+		d.pos += n
+		return s
+	case tcList:
+		header := d.buf[d.pos]
+		d.pos++
+		n, elem := int(header>>4), header&0x0F
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = d.value(elem)
+		}
+		return list
+	case tcStruct:
+		return d.structValue()
+	}
+	panic("unsupported type")
+}
+
+func (d *tDecoder) structValue() map[int16]interface{} {
+	out := map[int16]interface{}{}
+	var last int16
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return out
+		}
+		typ := header & 0x0F
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(d.zigzag())
+		}
+		out[last] = d.value(typ)
+	}
+}
+
+func newTestConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+	for _, name := range []string{"Station A", "Station/B"} {
+		station := synchrophasor.NewPMUStation(name, 1, true, true, true, true)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+		cfg.AddPMUStation(station)
+	}
+	return cfg
+}
+
+func readPage(t *testing.T, data []byte, offset int64, codec int32) []byte {
+	d := &tDecoder{buf: data, pos: int(offset)}
+	header := d.structValue()
+	size := int(header[3].(int64))
+	page := data[d.pos : d.pos+size]
+	if codec == Gzip {
+		zr, err := gzip.NewReader(bytes.NewReader(page))
+		require.NoError(t, err)
+		page, err = io.ReadAll(zr)
+		require.NoError(t, err)
+	}
+	require.Equal(t, header[2].(int64), int64(len(page)))
+	return page
+}
+
+func TestSinkPartitions(t *testing.T) {
+	for _, codec := range []int32{Uncompressed, Gzip} {
+		cfg := newTestConfig()
+		df := synchrophasor.NewDataFrame(cfg)
+		dir := t.TempDir()
+		sink, err := New(cfg, Options{Dir: dir, RowGroupRows: 2, Compression: codec})
+		require.NoError(t, err)
+
+		var m synchrophasor.Measurements
+		// Three rows on one day, one on the next
+		for i, soc := range []uint32{1760572797, 1760572798, 1760572799, 1760572800} {
+			df.SOC = soc
+			cfg.PMUStationList[0].PhasorValues[0] = complex(float64(100+i), 0)
+			cfg.PMUStationList[0].DigitalValues[0][0] = i == 1
+			df.FillMeasurements(&m)
+			require.NoError(t, sink.Write(&m))
+		}
+		require.NoError(t, sink.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "date=*", "station=*", "*.parquet"))
+		require.NoError(t, err)
+		require.Len(t, files, 4)
+		require.FileExists(t, filepath.Join(dir, "date=2025-10-16", "station=Station_B", "part-000000.parquet"))
+
+		data, err := os.ReadFile(filepath.Join(dir, "date=2025-10-15", "station=Station_A", "part-235957.parquet"))
+		require.NoError(t, err)
+		require.Equal(t, "PAR1", string(data[:4]))
+		require.Equal(t, "PAR1", string(data[len(data)-4:]))
+
+		size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+		d := &tDecoder{buf: data[len(data)-8-size : len(data)-8]}
+		meta := d.structValue()
+		require.Equal(t, int64(3), meta[3])
+
+		schema := meta[2].([]interface{})
+		require.Len(t, schema, 1+4+2+1+16)
+		require.Equal(t, "VA_mag", schema[5].(map[int16]interface{})[4])
+		require.Equal(t, int64(convertedTimestampMicros), schema[1].(map[int16]interface{})[6])
+
+		kv := meta[5].([]interface{})
+		require.Equal(t, "Station A", kv[0].(map[int16]interface{})[2])
+		require.Contains(t, kv[2].(map[int16]interface{})[2], `"stn":"Station A"`)
+
+		groups := meta[4].([]interface{})
+		require.Len(t, groups, 2)
+		first := groups[0].(map[int16]interface{})
+		require.Equal(t, int64(2), first[3])
+
+		chunks := first[1].([]interface{})
+		chunkMeta := func(i int) map[int16]interface{} {
+			return chunks[i].(map[int16]interface{})[3].(map[int16]interface{})
+		}
+		require.Equal(t, []interface{}{"VA_mag"}, chunkMeta(4)[3])
+
+		times := readPage(t, data, chunkMeta(0)[9].(int64), codec)
+		require.Equal(t, int64(1760572797000000), int64(binary.LittleEndian.Uint64(times)))
+		mags := readPage(t, data, chunkMeta(4)[9].(int64), codec)
+		require.Equal(t, 101.0, math.Float64frombits(binary.LittleEndian.Uint64(mags[8:])))
+		bits := readPage(t, data, chunkMeta(7)[9].(int64), codec)
+		require.Equal(t, []byte{0b10}, bits)
+	}
+}
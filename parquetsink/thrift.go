@@ -0,0 +1,107 @@
+package parquetsink
+
+import "encoding/binary"
+
+// Parquet metadata is serialized with the Thrift compact protocol. The
+// structures written here are few and flat enough that a tiny encoder is
+// simpler than generated Thrift code.
+
+// Thrift compact protocol type ids
+const (
+	tcTrue   = 1
+	tcFalse  = 2
+	tcI32    = 5
+	tcI64    = 6
+	tcBinary = 8
+	tcList   = 9
+	tcStruct = 12
+)
+
+// tEncoder writes Thrift compact protocol structs
+type tEncoder struct {
+	buf  []byte
+	last []int16 // last field id of each open struct
+}
+
+// begin opens a struct, either the top level one or a struct valued field
+func (e *tEncoder) begin() {
+	e.last = append(e.last, 0)
+}
+
+// end closes the current struct
+func (e *tEncoder) end() {
+	e.buf = append(e.buf, 0)
+	e.last = e.last[:len(e.last)-1]
+}
+
+// field writes a field header
+func (e *tEncoder) field(id int16, typ byte) {
+	last := &e.last[len(e.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.varint(int64(id))
+	}
+	*last = id
+}
+
+// boolField writes a boolean field
+func (e *tEncoder) boolField(id int16, v bool) {
+	if v {
+		e.field(id, tcTrue)
+	} else {
+		e.field(id, tcFalse)
+	}
+}
+
+// i32Field writes an i32 (or enum) field
+func (e *tEncoder) i32Field(id int16, v int32) {
+	e.field(id, tcI32)
+	e.varint(int64(v))
+}
+
+// i64Field writes an i64 field
+func (e *tEncoder) i64Field(id int16, v int64) {
+	e.field(id, tcI64)
+	e.varint(v)
+}
+
+// stringField writes a string field
+func (e *tEncoder) stringField(id int16, v string) {
+	e.field(id, tcBinary)
+	e.writeBinary(v)
+}
+
+// structField opens a struct valued field, closed with end
+func (e *tEncoder) structField(id int16) {
+	e.field(id, tcStruct)
+	e.begin()
+}
+
+// listField writes a list field header; the elements follow
+func (e *tEncoder) listField(id int16, elemType byte, n int) {
+	e.field(id, tcList)
+	if n < 15 {
+		e.buf = append(e.buf, byte(n)<<4|elemType)
+	} else {
+		e.buf = append(e.buf, 0xF0|elemType)
+		e.buf = binary.AppendUvarint(e.buf, uint64(n))
+	}
+}
+
+// writeI32 writes an i32 list element
+func (e *tEncoder) writeI32(v int32) {
+	e.varint(int64(v))
+}
+
+// writeBinary writes a length-prefixed string or list element
+func (e *tEncoder) writeBinary(v string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// varint writes a zigzag encoded integer
+func (e *tEncoder) varint(v int64) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(v<<1)^uint64(v>>63))
+}
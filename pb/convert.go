@@ -0,0 +1,234 @@
+// Package pb provides Protocol Buffers messages for synchrophasor
+// configurations and measurements, and converters to and from the native types
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative synchrophasor.proto service.proto
+//go:generate protoc --go-grpc_out=. --go-grpc_opt=paths=source_relative service.proto
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// FromConfig converts a configuration frame
+func FromConfig(cfg *synchrophasor.ConfigFrame) *Configuration {
+	out := &Configuration{
+		IdCode:   uint32(cfg.IDCode),
+		TimeBase: cfg.TimeBase,
+		DataRate: int32(cfg.DataRate),
+		Stations: make([]*StationConfig, len(cfg.PMUStationList)),
+	}
+
+	for i, pmu := range cfg.PMUStationList {
+		st := &StationConfig{
+			Name:             strings.TrimSpace(pmu.STN),
+			IdCode:           uint32(pmu.IDCode),
+			Format:           uint32(pmu.Format),
+			NominalFrequency: uint32(pmu.GetNominalFrequency()),
+			ConfigCount:      uint32(pmu.CfgCnt),
+			Phasors:          make([]*PhasorChannel, pmu.Phnmr),
+			Analogs:          make([]*AnalogChannel, pmu.Annmr),
+			Digitals:         make([]*DigitalWord, pmu.Dgnmr),
+		}
+
+		for j := range st.Phasors {
+			unit := pmu.Phunit[j]
+			st.Phasors[j] = &PhasorChannel{
+				Name:   pmu.PhasorName(j),
+				Unit:   PhasorUnit(unit >> 24),
+				Factor: unit & 0x0FFFFFF,
+			}
+		}
+
+		for j := range st.Analogs {
+			unit := pmu.Anunit[j]
+			st.Analogs[j] = &AnalogChannel{
+				Name:   pmu.AnalogName(j),
+				Unit:   AnalogUnit(unit >> 24),
+				Factor: unit & 0x0FFFFFF,
+			}
+		}
+
+		for j := range st.Digitals {
+			unit := pmu.Dgunit[j]
+			names := make([]string, 16)
+			for k := range names {
+				names[k] = pmu.DigitalName(j*16 + k)
+			}
+			st.Digitals[j] = &DigitalWord{
+				Names:  names,
+				Normal: unit >> 16,
+				Valid:  unit & 0xFFFF,
+			}
+		}
+
+		out.Stations[i] = st
+	}
+
+	return out
+}
+
+// ToConfig converts a configuration message to a configuration frame
+func ToConfig(c *Configuration) (*synchrophasor.ConfigFrame, error) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = uint16(c.GetIdCode())
+	cfg.TimeBase = c.GetTimeBase()
+	cfg.DataRate = int16(c.GetDataRate())
+
+	for _, st := range c.GetStations() {
+		pmu := synchrophasor.NewPMUStation(st.GetName(), uint16(st.GetIdCode()), false, false, false, false)
+		pmu.Format = uint16(st.GetFormat())
+		pmu.CfgCnt = uint16(st.GetConfigCount())
+
+		switch st.GetNominalFrequency() {
+		case 50:
+			pmu.Fnom = synchrophasor.FreqNom50Hz
+		case 60, 0:
+			pmu.Fnom = synchrophasor.FreqNom60Hz
+		default:
+			return nil, fmt.Errorf("%w: nominal frequency %d Hz", synchrophasor.ErrInvalidParameter, st.GetNominalFrequency())
+		}
+
+		for _, ph := range st.GetPhasors() {
+			pmu.AddPhasor(ph.GetName(), ph.GetFactor(), uint8(ph.GetUnit()))
+		}
+		for _, an := range st.GetAnalogs() {
+			pmu.AddAnalog(an.GetName(), an.GetFactor(), uint8(an.GetUnit()))
+		}
+		for _, dg := range st.GetDigitals() {
+			names := make([]string, 16)
+			copy(names, dg.GetNames())
+			pmu.AddDigital(names, uint16(dg.GetNormal()), uint16(dg.GetValid()))
+		}
+
+		cfg.AddPMUStation(pmu)
+	}
+
+	return cfg, nil
+}
+
+// FromDataFrame converts the values of a data frame
+func FromDataFrame(df *synchrophasor.DataFrame) *MeasurementSet {
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+
+	out := FromMeasurements(&m)
+	out.Soc = df.SOC
+	out.FracSec = df.FracSec
+	return out
+}
+
+// FromMeasurements converts a measurement set. SOC and FRACSEC are left
+// empty since Measurements only carries the combined time.
+func FromMeasurements(m *synchrophasor.Measurements) *MeasurementSet {
+	out := &MeasurementSet{
+		IdCode:   uint32(m.PMUID),
+		Time:     m.Time,
+		Stations: make([]*StationMeasurement, len(m.Stations)),
+	}
+
+	for i := range m.Stations {
+		s := &m.Stations[i]
+		st := &StationMeasurement{
+			IdCode:    uint32(s.StreamID),
+			Stat:      uint32(s.Stat),
+			Phasors:   make([]*Phasor, len(s.Phasors)),
+			Analogs:   append([]float32(nil), s.Analog...),
+			Digitals:  make([]uint32, len(s.Digital)),
+			Frequency: s.Frequency,
+			Rocof:     s.ROCOF,
+		}
+
+		for j, v := range s.Phasors {
+			st.Phasors[j] = &Phasor{Real: real(v), Imag: imag(v)}
+		}
+		for j, word := range s.Digital {
+			for k, bit := range word {
+				if bit {
+					st.Digitals[j] |= 1 << uint(k)
+				}
+			}
+		}
+
+		out.Stations[i] = st
+	}
+
+	return out
+}
+
+// ToMeasurements fills m from a measurement set, reusing the slices of m
+func ToMeasurements(ms *MeasurementSet, m *synchrophasor.Measurements) {
+	m.PMUID = uint16(ms.GetIdCode())
+	m.Time = ms.GetTime()
+
+	stations := ms.GetStations()
+	if cap(m.Stations) < len(stations) {
+		m.Stations = make([]synchrophasor.StationMeasurement, len(stations))
+	}
+	m.Stations = m.Stations[:len(stations)]
+
+	for i, st := range stations {
+		s := &m.Stations[i]
+		s.StreamID = uint16(st.GetIdCode())
+		s.Stat = uint16(st.GetStat())
+		s.Frequency = st.GetFrequency()
+		s.ROCOF = st.GetRocof()
+
+		s.Phasors = s.Phasors[:0]
+		for _, ph := range st.GetPhasors() {
+			s.Phasors = append(s.Phasors, complex(ph.GetReal(), ph.GetImag()))
+		}
+
+		s.Analog = append(s.Analog[:0], st.GetAnalogs()...)
+
+		s.Digital = s.Digital[:0]
+		for _, word := range st.GetDigitals() {
+			bits := make([]bool, 16)
+			for k := range bits {
+				bits[k] = word&(1<<uint(k)) != 0
+			}
+			s.Digital = append(s.Digital, bits)
+		}
+	}
+}
+
+// ToDataFrame sets the station values of cfg from a measurement set and
+// returns a data frame ready to be packed
+func ToDataFrame(ms *MeasurementSet, cfg *synchrophasor.ConfigFrame) (*synchrophasor.DataFrame, error) {
+	stations := ms.GetStations()
+	if len(stations) != len(cfg.PMUStationList) {
+		return nil, fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(stations), len(cfg.PMUStationList))
+	}
+
+	for i, st := range stations {
+		pmu := cfg.PMUStationList[i]
+		if len(st.GetPhasors()) != int(pmu.Phnmr) || len(st.GetAnalogs()) != int(pmu.Annmr) ||
+			len(st.GetDigitals()) != int(pmu.Dgnmr) {
+			return nil, fmt.Errorf("%w: station %d channel counts do not match configuration",
+				synchrophasor.ErrInvalidParameter, pmu.IDCode)
+		}
+
+		pmu.ResetValues()
+		pmu.Stat = uint16(st.GetStat())
+		pmu.Freq = st.GetFrequency()
+		pmu.DFreq = st.GetRocof()
+		for j, ph := range st.GetPhasors() {
+			pmu.PhasorValues[j] = complex(ph.GetReal(), ph.GetImag())
+		}
+		copy(pmu.AnalogValues, st.GetAnalogs())
+		for j, word := range st.GetDigitals() {
+			for k := range pmu.DigitalValues[j] {
+				pmu.DigitalValues[j][k] = word&(1<<uint(k)) != 0
+			}
+		}
+	}
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.IDCode = uint16(ms.GetIdCode())
+	df.SOC = ms.GetSoc()
+	df.FracSec = ms.GetFracSec()
+	return df, nil
+}
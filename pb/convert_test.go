@@ -0,0 +1,85 @@
+package pb
+
+import (
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7734
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+
+	station := synchrophasor.NewPMUStation("Station A", 7734, true, false, true, false)
+	station.AddPhasor("VA", 915527, synchrophasor.PhunitVoltage)
+	station.AddPhasor("IA", 45776, synchrophasor.PhunitCurrent)
+	station.AddAnalog("ANALOG1", 1, synchrophasor.AnunitRMS)
+	names := make([]string, 16)
+	names[0] = "BREAKER 1 STATUS"
+	station.AddDigital(names, 0x0000, 0xFFFF)
+	station.Fnom = synchrophasor.FreqNom50Hz
+	cfg.AddPMUStation(station)
+
+	return cfg
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	cfg := newTestConfig()
+	want, err := cfg.Pack()
+	require.NoError(t, err)
+
+	data, err := proto.Marshal(FromConfig(cfg))
+	require.NoError(t, err)
+	var msg Configuration
+	require.NoError(t, proto.Unmarshal(data, &msg))
+
+	require.Equal(t, uint32(50), msg.GetStations()[0].GetNominalFrequency())
+	require.Equal(t, PhasorUnit_PHASOR_UNIT_CURRENT, msg.GetStations()[0].GetPhasors()[1].GetUnit())
+
+	back, err := ToConfig(&msg)
+	require.NoError(t, err)
+	back.SOC, back.FracSec = cfg.SOC, cfg.FracSec
+	got, err := back.Pack()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func TestMeasurementRoundTrip(t *testing.T) {
+	cfg := newTestConfig()
+	station := cfg.PMUStationList[0]
+	station.PhasorValues[0] = complex(230, -1)
+	station.PhasorValues[1] = complex(10, 2)
+	station.AnalogValues[0] = 1.5
+	station.DigitalValues[0][0] = true
+	station.Freq = 50.01
+	station.DFreq = 0.02
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.IDCode = cfg.IDCode
+	df.SOC = 1760529600
+	df.FracSec = 500000
+	want, err := df.Pack()
+	require.NoError(t, err)
+
+	data, err := proto.Marshal(FromDataFrame(df))
+	require.NoError(t, err)
+	var msg MeasurementSet
+	require.NoError(t, proto.Unmarshal(data, &msg))
+	require.Equal(t, uint32(1), msg.GetStations()[0].GetDigitals()[0])
+
+	var m synchrophasor.Measurements
+	ToMeasurements(&msg, &m)
+	require.InDelta(t, 1760529600.5, m.Time, 1e-6)
+	require.Equal(t, complex(230, -1), m.Stations[0].Phasors[0])
+
+	station.ResetValues()
+	back, err := ToDataFrame(&msg, cfg)
+	require.NoError(t, err)
+	got, err := back.Pack()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
@@ -0,0 +1,193 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net/netip"
+)
+
+// Link layer types
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkLinuxSLL = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// IP protocol numbers
+const (
+	protoTCP = 6
+	protoUDP = 17
+)
+
+// TCP flags
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// segment is the transport payload of a packet
+type segment struct {
+	src, dst netip.AddrPort
+	proto    uint8
+	seq      uint32
+	flags    uint8
+	payload  []byte
+}
+
+// decodePacket strips the link, network and transport headers.
+// It returns false for anything that is not TCP or UDP over IP.
+func decodePacket(linkType uint16, data []byte) (segment, bool) {
+	var etherType uint16
+
+	switch linkType {
+	case linkEthernet:
+		if len(data) < 14 {
+			return segment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		// 802.1Q and 802.1ad VLAN tags
+		for (etherType == 0x8100 || etherType == 0x88A8) && len(data) >= 4 {
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return segment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[0:]), data[20:]
+	case linkNull, linkLoop:
+		if len(data) < 4 {
+			return segment{}, false
+		}
+		data = data[4:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		return segment{}, false
+	}
+
+	if len(data) == 0 {
+		return segment{}, false
+	}
+	if etherType == 0 {
+		// Raw and loopback links: take the IP version from the header
+		switch data[0] >> 4 {
+		case 4:
+			etherType = 0x0800
+		case 6:
+			etherType = 0x86DD
+		}
+	}
+
+	switch etherType {
+	case 0x0800:
+		return decodeIPv4(data)
+	case 0x86DD:
+		return decodeIPv6(data)
+	default:
+		return segment{}, false
+	}
+}
+
+// decodeIPv4 parses an IPv4 header. Fragments other than the first are ignored.
+func decodeIPv4(data []byte) (segment, bool) {
+	if len(data) < 20 || data[0]>>4 != 4 {
+		return segment{}, false
+	}
+	ihl := int(data[0]&0x0F) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	if ihl < 20 || total < ihl || total > len(data) {
+		// Tolerate captures whose total length field is not trustworthy (TSO)
+		if ihl < 20 || ihl > len(data) {
+			return segment{}, false
+		}
+		total = len(data)
+	}
+	if binary.BigEndian.Uint16(data[6:])&0x1FFF != 0 {
+		return segment{}, false
+	}
+
+	src, _ := netip.AddrFromSlice(data[12:16])
+	dst, _ := netip.AddrFromSlice(data[16:20])
+	return decodeTransport(data[9], src, dst, data[ihl:total])
+}
+
+// decodeIPv6 parses an IPv6 header and skips common extension headers
+func decodeIPv6(data []byte) (segment, bool) {
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return segment{}, false
+	}
+	length := int(binary.BigEndian.Uint16(data[4:]))
+	next := data[6]
+	src, _ := netip.AddrFromSlice(data[8:24])
+	dst, _ := netip.AddrFromSlice(data[24:40])
+
+	payload := data[40:]
+	if length > 0 && length <= len(payload) {
+		payload = payload[:length]
+	}
+
+	// Hop-by-hop, routing and destination options
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			return segment{}, false
+		}
+		size := (int(payload[1]) + 1) * 8
+		if size > len(payload) {
+			return segment{}, false
+		}
+		next, payload = payload[0], payload[size:]
+	}
+
+	return decodeTransport(next, src, dst, payload)
+}
+
+// decodeTransport parses a TCP or UDP header
+func decodeTransport(proto uint8, src, dst netip.Addr, data []byte) (segment, bool) {
+	switch proto {
+	case protoTCP:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+		offset := int(data[12]>>4) * 4
+		if offset < 20 || offset > len(data) {
+			return segment{}, false
+		}
+		return segment{
+			src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(data[0:])),
+			dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			proto:   protoTCP,
+			seq:     binary.BigEndian.Uint32(data[4:]),
+			flags:   data[13],
+			payload: data[offset:],
+		}, true
+
+	case protoUDP:
+		if len(data) < 8 {
+			return segment{}, false
+		}
+		payload := data[8:]
+		if length := int(binary.BigEndian.Uint16(data[4:])); length >= 8 && length-8 <= len(payload) {
+			payload = payload[:length-8]
+		}
+		return segment{
+			src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(data[0:])),
+			dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			proto:   protoUDP,
+			payload: payload,
+		}, true
+
+	default:
+		return segment{}, false
+	}
+}
@@ -0,0 +1,27 @@
+package pcap
+
+import "errors"
+
+// ErrLiveUnsupported is returned by live captures on platforms without
+// packet sockets
+var ErrLiveUnsupported = errors.New("live capture not supported on this platform")
+
+// NewLiveReader captures the C37.118 frames of a network interface, or of
+// all interfaces if iface is empty or "any". It needs the CAP_NET_RAW
+// capability and yields frames until Close is called.
+func NewLiveReader(iface string, opts Options) (*Reader, error) {
+	src, err := openLive(iface)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(src, opts), nil
+}
+
+// NewLiveDecoder decodes the frames captured on a network interface
+func NewLiveDecoder(iface string, opts Options) (*Decoder, error) {
+	reader, err := NewLiveReader(iface, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(reader), nil
+}
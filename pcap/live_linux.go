@@ -0,0 +1,105 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// liveSource reads packets from an AF_PACKET socket
+type liveSource struct {
+	file *os.File
+	conn syscall.RawConn
+	// loopback holds the indexes of loopback interfaces, whose packets are
+	// seen both outgoing and incoming
+	loopback map[int]bool
+	buf      []byte
+}
+
+// htons converts a short to network byte order
+func htons(v uint16) uint16 {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return binary.NativeEndian.Uint16(b[:])
+}
+
+// openLive opens a cooked packet socket, which strips the link layer
+// headers, bound to iface
+func openLive(iface string) (*liveSource, error) {
+	index := 0
+	if iface != "" && iface != "any" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return nil, err
+		}
+		index = ifi.Index
+	}
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	loopback := make(map[int]bool)
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			loopback[ifi.Index] = true
+		}
+	}
+
+	proto := htons(syscall.ETH_P_ALL)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, int(proto))
+	if err != nil {
+		return nil, fmt.Errorf("open packet socket: %w", err)
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: index}); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("bind packet socket to %s: %w", iface, err)
+	}
+
+	// A non-blocking descriptor is served by the runtime poller, so Close
+	// wakes up a pending read
+	file := os.NewFile(uintptr(fd), "packet:"+iface)
+	conn, err := file.SyscallConn()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &liveSource{file: file, conn: conn, loopback: loopback, buf: make([]byte, 65536)}, nil
+}
+
+// next reads the next IP packet, or io.EOF once the source is closed
+func (l *liveSource) next() (*packet, error) {
+	for {
+		var n int
+		var from syscall.Sockaddr
+		var readErr error
+		err := l.conn.Read(func(fd uintptr) bool {
+			n, from, readErr = syscall.Recvfrom(int(fd), l.buf, 0)
+			return readErr != syscall.EAGAIN
+		})
+		if err != nil {
+			return nil, io.EOF
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		sll, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok || (sll.Pkttype == syscall.PACKET_OUTGOING && l.loopback[sll.Ifindex]) {
+			continue
+		}
+		if sll.Protocol != htons(0x0800) && sll.Protocol != htons(0x86DD) {
+			continue
+		}
+		data := append([]byte(nil), l.buf[:n]...)
+		return &packet{time: time.Now().UTC(), linkType: linkRaw, data: data}, nil
+	}
+}
+
+// Close closes the socket
+func (l *liveSource) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package pcap
+
+// liveSource is not available without packet sockets
+type liveSource struct{}
+
+// openLive fails on platforms without packet sockets
+func openLive(string) (*liveSource, error) {
+	return nil, ErrLiveUnsupported
+}
+
+// next is never called
+func (*liveSource) next() (*packet, error) {
+	return nil, ErrLiveUnsupported
+}
@@ -0,0 +1,255 @@
+// Package pcap reads pcap and pcapng captures, reassembles the TCP streams and
+// UDP datagrams on the C37.118 ports and yields the frames they carry together
+// with their capture timestamps
+package pcap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"time"
+)
+
+// Capture file magic numbers
+const (
+	magicMicros = 0xA1B2C3D4
+	magicNanos  = 0xA1B23C4D
+	magicNG     = 0x0A0D0D0A
+
+	byteOrderMagic = 0x1A2B3C4D
+)
+
+// pcapng block types
+const (
+	blockInterface      = 0x00000001
+	blockPacket         = 0x00000002
+	blockSimplePacket   = 0x00000003
+	blockEnhancedPacket = 0x00000006
+	blockSectionHeader  = magicNG
+)
+
+// ErrInvalidCapture is returned for files that are not pcap or pcapng captures
+var ErrInvalidCapture = errors.New("invalid capture file")
+
+// packet is a captured link layer packet
+type packet struct {
+	time     time.Time
+	linkType uint16
+	data     []byte
+}
+
+// packetSource reads packets from a capture file
+type packetSource interface {
+	next() (*packet, error)
+}
+
+// openCapture detects the capture format and returns a packet source
+func openCapture(r io.Reader) (packetSource, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCapture, err)
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(head) == magicNG:
+		return &ngReader{r: br}, nil
+	default:
+		return newPcapReader(br)
+	}
+}
+
+// pcapReader reads the classic libpcap format
+type pcapReader struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint16
+	header   [16]byte
+}
+
+// newPcapReader reads the global header
+func newPcapReader(r *bufio.Reader) (*pcapReader, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCapture, err)
+	}
+
+	p := &pcapReader{r: r}
+	switch {
+	case binary.LittleEndian.Uint32(header[:]) == magicMicros:
+		p.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[:]) == magicMicros:
+		p.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[:]) == magicNanos:
+		p.order, p.nanos = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header[:]) == magicNanos:
+		p.order, p.nanos = binary.BigEndian, true
+	default:
+		return nil, ErrInvalidCapture
+	}
+	p.linkType = uint16(p.order.Uint32(header[20:]))
+
+	return p, nil
+}
+
+// next reads the next packet record
+func (p *pcapReader) next() (*packet, error) {
+	if _, err := io.ReadFull(p.r, p.header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: truncated record header", ErrInvalidCapture)
+		}
+		return nil, err
+	}
+
+	sec := int64(p.order.Uint32(p.header[0:]))
+	frac := int64(p.order.Uint32(p.header[4:]))
+	if !p.nanos {
+		frac *= 1000
+	}
+	data := make([]byte, p.order.Uint32(p.header[8:]))
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return nil, fmt.Errorf("%w: truncated packet", ErrInvalidCapture)
+	}
+
+	return &packet{time: time.Unix(sec, frac).UTC(), linkType: p.linkType, data: data}, nil
+}
+
+// ngInterface is an interface description of a pcapng section
+type ngInterface struct {
+	linkType uint16
+	tsPerSec uint64 // timestamp ticks per second
+}
+
+// ngReader reads the pcapng format
+type ngReader struct {
+	r          *bufio.Reader
+	order      binary.ByteOrder
+	interfaces []ngInterface
+}
+
+// next reads blocks until the next packet block
+func (n *ngReader) next() (*packet, error) {
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(n.r, header[:]); err != nil {
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, fmt.Errorf("%w: truncated block header", ErrInvalidCapture)
+			}
+			return nil, err
+		}
+
+		// The section header defines the byte order of everything that follows
+		if binary.LittleEndian.Uint32(header[:]) == blockSectionHeader {
+			var bom [4]byte
+			if _, err := io.ReadFull(n.r, bom[:]); err != nil {
+				return nil, fmt.Errorf("%w: truncated section header", ErrInvalidCapture)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom[:]) == byteOrderMagic:
+				n.order = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom[:]) == byteOrderMagic:
+				n.order = binary.BigEndian
+			default:
+				return nil, ErrInvalidCapture
+			}
+			n.interfaces = n.interfaces[:0]
+			if err := n.skip(int(n.order.Uint32(header[4:])) - 12); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if n.order == nil {
+			return nil, ErrInvalidCapture
+		}
+
+		blockType := n.order.Uint32(header[:])
+		length := int(n.order.Uint32(header[4:]))
+		if length < 12 || length%4 != 0 {
+			return nil, fmt.Errorf("%w: block length %d", ErrInvalidCapture, length)
+		}
+		body := make([]byte, length-12)
+		if _, err := io.ReadFull(n.r, body); err != nil {
+			return nil, fmt.Errorf("%w: truncated block", ErrInvalidCapture)
+		}
+		if err := n.skip(4); err != nil {
+			return nil, err
+		}
+
+		switch blockType {
+		case blockInterface:
+			n.interfaces = append(n.interfaces, n.parseInterface(body))
+		case blockEnhancedPacket:
+			return n.parsePacket(body, n.order.Uint32(body[0:]), 4, 20)
+		case blockPacket:
+			return n.parsePacket(body, uint32(n.order.Uint16(body[0:])), 4, 20)
+		case blockSimplePacket:
+			if len(n.interfaces) == 0 || len(body) < 4 {
+				return nil, ErrInvalidCapture
+			}
+			length := min(int(n.order.Uint32(body)), len(body)-4)
+			return &packet{linkType: n.interfaces[0].linkType, data: body[4 : 4+length]}, nil
+		}
+	}
+}
+
+// parseInterface reads the link type and timestamp resolution of an interface
+func (n *ngReader) parseInterface(body []byte) ngInterface {
+	iface := ngInterface{linkType: n.order.Uint16(body), tsPerSec: 1e6}
+
+	// Options follow the fixed 8 byte part
+	for opts := body[8:]; len(opts) >= 4; {
+		code, size := n.order.Uint16(opts), int(n.order.Uint16(opts[2:]))
+		if code == 0 || 4+size > len(opts) {
+			break
+		}
+		if code == 9 && size >= 1 {
+			res := opts[4]
+			iface.tsPerSec = 1
+			if res&0x80 != 0 {
+				iface.tsPerSec <<= min(res&0x7F, 63)
+			} else {
+				for i := byte(0); i < min(res, 19); i++ {
+					iface.tsPerSec *= 10
+				}
+			}
+		}
+		opts = opts[4+(size+3)/4*4:]
+	}
+	return iface
+}
+
+// parsePacket reads an enhanced or obsolete packet block
+func (n *ngReader) parsePacket(body []byte, ifaceID uint32, tsAt, dataAt int) (*packet, error) {
+	if len(body) < dataAt || int(ifaceID) >= len(n.interfaces) {
+		return nil, ErrInvalidCapture
+	}
+	iface := n.interfaces[ifaceID]
+
+	ts := uint64(n.order.Uint32(body[tsAt:]))<<32 | uint64(n.order.Uint32(body[tsAt+4:]))
+	capLen := int(n.order.Uint32(body[tsAt+8:]))
+	if dataAt+capLen > len(body) {
+		return nil, fmt.Errorf("%w: packet exceeds block", ErrInvalidCapture)
+	}
+
+	sec, frac := ts/iface.tsPerSec, ts%iface.tsPerSec
+	hi, lo := bits.Mul64(frac, 1e9)
+	nanos, _ := bits.Div64(hi, lo, iface.tsPerSec)
+	t := time.Unix(int64(sec), int64(nanos)).UTC()
+
+	return &packet{time: t, linkType: iface.linkType, data: body[dataAt : dataAt+capLen]}, nil
+}
+
+// skip discards n bytes
+func (n *ngReader) skip(count int) error {
+	if count < 0 {
+		return ErrInvalidCapture
+	}
+	if _, err := n.r.Discard(count); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCapture, err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net/netip"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// DefaultPorts are the IANA ports for C37.118 over TCP and UDP
+var DefaultPorts = []uint16{4712, 4713}
+
+// maxPendingSegments bounds the out-of-order segments buffered per stream
+const maxPendingSegments = 256
+
+// Frame is a C37.118 frame found in a capture
+type Frame struct {
+	// Time is the capture timestamp of the packet completing the frame
+	Time time.Time
+	Src  netip.AddrPort
+	Dst  netip.AddrPort
+	// Transport is "tcp" or "udp"
+	Transport string
+	// Data holds the raw frame including SYNC and CHK
+	Data []byte
+}
+
+// Options configures a reader
+type Options struct {
+	// Ports selects the TCP and UDP ports carrying C37.118, on either side of
+	// the connection. Defaults to DefaultPorts.
+	Ports []uint16
+}
+
+// streamKey identifies one direction of a TCP connection
+type streamKey struct {
+	src, dst netip.AddrPort
+}
+
+// tcpStream reassembles one direction of a TCP connection
+type tcpStream struct {
+	started bool
+	next    uint32
+	buf     []byte
+	pending map[uint32][]byte
+}
+
+// Reader yields the C37.118 frames of a capture in capture order
+type Reader struct {
+	src     packetSource
+	ports   map[uint16]bool
+	streams map[streamKey]*tcpStream
+	queue   []*Frame
+}
+
+// NewReader creates a reader for a pcap or pcapng capture
+func NewReader(r io.Reader, opts Options) (*Reader, error) {
+	src, err := openCapture(r)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(src, opts), nil
+}
+
+// newReader creates a reader for the packets of src
+func newReader(src packetSource, opts Options) *Reader {
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = DefaultPorts
+	}
+	reader := &Reader{
+		src:     src,
+		ports:   make(map[uint16]bool, len(ports)),
+		streams: make(map[streamKey]*tcpStream),
+	}
+	for _, port := range ports {
+		reader.ports[port] = true
+	}
+	return reader
+}
+
+// Close stops a live capture. It is a no-op for capture files, which are
+// closed by the caller.
+func (r *Reader) Close() error {
+	if c, ok := r.src.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Next returns the next frame, or io.EOF at the end of the capture
+func (r *Reader) Next() (*Frame, error) {
+	for len(r.queue) == 0 {
+		pkt, err := r.src.next()
+		if err != nil {
+			return nil, err
+		}
+
+		seg, ok := decodePacket(pkt.linkType, pkt.data)
+		if !ok || !(r.ports[seg.src.Port()] || r.ports[seg.dst.Port()]) {
+			continue
+		}
+
+		if seg.proto == protoUDP {
+			r.extract(pkt.time, seg, "udp", seg.payload)
+		} else {
+			r.reassemble(pkt.time, seg)
+		}
+	}
+
+	frame := r.queue[0]
+	r.queue = r.queue[1:]
+	return frame, nil
+}
+
+// reassemble adds a TCP segment to its stream and extracts completed frames
+func (r *Reader) reassemble(t time.Time, seg segment) {
+	key := streamKey{seg.src, seg.dst}
+	stream := r.streams[key]
+	if stream == nil || seg.flags&tcpSYN != 0 {
+		stream = &tcpStream{pending: make(map[uint32][]byte)}
+		r.streams[key] = stream
+	}
+
+	if seg.flags&tcpSYN != 0 {
+		stream.started = true
+		stream.next = seg.seq + 1
+	} else if !stream.started {
+		// Capture started mid-connection: resynchronize on the SYNC byte later
+		stream.started = true
+		stream.next = seg.seq
+	}
+
+	if len(seg.payload) > 0 {
+		stream.add(seg.seq, seg.payload)
+		stream.buf = r.extract(t, seg, "tcp", stream.buf)
+	}
+
+	if seg.flags&(tcpFIN|tcpRST) != 0 {
+		delete(r.streams, key)
+	}
+}
+
+// add places payload at seq, buffering segments that arrive out of order
+func (s *tcpStream) add(seq uint32, payload []byte) {
+	diff := int32(seq - s.next)
+	switch {
+	case diff > 0:
+		if len(s.pending) < maxPendingSegments {
+			s.pending[seq] = append([]byte(nil), payload...)
+		}
+		return
+	case diff < 0:
+		// Retransmission overlapping data already seen
+		if -int(diff) >= len(payload) {
+			return
+		}
+		payload = payload[-diff:]
+	}
+
+	s.buf = append(s.buf, payload...)
+	s.next += uint32(len(payload))
+
+	for len(s.pending) > 0 {
+		data, ok := s.pending[s.next]
+		if !ok {
+			break
+		}
+		delete(s.pending, s.next)
+		s.buf = append(s.buf, data...)
+		s.next += uint32(len(data))
+	}
+}
+
+// extract queues the complete frames at the start of buf and returns the rest
+func (r *Reader) extract(t time.Time, seg segment, transport string, buf []byte) []byte {
+	for {
+		// Resynchronize on the SYNC byte after gaps or garbage
+		start := 0
+		for start < len(buf) && buf[start] != synchrophasor.SyncAA {
+			start++
+		}
+		buf = buf[start:]
+		if len(buf) < 4 {
+			break
+		}
+
+		size := int(binary.BigEndian.Uint16(buf[2:]))
+		if size < 4 {
+			buf = buf[1:]
+			continue
+		}
+		if len(buf) < size {
+			break
+		}
+
+		r.queue = append(r.queue, &Frame{
+			Time:      t,
+			Src:       seg.src,
+			Dst:       seg.dst,
+			Transport: transport,
+			Data:      append([]byte(nil), buf[:size]...),
+		})
+		buf = buf[size:]
+	}
+
+	if len(buf) == 0 {
+		return buf[:0]
+	}
+	return append([]byte(nil), buf...)
+}
+
+// Decoded is a frame together with its decoded form
+type Decoded struct {
+	*Frame
+	// Value is the frame returned by synchrophasor.UnpackFrame, nil if decoding
+	// failed. Data frame values are held by the stream's configuration frame and
+	// are only valid until the next call to Next.
+	Value interface{}
+	// Err is the decoding error, e.g. a CRC failure or a data frame seen
+	// before any configuration frame of its stream
+	Err error
+}
+
+// Decoder decodes the frames of a capture, remembering the latest
+// configuration frame of every stream to decode its data frames
+type Decoder struct {
+	r       *Reader
+	configs map[netip.AddrPort]*synchrophasor.ConfigFrame
+	byID    map[uint16]*synchrophasor.ConfigFrame
+}
+
+// NewDecoder creates a decoder for a pcap or pcapng capture
+func NewDecoder(r io.Reader, opts Options) (*Decoder, error) {
+	reader, err := NewReader(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newDecoder(reader), nil
+}
+
+// newDecoder creates a decoder for the frames of r
+func newDecoder(r *Reader) *Decoder {
+	return &Decoder{
+		r:       r,
+		configs: make(map[netip.AddrPort]*synchrophasor.ConfigFrame),
+		byID:    make(map[uint16]*synchrophasor.ConfigFrame),
+	}
+}
+
+// Close stops a live capture
+func (d *Decoder) Close() error {
+	return d.r.Close()
+}
+
+// Next returns the next decoded frame, or io.EOF at the end of the capture.
+// Frames that fail to decode are returned with Err set rather than as an error.
+func (d *Decoder) Next() (*Decoded, error) {
+	frame, err := d.r.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	// Data frames are decoded with the configuration sent by the same PMU,
+	// falling back to a configuration with the same ID code
+	cfg := d.configs[frame.Src]
+	if cfg == nil && len(frame.Data) >= 6 {
+		cfg = d.byID[binary.BigEndian.Uint16(frame.Data[4:])]
+	}
+
+	value, err := synchrophasor.UnpackFrame(frame.Data, cfg)
+	if err != nil {
+		value = nil
+	}
+
+	switch c := value.(type) {
+	case *synchrophasor.ConfigFrame:
+		d.configs[frame.Src] = c
+		d.byID[c.IDCode] = c
+	case *synchrophasor.Config1Frame:
+		d.configs[frame.Src] = &c.ConfigFrame
+		d.byID[c.IDCode] = &c.ConfigFrame
+	}
+
+	return &Decoded{Frame: frame, Value: value, Err: err}, nil
+}
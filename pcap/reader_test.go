@@ -0,0 +1,305 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pmuAddr = netip.MustParseAddrPort("10.0.0.1:4712")
+	pdcAddr = netip.MustParseAddrPort("10.0.0.2:50000")
+)
+
+// ethernetTCP builds an Ethernet/IPv4/TCP packet
+func ethernetTCP(src, dst netip.AddrPort, seq uint32, flags byte, payload []byte) []byte {
+	pkt := make([]byte, 14, 54+len(payload))
+	binary.BigEndian.PutUint16(pkt[12:], 0x0800)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(40+len(payload)))
+	ip[8] = 64
+	ip[9] = protoTCP
+	copy(ip[12:], src.Addr().AsSlice())
+	copy(ip[16:], dst.Addr().AsSlice())
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], src.Port())
+	binary.BigEndian.PutUint16(tcp[2:], dst.Port())
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+
+	pkt = append(pkt, ip...)
+	pkt = append(pkt, tcp...)
+	return append(pkt, payload...)
+}
+
+// writePcap writes packets to a little-endian microsecond pcap file
+func writePcap(packets [][]byte, start time.Time) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], magicMicros)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkEthernet)
+	buf.Write(header)
+
+	for i, pkt := range packets {
+		t := start.Add(time.Duration(i) * time.Millisecond)
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+		binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(pkt)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(pkt)))
+		buf.Write(record)
+		buf.Write(pkt)
+	}
+	return buf.Bytes()
+}
+
+// writePcapNG writes packets as enhanced packet blocks with nanosecond timestamps
+func writePcapNG(packets [][]byte, start time.Time) []byte {
+	var buf bytes.Buffer
+	block := func(typ uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		b := binary.LittleEndian.AppendUint32(nil, typ)
+		b = binary.LittleEndian.AppendUint32(b, uint32(12+len(body)))
+		b = append(b, body...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(12+len(body)))
+		buf.Write(b)
+	}
+
+	shb := binary.LittleEndian.AppendUint32(nil, byteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1)
+	shb = binary.LittleEndian.AppendUint16(shb, 0)
+	shb = binary.LittleEndian.AppendUint64(shb, 0xFFFFFFFFFFFFFFFF)
+	block(blockSectionHeader, shb)
+
+	idb := binary.LittleEndian.AppendUint16(nil, linkEthernet)
+	idb = binary.LittleEndian.AppendUint16(idb, 0)
+	idb = binary.LittleEndian.AppendUint32(idb, 65535)
+	idb = append(idb, 9, 0, 1, 0, 9, 0, 0, 0) // if_tsresol = 9
+	idb = append(idb, 0, 0, 0, 0)             // opt_endofopt
+	block(blockInterface, idb)
+
+	for i, pkt := range packets {
+		ts := uint64(start.Add(time.Duration(i) * time.Millisecond).UnixNano())
+		epb := binary.LittleEndian.AppendUint32(nil, 0)
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(len(pkt)))
+		epb = binary.LittleEndian.AppendUint32(epb, uint32(len(pkt)))
+		block(blockEnhancedPacket, append(epb, pkt...))
+	}
+	return buf.Bytes()
+}
+
+// testStream returns packets carrying a configuration frame and two data
+// frames, split across segments and with one segment out of order
+func testStream(t *testing.T) [][]byte {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7734
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Station A", 7734, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	cfg.AddPMUStation(station)
+
+	cfgData, err := cfg.Pack()
+	require.NoError(t, err)
+
+	var stream []byte
+	stream = append(stream, cfgData...)
+	for i := 0; i < 2; i++ {
+		station.PhasorValues[0] = complex(float64(100+i), 0)
+		df := synchrophasor.NewDataFrame(cfg)
+		df.IDCode = cfg.IDCode
+		data, err := df.Pack()
+		require.NoError(t, err)
+		stream = append(stream, data...)
+	}
+
+	seq := uint32(1000)
+	cut1, cut2 := len(cfgData)/2, len(cfgData)+10
+	return [][]byte{
+		ethernetTCP(pdcAddr, pmuAddr, 1, tcpSYN, nil),
+		ethernetTCP(pmuAddr, pdcAddr, seq, tcpSYN, nil),
+		ethernetTCP(pmuAddr, pdcAddr, seq+1, 0, stream[:cut1]),
+		// Out of order, then a retransmission of the first segment
+		ethernetTCP(pmuAddr, pdcAddr, seq+1+uint32(cut2), 0, stream[cut2:]),
+		ethernetTCP(pmuAddr, pdcAddr, seq+1, 0, stream[:cut1]),
+		ethernetTCP(pmuAddr, pdcAddr, seq+1+uint32(cut1), 0, stream[cut1:cut2]),
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	start := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	packets := testStream(t)
+
+	for name, capture := range map[string][]byte{
+		"pcap":   writePcap(packets, start),
+		"pcapng": writePcapNG(packets, start),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dec, err := NewDecoder(bytes.NewReader(capture), Options{})
+			require.NoError(t, err)
+
+			first, err := dec.Next()
+			require.NoError(t, err)
+			require.NoError(t, first.Err)
+			require.IsType(t, &synchrophasor.ConfigFrame{}, first.Value)
+			require.Equal(t, "tcp", first.Transport)
+			require.Equal(t, pmuAddr, first.Src)
+			require.Equal(t, start.Add(5*time.Millisecond), first.Time)
+
+			for i := 0; i < 2; i++ {
+				frame, err := dec.Next()
+				require.NoError(t, err)
+				require.NoError(t, frame.Err)
+				df, ok := frame.Value.(*synchrophasor.DataFrame)
+				require.True(t, ok)
+				require.InDelta(t, 100+i, real(df.AssociatedConfig.PMUStationList[0].PhasorValues[0]), 1e-3)
+			}
+
+			_, err = dec.Next()
+			require.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+func TestReaderInvalid(t *testing.T) {
+	_, err := NewReader(bytes.NewReader([]byte("not a capture file at all")), Options{})
+	require.ErrorIs(t, err, ErrInvalidCapture)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	var capture bytes.Buffer
+	w, err := NewWriter(&capture)
+	require.NoError(t, err)
+
+	pmu := synchrophasor.NewPMU()
+	station := synchrophasor.NewPMUStation("Station A", 7734, false, true, false, false)
+	station.AddPhasor("VA", 915527, synchrophasor.PhunitVoltage)
+	pmu.Config2.AddPMUStation(station)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(w.Listener(l))
+	}()
+
+	pdc := synchrophasor.NewPDC(1)
+	require.NoError(t, pdc.Connect(l.Addr().String()))
+	_, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+	_, err = pdc.GetConfig(1)
+	require.NoError(t, err)
+	pdc.Disconnect()
+
+	// The server side is done recording once the client is removed
+	require.Eventually(t, func() bool {
+		pmu.ClientsMutex.Lock()
+		defer pmu.ClientsMutex.Unlock()
+		return len(pmu.Clients) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	pmu.Stop()
+
+	port := l.Addr().(*net.TCPAddr).AddrPort().Port()
+	dec, err := NewDecoder(bytes.NewReader(capture.Bytes()), Options{Ports: []uint16{port}})
+	require.NoError(t, err)
+
+	var commands, configs int
+	for {
+		frame, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, frame.Err)
+		require.True(t, frame.Src.Addr().IsLoopback())
+		switch frame.Value.(type) {
+		case *synchrophasor.CommandFrame:
+			commands++
+		case *synchrophasor.ConfigFrame, *synchrophasor.Config1Frame:
+			configs++
+		}
+	}
+	require.Equal(t, 2, commands)
+	require.Equal(t, 2, configs)
+}
+
+func TestWriterSyntheticAddresses(t *testing.T) {
+	var capture bytes.Buffer
+	w, err := NewWriter(&capture)
+	require.NoError(t, err)
+
+	server, client := net.Pipe()
+	client = w.Conn(client)
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+
+	cmd := synchrophasor.NewCommandFrame()
+	cmd.IDCode = 1
+	cmd.CMD = synchrophasor.CmdStart
+	_, err = cmd.PackTo(client)
+	require.NoError(t, err)
+	require.NoError(t, client.Close())
+
+	r, err := NewReader(bytes.NewReader(capture.Bytes()), Options{})
+	require.NoError(t, err)
+	frame, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, netip.AddrPortFrom(syntheticPMU, 4712), frame.Dst)
+	require.Equal(t, syntheticPDC, frame.Src.Addr())
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestLiveDecoder(t *testing.T) {
+	d, err := NewLiveDecoder("lo", Options{Ports: []uint16{47120}})
+	if errors.Is(err, ErrLiveUnsupported) || errors.Is(err, syscall.EPERM) {
+		t.Skipf("live capture unavailable: %v", err)
+	}
+	require.NoError(t, err)
+
+	conn, err := net.Dial("udp", "127.0.0.1:47120")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	cmd := synchrophasor.NewCommandFrame()
+	cmd.IDCode = 9
+	cmd.CMD = synchrophasor.CmdCfg2
+	data, err := cmd.Pack()
+	require.NoError(t, err)
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+
+	frame, err := d.Next()
+	require.NoError(t, err)
+	require.NoError(t, frame.Err)
+	require.Equal(t, "udp", frame.Transport)
+	require.Equal(t, uint16(47120), frame.Dst.Port())
+	require.Equal(t, data, frame.Data)
+
+	// Close wakes up a pending read
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = d.Close()
+	}()
+	_, err = d.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
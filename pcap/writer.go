@@ -0,0 +1,254 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// maxSegment is the largest TCP payload written into a single packet
+const maxSegment = 65535 - 60 - 20
+
+// Synthetic endpoints for connections without IP addresses, e.g. net.Pipe
+var (
+	syntheticPMU = netip.MustParseAddr("192.0.2.1")
+	syntheticPDC = netip.MustParseAddr("192.0.2.2")
+)
+
+// Writer writes packets to a pcap capture with nanosecond timestamps and raw
+// IP link type. It is safe for concurrent use by multiple connections.
+type Writer struct {
+	mu       sync.Mutex
+	w        io.Writer
+	buf      []byte
+	nextPort uint16
+}
+
+// NewWriter creates a writer and writes the capture file header
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw := &Writer{w: w, nextPort: 49152}
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], magicNanos)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkRaw)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Conn wraps a client connection, e.g. the Socket of a synchrophasor.PDC, so
+// that everything it sends and receives is recorded
+func (w *Writer) Conn(conn net.Conn) net.Conn {
+	return w.wrap(conn, false)
+}
+
+// Listener wraps a server listener, e.g. the one passed to
+// synchrophasor.PMU.Serve, so that the traffic of every accepted connection is
+// recorded. Wrap the TLS listener rather than the TCP one to record plaintext.
+func (w *Writer) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, w: w}
+}
+
+// listener records the connections it accepts
+type listener struct {
+	net.Listener
+	w *Writer
+}
+
+// Accept waits for and wraps the next connection
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.w.wrap(conn, true), nil
+}
+
+// conn records a connection as a synthetic TCP stream
+type conn struct {
+	net.Conn
+	w *Writer
+	// local and remote endpoints with their next sequence numbers
+	local, remote       netip.AddrPort
+	localSeq, remoteSeq uint32
+	closeOnce           sync.Once
+}
+
+// wrap records the handshake of conn and returns the recording connection
+func (w *Writer) wrap(nc net.Conn, server bool) net.Conn {
+	c := &conn{Conn: nc, w: w, localSeq: 1000, remoteSeq: 5000}
+	c.local, c.remote = endpoint(nc.LocalAddr()), endpoint(nc.RemoteAddr())
+
+	w.mu.Lock()
+	if !c.local.IsValid() || !c.remote.IsValid() || c.local.Addr().Is4() != c.remote.Addr().Is4() {
+		port := w.nextPort
+		w.nextPort++
+		if w.nextPort == 0 {
+			w.nextPort = 49152
+		}
+		pmu, pdc := netip.AddrPortFrom(syntheticPMU, DefaultPorts[0]), netip.AddrPortFrom(syntheticPDC, port)
+		if server {
+			c.local, c.remote = pmu, pdc
+		} else {
+			c.local, c.remote = pdc, pmu
+		}
+	}
+	w.mu.Unlock()
+
+	// Three-way handshake initiated by the client side
+	if server {
+		c.record(false, tcpSYN, nil)
+		c.record(true, tcpSYN|tcpACK, nil)
+		c.record(false, tcpACK, nil)
+	} else {
+		c.record(true, tcpSYN, nil)
+		c.record(false, tcpSYN|tcpACK, nil)
+		c.record(true, tcpACK, nil)
+	}
+	return c
+}
+
+// endpoint converts a TCP or UDP address, returning an invalid AddrPort otherwise
+func endpoint(addr net.Addr) netip.AddrPort {
+	var ap netip.AddrPort
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ap = a.AddrPort()
+	case *net.UDPAddr:
+		ap = a.AddrPort()
+	default:
+		return ap
+	}
+	return netip.AddrPortFrom(ap.Addr().Unmap(), ap.Port())
+}
+
+// Read reads from the connection and records the received bytes
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.record(false, tcpPSH|tcpACK, b[:n])
+	}
+	return n, err
+}
+
+// Write writes to the connection and records the bytes sent
+func (c *conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.record(true, tcpPSH|tcpACK, b[:n])
+	}
+	return n, err
+}
+
+// Close closes the connection and records a FIN
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.record(true, tcpFIN|tcpACK, nil)
+	})
+	return c.Conn.Close()
+}
+
+// record writes payload as segments sent by the local side if outgoing,
+// by the remote side otherwise
+func (c *conn) record(outgoing bool, flags uint8, payload []byte) {
+	c.w.mu.Lock()
+	defer c.w.mu.Unlock()
+
+	src, dst, seq, ack := c.local, c.remote, &c.localSeq, &c.remoteSeq
+	if !outgoing {
+		src, dst, seq, ack = c.remote, c.local, &c.remoteSeq, &c.localSeq
+	}
+
+	t := time.Now()
+	for {
+		chunk := payload[:min(len(payload), maxSegment)]
+		ackNum := *ack
+		if flags&tcpACK == 0 {
+			ackNum = 0
+		}
+		// Recording errors must not break the connection being recorded
+		_ = c.w.writePacket(t, src, dst, *seq, ackNum, flags, chunk)
+
+		*seq += uint32(len(chunk))
+		if flags&(tcpSYN|tcpFIN) != 0 {
+			*seq++
+		}
+		payload = payload[len(chunk):]
+		if len(payload) == 0 {
+			return
+		}
+	}
+}
+
+// writePacket writes one IP/TCP packet record. The caller holds w.mu.
+func (w *Writer) writePacket(t time.Time, src, dst netip.AddrPort, seq, ack uint32, flags uint8, payload []byte) error {
+	b := w.buf[:0]
+	b = binary.LittleEndian.AppendUint32(b, uint32(t.Unix()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(t.Nanosecond()))
+	b = append(b, make([]byte, 8)...) // lengths, filled in below
+	start := len(b)
+
+	tcpLen := 20 + len(payload)
+	if src.Addr().Is4() {
+		ip := src.Addr().As4()
+		dip := dst.Addr().As4()
+		b = append(b, 0x45, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(20+tcpLen))
+		b = append(b, 0, 0, 0x40, 0, 64, protoTCP, 0, 0)
+		b = append(b, ip[:]...)
+		b = append(b, dip[:]...)
+		binary.BigEndian.PutUint16(b[start+10:], ^checksum(0, b[start:start+20]))
+	} else {
+		ip := src.Addr().As16()
+		dip := dst.Addr().As16()
+		b = append(b, 0x60, 0, 0, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(tcpLen))
+		b = append(b, protoTCP, 64)
+		b = append(b, ip[:]...)
+		b = append(b, dip[:]...)
+	}
+
+	tcp := len(b)
+	b = binary.BigEndian.AppendUint16(b, src.Port())
+	b = binary.BigEndian.AppendUint16(b, dst.Port())
+	b = binary.BigEndian.AppendUint32(b, seq)
+	b = binary.BigEndian.AppendUint32(b, ack)
+	b = append(b, 5<<4, flags, 0xFF, 0xFF, 0, 0, 0, 0)
+	b = append(b, payload...)
+	binary.BigEndian.PutUint16(b[tcp+16:], ^checksum(pseudoHeaderSum(src.Addr(), dst.Addr(), tcpLen), b[tcp:]))
+
+	size := uint32(len(b) - start)
+	binary.LittleEndian.PutUint32(b[8:], size)
+	binary.LittleEndian.PutUint32(b[12:], size)
+
+	w.buf = b
+	_, err := w.w.Write(b)
+	return err
+}
+
+// pseudoHeaderSum is the checksum of the TCP pseudo header
+func pseudoHeaderSum(src, dst netip.Addr, length int) uint32 {
+	return uint32(checksum(0, src.AsSlice())) + uint32(checksum(0, dst.AsSlice())) + protoTCP + uint32(length)
+}
+
+// checksum adds b to the ones' complement sum and returns it folded to 16 bits
+func checksum(sum uint32, b []byte) uint16 {
+	for len(b) >= 2 {
+		sum += uint32(binary.BigEndian.Uint16(b))
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		sum += uint32(b[0]) << 8
+	}
+	for sum > 0xFFFF {
+		sum = sum>>16 + sum&0xFFFF
+	}
+	return uint16(sum)
+}
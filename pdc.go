@@ -1,6 +1,7 @@
 package synchrophasor
 
 import (
+	"crypto/tls"
 	"encoding/binary"
 	"net"
 )
@@ -13,32 +14,75 @@ type PDC struct {
 	PMUConfig2 *ConfigFrame
 	PMUHeader  *HeaderFrame
 	Buffer     []byte
+	// DecodeWorkers enables parallel decoding of data frame station blocks when
+	// greater than one. Useful for super-PDC streams with hundreds of stations.
+	DecodeWorkers int
+	bufferPtr     *[]byte
+	readStart     int
+	readEnd       int
 }
 
-// NewPDC creates a new PDC instance
+// NewPDC creates a new PDC instance. The read buffer is taken from a pool on
+// Connect, Attach or the first ReadFrame and returned on Disconnect unless
+// Buffer is set by the caller.
 func NewPDC(idCode uint16) *PDC {
 	return &PDC{
 		IDCode: idCode,
-		Buffer: make([]byte, 65536),
 	}
 }
 
+// acquireBuffer takes a pooled read buffer if none is set
+func (p *PDC) acquireBuffer() {
+	if p.Buffer == nil {
+		p.bufferPtr = readPool.Get().(*[]byte)
+		p.Buffer = *p.bufferPtr
+	}
+}
+
+// releaseBuffer returns a pooled read buffer
+func (p *PDC) releaseBuffer() {
+	if p.bufferPtr != nil {
+		readPool.Put(p.bufferPtr)
+		p.bufferPtr = nil
+		p.Buffer = nil
+	}
+	p.readStart, p.readEnd = 0, 0
+}
+
 // Connect connects to a PMU
 func (p *PDC) Connect(address string) error {
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
 		return err
 	}
-	p.Socket = conn
+	p.Attach(conn)
 	return nil
 }
 
+// ConnectTLS connects to a PMU over TLS
+func (p *PDC) ConnectTLS(address string, config *tls.Config) error {
+	conn, err := tls.Dial("tcp", address, config)
+	if err != nil {
+		return err
+	}
+	p.Attach(conn)
+	return nil
+}
+
+// Attach uses an established connection to a PMU, e.g. an in-memory one in
+// tests. The connection is closed by Disconnect.
+func (p *PDC) Attach(conn net.Conn) {
+	p.Socket = conn
+	p.acquireBuffer()
+}
+
 // Disconnect closes the connection
 func (p *PDC) Disconnect() {
 	if p.Socket != nil {
 		_ = p.Socket.Close()
 		p.Socket = nil
 	}
+	p.releaseBuffer()
 }
 
 // SendCommand sends a command to PMU
@@ -48,12 +92,7 @@ func (p *PDC) SendCommand(cmdCode uint16) error {
 	cmd.CMD = cmdCode
 	cmd.SetTime(nil, nil)
 
-	data, err := cmd.Pack()
-	if err != nil {
-		return err
-	}
-
-	_, err = p.Socket.Write(data)
+	_, err := cmd.PackTo(p.Socket)
 	return err
 }
 
@@ -131,10 +170,17 @@ func (p *PDC) GetConfig(version int) (*ConfigFrame, error) {
 	}
 }
 
-// ReadFrame reads a frame from the socket
+// ReadFrame reads a frame from the socket. Bytes of following frames that
+// arrive in the same read, e.g. from a batched send, are kept for the next call.
 func (p *PDC) ReadFrame() (interface{}, error) {
+	// Socket may have been set directly instead of through Attach
+	p.acquireBuffer()
+
+	// Move bytes left over from the previous read to the front
+	totalRead := copy(p.Buffer, p.Buffer[p.readStart:p.readEnd])
+	p.readStart, p.readEnd = 0, 0
+
 	// Read at least SYNC + FRAMESIZE (4 bytes)
-	totalRead := 0
 	for totalRead < 4 {
 		n, err := p.Socket.Read(p.Buffer[totalRead:])
 		if err != nil {
@@ -144,6 +190,9 @@ func (p *PDC) ReadFrame() (interface{}, error) {
 	}
 
 	frameSize := binary.BigEndian.Uint16(p.Buffer[2:4])
+	if frameSize < 4 {
+		return nil, ErrInvalidSize
+	}
 
 	for totalRead < int(frameSize) {
 		n, err := p.Socket.Read(p.Buffer[totalRead:])
@@ -153,5 +202,15 @@ func (p *PDC) ReadFrame() (interface{}, error) {
 		totalRead += n
 	}
 
-	return UnpackFrame(p.Buffer[:frameSize], p.PMUConfig2)
+	p.readStart, p.readEnd = int(frameSize), totalRead
+	frame := p.Buffer[:frameSize]
+
+	if p.DecodeWorkers > 1 && p.PMUConfig2 != nil {
+		if frameType, err := GetFrameType(frame); err == nil && frameType == FrameTypeData {
+			df := NewDataFrame(p.PMUConfig2)
+			return df, df.UnpackParallel(frame, p.DecodeWorkers)
+		}
+	}
+
+	return UnpackFrame(frame, p.PMUConfig2)
 }
@@ -0,0 +1,40 @@
+package synchrophasor
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPDCReadFrameCoalesced(t *testing.T) {
+	cfg := newBenchConfig(2)
+	first, err := NewDataFrame(cfg).Pack()
+	require.NoError(t, err)
+
+	cfg.PMUStationList[0].Stat = 0x0010
+	second, err := NewDataFrame(cfg).Pack()
+	require.NoError(t, err)
+
+	server, client := net.Pipe()
+	defer func() { _ = server.Close() }()
+
+	pdc := NewPDC(1)
+	pdc.Socket = client
+	pdc.PMUConfig2 = newBenchConfig(2)
+	defer pdc.Disconnect()
+
+	go func() {
+		_, _ = server.Write(append(first, second...))
+	}()
+
+	frame, err := pdc.ReadFrame()
+	require.NoError(t, err)
+	require.IsType(t, &DataFrame{}, frame)
+	require.Equal(t, uint16(0), pdc.PMUConfig2.PMUStationList[0].Stat)
+
+	frame, err = pdc.ReadFrame()
+	require.NoError(t, err)
+	require.IsType(t, &DataFrame{}, frame)
+	require.Equal(t, uint16(0x0010), pdc.PMUConfig2.PMUStationList[0].Stat)
+}
@@ -0,0 +1,229 @@
+// Package perunit defines voltage, current and power bases per station and
+// converts engineering values to per unit and back, so analytics thresholds
+// can be specified in per unit regardless of the voltage level
+package perunit
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Quantity is the kind of a converted value
+type Quantity uint8
+
+const (
+	// Voltage is a phase-to-neutral voltage in V
+	Voltage Quantity = iota
+	// Current is a phase current in A
+	Current
+	// Power is a three-phase power in W, var or VA
+	Power
+	// Impedance is a phase impedance in ohm
+	Impedance
+)
+
+// String returns the name of the quantity
+func (q Quantity) String() string {
+	switch q {
+	case Voltage:
+		return "voltage"
+	case Current:
+		return "current"
+	case Power:
+		return "power"
+	case Impedance:
+		return "impedance"
+	}
+	return fmt.Sprintf("quantity %d", uint8(q))
+}
+
+// Base holds the bases of a station. The current and impedance bases follow
+// from the voltage and power bases.
+type Base struct {
+	// Voltage is the phase-to-neutral base voltage in V
+	Voltage float64
+	// Power is the three-phase base power in VA
+	Power float64
+}
+
+// NewBase returns the base of a rated phase-to-phase voltage in V and a
+// three-phase power in VA, e.g. NewBase(400e3, 100e6)
+func NewBase(lineVoltage, power float64) Base {
+	return Base{Voltage: lineVoltage / math.Sqrt(3), Power: power}
+}
+
+// Valid reports whether both bases are positive
+func (b Base) Valid() bool {
+	return b.Voltage > 0 && b.Power > 0
+}
+
+// Current returns the base current in A
+func (b Base) Current() float64 {
+	return b.Power / (3 * b.Voltage)
+}
+
+// Impedance returns the base impedance in ohm
+func (b Base) Impedance() float64 {
+	return 3 * b.Voltage * b.Voltage / b.Power
+}
+
+// Of returns the base of a quantity, zero for unknown quantities
+func (b Base) Of(q Quantity) float64 {
+	switch q {
+	case Voltage:
+		return b.Voltage
+	case Current:
+		return b.Current()
+	case Power:
+		return b.Power
+	case Impedance:
+		return b.Impedance()
+	}
+	return 0
+}
+
+// ToPU converts an engineering value of a quantity to per unit
+func (b Base) ToPU(q Quantity, v float64) float64 {
+	return v / b.Of(q)
+}
+
+// FromPU converts a per unit value of a quantity to engineering units
+func (b Base) FromPU(q Quantity, pu float64) float64 {
+	return pu * b.Of(q)
+}
+
+// Options configures a Converter
+type Options struct {
+	// Default is the base of stations not listed in Stations, none if zero
+	Default Base
+	// Stations holds the bases by station name
+	Stations map[string]Base
+}
+
+// Converter converts the phasors of a stream to per unit. It is not safe for
+// concurrent use.
+type Converter struct {
+	opts Options
+	cfg  *synchrophasor.ConfigFrame
+	// bases holds the base of every station, zero if it has none
+	bases []Base
+	// phasors holds the base of the phasors by name and scale the base of
+	// every phasor by station, zero if it has none
+	phasors map[string]float64
+	scale   [][]float64
+	set     synchrophasor.Measurements
+}
+
+// New creates a converter for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Converter, error) {
+	if opts.Default != (Base{}) && !opts.Default.Valid() {
+		return nil, fmt.Errorf("%w: default base %+v not positive", synchrophasor.ErrInvalidParameter, opts.Default)
+	}
+	for name, b := range opts.Stations {
+		if !b.Valid() {
+			return nil, fmt.Errorf("%w: base %+v of station %q not positive", synchrophasor.ErrInvalidParameter, b, name)
+		}
+	}
+	c := &Converter{opts: opts}
+	if err := c.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetConfig replaces the configuration
+func (c *Converter) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	stations := make(map[string]bool, len(cfg.PMUStationList))
+	bases := make([]Base, len(cfg.PMUStationList))
+	phasors := make(map[string]float64)
+	scale := make([][]float64, len(cfg.PMUStationList))
+	for i, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN)
+		stations[stn] = true
+		b, ok := c.opts.Stations[stn]
+		if !ok {
+			b = c.opts.Default
+		}
+		bases[i] = b
+		scale[i] = make([]float64, len(pmu.CHNAMPhasor))
+		if !b.Valid() {
+			continue
+		}
+		for j, name := range pmu.CHNAMPhasor {
+			q := Voltage
+			if j < len(pmu.Phunit) && pmu.Phunit[j]>>24 == synchrophasor.PhunitCurrent {
+				q = Current
+			}
+			scale[i][j] = b.Of(q)
+			phasors[stn+"."+strings.TrimSpace(name)] = scale[i][j]
+		}
+	}
+	for name := range c.opts.Stations {
+		if !stations[name] {
+			return fmt.Errorf("%w: unknown station %q", synchrophasor.ErrInvalidParameter, name)
+		}
+	}
+	c.cfg, c.bases, c.phasors, c.scale = cfg, bases, phasors, scale
+	return nil
+}
+
+// Base returns the base of a station by name, false if it has none
+func (c *Converter) Base(station string) (Base, bool) {
+	for i, pmu := range c.cfg.PMUStationList {
+		if strings.TrimSpace(pmu.STN) == station {
+			return c.bases[i], c.bases[i].Valid()
+		}
+	}
+	return Base{}, false
+}
+
+// PhasorBase returns the base of a phasor named "Sub 1.VA", the voltage or
+// current base of its station depending on the phasor type
+func (c *Converter) PhasorBase(name string) (float64, error) {
+	b, ok := c.phasors[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown phasor %q or station without base", synchrophasor.ErrInvalidParameter, name)
+	}
+	return b, nil
+}
+
+// Threshold converts a per unit limit of a phasor named "Sub 1.VA" to
+// engineering units, e.g. for the voltage limits of analytics configured in
+// per unit
+func (c *Converter) Threshold(name string, pu float64) (float64, error) {
+	b, err := c.PhasorBase(name)
+	if err != nil {
+		return 0, err
+	}
+	return pu * b, nil
+}
+
+// Write calls fn with the phasors of m converted to per unit, e.g. for
+// analytics configured in per unit. Stations without a base are passed
+// unchanged. The set passed to fn is only valid during the call and m is not
+// modified.
+func (c *Converter) Write(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	if len(m.Stations) != len(c.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(c.cfg.PMUStationList))
+	}
+	for i, pmu := range c.cfg.PMUStationList {
+		if len(m.Stations[i].Phasors) != len(pmu.PhasorValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	m.CopyTo(&c.set)
+	for i, scale := range c.scale {
+		st := &c.set.Stations[i]
+		for j, b := range scale {
+			if b > 0 {
+				st.Phasors[j] /= complex(b, 0)
+			}
+		}
+	}
+	return fn(&c.set)
+}
@@ -0,0 +1,95 @@
+package perunit
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+	})
+}
+
+func TestBase(t *testing.T) {
+	b := NewBase(400e3, 100e6)
+	require.True(t, b.Valid())
+	require.InDelta(t, 230940.1, b.Voltage, 0.1)
+	require.InDelta(t, 144.34, b.Current(), 0.01)
+	require.InDelta(t, 1600, b.Impedance(), 1e-9)
+	require.InDelta(t, 1.05, b.ToPU(Voltage, b.FromPU(Voltage, 1.05)), 1e-12)
+	require.InDelta(t, 0.5, b.ToPU(Power, 50e6), 1e-12)
+	require.InDelta(t, 16, b.FromPU(Impedance, 0.01), 1e-9)
+	require.Equal(t, "current", Current.String())
+	require.False(t, Base{Voltage: 1}.Valid())
+}
+
+func TestConverter(t *testing.T) {
+	cfg := testConfig()
+	c, err := New(cfg, Options{Stations: map[string]Base{"Sub 1": NewBase(400e3, 100e6)}})
+	require.NoError(t, err)
+
+	b, ok := c.Base("Sub 1")
+	require.True(t, ok)
+	require.InDelta(t, 230940.1, b.Voltage, 0.1)
+	_, ok = c.Base("Sub 2")
+	require.False(t, ok)
+
+	limit, err := c.Threshold("Sub 1.VA", 0.9)
+	require.NoError(t, err)
+	require.InDelta(t, 207846.1, limit, 0.1)
+	base, err := c.PhasorBase("Sub 1.IA")
+	require.NoError(t, err)
+	require.InDelta(t, 144.34, base, 0.01)
+	_, err = c.PhasorBase("Sub 2.VA")
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000000
+	for _, pmu := range cfg.PMUStationList {
+		pmu.PhasorValues[0] = cmplx.Rect(230940.1, 0.1)
+		pmu.PhasorValues[1] = cmplx.Rect(144.34, -0.4)
+	}
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	var called bool
+	require.NoError(t, c.Write(&m, func(pu *synchrophasor.Measurements) error {
+		called = true
+		require.InDelta(t, 1, cmplx.Abs(pu.Stations[0].Phasors[0]), 1e-6)
+		require.InDelta(t, 0.1, cmplx.Phase(pu.Stations[0].Phasors[0]), 1e-6)
+		require.InDelta(t, 1, cmplx.Abs(pu.Stations[0].Phasors[1]), 1e-4)
+		// Without a base
+		require.InDelta(t, 144.34, cmplx.Abs(pu.Stations[1].Phasors[1]), 1e-2)
+		return nil
+	}))
+	require.True(t, called)
+	require.InDelta(t, 230940.1, cmplx.Abs(m.Stations[0].Phasors[0]), 0.1)
+
+	// The default applies to stations without a base of their own
+	c, err = New(cfg, Options{Default: Base{Voltage: 1000, Power: 3e6}})
+	require.NoError(t, err)
+	base, err = c.PhasorBase("Sub 2.IA")
+	require.NoError(t, err)
+	require.InDelta(t, 1000, base, 1e-9)
+
+	m.Stations = m.Stations[:1]
+	require.ErrorIs(t, c.Write(&m, nil), synchrophasor.ErrInvalidParameter)
+}
+
+func TestNew(t *testing.T) {
+	for _, opts := range []Options{
+		{Default: Base{Voltage: 1000}},
+		{Stations: map[string]Base{"Sub 1": {Voltage: -1, Power: 1}}},
+		{Stations: map[string]Base{"Sub 9": NewBase(400e3, 100e6)}},
+	} {
+		_, err := New(testConfig(), opts)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+	require.True(t, math.IsInf(Base{}.ToPU(Voltage, 1), 1))
+}
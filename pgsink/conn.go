@@ -0,0 +1,440 @@
+package pgsink
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by the PostgreSQL client
+var (
+	// ErrServer wraps ErrorResponse messages sent by the server
+	ErrServer = errors.New("postgres error")
+	// ErrProtocol is returned for unexpected or malformed messages
+	ErrProtocol = errors.New("postgres protocol error")
+	// ErrAuth is returned for unsupported or failed authentication
+	ErrAuth = errors.New("postgres authentication failed")
+)
+
+// connConfig holds the startup parameters
+type connConfig struct {
+	addr     string
+	user     string
+	password string
+	database string
+	tls      *tls.Config
+	timeout  time.Duration
+}
+
+// pgConn is a minimal PostgreSQL frontend/backend protocol v3 client
+// supporting simple queries and COPY FROM STDIN
+type pgConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	body    []byte
+	timeout time.Duration
+	// broken is set once reading or writing failed, after which the
+	// connection is out of sync with the server
+	broken bool
+}
+
+// dialPG connects, authenticates and waits until the server is ready
+func dialPG(cfg connConfig) (*pgConn, error) {
+	conn, err := net.DialTimeout("tcp", cfg.addr, cfg.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(cfg.timeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	c := &pgConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn), timeout: cfg.timeout}
+	if err := c.startup(cfg); err != nil {
+		_ = c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// startup negotiates TLS, sends the StartupMessage and authenticates
+func (c *pgConn) startup(cfg connConfig) error {
+	if cfg.tls != nil {
+		// SSLRequest
+		if _, err := c.conn.Write([]byte{0, 0, 0, 8, 0x04, 0xD2, 0x16, 0x2F}); err != nil {
+			return err
+		}
+		answer := make([]byte, 1)
+		if _, err := io.ReadFull(c.conn, answer); err != nil {
+			return err
+		}
+		if answer[0] != 'S' {
+			return fmt.Errorf("%w: server does not support TLS", ErrProtocol)
+		}
+		config := cfg.tls
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName, _, _ = net.SplitHostPort(cfg.addr)
+		}
+		tlsConn := tls.Client(c.conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.conn = tlsConn
+		c.r = bufio.NewReader(tlsConn)
+		c.w = bufio.NewWriter(tlsConn)
+	}
+
+	msg := binary.BigEndian.AppendUint32(nil, 0)
+	msg = binary.BigEndian.AppendUint32(msg, 3<<16)
+	for _, kv := range [][2]string{
+		{"user", cfg.user},
+		{"database", cfg.database},
+		{"application_name", "synchrophasor"},
+		{"client_encoding", "UTF8"},
+	} {
+		msg = append(append(msg, kv[0]...), 0)
+		msg = append(append(msg, kv[1]...), 0)
+	}
+	msg = append(msg, 0)
+	binary.BigEndian.PutUint32(msg, uint32(len(msg)))
+	if _, err := c.w.Write(msg); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+
+	var scram *scramClient
+	for {
+		typ, body, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'R':
+			if scram, err = c.authenticate(cfg, body, scram); err != nil {
+				return err
+			}
+		case 'Z':
+			return nil
+		case 'E':
+			return serverError(body)
+		}
+		// ParameterStatus, BackendKeyData and notices need no action
+	}
+}
+
+// authenticate answers an Authentication request
+func (c *pgConn) authenticate(cfg connConfig, body []byte, scram *scramClient) (*scramClient, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("%w: short authentication message", ErrProtocol)
+	}
+
+	switch code := binary.BigEndian.Uint32(body); code {
+	case 0: // AuthenticationOk
+		return scram, nil
+
+	case 3: // AuthenticationCleartextPassword
+		return scram, c.sendPassword(cfg.password)
+
+	case 5: // AuthenticationMD5Password
+		if len(body) < 8 {
+			return nil, fmt.Errorf("%w: short MD5 salt", ErrProtocol)
+		}
+		inner := md5.Sum([]byte(cfg.password + cfg.user))
+		outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), body[4:8]...))
+		return scram, c.sendPassword("md5" + hex.EncodeToString(outer[:]))
+
+	case 10: // AuthenticationSASL
+		if !strings.Contains(string(body[4:]), "SCRAM-SHA-256\x00") {
+			return nil, fmt.Errorf("%w: no supported SASL mechanism", ErrAuth)
+		}
+		nonce := make([]byte, 18)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		// The server takes the user from the startup message
+		scram = &scramClient{password: cfg.password, nonce: base64.StdEncoding.EncodeToString(nonce)}
+		first := scram.first()
+
+		msg := append([]byte("SCRAM-SHA-256"), 0)
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(first)))
+		msg = append(msg, first...)
+		return scram, c.send('p', msg)
+
+	case 11: // AuthenticationSASLContinue
+		if scram == nil {
+			return nil, fmt.Errorf("%w: unexpected SASL continue", ErrProtocol)
+		}
+		final, err := scram.final(string(body[4:]))
+		if err != nil {
+			return nil, err
+		}
+		return scram, c.send('p', []byte(final))
+
+	case 12: // AuthenticationSASLFinal
+		if scram == nil {
+			return nil, fmt.Errorf("%w: unexpected SASL final", ErrProtocol)
+		}
+		return scram, scram.verify(string(body[4:]))
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported method %d", ErrAuth, code)
+	}
+}
+
+// sendPassword sends a PasswordMessage
+func (c *pgConn) sendPassword(password string) error {
+	return c.send('p', append([]byte(password), 0))
+}
+
+// exec runs a simple query and waits for ReadyForQuery
+func (c *pgConn) exec(query string) error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	if err := c.send('Q', append([]byte(query), 0)); err != nil {
+		return err
+	}
+	return c.waitReady()
+}
+
+// copyIn runs a COPY ... FROM STDIN statement with data in text format
+func (c *pgConn) copyIn(query string, data []byte) error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	if err := c.send('Q', append([]byte(query), 0)); err != nil {
+		return err
+	}
+
+	for {
+		typ, body, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'G': // CopyInResponse
+			for len(data) > 0 {
+				chunk := data[:min(len(data), 64*1024)]
+				if err := c.queue('d', chunk); err != nil {
+					return err
+				}
+				data = data[len(chunk):]
+			}
+			if err := c.send('c', nil); err != nil {
+				return err
+			}
+			return c.waitReady()
+		case 'E':
+			err := serverError(body)
+			return errors.Join(err, c.waitReady())
+		case 'Z':
+			return fmt.Errorf("%w: COPY did not start", ErrProtocol)
+		}
+	}
+}
+
+// waitReady reads until ReadyForQuery, returning the first error response
+func (c *pgConn) waitReady() error {
+	var first error
+	for {
+		typ, body, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'E':
+			if first == nil {
+				first = serverError(body)
+			}
+		case 'Z':
+			return first
+		}
+	}
+}
+
+// setDeadline bounds the next query, including its COPY data, by the
+// timeout
+func (c *pgConn) setDeadline() error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		c.broken = true
+		return err
+	}
+	return nil
+}
+
+// close sends Terminate and closes the connection
+func (c *pgConn) close() error {
+	err := c.send('X', nil)
+	return errors.Join(err, c.conn.Close())
+}
+
+// queue buffers a message without flushing
+func (c *pgConn) queue(typ byte, body []byte) error {
+	var header [5]byte
+	header[0] = typ
+	binary.BigEndian.PutUint32(header[1:], uint32(4+len(body)))
+	if _, err := c.w.Write(header[:]); err != nil {
+		c.broken = true
+		return err
+	}
+	if _, err := c.w.Write(body); err != nil {
+		c.broken = true
+		return err
+	}
+	return nil
+}
+
+// send writes a message and flushes
+func (c *pgConn) send(typ byte, body []byte) error {
+	if err := c.queue(typ, body); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		c.broken = true
+		return err
+	}
+	return nil
+}
+
+// receive reads the next message. The body is valid until the next call.
+func (c *pgConn) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		c.broken = true
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[1:]))
+	if size < 4 || size > 1<<24 {
+		c.broken = true
+		return 0, nil, fmt.Errorf("%w: message length %d", ErrProtocol, size)
+	}
+	if cap(c.body) < size-4 {
+		c.body = make([]byte, size-4)
+	}
+	c.body = c.body[:size-4]
+	if _, err := io.ReadFull(c.r, c.body); err != nil {
+		c.broken = true
+		return 0, nil, err
+	}
+	return header[0], c.body, nil
+}
+
+// serverError converts an ErrorResponse body
+func serverError(body []byte) error {
+	var severity, code, message string
+	for len(body) > 1 {
+		field := body[0]
+		end := strings.IndexByte(string(body[1:]), 0)
+		if end < 0 {
+			break
+		}
+		value := string(body[1 : 1+end])
+		body = body[2+end:]
+		switch field {
+		case 'S':
+			severity = value
+		case 'C':
+			code = value
+		case 'M':
+			message = value
+		}
+	}
+	return fmt.Errorf("%w: %s: %s (SQLSTATE %s)", ErrServer, severity, message, code)
+}
+
+// scramClient performs SCRAM-SHA-256 authentication (RFC 5802, RFC 7677)
+type scramClient struct {
+	user      string
+	password  string
+	nonce     string
+	firstBare string
+	authMsg   string
+	salted    []byte
+}
+
+// first returns the client-first-message
+func (s *scramClient) first() string {
+	s.firstBare = "n=" + saslName(s.user) + ",r=" + s.nonce
+	return "n,," + s.firstBare
+}
+
+// saslName escapes '=' and ',' in a user name as RFC 5802 section 5.1 requires
+func saslName(user string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(user)
+}
+
+// final answers the server-first-message with the client-final-message
+func (s *scramClient) final(serverFirst string) (string, error) {
+	var nonce, salt string
+	iterations := 0
+	for _, attr := range strings.Split(serverFirst, ",") {
+		if len(attr) < 2 || attr[1] != '=' {
+			continue
+		}
+		switch attr[0] {
+		case 'r':
+			nonce = attr[2:]
+		case 's':
+			salt = attr[2:]
+		case 'i':
+			iterations, _ = strconv.Atoi(attr[2:])
+		}
+	}
+	if !strings.HasPrefix(nonce, s.nonce) || len(nonce) == len(s.nonce) || iterations <= 0 {
+		return "", fmt.Errorf("%w: invalid SCRAM server message", ErrAuth)
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid SCRAM salt", ErrAuth)
+	}
+
+	s.salted, err = pbkdf2.Key(sha256.New, s.password, saltBytes, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	clientKey := hmacSHA256(s.salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+
+	withoutProof := "c=biws,r=" + nonce
+	s.authMsg = s.firstBare + "," + serverFirst + "," + withoutProof
+	signature := hmacSHA256(storedKey[:], s.authMsg)
+	for i := range clientKey {
+		clientKey[i] ^= signature[i]
+	}
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(clientKey), nil
+}
+
+// verify checks the server signature of the server-final-message
+func (s *scramClient) verify(serverFinal string) error {
+	serverKey := hmacSHA256(s.salted, "Server Key")
+	expected := "v=" + base64.StdEncoding.EncodeToString(hmacSHA256(serverKey, s.authMsg))
+	if !hmac.Equal([]byte(strings.TrimSpace(serverFinal)), []byte(expected)) {
+		return fmt.Errorf("%w: invalid SCRAM server signature", ErrAuth)
+	}
+	return nil
+}
+
+// hmacSHA256 returns HMAC-SHA-256(key, msg)
+func hmacSHA256(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
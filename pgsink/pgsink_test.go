@@ -0,0 +1,270 @@
+package pgsink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// server is a fake PostgreSQL server with cleartext authentication that
+// records queries and COPY data
+type server struct {
+	listener net.Listener
+	password string
+	mu       sync.Mutex
+	params   map[string]string
+	queries  []string
+	copies   []string
+}
+
+func newServer(t *testing.T, password string) *server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &server{listener: l, password: password}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *server) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	send := func(typ byte, body string) {
+		_ = w.WriteByte(typ)
+		_ = binary.Write(w, binary.BigEndian, uint32(4+len(body)))
+		_, _ = w.WriteString(body)
+	}
+	fail := func(msg string) {
+		send('E', "SERROR\x00C42P01\x00M"+msg+"\x00\x00")
+	}
+
+	// StartupMessage
+	var size uint32
+	if binary.Read(r, binary.BigEndian, &size) != nil {
+		return
+	}
+	startup := make([]byte, size-4)
+	if _, err := io.ReadFull(r, startup); err != nil {
+		return
+	}
+	params := map[string]string{}
+	fields := strings.Split(string(startup[4:]), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		params[fields[i]] = fields[i+1]
+	}
+	s.mu.Lock()
+	s.params = params
+	s.mu.Unlock()
+
+	send('R', "\x00\x00\x00\x03")
+	_ = w.Flush()
+
+	var copyData strings.Builder
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		if binary.Read(r, binary.BigEndian, &size) != nil {
+			return
+		}
+		body := make([]byte, size-4)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+
+		switch typ {
+		case 'p':
+			if strings.TrimSuffix(string(body), "\x00") != s.password {
+				send('E', "SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00")
+				_ = w.Flush()
+				return
+			}
+			send('R', "\x00\x00\x00\x00")
+			send('S', "server_version\x0016.0\x00")
+			send('K', "\x00\x00\x00\x01\x00\x00\x00\x02")
+			send('Z', "I")
+		case 'Q':
+			query := strings.TrimSuffix(string(body), "\x00")
+			s.mu.Lock()
+			s.queries = append(s.queries, query)
+			s.mu.Unlock()
+			switch {
+			case strings.Contains(query, "pg_sleep"):
+				// Never answer
+			case strings.Contains(query, "missing"):
+				fail(`relation "missing" does not exist`)
+				send('Z', "I")
+			case strings.HasPrefix(query, "COPY"):
+				send('G', "\x00\x00\x04\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+				copyData.Reset()
+			default:
+				send('C', "OK\x00")
+				send('Z', "I")
+			}
+		case 'd':
+			copyData.Write(body)
+		case 'c':
+			s.mu.Lock()
+			s.copies = append(s.copies, copyData.String())
+			s.mu.Unlock()
+			send('C', "COPY\x00")
+			send('Z', "I")
+		case 'X':
+			return
+		}
+		_ = w.Flush()
+	}
+}
+
+func (s *server) url(user, database string) string {
+	return "postgres://" + user + ":" + s.password + "@" + s.listener.Addr().String() + "/" + database
+}
+
+func testMeasurements() (*synchrophasor.ConfigFrame, *synchrophasor.Measurements) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Sub\t1", 7734, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, 0)
+	station.AddDigital([]string{"BRK"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+
+	station.PhasorValues[0] = complex(0, 230)
+	station.AnalogValues[0] = float32(math.NaN())
+	station.Freq = 50
+	station.DigitalValues[0][0] = true
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000000
+	df.FracSec = 500000
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return cfg, &m
+}
+
+func TestSink(t *testing.T) {
+	srv := newServer(t, "secret")
+	cfg, m := testMeasurements()
+
+	sink, err := New(cfg, Options{URL: srv.url("pmu", "grid"), CreateTable: true, Hypertable: true, BatchRows: 40})
+	require.NoError(t, err)
+	srv.mu.Lock()
+	require.Equal(t, "pmu", srv.params["user"])
+	require.Equal(t, "grid", srv.params["database"])
+	require.Len(t, srv.queries, 3)
+	require.Contains(t, srv.queries[0], "CREATE TABLE IF NOT EXISTS synchrophasor")
+	require.Equal(t, "SELECT create_hypertable('synchrophasor', 'ts', if_not_exists => TRUE)", srv.queries[1])
+	srv.mu.Unlock()
+
+	// 3 station rows, 2 phasor rows, 1 analog row and 16 digital rows
+	require.NoError(t, sink.Write(m))
+	require.NoError(t, sink.Write(m))
+	srv.mu.Lock()
+	require.Len(t, srv.copies, 1)
+	rows := strings.Split(strings.TrimSuffix(srv.copies[0], "\n"), "\n")
+	srv.mu.Unlock()
+	require.Len(t, rows, 44)
+	require.Equal(t, "2023-11-14 22:13:20.500000+00\tSub\\t1\tfreq\t50", rows[0])
+	require.Equal(t, "2023-11-14 22:13:20.500000+00\tSub\\t1\tVA.mag\t230", rows[3])
+	require.Equal(t, "2023-11-14 22:13:20.500000+00\tSub\\t1\tVA.ang\t90", rows[4])
+	require.Equal(t, "2023-11-14 22:13:20.500000+00\tSub\\t1\tP\tNaN", rows[5])
+	require.Equal(t, "2023-11-14 22:13:20.500000+00\tSub\\t1\tBRK\t1", rows[6])
+	require.Equal(t, "2023-11-14 22:13:20.500000+00\tSub\\t1\tD0_1\t0", rows[7])
+
+	require.NoError(t, sink.Write(m))
+	require.NoError(t, sink.Close())
+	srv.mu.Lock()
+	require.Len(t, srv.copies, 2)
+	require.Equal(t, "COPY synchrophasor (ts, station, channel, value) FROM STDIN", srv.queries[len(srv.queries)-1])
+	srv.mu.Unlock()
+}
+
+func TestSinkErrors(t *testing.T) {
+	srv := newServer(t, "secret")
+	cfg, m := testMeasurements()
+
+	_, err := New(cfg, Options{URL: srv.url("pmu", "grid"), Table: "bad;name"})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+
+	_, err = New(cfg, Options{URL: "postgres://pmu:wrong@" + srv.listener.Addr().String() + "/grid"})
+	require.ErrorIs(t, err, ErrServer)
+
+	// The connection stays usable after a failed COPY
+	sink, err := New(cfg, Options{URL: srv.url("pmu", ""), Table: "public.missing", BatchRows: 1})
+	require.NoError(t, err)
+	require.ErrorIs(t, sink.Write(m), ErrServer)
+	require.ErrorIs(t, sink.Write(m), ErrServer)
+	require.NoError(t, sink.Close())
+	srv.mu.Lock()
+	require.Equal(t, "pmu", srv.params["database"])
+	srv.mu.Unlock()
+}
+
+func TestSinkReconnect(t *testing.T) {
+	srv := newServer(t, "secret")
+	cfg, m := testMeasurements()
+
+	sink, err := New(cfg, Options{URL: srv.url("pmu", "grid"), BatchRows: 1, Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+
+	// A query the server does not answer times out and breaks the connection
+	err = sink.conn.exec("SELECT pg_sleep(1)")
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	require.True(t, netErr.Timeout())
+	require.True(t, sink.conn.broken)
+
+	// The next batch is sent on a new connection
+	require.NoError(t, sink.Write(m))
+	require.False(t, sink.conn.broken)
+
+	// The rows of a batch that fails are dropped
+	_ = sink.conn.conn.Close()
+	require.Error(t, sink.Write(m))
+	require.True(t, sink.conn.broken)
+	require.NoError(t, sink.Write(m))
+	require.NoError(t, sink.Close())
+	srv.mu.Lock()
+	require.Len(t, srv.copies, 2)
+	srv.mu.Unlock()
+}
+
+func TestSCRAM(t *testing.T) {
+	// RFC 7677 section 3
+	s := &scramClient{user: "user", password: "pencil", nonce: "rOprNGfwEbeRWgbNEkqO"}
+	require.Equal(t, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", s.first())
+
+	final, err := s.final("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.NoError(t, err)
+	require.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,"+
+		"p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", final)
+	require.NoError(t, s.verify("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	require.ErrorIs(t, s.verify("v=AAAA"), ErrAuth)
+
+	_, err = s.final("r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.ErrorIs(t, err, ErrAuth)
+
+	// Separators in the user name are escaped
+	s = &scramClient{user: "a=b,c", nonce: "rOprNGfwEbeRWgbNEkqO"}
+	require.Equal(t, "n,,n=a=3Db=2Cc,r=rOprNGfwEbeRWgbNEkqO", s.first())
+}
@@ -1,12 +1,14 @@
 package synchrophasor
 
 import (
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -21,11 +23,42 @@ type PMU struct {
 	Socket       net.Listener
 	Clients      []net.Conn
 	ClientsMutex sync.Mutex
-	Running      bool
-	SendData     map[net.Conn]bool
+	// Running mirrors IsRunning.
+	//
+	// Deprecated: Use IsRunning, the field is not safe to read while the
+	// server is running. It will be removed in the next release.
+	Running bool
+	// SendData mirrors whether each client receives data frames.
+	//
+	// Deprecated: The map is kept up to date for existing readers, which
+	// must hold SendDataMux, but writing it has no effect. It will be
+	// removed in the next release.
+	SendData map[net.Conn]bool
+	// SendDataMux guards SendData.
+	//
+	// Deprecated: Only needed to read SendData, which is deprecated.
 	SendDataMux  sync.Mutex
-	logger       *log.Logger
-	metrics      MetricsRecorder
+	running      atomic.Bool
+	clients      atomic.Pointer[[]*pmuClient]
+	listeners    []net.Listener
+	listenersMux sync.Mutex
+	// packetConns are the UDP sockets, closed together with the listeners
+	packetConns []net.PacketConn
+	// udpDataPort sends the data of TCP clients over UDP, 0 keeps it on TCP
+	udpDataPort int
+	// udpPeers limits the peers of the UDP sockets
+	udpPeers UDPPeerOptions
+	logger   *log.Logger
+	metrics  MetricsRecorder
+	provider DataProvider
+	clock    func(t time.Time) (time.Time, uint8)
+	// publishOnly disables the internal data sender in favour of Publish
+	publishOnly bool
+	// senderDone stops the data sender, senderWG waits for it to return
+	senderDone chan struct{}
+	senderWG   sync.WaitGroup
+	// configMu guards replacing and packing the configuration frames
+	configMu sync.Mutex
 }
 
 // NewPMU creates a new PMU instance
@@ -33,7 +66,6 @@ func NewPMU() *PMU {
 	pmu := &PMU{
 		Clients:  make([]net.Conn, 0),
 		SendData: make(map[net.Conn]bool),
-		Running:  false,
 	}
 
 	// Initialize with default configuration
@@ -61,6 +93,51 @@ func (p *PMU) SetMetrics(m MetricsRecorder) {
 	p.metrics = m
 }
 
+// SetDataProvider sets the source of measurement values. When set, it is asked
+// to update the station values of Config2 before every data frame is sent.
+func (p *PMU) SetDataProvider(provider DataProvider) {
+	p.provider = provider
+}
+
+// SetClock sets the source of the data frame timestamps. clock is called
+// with the wall time of every data frame and returns the time to stamp and
+// the 4-bit message time quality code carried in FRACSEC, e.g. to simulate a
+// drifting clock after a loss of synchronization. It must be called before
+// the server is started.
+func (p *PMU) SetClock(clock func(t time.Time) (time.Time, uint8)) {
+	p.clock = clock
+}
+
+// SetPublishOnly disables the internal data sender, so that data frames are
+// only sent by Publish, e.g. when replaying recorded frames. It must be called
+// before the server is started.
+func (p *PMU) SetPublishOnly(enabled bool) {
+	p.publishOnly = enabled
+}
+
+// SetConfig replaces the configuration sent to PDCs while the server is
+// running, e.g. when a replayed recording changes its configuration
+func (p *PMU) SetConfig(cfg *ConfigFrame) {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+
+	p.Config2 = cfg
+	p.Config1.ConfigFrame = *cfg
+	p.Config1.Sync = (SyncAA << 8) | SyncCfg1
+}
+
+// config returns the current configuration
+func (p *PMU) config() *ConfigFrame {
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+	return p.Config2
+}
+
+// IsRunning reports whether the PMU server is running
+func (p *PMU) IsRunning() bool {
+	return p.running.Load()
+}
+
 // log returns the logger or creates a default one
 func (p *PMU) log() *log.Logger {
 	if p.logger == nil {
@@ -77,49 +154,135 @@ func (p *PMU) Start(address string) error {
 	}
 
 	p.Socket = listener
-	p.Running = true
-
 	p.log().WithField("address", address).Info("PMU server listening")
+	p.listen(listener)
+
+	return nil
+}
+
+// StartTLS starts a TLS listener on the given address. It may be combined with Start
+// to serve TLS and plaintext PDCs at the same time from the same stream.
+func (p *PMU) StartTLS(address string, config *tls.Config) error {
+	listener, err := tls.Listen("tcp", address, config)
+	if err != nil {
+		return err
+	}
+
+	p.log().WithFields(log.Fields{
+		"address": address,
+		"tls":     true,
+	}).Info("PMU server listening")
+	p.listen(listener)
+
+	return nil
+}
+
+// Serve accepts PDC connections on a caller-provided listener, such as a socket
+// activated or unix domain listener, and blocks until the listener fails or the PMU
+// is stopped, similar to http.Server.Serve. It always returns a non-nil error;
+// after Stop the error is ErrPMUStopped.
+func (p *PMU) Serve(listener net.Listener) error {
+	p.log().WithField("address", listener.Addr().String()).Info("PMU server listening")
+	p.addListener(listener)
+
+	return p.acceptLoop(listener)
+}
+
+// listen registers a listener and accepts connections on it in the background
+func (p *PMU) listen(listener net.Listener) {
+	p.addListener(listener)
 
-	// Accept connections
 	go func() {
-		for p.Running {
-			conn, err := p.Socket.Accept()
-			if err != nil {
-				if p.Running {
-					p.log().WithError(err).Error("Error accepting connection")
-				}
-				continue
-			}
+		_ = p.acceptLoop(listener)
+	}()
+}
 
-			clientAddr := conn.RemoteAddr().String()
-			p.log().WithField("client", clientAddr).Info("New PDC client connected")
+// addListener registers a listener. The data sender is started together with the
+// first listener or UDP socket and shared by all of them.
+func (p *PMU) addListener(listener net.Listener) {
+	p.listenersMux.Lock()
+	first := len(p.listeners) == 0 && len(p.packetConns) == 0
+	p.listeners = append(p.listeners, listener)
+	p.running.Store(true)
+	p.Running = true
+	if first {
+		p.startSender()
+	}
+	p.listenersMux.Unlock()
+}
 
-			p.ClientsMutex.Lock()
-			p.Clients = append(p.Clients, conn)
-			p.SendData[conn] = false
-			p.ClientsMutex.Unlock()
+// startSender starts the data sender unless only Publish sends data. It is
+// called with listenersMux held.
+func (p *PMU) startSender() {
+	if p.publishOnly {
+		return
+	}
+	p.senderDone = make(chan struct{})
+	p.senderWG.Add(1)
+	go p.dataSender(p.senderDone)
+}
 
-			if p.metrics != nil {
-				p.metrics.RecordClientConnected()
+// acceptLoop accepts connections until the listener is closed
+func (p *PMU) acceptLoop(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !p.running.Load() {
+				return ErrPMUStopped
 			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			p.log().WithError(err).Error("Error accepting connection")
+			continue
+		}
+
+		clientAddr := conn.RemoteAddr().String()
+		p.log().WithField("client", clientAddr).Info("New PDC client connected")
 
-			// Handle client in goroutine
-			go p.handleClient(conn)
+		client := newPMUClient(conn)
+		if p.udpDataPort != 0 {
+			if client.data, err = p.dialUDPData(conn); err != nil {
+				p.log().WithField("client", clientAddr).WithError(err).Error("Error opening UDP data channel")
+				_ = conn.Close()
+				continue
+			}
 		}
-	}()
+		p.addClient(client)
 
-	go p.dataSender()
+		if p.metrics != nil {
+			p.metrics.RecordClientConnected()
+		}
 
-	return nil
+		// Handle client in goroutines
+		go p.clientWriter(client)
+		go p.handleClient(client)
+	}
 }
 
 // Stop stops the PMU server
 func (p *PMU) Stop() {
+	p.running.Store(false)
+
+	p.listenersMux.Lock()
+	for _, listener := range p.listeners {
+		_ = listener.Close()
+	}
+	p.listeners = nil
+	for _, pc := range p.packetConns {
+		_ = pc.Close()
+	}
+	p.packetConns = nil
 	p.Running = false
-	if p.Socket != nil {
-		_ = p.Socket.Close()
+	done := p.senderDone
+	p.senderDone = nil
+	p.listenersMux.Unlock()
+
+	// Wait for the data sender, so that a restart does not run two of them
+	if done != nil {
+		close(done)
 	}
+	p.senderWG.Wait()
 
 	p.ClientsMutex.Lock()
 	for _, conn := range p.Clients {
@@ -131,22 +294,75 @@ func (p *PMU) Stop() {
 	p.log().Info("PMU server stopped")
 }
 
-// handleClient handles a client connection
-func (p *PMU) handleClient(conn net.Conn) {
+// addClient registers a client. The sender's client snapshot is replaced rather
+// than modified, so the sender never has to lock.
+func (p *PMU) addClient(client *pmuClient) {
+	p.ClientsMutex.Lock()
+	defer p.ClientsMutex.Unlock()
+
+	p.Clients = append(p.Clients, client.conn)
+	p.mirrorSendData(client)
+
+	var snapshot []*pmuClient
+	if current := p.clients.Load(); current != nil {
+		snapshot = make([]*pmuClient, 0, len(*current)+1)
+		snapshot = append(snapshot, *current...)
+	}
+	snapshot = append(snapshot, client)
+	p.clients.Store(&snapshot)
+}
+
+// removeClient unregisters a client, publishing a new snapshot without it
+func (p *PMU) removeClient(client *pmuClient) {
+	p.ClientsMutex.Lock()
+	defer p.ClientsMutex.Unlock()
+
+	for i, c := range p.Clients {
+		if c == client.conn {
+			p.Clients = append(p.Clients[:i], p.Clients[i+1:]...)
+			break
+		}
+	}
+	p.SendDataMux.Lock()
+	delete(p.SendData, client.conn)
+	p.SendDataMux.Unlock()
+
+	current := p.clients.Load()
+	if current == nil {
+		return
+	}
+	snapshot := make([]*pmuClient, 0, len(*current))
+	for _, c := range *current {
+		if c != client {
+			snapshot = append(snapshot, c)
+		}
+	}
+	p.clients.Store(&snapshot)
+}
+
+// mirrorSendData copies the data state of a client into the deprecated
+// SendData map
+func (p *PMU) mirrorSendData(client *pmuClient) {
+	p.SendDataMux.Lock()
+	defer p.SendDataMux.Unlock()
+
+	if p.SendData == nil {
+		p.SendData = make(map[net.Conn]bool)
+	}
+	p.SendData[client.conn] = client.sendData.Load()
+}
+
+func (p *PMU) handleClient(client *pmuClient) {
+	conn := client.conn
 	clientAddr := conn.RemoteAddr().String()
 
 	defer func() {
 		_ = conn.Close()
-		p.ClientsMutex.Lock()
-		delete(p.SendData, conn)
-		// Remove from clients list
-		for i, c := range p.Clients {
-			if c == conn {
-				p.Clients = append(p.Clients[:i], p.Clients[i+1:]...)
-				break
-			}
+		if client.data != conn {
+			_ = client.data.Close()
 		}
-		p.ClientsMutex.Unlock()
+		close(client.done)
+		p.removeClient(client)
 
 		// Update metrics
 		if p.metrics != nil {
@@ -156,9 +372,11 @@ func (p *PMU) handleClient(conn net.Conn) {
 		p.log().WithField("client", clientAddr).Info("PDC client disconnected")
 	}()
 
-	buffer := make([]byte, 65536)
+	bufferPtr := readPool.Get().(*[]byte)
+	defer readPool.Put(bufferPtr)
+	buffer := *bufferPtr
 
-	for p.Running {
+	for p.running.Load() {
 		// Set read timeout
 		if err := conn.SetReadDeadline(time.Now().Add(1 * time.Second)); err != nil {
 			p.log().WithField("client", clientAddr).WithError(err).Error("Error setting read deadline")
@@ -192,7 +410,7 @@ func (p *PMU) handleClient(conn net.Conn) {
 				frame, err := UnpackFrame(buffer[:frameSize], nil)
 				if err == nil {
 					if cmd, ok := frame.(*CommandFrame); ok {
-						p.handleCommand(conn, cmd)
+						p.handleCommand(client, cmd)
 					}
 				} else {
 					p.log().WithFields(log.Fields{
@@ -209,47 +427,56 @@ func (p *PMU) handleClient(conn net.Conn) {
 }
 
 // handleCommand processes a command frame
-func (p *PMU) handleCommand(conn net.Conn, cmd *CommandFrame) {
+func (p *PMU) handleCommand(client *pmuClient, cmd *CommandFrame) {
+	conn := client.conn
 	clientAddr := conn.RemoteAddr().String()
 	var response []byte
 	var err error
 	var cmdName string
 
+	responseBuf := getFrameBuffer()
+	defer putFrameBuffer(responseBuf)
+
 	switch cmd.CMD {
 	case CmdStart:
 		cmdName = "START"
-		p.SendDataMux.Lock()
-		p.SendData[conn] = true
-		p.SendDataMux.Unlock()
+		client.sendData.Store(true)
+		p.mirrorSendData(client)
 		p.log().WithField("client", clientAddr).Info("Started data transmission")
 
 	case CmdStop:
 		cmdName = "STOP"
-		p.SendDataMux.Lock()
-		p.SendData[conn] = false
-		p.SendDataMux.Unlock()
+		client.sendData.Store(false)
+		p.mirrorSendData(client)
 		p.log().WithField("client", clientAddr).Info("Stopped data transmission")
 
 	case CmdHeader:
 		cmdName = "HEADER"
+		if p.Header == nil {
+			break
+		}
 		p.Header.SetTime(nil, nil)
-		response, err = p.Header.Pack()
+		response, err = p.Header.AppendTo(*responseBuf)
 		if err == nil && p.metrics != nil {
 			p.metrics.RecordHeaderFrameSent(len(response))
 		}
 
 	case CmdCfg1:
 		cmdName = "CONFIG1"
+		p.configMu.Lock()
 		p.Config1.SetTime(nil, nil)
-		response, err = p.Config1.Pack()
+		response, err = p.Config1.AppendTo(*responseBuf)
+		p.configMu.Unlock()
 		if err == nil && p.metrics != nil {
 			p.metrics.RecordConfigFrameSent(len(response))
 		}
 
 	case CmdCfg2:
 		cmdName = "CONFIG2"
+		p.configMu.Lock()
 		p.Config2.SetTime(nil, nil)
-		response, err = p.Config2.Pack()
+		response, err = p.Config2.AppendTo(*responseBuf)
+		p.configMu.Unlock()
 		if err == nil && p.metrics != nil {
 			p.metrics.RecordConfigFrameSent(len(response))
 		}
@@ -270,6 +497,11 @@ func (p *PMU) handleCommand(conn net.Conn, cmd *CommandFrame) {
 	}).Debug("Received command")
 
 	if response != nil && err == nil {
+		*responseBuf = response
+		// The data writer leaves its write deadline on the connection
+		if err := conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout)); err != nil {
+			p.log().WithField("client", clientAddr).WithError(err).Debug("Error setting write deadline")
+		}
 		if _, err := conn.Write(response); err != nil {
 			p.log().WithFields(log.Fields{
 				"client":  clientAddr,
@@ -289,8 +521,39 @@ func (p *PMU) handleCommand(conn net.Conn, cmd *CommandFrame) {
 	}
 }
 
-// dataSender sends data frames to connected clients
-func (p *PMU) dataSender() {
+// sendBuffer holds a packed data frame shared by the client writers of one tick.
+// It returns itself to sendBufferPool once the last reference is released.
+type sendBuffer struct {
+	data []byte
+	refs atomic.Int32
+}
+
+// sendBufferPool recycles data frame buffers across ticks
+var sendBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &sendBuffer{}
+	},
+}
+
+// getSendBuffer returns an empty pooled send buffer holding one reference
+func getSendBuffer() *sendBuffer {
+	b := sendBufferPool.Get().(*sendBuffer)
+	b.data = b.data[:0]
+	b.refs.Store(1)
+	return b
+}
+
+// release drops a reference and recycles the buffer when none are left
+func (b *sendBuffer) release() {
+	if b.refs.Add(-1) == 0 {
+		sendBufferPool.Put(b)
+	}
+}
+
+// dataSender sends data frames to connected clients until done is closed
+func (p *PMU) dataSender(done <-chan struct{}) {
+	defer p.senderWG.Done()
+
 	ticker := time.NewTicker(time.Duration(1000/p.Config2.DataRate) * time.Millisecond)
 	defer ticker.Stop()
 
@@ -298,55 +561,52 @@ func (p *PMU) dataSender() {
 	framesSent := 0
 	lastRateUpdate := time.Now()
 
-	for p.Running {
-		<-ticker.C
-		// Create data frame
-		df := NewDataFrame(p.Config2)
-		df.IDCode = p.Config2.IDCode
-		df.SetTime(nil, nil)
+	df := NewDataFrame(p.Config2)
 
-		// Pack data frame
-		data, err := df.Pack()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		// Prepare data frame
+		cfg := p.config()
+		df.AssociatedConfig = cfg
+		df.IDCode = cfg.IDCode
+		now := time.Now()
+		if p.clock != nil {
+			stamp, quality := p.clock(now)
+			fraction := uint32(int64(stamp.Nanosecond()) * int64(cfg.TimeBase&0x00FFFFFF) / int64(time.Second))
+			df.SOC = uint32(stamp.Unix())
+			df.FracSec = uint32(quality&0x0F)<<24 | fraction&0x00FFFFFF
+		} else {
+			df.SetTime(nil, nil)
+		}
+
+		if p.provider != nil {
+			if err := p.provider.Update(cfg, now); err != nil {
+				p.log().WithError(err).Error("Error updating data from provider")
+				if p.metrics != nil {
+					p.metrics.RecordFrameError("provider_error")
+				}
+				continue
+			}
+		}
+
+		// Pack data frame into a pooled buffer
+		buf := getSendBuffer()
+		var err error
+		buf.data, err = df.AppendTo(buf.data)
 		if err != nil {
+			buf.release()
 			p.log().WithError(err).Error("Error packing data frame")
 			if p.metrics != nil {
 				p.metrics.RecordFrameError("data_pack_error")
 			}
 			continue
 		}
-
-		// Send to all clients with data enabled
-		p.ClientsMutex.Lock()
-		activeClients := 0
-		for conn := range p.SendData {
-			p.SendDataMux.Lock()
-			sendEnabled := p.SendData[conn]
-			p.SendDataMux.Unlock()
-
-			if sendEnabled {
-				activeClients++
-				go func(c net.Conn) {
-					if err := c.SetWriteDeadline(time.Now().Add(100 * time.Millisecond)); err != nil {
-						p.log().WithField("client", c.RemoteAddr().String()).WithError(err).Debug("Error setting write deadline")
-						return
-					}
-					_, err := c.Write(data)
-					if err != nil {
-						p.log().WithFields(log.Fields{
-							"client": c.RemoteAddr().String(),
-							"error":  err,
-						}).Debug("Error sending data frame")
-					}
-				}(conn)
-			}
-		}
-		p.ClientsMutex.Unlock()
-
-		if activeClients > 0 {
+		if p.broadcast(buf) > 0 {
 			framesSent++
-			if p.metrics != nil {
-				p.metrics.RecordDataFrameSent(len(data))
-			}
 		}
 
 		// Update rate metric every second
@@ -366,6 +626,46 @@ func (p *PMU) dataSender() {
 	}
 }
 
+// broadcast queues a data frame for all clients with data enabled and
+// releases buf. It returns the number of clients the frame was queued for.
+func (p *PMU) broadcast(buf *sendBuffer) int {
+	frameSize := len(buf.data)
+	activeClients := 0
+	if clients := p.clients.Load(); clients != nil {
+		for _, client := range *clients {
+			if !client.sendData.Load() {
+				continue
+			}
+
+			activeClients++
+			if !client.enqueue(buf) {
+				p.log().WithField("client", client.conn.RemoteAddr().String()).Debug("Send queue full, dropping data frame")
+				if p.metrics != nil {
+					p.metrics.RecordFrameError("send_queue_full")
+				}
+			}
+		}
+	}
+	buf.release()
+
+	if activeClients > 0 && p.metrics != nil {
+		p.metrics.RecordDataFrameSent(frameSize)
+	}
+	return activeClients
+}
+
+// Publish sends a packed data frame to all clients with data enabled. The
+// frame is copied, so it may be reused once Publish returns.
+func (p *PMU) Publish(frame []byte) error {
+	if len(frame) < 4 || int(binary.BigEndian.Uint16(frame[2:4])) != len(frame) {
+		return fmt.Errorf("%w: invalid frame size", ErrInvalidFrame)
+	}
+	buf := getSendBuffer()
+	buf.data = append(buf.data, frame...)
+	p.broadcast(buf)
+	return nil
+}
+
 // LogConfiguration logs the complete PMU configuration
 func (p *PMU) LogConfiguration() {
 	if p.Config2 == nil {
@@ -0,0 +1,113 @@
+package synchrophasor
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// clientQueueSize is the number of data frames buffered per client before frames are dropped
+	clientQueueSize = 64
+	// clientWriteTimeout bounds a single (batched) write to a client
+	clientWriteTimeout = 100 * time.Millisecond
+)
+
+// pmuClient is a connected PDC with its outgoing data frame queue
+type pmuClient struct {
+	conn net.Conn
+	// data receives the data frames, conn unless they are sent over UDP
+	data     net.Conn
+	sendData atomic.Bool
+	queue    chan *sendBuffer
+	done     chan struct{}
+}
+
+// newPMUClient creates a client for conn
+func newPMUClient(conn net.Conn) *pmuClient {
+	return &pmuClient{
+		conn:  conn,
+		data:  conn,
+		queue: make(chan *sendBuffer, clientQueueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// enqueue queues a data frame for the client, taking a reference on buf.
+// It returns false if the queue is full and the frame was dropped.
+func (c *pmuClient) enqueue(buf *sendBuffer) bool {
+	buf.refs.Add(1)
+	select {
+	case c.queue <- buf:
+		return true
+	default:
+		buf.release()
+		return false
+	}
+}
+
+// clientWriter sends queued data frames to a client until it disconnects.
+// Frames that piled up while a previous write was in flight are coalesced
+// into a single vectored write.
+func (p *PMU) clientWriter(c *pmuClient) {
+	batch := make([]*sendBuffer, 0, clientQueueSize)
+	vec := make(net.Buffers, 0, clientQueueSize)
+
+	for {
+		select {
+		case <-c.done:
+			for {
+				select {
+				case buf := <-c.queue:
+					buf.release()
+				default:
+					return
+				}
+			}
+
+		case buf := <-c.queue:
+			batch = append(batch[:0], buf)
+		drain:
+			for len(batch) < cap(batch) {
+				select {
+				case buf := <-c.queue:
+					batch = append(batch, buf)
+				default:
+					break drain
+				}
+			}
+
+			vec = vec[:0]
+			for _, b := range batch {
+				vec = append(vec, b.data)
+			}
+
+			p.writeBatch(c.data, vec)
+
+			for i, b := range batch {
+				b.release()
+				batch[i] = nil
+			}
+		}
+	}
+}
+
+// writeBatch writes all buffers to conn, using writev where the connection supports it
+func (p *PMU) writeBatch(conn net.Conn, vec net.Buffers) {
+	if err := conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout)); err != nil {
+		p.log().WithField("client", conn.RemoteAddr().String()).WithError(err).Debug("Error setting write deadline")
+		return
+	}
+
+	// WriteTo consumes the slice header, keep vec intact for reuse
+	pending := vec
+	if _, err := pending.WriteTo(conn); err != nil {
+		p.log().WithFields(log.Fields{
+			"client": conn.RemoteAddr().String(),
+			"frames": len(vec),
+			"error":  err,
+		}).Debug("Error sending data frame")
+	}
+}
@@ -1,5 +1,10 @@
 package synchrophasor
 
+import (
+	"slices"
+	"strings"
+)
+
 // PMUStation represents a PMU station configuration
 type PMUStation struct {
 	C37118
@@ -83,6 +88,41 @@ func (p *PMUStation) FormatFreqType() bool {
 	return (p.Format & 0x08) != 0
 }
 
+// DataSize returns the size in bytes of the station's block in a data frame
+func (p *PMUStation) DataSize() uint16 {
+	return uint16(p.dataSize())
+}
+
+// dataSize returns the block size without wrapping around for channel
+// counts that do not fit a frame
+func (p *PMUStation) dataSize() int {
+	size := 2 // STAT
+	phnmr, annmr := int(p.Phnmr), int(p.Annmr)
+
+	if p.FormatPhasorType() {
+		size += 8 * phnmr
+	} else {
+		size += 4 * phnmr
+	}
+
+	if p.FormatFreqType() {
+		size += 8
+	} else {
+		size += 4
+	}
+
+	if p.FormatAnalogType() {
+		size += 4 * annmr
+	} else {
+		size += 2 * annmr
+	}
+
+	// Digital data
+	size += 2 * int(p.Dgnmr)
+
+	return size
+}
+
 // AddPhasor adds a phasor channel
 func (p *PMUStation) AddPhasor(name string, factor uint32, phType uint8) {
 	name = padString(name)
@@ -112,6 +152,45 @@ func (p *PMUStation) AddDigital(names []string, normal, valid uint16) {
 	p.DigitalValues = append(p.DigitalValues, make([]bool, 16))
 }
 
+// ResetValues zeroes the measurement values and sizes the value slices to the
+// configured channel counts, reusing existing capacity where possible
+func (p *PMUStation) ResetValues() {
+	p.Stat = 0
+	p.Freq = 0
+	p.DFreq = 0
+
+	p.PhasorValues = resize(p.PhasorValues, int(p.Phnmr))
+	clear(p.PhasorValues)
+
+	p.AnalogValues = resize(p.AnalogValues, int(p.Annmr))
+	clear(p.AnalogValues)
+
+	p.DigitalValues = resize(p.DigitalValues, int(p.Dgnmr))
+	for j := range p.DigitalValues {
+		p.DigitalValues[j] = resize(p.DigitalValues[j], 16)
+		clear(p.DigitalValues[j])
+	}
+}
+
+// Clone returns a deep copy of p, whose channel lists and values may be
+// changed without affecting p
+func (p *PMUStation) Clone() *PMUStation {
+	out := *p
+	out.CHNAMPhasor = slices.Clone(p.CHNAMPhasor)
+	out.CHNAMAnalog = slices.Clone(p.CHNAMAnalog)
+	out.CHNAMDigital = slices.Clone(p.CHNAMDigital)
+	out.Phunit = slices.Clone(p.Phunit)
+	out.Anunit = slices.Clone(p.Anunit)
+	out.Dgunit = slices.Clone(p.Dgunit)
+	out.PhasorValues = slices.Clone(p.PhasorValues)
+	out.AnalogValues = slices.Clone(p.AnalogValues)
+	out.DigitalValues = make([][]bool, len(p.DigitalValues))
+	for j, word := range p.DigitalValues {
+		out.DigitalValues[j] = slices.Clone(word)
+	}
+	return &out
+}
+
 // GetPhasorFactor returns the factor for a phasor channel
 func (p *PMUStation) GetPhasorFactor(index int) uint32 {
 	if index >= len(p.Phunit) {
@@ -120,6 +199,30 @@ func (p *PMUStation) GetPhasorFactor(index int) uint32 {
 	return p.Phunit[index] & 0x0FFFFFF
 }
 
+// PhasorName returns the trimmed name of phasor channel i, or "" if there is none
+func (p *PMUStation) PhasorName(i int) string {
+	return channelName(p.CHNAMPhasor, i)
+}
+
+// AnalogName returns the trimmed name of analog channel i, or "" if there is none
+func (p *PMUStation) AnalogName(i int) string {
+	return channelName(p.CHNAMAnalog, i)
+}
+
+// DigitalName returns the trimmed name of digital channel i, counting the 16
+// bits of every status word, or "" if there is none
+func (p *PMUStation) DigitalName(i int) string {
+	return channelName(p.CHNAMDigital, i)
+}
+
+// channelName returns the trimmed name at index i, or "" if there is none
+func channelName(names []string, i int) string {
+	if i < 0 || i >= len(names) {
+		return ""
+	}
+	return strings.TrimSpace(names[i])
+}
+
 // GetNominalFrequency returns the nominal frequency based on Fnom setting
 func (p *PMUStation) GetNominalFrequency() float32 {
 	if p.Fnom == FreqNom50Hz {
@@ -0,0 +1,36 @@
+package synchrophasor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPMUStationChannelNames(t *testing.T) {
+	station := NewPMUStation("Station A", 1, false, false, false, false)
+	station.AddPhasor("VA", 915527, PhunitVoltage)
+	station.AddAnalog("P", 1, AnunitPow)
+	station.AddDigital([]string{"BREAKER 1"}, 0, 0xFFFF)
+
+	require.Equal(t, "VA", station.PhasorName(0))
+	require.Equal(t, "P", station.AnalogName(0))
+	require.Equal(t, "BREAKER 1", station.DigitalName(0))
+	require.Empty(t, station.PhasorName(1))
+	require.Empty(t, station.AnalogName(-1))
+}
+
+func TestConfigFrameClone(t *testing.T) {
+	cfg := newBenchConfig(2)
+	cfg.PMUStationList[0].DigitalValues[0][3] = true
+	c := cfg.Clone()
+	require.Equal(t, cfg, c)
+
+	c.PMUStationList[0].CHNAMPhasor[0] = "X"
+	c.PMUStationList[0].PhasorValues[0] = 1
+	c.PMUStationList[0].DigitalValues[0][3] = false
+	c.PMUStationList[1].STN = "X"
+	require.NotEqual(t, "X", cfg.PMUStationList[0].CHNAMPhasor[0])
+	require.Zero(t, cfg.PMUStationList[0].PhasorValues[0])
+	require.True(t, cfg.PMUStationList[0].DigitalValues[0][3])
+	require.NotEqual(t, "X", cfg.PMUStationList[1].STN)
+}
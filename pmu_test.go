@@ -0,0 +1,345 @@
+package synchrophasor
+
+import (
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPMUServe(t *testing.T) {
+	pmu := NewPMU()
+	station := NewPMUStation("Station A", 7734, false, true, false, false)
+	station.AddPhasor("VA", 915527, PhunitVoltage)
+	pmu.Config2.AddPMUStation(station)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- pmu.Serve(listener)
+	}()
+
+	pdc := NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	cfg, err := pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.Equal(t, uint16(1), cfg.NumPMU)
+	require.Equal(t, "Station A", cfg.PMUStationList[0].STN)
+
+	pmu.Stop()
+	require.ErrorIs(t, <-served, ErrPMUStopped)
+}
+
+func TestPMUDataStream(t *testing.T) {
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	defer pmu.Stop()
+
+	pdc := NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	_, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, pdc.Start())
+
+	for i := 0; i < 5; i++ {
+		frame, err := pdc.ReadFrame()
+		require.NoError(t, err)
+		require.IsType(t, &DataFrame{}, frame)
+	}
+
+	// The deprecated SendData map still mirrors the client state
+	pmu.SendDataMux.Lock()
+	require.Equal(t, []bool{true}, slices.Collect(maps.Values(pmu.SendData)))
+	pmu.SendDataMux.Unlock()
+}
+
+func TestPMUStopStopsSender(t *testing.T) {
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+	var updates atomic.Int32
+	pmu.SetDataProvider(DataProviderFunc(func(*ConfigFrame, time.Time) error {
+		updates.Add(1)
+		return nil
+	}))
+
+	// A restart runs a single sender at the data rate
+	require.NoError(t, pmu.Start("127.0.0.1:0"))
+	require.True(t, pmu.Running)
+	pmu.Stop()
+	require.False(t, pmu.Running)
+	require.NoError(t, pmu.Start("127.0.0.1:0"))
+	updates.Store(0)
+	time.Sleep(400 * time.Millisecond)
+	require.InDelta(t, 20, updates.Load(), 6)
+
+	// No sender is left running after Stop
+	pmu.Stop()
+	stopped := updates.Load()
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, stopped, updates.Load())
+}
+
+func TestPMUCommandAfterStop(t *testing.T) {
+	pmu := NewPMU()
+	pmu.SetConfig(newBenchConfig(1))
+	pmu.Config2.DataRate = 50
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	defer pmu.Stop()
+
+	pdc := NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	_, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, pdc.Start())
+	_, err = pdc.ReadFrame()
+	require.NoError(t, err)
+	require.NoError(t, pdc.Stop())
+
+	// Let the write deadline of the last data frame expire
+	time.Sleep(3 * clientWriteTimeout)
+	require.NoError(t, pdc.SendCommand(CmdCfg2))
+	require.NoError(t, pdc.Socket.SetReadDeadline(time.Now().Add(time.Second)))
+	for {
+		frame, err := pdc.ReadFrame()
+		require.NoError(t, err)
+		if _, ok := frame.(*ConfigFrame); ok {
+			break
+		}
+	}
+}
+
+func TestPMUWithoutHeader(t *testing.T) {
+	pmu := NewPMU()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	defer pmu.Stop()
+
+	pdc := NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	// The header request is ignored rather than crashing the server
+	require.NoError(t, pdc.SendCommand(CmdHeader))
+	time.Sleep(100 * time.Millisecond)
+	_, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+}
+
+func TestPMUClock(t *testing.T) {
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+	pmu.SetClock(func(t time.Time) (time.Time, uint8) {
+		return time.Unix(1700000000, 250000000), 0x0B
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	defer pmu.Stop()
+
+	pdc := NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	_, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, pdc.Start())
+
+	frame, err := pdc.ReadFrame()
+	require.NoError(t, err)
+	df, ok := frame.(*DataFrame)
+	require.True(t, ok)
+	require.Equal(t, uint32(1700000000), df.SOC)
+	require.Equal(t, uint32(0x0B03D090), df.FracSec)
+}
+
+func TestPMUUDP(t *testing.T) {
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+	require.NoError(t, pmu.StartUDP("127.0.0.1:0"))
+	defer pmu.Stop()
+
+	conn, err := net.Dial("udp", pmu.packetConns[0].LocalAddr().String())
+	require.NoError(t, err)
+	pdc := NewPDC(1)
+	pdc.Socket = conn
+	defer pdc.Disconnect()
+
+	cfg, err := pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.Equal(t, int16(50), cfg.DataRate)
+	require.NoError(t, pdc.Start())
+
+	for i := 0; i < 5; i++ {
+		frame, err := pdc.ReadFrame()
+		require.NoError(t, err)
+		require.IsType(t, &DataFrame{}, frame)
+	}
+}
+
+func TestPMUStreamUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+	require.NoError(t, pmu.StreamUDP(listener.LocalAddr().String(), time.Minute))
+	defer pmu.Stop()
+
+	buffer := make([]byte, maxDatagramSize)
+	require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := listener.ReadFrom(buffer)
+	require.NoError(t, err)
+	frame, err := UnpackFrame(buffer[:n], nil)
+	require.NoError(t, err)
+	cfg, ok := frame.(*ConfigFrame)
+	require.True(t, ok)
+
+	n, _, err = listener.ReadFrom(buffer)
+	require.NoError(t, err)
+	frame, err = UnpackFrame(buffer[:n], cfg)
+	require.NoError(t, err)
+	require.IsType(t, &DataFrame{}, frame)
+}
+
+func TestPMUUDPDataPort(t *testing.T) {
+	data, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = data.Close() }()
+
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+	pmu.SetUDPDataPort(data.LocalAddr().(*net.UDPAddr).Port)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	defer pmu.Stop()
+
+	pdc := NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	defer pdc.Disconnect()
+
+	cfg, err := pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, pdc.Start())
+
+	buffer := make([]byte, maxDatagramSize)
+	require.NoError(t, data.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for i := 0; i < 5; i++ {
+		n, _, err := data.ReadFrom(buffer)
+		require.NoError(t, err)
+		frame, err := UnpackFrame(buffer[:n], cfg)
+		require.NoError(t, err)
+		require.IsType(t, &DataFrame{}, frame)
+	}
+}
+
+func TestPMUUDPPeers(t *testing.T) {
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.Config2.DataRate = 50
+	pmu.SetUDPPeerOptions(UDPPeerOptions{
+		MaxPeers:    1,
+		IdleTimeout: 100 * time.Millisecond,
+		Allow:       []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	})
+	require.NoError(t, pmu.StartUDP("127.0.0.1:0"))
+	defer pmu.Stop()
+
+	peers := func() int { return clientCount(pmu) }
+	dial := func() *PDC {
+		conn, err := net.Dial("udp", pmu.packetConns[0].LocalAddr().String())
+		require.NoError(t, err)
+		pdc := NewPDC(1)
+		pdc.Socket = conn
+		t.Cleanup(pdc.Disconnect)
+		return pdc
+	}
+
+	// The second peer is dropped until the first one is idle
+	first, second := dial(), dial()
+	_, err := first.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, second.SendCommand(CmdCfg2))
+	require.NoError(t, second.Socket.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = second.ReadFrame()
+	require.Error(t, err)
+	require.Eventually(t, func() bool { return peers() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// A stop command removes the peer at once
+	require.NoError(t, second.Socket.SetReadDeadline(time.Time{}))
+	_, err = second.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, second.Start())
+	_, err = second.ReadFrame()
+	require.NoError(t, err)
+	require.NoError(t, second.SendCommand(CmdStop))
+	require.Eventually(t, func() bool { return peers() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPMUUDPAllow(t *testing.T) {
+	pmu := NewPMU()
+	pmu.Config2 = newBenchConfig(1)
+	pmu.SetUDPPeerOptions(UDPPeerOptions{Allow: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}})
+	require.NoError(t, pmu.StartUDP("127.0.0.1:0"))
+	defer pmu.Stop()
+
+	conn, err := net.Dial("udp", pmu.packetConns[0].LocalAddr().String())
+	require.NoError(t, err)
+	pdc := NewPDC(1)
+	pdc.Socket = conn
+	defer pdc.Disconnect()
+
+	require.NoError(t, pdc.SendCommand(CmdCfg2))
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, err = pdc.ReadFrame()
+	require.Error(t, err)
+	require.Zero(t, clientCount(pmu))
+}
+
+// clientCount returns the number of clients served by p
+func clientCount(p *PMU) int {
+	if clients := p.clients.Load(); clients != nil {
+		return len(*clients)
+	}
+	return 0
+}
@@ -0,0 +1,374 @@
+package synchrophasor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxDatagramSize is the largest UDP payload
+const maxDatagramSize = 65535
+
+// StartUDP serves PDCs over UDP on address. Commands arrive as datagrams and
+// are answered to their sender, which receives the data frames after a start
+// command, one frame per datagram, until it sends a stop command. It may be
+// combined with Start and StartTLS.
+func (p *PMU) StartUDP(address string) error {
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+
+	p.log().WithFields(log.Fields{
+		"address": pc.LocalAddr().String(),
+		"udp":     true,
+	}).Info("PMU server listening")
+	p.addPacketConn(pc)
+
+	go p.serveUDP(pc)
+	return nil
+}
+
+// StreamUDP sends the data frames spontaneously to address, a unicast or
+// multicast destination, without waiting for commands. CFG-2 is sent first
+// and then every configInterval, so that listeners learn the configuration
+// from the stream; 0 sends it once.
+func (p *PMU) StreamUDP(address string, configInterval time.Duration) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return err
+	}
+
+	p.log().WithFields(log.Fields{
+		"destination": addr.String(),
+		"udp":         true,
+	}).Info("PMU server streaming")
+	p.addPacketConn(pc)
+
+	client := newPMUClient(&udpPeer{pc: pc, addr: addr})
+	client.sendData.Store(true)
+	p.addClient(client)
+	go p.clientWriter(client)
+	go p.repeatConfig(client, configInterval)
+
+	// Nothing is expected from the destination, wait for the socket to close
+	go func() {
+		buffer := make([]byte, maxDatagramSize)
+		for {
+			if _, _, err := pc.ReadFrom(buffer); errors.Is(err, net.ErrClosed) {
+				break
+			}
+		}
+		close(client.done)
+		p.removeClient(client)
+	}()
+	return nil
+}
+
+// UDPPeerOptions limits the PDCs served by StartUDP, which are not connected
+// and only known by the commands they send
+type UDPPeerOptions struct {
+	// MaxPeers is the largest number of peers served at once, defaults to 64.
+	// Commands of further peers are dropped until a peer is removed.
+	MaxPeers int
+	// IdleTimeout removes peers not receiving data that sent no command for
+	// this long, defaults to one minute
+	IdleTimeout time.Duration
+	// DataTimeout removes peers receiving data that sent no command for this
+	// long. C37.118 has no keepalive, so such PDCs must repeat the start
+	// command. 0 keeps them until they send a stop command.
+	DataTimeout time.Duration
+	// Allow restricts the peers to these address ranges, empty allows all
+	Allow []netip.Prefix
+}
+
+// SetUDPPeerOptions limits the peers served by StartUDP. Peers are always
+// removed when they send a stop command. It must be called before the server
+// is started.
+func (p *PMU) SetUDPPeerOptions(opts UDPPeerOptions) {
+	p.udpPeers = opts
+}
+
+// SetUDPDataPort sends the data frames of TCP clients as UDP datagrams to
+// port on the address of the client, while commands and responses stay on
+// the TCP connection. 0 sends the data over TCP. It must be called before the
+// server is started.
+func (p *PMU) SetUDPDataPort(port int) {
+	p.udpDataPort = port
+}
+
+// addPacketConn registers a UDP socket, starting the data sender with the
+// first listener or socket
+func (p *PMU) addPacketConn(pc net.PacketConn) {
+	p.listenersMux.Lock()
+	first := len(p.listeners) == 0 && len(p.packetConns) == 0
+	p.packetConns = append(p.packetConns, pc)
+	p.running.Store(true)
+	p.Running = true
+	if first {
+		p.startSender()
+	}
+	p.listenersMux.Unlock()
+}
+
+// udpSession is a peer served by serveUDP
+type udpSession struct {
+	client *pmuClient
+	// seen is the time of the peer's latest command
+	seen time.Time
+}
+
+// serveUDP answers the commands received on pc until it is closed
+func (p *PMU) serveUDP(pc net.PacketConn) {
+	opts := p.udpPeers
+	if opts.MaxPeers <= 0 {
+		opts.MaxPeers = 64
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = time.Minute
+	}
+	// Idle peers are looked for at a quarter of the shortest timeout
+	sweep := opts.IdleTimeout
+	if opts.DataTimeout > 0 {
+		sweep = min(sweep, opts.DataTimeout)
+	}
+	sweep /= 4
+
+	peers := make(map[string]*udpSession)
+	remove := func(key, reason string) {
+		client := peers[key].client
+		delete(peers, key)
+		close(client.done)
+		p.removeClient(client)
+		if p.metrics != nil {
+			p.metrics.RecordClientDisconnected()
+		}
+		p.log().WithField("client", key).Info("UDP PDC client removed, " + reason)
+	}
+	defer func() {
+		for key := range peers {
+			remove(key, "server stopped")
+		}
+	}()
+
+	buffer := make([]byte, maxDatagramSize)
+	lastSweep := time.Now()
+	for {
+		now := time.Now()
+		if now.Sub(lastSweep) >= sweep {
+			lastSweep = now
+			for key, peer := range peers {
+				timeout := opts.IdleTimeout
+				if peer.client.sendData.Load() {
+					timeout = opts.DataTimeout
+				}
+				if timeout > 0 && now.Sub(peer.seen) > timeout {
+					remove(key, "idle")
+				}
+			}
+		}
+
+		_ = pc.SetReadDeadline(lastSweep.Add(sweep))
+		n, addr, err := pc.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				continue
+			}
+			if !p.running.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			p.log().WithError(err).Error("Error reading UDP command")
+			continue
+		}
+		key := addr.String()
+		if !allowed(opts.Allow, addr) {
+			p.log().WithField("client", key).Debug("UDP command from address not allowed")
+			if p.metrics != nil {
+				p.metrics.RecordFrameError("peer_not_allowed")
+			}
+			continue
+		}
+		if p.metrics != nil {
+			p.metrics.RecordBytesReceived(n)
+		}
+
+		cmd, err := unpackCommand(buffer[:n])
+		if err != nil {
+			p.log().WithField("client", key).WithError(err).Error("Error unpacking frame")
+			if p.metrics != nil {
+				p.metrics.RecordFrameError("unpack_error")
+			}
+			continue
+		}
+
+		peer, ok := peers[key]
+		if !ok {
+			if len(peers) >= opts.MaxPeers {
+				p.log().WithField("client", key).Warn("UDP PDC client rejected, too many peers")
+				if p.metrics != nil {
+					p.metrics.RecordFrameError("too_many_peers")
+				}
+				continue
+			}
+			p.log().WithField("client", key).Info("New UDP PDC client")
+			peer = &udpSession{client: newPMUClient(&udpPeer{pc: pc, addr: addr})}
+			peers[key] = peer
+			p.addClient(peer.client)
+			if p.metrics != nil {
+				p.metrics.RecordClientConnected()
+			}
+			go p.clientWriter(peer.client)
+		}
+		peer.seen = time.Now()
+		p.handleCommand(peer.client, cmd)
+		if cmd.CMD == CmdStop {
+			remove(key, "stopped")
+		}
+	}
+}
+
+// allowed reports whether addr is in one of the prefixes, or prefixes is
+// empty
+func allowed(prefixes []netip.Prefix, addr net.Addr) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	udp, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	ip := udp.AddrPort().Addr().Unmap()
+	return slices.ContainsFunc(prefixes, func(prefix netip.Prefix) bool {
+		return prefix.Contains(ip)
+	})
+}
+
+// unpackCommand unpacks a datagram holding a command frame
+func unpackCommand(data []byte) (*CommandFrame, error) {
+	if len(data) < 4 || int(binary.BigEndian.Uint16(data[2:4])) > len(data) {
+		return nil, fmt.Errorf("%w: truncated datagram", ErrInvalidSize)
+	}
+	frame, err := UnpackFrame(data[:binary.BigEndian.Uint16(data[2:4])], nil)
+	if err != nil {
+		return nil, err
+	}
+	cmd, ok := frame.(*CommandFrame)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a command frame", ErrInvalidFrame)
+	}
+	return cmd, nil
+}
+
+// repeatConfig sends CFG-2 to a spontaneous stream now and every interval
+// until the client is done
+func (p *PMU) repeatConfig(client *pmuClient, interval time.Duration) {
+	send := func() {
+		p.configMu.Lock()
+		p.Config2.SetTime(nil, nil)
+		frame, err := p.Config2.Pack()
+		p.configMu.Unlock()
+		if err == nil {
+			_, err = client.conn.Write(frame)
+		}
+		if err != nil {
+			p.log().WithField("client", client.conn.RemoteAddr().String()).WithError(err).Error("Error sending configuration")
+			return
+		}
+		if p.metrics != nil {
+			p.metrics.RecordConfigFrameSent(len(frame))
+		}
+	}
+
+	send()
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			send()
+		case <-client.done:
+			return
+		}
+	}
+}
+
+// dialUDPData opens the UDP data channel of a TCP client
+func (p *PMU) dialUDPData(conn net.Conn) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	data, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(p.udpDataPort)))
+	if err != nil {
+		return nil, err
+	}
+	return datagramConn{data}, nil
+}
+
+// datagramConn sends every write as one datagram. It hides the vectored
+// writes of the UDP socket, which would join the frames of a batch.
+type datagramConn struct {
+	net.Conn
+}
+
+// udpPeer is a PDC reached through a shared UDP socket. Only writes are
+// supported, the socket is read by its owner.
+type udpPeer struct {
+	pc   net.PacketConn
+	addr net.Addr
+}
+
+// Read is not supported, commands are read from the shared socket
+func (u *udpPeer) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("%w: read from UDP peer", ErrNotImpl)
+}
+
+// Write sends b as one datagram to the peer
+func (u *udpPeer) Write(b []byte) (int, error) {
+	return u.pc.WriteTo(b, u.addr)
+}
+
+// Close does nothing, the shared socket is closed by its owner
+func (u *udpPeer) Close() error {
+	return nil
+}
+
+// LocalAddr returns the address of the shared socket
+func (u *udpPeer) LocalAddr() net.Addr {
+	return u.pc.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer
+func (u *udpPeer) RemoteAddr() net.Addr {
+	return u.addr
+}
+
+// SetDeadline does nothing, deadlines would affect all peers
+func (u *udpPeer) SetDeadline(time.Time) error {
+	return nil
+}
+
+// SetReadDeadline does nothing, deadlines would affect all peers
+func (u *udpPeer) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline does nothing, deadlines would affect all peers
+func (u *udpPeer) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package power derives active, reactive and apparent power and the power
+// factor from voltage and current phasor pairs, single or three-phase, and
+// appends them to the stream as analog channels that can be republished or
+// exported like any other
+package power
+
+import (
+	"fmt"
+	"math/cmplx"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Pair configures the power flow measured by voltage and current phasors
+type Pair struct {
+	// Name prefixes the derived analog channels "<Name> P", "<Name> Q",
+	// "<Name> S" and "<Name> PF", so it may be 13 characters long
+	Name string
+	// Voltage lists the phase-to-neutral voltage phasors named "Sub 1.VA",
+	// one for single-phase or three for three-phase power. The derived
+	// channels are added to the station of the first one.
+	Voltage []string
+	// Current lists the current phasors of the same phases, in the same order
+	Current []string
+}
+
+// Options configures a Calculator
+type Options struct {
+	Pairs []Pair
+	// IDCode of the derived stream, zero keeps the ID code of the
+	// configuration
+	IDCode uint16
+}
+
+// pair is a resolved Pair
+type pair struct {
+	voltage, current []synchrophasor.PhasorRef
+	// station receives the derived channels
+	station int
+}
+
+// Calculator appends power channels to measurement sets. It is not safe for
+// concurrent use.
+type Calculator struct {
+	opts  Options
+	cfg   *synchrophasor.ConfigFrame
+	out   *synchrophasor.DerivedStream
+	pairs []pair
+	set   synchrophasor.Measurements
+}
+
+// New creates a calculator for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Calculator, error) {
+	c := &Calculator{opts: opts}
+	if err := c.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetConfig replaces the configuration
+func (c *Calculator) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	resolve := func(names []string) ([]synchrophasor.PhasorRef, error) {
+		refs := make([]synchrophasor.PhasorRef, len(names))
+		for i, name := range names {
+			ref, ok := cfg.FindPhasor(name)
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown phasor %q", synchrophasor.ErrInvalidParameter, name)
+			}
+			refs[i] = ref
+		}
+		return refs, nil
+	}
+
+	out := synchrophasor.NewDerivedStream(cfg, c.opts.IDCode)
+	pairs := make([]pair, len(c.opts.Pairs))
+	for i, p := range c.opts.Pairs {
+		if n := len(p.Voltage); n != 1 && n != 3 || len(p.Current) != n {
+			return fmt.Errorf("%w: pair %q needs one or three voltage and current phasors",
+				synchrophasor.ErrInvalidParameter, p.Name)
+		}
+		if p.Name == "" || len(p.Name) > 13 {
+			return fmt.Errorf("%w: pair name %q empty or longer than 13 characters",
+				synchrophasor.ErrInvalidParameter, p.Name)
+		}
+		var err error
+		if pairs[i].voltage, err = resolve(p.Voltage); err != nil {
+			return err
+		}
+		if pairs[i].current, err = resolve(p.Current); err != nil {
+			return err
+		}
+
+		station := pairs[i].voltage[0].Station
+		pairs[i].station = station
+		for _, q := range []string{"P", "Q", "S", "PF"} {
+			out.AddAnalog(station, p.Name+" "+q)
+		}
+	}
+
+	c.cfg, c.out, c.pairs = cfg, out, pairs
+	return nil
+}
+
+// Config returns the configuration extended by the power channels
+func (c *Calculator) Config() *synchrophasor.ConfigFrame {
+	return c.out.Config
+}
+
+// Write calls fn with m extended by the power channels of the pairs. Stations
+// receiving them are flagged as modified, and the channels of pairs with
+// invalid phasors are NaN. The set passed to fn is only valid during the call
+// and m is not modified.
+func (c *Calculator) Write(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	if len(m.Stations) != len(c.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(c.cfg.PMUStationList))
+	}
+	for i, pmu := range c.cfg.PMUStationList {
+		if st := &m.Stations[i]; len(st.Phasors) != len(pmu.PhasorValues) || len(st.Analog) != len(pmu.AnalogValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	c.out.CopyTo(m, &c.set)
+	for _, p := range c.pairs {
+		var s complex128
+		for k := range p.voltage {
+			v, i := p.voltage[k], p.current[k]
+			vs, is := &m.Stations[v.Station], &m.Stations[i.Station]
+			if vs.Stat&synchrophasor.StatDataError != 0 || is.Stat&synchrophasor.StatDataError != 0 {
+				s = cmplx.NaN()
+				break
+			}
+			s += Power(vs.Phasors[v.Index], is.Phasors[i.Index])
+		}
+		st := &c.set.Stations[p.station]
+		st.Analog = append(st.Analog,
+			float32(real(s)), float32(imag(s)), float32(cmplx.Abs(s)), float32(PowerFactor(s)))
+	}
+	return fn(&c.set)
+}
+
+// Power returns the complex power S = P + jQ of a phase from its RMS voltage
+// and current phasors
+func Power(v, i complex128) complex128 {
+	return v * cmplx.Conj(i)
+}
+
+// PowerFactor returns P/|S|, negative for reversed active power flow, and
+// zero if S is zero
+func PowerFactor(s complex128) float64 {
+	abs := cmplx.Abs(s)
+	if abs == 0 {
+		return 0
+	}
+	return real(s) / abs
+}
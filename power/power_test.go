@@ -0,0 +1,108 @@
+package power
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		for _, phase := range []string{"A", "B", "C"} {
+			station.AddPhasor("V"+phase, 1, synchrophasor.PhunitVoltage)
+			station.AddPhasor("I"+phase, 1, synchrophasor.PhunitCurrent)
+		}
+		station.AddAnalog("T", 1, 0)
+	})
+	cfg.IDCode = 7
+	return cfg
+}
+
+// set returns balanced three-phase measurements of 230 V and 100 A lagging
+// by 30 degrees
+func set(cfg *synchrophasor.ConfigFrame) *synchrophasor.Measurements {
+	for _, pmu := range cfg.PMUStationList {
+		for k := 0; k < 3; k++ {
+			shift := -float64(k) * 2 * math.Pi / 3
+			pmu.PhasorValues[2*k] = cmplx.Rect(230, shift)
+			pmu.PhasorValues[2*k+1] = cmplx.Rect(100, shift-math.Pi/6)
+		}
+		pmu.AnalogValues[0] = 20
+	}
+	return testutil.Measurements(cfg, 0)
+}
+
+func TestCalculator(t *testing.T) {
+	cfg := testConfig()
+	c, err := New(cfg, Options{IDCode: 70, Pairs: []Pair{
+		{Name: "Line", Voltage: []string{"Sub 2.VA", "Sub 2.VB", "Sub 2.VC"},
+			Current: []string{"Sub 2.IA", "Sub 2.IB", "Sub 2.IC"}},
+		{Name: "Line A", Voltage: []string{"Sub 2.VA"}, Current: []string{"Sub 1.IA"}},
+	}})
+	require.NoError(t, err)
+
+	out := c.Config()
+	require.Equal(t, uint16(70), out.IDCode)
+	require.Len(t, cfg.PMUStationList[1].CHNAMAnalog, 1)
+	sub := out.PMUStationList[1]
+	require.Equal(t, uint16(9), sub.Annmr)
+	require.Equal(t, "Line PF", strings.TrimSpace(sub.CHNAMAnalog[4]))
+	require.Equal(t, "Line A P", strings.TrimSpace(sub.CHNAMAnalog[5]))
+	require.True(t, sub.FormatAnalogType())
+	require.Equal(t, uint16(1), out.PMUStationList[0].Annmr)
+
+	var got *synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		got = m
+		return nil
+	}
+	in := set(cfg)
+	require.NoError(t, c.Write(in, keep))
+	require.Equal(t, uint16(70), got.PMUID)
+	analog := got.Stations[1].Analog
+	require.Len(t, analog, 9)
+	require.Equal(t, float32(20), analog[0])
+	require.InDelta(t, 3*23000*math.Sqrt(3)/2, analog[1], 1)
+	require.InDelta(t, 3*23000*0.5, analog[2], 1)
+	require.InDelta(t, 3*23000, analog[3], 1)
+	require.InDelta(t, math.Sqrt(3)/2, analog[4], 1e-6)
+	require.InDelta(t, 23000, analog[7], 1)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), got.Stations[1].Stat)
+	require.Equal(t, uint16(0), got.Stations[0].Stat)
+	require.Len(t, in.Stations[1].Analog, 1)
+
+	// The derived stream packs with its configuration
+	df := synchrophasor.NewDataFrame(out)
+	require.NoError(t, df.SetMeasurements(got))
+	_, err = df.Pack()
+	require.NoError(t, err)
+
+	// Invalid phasors
+	in.Stations[0].Stat = 0x8000
+	require.NoError(t, c.Write(in, keep))
+	require.InDelta(t, 3*23000, got.Stations[1].Analog[3], 1)
+	require.True(t, math.IsNaN(float64(got.Stations[1].Analog[5])))
+	require.True(t, math.IsNaN(float64(got.Stations[1].Analog[8])))
+
+	require.ErrorIs(t, c.Write(&synchrophasor.Measurements{}, keep), synchrophasor.ErrInvalidParameter)
+}
+
+func TestNew(t *testing.T) {
+	cfg := testConfig()
+	for _, p := range []Pair{
+		{Name: "L", Voltage: []string{"Sub 1.VA", "Sub 1.VB"}, Current: []string{"Sub 1.IA", "Sub 1.IB"}},
+		{Name: "L", Voltage: []string{"Sub 1.VA"}, Current: []string{"Sub 1.IA", "Sub 1.IB", "Sub 1.IC"}},
+		{Name: "Long line name", Voltage: []string{"Sub 1.VA"}, Current: []string{"Sub 1.IA"}},
+		{Name: "L", Voltage: []string{"Sub 3.VA"}, Current: []string{"Sub 1.IA"}},
+	} {
+		_, err := New(cfg, Options{Pairs: []Pair{p}})
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+	require.InDelta(t, -1, PowerFactor(Power(230, -10)), 1e-9)
+	require.Zero(t, PowerFactor(0))
+}
@@ -0,0 +1,19 @@
+package synchrophasor
+
+import "time"
+
+// DataProvider supplies measurement values to a PMU server.
+// Update is called from the sender loop before each data frame is packed and
+// sets the station values (phasors, analogs, digitals, frequency, STAT) of cfg
+// for the given time. Returning an error skips the frame.
+type DataProvider interface {
+	Update(cfg *ConfigFrame, t time.Time) error
+}
+
+// DataProviderFunc adapts an ordinary function to the DataProvider interface
+type DataProviderFunc func(cfg *ConfigFrame, t time.Time) error
+
+// Update calls f(cfg, t)
+func (f DataProviderFunc) Update(cfg *ConfigFrame, t time.Time) error {
+	return f(cfg, t)
+}
@@ -0,0 +1,252 @@
+// Package quality scores the data quality of measurement streams from the
+// STAT flags and time quality of every station, the sanity of the timestamps,
+// the latency and the recent gaps, and attaches the scores to the
+// measurements, so that analytics can weight or discard bad data
+package quality
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// STAT bits of a C37.118 station
+const (
+	statSyncError = 0x2000
+	// statTimeQuality is the 3 bit PMU time quality code
+	statTimeQuality = 0x01C0
+	// statUnlocked is the 2 bit time since the clock lost its lock
+	statUnlocked = 0x0030
+)
+
+// Options configures a Scorer
+type Options struct {
+	// Latency is the latency still scored as good, defaults to 100 ms
+	Latency time.Duration
+	// MaxLatency is the latency scored as unusable, defaults to 2 s. The
+	// score falls linearly in between.
+	MaxLatency time.Duration
+	// MaxSkew is how far timestamps may lie in the future of the receive
+	// time before they are considered insane, defaults to 100 ms
+	MaxSkew time.Duration
+	// Window is the period of the gap history, defaults to 10 s
+	Window time.Duration
+}
+
+// Score is the quality of a measurement set. The scores range from 0 for
+// unusable to 1 for good data.
+type Score struct {
+	// Timestamp scores the timestamp, 0 if it is not after the previous one
+	// or lies in the future, 0.5 if it is not aligned to the data rate
+	Timestamp float64
+	// Latency scores the delay between the timestamp and the receive time,
+	// 1 if the receive time is not known
+	Latency float64
+	// Completeness is the share of the sets expected within the window that
+	// were received
+	Completeness float64
+	// Stream is the product of the stream scores, which the station scores
+	// are multiplied with
+	Stream float64
+}
+
+// event is a received set with the number of sets missing before it
+type event struct {
+	time   int64
+	missed int64
+}
+
+// Scorer scores measurement sets of one stream. It is safe for concurrent
+// use, but the sets must be scored in the order of their timestamps.
+type Scorer struct {
+	opts Options
+	mu   sync.Mutex
+	cfg  *synchrophasor.ConfigFrame
+	// last is the time of the latest set, zero before the first one
+	last    int64
+	history []event
+	missed  int64
+}
+
+// New creates a scorer for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) *Scorer {
+	if opts.Latency <= 0 {
+		opts.Latency = 100 * time.Millisecond
+	}
+	if opts.MaxLatency <= opts.Latency {
+		opts.MaxLatency = max(2*time.Second, 2*opts.Latency)
+	}
+	if opts.MaxSkew <= 0 {
+		opts.MaxSkew = 100 * time.Millisecond
+	}
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	return &Scorer{opts: opts, cfg: cfg}
+}
+
+// SetConfig replaces the configuration, restarting the gap history
+func (s *Scorer) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+	s.last, s.history, s.missed = 0, s.history[:0], 0
+}
+
+// Score scores m as received now, see ScoreAt
+func (s *Scorer) Score(m *synchrophasor.Measurements) (Score, error) {
+	return s.ScoreAt(m, time.Now())
+}
+
+// ScoreAt scores m as received at the given time, setting the Quality of its
+// stations to the product of the stream score and the station's own score.
+// A zero receive time skips the latency and clock checks, e.g. for recorded
+// data.
+func (s *Scorer) ScoreAt(m *synchrophasor.Measurements, received time.Time) (Score, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(m.Stations) != len(s.cfg.PMUStationList) {
+		return Score{}, fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.cfg.PMUStationList))
+	}
+
+	t := m.UnixNano()
+	score := Score{Timestamp: 1, Latency: 1}
+	if !received.IsZero() {
+		delay := received.UnixNano() - t
+		score.Latency = s.latency(delay)
+		if -delay > int64(s.opts.MaxSkew) {
+			score.Timestamp = 0
+		}
+	}
+	interval := s.interval()
+	if !s.aligned(t, interval) {
+		score.Timestamp = min(score.Timestamp, 0.5)
+	}
+	if t <= s.last {
+		score.Timestamp = 0
+	} else {
+		s.record(t, interval)
+	}
+	score.Completeness = s.completeness(interval)
+	score.Stream = score.Timestamp * score.Latency * score.Completeness
+
+	for i := range m.Stations {
+		st := &m.Stations[i]
+		st.Quality = float32(score.Stream * station(st.Stat))
+	}
+	return score, nil
+}
+
+// latency scores a delay in nanoseconds
+func (s *Scorer) latency(delay int64) float64 {
+	good, bad := int64(s.opts.Latency), int64(s.opts.MaxLatency)
+	switch {
+	case delay <= good:
+		return 1
+	case delay >= bad:
+		return 0
+	}
+	return float64(bad-delay) / float64(bad-good)
+}
+
+// record adds a set at time t to the gap history
+func (s *Scorer) record(t, interval int64) {
+	var missed int64
+	if s.last != 0 && interval > 0 {
+		missed = max(0, (t-s.last+interval/2)/interval-1)
+	}
+	s.last = t
+	s.history = append(s.history, event{time: t, missed: missed})
+	s.missed += missed
+
+	// Drop the sets that left the window
+	from := t - int64(s.opts.Window)
+	n := 0
+	for n < len(s.history) && s.history[n].time <= from {
+		s.missed -= s.history[n].missed
+		n++
+	}
+	if n > 0 {
+		s.history = append(s.history[:0], s.history[n:]...)
+	}
+}
+
+// completeness returns the share of the sets received within the window.
+// Sets missing before the oldest set of the window are attributed to it, so
+// gaps count until the set that ended them leaves the window.
+func (s *Scorer) completeness(interval int64) float64 {
+	if interval <= 0 || len(s.history) == 0 {
+		return 1
+	}
+	received := int64(len(s.history))
+	return float64(received) / float64(received+s.missed)
+}
+
+// interval returns the time between sets at the configured data rate, zero
+// if it is not set
+func (s *Scorer) interval() int64 {
+	switch rate := int64(s.cfg.DataRate); {
+	case rate > 0:
+		return int64(time.Second) / rate
+	case rate < 0:
+		// Negative data rates are seconds per frame
+		return -rate * int64(time.Second)
+	}
+	return 0
+}
+
+// aligned reports whether t lies within a tenth of the interval of a
+// timestamp of the data rate
+func (s *Scorer) aligned(t, interval int64) bool {
+	var off int64
+	switch rate := int64(s.cfg.DataRate); {
+	case rate > 0:
+		// Timestamps at rates not dividing a second are aligned per second
+		ns := t % int64(time.Second)
+		k := (ns*rate + int64(time.Second)/2) / int64(time.Second)
+		off = ns - k*int64(time.Second)/rate
+	case rate < 0:
+		off = t % interval
+		off = min(off, interval-off)
+	default:
+		return true
+	}
+	return max(off, -off) <= interval/10
+}
+
+// station scores the STAT word of a station
+func station(stat uint16) float64 {
+	if stat&synchrophasor.StatDataError != 0 {
+		return 0
+	}
+	score := 1.0
+	if stat&statSyncError != 0 {
+		score *= 0.5
+	}
+	if stat&synchrophasor.StatDataModified != 0 {
+		score *= 0.8
+	}
+
+	// Time errors of 10 µs and below keep the phase error below 0.25°
+	switch (stat & statTimeQuality) >> 6 {
+	case 4:
+		score *= 0.5
+	case 5:
+		score *= 0.2
+	case 6, 7:
+		score = 0
+	}
+	switch (stat & statUnlocked) >> 4 {
+	case 1:
+		score *= 0.9
+	case 2:
+		score *= 0.7
+	case 3:
+		score *= 0.5
+	}
+	return score
+}
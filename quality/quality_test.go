@@ -0,0 +1,109 @@
+package quality
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// STAT of Sub 2
+func set(cfg *synchrophasor.ConfigFrame, i int, stat uint16) *synchrophasor.Measurements {
+	cfg.PMUStationList[1].Stat = stat
+	return testutil.Measurements(cfg, i)
+}
+
+// at returns the time of frame i delayed by d
+func at(i int, d time.Duration) time.Time {
+	return testutil.FrameTime(10, i).Add(d)
+}
+
+func TestScore(t *testing.T) {
+	cfg := testConfig()
+	s := New(cfg, Options{Latency: 100 * time.Millisecond, MaxLatency: 2 * time.Second})
+
+	for i := 0; i < 3; i++ {
+		score, err := s.ScoreAt(set(cfg, i, 0), at(i, 50*time.Millisecond))
+		require.NoError(t, err)
+		require.Equal(t, Score{Timestamp: 1, Latency: 1, Completeness: 1, Stream: 1}, score)
+	}
+
+	// Frames 3 and 4 are missing, frame 5 arrives late
+	m := set(cfg, 5, 0x2000|5<<6)
+	score, err := s.ScoreAt(m, at(5, 1050*time.Millisecond))
+	require.NoError(t, err)
+	require.InDelta(t, 0.5, score.Latency, 1e-9)
+	require.InDelta(t, 4.0/6, score.Completeness, 1e-9)
+	require.InDelta(t, 1.0/3, score.Stream, 1e-9)
+	require.InDelta(t, 1.0/3, m.Stations[0].Quality, 1e-6)
+	require.InDelta(t, 1.0/3*0.5*0.2, m.Stations[1].Quality, 1e-6)
+
+	// Data errors are unusable
+	m = set(cfg, 6, 0x4000)
+	_, err = s.ScoreAt(m, time.Time{})
+	require.NoError(t, err)
+	require.Zero(t, m.Stations[1].Quality)
+	require.NotZero(t, m.Stations[0].Quality)
+
+	// Repeated, future and misaligned timestamps
+	score, err = s.ScoreAt(set(cfg, 6, 0), time.Time{})
+	require.NoError(t, err)
+	require.Zero(t, score.Timestamp)
+	score, err = s.ScoreAt(set(cfg, 7, 0), at(7, -200*time.Millisecond))
+	require.NoError(t, err)
+	require.Zero(t, score.Timestamp)
+	m = set(cfg, 8, 0)
+	m.Time += 0.03
+	score, err = s.ScoreAt(m, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 0.5, score.Timestamp)
+
+	// The gap leaves the window
+	for i := 9; i < 160; i++ {
+		score, err = s.ScoreAt(set(cfg, i, 0), time.Time{})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1.0, score.Completeness)
+
+	_, err = s.ScoreAt(&synchrophasor.Measurements{}, time.Time{})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
+
+func TestScoreRates(t *testing.T) {
+	cfg := testConfig()
+	cfg.DataRate = 60
+	s := New(cfg, Options{})
+	for i := 0; i < 120; i++ {
+		m := &synchrophasor.Measurements{
+			Time:     1700000000 + float64(i/60) + float64(uint32(i%60)*1000000/60)/1000000,
+			Stations: make([]synchrophasor.StationMeasurement, 2),
+		}
+		score, err := s.ScoreAt(m, time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, 1.0, score.Stream, "frame %d", i)
+	}
+
+	// One frame every two seconds
+	cfg.DataRate = -2
+	s.SetConfig(cfg)
+	for i := 0; i < 3; i++ {
+		m := &synchrophasor.Measurements{
+			Time: 1700000000 + float64(4*i), Stations: make([]synchrophasor.StationMeasurement, 2),
+		}
+		score, err := s.ScoreAt(m, time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, 1.0, score.Timestamp)
+		if i > 0 {
+			require.InDelta(t, float64(i+1)/float64(2*i+1), score.Completeness, 1e-9)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package synchrophasor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backoff schedules reconnection attempts, doubling the delay between them
+// from Min up to Max
+type Backoff struct {
+	// Min is the delay before the first attempt, defaults to one second
+	Min time.Duration
+	// Max bounds the delay, defaults to 30 seconds
+	Max time.Duration
+}
+
+// Retry calls connect after Min and then with doubling delays up to Max
+// until it succeeds, passing the failed attempts to failed, if not nil, with
+// the delay before the next one. It returns false once stop is closed.
+func (b Backoff) Retry(stop <-chan struct{}, connect func() error, failed func(err error, retry time.Duration)) bool {
+	if b.Min <= 0 {
+		b.Min = time.Second
+	}
+	if b.Max <= 0 {
+		b.Max = 30 * time.Second
+	}
+
+	delay := b.Min
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		err := connect()
+		if err == nil {
+			return true
+		}
+		select {
+		case <-stop:
+			return false
+		default:
+		}
+		delay = min(2*delay, b.Max)
+		if failed != nil {
+			failed(err, delay)
+		}
+	}
+}
+
+// SameLayout returns an error unless cfg has the stations and channel counts
+// of c, so that the measurements of both are interchangeable, e.g. when the
+// configuration is fetched again after a reconnect
+func (c *ConfigFrame) SameLayout(cfg *ConfigFrame) error {
+	if len(cfg.PMUStationList) != len(c.PMUStationList) {
+		return fmt.Errorf("%w: configuration changed from %d to %d stations",
+			ErrInvalidParameter, len(c.PMUStationList), len(cfg.PMUStationList))
+	}
+	for i, pmu := range cfg.PMUStationList {
+		w := c.PMUStationList[i]
+		if pmu.Phnmr != w.Phnmr || pmu.Annmr != w.Annmr || pmu.Dgnmr != w.Dgnmr {
+			return fmt.Errorf("%w: configuration of station %s changed", ErrInvalidParameter, pmu.STN)
+		}
+	}
+	return nil
+}
+
+// IsFrameError reports whether err, returned by PDC.ReadFrame, concerns a
+// single invalid or unsupported frame, so that reading may go on
+func IsFrameError(err error) bool {
+	return errors.Is(err, ErrInvalidFrame) || errors.Is(err, ErrCRCFailed) ||
+		errors.Is(err, ErrInvalidSize) || errors.Is(err, ErrInvalidParameter) ||
+		errors.Is(err, ErrNotImpl)
+}
@@ -0,0 +1,48 @@
+package synchrophasor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffRetry(t *testing.T) {
+	b := Backoff{Min: time.Millisecond, Max: 4 * time.Millisecond}
+	attempts := 0
+	var delays []time.Duration
+	require.True(t, b.Retry(make(chan struct{}), func() error {
+		if attempts++; attempts < 5 {
+			return io.EOF
+		}
+		return nil
+	}, func(err error, retry time.Duration) {
+		require.ErrorIs(t, err, io.EOF)
+		delays = append(delays, retry)
+	}))
+	require.Equal(t, []time.Duration{2 * time.Millisecond, 4 * time.Millisecond, 4 * time.Millisecond,
+		4 * time.Millisecond}, delays)
+
+	stop := make(chan struct{})
+	close(stop)
+	require.False(t, Backoff{}.Retry(stop, func() error { return nil }, nil))
+}
+
+func TestConfigFrameSameLayout(t *testing.T) {
+	cfg := newBenchConfig(2)
+	require.NoError(t, cfg.SameLayout(newBenchConfig(2)))
+	require.ErrorIs(t, cfg.SameLayout(newBenchConfig(3)), ErrInvalidParameter)
+
+	other := newBenchConfig(2)
+	other.PMUStationList[1].AddAnalog("Q", 1, AnunitPow)
+	require.ErrorIs(t, cfg.SameLayout(other), ErrInvalidParameter)
+}
+
+func TestIsFrameError(t *testing.T) {
+	require.True(t, IsFrameError(fmt.Errorf("%w: bad", ErrCRCFailed)))
+	require.False(t, IsFrameError(io.EOF))
+	require.False(t, IsFrameError(errors.New("connection reset")))
+}
@@ -0,0 +1,493 @@
+// Package remotewrite pushes selected synchrophasor channels to a Prometheus
+// remote-write endpoint such as Prometheus, Mimir, Thanos or VictoriaMetrics
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ErrWrite is returned when the endpoint rejects a request
+var ErrWrite = errors.New("remote write failed")
+
+// Channel selects a group of channels to push
+type Channel uint
+
+// Channel groups, the metric name is the prefix followed by the given suffix
+const (
+	// ChannelFrequency pushes _frequency_hz per station
+	ChannelFrequency Channel = 1 << iota
+	// ChannelROCOF pushes _rocof_hz_per_second per station
+	ChannelROCOF
+	// ChannelVoltageMagnitude pushes _voltage_magnitude_volts per voltage phasor
+	ChannelVoltageMagnitude
+	// ChannelCurrentMagnitude pushes _current_magnitude_amperes per current phasor
+	ChannelCurrentMagnitude
+	// ChannelPhaseAngle pushes _phase_angle_degrees per phasor
+	ChannelPhaseAngle
+	// ChannelAnalog pushes _analog_value per analog channel
+	ChannelAnalog
+)
+
+// Options configures a remote-write sink
+type Options struct {
+	// URL is the push endpoint, e.g. http://localhost:9090/api/v1/write
+	URL string
+	// Channels defaults to frequency, ROCOF and voltage magnitudes
+	Channels Channel
+	// Decimation pushes every Nth measurement set, defaults to 1 (full rate)
+	Decimation int
+	// Prefix of the metric names, defaults to "synchrophasor"
+	Prefix string
+	// Labels are added to every series, e.g. a site or instance label
+	Labels map[string]string
+	// Headers are added to every request, e.g. Authorization or X-Scope-OrgID
+	Headers http.Header
+	// MaxSamples is the number of samples sent per request, defaults to 10000
+	MaxSamples int
+	// FlushInterval sends a partial batch once it is this old, defaults to one second
+	FlushInterval time.Duration
+	// MaxPending bounds the samples queued while the endpoint is slow or
+	// unavailable, defaults to ten batches. The oldest batches are dropped
+	// beyond it.
+	MaxPending int
+	// MinBackoff and MaxBackoff bound the exponential delay between retries
+	// of a failed batch, defaulting to 30 milliseconds and 5 seconds as in
+	// Prometheus
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Client defaults to an http.Client with a 10 second timeout
+	Client *http.Client
+}
+
+// labelName matches valid metric and label names
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// series is a time series and the samples pending for it
+type series struct {
+	labels     []byte
+	timestamps []int64
+	values     []float64
+}
+
+// channelRef points a series at a channel of a station
+type channelRef struct {
+	series  int
+	channel Channel
+	index   int
+}
+
+// batch is an encoded request and the number of samples it carries
+type batch struct {
+	body    []byte
+	samples int
+}
+
+// Sink batches samples and pushes them as remote-write v1 requests (snappy
+// compressed protobuf). Requests are sent by a background goroutine, so Write
+// never waits for the endpoint; Write, Flush and Close are not safe for
+// concurrent use. A failed batch is retried with exponential backoff when the
+// endpoint answers 429 or 5xx or cannot be reached, as the remote-write
+// specification requires, and dropped otherwise.
+type Sink struct {
+	opts     Options
+	series   []series
+	stations [][]channelRef
+	count    int
+	samples  int
+	first    time.Time
+	buf      []byte
+
+	// mu guards the queue and the state shared with the sender
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue holds the batches waiting to be sent, queued their samples
+	queue  []batch
+	queued int
+	// sending is set while a batch is posted, retrying after a batch failed
+	// until one succeeds
+	sending  bool
+	retrying bool
+	closing  bool
+	// err is the last send error not yet returned
+	err     error
+	dropped uint64
+	// done interrupts the backoff, stopped is closed when the sender returns
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// New creates a sink for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Sink, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("%w: URL is required", synchrophasor.ErrInvalidParameter)
+	}
+	if opts.Channels == 0 {
+		opts.Channels = ChannelFrequency | ChannelROCOF | ChannelVoltageMagnitude
+	}
+	if opts.Decimation <= 0 {
+		opts.Decimation = 1
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "synchrophasor"
+	}
+	if opts.MaxSamples <= 0 {
+		opts.MaxSamples = 10000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 10 * opts.MaxSamples
+	}
+	opts.MaxPending = max(opts.MaxPending, opts.MaxSamples)
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 30 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(5*time.Second, opts.MinBackoff)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if !labelName.MatchString(opts.Prefix) {
+		return nil, fmt.Errorf("%w: invalid metric prefix %q", synchrophasor.ErrInvalidParameter, opts.Prefix)
+	}
+	for name := range opts.Labels {
+		if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("%w: invalid label name %q", synchrophasor.ErrInvalidParameter, name)
+		}
+	}
+
+	s := &Sink{opts: opts}
+	for _, pmu := range cfg.PMUStationList {
+		station := map[string]string{
+			"station": strings.TrimSpace(pmu.STN),
+			"idcode":  strconv.Itoa(int(pmu.IDCode)),
+		}
+		var refs []channelRef
+
+		add := func(channel Channel, index int, name string, extra map[string]string) {
+			if opts.Channels&channel == 0 {
+				return
+			}
+			refs = append(refs, channelRef{series: len(s.series), channel: channel, index: index})
+			s.series = append(s.series, series{labels: s.encodeLabels(opts.Prefix+name, station, extra)})
+		}
+
+		add(ChannelFrequency, 0, "_frequency_hz", nil)
+		add(ChannelROCOF, 0, "_rocof_hz_per_second", nil)
+		for j, name := range pmu.CHNAMPhasor {
+			channel := map[string]string{"channel": strings.TrimSpace(name)}
+			if j < len(pmu.Phunit) && pmu.Phunit[j]>>24 == synchrophasor.PhunitCurrent {
+				add(ChannelCurrentMagnitude, j, "_current_magnitude_amperes", channel)
+			} else {
+				add(ChannelVoltageMagnitude, j, "_voltage_magnitude_volts", channel)
+			}
+			add(ChannelPhaseAngle, j, "_phase_angle_degrees", channel)
+		}
+		for j, name := range pmu.CHNAMAnalog {
+			add(ChannelAnalog, j, "_analog_value", map[string]string{"channel": strings.TrimSpace(name)})
+		}
+		s.stations = append(s.stations, refs)
+	}
+
+	s.cond = sync.NewCond(&s.mu)
+	s.done = make(chan struct{})
+	s.stopped = make(chan struct{})
+	go s.sender()
+	return s, nil
+}
+
+// encodeLabels returns the protobuf encoded labels of a series, sorted by name
+func (s *Sink) encodeLabels(name string, sets ...map[string]string) []byte {
+	labels := map[string]string{"__name__": name}
+	for k, v := range s.opts.Labels {
+		labels[k] = v
+	}
+	for _, set := range sets {
+		for k, v := range set {
+			labels[k] = v
+		}
+	}
+
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for _, k := range names {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, k)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, labels[k])
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, label)
+	}
+	return b
+}
+
+// Write adds the selected channels of every Decimation-th measurement set to
+// the batch and queues the batch for sending if it is full or older than the
+// flush interval. It returns the last send error since the previous call.
+func (s *Sink) Write(m *synchrophasor.Measurements) error {
+	if len(m.Stations) != len(s.stations) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.stations))
+	}
+	s.count++
+	if (s.count-1)%s.opts.Decimation != 0 {
+		return nil
+	}
+	if s.samples == 0 {
+		s.first = time.Now()
+	}
+
+	ts := int64(math.Round(m.Time * 1000))
+	for i, refs := range s.stations {
+		st := &m.Stations[i]
+		for _, ref := range refs {
+			var v float64
+			switch ref.channel {
+			case ChannelFrequency:
+				v = float64(st.Frequency)
+			case ChannelROCOF:
+				v = float64(st.ROCOF)
+			case ChannelVoltageMagnitude, ChannelCurrentMagnitude:
+				if ref.index >= len(st.Phasors) {
+					continue
+				}
+				v = cmplx.Abs(st.Phasors[ref.index])
+			case ChannelPhaseAngle:
+				if ref.index >= len(st.Phasors) {
+					continue
+				}
+				v = cmplx.Phase(st.Phasors[ref.index]) * 180 / math.Pi
+			case ChannelAnalog:
+				if ref.index >= len(st.Analog) {
+					continue
+				}
+				v = float64(st.Analog[ref.index])
+			}
+			ser := &s.series[ref.series]
+			ser.timestamps = append(ser.timestamps, ts)
+			ser.values = append(ser.values, v)
+			s.samples++
+		}
+	}
+
+	if s.samples >= s.opts.MaxSamples || time.Since(s.first) >= s.opts.FlushInterval {
+		s.enqueue()
+	}
+	return s.takeErr()
+}
+
+// Flush queues the pending samples and waits until all queued batches are
+// sent or dropped, or a batch failed and is being retried. It returns the
+// last send error since the previous call.
+func (s *Sink) Flush() error {
+	s.enqueue()
+
+	s.mu.Lock()
+	for (len(s.queue) > 0 || s.sending) && !s.retrying {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+	return s.takeErr()
+}
+
+// Dropped returns the number of samples dropped because the endpoint
+// rejected them or the pending queue was full
+func (s *Sink) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// takeErr returns and clears the last send error
+func (s *Sink) takeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// enqueue encodes the pending samples into a batch and queues it, dropping
+// the oldest batches beyond MaxPending
+func (s *Sink) enqueue() {
+	if s.samples == 0 {
+		return
+	}
+
+	// WriteRequest: repeated TimeSeries timeseries = 1
+	s.buf = s.buf[:0]
+	var ts []byte
+	for i := range s.series {
+		ser := &s.series[i]
+		if len(ser.values) == 0 {
+			continue
+		}
+		ts = append(ts[:0], ser.labels...)
+		for j, v := range ser.values {
+			// Sample: double value = 1, int64 timestamp = 2
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendVarint(ts, uint64(1+8+1+protowire.SizeVarint(uint64(ser.timestamps[j]))))
+			ts = protowire.AppendTag(ts, 1, protowire.Fixed64Type)
+			ts = protowire.AppendFixed64(ts, math.Float64bits(v))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(ser.timestamps[j]))
+		}
+		s.buf = protowire.AppendTag(s.buf, 1, protowire.BytesType)
+		s.buf = protowire.AppendBytes(s.buf, ts)
+	}
+	b := batch{body: snappy.Encode(nil, s.buf), samples: s.samples}
+	for i := range s.series {
+		s.series[i].timestamps = s.series[i].timestamps[:0]
+		s.series[i].values = s.series[i].values[:0]
+	}
+	s.samples = 0
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, b)
+	s.queued += b.samples
+	s.trim()
+	s.cond.Broadcast()
+}
+
+// trim drops the oldest queued batches beyond MaxPending, always keeping the
+// newest. It is called with mu held.
+func (s *Sink) trim() {
+	for s.queued > s.opts.MaxPending && len(s.queue) > 1 {
+		s.queued -= s.queue[0].samples
+		s.dropped += uint64(s.queue[0].samples)
+		s.queue[0] = batch{}
+		s.queue = s.queue[1:]
+	}
+}
+
+// sender posts the queued batches in order until the sink is closed,
+// retrying a batch with exponential backoff while the failure is retryable
+func (s *Sink) sender() {
+	defer close(s.stopped)
+
+	var backoff time.Duration
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closing {
+			s.cond.Wait()
+		}
+		if s.closing {
+			s.mu.Unlock()
+			return
+		}
+		b := s.queue[0]
+		s.queue[0] = batch{}
+		s.queue = s.queue[1:]
+		s.queued -= b.samples
+		s.sending = true
+		s.mu.Unlock()
+
+		retry, err := s.post(b.body)
+
+		s.mu.Lock()
+		s.sending = false
+		s.retrying = err != nil && retry
+		if err != nil {
+			s.err = err
+		}
+		if s.retrying {
+			// Retry the batch first, unless newer ones pushed it out
+			s.queue = append([]batch{b}, s.queue...)
+			s.queued += b.samples
+			s.trim()
+		} else if err != nil {
+			s.dropped += uint64(b.samples)
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+
+		if err == nil || !retry {
+			backoff = 0
+			continue
+		}
+		backoff = min(max(2*backoff, s.opts.MinBackoff), s.opts.MaxBackoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// post sends an encoded request and reports whether a failure is retryable
+func (s *Sink) post(body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range s.opts.Headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "synchrophasor")
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry := resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%w: %s: %s", ErrWrite, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return false, nil
+}
+
+// Close flushes the pending samples and stops the sender. Batches still
+// waiting for a retry are dropped.
+func (s *Sink) Close() error {
+	err := s.Flush()
+
+	s.mu.Lock()
+	s.closing = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	close(s.done)
+	<-s.stopped
+
+	s.mu.Lock()
+	for _, b := range s.queue {
+		s.dropped += uint64(b.samples)
+	}
+	s.queue, s.queued = nil, 0
+	s.mu.Unlock()
+	return errors.Join(err, s.takeErr())
+}
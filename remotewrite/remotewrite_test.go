@@ -0,0 +1,287 @@
+package remotewrite
+
+import (
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// sample is a decoded remote-write sample
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// decodeRequest returns the samples of a WriteRequest keyed by their labels
+// formatted as name{k="v",...}
+func decodeRequest(t *testing.T, b []byte) map[string][]sample {
+	out := map[string][]sample{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.Positive(t, n)
+		b = b[n:]
+		require.Equal(t, protowire.Number(1), num)
+		require.Equal(t, protowire.BytesType, typ)
+		ts, n := protowire.ConsumeBytes(b)
+		require.Positive(t, n)
+		b = b[n:]
+
+		var (
+			name    string
+			labels  []string
+			samples []sample
+		)
+		for len(ts) > 0 {
+			num, _, n := protowire.ConsumeTag(ts)
+			ts = ts[n:]
+			field, n := protowire.ConsumeBytes(ts)
+			require.Positive(t, n)
+			ts = ts[n:]
+
+			values := map[protowire.Number][]byte{}
+			var s sample
+			for len(field) > 0 {
+				fnum, ftyp, n := protowire.ConsumeTag(field)
+				field = field[n:]
+				switch ftyp {
+				case protowire.BytesType:
+					values[fnum], n = protowire.ConsumeBytes(field)
+				case protowire.Fixed64Type:
+					var v uint64
+					v, n = protowire.ConsumeFixed64(field)
+					s.value = math.Float64frombits(v)
+				case protowire.VarintType:
+					var v uint64
+					v, n = protowire.ConsumeVarint(field)
+					s.timestamp = int64(v)
+				}
+				require.Positive(t, n)
+				field = field[n:]
+			}
+
+			if num == 1 {
+				if string(values[1]) == "__name__" {
+					name = string(values[2])
+				} else {
+					labels = append(labels, string(values[1])+`="`+string(values[2])+`"`)
+				}
+			} else {
+				samples = append(samples, s)
+			}
+		}
+		require.True(t, sort.StringsAreSorted(labels))
+		out[name+"{"+strings.Join(labels, ",")+"}"] = samples
+	}
+	return out
+}
+
+func testMeasurements() (*synchrophasor.ConfigFrame, *synchrophasor.Measurements) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Sub 1", 7734, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+	station.AddAnalog("P", 1, 0)
+	cfg.AddPMUStation(station)
+
+	station.PhasorValues[0] = complex(0, 230)
+	station.PhasorValues[1] = complex(5, 0)
+	station.AnalogValues[0] = 42
+	station.Freq = 50
+	station.DFreq = 0.5
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000000
+	df.FracSec = 500000
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return cfg, &m
+}
+
+func TestSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []map[string][]sample
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		require.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		require.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		mu.Lock()
+		requests = append(requests, decodeRequest(t, decoded))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{
+		URL:           srv.URL,
+		Decimation:    2,
+		Labels:        map[string]string{"site": "north"},
+		Headers:       http.Header{"X-Scope-OrgID": {"tenant"}},
+		MaxSamples:    6,
+		FlushInterval: time.Hour,
+	})
+	require.NoError(t, err)
+
+	// Sets 0 and 2 are kept, 3 samples each
+	for i := 0; i < 4; i++ {
+		require.NoError(t, sink.Write(m))
+		m.Time += 0.02
+	}
+	require.NoError(t, sink.Flush())
+	mu.Lock()
+	require.Len(t, requests, 1)
+	first := requests[0]
+	mu.Unlock()
+	require.Len(t, first, 3)
+	require.Equal(t, []sample{{50, 1700000000500}, {50, 1700000000540}},
+		first[`synchrophasor_frequency_hz{idcode="7734",site="north",station="Sub 1"}`])
+	require.Equal(t, []sample{{0.5, 1700000000500}, {0.5, 1700000000540}},
+		first[`synchrophasor_rocof_hz_per_second{idcode="7734",site="north",station="Sub 1"}`])
+	require.Equal(t, []sample{{230, 1700000000500}, {230, 1700000000540}},
+		first[`synchrophasor_voltage_magnitude_volts{channel="VA",idcode="7734",site="north",station="Sub 1"}`])
+
+	require.NoError(t, sink.Write(m))
+	require.NoError(t, sink.Close())
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 2)
+	require.Len(t, requests[1], 3)
+}
+
+func TestSinkChannels(t *testing.T) {
+	var request map[string][]sample
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		request = decodeRequest(t, decoded)
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{
+		URL: srv.URL, Prefix: "pmu", Channels: ChannelCurrentMagnitude | ChannelPhaseAngle | ChannelAnalog,
+	})
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(m))
+	require.NoError(t, sink.Close())
+
+	require.Len(t, request, 4)
+	require.Equal(t, 5.0, request[`pmu_current_magnitude_amperes{channel="IA",idcode="7734",station="Sub 1"}`][0].value)
+	require.Equal(t, 90.0, request[`pmu_phase_angle_degrees{channel="VA",idcode="7734",station="Sub 1"}`][0].value)
+	require.Equal(t, 0.0, request[`pmu_phase_angle_degrees{channel="IA",idcode="7734",station="Sub 1"}`][0].value)
+	require.Equal(t, 42.0, request[`pmu_analog_value{channel="P",idcode="7734",station="Sub 1"}`][0].value)
+}
+
+func TestSinkErrors(t *testing.T) {
+	var status, requests atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", int(status.Load()))
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	_, err := New(cfg, Options{URL: srv.URL, Labels: map[string]string{"bad-name": "x"}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+
+	sink, err := New(cfg, Options{URL: srv.URL, MaxSamples: 1, MinBackoff: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	// 5xx keeps the batch for a retry, 4xx drops it
+	require.ErrorIs(t, errors.Join(sink.Write(m), sink.Flush()), ErrWrite)
+	require.Zero(t, sink.Dropped())
+	status.Store(http.StatusBadRequest)
+	require.Eventually(t, func() bool { return sink.Dropped() == 3 }, time.Second, time.Millisecond)
+	require.ErrorIs(t, sink.Flush(), ErrWrite)
+	require.NoError(t, sink.Close())
+	require.GreaterOrEqual(t, requests.Load(), int32(2))
+}
+
+func TestSinkBackoff(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{URL: srv.URL, MaxSamples: 1, MinBackoff: time.Hour})
+	require.NoError(t, err)
+
+	// A failing endpoint is not retried before the backoff, and Close does
+	// not wait for it
+	require.ErrorIs(t, errors.Join(sink.Write(m), sink.Flush()), ErrWrite)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(1), requests.Load())
+	require.NoError(t, sink.Close())
+	require.Equal(t, uint64(3), sink.Dropped())
+}
+
+func TestSinkPending(t *testing.T) {
+	arrived := make(chan struct{}, 16)
+	release := make(chan struct{})
+	var (
+		mu         sync.Mutex
+		timestamps []int64
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		mu.Lock()
+		for _, samples := range decodeRequest(t, decoded) {
+			timestamps = append(timestamps, samples[0].timestamp)
+			break
+		}
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg, m := testMeasurements()
+	sink, err := New(cfg, Options{URL: srv.URL, MaxSamples: 3, MaxPending: 6})
+	require.NoError(t, err)
+
+	// Writes do not wait for the stalled endpoint, only the newest two
+	// batches are kept behind the one being sent
+	require.NoError(t, sink.Write(m))
+	<-arrived
+	start := time.Now()
+	for i := 1; i < 10; i++ {
+		m.Time = float64(i)
+		require.NoError(t, sink.Write(m))
+	}
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, uint64(21), sink.Dropped())
+
+	close(release)
+	require.NoError(t, sink.Close())
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int64{1700000000500, 8000, 9000}, timestamps)
+}
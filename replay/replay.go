@@ -0,0 +1,160 @@
+// Package replay re-serves recorded data frames through a PMU server at the
+// recorded pace, accelerated or one frame at a time, for regression testing
+// PDCs against archived or captured streams
+package replay
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ErrDone is returned by Step once the replay has finished
+var ErrDone = errors.New("replay finished")
+
+// Options configures a Replayer
+type Options struct {
+	// Speed is the multiple of the recorded pace, defaults to 1
+	Speed float64
+	// Step sends one frame per call to Step instead of following the
+	// recorded timestamps
+	Step bool
+	// Now shifts the timestamps so that the first frame is stamped with the
+	// time the replay started, keeping the recorded spacing
+	Now bool
+}
+
+// Replayer publishes the frames of a source through a PMU server, switching
+// the served configuration whenever the recording does
+type Replayer struct {
+	pmu  *synchrophasor.PMU
+	src  Source
+	opts Options
+	step chan struct{}
+	done chan struct{}
+	cfg  *synchrophasor.ConfigFrame
+	buf  []byte
+}
+
+// New creates a replayer and sets the PMU to publish only, so it must be
+// called before the PMU is started
+func New(pmu *synchrophasor.PMU, src Source, opts Options) *Replayer {
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+	pmu.SetPublishOnly(true)
+	return &Replayer{
+		pmu:  pmu,
+		src:  src,
+		opts: opts,
+		step: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Run replays the source until its end, returning nil, or until ctx is done.
+// Frames are only received by PDCs that sent the start command.
+func (r *Replayer) Run(ctx context.Context) error {
+	defer close(r.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	var start time.Time
+	var first, last, offset int64
+	for {
+		f, err := r.src.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(f.Data) < 16 || f.Config == nil {
+			continue
+		}
+		if frameType, err := synchrophasor.GetFrameType(f.Data); err != nil || frameType != synchrophasor.FrameTypeData {
+			continue
+		}
+
+		t := frameTime(f.Data, f.Config.TimeBase)
+		if start.IsZero() || t < last {
+			// Time jumps back between recordings restart the pacing
+			start, first = time.Now(), t
+			offset = start.UnixNano() - t
+		}
+		last = t
+
+		if r.opts.Step {
+			select {
+			case <-r.step:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		} else {
+			due := start.Add(time.Duration(float64(t-first) / r.opts.Speed))
+			if wait := time.Until(due); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		if f.Config != r.cfg {
+			r.pmu.SetConfig(f.Config)
+			r.cfg = f.Config
+		}
+		frame := f.Data
+		if r.opts.Now {
+			r.buf = append(r.buf[:0], f.Data...)
+			frame = setFrameTime(r.buf, t+offset, f.Config.TimeBase)
+		}
+		if err := r.pmu.Publish(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// Step sends the next frame in step mode. It blocks until the replayer
+// takes the step and returns ErrDone once the replay has finished.
+func (r *Replayer) Step(ctx context.Context) error {
+	select {
+	case r.step <- struct{}{}:
+		return nil
+	case <-r.done:
+		return ErrDone
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// frameTime returns the SOC and FRACSEC of a raw frame in nanoseconds
+func frameTime(frame []byte, timeBase uint32) int64 {
+	soc := int64(binary.BigEndian.Uint32(frame[6:]))
+	frac := int64(binary.BigEndian.Uint32(frame[10:]) & 0xFFFFFF)
+	timeBase &= 0xFFFFFF
+	if timeBase == 0 {
+		return soc * 1e9
+	}
+	return soc*1e9 + frac*1e9/int64(timeBase)
+}
+
+// setFrameTime rewrites the SOC and FRACSEC of a raw frame, keeping the time
+// quality flags, and updates its CRC
+func setFrameTime(frame []byte, t int64, timeBase uint32) []byte {
+	timeBase &= 0xFFFFFF
+	soc, ns := t/1e9, t%1e9
+	frac := uint32(ns * int64(timeBase) / 1e9)
+	binary.BigEndian.PutUint32(frame[6:], uint32(soc))
+	binary.BigEndian.PutUint32(frame[10:], uint32(frame[10])<<24|frac&0xFFFFFF)
+	binary.BigEndian.PutUint16(frame[len(frame)-2:], synchrophasor.CalcCRC(frame[:len(frame)-2]))
+	return frame
+}
@@ -0,0 +1,207 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/archive"
+	"github.com/JSchlarb/synchrophasor/pcap"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(name string) *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 10
+	station := synchrophasor.NewPMUStation(name, 7, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+// dataFrames returns n data frames at 10 frames per second from 1700000000,
+// the frequency counting up from 50 Hz in steps of 0.01 Hz
+func dataFrames(t *testing.T, cfg *synchrophasor.ConfigFrame, n int) [][]byte {
+	df := synchrophasor.NewDataFrame(cfg)
+	df.IDCode = cfg.IDCode
+	var frames [][]byte
+	for i := 0; i < n; i++ {
+		testutil.SetFrame(df, i)
+		cfg.PMUStationList[0].Freq = 50 + float32(i)/100
+		frame, err := df.Pack()
+		require.NoError(t, err)
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// testArchive returns an archive of 10 frames of "Sub 1" followed by 10
+// frames of "Sub 2" a second later
+func testArchive(t *testing.T) *archive.Reader {
+	var buf bytes.Buffer
+	w, err := archive.NewWriter(&buf, archive.Options{})
+	require.NoError(t, err)
+	for i, name := range []string{"Sub 1", "Sub 2"} {
+		cfg := testConfig(name)
+		require.NoError(t, w.WriteConfig(cfg))
+		for _, frame := range dataFrames(t, cfg, 20)[10*i : 10*i+10] {
+			require.NoError(t, w.Write(frame))
+		}
+	}
+	require.NoError(t, w.Close())
+	r, err := archive.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	return r
+}
+
+// commands notes the start command of the PDC
+type commands struct {
+	synchrophasor.MetricsRecorder
+	started atomic.Bool
+}
+
+func (c *commands) RecordCommand(cmdType string) {
+	if cmdType == "START" {
+		c.started.Store(true)
+	}
+}
+
+func (c *commands) RecordClientConnected()    {}
+func (c *commands) RecordClientDisconnected() {}
+func (c *commands) RecordBytesReceived(int)   {}
+func (c *commands) RecordConfigFrameSent(int) {}
+func (c *commands) RecordDataFrameSent(int)   {}
+
+// serve starts the PMU with a configuration of the recorded layout and
+// connects a started PDC
+func serve(t *testing.T, pmu *synchrophasor.PMU) *synchrophasor.PDC {
+	pmu.SetConfig(testConfig("Sub 0"))
+	cmds := &commands{}
+	pmu.SetMetrics(cmds)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	t.Cleanup(pmu.Stop)
+
+	pdc := synchrophasor.NewPDC(1)
+	require.NoError(t, pdc.Connect(listener.Addr().String()))
+	t.Cleanup(pdc.Disconnect)
+	_, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.NoError(t, pdc.Start())
+	require.Eventually(t, cmds.started.Load, 5*time.Second, time.Millisecond)
+	return pdc
+}
+
+func readData(t *testing.T, pdc *synchrophasor.PDC) *synchrophasor.DataFrame {
+	frame, err := pdc.ReadFrame()
+	require.NoError(t, err)
+	require.IsType(t, &synchrophasor.DataFrame{}, frame)
+	return frame.(*synchrophasor.DataFrame)
+}
+
+func dataTime(df *synchrophasor.DataFrame) time.Time {
+	return time.Unix(int64(df.SOC), int64(df.FracSec&0xFFFFFF)*1000)
+}
+
+func TestReplay(t *testing.T) {
+	r := testArchive(t)
+	pmu := synchrophasor.NewPMU()
+	rp := New(pmu, FromArchive(r.Range(time.Time{}, time.Now())), Options{Speed: 10})
+	pdc := serve(t, pmu)
+
+	// Two seconds at ten times the recorded pace
+	started := time.Now()
+	require.NoError(t, rp.Run(context.Background()))
+	require.InDelta(t, 190*time.Millisecond, time.Since(started), float64(100*time.Millisecond))
+
+	for i := 0; i < 20; i++ {
+		df := readData(t, pdc)
+		require.Equal(t, uint32(1700000000+i/10), df.SOC)
+		require.Equal(t, uint32(i%10)*100000, df.FracSec&0xFFFFFF)
+	}
+
+	// The configuration follows the recording
+	cfg, err := pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.Equal(t, "Sub 2", cfg.PMUStationList[0].STN)
+	require.ErrorIs(t, rp.Step(context.Background()), ErrDone)
+}
+
+func TestReplayStep(t *testing.T) {
+	r := testArchive(t)
+	pmu := synchrophasor.NewPMU()
+	rp := New(pmu, FromArchive(r.Range(time.Unix(1700000001, 0), time.Time{})), Options{Step: true, Now: true})
+	pdc := serve(t, pmu)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- rp.Run(ctx)
+	}()
+
+	// Timestamps are shifted to the replay start, keeping the spacing
+	require.NoError(t, rp.Step(ctx))
+	first := readData(t, pdc)
+	require.WithinDuration(t, time.Now(), dataTime(first), time.Second)
+	require.NoError(t, rp.Step(ctx))
+	second := readData(t, pdc)
+	require.Equal(t, 100*time.Millisecond, dataTime(second).Sub(dataTime(first)))
+	require.InDelta(t, 50.11, second.AssociatedConfig.PMUStationList[0].Freq, 1e-4)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestReplayCapture(t *testing.T) {
+	// Record a stream sent over a pipe
+	var capture bytes.Buffer
+	w, err := pcap.NewWriter(&capture)
+	require.NoError(t, err)
+	client, server := net.Pipe()
+	conn := w.Conn(server)
+	go func() {
+		_, _ = io.Copy(io.Discard, client)
+	}()
+	cfg := testConfig("Sub 1")
+	frame, err := cfg.Pack()
+	require.NoError(t, err)
+	_, err = conn.Write(frame)
+	require.NoError(t, err)
+	for _, frame := range dataFrames(t, cfg, 5) {
+		_, err = conn.Write(frame)
+		require.NoError(t, err)
+	}
+	require.NoError(t, conn.Close())
+
+	d, err := pcap.NewDecoder(&capture, pcap.Options{})
+	require.NoError(t, err)
+	src := FromCapture(d, 7)
+	var n int
+	for {
+		f, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Equal(t, int64(1700000000e9+n*100e6), frameTime(f.Data, f.Config.TimeBase))
+		n++
+	}
+	require.Equal(t, 5, n)
+
+	buf := append([]byte(nil), frame...)
+	setFrameTime(buf, 1800000000e9+250e6, cfg.TimeBase)
+	require.Equal(t, int64(1800000000e9+250e6), frameTime(buf, cfg.TimeBase))
+	_, err = synchrophasor.UnpackFrame(buf, nil)
+	require.NoError(t, err)
+}
@@ -0,0 +1,75 @@
+package replay
+
+import (
+	"encoding/binary"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/archive"
+	"github.com/JSchlarb/synchrophasor/pcap"
+)
+
+// Frame is a recorded data frame
+type Frame struct {
+	// Data is the raw frame, valid until the next call to Next
+	Data []byte
+	// Config is the configuration describing the frame
+	Config *synchrophasor.ConfigFrame
+}
+
+// Source yields recorded data frames in time order. Next returns io.EOF after
+// the last frame.
+type Source interface {
+	Next() (*Frame, error)
+}
+
+// archiveSource reads the frames of an archive time range
+type archiveSource struct {
+	it    *archive.Iterator
+	frame Frame
+}
+
+// FromArchive replays the frames of an archive time range, typically
+// obtained with archive.Reader.Range
+func FromArchive(it *archive.Iterator) Source {
+	return &archiveSource{it: it}
+}
+
+// Next returns the next frame of the range
+func (s *archiveSource) Next() (*Frame, error) {
+	f, err := s.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	s.frame = Frame{Data: f.Data, Config: f.Config}
+	return &s.frame, nil
+}
+
+// captureSource reads the data frames of a capture
+type captureSource struct {
+	d      *pcap.Decoder
+	idCode uint16
+	frame  Frame
+}
+
+// FromCapture replays the data frames of a pcap or pcapng capture with the
+// given ID code, or of all streams if it is zero. Frames that failed to
+// decode, e.g. data frames captured before their configuration, are skipped.
+func FromCapture(d *pcap.Decoder, idCode uint16) Source {
+	return &captureSource{d: d, idCode: idCode}
+}
+
+// Next returns the next data frame of the capture
+func (s *captureSource) Next() (*Frame, error) {
+	for {
+		f, err := s.d.Next()
+		if err != nil {
+			return nil, err
+		}
+		df, ok := f.Value.(*synchrophasor.DataFrame)
+		if !ok || (s.idCode != 0 && binary.BigEndian.Uint16(f.Data[4:]) != s.idCode) {
+			continue
+		}
+		s.frame = Frame{Data: f.Data, Config: df.AssociatedConfig}
+		return &s.frame, nil
+	}
+}
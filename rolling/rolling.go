@@ -0,0 +1,359 @@
+// Package rolling computes statistics of channels over sliding time windows:
+// mean, standard deviation, minimum, maximum and percentiles, available
+// through Stats and optionally appended to the stream as analog channels that
+// can be republished or exported
+package rolling
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Statistic selects a derived channel of a window
+type Statistic uint8
+
+const (
+	// Mean is the "<Name> mean" channel
+	Mean Statistic = iota
+	// StdDev is the "<Name> std" channel
+	StdDev
+	// Min is the "<Name> min" channel
+	Min
+	// Max is the "<Name> max" channel
+	Max
+	// Percentiles are the "<Name> p95" channels of all window percentiles
+	Percentiles
+)
+
+// Window configures the statistics of a channel
+type Window struct {
+	// Name prefixes the derived channels and must be unique per station,
+	// defaulting to the channel without the station, e.g. "VA.mag"
+	Name string
+	// Channel is named as by ConfigFrame.Channels, e.g. "Sub 1.freq" or
+	// "Sub 1.<phasor>.mag"
+	Channel string
+	// Length of the window, defaults to 10s
+	Length time.Duration
+	// Percentiles lists percentiles between 0 and 100, e.g. 5 and 95
+	Percentiles []float64
+	// Derived lists the statistics appended as analog channels to the
+	// station of the channel, none by default
+	Derived []Statistic
+}
+
+// Options configures a Calculator
+type Options struct {
+	Windows []Window
+	// IDCode of the derived stream, zero keeps the ID code of the
+	// configuration
+	IDCode uint16
+}
+
+// Stats holds the statistics of a window
+type Stats struct {
+	Name    string
+	Channel string
+	// Count is the number of valid samples in the window, the statistics are
+	// NaN without any
+	Count  int
+	Mean   float64
+	StdDev float64
+	Min    float64
+	Max    float64
+	// Percentiles holds the values of the window percentiles in their order
+	Percentiles []float64
+	// Time is the time of the latest set
+	Time time.Time
+}
+
+// sample is a valid value of a window
+type sample struct {
+	time  int64
+	value float64
+}
+
+// window is a resolved Window with its samples
+type window struct {
+	Window
+	channel synchrophasor.ChannelRef
+	samples []sample
+	time    int64
+}
+
+// Calculator computes the window statistics of a stream. Write must be called
+// from a single goroutine, Stats may be called concurrently.
+type Calculator struct {
+	opts    Options
+	mu      sync.Mutex
+	cfg     *synchrophasor.ConfigFrame
+	out     *synchrophasor.DerivedStream
+	windows []*window
+	set     synchrophasor.Measurements
+	sorted  []float64
+}
+
+// New creates a calculator for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Calculator, error) {
+	c := &Calculator{opts: opts}
+	for _, w := range opts.Windows {
+		if w.Length <= 0 {
+			w.Length = 10 * time.Second
+		}
+		if w.Name == "" {
+			_, w.Name, _ = strings.Cut(w.Channel, ".")
+		}
+		for _, p := range w.Percentiles {
+			if !(p >= 0 && p <= 100) {
+				return nil, fmt.Errorf("%w: window %q: percentile %g not between 0 and 100",
+					synchrophasor.ErrInvalidParameter, w.Name, p)
+			}
+		}
+		for _, s := range w.Derived {
+			if s > Percentiles {
+				return nil, fmt.Errorf("%w: window %q: unknown statistic %d", synchrophasor.ErrInvalidParameter, w.Name, s)
+			}
+		}
+		c.windows = append(c.windows, &window{Window: w})
+	}
+	if err := c.setConfig(cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetConfig replaces the configuration, keeping the samples of the windows
+func (c *Calculator) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setConfig(cfg)
+}
+
+// setConfig resolves the channels of the windows in cfg and builds the
+// derived configuration, c.mu must be held
+func (c *Calculator) setConfig(cfg *synchrophasor.ConfigFrame) error {
+	chans := cfg.Channels()
+	out := synchrophasor.NewDerivedStream(cfg, c.opts.IDCode)
+	refs := make([]synchrophasor.ChannelRef, len(c.windows))
+	names := make(map[string]bool)
+	for i, w := range c.windows {
+		ref, ok := chans[w.Channel]
+		if !ok {
+			return fmt.Errorf("%w: window %q: unknown channel %q", synchrophasor.ErrInvalidParameter, w.Name, w.Channel)
+		}
+		refs[i] = ref
+		if len(w.Derived) == 0 {
+			continue
+		}
+		key := strconv.Itoa(ref.Station) + "." + w.Name
+		if names[key] {
+			return fmt.Errorf("%w: duplicate window %q", synchrophasor.ErrInvalidParameter, w.Name)
+		}
+		names[key] = true
+
+		for _, name := range w.channelNames() {
+			if len(name) > 16 {
+				return fmt.Errorf("%w: window %q: channel name %q longer than 16 characters",
+					synchrophasor.ErrInvalidParameter, w.Name, name)
+			}
+			out.AddAnalog(ref.Station, name)
+		}
+	}
+	for i, w := range c.windows {
+		w.channel = refs[i]
+	}
+	c.cfg, c.out = cfg, out
+	return nil
+}
+
+// channelNames returns the names of the derived channels of a window
+func (w *window) channelNames() []string {
+	var names []string
+	for _, s := range w.Derived {
+		switch s {
+		case Mean:
+			names = append(names, w.Name+" mean")
+		case StdDev:
+			names = append(names, w.Name+" std")
+		case Min:
+			names = append(names, w.Name+" min")
+		case Max:
+			names = append(names, w.Name+" max")
+		case Percentiles:
+			for _, p := range w.Percentiles {
+				names = append(names, w.Name+" p"+strconv.FormatFloat(p, 'g', -1, 64))
+			}
+		}
+	}
+	return names
+}
+
+// Config returns the configuration extended by the statistics channels
+func (c *Calculator) Config() *synchrophasor.ConfigFrame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out.Config
+}
+
+// Write adds the channel values of a measurement set to the windows and
+// calls fn, unless nil, with m extended by the derived channels. Stations
+// receiving them are flagged as modified. The set passed to fn is only valid
+// during the call and m is not modified.
+func (c *Calculator) Write(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	c.mu.Lock()
+	if len(m.Stations) != len(c.cfg.PMUStationList) {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(c.cfg.PMUStationList))
+	}
+	for i, pmu := range c.cfg.PMUStationList {
+		if st := &m.Stations[i]; len(st.Phasors) != len(pmu.PhasorValues) || len(st.Analog) != len(pmu.AnalogValues) {
+			c.mu.Unlock()
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := m.UnixNano()
+	for _, w := range c.windows {
+		w.add(t, m)
+	}
+	if fn == nil {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.out.CopyTo(m, &c.set)
+	for _, w := range c.windows {
+		if len(w.Derived) == 0 {
+			continue
+		}
+		s := w.stats(&c.sorted)
+		st := &c.set.Stations[w.channel.Station]
+		for _, d := range w.Derived {
+			switch d {
+			case Mean:
+				st.Analog = append(st.Analog, float32(s.Mean))
+			case StdDev:
+				st.Analog = append(st.Analog, float32(s.StdDev))
+			case Min:
+				st.Analog = append(st.Analog, float32(s.Min))
+			case Max:
+				st.Analog = append(st.Analog, float32(s.Max))
+			case Percentiles:
+				for _, p := range s.Percentiles {
+					st.Analog = append(st.Analog, float32(p))
+				}
+			}
+		}
+	}
+	c.mu.Unlock()
+	return fn(&c.set)
+}
+
+// add appends the channel value of m at time t, if valid, and drops the
+// samples that left the window
+func (w *window) add(t int64, m *synchrophasor.Measurements) {
+	w.time = t
+	if v, ok := lookup(m, w.channel); ok {
+		w.samples = append(w.samples, sample{t, v})
+	}
+	start := t - int64(w.Length)
+	n := 0
+	for n < len(w.samples) && w.samples[n].time <= start {
+		n++
+	}
+	if n > 0 {
+		w.samples = append(w.samples[:0], w.samples[n:]...)
+	}
+}
+
+// stats returns the statistics of the window, sorting the values in sorted
+func (w *window) stats(sorted *[]float64) Stats {
+	s := Stats{
+		Name:        w.Name,
+		Channel:     w.Channel,
+		Count:       len(w.samples),
+		Mean:        math.NaN(),
+		StdDev:      math.NaN(),
+		Min:         math.NaN(),
+		Max:         math.NaN(),
+		Percentiles: make([]float64, len(w.Percentiles)),
+	}
+	if w.time != 0 {
+		s.Time = time.Unix(0, w.time).UTC()
+	}
+	if len(w.samples) == 0 {
+		for i := range s.Percentiles {
+			s.Percentiles[i] = math.NaN()
+		}
+		return s
+	}
+
+	var sum float64
+	s.Min, s.Max = math.Inf(1), math.Inf(-1)
+	for _, smp := range w.samples {
+		sum += smp.value
+		s.Min, s.Max = min(s.Min, smp.value), max(s.Max, smp.value)
+	}
+	s.Mean = sum / float64(len(w.samples))
+	var sq float64
+	for _, smp := range w.samples {
+		sq += (smp.value - s.Mean) * (smp.value - s.Mean)
+	}
+	s.StdDev = math.Sqrt(sq / float64(len(w.samples)))
+
+	if len(w.Percentiles) > 0 {
+		values := (*sorted)[:0]
+		for _, smp := range w.samples {
+			values = append(values, smp.value)
+		}
+		slices.Sort(values)
+		for i, p := range w.Percentiles {
+			s.Percentiles[i] = percentile(values, p)
+		}
+		*sorted = values
+	}
+	return s
+}
+
+// percentile returns percentile p of sorted values, interpolating linearly
+// between the closest ranks
+func percentile(sorted []float64, p float64) float64 {
+	pos := p / 100 * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// Stats returns the statistics of the windows in configuration order. The
+// standard deviation is that of the population of the window.
+func (c *Calculator) Stats() []Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]Stats, len(c.windows))
+	var sorted []float64
+	for i, w := range c.windows {
+		stats[i] = w.stats(&sorted)
+	}
+	return stats
+}
+
+// lookup returns a channel value of a measurement set, false if the station
+// flags a data error or the value is not finite
+func lookup(m *synchrophasor.Measurements, ref synchrophasor.ChannelRef) (float64, bool) {
+	st := &m.Stations[ref.Station]
+	if st.Stat&synchrophasor.StatDataError != 0 {
+		return 0, false
+	}
+	v, ok := ref.Value(st)
+	return v, ok && !math.IsNaN(v) && !math.IsInf(v, 0)
+}
@@ -0,0 +1,123 @@
+package rolling
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+	cfg.IDCode = 7
+	return cfg
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// frequency of the stations
+func set(cfg *synchrophasor.ConfigFrame, i int, freq float64) *synchrophasor.Measurements {
+	for _, pmu := range cfg.PMUStationList {
+		pmu.Freq = float32(freq)
+		pmu.PhasorValues[0] = complex(230, 0)
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+func TestCalculator(t *testing.T) {
+	cfg := testConfig()
+	c, err := New(cfg, Options{IDCode: 70, Windows: []Window{
+		{Channel: "Sub 2.freq", Length: time.Second, Percentiles: []float64{50, 90},
+			Derived: []Statistic{Mean, StdDev, Min, Max, Percentiles}},
+		{Name: "Sub 1 magnitude", Channel: "Sub 1.VA.mag"},
+	}})
+	require.NoError(t, err)
+
+	out := c.Config()
+	require.Equal(t, uint16(70), out.IDCode)
+	require.Empty(t, cfg.PMUStationList[1].CHNAMAnalog)
+	require.Empty(t, out.PMUStationList[0].CHNAMAnalog)
+	var names []string
+	for _, name := range out.PMUStationList[1].CHNAMAnalog {
+		names = append(names, strings.TrimSpace(name))
+	}
+	require.Equal(t, []string{"freq mean", "freq std", "freq min", "freq max", "freq p50", "freq p90"}, names)
+
+	var got *synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		got = m
+		return nil
+	}
+	// 50.00 to 50.19 Hz, the one second window holds the last ten
+	for i := 0; i < 20; i++ {
+		require.NoError(t, c.Write(set(cfg, i, 50+float64(i)*0.01), keep))
+	}
+	st := got.Stations[1]
+	require.Equal(t, uint16(70), got.PMUID)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), st.Stat&synchrophasor.StatDataModified)
+	require.Zero(t, got.Stations[0].Stat&synchrophasor.StatDataModified)
+	require.Len(t, st.Analog, 6)
+	require.InDelta(t, 50.145, st.Analog[0], 1e-4)
+	require.InDelta(t, 0.0287228, st.Analog[1], 1e-4)
+	require.InDelta(t, 50.10, st.Analog[2], 1e-4)
+	require.InDelta(t, 50.19, st.Analog[3], 1e-4)
+	require.InDelta(t, 50.145, st.Analog[4], 1e-4)
+	require.InDelta(t, 50.181, st.Analog[5], 1e-4)
+
+	stats := c.Stats()
+	require.Len(t, stats, 2)
+	require.Equal(t, "freq", stats[0].Name)
+	require.Equal(t, 10, stats[0].Count)
+	require.Equal(t, time.Unix(1700000001, 900000000).UTC(), stats[0].Time)
+	require.Equal(t, "Sub 1 magnitude", stats[1].Name)
+	require.Equal(t, 20, stats[1].Count)
+	require.InDelta(t, 230, stats[1].Mean, 1e-3)
+	require.InDelta(t, 0, stats[1].StdDev, 1e-3)
+
+	// Invalid samples are skipped and the window drains
+	for i := 20; i < 31; i++ {
+		m := set(cfg, i, 50)
+		m.Stations[1].Stat |= 0x8000
+		require.NoError(t, c.Write(m, keep))
+	}
+	stats = c.Stats()
+	require.Zero(t, stats[0].Count)
+	require.True(t, math.IsNaN(stats[0].Mean))
+	require.True(t, math.IsNaN(stats[0].Percentiles[1]))
+	require.True(t, math.IsNaN(float64(got.Stations[1].Analog[0])))
+
+	m := set(cfg, 31, 50)
+	m.Stations = m.Stations[:1]
+	require.ErrorIs(t, c.Write(m, nil), synchrophasor.ErrInvalidParameter)
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5}
+	require.Equal(t, 1.0, percentile(values, 0))
+	require.Equal(t, 3.0, percentile(values, 50))
+	require.Equal(t, 4.6, percentile(values, 90))
+	require.Equal(t, 5.0, percentile(values, 100))
+	require.Equal(t, 7.0, percentile([]float64{7}, 95))
+}
+
+func TestNew(t *testing.T) {
+	for _, w := range []Window{
+		{Channel: "Sub 9.freq"},
+		{Channel: "Sub 1.freq", Percentiles: []float64{101}},
+		{Channel: "Sub 1.freq", Derived: []Statistic{7}},
+		{Name: "frequency of Sub 1", Channel: "Sub 1.freq", Derived: []Statistic{Mean}},
+	} {
+		_, err := New(testConfig(), Options{Windows: []Window{w}})
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+	_, err := New(testConfig(), Options{Windows: []Window{
+		{Channel: "Sub 1.freq", Derived: []Statistic{Mean}},
+		{Channel: "Sub 1.freq", Derived: []Statistic{Max}},
+	}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
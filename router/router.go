@@ -0,0 +1,244 @@
+// Package router fans out a live stream to multiple sinks, such as CSV
+// files, message brokers, the historian or archives. Every sink runs in its
+// own goroutine behind a queue, so slow or failing sinks neither delay nor
+// break the others unless configured to apply backpressure.
+package router
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ErrClosed is returned when writing to a closed router
+var ErrClosed = errors.New("router closed")
+
+// Options configures a Router
+type Options struct {
+	// OnError is called with the errors of the sinks from their goroutines
+	OnError func(name string, err error)
+}
+
+// SinkOptions configures a sink added to a Router
+type SinkOptions struct {
+	// Queue is the number of writes buffered for the sink, defaults to 256
+	Queue int
+	// Drop discards writes for the sink while its queue is full. By default
+	// the router blocks until the sink catches up.
+	Drop bool
+}
+
+// SinkStats counts the writes of a sink
+type SinkStats struct {
+	Name string
+	// Written counts the measurement sets and frames passed to the sink
+	Written uint64
+	Dropped uint64
+	Errors  uint64
+	// LastError is the latest error of the sink
+	LastError error
+}
+
+// item is a queued write. Measurement sets and frames are shared by all
+// sinks and must not be modified.
+type item struct {
+	m     *synchrophasor.Measurements
+	frame []byte
+	// flush requests a flush, answered with its error
+	flush chan error
+}
+
+// route is a sink with its queue
+type route struct {
+	name  string
+	sink  Sink
+	opts  SinkOptions
+	queue chan item
+	done  chan struct{}
+
+	mu    sync.Mutex
+	stats SinkStats
+}
+
+// Router writes a stream to sinks. It implements Sink itself, so routers can
+// be nested.
+type Router struct {
+	opts Options
+	// mu guards routes and closed, writers hold it shared
+	mu     sync.RWMutex
+	routes []*route
+	closed bool
+}
+
+var _ Sink = (*Router)(nil)
+
+// New creates a router without sinks
+func New(opts Options) *Router {
+	return &Router{opts: opts}
+}
+
+// Add starts writing the stream to a sink. The measurement sets and frames
+// are shared by all sinks, which must not modify them. The router closes the
+// sink when it is closed.
+func (r *Router) Add(name string, s Sink, opts SinkOptions) error {
+	if opts.Queue <= 0 {
+		opts.Queue = 256
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	rt := &route{
+		name:  name,
+		sink:  s,
+		opts:  opts,
+		queue: make(chan item, opts.Queue),
+		done:  make(chan struct{}),
+		stats: SinkStats{Name: name},
+	}
+	r.routes = append(r.routes, rt)
+	go r.run(rt)
+	return nil
+}
+
+// WriteMeasurements queues a copy of m for every sink
+func (r *Router) WriteMeasurements(m *synchrophasor.Measurements) error {
+	return r.write(item{m: m.Clone()})
+}
+
+// WriteFrame queues a copy of frame for every sink
+func (r *Router) WriteFrame(frame []byte) error {
+	return r.write(item{frame: append([]byte(nil), frame...)})
+}
+
+// write queues it for every sink, blocking or dropping on full queues
+func (r *Router) write(it item) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return ErrClosed
+	}
+	for _, rt := range r.routes {
+		if !rt.opts.Drop {
+			rt.queue <- it
+			continue
+		}
+		select {
+		case rt.queue <- it:
+		default:
+			rt.mu.Lock()
+			rt.stats.Dropped++
+			rt.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// Flush waits until the sinks have written the queued data and flushed it,
+// returning their errors
+func (r *Router) Flush() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return ErrClosed
+	}
+
+	results := make([]chan error, len(r.routes))
+	for i, rt := range r.routes {
+		results[i] = make(chan error, 1)
+		rt.queue <- item{flush: results[i]}
+	}
+	var errs []error
+	for i, result := range results {
+		if err := <-result; err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.routes[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close writes the queued data and closes the sinks, returning their errors
+func (r *Router) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	for _, rt := range r.routes {
+		close(rt.queue)
+	}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, rt := range r.routes {
+		<-rt.done
+		if err := r.call(rt, rt.sink.Close); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", rt.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the counters of the sinks in the order they were added
+func (r *Router) Stats() []SinkStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := make([]SinkStats, len(r.routes))
+	for i, rt := range r.routes {
+		rt.mu.Lock()
+		stats[i] = rt.stats
+		rt.mu.Unlock()
+	}
+	return stats
+}
+
+// run writes the queue of a sink until it is closed
+func (r *Router) run(rt *route) {
+	defer close(rt.done)
+	for it := range rt.queue {
+		switch {
+		case it.flush != nil:
+			it.flush <- r.call(rt, rt.sink.Flush)
+		case it.m != nil:
+			if r.call(rt, func() error { return rt.sink.WriteMeasurements(it.m) }) == nil {
+				rt.count()
+			}
+		default:
+			if r.call(rt, func() error { return rt.sink.WriteFrame(it.frame) }) == nil {
+				rt.count()
+			}
+		}
+	}
+}
+
+// call calls fn of a sink, recording its error or panic
+func (r *Router) call(rt *route, fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+		if err == nil {
+			return
+		}
+		rt.mu.Lock()
+		rt.stats.Errors++
+		rt.stats.LastError = err
+		rt.mu.Unlock()
+		if r.opts.OnError != nil {
+			r.opts.OnError(rt.name, err)
+		}
+	}()
+	return fn()
+}
+
+// count counts a successful write
+func (rt *route) count() {
+	rt.mu.Lock()
+	rt.stats.Written++
+	rt.mu.Unlock()
+}
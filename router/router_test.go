@@ -0,0 +1,181 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/archive"
+	"github.com/JSchlarb/synchrophasor/historian"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 10
+	station := synchrophasor.NewPMUStation("Sub 1", 7, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+// fakeSink records its writes, failing or blocking on demand
+type fakeSink struct {
+	mu     sync.Mutex
+	sets   []float64
+	frames int
+	fail   error
+	block  chan struct{}
+	closed bool
+}
+
+func (s *fakeSink) WriteMeasurements(m *synchrophasor.Measurements) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.sets = append(s.sets, m.Time)
+	return nil
+}
+
+func (s *fakeSink) WriteFrame([]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frames++
+	return nil
+}
+
+func (s *fakeSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fail
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return s.fail
+}
+
+// panicSink panics on every write
+type panicSink struct {
+	fakeSink
+}
+
+func (s *panicSink) WriteMeasurements(*synchrophasor.Measurements) error {
+	panic("broken")
+}
+
+func TestRouter(t *testing.T) {
+	cfg := testConfig()
+	hist := historian.New(cfg, historian.Options{})
+	var buf bytes.Buffer
+	aw, err := archive.NewWriter(&buf, archive.Options{})
+	require.NoError(t, err)
+	require.NoError(t, aw.WriteConfig(cfg))
+
+	var mu sync.Mutex
+	failures := map[string]int{}
+	r := New(Options{OnError: func(name string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures[name]++
+	}})
+	good := &fakeSink{}
+	failing := &fakeSink{fail: errors.New("disk full")}
+	slow := &fakeSink{block: make(chan struct{})}
+	require.NoError(t, r.Add("good", good, SinkOptions{}))
+	require.NoError(t, r.Add("failing", failing, SinkOptions{}))
+	require.NoError(t, r.Add("panic", &panicSink{}, SinkOptions{}))
+	require.NoError(t, r.Add("slow", slow, SinkOptions{Queue: 2, Drop: true}))
+	require.NoError(t, r.Add("historian", Measurements(hist), SinkOptions{}))
+	require.NoError(t, r.Add("archive", Frames(aw), SinkOptions{}))
+
+	// The slow sink drops what does not fit its queue, the others are not
+	// affected by it or the failing sinks
+	df := synchrophasor.NewDataFrame(cfg)
+	df.IDCode = cfg.IDCode
+	var m synchrophasor.Measurements
+	for i := 0; i < 10; i++ {
+		df.SOC = 1700000000 + uint32(i)
+		df.FillMeasurements(&m)
+		require.NoError(t, r.WriteMeasurements(&m))
+		frame, err := df.Pack()
+		require.NoError(t, err)
+		require.NoError(t, r.WriteFrame(frame))
+	}
+	// The router copies the sets
+	m.Stations[0].Phasors[0] = 1
+
+	require.Eventually(t, func() bool { return r.Stats()[5].Written == 20 }, 5*time.Second, time.Millisecond)
+	close(slow.block)
+	require.ErrorContains(t, r.Flush(), "failing: disk full")
+
+	stats := r.Stats()
+	require.Equal(t, SinkStats{Name: "good", Written: 20}, stats[0])
+	require.Equal(t, uint64(11), stats[1].Errors)
+	require.Equal(t, uint64(10), stats[1].Written)
+	require.Equal(t, uint64(10), stats[2].Errors)
+	require.ErrorContains(t, stats[2].LastError, "panic: broken")
+	require.Less(t, stats[3].Written, uint64(20))
+	require.Equal(t, uint64(20), stats[3].Written+stats[3].Dropped)
+	require.Len(t, good.sets, 10)
+	require.Equal(t, 10, good.frames)
+
+	samples, err := hist.Query("Sub 1.VA.mag", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, samples, 10)
+	require.Zero(t, samples[9].Value)
+
+	require.ErrorContains(t, r.Close(), "failing: disk full")
+	require.True(t, good.closed)
+	require.NoError(t, r.Close())
+	require.ErrorIs(t, r.WriteFrame(nil), ErrClosed)
+	require.ErrorIs(t, r.Add("late", &fakeSink{}, SinkOptions{}), ErrClosed)
+
+	ar, err := archive.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	first, last := ar.Span()
+	require.Equal(t, time.Unix(1700000000, 0), first)
+	require.Equal(t, time.Unix(1700000009, 0), last)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 12, failures["failing"])
+	require.Equal(t, 10, failures["panic"])
+}
+
+func TestRouterBackpressure(t *testing.T) {
+	r := New(Options{})
+	slow := &fakeSink{block: make(chan struct{})}
+	require.NoError(t, r.Add("slow", slow, SinkOptions{Queue: 1}))
+
+	// The first write is taken by the sink, the second queued and the third
+	// blocks until the sink catches up
+	m := &synchrophasor.Measurements{}
+	require.NoError(t, r.WriteMeasurements(m))
+	require.NoError(t, r.WriteMeasurements(m))
+	done := make(chan error, 1)
+	go func() {
+		done <- r.WriteMeasurements(m)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(slow.block)
+	require.NoError(t, <-done)
+	require.NoError(t, r.Close())
+	require.Len(t, slow.sets, 3)
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"io"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Sink consumes a live stream as measurement sets, raw frames or both
+type Sink interface {
+	// WriteMeasurements writes a measurement set, which is only valid during
+	// the call
+	WriteMeasurements(m *synchrophasor.Measurements) error
+	// WriteFrame writes a raw frame, which is only valid during the call
+	WriteFrame(frame []byte) error
+	// Flush writes out buffered data
+	Flush() error
+	// Close flushes and releases the sink
+	Close() error
+}
+
+// MeasurementWriter is implemented by the measurement sinks, e.g.
+// csvsink.Sink or historian.Historian
+type MeasurementWriter interface {
+	Write(m *synchrophasor.Measurements) error
+}
+
+// FrameWriter is implemented by the raw frame sinks, e.g. archive.Writer
+type FrameWriter interface {
+	Write(frame []byte) error
+}
+
+// flusher is implemented by sinks buffering their output
+type flusher interface {
+	Flush() error
+}
+
+// adapter forwards Flush and Close to the wrapped writer if it implements
+// them
+type adapter struct {
+	w interface{}
+}
+
+func (a adapter) Flush() error {
+	if f, ok := a.w.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (a adapter) Close() error {
+	if c, ok := a.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// measurementSink ignores raw frames
+type measurementSink struct {
+	adapter
+	w MeasurementWriter
+}
+
+// Measurements returns a sink writing measurement sets to w and ignoring raw
+// frames. Flush and Close are forwarded if w implements them.
+func Measurements(w MeasurementWriter) Sink {
+	return measurementSink{adapter{w}, w}
+}
+
+func (s measurementSink) WriteMeasurements(m *synchrophasor.Measurements) error {
+	return s.w.Write(m)
+}
+
+func (s measurementSink) WriteFrame([]byte) error {
+	return nil
+}
+
+// frameSink ignores measurement sets
+type frameSink struct {
+	adapter
+	w FrameWriter
+}
+
+// Frames returns a sink writing raw frames to w and ignoring measurement
+// sets. Flush and Close are forwarded if w implements them.
+func Frames(w FrameWriter) Sink {
+	return frameSink{adapter{w}, w}
+}
+
+func (s frameSink) WriteMeasurements(*synchrophasor.Measurements) error {
+	return nil
+}
+
+func (s frameSink) WriteFrame(frame []byte) error {
+	return s.w.Write(frame)
+}
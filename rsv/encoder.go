@@ -0,0 +1,286 @@
+package rsv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Session layer constants of IEC 61850-90-5 over CLTP
+const (
+	// transportLI and transportTI form the connectionless transport header
+	transportLI = 0x01
+	transportTI = 0x40
+	// sessionSV identifies a sampled value SPDU
+	sessionSV = 0xA2
+	// commonHeaderPI starts the common session header
+	commonHeaderPI = 0x80
+	// commonHeaderLen is the length of the common session header parameters
+	commonHeaderLen = 22
+	// payloadSV tags a sampled value payload element
+	payloadSV = 0x82
+	// signatureTag tags the signature following the payload
+	signatureTag = 0x85
+	// sessionVersion is the session protocol version
+	sessionVersion = 1
+)
+
+// MAC selects the signature algorithm of the SPDU
+type MAC uint8
+
+// MAC algorithms defined by IEC 61850-90-5
+const (
+	MACNone MAC = iota
+	MACHMACSHA256_80
+	MACHMACSHA256_128
+	MACHMACSHA256_256
+)
+
+// size returns the signature length in bytes
+func (m MAC) size() int {
+	switch m {
+	case MACHMACSHA256_80:
+		return 10
+	case MACHMACSHA256_128:
+		return 16
+	case MACHMACSHA256_256:
+		return 32
+	}
+	return 0
+}
+
+// STAT bits of a C37.118 station mapped to quality and synchronization
+const (
+	statTestMode = 0x8000
+	statSyncLost = 0x2000
+)
+
+// Quality bits of IEC 61850-9-2 sampled values
+const (
+	qualityInvalid      = 0x0001
+	qualityQuestionable = 0x0003
+	qualityTest         = 0x0800
+)
+
+// EncoderOptions configures the session and sampled value framing
+type EncoderOptions struct {
+	// AppID is the APPID of the payload element
+	AppID uint16
+	// Simulation sets the simulation flag of the payload element
+	Simulation bool
+	// MAC selects the signature, MACNone sends unsigned SPDUs
+	MAC MAC
+	// Key is the HMAC key, required unless MAC is MACNone
+	Key []byte
+	// KeyID identifies the key to the subscribers
+	KeyID uint32
+	// KeyTime is the Unix time the key became current, TimeToNextKey the
+	// seconds until it is replaced
+	KeyTime       uint32
+	TimeToNextKey uint16
+}
+
+// Encoder frames measurement sets as IEC 61850-90-5 R-SV session PDUs. Every
+// station is one ASDU with the station name as svID and a sample of
+//
+//	per phasor:        magnitude FLOAT32, quality, angle FLOAT32 (degrees), quality
+//	frequency:         FLOAT32, quality
+//	ROCOF:             FLOAT32, quality
+//	per analog:        FLOAT32, quality
+//	per digital word:  INT32 (status bits), quality
+//
+// where every quality is a 32 bit IEC 61850 quality derived from STAT.
+// An Encoder is not safe for concurrent use.
+type Encoder struct {
+	opts     EncoderOptions
+	cfg      *synchrophasor.ConfigFrame
+	spduNum  uint32
+	smpCnt   uint16
+	apdu     []byte
+	asdu     []byte
+	sample   []byte
+	signBody []byte
+}
+
+// NewEncoder creates an encoder for the given configuration
+func NewEncoder(cfg *synchrophasor.ConfigFrame, opts EncoderOptions) (*Encoder, error) {
+	if opts.MAC > MACHMACSHA256_256 {
+		return nil, fmt.Errorf("%w: unsupported MAC algorithm %d", synchrophasor.ErrInvalidParameter, opts.MAC)
+	}
+	if opts.MAC != MACNone && len(opts.Key) == 0 {
+		return nil, fmt.Errorf("%w: key required for signed SPDUs", synchrophasor.ErrInvalidParameter)
+	}
+	return &Encoder{opts: opts, cfg: cfg}, nil
+}
+
+// Append appends the SPDU for m, including the transport header, to b
+func (e *Encoder) Append(b []byte, m *synchrophasor.Measurements) ([]byte, error) {
+	if len(m.Stations) != len(e.cfg.PMUStationList) {
+		return b, fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(e.cfg.PMUStationList))
+	}
+
+	e.apdu = e.appendSavPdu(e.apdu[:0], m)
+	if len(e.apdu) > math.MaxUint16 {
+		return b, fmt.Errorf("%w: APDU of %d bytes exceeds 65535", synchrophasor.ErrInvalidParameter, len(e.apdu))
+	}
+	e.smpCnt++
+
+	start := len(b)
+	b = append(b, transportLI, transportTI)
+	session := len(b)
+	b = append(b, sessionSV, 2+commonHeaderLen, commonHeaderPI, commonHeaderLen)
+
+	// SPDU length is filled in below
+	lengthAt := len(b)
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = binary.BigEndian.AppendUint32(b, e.spduNum)
+	b = binary.BigEndian.AppendUint16(b, sessionVersion)
+	b = binary.BigEndian.AppendUint32(b, e.opts.KeyTime)
+	b = binary.BigEndian.AppendUint16(b, e.opts.TimeToNextKey)
+	b = append(b, 0, byte(e.opts.MAC)) // no encryption
+	b = binary.BigEndian.AppendUint32(b, e.opts.KeyID)
+	e.spduNum++
+
+	// Payload with one sampled value element
+	b = binary.BigEndian.AppendUint32(b, uint32(6+len(e.apdu)))
+	simulation := byte(0)
+	if e.opts.Simulation {
+		simulation = 1
+	}
+	b = append(b, payloadSV, simulation)
+	b = binary.BigEndian.AppendUint16(b, e.opts.AppID)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(e.apdu)))
+	b = append(b, e.apdu...)
+
+	if size := e.opts.MAC.size(); size > 0 {
+		binary.BigEndian.PutUint32(b[lengthAt:], uint32(len(b)-lengthAt-4+2+size))
+		mac := hmac.New(sha256.New, e.opts.Key)
+		mac.Write(b[session:])
+		b = append(b, signatureTag, byte(size))
+		b = append(b, mac.Sum(nil)[:size]...)
+	} else {
+		binary.BigEndian.PutUint32(b[lengthAt:], uint32(len(b)-lengthAt-4))
+	}
+
+	if len(b)-start > 65507 {
+		return b[:start], fmt.Errorf("%w: SPDU of %d bytes exceeds a UDP datagram",
+			synchrophasor.ErrInvalidParameter, len(b)-start)
+	}
+	return b, nil
+}
+
+// appendSavPdu appends the BER encoded savPdu with one ASDU per station
+func (e *Encoder) appendSavPdu(b []byte, m *synchrophasor.Measurements) []byte {
+	var content []byte
+	content = appendTLV(content, 0x80, appendInt(nil, int64(len(m.Stations))))
+
+	var asdus []byte
+	sec, frac := math.Modf(m.Time)
+	for i, pmu := range e.cfg.PMUStationList {
+		st := &m.Stations[i]
+		e.sample = appendSample(e.sample[:0], st)
+
+		synced := st.Stat&statSyncLost == 0
+		timeQuality := byte(0x1F) // accuracy unspecified
+		smpSynch := byte(2)       // globally synchronized
+		if !synced {
+			timeQuality |= 0x20
+			smpSynch = 0
+		}
+		refrTm := binary.BigEndian.AppendUint32(nil, uint32(sec))
+		fraction := uint32(frac * (1 << 24))
+		refrTm = append(refrTm, byte(fraction>>16), byte(fraction>>8), byte(fraction), timeQuality)
+
+		asdu := appendTLV(e.asdu[:0], 0x80, []byte(strings.TrimSpace(pmu.STN)))
+		asdu = appendTLV(asdu, 0x82, binary.BigEndian.AppendUint16(nil, e.smpCnt))
+		asdu = appendTLV(asdu, 0x83, binary.BigEndian.AppendUint32(nil, uint32(pmu.CfgCnt)))
+		asdu = appendTLV(asdu, 0x84, refrTm)
+		asdu = appendTLV(asdu, 0x85, []byte{smpSynch})
+		if rate := e.cfg.DataRate; rate > 0 {
+			asdu = appendTLV(asdu, 0x86, binary.BigEndian.AppendUint16(nil, uint16(rate)))
+		}
+		asdu = appendTLV(asdu, 0x87, e.sample)
+		e.asdu = asdu
+		asdus = appendTLV(asdus, 0x30, asdu)
+	}
+	content = appendTLV(content, 0xA2, asdus)
+	return appendTLV(b, 0x60, content)
+}
+
+// appendSample appends the sample values of one station
+func appendSample(b []byte, st *synchrophasor.StationMeasurement) []byte {
+	quality := uint32(0)
+	switch {
+	case st.Stat&synchrophasor.StatDataError == statTestMode:
+		quality = qualityTest
+	case st.Stat&synchrophasor.StatDataError != 0:
+		quality = qualityInvalid
+	case st.Stat&statSyncLost != 0:
+		quality = qualityQuestionable
+	}
+
+	value := func(b []byte, v float64) []byte {
+		q := quality
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			q |= qualityInvalid
+		}
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(float32(v)))
+		return binary.BigEndian.AppendUint32(b, q)
+	}
+
+	for _, ph := range st.Phasors {
+		b = value(b, cmplx.Abs(ph))
+		b = value(b, cmplx.Phase(ph)*180/math.Pi)
+	}
+	b = value(b, float64(st.Frequency))
+	b = value(b, float64(st.ROCOF))
+	for _, v := range st.Analog {
+		b = value(b, float64(v))
+	}
+	for _, word := range st.Digital {
+		var bits uint32
+		for k, bit := range word {
+			if bit {
+				bits |= 1 << uint(k)
+			}
+		}
+		b = binary.BigEndian.AppendUint32(b, bits)
+		b = binary.BigEndian.AppendUint32(b, quality)
+	}
+	return b
+}
+
+// appendTLV appends a BER tag, length and content
+func appendTLV(b []byte, tag byte, content []byte) []byte {
+	b = append(b, tag)
+	switch n := len(content); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xFF:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xFFFF:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, content...)
+}
+
+// appendInt appends the minimal two's complement encoding of v
+func appendInt(b []byte, v int64) []byte {
+	n := 1
+	for n < 8 && (v>>(8*n-1) != 0 && v>>(8*n-1) != -1) {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
@@ -0,0 +1,86 @@
+// Package rsv sends synchrophasor measurements as IEC 61850-90-5 routed
+// sampled values (R-SV): IEC 61850-9-2 savPdu APDUs in the 90-5 session layer
+// framing over UDP, optionally signed with HMAC-SHA256
+package rsv
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/JSchlarb/synchrophasor"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// DefaultPort is the UDP port assigned to IEC 61850-90-5
+const DefaultPort = 102
+
+// Options configures a Sender
+type Options struct {
+	EncoderOptions
+	// Addr is the unicast or multicast destination, the port defaults to 102
+	Addr string
+	// TTL is the multicast time to live (hop limit), defaults to 16 so that
+	// the packets cross routers
+	TTL int
+}
+
+// Sender sends one SPDU per measurement set. It is not safe for concurrent use.
+type Sender struct {
+	conn    *net.UDPConn
+	encoder *Encoder
+	buf     []byte
+}
+
+// New creates a sender for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Sender, error) {
+	if opts.TTL <= 0 {
+		opts.TTL = 16
+	}
+	encoder, err := NewEncoder(cfg, opts.EncoderOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := opts.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(DefaultPort))
+	}
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if raddr.IP.IsMulticast() {
+		if raddr.IP.To4() != nil {
+			err = ipv4.NewPacketConn(conn).SetMulticastTTL(opts.TTL)
+		} else {
+			err = ipv6.NewPacketConn(conn).SetMulticastHopLimit(opts.TTL)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return &Sender{conn: conn, encoder: encoder}, nil
+}
+
+// Write sends the SPDU for m
+func (s *Sender) Write(m *synchrophasor.Measurements) error {
+	var err error
+	s.buf, err = s.encoder.Append(s.buf[:0], m)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(s.buf)
+	return err
+}
+
+// Close closes the socket
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
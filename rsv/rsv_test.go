@@ -0,0 +1,163 @@
+package rsv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// tlv is a decoded BER element
+type tlv struct {
+	tag     byte
+	content []byte
+}
+
+// parseTLVs decodes consecutive BER elements
+func parseTLVs(t *testing.T, b []byte) []tlv {
+	var out []tlv
+	for len(b) > 0 {
+		require.GreaterOrEqual(t, len(b), 2)
+		tag, n := b[0], int(b[1])
+		b = b[2:]
+		if n&0x80 != 0 {
+			size := n & 0x7F
+			n = 0
+			for _, v := range b[:size] {
+				n = n<<8 | int(v)
+			}
+			b = b[size:]
+		}
+		require.GreaterOrEqual(t, len(b), n)
+		out = append(out, tlv{tag, b[:n]})
+		b = b[n:]
+	}
+	return out
+}
+
+func testMeasurements() (*synchrophasor.ConfigFrame, *synchrophasor.Measurements) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+	for _, name := range []string{"Sub 1", "Sub 2"} {
+		station := synchrophasor.NewPMUStation(name, 7734, true, true, true, true)
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.AddDigital([]string{"BRK"}, 0, 0xFFFF)
+		station.PhasorValues[0] = complex(0, 230)
+		station.Freq = 50
+		station.DigitalValues[0][0] = true
+		station.CfgCnt = 3
+		cfg.AddPMUStation(station)
+	}
+	cfg.PMUStationList[1].Stat = statSyncLost
+
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SOC = 1700000000
+	df.FracSec = 500000
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return cfg, &m
+}
+
+func TestEncoder(t *testing.T) {
+	cfg, m := testMeasurements()
+	key := []byte("secret")
+	enc, err := NewEncoder(cfg, EncoderOptions{AppID: 0x4000, MAC: MACHMACSHA256_128, Key: key, KeyID: 7})
+	require.NoError(t, err)
+
+	b, err := enc.Append(nil, m)
+	require.NoError(t, err)
+
+	// Transport, session and common header
+	require.Equal(t, []byte{transportLI, transportTI, sessionSV, 24, commonHeaderPI, commonHeaderLen}, b[:6])
+	require.Equal(t, uint32(len(b)-10), binary.BigEndian.Uint32(b[6:]))
+	require.Equal(t, uint32(0), binary.BigEndian.Uint32(b[10:]))
+	require.Equal(t, uint16(sessionVersion), binary.BigEndian.Uint16(b[14:]))
+	require.Equal(t, byte(MACHMACSHA256_128), b[23])
+	require.Equal(t, uint32(7), binary.BigEndian.Uint32(b[24:]))
+
+	// Payload element
+	payloadLen := int(binary.BigEndian.Uint32(b[28:]))
+	payload := b[32 : 32+payloadLen]
+	require.Equal(t, byte(payloadSV), payload[0])
+	require.Equal(t, uint16(0x4000), binary.BigEndian.Uint16(payload[2:]))
+	apdu := payload[6:]
+	require.Equal(t, int(binary.BigEndian.Uint16(payload[4:])), len(apdu))
+
+	// Signature over the session PDU
+	sig := b[32+payloadLen:]
+	require.Equal(t, []byte{signatureTag, 16}, sig[:2])
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b[2 : 32+payloadLen])
+	require.Equal(t, mac.Sum(nil)[:16], sig[2:])
+
+	// savPdu with one ASDU per station
+	pdu := parseTLVs(t, apdu)
+	require.Len(t, pdu, 1)
+	require.Equal(t, byte(0x60), pdu[0].tag)
+	fields := parseTLVs(t, pdu[0].content)
+	require.Equal(t, []byte{2}, fields[0].content)
+	asdus := parseTLVs(t, fields[1].content)
+	require.Len(t, asdus, 2)
+
+	asdu := parseTLVs(t, asdus[0].content)
+	require.Equal(t, "Sub 1", string(asdu[0].content))
+	require.Equal(t, []byte{0, 0}, asdu[1].content)
+	require.Equal(t, []byte{0, 0, 0, 3}, asdu[2].content)
+	require.Equal(t, uint32(1700000000), binary.BigEndian.Uint32(asdu[3].content))
+	require.Equal(t, []byte{0x80, 0, 0, 0x1F}, asdu[3].content[4:])
+	require.Equal(t, []byte{2}, asdu[4].content)
+	require.Equal(t, []byte{0, 50}, asdu[5].content)
+
+	sample := asdu[6].content
+	require.Len(t, sample, 6*8)
+	require.InDelta(t, 230, math.Float32frombits(binary.BigEndian.Uint32(sample)), 1e-4)
+	require.InDelta(t, 90, math.Float32frombits(binary.BigEndian.Uint32(sample[8:])), 1e-4)
+	require.Equal(t, float32(50), math.Float32frombits(binary.BigEndian.Uint32(sample[16:])))
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(sample[40:]))
+	require.Equal(t, uint32(0), binary.BigEndian.Uint32(sample[44:]))
+
+	// Lost synchronization marks the values questionable
+	asdu = parseTLVs(t, asdus[1].content)
+	require.Equal(t, []byte{0}, asdu[4].content)
+	require.Equal(t, byte(0x3F), asdu[3].content[7])
+	require.Equal(t, uint32(qualityQuestionable), binary.BigEndian.Uint32(asdu[6].content[4:]))
+
+	// Counters advance per SPDU
+	b, err = enc.Append(b[:0], m)
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(b[10:]))
+
+	_, err = NewEncoder(cfg, EncoderOptions{MAC: MACHMACSHA256_80})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
+
+func TestSender(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+
+	cfg, m := testMeasurements()
+	sender, err := New(cfg, Options{Addr: l.LocalAddr().String()})
+	require.NoError(t, err)
+	require.NoError(t, sender.Write(m))
+	require.ErrorIs(t, sender.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+	require.NoError(t, sender.Close())
+
+	buf := make([]byte, 65536)
+	require.NoError(t, l.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := l.ReadFrom(buf)
+	require.NoError(t, err)
+
+	// Unsigned SPDUs end with the payload
+	require.Equal(t, byte(MACNone), buf[23])
+	require.Equal(t, uint32(n-10), binary.BigEndian.Uint32(buf[6:]))
+	require.Equal(t, n-32, int(binary.BigEndian.Uint32(buf[28:])))
+}
@@ -0,0 +1,489 @@
+// Package s3archive rolls raw frames into local archive segments and uploads
+// them to S3-compatible object storage. Segments are partitioned by station
+// and date, uploaded in resumable multipart uploads whose progress survives
+// restarts and dropped links, and removed locally and remotely by retention
+// policies.
+//
+// Local segments mirror the object keys below the prefix:
+//
+//	station=<station>/date=<YYYY-MM-DD>/<YYYYMMDDTHHMMSSZ>.c37a
+package s3archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/archive"
+)
+
+// File name suffixes of segments being written, complete segments and their
+// upload state
+const (
+	suffixTemp    = ".tmp"
+	suffixSegment = ".c37a"
+	suffixState   = ".upload"
+)
+
+// Options configures an Archiver
+type Options struct {
+	// Dir holds the local segments
+	Dir string
+	// Endpoint is the object storage URL, e.g. https://s3.eu-central-1.amazonaws.com
+	// or http://minio:9000. Objects are addressed path-style.
+	Endpoint string
+	// Region defaults to us-east-1
+	Region string
+	// Bucket receives the segments
+	Bucket string
+	// Prefix is prepended to the object keys, e.g. "pmu/"
+	Prefix string
+	// AccessKey, SecretKey and the optional SessionToken authenticate requests
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Station names the partition, defaults to the station name of single
+	// station streams and the stream ID code otherwise
+	Station string
+	// Roll starts a new segment at multiples of this duration, defaults to
+	// one hour
+	Roll time.Duration
+	// Archive configures the segment writer
+	Archive archive.Options
+	// PartSize is the size of multipart upload parts, defaults to 8 MiB. S3
+	// requires at least 5 MiB, smaller segments are uploaded in one request.
+	PartSize int
+	// KeepLocal keeps uploaded segments for this long, zero removes them
+	// after the upload
+	KeepLocal time.Duration
+	// Retention removes objects of older dates from the storage, zero keeps
+	// them
+	Retention time.Duration
+	// Client defaults to an http.Client with a one minute timeout
+	Client *http.Client
+}
+
+// uploadState is the progress of a segment upload, stored next to it
+type uploadState struct {
+	UploadID string   `json:"upload_id,omitempty"`
+	ETags    []string `json:"etags,omitempty"`
+	Done     bool     `json:"done,omitempty"`
+}
+
+// Archiver writes frames into segments and uploads complete ones. Write and
+// Close are not safe for concurrent use, Sync may run concurrently with them.
+type Archiver struct {
+	opts   Options
+	client *s3Client
+
+	// Segment writing
+	file   *os.File
+	writer *archive.Writer
+	name   string
+	end    int64
+	config []byte
+
+	// mu guards station, set by Write from the first configuration
+	mu      sync.Mutex
+	station string
+	// syncMu serializes Sync calls
+	syncMu sync.Mutex
+}
+
+// New creates an archiver. Segments left behind by a crash are completed, so
+// the next Sync uploads them.
+func New(opts Options) (*Archiver, error) {
+	if opts.Dir == "" || opts.Bucket == "" {
+		return nil, fmt.Errorf("%w: Dir and Bucket are required", synchrophasor.ErrInvalidParameter)
+	}
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint %q", synchrophasor.ErrInvalidParameter, opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Roll <= 0 {
+		opts.Roll = time.Hour
+	}
+	if opts.Roll%time.Second != 0 {
+		return nil, fmt.Errorf("%w: roll interval %v is not whole seconds", synchrophasor.ErrInvalidParameter, opts.Roll)
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = 8 << 20
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: time.Minute}
+	}
+	if opts.Station != "" {
+		opts.Station = sanitize(opts.Station)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(opts.Dir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil || d.IsDir():
+			return err
+		case strings.HasSuffix(path, suffixSegment+suffixTemp):
+			return os.Rename(path, strings.TrimSuffix(path, suffixTemp))
+		case strings.HasSuffix(path, suffixTemp):
+			// Upload states are written before being renamed
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Archiver{opts: opts, station: opts.Station}
+	a.client = &s3Client{endpoint: endpoint, opts: &a.opts, now: time.Now}
+	return a, nil
+}
+
+// Write adds a raw frame to the current segment, starting a new one when the
+// frame time crosses a roll boundary. Configuration frames are repeated at the
+// start of every segment.
+func (a *Archiver) Write(frame []byte) error {
+	if len(frame) < 16 {
+		return synchrophasor.ErrInvalidSize
+	}
+	frameType, err := synchrophasor.GetFrameType(frame)
+	if err != nil {
+		return err
+	}
+
+	switch frameType {
+	case synchrophasor.FrameTypeCfg1, synchrophasor.FrameTypeCfg2:
+		if err := a.setStation(frame); err != nil {
+			return err
+		}
+		a.config = append(a.config[:0], frame...)
+		if a.writer == nil {
+			return nil
+		}
+	case synchrophasor.FrameTypeData:
+		if a.config == nil {
+			return fmt.Errorf("%w: data frame before configuration", synchrophasor.ErrInvalidParameter)
+		}
+		soc := int64(uint32(frame[6])<<24 | uint32(frame[7])<<16 | uint32(frame[8])<<8 | uint32(frame[9]))
+		if a.writer == nil || soc >= a.end || soc < a.end-int64(a.opts.Roll/time.Second) {
+			if err := a.roll(soc); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	return a.writer.Write(frame)
+}
+
+// setStation names the partition after the first configuration unless set by
+// the options
+func (a *Archiver) setStation(frame []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.station != "" {
+		return nil
+	}
+	station, err := stationName(frame)
+	a.station = station
+	return err
+}
+
+// roll completes the current segment and starts one for time soc
+func (a *Archiver) roll(soc int64) error {
+	if err := a.finish(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	station := a.station
+	a.mu.Unlock()
+
+	roll := int64(a.opts.Roll / time.Second)
+	start := time.Unix(soc, 0).UTC()
+	dir := filepath.Join(a.opts.Dir, "station="+station, "date="+start.Format(time.DateOnly))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, start.Format("20060102T150405Z")+suffixSegment)
+	file, err := os.OpenFile(name+suffixTemp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	writer, err := archive.NewWriter(file, a.opts.Archive)
+	if err == nil {
+		err = writer.Write(a.config)
+	}
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	a.file, a.writer, a.name = file, writer, name
+	a.end = (soc/roll + 1) * roll
+	return nil
+}
+
+// finish completes the current segment, making it visible to Sync
+func (a *Archiver) finish() error {
+	if a.writer == nil {
+		return nil
+	}
+	err := errors.Join(a.writer.Close(), a.file.Sync(), a.file.Close())
+	if err == nil {
+		err = os.Rename(a.name+suffixTemp, a.name)
+	}
+	a.file, a.writer = nil, nil
+	return err
+}
+
+// Close completes the current segment. Uploads are left to Sync.
+func (a *Archiver) Close() error {
+	return a.finish()
+}
+
+// Sync uploads the complete segments, continuing interrupted uploads, and
+// applies the retention policies. It returns the errors of all failed
+// segments; these are retried by the next call.
+func (a *Archiver) Sync(ctx context.Context) error {
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+
+	var segments []string
+	err := filepath.WalkDir(a.opts.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, suffixSegment) {
+			segments = append(segments, path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(segments)
+
+	var errs []error
+	for _, path := range segments {
+		if err := a.upload(ctx, path); err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				return errors.Join(errs...)
+			}
+		}
+	}
+	if a.opts.Retention > 0 {
+		if err := a.expire(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// upload uploads a segment unless done before and removes it once KeepLocal
+// has passed
+func (a *Archiver) upload(ctx context.Context, path string) error {
+	state, err := readState(path)
+	if err != nil {
+		return err
+	}
+	if !state.Done {
+		if err := a.uploadSegment(ctx, path, &state); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if time.Since(info.ModTime()) < a.opts.KeepLocal {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := os.Remove(path + suffixState); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// Empty partition directories are removed as well
+	for dir := filepath.Dir(path); dir != filepath.Clean(a.opts.Dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// uploadSegment uploads a segment, in parts for segments above PartSize. The
+// state is saved after every part, so an interrupted upload continues with
+// the next part.
+func (a *Archiver) uploadSegment(ctx context.Context, path string, state *uploadState) error {
+	rel, err := filepath.Rel(a.opts.Dir, path)
+	if err != nil {
+		return err
+	}
+	key := a.opts.Prefix + filepath.ToSlash(rel)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	part := make([]byte, min(int64(a.opts.PartSize), info.Size()))
+	if info.Size() <= int64(a.opts.PartSize) {
+		if _, err := io.ReadFull(file, part); err != nil {
+			return err
+		}
+		if err := a.client.putObject(ctx, key, part); err != nil {
+			return err
+		}
+		return a.saveState(path, &uploadState{Done: true})
+	}
+
+	for {
+		if state.UploadID == "" {
+			if state.UploadID, err = a.client.createUpload(ctx, key); err != nil {
+				return err
+			}
+			state.ETags = nil
+			if err := a.saveState(path, state); err != nil {
+				return err
+			}
+		}
+
+		err = a.uploadParts(ctx, file, key, state)
+		if !errors.Is(err, errNoSuchUpload) {
+			break
+		}
+		// The upload expired or was aborted, start over
+		state.UploadID = ""
+	}
+	if err != nil {
+		return err
+	}
+	return a.saveState(path, &uploadState{Done: true})
+}
+
+// uploadParts uploads the missing parts and completes the upload
+func (a *Archiver) uploadParts(ctx context.Context, file *os.File, key string, state *uploadState) error {
+	part := make([]byte, a.opts.PartSize)
+	for offset := int64(len(state.ETags)) * int64(a.opts.PartSize); ; offset += int64(a.opts.PartSize) {
+		n, err := file.ReadAt(part, offset)
+		if n == 0 && errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		etag, err := a.client.uploadPart(ctx, key, state.UploadID, len(state.ETags)+1, part[:n])
+		if err != nil {
+			return err
+		}
+		state.ETags = append(state.ETags, etag)
+		if err := a.saveState(file.Name(), state); err != nil {
+			return err
+		}
+	}
+	return a.client.completeUpload(ctx, key, state.UploadID, state.ETags)
+}
+
+// expire removes objects of the station whose date partition is older than
+// the retention
+func (a *Archiver) expire(ctx context.Context) error {
+	a.mu.Lock()
+	station := a.station
+	a.mu.Unlock()
+	if station == "" {
+		return nil
+	}
+	prefix := a.opts.Prefix + "station=" + station + "/"
+	keys, err := a.client.listObjects(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().UTC().Add(-a.opts.Retention).Format(time.DateOnly)
+	for _, key := range keys {
+		date, _, ok := strings.Cut(strings.TrimPrefix(key, prefix+"date="), "/")
+		if !ok || len(date) != len(time.DateOnly) || date >= cutoff {
+			continue
+		}
+		if err := a.client.deleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readState returns the upload state of a segment, empty if none was saved
+func readState(path string) (uploadState, error) {
+	var state uploadState
+	data, err := os.ReadFile(path + suffixState)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		// A state torn by a crash restarts the upload
+		return uploadState{}, nil
+	}
+	return state, nil
+}
+
+// saveState atomically replaces the upload state of a segment
+func (a *Archiver) saveState(path string, state *uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+suffixState+suffixTemp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+suffixState+suffixTemp, path+suffixState)
+}
+
+// stationName returns the partition name of a configuration frame
+func stationName(frame []byte) (string, error) {
+	cfg := synchrophasor.NewConfigFrame()
+	if err := cfg.Unpack(frame); err != nil {
+		return "", err
+	}
+	if len(cfg.PMUStationList) == 1 {
+		if name := sanitize(cfg.PMUStationList[0].STN); name != "" {
+			return name, nil
+		}
+	}
+	return strconv.Itoa(int(cfg.IDCode)), nil
+}
+
+// sanitize replaces characters other than letters, digits, dots, dashes and
+// underscores, keeping keys and file names portable
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || '0' <= r && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(s))
+}
@@ -0,0 +1,258 @@
+package s3archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRequest is returned when the object storage rejects a request
+var ErrRequest = errors.New("s3 request failed")
+
+// errNoSuchUpload is returned for multipart uploads aborted or expired on the
+// server, which are restarted
+var errNoSuchUpload = errors.New("no such upload")
+
+// s3Client is a minimal S3 client using path-style URLs and Signature
+// Version 4, enough for uploads, listings and deletions
+type s3Client struct {
+	endpoint *url.URL
+	opts     *Options
+	now      func() time.Time
+}
+
+// s3Error is the error document returned by S3
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// objectURL returns the URL of key, escaped as required by the signature
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	path := strings.TrimSuffix(u.Path, "/") + "/" + c.opts.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	u.Path = path
+	u.RawPath = escapePath(path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do signs and sends a request and returns the response body, or an error
+// wrapping ErrRequest for other status codes than 2xx
+func (c *s3Client) do(ctx context.Context, method, key string, query url.Values,
+	body []byte) (http.Header, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.ContentLength = int64(len(body))
+	c.sign(req, body)
+
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// CompleteMultipartUpload may fail after sending 200 OK
+	var e s3Error
+	if resp.StatusCode/100 != 2 || bytes.Contains(data[:min(len(data), 256)], []byte("<Error>")) {
+		_ = xml.Unmarshal(data, &e)
+		if e.Code == "NoSuchUpload" {
+			return nil, nil, errNoSuchUpload
+		}
+		return nil, nil, fmt.Errorf("%w: %s %s: %s %s %s", ErrRequest, method, key, resp.Status, e.Code, e.Message)
+	}
+	return resp.Header, data, nil
+}
+
+// sign adds the Signature Version 4 headers, signing all headers of req
+func (c *s3Client) sign(req *http.Request, body []byte) {
+	now := c.now().UTC()
+	date := now.Format("20060102T150405Z")
+	day := date[:8]
+
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if c.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.opts.SessionToken)
+	}
+
+	names := []string{"host"}
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		names = append(names, name)
+		headers[name] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + hex.EncodeToString(payload[:]))
+
+	scope := day + "/" + c.opts.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + c.opts.SecretKey)
+	for _, part := range []string{day, c.opts.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		c.opts.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escape encodes s as URI component, keeping only unreserved characters
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// escapePath escapes every segment of a path
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = escape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes query sorted by name
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, v := range query[name] {
+			parts = append(parts, escape(name)+"="+escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// putObject uploads an object in a single request
+func (c *s3Client) putObject(ctx context.Context, key string, body []byte) error {
+	_, _, err := c.do(ctx, http.MethodPut, key, nil, body)
+	return err
+}
+
+// createUpload starts a multipart upload and returns its ID
+func (c *s3Client) createUpload(ctx context.Context, key string) (string, error) {
+	_, data, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("%w: no upload ID for %s", ErrRequest, key)
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart uploads part number n and returns its ETag
+func (c *s3Client) uploadPart(ctx context.Context, key, uploadID string, n int, body []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+	header, _, err := c.do(ctx, http.MethodPut, key, query, body)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("ETag"), nil
+}
+
+// completeUpload assembles the uploaded parts
+func (c *s3Client) completeUpload(ctx context.Context, key, uploadID string, etags []string) error {
+	var b strings.Builder
+	b.WriteString("<CompleteMultipartUpload>")
+	for i, etag := range etags {
+		fmt.Fprintf(&b, "<Part><PartNumber>%d</PartNumber><ETag>", i+1)
+		_ = xml.EscapeText(&b, []byte(etag))
+		b.WriteString("</ETag></Part>")
+	}
+	b.WriteString("</CompleteMultipartUpload>")
+	_, _, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, []byte(b.String()))
+	return err
+}
+
+// listObjects returns the keys starting with prefix
+func (c *s3Client) listObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		_, data, err := c.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("%w: listing: %v", ErrRequest, err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// deleteObject removes an object
+func (c *s3Client) deleteObject(ctx context.Context, key string) error {
+	_, _, err := c.do(ctx, http.MethodDelete, key, nil, nil)
+	return err
+}
@@ -0,0 +1,149 @@
+package smooth
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Method selects a smoothing filter
+type Method uint8
+
+const (
+	// MethodNone passes the samples unchanged
+	MethodNone Method = iota
+	// MethodAverage averages the latest Window samples
+	MethodAverage
+	// MethodMedian takes the median of the latest Window samples, removing
+	// isolated spikes without blurring steps
+	MethodMedian
+	// MethodLowPass is a first-order low-pass filter with the time constant
+	// TimeConstant, following irregular sample intervals
+	MethodLowPass
+)
+
+// Spec configures a filter
+type Spec struct {
+	Method Method
+	// Window is the number of samples of MethodAverage and MethodMedian
+	Window int
+	// TimeConstant of MethodLowPass
+	TimeConstant time.Duration
+}
+
+// Filter smooths a series of samples
+type Filter interface {
+	// Next adds the sample v at time t in seconds and returns the filtered
+	// value. Until the window is filled, the filter works on the samples
+	// added so far.
+	Next(t, v float64) float64
+	// Reset discards the samples
+	Reset()
+}
+
+// New returns a filter of the spec
+func (s Spec) New() (Filter, error) {
+	switch s.Method {
+	case MethodNone:
+		return none{}, nil
+	case MethodAverage, MethodMedian:
+		if s.Window <= 0 {
+			return nil, fmt.Errorf("%w: window of %d samples", synchrophasor.ErrInvalidParameter, s.Window)
+		}
+		w := &window{samples: make([]float64, 0, s.Window)}
+		if s.Method == MethodMedian {
+			return &median{window: w, sorted: make([]float64, 0, s.Window)}, nil
+		}
+		return &average{window: w}, nil
+	case MethodLowPass:
+		if s.TimeConstant <= 0 {
+			return nil, fmt.Errorf("%w: time constant %v", synchrophasor.ErrInvalidParameter, s.TimeConstant)
+		}
+		return &lowPass{tau: s.TimeConstant.Seconds()}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown filter method %d", synchrophasor.ErrInvalidParameter, s.Method)
+}
+
+// none passes the samples unchanged
+type none struct{}
+
+func (none) Next(_, v float64) float64 { return v }
+func (none) Reset()                    {}
+
+// window is a ring of the latest samples
+type window struct {
+	samples []float64
+	next    int
+}
+
+// add adds v, replacing the oldest sample once the window is full
+func (w *window) add(v float64) {
+	if len(w.samples) < cap(w.samples) {
+		w.samples = append(w.samples, v)
+		return
+	}
+	w.samples[w.next] = v
+	w.next = (w.next + 1) % len(w.samples)
+}
+
+func (w *window) Reset() {
+	w.samples, w.next = w.samples[:0], 0
+}
+
+// average is a moving average
+type average struct {
+	*window
+}
+
+func (a *average) Next(_, v float64) float64 {
+	a.add(v)
+	sum := 0.0
+	for _, s := range a.samples {
+		sum += s
+	}
+	return sum / float64(len(a.samples))
+}
+
+// median is a moving median
+type median struct {
+	*window
+	sorted []float64
+}
+
+func (m *median) Next(_, v float64) float64 {
+	m.add(v)
+	m.sorted = append(m.sorted[:0], m.samples...)
+	sort.Float64s(m.sorted)
+	n := len(m.sorted)
+	if n%2 == 1 {
+		return m.sorted[n/2]
+	}
+	return (m.sorted[n/2-1] + m.sorted[n/2]) / 2
+}
+
+// lowPass is a first-order low-pass filter, discretized for the interval
+// since the previous sample
+type lowPass struct {
+	tau     float64
+	t, y    float64
+	started bool
+}
+
+func (l *lowPass) Next(t, v float64) float64 {
+	if !l.started || t <= l.t {
+		// The first sample and samples out of order restart the filter
+		l.t, l.y, l.started = t, v, true
+		return v
+	}
+	alpha := 1 - math.Exp(-(t-l.t)/l.tau)
+	l.t = t
+	l.y += alpha * (v - l.y)
+	return l.y
+}
+
+func (l *lowPass) Reset() {
+	l.started = false
+}
@@ -0,0 +1,114 @@
+// Package smooth filters the frequency and ROCOF of measurement streams with
+// moving average, median or low-pass filters, since raw device ROCOF is
+// notoriously noisy, and optionally derives ROCOF from the smoothed frequency
+package smooth
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Options configures a Smoother
+type Options struct {
+	// Frequency filters the frequency of every station
+	Frequency Spec
+	// ROCOF filters the ROCOF of every station
+	ROCOF Spec
+	// DeriveROCOF replaces the reported ROCOF by the rate of change of the
+	// filtered frequency between consecutive sets, before the ROCOF filter
+	DeriveROCOF bool
+}
+
+// station holds the filters of a station
+type station struct {
+	freq, rocof Filter
+	// t and f are the time and filtered frequency of the previous valid set
+	t, f  float64
+	valid bool
+}
+
+// Smoother filters the frequency and ROCOF of the stations of a stream. It is
+// not safe for concurrent use.
+type Smoother struct {
+	opts     Options
+	stations []station
+	out      synchrophasor.Measurements
+}
+
+// New creates a smoother for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Smoother, error) {
+	s := &Smoother{opts: opts}
+	if err := s.SetConfig(cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetConfig replaces the configuration, restarting the filters
+func (s *Smoother) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	stations := make([]station, len(cfg.PMUStationList))
+	for i := range stations {
+		var err error
+		if stations[i].freq, err = s.opts.Frequency.New(); err != nil {
+			return fmt.Errorf("frequency: %w", err)
+		}
+		if stations[i].rocof, err = s.opts.ROCOF.New(); err != nil {
+			return fmt.Errorf("ROCOF: %w", err)
+		}
+	}
+	s.stations = stations
+	return nil
+}
+
+// Reset restarts the filters, e.g. after a reconnect
+func (s *Smoother) Reset() {
+	for i := range s.stations {
+		st := &s.stations[i]
+		st.freq.Reset()
+		st.rocof.Reset()
+		st.valid = false
+	}
+}
+
+// Write calls fn with m whose frequency and ROCOF are filtered, flagging the
+// stations as modified. Stations with invalid data are passed unchanged and
+// skipped by the filters. The set passed to fn is only valid during the call
+// and m is not modified.
+func (s *Smoother) Write(m *synchrophasor.Measurements, fn func(m *synchrophasor.Measurements) error) error {
+	if len(m.Stations) != len(s.stations) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.stations))
+	}
+
+	m.CopyTo(&s.out)
+	modifies := s.opts.Frequency.Method != MethodNone || s.opts.ROCOF.Method != MethodNone || s.opts.DeriveROCOF
+	for i := range s.stations {
+		st, out := &s.stations[i], &s.out.Stations[i]
+		freq, rocof := float64(out.Frequency), float64(out.ROCOF)
+		if out.Stat&synchrophasor.StatDataError != 0 || math.IsNaN(freq) || math.IsInf(freq, 0) {
+			continue
+		}
+
+		freq = st.freq.Next(m.Time, freq)
+		if s.opts.DeriveROCOF {
+			derived := st.valid && m.Time > st.t
+			st.t, st.f, st.valid, rocof = m.Time, freq, true, (freq-st.f)/(m.Time-st.t)
+			if !derived {
+				// The first set has no previous frequency, so the ROCOF is
+				// left as reported
+				rocof = float64(out.ROCOF)
+			}
+		}
+		if !math.IsNaN(rocof) && !math.IsInf(rocof, 0) {
+			rocof = st.rocof.Next(m.Time, rocof)
+		}
+
+		out.Frequency, out.ROCOF = float32(freq), float32(rocof)
+		if modifies {
+			out.Stat |= synchrophasor.StatDataModified
+		}
+	}
+	return fn(&s.out)
+}
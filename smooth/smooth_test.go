@@ -0,0 +1,110 @@
+package smooth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second with the
+// same frequency and ROCOF at all stations
+func set(cfg *synchrophasor.ConfigFrame, i int, freq, rocof float32) *synchrophasor.Measurements {
+	for _, pmu := range cfg.PMUStationList {
+		pmu.Freq = freq
+		pmu.DFreq = rocof
+	}
+	return testutil.Measurements(cfg, i)
+}
+
+func TestFilters(t *testing.T) {
+	next := func(f Filter, values ...float64) []float64 {
+		out := make([]float64, len(values))
+		for i, v := range values {
+			out[i] = f.Next(float64(i)/10, v)
+		}
+		return out
+	}
+
+	f, err := Spec{Method: MethodAverage, Window: 3}.New()
+	require.NoError(t, err)
+	require.InDeltaSlice(t, []float64{3, 4.5, 5, 8}, next(f, 3, 6, 6, 12), 1e-12)
+
+	f, err = Spec{Method: MethodMedian, Window: 3}.New()
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 50.5, 1, 2, 2}, next(f, 1, 100, 1, 2, 2))
+	f.Reset()
+	require.Equal(t, []float64{7}, next(f, 7))
+
+	// After one time constant the step response reaches 1 - 1/e
+	f, err = Spec{Method: MethodLowPass, TimeConstant: 200 * time.Millisecond}.New()
+	require.NoError(t, err)
+	require.InDeltaSlice(t, []float64{0, 0.3935, 0.6321}, next(f, 0, 1, 1), 1e-4)
+
+	f, err = Spec{}.New()
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 2}, next(f, 1, 2))
+
+	_, err = Spec{Method: MethodMedian}.New()
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = Spec{Method: MethodLowPass}.New()
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	_, err = Spec{Method: 9}.New()
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
+
+func TestSmoother(t *testing.T) {
+	cfg := testConfig()
+	s, err := New(cfg, Options{
+		Frequency:   Spec{Method: MethodAverage, Window: 2},
+		DeriveROCOF: true,
+	})
+	require.NoError(t, err)
+
+	var out *synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		out = m
+		return nil
+	}
+	in := set(cfg, 0, 50, 3)
+	require.NoError(t, s.Write(in, keep))
+	require.Equal(t, float32(50), out.Stations[0].Frequency)
+	require.Equal(t, float32(3), out.Stations[0].ROCOF)
+	require.Equal(t, uint16(synchrophasor.StatDataModified), out.Stations[0].Stat)
+	require.Equal(t, uint16(0), in.Stations[0].Stat)
+
+	// The average of 50 and 50.2 is 50.1, 0.1 Hz up in 0.1 s
+	require.NoError(t, s.Write(set(cfg, 1, 50.2, 3), keep))
+	require.InDelta(t, 50.1, out.Stations[0].Frequency, 1e-5)
+	require.InDelta(t, 1, out.Stations[0].ROCOF, 1e-3)
+
+	// Invalid stations pass unchanged and skip the filters
+	m := set(cfg, 2, 0, 0)
+	m.Stations[1].Stat = 0x8000
+	m.Stations[0].Frequency = 50.2
+	require.NoError(t, s.Write(m, keep))
+	require.InDelta(t, 50.2, out.Stations[0].Frequency, 1e-5)
+	require.InDelta(t, 1, out.Stations[0].ROCOF, 1e-3)
+	require.Equal(t, float32(0), out.Stations[1].Frequency)
+	require.Equal(t, uint16(0x8000), out.Stations[1].Stat)
+	require.NoError(t, s.Write(set(cfg, 3, 50.2, 0), keep))
+	require.InDelta(t, 50.2, out.Stations[1].Frequency, 1e-5)
+	require.InDelta(t, 0.5, out.Stations[1].ROCOF, 1e-3)
+
+	s.Reset()
+	require.NoError(t, s.Write(set(cfg, 4, 49, 2), keep))
+	require.Equal(t, float32(49), out.Stations[0].Frequency)
+	require.Equal(t, float32(2), out.Stations[0].ROCOF)
+
+	require.ErrorIs(t, s.Write(&synchrophasor.Measurements{}, keep), synchrophasor.ErrInvalidParameter)
+	_, err = New(cfg, Options{ROCOF: Spec{Method: MethodAverage}})
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+}
@@ -0,0 +1,593 @@
+// Package soak runs a simulated deployment for hours: PMU servers, a gateway
+// tier concentrating and republishing their streams, and PDCs consuming the
+// republished streams. It samples the memory and goroutines of the process,
+// frame gaps and the delay of the frames along the way, and evaluates their
+// trends into a machine-readable pass/fail report. It catches the leaks and
+// slow degradation that short tests miss, e.g. goroutines piling up behind
+// blocked sends.
+package soak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/cmplx"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/gateway"
+	log "github.com/sirupsen/logrus"
+)
+
+// Options configures a run
+type Options struct {
+	// PMUs is the number of simulated PMU servers, defaults to 4
+	PMUs int
+	// DataRate is the frames per second of the simulated PMUs, defaults to 50
+	DataRate int16
+	// Consumers is the number of PDCs reading every republished stream,
+	// defaults to 2
+	Consumers int
+	// Duration is the length of the run, defaults to one hour
+	Duration time.Duration
+	// Interval is the sampling period, defaults to 10 s
+	Interval time.Duration
+	// Warmup is excluded from the trends, defaults to a tenth of Duration
+	Warmup time.Duration
+	// Limits are the thresholds of the checks
+	Limits Limits
+	// Progress is called with every sample
+	Progress func(Sample)
+	// Logger receives the logs of the servers and the gateway, discarded if nil
+	Logger *log.Logger
+}
+
+// Limits are the thresholds of the checks, zero values select the defaults
+type Limits struct {
+	// GoroutinesPerHour is the accepted goroutine growth, defaults to 10
+	GoroutinesPerHour float64
+	// HeapMBPerHour is the accepted live heap growth, defaults to 16 MB
+	HeapMBPerHour float64
+	// LeakedGoroutines is the number of goroutines accepted to remain after
+	// shutdown, defaults to 5
+	LeakedGoroutines int
+	// GapRatio is the accepted share of missed frames, defaults to 0.001
+	GapRatio float64
+	// DriftMsPerHour is the accepted growth of the frame delay, defaults to
+	// 50 ms
+	DriftMsPerHour float64
+}
+
+// Sample is the state of the run at one point in time. Frames, Gaps,
+// Reconnects and GatewayErrors are totals since the start.
+type Sample struct {
+	Elapsed       float64 `json:"elapsed_s"`
+	Goroutines    int     `json:"goroutines"`
+	HeapAlloc     uint64  `json:"heap_alloc"`
+	HeapInuse     uint64  `json:"heap_inuse"`
+	Sys           uint64  `json:"sys"`
+	NumGC         uint32  `json:"num_gc"`
+	Frames        uint64  `json:"frames"`
+	Gaps          uint64  `json:"gaps"`
+	Reconnects    uint64  `json:"reconnects"`
+	GatewayErrors uint64  `json:"gateway_errors"`
+	// LatencyMean and LatencyMax are the delays from the frame timestamps to
+	// their arrival at the consumers since the previous sample
+	LatencyMean float64 `json:"latency_mean_ms"`
+	LatencyMax  float64 `json:"latency_max_ms"`
+}
+
+// Check is the outcome of comparing a measured value with its limit
+type Check struct {
+	Name   string  `json:"name"`
+	Passed bool    `json:"passed"`
+	Value  float64 `json:"value"`
+	Limit  float64 `json:"limit"`
+	Detail string  `json:"detail"`
+}
+
+// Report is the result of a run
+type Report struct {
+	Start     time.Time `json:"start"`
+	Elapsed   float64   `json:"elapsed_s"`
+	PMUs      int       `json:"pmus"`
+	DataRate  int16     `json:"data_rate"`
+	Consumers int       `json:"consumers"`
+	// Baseline is the goroutine count before the run, Final the count after
+	// shutdown
+	Baseline int `json:"baseline_goroutines"`
+	Final    int `json:"final_goroutines"`
+	// GoroutineGrowth, HeapGrowth and Drift are the trends after the warmup
+	GoroutineGrowth float64  `json:"goroutine_growth_per_hour"`
+	HeapGrowth      float64  `json:"heap_growth_mb_per_hour"`
+	Drift           float64  `json:"latency_drift_ms_per_hour"`
+	Frames          uint64   `json:"frames"`
+	Gaps            uint64   `json:"gaps"`
+	Reconnects      uint64   `json:"reconnects"`
+	GatewayErrors   uint64   `json:"gateway_errors"`
+	Checks          []Check  `json:"checks"`
+	Samples         []Sample `json:"samples"`
+}
+
+// Passed reports whether all checks passed
+func (r *Report) Passed() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText writes the checks and totals of the report
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Soak test of %d PMUs at %d fps with %d consumers each, %s, %.0f s\n\n",
+		r.PMUs, r.DataRate, r.Consumers, r.Start.UTC().Format(time.RFC3339), r.Elapsed)
+	fmt.Fprintf(&b, "Frames %d, gaps %d, reconnects %d, gateway errors %d, goroutines %d before and %d after\n\n",
+		r.Frames, r.Gaps, r.Reconnects, r.GatewayErrors, r.Baseline, r.Final)
+	width := 0
+	for _, c := range r.Checks {
+		width = max(width, len(c.Name))
+	}
+	for _, c := range r.Checks {
+		status := "PASS"
+		if !c.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s  %-*s  %s\n", status, width, c.Name, c.Detail)
+	}
+	verdict := "PASS"
+	if !r.Passed() {
+		verdict = "FAIL"
+	}
+	fmt.Fprintf(&b, "\nResult: %s\n", verdict)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// harness is a running deployment
+type harness struct {
+	opts    Options
+	logger  *log.Logger
+	pmus    []*synchrophasor.PMU
+	streams []string
+	// listeners are the downstream listeners, which the gateway only closes
+	// for routes that received their upstream configuration
+	listeners []net.Listener
+
+	mu            sync.Mutex
+	frames        uint64
+	gaps          uint64
+	reconnects    uint64
+	gatewayErrors uint64
+	latencySum    float64
+	latencyCount  uint64
+	latencyMax    float64
+}
+
+// consumerTimeout bounds the waits of the consumers, and reconnectDelay
+// paces their reconnects
+const (
+	consumerTimeout = 10 * time.Second
+	reconnectDelay  = time.Second
+)
+
+// settleTimeout bounds the wait for goroutines to exit after shutdown, those
+// remaining longer count as leaked
+const settleTimeout = 2 * time.Second
+
+// Run runs the deployment until Duration is over or ctx is done. It returns
+// an error only if the deployment could not be set up.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	opts = withDefaults(opts)
+	h := &harness{opts: opts, logger: opts.Logger}
+	if h.logger == nil {
+		h.logger = log.New()
+		h.logger.SetOutput(io.Discard)
+	}
+
+	// Baseline before any listener or connection exists
+	baseline := settleGoroutines(0, 0)
+	start := time.Now()
+	// The workers outlive the last sample, which must not see them stopping
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, err := h.setup()
+	if err != nil {
+		h.stopPMUs()
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = g.Run(ctx)
+	}()
+	for _, addr := range h.streams {
+		for i := 0; i < opts.Consumers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.consume(ctx, addr)
+			}()
+		}
+	}
+
+	report := &Report{
+		Start:     start,
+		PMUs:      opts.PMUs,
+		DataRate:  opts.DataRate,
+		Consumers: opts.Consumers,
+		Baseline:  baseline,
+	}
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+sampling:
+	for {
+		select {
+		case <-ctx.Done():
+			break sampling
+		case <-ticker.C:
+			s := h.sample(start)
+			report.Samples = append(report.Samples, s)
+			if opts.Progress != nil {
+				opts.Progress(s)
+			}
+			if time.Since(start) > opts.Duration-opts.Interval/2 {
+				break sampling
+			}
+		}
+	}
+
+	cancel()
+	wg.Wait()
+	h.stopPMUs()
+	report.Elapsed = time.Since(start).Seconds()
+	report.Final = settleGoroutines(baseline, settleTimeout)
+	h.mu.Lock()
+	report.Frames, report.Gaps = h.frames, h.gaps
+	report.Reconnects, report.GatewayErrors = h.reconnects, h.gatewayErrors
+	h.mu.Unlock()
+
+	evaluate(report, opts)
+	return report, nil
+}
+
+// withDefaults fills in the unset options
+func withDefaults(opts Options) Options {
+	if opts.PMUs <= 0 {
+		opts.PMUs = 4
+	}
+	if opts.DataRate <= 0 {
+		opts.DataRate = 50
+	}
+	if opts.Consumers <= 0 {
+		opts.Consumers = 2
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = time.Hour
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Warmup <= 0 {
+		opts.Warmup = opts.Duration / 10
+	}
+	l := &opts.Limits
+	if l.GoroutinesPerHour <= 0 {
+		l.GoroutinesPerHour = 10
+	}
+	if l.HeapMBPerHour <= 0 {
+		l.HeapMBPerHour = 16
+	}
+	if l.LeakedGoroutines <= 0 {
+		l.LeakedGoroutines = 5
+	}
+	if l.GapRatio <= 0 {
+		l.GapRatio = 0.001
+	}
+	if l.DriftMsPerHour <= 0 {
+		l.DriftMsPerHour = 50
+	}
+	return opts
+}
+
+// setup starts the simulated PMUs and creates the gateway routing each of
+// them to a downstream server
+func (h *harness) setup() (*gateway.Gateway, error) {
+	routes := make([]gateway.Route, 0, h.opts.PMUs)
+	for i := 0; i < h.opts.PMUs; i++ {
+		pmu := h.newPMU(uint16(i + 1))
+		upstream, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		h.pmus = append(h.pmus, pmu)
+		go func() { _ = pmu.Serve(upstream) }()
+
+		downstream, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		h.listeners = append(h.listeners, downstream)
+		relay := synchrophasor.NewPMU()
+		relay.SetLogger(h.logger)
+		h.streams = append(h.streams, downstream.Addr().String())
+		routes = append(routes, gateway.Route{
+			Upstream:   gateway.Upstream{Address: upstream.Addr().String(), IDCode: uint16(i + 1)},
+			Downstream: gateway.Downstream{PMU: relay, Listener: downstream},
+			IDCode:     uint16(1001 + i),
+		})
+	}
+
+	return gateway.New(routes, gateway.Options{
+		Retry: reconnectDelay,
+		OnError: func(route int, err error) {
+			h.mu.Lock()
+			h.gatewayErrors++
+			h.mu.Unlock()
+			h.logger.WithField("route", route).WithError(err).Warn("Gateway upstream failed")
+		},
+	})
+}
+
+// newPMU creates a simulated PMU with one station of three voltage phasors
+// and a slowly swinging frequency
+func (h *harness) newPMU(id uint16) *synchrophasor.PMU {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = id
+	cfg.TimeBase = 1000000
+	cfg.DataRate = h.opts.DataRate
+	station := synchrophasor.NewPMUStation(fmt.Sprintf("SOAK %d", id), id, true, true, true, true)
+	for _, name := range []string{"VA", "VB", "VC"} {
+		station.AddPhasor(name, 915527, synchrophasor.PhunitVoltage)
+	}
+	station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+	station.AddDigital([]string{"BREAKER"}, 0, 0xFFFF)
+	cfg.AddPMUStation(station)
+
+	pmu := synchrophasor.NewPMU()
+	pmu.SetLogger(h.logger)
+	pmu.SetConfig(cfg)
+	pmu.SetDataProvider(synchrophasor.DataProviderFunc(func(cfg *synchrophasor.ConfigFrame, t time.Time) error {
+		seconds := float64(t.UnixNano()) / 1e9
+		st := cfg.PMUStationList[0]
+		st.Freq = float32(50 + 0.02*math.Sin(2*math.Pi*seconds/60))
+		st.DFreq = float32(0.02 * 2 * math.Pi / 60 * math.Cos(2*math.Pi*seconds/60))
+		for j := range st.PhasorValues {
+			st.PhasorValues[j] = cmplx.Rect(230000/math.Sqrt(3), -2*math.Pi*float64(j)/3)
+		}
+		st.AnalogValues[0] = float32(100 + 10*math.Sin(seconds))
+		return nil
+	}))
+	return pmu
+}
+
+// stopPMUs stops the simulated PMUs and closes the downstream listeners
+func (h *harness) stopPMUs() {
+	for _, pmu := range h.pmus {
+		pmu.Stop()
+	}
+	for _, listener := range h.listeners {
+		_ = listener.Close()
+	}
+}
+
+// consume reads a republished stream until ctx is done, reconnecting after
+// failures
+func (h *harness) consume(ctx context.Context, addr string) {
+	connected := false
+	for ctx.Err() == nil {
+		err := h.stream(ctx, addr, &connected)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.WithField("stream", addr).WithError(err).Warn("Consumer failed")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+		if connected {
+			h.mu.Lock()
+			h.reconnects++
+			h.mu.Unlock()
+		}
+	}
+}
+
+// stream reads one connection to a republished stream, counting gaps
+// between consecutive timestamps
+func (h *harness) stream(ctx context.Context, addr string, connected *bool) error {
+	pdc := synchrophasor.NewPDC(1)
+	if err := pdc.Connect(addr); err != nil {
+		return err
+	}
+	defer pdc.Disconnect()
+	conn := pdc.Socket
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := pdc.Socket.SetDeadline(time.Now().Add(consumerTimeout)); err != nil {
+		return err
+	}
+	cfg, err := pdc.GetConfig(2)
+	if err != nil {
+		return err
+	}
+	if err := pdc.Start(); err != nil {
+		return err
+	}
+	*connected = true
+
+	period := 1 / float64(cfg.DataRate)
+	var previous float64
+	for {
+		if err := pdc.Socket.SetReadDeadline(time.Now().Add(consumerTimeout)); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		frame, err := pdc.ReadFrame()
+		if err != nil {
+			if errors.Is(err, synchrophasor.ErrCRCFailed) {
+				continue
+			}
+			return err
+		}
+		df, ok := frame.(*synchrophasor.DataFrame)
+		if !ok {
+			continue
+		}
+
+		now := time.Now()
+		base := df.AssociatedConfig.TimeBase & 0xFFFFFF
+		stamp := float64(df.SOC)
+		if base > 0 {
+			stamp += float64(df.FracSec&0xFFFFFF) / float64(base)
+		}
+		var missed uint64
+		if previous != 0 {
+			if diff := stamp - previous; diff > 1.5*period {
+				missed = uint64(math.Round(diff/period)) - 1
+			}
+		}
+		previous = stamp
+		latency := (float64(now.UnixNano())/1e9 - stamp) * 1e3
+
+		h.mu.Lock()
+		h.frames++
+		h.gaps += missed
+		h.latencySum += latency
+		h.latencyCount++
+		h.latencyMax = max(h.latencyMax, latency)
+		h.mu.Unlock()
+	}
+}
+
+// sample reads the state of the process and resets the latency window
+func (h *harness) sample(start time.Time) Sample {
+	// Collect first so that the heap holds live objects only
+	runtime.GC()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := Sample{
+		Elapsed:       time.Since(start).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		Sys:           mem.Sys,
+		NumGC:         mem.NumGC,
+		Frames:        h.frames,
+		Gaps:          h.gaps,
+		Reconnects:    h.reconnects,
+		GatewayErrors: h.gatewayErrors,
+		LatencyMax:    h.latencyMax,
+	}
+	if h.latencyCount > 0 {
+		s.LatencyMean = h.latencySum / float64(h.latencyCount)
+	}
+	h.latencySum, h.latencyCount, h.latencyMax = 0, 0, 0
+	return s
+}
+
+// settleGoroutines waits up to timeout for the goroutine count to drop to
+// target and returns the last count
+func settleGoroutines(target int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= target || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// evaluate computes the trends of the samples after the warmup and the checks
+func evaluate(r *Report, opts Options) {
+	limits := opts.Limits
+	warmup := opts.Warmup.Seconds()
+	var t, goroutines, heap, latency []float64
+	for _, s := range r.Samples {
+		if s.Elapsed < warmup {
+			continue
+		}
+		t = append(t, s.Elapsed/3600)
+		goroutines = append(goroutines, float64(s.Goroutines))
+		heap = append(heap, float64(s.HeapAlloc)/1e6)
+		latency = append(latency, s.LatencyMean)
+	}
+
+	trend := func(name string, y []float64, limit float64, unit string) (float64, Check) {
+		if len(t) < 3 {
+			return 0, Check{Name: name, Passed: true, Limit: limit,
+				Detail: fmt.Sprintf("skipped, %d samples after the warmup", len(t))}
+		}
+		slope := slope(t, y)
+		return slope, Check{Name: name, Passed: slope <= limit, Value: slope, Limit: limit,
+			Detail: fmt.Sprintf("%+.2f %s per hour, limit %.2f", slope, unit, limit)}
+	}
+	var c Check
+	r.GoroutineGrowth, c = trend("goroutine_growth", goroutines, limits.GoroutinesPerHour, "goroutines")
+	r.Checks = append(r.Checks, c)
+	r.HeapGrowth, c = trend("heap_growth", heap, limits.HeapMBPerHour, "MB")
+	r.Checks = append(r.Checks, c)
+	r.Drift, c = trend("latency_drift", latency, limits.DriftMsPerHour, "ms")
+	r.Checks = append(r.Checks, c)
+
+	leaked := r.Final - r.Baseline
+	r.Checks = append(r.Checks, Check{
+		Name: "goroutines_after_shutdown", Passed: leaked <= limits.LeakedGoroutines,
+		Value: float64(leaked), Limit: float64(limits.LeakedGoroutines),
+		Detail: fmt.Sprintf("%d left over, limit %d", leaked, limits.LeakedGoroutines),
+	})
+
+	ratio := 0.0
+	if total := r.Frames + r.Gaps; total > 0 {
+		ratio = float64(r.Gaps) / float64(total)
+	}
+	r.Checks = append(r.Checks, Check{
+		Name: "gaps", Passed: r.Frames > 0 && ratio <= limits.GapRatio, Value: ratio, Limit: limits.GapRatio,
+		Detail: fmt.Sprintf("%d of %d frames missed (%.4f%%), limit %.4f%%",
+			r.Gaps, r.Frames+r.Gaps, ratio*100, limits.GapRatio*100),
+	})
+	r.Checks = append(r.Checks, Check{
+		Name: "reconnects", Passed: r.Reconnects == 0 && r.GatewayErrors == 0,
+		Value: float64(r.Reconnects + r.GatewayErrors),
+		Detail: fmt.Sprintf("%d consumer reconnects, %d gateway upstream errors",
+			r.Reconnects, r.GatewayErrors),
+	})
+}
+
+// slope returns the least squares slope of y over x
+func slope(x, y []float64) float64 {
+	n := float64(len(x))
+	var sx, sy, sxx, sxy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+		sxx += x[i] * x[i]
+		sxy += x[i] * y[i]
+	}
+	d := n*sxx - sx*sx
+	if d == 0 {
+		return 0
+	}
+	return (n*sxy - sx*sy) / d
+}
@@ -0,0 +1,110 @@
+package soak
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// shortLimits relaxes the per-hour trends, which seconds of noise extrapolate
+// to large values
+var shortLimits = Limits{GoroutinesPerHour: 1e9, HeapMBPerHour: 1e9, DriftMsPerHour: 1e9, GapRatio: 0.01}
+
+func TestRun(t *testing.T) {
+	var samples int
+	report, err := Run(context.Background(), Options{
+		PMUs:      2,
+		DataRate:  25,
+		Consumers: 2,
+		Duration:  3 * time.Second,
+		Interval:  250 * time.Millisecond,
+		Warmup:    time.Second,
+		Limits:    shortLimits,
+		Progress:  func(Sample) { samples++ },
+	})
+	require.NoError(t, err)
+
+	var text bytes.Buffer
+	require.NoError(t, report.WriteText(&text))
+	require.True(t, report.Passed(), text.String())
+	require.Equal(t, len(report.Samples), samples)
+	require.GreaterOrEqual(t, samples, 10)
+	// Four consumers at 25 fps for about two seconds after connecting
+	require.Greater(t, report.Frames, uint64(150))
+	require.Zero(t, report.Reconnects)
+	last := report.Samples[len(report.Samples)-1]
+	require.Positive(t, last.HeapAlloc)
+	require.Less(t, last.LatencyMean, 1000.0)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"goroutine_growth_per_hour"`)
+}
+
+func TestRunLeak(t *testing.T) {
+	// Goroutines piling up behind a blocked send on every sample
+	block := make(chan struct{})
+	defer close(block)
+	report, err := Run(context.Background(), Options{
+		PMUs:      1,
+		DataRate:  10,
+		Consumers: 1,
+		Duration:  2 * time.Second,
+		Interval:  200 * time.Millisecond,
+		Warmup:    200 * time.Millisecond,
+		Limits:    Limits{GoroutinesPerHour: 1e4, HeapMBPerHour: 1e9, DriftMsPerHour: 1e9, GapRatio: 0.01},
+		Progress: func(Sample) {
+			for i := 0; i < 10; i++ {
+				go func() { <-block }()
+			}
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, report.Passed())
+
+	failed := map[string]bool{}
+	for _, c := range report.Checks {
+		if !c.Passed {
+			failed[c.Name] = true
+		}
+	}
+	require.Equal(t, map[string]bool{"goroutine_growth": true, "goroutines_after_shutdown": true}, failed)
+	require.Greater(t, report.GoroutineGrowth, 1e4)
+}
+
+func TestEvaluate(t *testing.T) {
+	opts := withDefaults(Options{Duration: 10 * time.Hour, Warmup: time.Hour})
+	report := &Report{Baseline: 10, Final: 12, Frames: 1000000, Gaps: 10}
+	for i := 0; i <= 10; i++ {
+		report.Samples = append(report.Samples, Sample{
+			Elapsed:     float64(i) * 3600,
+			Goroutines:  50 + i*20,
+			HeapAlloc:   uint64(8e6 + float64(i)*1e6),
+			LatencyMean: 5,
+		})
+	}
+	// A warmup outlier does not count
+	report.Samples[0].Goroutines = 1000
+
+	evaluate(report, opts)
+	require.InDelta(t, 20, report.GoroutineGrowth, 1e-9)
+	require.InDelta(t, 1, report.HeapGrowth, 1e-9)
+	require.InDelta(t, 0, report.Drift, 1e-9)
+
+	passed := map[string]bool{}
+	for _, c := range report.Checks {
+		passed[c.Name] = c.Passed
+	}
+	require.Equal(t, map[string]bool{
+		"goroutine_growth":          false,
+		"heap_growth":               true,
+		"latency_drift":             true,
+		"goroutines_after_shutdown": true,
+		"gaps":                      true,
+		"reconnects":                true,
+	}, passed)
+}
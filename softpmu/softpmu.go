@@ -0,0 +1,375 @@
+// Package softpmu estimates synchrophasors, frequency and ROCOF from
+// point-on-wave samples, e.g. IEC 61850-9-2 sampled values or recorded
+// waveforms, with the P and M class reference models of IEEE C37.118.1
+// Annex C, optionally with harmonic phasors for power quality monitoring.
+// The sets can be published like any derived stream through
+// downsample.NewOutput, turning a sample source into a soft PMU.
+package softpmu
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"slices"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Class selects the reference filter
+type Class uint8
+
+const (
+	// ClassP is the protection class: a short triangular filter of two
+	// nominal cycles with fast response
+	ClassP Class = iota
+	// ClassM is the measurement class: a Hamming-windowed low-pass filter
+	// depending on the reporting rate, rejecting out-of-band interference
+	ClassM
+)
+
+// mClass holds the M class filter reference frequency and order of C37.118.1
+// Table C.1 by reporting rate, the order at 960 samples per second
+var mClass = map[int]struct {
+	ffr   float64
+	order int
+}{
+	10: {1.779, 806},
+	12: {2.201, 644},
+	15: {2.679, 536},
+	20: {3.640, 402},
+	25: {4.355, 322},
+	30: {5.461, 268},
+	50: {7.75, 182},
+	60: {8.732, 162},
+}
+
+// Channel is a sampled waveform
+type Channel struct {
+	// Name of the phasor, at most 16 characters
+	Name string
+	// Unit is synchrophasor.PhunitVoltage or synchrophasor.PhunitCurrent
+	Unit uint8
+}
+
+// Options configures an Estimator
+type Options struct {
+	// Station name and IDCode of the stream
+	Station string
+	IDCode  uint16
+	// SampleRate in samples per second, a multiple of the nominal frequency
+	// for P class, e.g. 4000 or 4800 for IEC 61850-9-2LE
+	SampleRate float64
+	// Nominal is the system frequency, 50 or 60 Hz, defaults to 60
+	Nominal float64
+	// Rate is the reporting rate in frames per second
+	Rate  int
+	Class Class
+	// Channels lists the sampled waveforms in the order of the values
+	// passed to Write
+	Channels []Channel
+	// FrequencyChannel is the index of the channel the frequency and ROCOF
+	// are estimated from, typically a voltage
+	FrequencyChannel int
+	// FilterFrequency and Order override the M class filter reference
+	// frequency in Hz and its order in samples, required for reporting rates
+	// not in Table C.1
+	FilterFrequency float64
+	Order           int
+	// Harmonics lists harmonic orders, e.g. 3 and 5, whose phasors are
+	// appended to the fundamentals as channels "<name> H3", per channel in
+	// the order of Channels. They are filtered like the fundamental,
+	// referenced to a cosine at the harmonic of the nominal frequency, and
+	// not compensated off nominal frequency.
+	Harmonics []int
+}
+
+// sample is a sample instant of all channels
+type sample struct {
+	time   int64
+	values []float64
+}
+
+// Estimator turns sample instants into measurement sets. It is not safe for
+// concurrent use.
+type Estimator struct {
+	opts Options
+	cfg  *synchrophasor.ConfigFrame
+	// weights are the filter coefficients from -half to half, gain their
+	// sum, and interval the sample interval in nanoseconds
+	weights  []float64
+	half     int
+	gain     float64
+	interval int64
+	// spacing is the distance in samples of the angles the frequency is
+	// derived from, half a nominal cycle
+	spacing int
+	// samples holds the latest sample instants, next the pending report time
+	samples []sample
+	free    [][]float64
+	next    int64
+	set     synchrophasor.Measurements
+}
+
+// New creates an estimator
+func New(opts Options) (*Estimator, error) {
+	if opts.Nominal == 0 {
+		opts.Nominal = 60
+	}
+	if opts.Nominal != 50 && opts.Nominal != 60 {
+		return nil, fmt.Errorf("%w: nominal frequency %v Hz", synchrophasor.ErrInvalidParameter, opts.Nominal)
+	}
+	if opts.Rate <= 0 || opts.SampleRate < 4*opts.Nominal {
+		return nil, fmt.Errorf("%w: reporting rate %d, sample rate %v",
+			synchrophasor.ErrInvalidParameter, opts.Rate, opts.SampleRate)
+	}
+	if len(opts.Channels) == 0 || opts.FrequencyChannel < 0 || opts.FrequencyChannel >= len(opts.Channels) {
+		return nil, fmt.Errorf("%w: %d channels, frequency channel %d",
+			synchrophasor.ErrInvalidParameter, len(opts.Channels), opts.FrequencyChannel)
+	}
+	for _, ch := range opts.Channels {
+		if ch.Name == "" || len(ch.Name) > 16 {
+			return nil, fmt.Errorf("%w: channel name %q empty or longer than 16 characters",
+				synchrophasor.ErrInvalidParameter, ch.Name)
+		}
+		for _, h := range opts.Harmonics {
+			if name := harmonicName(ch.Name, h); len(name) > 16 {
+				return nil, fmt.Errorf("%w: harmonic channel name %q longer than 16 characters",
+					synchrophasor.ErrInvalidParameter, name)
+			}
+		}
+	}
+	for _, h := range opts.Harmonics {
+		if h < 2 || float64(h)*opts.Nominal >= opts.SampleRate/2 {
+			return nil, fmt.Errorf("%w: harmonic %d not between 2 and the Nyquist frequency",
+				synchrophasor.ErrInvalidParameter, h)
+		}
+	}
+
+	e := &Estimator{
+		opts:     opts,
+		interval: int64(math.Round(1e9 / opts.SampleRate)),
+		spacing:  int(math.Round(opts.SampleRate / (2 * opts.Nominal))),
+	}
+	switch opts.Class {
+	case ClassP:
+		cycle := opts.SampleRate / opts.Nominal
+		if math.Abs(cycle-math.Round(cycle)) > 1e-9 {
+			return nil, fmt.Errorf("%w: sample rate %v not a multiple of %v Hz",
+				synchrophasor.ErrInvalidParameter, opts.SampleRate, opts.Nominal)
+		}
+		e.half = int(math.Round(cycle)) - 1
+		e.weights = make([]float64, 2*e.half+1)
+		for k := -e.half; k <= e.half; k++ {
+			e.weights[k+e.half] = 1 - 2*math.Abs(float64(k))/float64(2*e.half+2)
+		}
+	case ClassM:
+		ffr, order := opts.FilterFrequency, opts.Order
+		if ref, ok := mClass[opts.Rate]; ok {
+			if ffr <= 0 {
+				ffr = ref.ffr
+			}
+			if order <= 0 {
+				order = int(math.Round(float64(ref.order) * opts.SampleRate / 960))
+			}
+		}
+		if ffr <= 0 || order < 2 {
+			return nil, fmt.Errorf("%w: no M class filter for %d frames per second",
+				synchrophasor.ErrInvalidParameter, opts.Rate)
+		}
+		e.half = order / 2
+		e.weights = make([]float64, 2*e.half+1)
+		dt := 1 / opts.SampleRate
+		for k := -e.half; k <= e.half; k++ {
+			w := 1.0
+			if k != 0 {
+				x := 2 * math.Pi * 2 * ffr * float64(k) * dt
+				w = math.Sin(x) / x
+			}
+			hamming := 0.54 + 0.46*math.Cos(2*math.Pi*float64(k)/float64(2*e.half))
+			e.weights[k+e.half] = w * hamming
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown class %d", synchrophasor.ErrInvalidParameter, opts.Class)
+	}
+	for _, w := range e.weights {
+		e.gain += w
+	}
+	e.cfg = e.config()
+	return e, nil
+}
+
+// config returns the configuration of the stream
+func (e *Estimator) config() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = e.opts.IDCode
+	cfg.TimeBase = 1000000
+	cfg.DataRate = int16(e.opts.Rate)
+	station := synchrophasor.NewPMUStation(e.opts.Station, e.opts.IDCode, true, false, true, false)
+	if e.opts.Nominal == 50 {
+		station.Fnom = synchrophasor.FreqNom50Hz
+	}
+	for _, ch := range e.opts.Channels {
+		station.AddPhasor(ch.Name, 1, ch.Unit)
+	}
+	for _, ch := range e.opts.Channels {
+		for _, h := range e.opts.Harmonics {
+			station.AddPhasor(harmonicName(ch.Name, h), 1, ch.Unit)
+		}
+	}
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+// Config returns the configuration of the stream, e.g. for serving it through
+// downsample.NewOutput
+func (e *Estimator) Config() *synchrophasor.ConfigFrame {
+	return e.cfg
+}
+
+// Write adds the instantaneous values of all channels sampled at time t and
+// calls fn with the set of every reporting time whose filter window is
+// complete. Sets are delayed by half the window. A gap in the samples
+// restarts the windows, skipping the reports it covers. The set passed to fn
+// is only valid during the call.
+func (e *Estimator) Write(t time.Time, values []float64, fn func(m *synchrophasor.Measurements) error) error {
+	if len(values) != len(e.opts.Channels) {
+		return fmt.Errorf("%w: %d values, %d channels", synchrophasor.ErrInvalidParameter, len(values), len(e.opts.Channels))
+	}
+	ns := t.UnixNano()
+	if n := len(e.samples); n > 0 {
+		if gap := ns - e.samples[n-1].time; gap <= 0 || gap > e.interval*3/2 {
+			e.reset()
+		}
+	}
+	if len(e.samples) == 0 {
+		period := int64(time.Second) / int64(e.opts.Rate)
+		e.next = (ns + period - 1) / period * period
+	}
+	e.add(ns, values)
+
+	// The reports need the window around their center, extended by the
+	// spacing on either side for the frequency
+	reach := e.half + e.spacing
+	for {
+		c := e.center(e.next)
+		if c < 0 || c+reach >= len(e.samples) {
+			return nil
+		}
+		report := e.next
+		e.next += int64(time.Second) / int64(e.opts.Rate)
+		if c-reach < 0 {
+			continue
+		}
+		e.estimate(report, c)
+		err := fn(&e.set)
+		e.drop()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// add appends a sample instant, reusing dropped value slices
+func (e *Estimator) add(ns int64, values []float64) {
+	var v []float64
+	if n := len(e.free); n > 0 {
+		v, e.free = e.free[n-1], e.free[:n-1]
+	}
+	e.samples = append(e.samples, sample{ns, append(v[:0], values...)})
+}
+
+// reset discards the samples
+func (e *Estimator) reset() {
+	for _, s := range e.samples {
+		e.free = append(e.free, s.values)
+	}
+	e.samples = e.samples[:0]
+}
+
+// drop discards the samples no longer needed for the pending report
+func (e *Estimator) drop() {
+	keep := e.next - int64(e.half+e.spacing+1)*e.interval
+	n := 0
+	for n < len(e.samples) && e.samples[n].time < keep {
+		e.free = append(e.free, e.samples[n].values)
+		n++
+	}
+	if n > 0 {
+		e.samples = append(e.samples[:0], e.samples[n:]...)
+	}
+}
+
+// center returns the index of the sample closest to the report time, -1 if
+// the samples do not reach it yet
+func (e *Estimator) center(report int64) int {
+	for i, s := range e.samples {
+		if s.time >= report-e.interval/2 {
+			return i
+		}
+	}
+	return -1
+}
+
+// harmonicName returns the channel name of harmonic h of a channel
+func harmonicName(name string, h int) string {
+	return fmt.Sprintf("%s H%d", name, h)
+}
+
+// phasor returns the RMS phasor of a channel with the filter centred on
+// sample c, referenced to a cosine at nominal frequency synchronized to the
+// second
+func (e *Estimator) phasor(ch, c int) complex128 {
+	return e.harmonic(ch, c, 1)
+}
+
+// harmonic returns the RMS phasor of harmonic h of a channel with the filter
+// centred on sample c, referenced to a cosine at h times the nominal
+// frequency
+func (e *Estimator) harmonic(ch, c, h int) complex128 {
+	omega := 2 * math.Pi * e.opts.Nominal * float64(h)
+	var sum complex128
+	for k := -e.half; k <= e.half; k++ {
+		s := &e.samples[c+k]
+		// The fraction of the second keeps the argument small
+		frac := float64(s.time%int64(time.Second)) / 1e9
+		sum += complex(s.values[ch]*e.weights[k+e.half], 0) * cmplx.Rect(1, -omega*frac)
+	}
+	return sum * complex(math.Sqrt2/e.gain, 0)
+}
+
+// estimate fills the set of the report time from the filter centred on
+// sample c. The frequency and ROCOF are the first and second differences of
+// the angles half a nominal cycle apart, which cancels the double-frequency
+// ripple of single-phase estimates off nominal frequency.
+func (e *Estimator) estimate(report int64, c int) {
+	dt := float64(e.interval) / 1e9 * float64(e.spacing)
+	fc := e.opts.FrequencyChannel
+	before := cmplx.Phase(e.phasor(fc, c-e.spacing))
+	at := cmplx.Phase(e.phasor(fc, c))
+	after := cmplx.Phase(e.phasor(fc, c+e.spacing))
+	d1, d2 := math.Remainder(at-before, 2*math.Pi), math.Remainder(after-at, 2*math.Pi)
+	freq := e.opts.Nominal + (d1+d2)/(2*dt)/(2*math.Pi)
+	rocof := (d2 - d1) / (dt * dt) / (2 * math.Pi)
+
+	e.set.PMUID = e.opts.IDCode
+	e.set.Time = float64(report/int64(time.Second)) + float64(report%int64(time.Second))/1e9
+	e.set.Stations = slices.Grow(e.set.Stations[:0], 1)[:1]
+	st := &e.set.Stations[0]
+	st.StreamID, st.Stat = e.opts.IDCode, 0
+	st.Frequency, st.ROCOF = float32(freq), float32(rocof)
+	n := len(e.opts.Channels)
+	size := n * (1 + len(e.opts.Harmonics))
+	st.Phasors = slices.Grow(st.Phasors[:0], size)[:size]
+	for ch := range e.opts.Channels {
+		p := e.phasor(ch, c)
+		if e.opts.Class == ClassP {
+			// Compensation of the triangular filter gain off nominal frequency
+			p /= complex(math.Sin(math.Pi*(e.opts.Nominal+1.625*(freq-e.opts.Nominal))/(2*e.opts.Nominal)), 0)
+		}
+		st.Phasors[ch] = p
+		for i, h := range e.opts.Harmonics {
+			st.Phasors[n+ch*len(e.opts.Harmonics)+i] = e.harmonic(ch, c, h)
+		}
+	}
+}
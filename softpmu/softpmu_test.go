@@ -0,0 +1,151 @@
+package softpmu
+
+import (
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// feed writes the samples of a voltage and a current of frequency f from the
+// start time on for the given duration, returning the sets
+func feed(t *testing.T, e *Estimator, rate float64, f float64, start time.Time,
+	d time.Duration) []synchrophasor.Measurements {
+	var sets []synchrophasor.Measurements
+	keep := func(m *synchrophasor.Measurements) error {
+		c := *m
+		c.Stations = []synchrophasor.StationMeasurement{m.Stations[0]}
+		c.Stations[0].Phasors = append([]complex128(nil), m.Stations[0].Phasors...)
+		sets = append(sets, c)
+		return nil
+	}
+	n := int(d.Seconds() * rate)
+	for i := 0; i < n; i++ {
+		ts := start.Add(time.Duration(float64(i) / rate * 1e9))
+		x := float64(ts.UnixNano()%int64(time.Second)) / 1e9
+		v := math.Sqrt2 * 230 * math.Cos(2*math.Pi*f*x+0.3)
+		c := math.Sqrt2 * 100 * math.Cos(2*math.Pi*f*x+0.3-math.Pi/6)
+		require.NoError(t, e.Write(ts, []float64{v, c}, keep))
+	}
+	return sets
+}
+
+func channels() []Channel {
+	return []Channel{{Name: "VA", Unit: synchrophasor.PhunitVoltage}, {Name: "IA", Unit: synchrophasor.PhunitCurrent}}
+}
+
+func TestClassP(t *testing.T) {
+	e, err := New(Options{Station: "Soft", IDCode: 5, SampleRate: 4000, Nominal: 50, Rate: 50, Channels: channels()})
+	require.NoError(t, err)
+	cfg := e.Config()
+	require.Equal(t, int16(50), cfg.DataRate)
+	require.Equal(t, uint16(synchrophasor.FreqNom50Hz), cfg.PMUStationList[0].Fnom)
+	require.Len(t, cfg.PMUStationList[0].PhasorValues, 2)
+
+	start := time.Unix(1700000000, 0)
+	sets := feed(t, e, 4000, 50.5, start, time.Second)
+	// The first reports lack history, the last ones wait for samples
+	require.Len(t, sets, 47)
+	for _, m := range sets {
+		st := m.Stations[0]
+		require.Equal(t, uint16(5), m.PMUID)
+		require.InDelta(t, 50.5, st.Frequency, 0.005)
+		require.InDelta(t, 0, st.ROCOF, 0.01)
+
+		// The phasor rotates at 0.5 Hz against the nominal reference
+		frac := m.Time - math.Floor(m.Time)
+		want := cmplx.Rect(230, 2*math.Pi*0.5*frac+0.3)
+		require.Less(t, cmplx.Abs(st.Phasors[0]-want)/230, 0.01)
+		require.InDelta(t, 100, cmplx.Abs(st.Phasors[1]), 1)
+	}
+	require.InDelta(t, 1700000000.04, sets[0].Time, 1e-6)
+
+	// A gap restarts the windows
+	sets = feed(t, e, 4000, 50.5, start.Add(2*time.Second), 100*time.Millisecond)
+	require.Len(t, sets, 2)
+	require.InDelta(t, 1700000002.04, sets[0].Time, 1e-6)
+}
+
+func TestClassM(t *testing.T) {
+	e, err := New(Options{Station: "Soft", SampleRate: 960, Rate: 60, Class: ClassM, Channels: channels()})
+	require.NoError(t, err)
+	require.Len(t, e.weights, 163)
+
+	sets := feed(t, e, 960, 60, time.Unix(1700000000, 0), time.Second)
+	require.NotEmpty(t, sets)
+	for _, m := range sets {
+		st := m.Stations[0]
+		require.InDelta(t, 60, st.Frequency, 1e-6)
+		require.Less(t, cmplx.Abs(st.Phasors[0]-cmplx.Rect(230, 0.3))/230, 0.001)
+	}
+}
+
+func TestHarmonics(t *testing.T) {
+	e, err := New(Options{
+		Station: "Soft", SampleRate: 4000, Nominal: 50, Rate: 50, Channels: channels(), Harmonics: []int{3, 5},
+	})
+	require.NoError(t, err)
+	var names []string
+	for _, name := range e.Config().PMUStationList[0].CHNAMPhasor {
+		names = append(names, strings.TrimSpace(name))
+	}
+	require.Equal(t, []string{"VA", "IA", "VA H3", "VA H5", "IA H3", "IA H5"}, names)
+	require.Equal(t, uint32(synchrophasor.PhunitCurrent), e.Config().PMUStationList[0].Phunit[5]>>24)
+
+	// 5% third and 10% fifth harmonic in the voltage, 20% third in the current
+	var sets []synchrophasor.Measurements
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 4000; i++ {
+		ts := start.Add(time.Duration(float64(i) / 4000 * 1e9))
+		x := 2 * math.Pi * 50 * float64(ts.UnixNano()%int64(time.Second)) / 1e9
+		v := math.Sqrt2 * (230*math.Cos(x+0.3) + 11.5*math.Cos(3*x-0.5) + 23*math.Cos(5*x+1))
+		c := math.Sqrt2 * (100*math.Cos(x-0.2) + 20*math.Cos(3*x+0.4))
+		require.NoError(t, e.Write(ts, []float64{v, c}, func(m *synchrophasor.Measurements) error {
+			c := *m
+			c.Stations = []synchrophasor.StationMeasurement{m.Stations[0]}
+			c.Stations[0].Phasors = append([]complex128(nil), m.Stations[0].Phasors...)
+			sets = append(sets, c)
+			return nil
+		}))
+	}
+	require.NotEmpty(t, sets)
+	for _, m := range sets {
+		st := m.Stations[0]
+		require.Len(t, st.Phasors, 6)
+		require.InDelta(t, 50, st.Frequency, 1e-6)
+		for i, want := range []complex128{
+			cmplx.Rect(230, 0.3), cmplx.Rect(100, -0.2),
+			cmplx.Rect(11.5, -0.5), cmplx.Rect(23, 1), cmplx.Rect(20, 0.4), 0,
+		} {
+			require.Less(t, cmplx.Abs(st.Phasors[i]-want), 0.01, "phasor %d", i)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, opts := range []Options{
+		{SampleRate: 4000, Nominal: 55, Rate: 50, Channels: channels()},
+		{SampleRate: 100, Rate: 50, Channels: channels()},
+		{SampleRate: 4000, Rate: 50},
+		{SampleRate: 4000, Rate: 50, Channels: channels(), FrequencyChannel: 2},
+		{SampleRate: 4000, Rate: 50, Channels: []Channel{{Name: "Voltage phase A bus 1"}}},
+		{SampleRate: 4001, Rate: 50, Channels: channels()},
+		{SampleRate: 4000, Rate: 5, Class: ClassM, Channels: channels()},
+		{SampleRate: 4000, Rate: 50, Class: 7, Channels: channels()},
+		{SampleRate: 4000, Rate: 50, Channels: channels(), Harmonics: []int{1}},
+		{SampleRate: 960, Rate: 60, Channels: channels(), Harmonics: []int{8}},
+		{SampleRate: 4000, Rate: 50, Channels: []Channel{{Name: "Voltage phase A"}}, Harmonics: []int{3}},
+	} {
+		_, err := New(opts)
+		require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	}
+	e, err := New(Options{
+		SampleRate: 4000, Rate: 5, Class: ClassM, FilterFrequency: 0.9, Order: 6000, Channels: channels(),
+	})
+	require.NoError(t, err)
+	require.ErrorIs(t, e.Write(time.Now(), []float64{1}, nil), synchrophasor.ErrInvalidParameter)
+}
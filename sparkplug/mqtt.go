@@ -0,0 +1,316 @@
+package sparkplug
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// ErrConnectionRefused is returned when the broker rejects the connection
+var ErrConnectionRefused = errors.New("mqtt connection refused")
+
+// message is a received PUBLISH
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// will is the last will published by the broker when the client disappears
+type will struct {
+	topic   string
+	payload []byte
+	qos     byte
+}
+
+// connectOptions holds the CONNECT parameters
+type connectOptions struct {
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	will      *will
+	tls       *tls.Config
+	timeout   time.Duration
+}
+
+// mqttConn is a minimal MQTT 3.1.1 client supporting QoS 0 publishing,
+// subscriptions and a last will
+type mqttConn struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	mu       sync.Mutex // serializes writes
+	buf      []byte
+	nextID   uint16
+	messages chan message
+	done     chan struct{}
+	err      error
+}
+
+// dialMQTT connects to a broker at address and performs the CONNECT handshake
+func dialMQTT(address string, opts connectOptions) (*mqttConn, error) {
+	dialer := &net.Dialer{Timeout: opts.timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if opts.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, opts.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mqttConn{
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		messages: make(chan message, 16),
+		done:     make(chan struct{}),
+	}
+	if err := c.connect(opts); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+	if opts.keepAlive > 0 {
+		go c.pingLoop(opts.keepAlive)
+	}
+	return c, nil
+}
+
+// connect sends CONNECT and waits for the CONNACK
+func (c *mqttConn) connect(opts connectOptions) error {
+	var flags byte = 0x02 // clean session
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, 0)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.keepAlive/time.Second))
+
+	body = appendString(body, opts.clientID)
+	if opts.will != nil {
+		flags |= 0x04 | opts.will.qos<<3
+		body = appendString(body, opts.will.topic)
+		body = appendBytes(body, opts.will.payload)
+	}
+	if opts.username != "" {
+		flags |= 0x80
+		body = appendString(body, opts.username)
+	}
+	if opts.password != "" {
+		flags |= 0x40
+		body = appendString(body, opts.password)
+	}
+	body[7] = flags
+
+	if opts.timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(opts.timeout)); err != nil {
+			return err
+		}
+		defer func() { _ = c.conn.SetDeadline(time.Time{}) }()
+	}
+	if err := c.send(packetConnect<<4, body); err != nil {
+		return err
+	}
+
+	header, payload, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if header>>4 != packetConnack || len(payload) != 2 {
+		return fmt.Errorf("%w: unexpected packet type %d", ErrConnectionRefused, header>>4)
+	}
+	if payload[1] != 0 {
+		return fmt.Errorf("%w: return code %d", ErrConnectionRefused, payload[1])
+	}
+	return nil
+}
+
+// publish sends a QoS 0 PUBLISH
+func (c *mqttConn) publish(topic string, payload []byte, retain bool) error {
+	var header byte = packetPublish << 4
+	if retain {
+		header |= 0x01
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = appendString(c.buf[:0], topic)
+	c.buf = append(c.buf, payload...)
+	return c.writePacket(header, c.buf)
+}
+
+// subscribe requests a QoS 0 subscription. The SUBACK is not awaited.
+func (c *mqttConn) subscribe(filter string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	body := binary.BigEndian.AppendUint16(nil, c.nextID)
+	body = appendString(body, filter)
+	body = append(body, 0)
+	return c.writePacket(packetSubscribe<<4|0x02, body)
+}
+
+// disconnect sends DISCONNECT, so the broker discards the will, and closes
+func (c *mqttConn) disconnect() error {
+	err := c.send(packetDisconnect<<4, nil)
+	return errors.Join(err, c.close())
+}
+
+// close closes the connection without DISCONNECT, so the broker sends the will
+func (c *mqttConn) close() error {
+	err := c.conn.Close()
+	<-c.done
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	return err
+}
+
+// send writes a packet under the write lock
+func (c *mqttConn) send(header byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writePacket(header, body)
+}
+
+// writePacket writes the fixed header and body. The caller holds c.mu.
+func (c *mqttConn) writePacket(header byte, body []byte) error {
+	packet := make([]byte, 0, 5+len(body))
+	packet = append(packet, header)
+	for n := len(body); ; {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// readPacket reads the next control packet
+func (c *mqttConn) readPacket() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("%w: malformed remaining length", ErrConnectionRefused)
+		}
+		multiplier *= 128
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header, payload, nil
+}
+
+// readLoop delivers received messages until the connection fails
+func (c *mqttConn) readLoop() {
+	defer close(c.done)
+	defer close(c.messages)
+
+	for {
+		header, payload, err := c.readPacket()
+		if err != nil {
+			c.err = err
+			return
+		}
+		if header>>4 != packetPublish || len(payload) < 2 {
+			// CONNACK, SUBACK, PINGRESP and acknowledgements need no action
+			continue
+		}
+
+		qos := header >> 1 & 0x03
+		n := int(binary.BigEndian.Uint16(payload))
+		if 2+n > len(payload) {
+			continue
+		}
+		topic, rest := string(payload[2:2+n]), payload[2+n:]
+		if qos > 0 {
+			if len(rest) < 2 {
+				continue
+			}
+			if err := c.send(packetPuback<<4, rest[:2]); err != nil {
+				c.err = err
+				return
+			}
+			rest = rest[2:]
+		}
+
+		select {
+		case c.messages <- message{topic: topic, payload: rest}:
+		default:
+			// Slow consumer: drop rather than stall keepalive handling
+		}
+	}
+}
+
+// pingLoop sends PINGREQ at the keepalive interval until the connection closes
+func (c *mqttConn) pingLoop(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.send(packetPingreq<<4, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// appendString appends a length prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// appendBytes appends length prefixed binary data
+func appendBytes(b, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
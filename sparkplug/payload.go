@@ -0,0 +1,258 @@
+package sparkplug
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Sparkplug B metric data types
+const (
+	TypeUInt16  = 6
+	TypeUInt32  = 7
+	TypeUInt64  = 8
+	TypeFloat   = 9
+	TypeDouble  = 10
+	TypeBoolean = 11
+	TypeString  = 12
+)
+
+// Metric is a Sparkplug B metric. Name is only sent in birth certificates,
+// data messages refer to metrics by Alias.
+type Metric struct {
+	Name     string
+	Alias    uint64
+	DataType uint32
+	// Value holds a uint32, uint64, float32, float64, bool or string
+	Value interface{}
+	// Properties are string properties such as the engineering unit
+	Properties map[string]string
+}
+
+// Payload is a Sparkplug B payload
+type Payload struct {
+	// Timestamp is in milliseconds since the Unix epoch
+	Timestamp uint64
+	Metrics   []Metric
+	Seq       uint64
+	// noSeq omits the sequence number, as required for NDEATH
+	noSeq bool
+}
+
+// Payload and Metric field numbers from sparkplug_b.proto
+const (
+	fieldPayloadTimestamp = 1
+	fieldPayloadMetrics   = 2
+	fieldPayloadSeq       = 3
+
+	fieldMetricName       = 1
+	fieldMetricAlias      = 2
+	fieldMetricTimestamp  = 3
+	fieldMetricDataType   = 4
+	fieldMetricProperties = 9
+	fieldMetricInt        = 10
+	fieldMetricLong       = 11
+	fieldMetricFloat      = 12
+	fieldMetricDouble     = 13
+	fieldMetricBoolean    = 14
+	fieldMetricString     = 15
+
+	fieldPropertyKeys      = 1
+	fieldPropertyValues    = 2
+	fieldPropertyValueType = 1
+	fieldPropertyString    = 8
+)
+
+// AppendTo appends the protobuf encoding of the payload to b
+func (p *Payload) AppendTo(b []byte) []byte {
+	b = protowire.AppendTag(b, fieldPayloadTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, p.Timestamp)
+
+	var metric []byte
+	for i := range p.Metrics {
+		metric = p.Metrics[i].appendTo(metric[:0], p.Timestamp)
+		b = protowire.AppendTag(b, fieldPayloadMetrics, protowire.BytesType)
+		b = protowire.AppendBytes(b, metric)
+	}
+
+	if p.noSeq {
+		return b
+	}
+	b = protowire.AppendTag(b, fieldPayloadSeq, protowire.VarintType)
+	return protowire.AppendVarint(b, p.Seq)
+}
+
+// appendTo encodes a metric
+func (m *Metric) appendTo(b []byte, timestamp uint64) []byte {
+	if m.Name != "" {
+		b = protowire.AppendTag(b, fieldMetricName, protowire.BytesType)
+		b = protowire.AppendString(b, m.Name)
+	}
+	b = protowire.AppendTag(b, fieldMetricAlias, protowire.VarintType)
+	b = protowire.AppendVarint(b, m.Alias)
+	b = protowire.AppendTag(b, fieldMetricTimestamp, protowire.VarintType)
+	b = protowire.AppendVarint(b, timestamp)
+	b = protowire.AppendTag(b, fieldMetricDataType, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(m.DataType))
+
+	if len(m.Properties) > 0 {
+		var props []byte
+		for _, key := range sortedKeys(m.Properties) {
+			props = protowire.AppendTag(props, fieldPropertyKeys, protowire.BytesType)
+			props = protowire.AppendString(props, key)
+		}
+		for _, key := range sortedKeys(m.Properties) {
+			var value []byte
+			value = protowire.AppendTag(value, fieldPropertyValueType, protowire.VarintType)
+			value = protowire.AppendVarint(value, TypeString)
+			value = protowire.AppendTag(value, fieldPropertyString, protowire.BytesType)
+			value = protowire.AppendString(value, m.Properties[key])
+			props = protowire.AppendTag(props, fieldPropertyValues, protowire.BytesType)
+			props = protowire.AppendBytes(props, value)
+		}
+		b = protowire.AppendTag(b, fieldMetricProperties, protowire.BytesType)
+		b = protowire.AppendBytes(b, props)
+	}
+
+	switch v := m.Value.(type) {
+	case uint32:
+		b = protowire.AppendTag(b, fieldMetricInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(v))
+	case uint64:
+		b = protowire.AppendTag(b, fieldMetricLong, protowire.VarintType)
+		b = protowire.AppendVarint(b, v)
+	case float32:
+		b = protowire.AppendTag(b, fieldMetricFloat, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(v))
+	case float64:
+		b = protowire.AppendTag(b, fieldMetricDouble, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(v))
+	case bool:
+		b = protowire.AppendTag(b, fieldMetricBoolean, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case string:
+		b = protowire.AppendTag(b, fieldMetricString, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	}
+	return b
+}
+
+// Unmarshal decodes a payload. Fields outside of Payload and Metric are skipped.
+func (p *Payload) Unmarshal(b []byte) error {
+	*p = Payload{}
+	return walk(b, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case fieldPayloadTimestamp:
+			p.Timestamp = v
+		case fieldPayloadSeq:
+			p.Seq = v
+		case fieldPayloadMetrics:
+			var m Metric
+			if err := m.unmarshal(data); err != nil {
+				return err
+			}
+			p.Metrics = append(p.Metrics, m)
+		}
+		return nil
+	})
+}
+
+// unmarshal decodes a metric
+func (m *Metric) unmarshal(b []byte) error {
+	var keys, values []string
+	err := walk(b, func(num protowire.Number, v uint64, data []byte) error {
+		switch num {
+		case fieldMetricName:
+			m.Name = string(data)
+		case fieldMetricAlias:
+			m.Alias = v
+		case fieldMetricDataType:
+			m.DataType = uint32(v)
+		case fieldMetricInt:
+			m.Value = uint32(v)
+		case fieldMetricLong:
+			m.Value = v
+		case fieldMetricFloat:
+			m.Value = math.Float32frombits(uint32(v))
+		case fieldMetricDouble:
+			m.Value = math.Float64frombits(v)
+		case fieldMetricBoolean:
+			m.Value = protowire.DecodeBool(v)
+		case fieldMetricString:
+			m.Value = string(data)
+		case fieldMetricProperties:
+			return walk(data, func(num protowire.Number, _ uint64, data []byte) error {
+				switch num {
+				case fieldPropertyKeys:
+					keys = append(keys, string(data))
+				case fieldPropertyValues:
+					var s string
+					err := walk(data, func(num protowire.Number, _ uint64, data []byte) error {
+						if num == fieldPropertyString {
+							s = string(data)
+						}
+						return nil
+					})
+					values = append(values, s)
+					return err
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		m.Properties = make(map[string]string, len(keys))
+		for i, key := range keys {
+			if i < len(values) {
+				m.Properties[key] = values[i]
+			}
+		}
+	}
+	return nil
+}
+
+// walk calls fn for every field of a message with the varint or fixed value
+// in v, or the contents of a length delimited field in data. Groups are skipped.
+func walk(b []byte, fn func(num protowire.Number, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var (
+			v    uint64
+			data []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			v = uint64(v32)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+// Package sparkplug publishes synchrophasor measurements to an MQTT broker
+// following the Sparkplug B topic and payload conventions. The publisher is an
+// edge node, every PMU station of the configuration is one of its devices.
+package sparkplug
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// namespace is the Sparkplug B topic namespace
+const namespace = "spBv1.0"
+
+// rebirthMetric is the node control metric a host application writes to
+// request new birth certificates
+const rebirthMetric = "Node Control/Rebirth"
+
+// ErrInvalidPayload is returned for payloads that are not valid protobuf
+var ErrInvalidPayload = errors.New("invalid sparkplug payload")
+
+// Options configures a publisher
+type Options struct {
+	// Broker is the host:port of the MQTT broker
+	Broker string
+	// GroupID and EdgeNodeID form the topics spBv1.0/<group>/<type>/<node>
+	GroupID    string
+	EdgeNodeID string
+	// ClientID defaults to the edge node ID
+	ClientID string
+	Username string
+	Password string
+	// TLS enables MQTT over TLS when set
+	TLS *tls.Config
+	// KeepAlive defaults to 30 seconds
+	KeepAlive time.Duration
+	// Timeout bounds connecting and the CONNACK, defaults to 10 seconds
+	Timeout time.Duration
+}
+
+// device is a station published as a Sparkplug device
+type device struct {
+	id      string
+	pmu     *synchrophasor.PMUStation
+	metrics []Metric
+}
+
+// Publisher publishes birth certificates built from the configuration frame
+// and a DDATA message per station for every measurement set. It answers
+// rebirth requests sent by host applications as NCMD messages.
+// A Publisher is not safe for concurrent use.
+type Publisher struct {
+	opts    Options
+	conn    *mqttConn
+	devices []*device
+	bdSeq   uint64
+	seq     uint64
+	rebirth atomic.Bool
+	payload Payload
+	data    []Metric
+	buf     []byte
+}
+
+// New connects to the broker and publishes the NBIRTH and DBIRTH certificates
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Publisher, error) {
+	if opts.GroupID == "" || opts.EdgeNodeID == "" {
+		return nil, fmt.Errorf("%w: group and edge node IDs are required", synchrophasor.ErrInvalidParameter)
+	}
+	if strings.ContainsAny(opts.GroupID+opts.EdgeNodeID, "+/#") {
+		return nil, fmt.Errorf("%w: IDs must not contain +, / or #", synchrophasor.ErrInvalidParameter)
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = opts.EdgeNodeID
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	p := &Publisher{opts: opts}
+	alias := uint64(3) // 1 and 2 are the node metrics
+	for _, pmu := range cfg.PMUStationList {
+		d := &device{id: deviceID(pmu), pmu: pmu, metrics: stationMetrics(pmu)}
+		for i := range d.metrics {
+			d.metrics[i].Alias = alias
+			alias++
+		}
+		p.devices = append(p.devices, d)
+	}
+
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// connect opens the MQTT session with the NDEATH will and publishes the births
+func (p *Publisher) connect() error {
+	death := p.death()
+	conn, err := dialMQTT(p.opts.Broker, connectOptions{
+		clientID:  p.opts.ClientID,
+		username:  p.opts.Username,
+		password:  p.opts.Password,
+		keepAlive: p.opts.KeepAlive,
+		will:      &will{topic: p.topic("NDEATH", ""), payload: death.AppendTo(nil), qos: 1},
+		tls:       p.opts.TLS,
+		timeout:   p.opts.Timeout,
+	})
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+
+	go p.commands(conn)
+	if err := conn.subscribe(p.topic("NCMD", "")); err != nil {
+		_ = conn.close()
+		return err
+	}
+	if err := p.publishBirths(time.Now()); err != nil {
+		_ = conn.close()
+		return err
+	}
+	return nil
+}
+
+// commands watches NCMD messages for rebirth requests
+func (p *Publisher) commands(conn *mqttConn) {
+	for msg := range conn.messages {
+		var cmd Payload
+		if err := cmd.Unmarshal(msg.payload); err != nil {
+			continue
+		}
+		for _, m := range cmd.Metrics {
+			if rebirth, ok := m.Value.(bool); ok && rebirth && m.Name == rebirthMetric {
+				p.rebirth.Store(true)
+			}
+		}
+	}
+}
+
+// publishBirths publishes NBIRTH followed by a DBIRTH per station, restarting
+// the sequence number. Birth metrics carry names, aliases and current values.
+func (p *Publisher) publishBirths(t time.Time) error {
+	p.seq = 0
+	ts := uint64(t.UnixMilli())
+
+	p.payload = Payload{Timestamp: ts, Metrics: []Metric{
+		{Name: "bdSeq", Alias: 1, DataType: TypeUInt64, Value: p.bdSeq},
+		{Name: rebirthMetric, Alias: 2, DataType: TypeBoolean, Value: false},
+	}}
+	if err := p.publish("NBIRTH", ""); err != nil {
+		return err
+	}
+
+	for _, d := range p.devices {
+		d.update()
+		p.payload = Payload{Timestamp: ts, Metrics: d.metrics}
+		if err := p.publish("DBIRTH", d.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write publishes a DDATA message per station. Only aliases are sent, the
+// names were announced in the DBIRTH.
+func (p *Publisher) Write(m *synchrophasor.Measurements) error {
+	if len(m.Stations) != len(p.devices) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(p.devices))
+	}
+	for i, d := range p.devices {
+		st := &m.Stations[i]
+		if len(st.Phasors) != len(d.pmu.CHNAMPhasor) || len(st.Analog) != len(d.pmu.CHNAMAnalog) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := time.Unix(0, m.UnixNano())
+	if p.rebirth.Swap(false) {
+		if err := p.publishBirths(t); err != nil {
+			return err
+		}
+	}
+
+	for i, d := range p.devices {
+		st := &m.Stations[i]
+		metrics := p.data[:0]
+		metrics = append(metrics,
+			Metric{Alias: d.metrics[0].Alias, DataType: TypeFloat, Value: st.Frequency},
+			Metric{Alias: d.metrics[1].Alias, DataType: TypeFloat, Value: st.ROCOF},
+			Metric{Alias: d.metrics[2].Alias, DataType: TypeUInt32, Value: uint32(st.Stat)})
+		k := 3
+		for _, ph := range st.Phasors {
+			metrics = append(metrics,
+				Metric{Alias: d.metrics[k].Alias, DataType: TypeDouble, Value: cmplx.Abs(ph)},
+				Metric{Alias: d.metrics[k+1].Alias, DataType: TypeDouble, Value: cmplx.Phase(ph) * 180 / math.Pi})
+			k += 2
+		}
+		for _, v := range st.Analog {
+			metrics = append(metrics, Metric{Alias: d.metrics[k].Alias, DataType: TypeFloat, Value: v})
+			k++
+		}
+		for _, word := range st.Digital {
+			for _, bit := range word {
+				if k < len(d.metrics) {
+					metrics = append(metrics, Metric{Alias: d.metrics[k].Alias, DataType: TypeBoolean, Value: bit})
+				}
+				k++
+			}
+		}
+
+		p.data = metrics
+		p.payload = Payload{Timestamp: uint64(t.UnixMilli()), Metrics: metrics}
+		if err := p.publish("DDATA", d.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close publishes the NDEATH certificate and disconnects. The broker only
+// sends the will on unexpected disconnects, so the death is published here.
+func (p *Publisher) Close() error {
+	death := p.death()
+	p.buf = death.AppendTo(p.buf[:0])
+	err := p.conn.publish(p.topic("NDEATH", ""), p.buf, false)
+	return errors.Join(err, p.conn.disconnect())
+}
+
+// death returns the NDEATH payload carrying the session's bdSeq
+func (p *Publisher) death() Payload {
+	return Payload{
+		Timestamp: uint64(time.Now().UnixMilli()),
+		Metrics:   []Metric{{Name: "bdSeq", DataType: TypeUInt64, Value: p.bdSeq}},
+		noSeq:     true,
+	}
+}
+
+// publish sends the current payload with the next sequence number
+func (p *Publisher) publish(messageType, deviceID string) error {
+	p.payload.Seq = p.seq
+	p.seq = (p.seq + 1) % 256
+	p.buf = p.payload.AppendTo(p.buf[:0])
+	return p.conn.publish(p.topic(messageType, deviceID), p.buf, false)
+}
+
+// topic returns spBv1.0/<group>/<type>/<node>[/<device>]
+func (p *Publisher) topic(messageType, deviceID string) string {
+	topic := namespace + "/" + p.opts.GroupID + "/" + messageType + "/" + p.opts.EdgeNodeID
+	if deviceID != "" {
+		topic += "/" + deviceID
+	}
+	return topic
+}
+
+// update copies the station's current values into the birth metrics
+func (d *device) update() {
+	pmu := d.pmu
+	d.metrics[0].Value = pmu.Freq
+	d.metrics[1].Value = pmu.DFreq
+	d.metrics[2].Value = uint32(pmu.Stat)
+	// The value slices may be out of step with the names the metrics were
+	// built from, e.g. while the station is being changed
+	k := 3
+	for j := range pmu.CHNAMPhasor {
+		if j < len(pmu.PhasorValues) {
+			ph := pmu.PhasorValues[j]
+			d.metrics[k].Value = cmplx.Abs(ph)
+			d.metrics[k+1].Value = cmplx.Phase(ph) * 180 / math.Pi
+		}
+		k += 2
+	}
+	for j := range pmu.CHNAMAnalog {
+		if j < len(pmu.AnalogValues) {
+			d.metrics[k].Value = pmu.AnalogValues[j]
+		}
+		k++
+	}
+	for _, word := range pmu.DigitalValues {
+		for _, bit := range word {
+			if k < len(d.metrics) {
+				d.metrics[k].Value = bit
+			}
+			k++
+		}
+	}
+}
+
+// stationMetrics returns the metric definitions of a station in the order of
+// a StationMeasurement: frequency, ROCOF, STAT, phasors, analogs and digitals
+func stationMetrics(pmu *synchrophasor.PMUStation) []Metric {
+	metrics := []Metric{
+		{Name: "Frequency", DataType: TypeFloat, Value: float32(0), Properties: map[string]string{"engUnit": "Hz"}},
+		{Name: "ROCOF", DataType: TypeFloat, Value: float32(0), Properties: map[string]string{"engUnit": "Hz/s"}},
+		{Name: "STAT", DataType: TypeUInt32, Value: uint32(0)},
+	}
+	for i, name := range pmu.CHNAMPhasor {
+		unit := "V"
+		if i < len(pmu.Phunit) && pmu.Phunit[i]>>24 == synchrophasor.PhunitCurrent {
+			unit = "A"
+		}
+		name = strings.TrimSpace(name)
+		metrics = append(metrics,
+			Metric{Name: name + "/Magnitude", DataType: TypeDouble, Value: float64(0),
+				Properties: map[string]string{"engUnit": unit}},
+			Metric{Name: name + "/Angle", DataType: TypeDouble, Value: float64(0),
+				Properties: map[string]string{"engUnit": "deg"}})
+	}
+	for _, name := range pmu.CHNAMAnalog {
+		metrics = append(metrics, Metric{Name: "Analog/" + strings.TrimSpace(name), DataType: TypeFloat, Value: float32(0)})
+	}
+	for word := 0; word < int(pmu.Dgnmr); word++ {
+		for bit := 0; bit < 16; bit++ {
+			name := ""
+			if i := word*16 + bit; i < len(pmu.CHNAMDigital) {
+				name = strings.TrimSpace(pmu.CHNAMDigital[i])
+			}
+			if name == "" {
+				name = fmt.Sprintf("%d_%d", word, bit)
+			}
+			metrics = append(metrics, Metric{Name: "Digital/" + name, DataType: TypeBoolean, Value: false})
+		}
+	}
+	return metrics
+}
+
+// deviceID makes a station name usable as a Sparkplug device ID
+func deviceID(pmu *synchrophasor.PMUStation) string {
+	name := strings.TrimSpace(pmu.STN)
+	if name == "" {
+		return fmt.Sprintf("PMU%d", pmu.IDCode)
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '+', '/', '#', ' ':
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
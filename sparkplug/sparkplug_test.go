@@ -0,0 +1,179 @@
+package sparkplug
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+// broker is a fake MQTT broker accepting a single client
+type broker struct {
+	listener net.Listener
+	conn     net.Conn
+	connect  chan []byte
+	messages chan message
+}
+
+func newBroker(t *testing.T) *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &broker{listener: l, connect: make(chan []byte, 1), messages: make(chan message, 64)}
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b.conn = conn
+		defer close(b.messages)
+
+		r := bufio.NewReader(conn)
+		for {
+			header, body, err := readTestPacket(r)
+			if err != nil {
+				return
+			}
+			switch header >> 4 {
+			case packetConnect:
+				b.connect <- body
+				_, _ = conn.Write([]byte{packetConnack << 4, 2, 0, 0})
+			case packetPublish:
+				n := int(binary.BigEndian.Uint16(body))
+				b.messages <- message{topic: string(body[2 : 2+n]), payload: body[2+n:]}
+			case packetSubscribe:
+				b.messages <- message{topic: "SUBSCRIBE " + string(body[4:len(body)-1])}
+			case packetDisconnect:
+				b.messages <- message{topic: "DISCONNECT"}
+			}
+		}
+	}()
+	return b
+}
+
+func readTestPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7F) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+func (b *broker) next(t *testing.T) (string, Payload) {
+	select {
+	case msg := <-b.messages:
+		var p Payload
+		require.NoError(t, p.Unmarshal(msg.payload))
+		return msg.topic, p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for message")
+		return "", Payload{}
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	station := synchrophasor.NewPMUStation("Station A", 7734, true, true, true, true)
+	station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	station.AddPhasor("IA", 1, synchrophasor.PhunitCurrent)
+	station.AddAnalog("P", 1, 0)
+	cfg.AddPMUStation(station)
+
+	b := newBroker(t)
+	pub, err := New(cfg, Options{Broker: b.listener.Addr().String(), GroupID: "grid", EdgeNodeID: "pdc1"})
+	require.NoError(t, err)
+
+	connect := <-b.connect
+	require.Contains(t, string(connect), "spBv1.0/grid/NDEATH/pdc1")
+
+	topic, _ := b.next(t)
+	require.Equal(t, "SUBSCRIBE spBv1.0/grid/NCMD/pdc1", topic)
+
+	topic, nbirth := b.next(t)
+	require.Equal(t, "spBv1.0/grid/NBIRTH/pdc1", topic)
+	require.Equal(t, uint64(0), nbirth.Seq)
+	require.Equal(t, "bdSeq", nbirth.Metrics[0].Name)
+
+	topic, dbirth := b.next(t)
+	require.Equal(t, "spBv1.0/grid/DBIRTH/pdc1/Station_A", topic)
+	require.Equal(t, uint64(1), dbirth.Seq)
+	require.Len(t, dbirth.Metrics, 3+4+1)
+	require.Equal(t, "IA/Magnitude", dbirth.Metrics[5].Name)
+	require.Equal(t, "A", dbirth.Metrics[5].Properties["engUnit"])
+	require.Equal(t, uint32(TypeDouble), dbirth.Metrics[5].DataType)
+
+	station.PhasorValues[1] = complex(0, 10)
+	station.Freq = 50.01
+	df := synchrophasor.NewDataFrame(cfg)
+	df.SetTime(nil, nil)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	require.NoError(t, pub.Write(&m))
+
+	topic, ddata := b.next(t)
+	require.Equal(t, "spBv1.0/grid/DDATA/pdc1/Station_A", topic)
+	require.Equal(t, uint64(2), ddata.Seq)
+	require.Len(t, ddata.Metrics, len(dbirth.Metrics))
+	require.Empty(t, ddata.Metrics[0].Name)
+	require.Equal(t, dbirth.Metrics[5].Alias, ddata.Metrics[5].Alias)
+	require.InDelta(t, 10, ddata.Metrics[5].Value, 1e-9)
+	require.InDelta(t, 90, ddata.Metrics[6].Value, 1e-9)
+	require.InDelta(t, 50.01, ddata.Metrics[0].Value, 1e-4)
+
+	// A rebirth request is answered before the next data message
+	cmd := Payload{Metrics: []Metric{{Name: rebirthMetric, DataType: TypeBoolean, Value: true}}}
+	body := appendString(nil, "spBv1.0/grid/NCMD/pdc1")
+	body = append(body, cmd.AppendTo(nil)...)
+	_, err = b.conn.Write(append([]byte{packetPublish << 4, byte(len(body))}, body...))
+	require.NoError(t, err)
+	require.Eventually(t, pub.rebirth.Load, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, pub.Write(&m))
+	topic, nbirth = b.next(t)
+	require.Equal(t, "spBv1.0/grid/NBIRTH/pdc1", topic)
+	require.Equal(t, uint64(0), nbirth.Seq)
+	topic, _ = b.next(t)
+	require.Equal(t, "spBv1.0/grid/DBIRTH/pdc1/Station_A", topic)
+	topic, _ = b.next(t)
+	require.Equal(t, "spBv1.0/grid/DDATA/pdc1/Station_A", topic)
+
+	// Sets that do not match the configuration are rejected before publishing
+	bad := m.Clone()
+	bad.Stations[0].Phasors = append(bad.Stations[0].Phasors, 0)
+	require.ErrorIs(t, pub.Write(bad), synchrophasor.ErrInvalidParameter)
+	bad = m.Clone()
+	bad.Stations[0].Analog = nil
+	require.ErrorIs(t, pub.Write(bad), synchrophasor.ErrInvalidParameter)
+
+	// Births only use the station values that have a metric
+	station.PhasorValues = append(station.PhasorValues, 0)
+	station.AnalogValues = nil
+	require.NotPanics(t, pub.devices[0].update)
+
+	require.NoError(t, pub.Close())
+	topic, _ = b.next(t)
+	require.Equal(t, "spBv1.0/grid/NDEATH/pdc1", topic)
+	topic, _ = b.next(t)
+	require.Equal(t, "DISCONNECT", topic)
+}
@@ -0,0 +1,251 @@
+// Package state keeps the latest value of every channel of a stream for
+// request/response consumers, such as REST handlers or SCADA gateways, and
+// notifies watchers of single channels without them having to consume the
+// full-rate stream
+package state
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// Sample is the latest value of a channel
+type Sample struct {
+	Time  time.Time
+	Value float64
+	// Stat is the STAT word of the channel's station
+	Stat uint16
+}
+
+// channel kinds
+const (
+	kindStat = iota
+	kindFrequency
+	kindROCOF
+	kindMagnitude
+	kindAngle
+	kindAnalog
+	kindDigital
+)
+
+// channelRef locates a channel in a measurement set
+type channelRef struct {
+	station int
+	kind    int
+	index   int
+}
+
+// watcher receives the updates of a channel
+type watcher struct {
+	ch chan Sample
+}
+
+// Store holds the latest value of every channel. Sets are passed to Write,
+// typically from a PDC read loop, and read concurrently.
+type Store struct {
+	mu       sync.RWMutex
+	cfg      *synchrophasor.ConfigFrame
+	names    []string
+	refs     []channelRef
+	index    map[string]int
+	samples  []Sample
+	valid    []bool
+	watchers map[string][]*watcher
+}
+
+// New creates a store for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame) *Store {
+	s := &Store{watchers: make(map[string][]*watcher)}
+	s.setConfig(cfg)
+	return s
+}
+
+// SetConfig replaces the configuration and discards the values. Watchers of
+// channels missing from the new configuration receive no more updates until
+// the channel reappears.
+func (s *Store) SetConfig(cfg *synchrophasor.ConfigFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setConfig(cfg)
+}
+
+// setConfig builds the channel table of cfg, s.mu must be held. Channels are
+// named like the historian channels: for a station "Sub 1" these are
+// "Sub 1.stat", "Sub 1.freq", "Sub 1.rocof", the phasor magnitudes and angles
+// (degrees) "Sub 1.<phasor>.mag" and "Sub 1.<phasor>.ang", and the analog and
+// digital channels "Sub 1.<channel>".
+func (s *Store) setConfig(cfg *synchrophasor.ConfigFrame) {
+	var names []string
+	var refs []channelRef
+	add := func(name string, ref channelRef) {
+		names = append(names, name)
+		refs = append(refs, ref)
+	}
+	for i, pmu := range cfg.PMUStationList {
+		stn := strings.TrimSpace(pmu.STN) + "."
+		add(stn+"stat", channelRef{i, kindStat, 0})
+		add(stn+"freq", channelRef{i, kindFrequency, 0})
+		add(stn+"rocof", channelRef{i, kindROCOF, 0})
+		for j, name := range pmu.CHNAMPhasor {
+			name = stn + strings.TrimSpace(name)
+			add(name+".mag", channelRef{i, kindMagnitude, j})
+			add(name+".ang", channelRef{i, kindAngle, j})
+		}
+		for j, name := range pmu.CHNAMAnalog {
+			add(stn+strings.TrimSpace(name), channelRef{i, kindAnalog, j})
+		}
+		for j, name := range pmu.CHNAMDigital {
+			if name = strings.TrimSpace(name); name != "" {
+				add(stn+name, channelRef{i, kindDigital, j})
+			}
+		}
+	}
+
+	s.cfg, s.names, s.refs = cfg, names, refs
+	s.index = make(map[string]int, len(names))
+	for i, name := range names {
+		s.index[name] = i
+	}
+	s.samples = make([]Sample, len(names))
+	s.valid = make([]bool, len(names))
+}
+
+// Write stores the values of a measurement set and notifies the watchers of
+// its channels
+func (s *Store) Write(m *synchrophasor.Measurements) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(m.Stations) != len(s.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.cfg.PMUStationList))
+	}
+	for i, pmu := range s.cfg.PMUStationList {
+		if st := &m.Stations[i]; len(st.Phasors) != len(pmu.PhasorValues) || len(st.Analog) != len(pmu.AnalogValues) {
+			return fmt.Errorf("%w: station %d does not match the configuration", synchrophasor.ErrInvalidParameter, i)
+		}
+	}
+
+	t := time.Unix(0, m.UnixNano()).UTC()
+	for i, ref := range s.refs {
+		st := &m.Stations[ref.station]
+		s.samples[i] = Sample{Time: t, Value: value(st, ref), Stat: st.Stat}
+		s.valid[i] = true
+	}
+	for name, watchers := range s.watchers {
+		i, ok := s.index[name]
+		if !ok {
+			continue
+		}
+		for _, w := range watchers {
+			w.send(s.samples[i])
+		}
+	}
+	return nil
+}
+
+// Get returns the latest value of a channel, false if the channel is unknown
+// or has no value yet
+func (s *Store) Get(channel string) (Sample, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.index[channel]
+	if !ok || !s.valid[i] {
+		return Sample{}, false
+	}
+	return s.samples[i], true
+}
+
+// Channels returns the names of the channels, sorted
+func (s *Store) Channels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := append([]string(nil), s.names...)
+	sort.Strings(names)
+	return names
+}
+
+// Watch returns a channel receiving the values of a channel until ctx is done,
+// when it is closed. The latest value, if any, is sent right away. Watchers
+// that fall behind skip to the latest value, so they never slow down Write.
+func (s *Store) Watch(ctx context.Context, channel string) (<-chan Sample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.index[channel]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown channel %q", synchrophasor.ErrInvalidParameter, channel)
+	}
+
+	w := &watcher{ch: make(chan Sample, 1)}
+	if s.valid[i] {
+		w.ch <- s.samples[i]
+	}
+	s.watchers[channel] = append(s.watchers[channel], w)
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		watchers := s.watchers[channel]
+		for j, other := range watchers {
+			if other == w {
+				watchers = append(watchers[:j], watchers[j+1:]...)
+				break
+			}
+		}
+		if len(watchers) == 0 {
+			delete(s.watchers, channel)
+		} else {
+			s.watchers[channel] = watchers
+		}
+		close(w.ch)
+	}()
+	return w.ch, nil
+}
+
+// send passes a sample to the watcher, replacing an unread one. Only Write
+// sends, holding the store lock.
+func (w *watcher) send(sample Sample) {
+	select {
+	case w.ch <- sample:
+		return
+	default:
+	}
+	select {
+	case <-w.ch:
+	default:
+	}
+	w.ch <- sample
+}
+
+// value returns a channel value of a station
+func value(st *synchrophasor.StationMeasurement, ref channelRef) float64 {
+	switch ref.kind {
+	case kindStat:
+		return float64(st.Stat)
+	case kindFrequency:
+		return float64(st.Frequency)
+	case kindROCOF:
+		return float64(st.ROCOF)
+	case kindMagnitude:
+		return cmplx.Abs(st.Phasors[ref.index])
+	case kindAngle:
+		return cmplx.Phase(st.Phasors[ref.index]) * 180 / math.Pi
+	case kindAnalog:
+		return float64(st.Analog[ref.index])
+	default:
+		word, bit := ref.index/16, ref.index%16
+		if word < len(st.Digital) && bit < len(st.Digital[word]) && st.Digital[word][bit] {
+			return 1
+		}
+		return 0
+	}
+}
@@ -0,0 +1,81 @@
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 1, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddAnalog("P", 1, 0)
+		station.AddDigital([]string{"BRK1"}, 0, 0xFFFF)
+	})
+}
+
+// set returns the measurements of frame i at 10 frames per second, Sub 1 at
+// 50 + i/100 Hz
+func set(cfg *synchrophasor.ConfigFrame, i int) *synchrophasor.Measurements {
+	sub := cfg.PMUStationList[0]
+	sub.Freq = 50 + float32(i)/100
+	sub.PhasorValues[0] = complex(0, 230)
+	sub.AnalogValues[0] = float32(i)
+	sub.DigitalValues[0][0] = true
+	return testutil.Measurements(cfg, i)
+}
+
+func TestStore(t *testing.T) {
+	cfg := testConfig()
+	s := New(cfg)
+	require.Equal(t, []string{
+		"Sub 1.BRK1", "Sub 1.P", "Sub 1.VA.ang", "Sub 1.VA.mag", "Sub 1.freq", "Sub 1.rocof", "Sub 1.stat",
+	}, s.Channels())
+	_, ok := s.Get("Sub 1.freq")
+	require.False(t, ok)
+
+	require.NoError(t, s.Write(set(cfg, 1)))
+	v, ok := s.Get("Sub 1.freq")
+	require.True(t, ok)
+	require.InDelta(t, 50.01, v.Value, 1e-5)
+	require.Equal(t, time.Unix(1700000000, 100000000).UTC(), v.Time)
+	v, _ = s.Get("Sub 1.VA.ang")
+	require.InDelta(t, 90, v.Value, 1e-9)
+	v, _ = s.Get("Sub 1.BRK1")
+	require.Equal(t, 1.0, v.Value)
+	_, ok = s.Get("Sub 2.freq")
+	require.False(t, ok)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := s.Watch(ctx, "Sub 1.P")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, (<-ch).Value)
+
+	// A watcher falling behind receives the latest value only
+	for i := 2; i < 10; i++ {
+		require.NoError(t, s.Write(set(cfg, i)))
+	}
+	require.Equal(t, 9.0, (<-ch).Value)
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected value %v", v)
+	default:
+	}
+
+	cancel()
+	_, open := <-ch
+	require.False(t, open)
+	require.NoError(t, s.Write(set(cfg, 10)))
+
+	_, err = s.Watch(context.Background(), "Sub 2.P")
+	require.ErrorIs(t, err, synchrophasor.ErrInvalidParameter)
+	require.ErrorIs(t, s.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+
+	s.SetConfig(cfg)
+	_, ok = s.Get("Sub 1.P")
+	require.False(t, ok)
+}
@@ -0,0 +1,54 @@
+package testutil
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// FixtureSOC is the SOC of the first frame of the fixture streams
+const FixtureSOC = 1700000000
+
+// NewConfig returns a configuration at rate frames per second with a
+// TIME_BASE of 1000000 and n stations named "Sub 1", "Sub 2", ... with ID
+// codes from 10 in floating-point polar format. channels, if not nil, adds
+// the channels of each station.
+func NewConfig(rate int16, n int, channels func(station *synchrophasor.PMUStation)) *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.TimeBase = 1000000
+	cfg.DataRate = rate
+	for i := 0; i < n; i++ {
+		station := synchrophasor.NewPMUStation("Sub "+strconv.Itoa(i+1), uint16(10+i), true, true, true, true)
+		if channels != nil {
+			channels(station)
+		}
+		cfg.AddPMUStation(station)
+	}
+	return cfg
+}
+
+// FrameTime returns the time of frame i of a stream at rate frames per
+// second starting at FixtureSOC
+func FrameTime(rate int16, i int) time.Time {
+	return time.Unix(FixtureSOC+int64(i/int(rate)), int64(i%int(rate))*int64(time.Second)/int64(rate))
+}
+
+// SetFrame sets the time of df to the one of frame i at the data rate of its
+// configuration, starting at FixtureSOC
+func SetFrame(df *synchrophasor.DataFrame, i int) {
+	cfg := df.AssociatedConfig
+	rate := int(cfg.DataRate)
+	df.SOC = FixtureSOC + uint32(i/rate)
+	df.FracSec = uint32(i%rate) * cfg.TimeBase / uint32(rate)
+}
+
+// Measurements returns the measurements of frame i at the data rate of cfg,
+// starting at FixtureSOC, holding the values set in the stations of cfg
+func Measurements(cfg *synchrophasor.ConfigFrame, i int) *synchrophasor.Measurements {
+	df := synchrophasor.NewDataFrame(cfg)
+	SetFrame(df, i)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	return &m
+}
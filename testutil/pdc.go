@@ -0,0 +1,117 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ServePMU serves pmu on an in-memory listener for the rest of the test,
+// stopping it on cleanup
+func ServePMU(tb testing.TB, pmu *synchrophasor.PMU) *Listener {
+	tb.Helper()
+	listener := NewListener()
+	go func() {
+		_ = pmu.Serve(listener)
+	}()
+	tb.Cleanup(pmu.Stop)
+	return listener
+}
+
+// MockPDC is a PDC client for testing PMU servers, reading with a timeout so
+// that a silent server fails the test instead of hanging it
+type MockPDC struct {
+	*synchrophasor.PDC
+	// Timeout bounds every read, defaults to DefaultTimeout
+	Timeout time.Duration
+}
+
+// NewMockPDC creates a mock PDC using conn, e.g. from Listener.Dial
+func NewMockPDC(conn net.Conn, idCode uint16) *MockPDC {
+	pdc := synchrophasor.NewPDC(idCode)
+	pdc.Attach(conn)
+	return &MockPDC{PDC: pdc, Timeout: DefaultTimeout}
+}
+
+// DialPDC connects a mock PDC to an in-memory listener
+func DialPDC(listener *Listener, idCode uint16) (*MockPDC, error) {
+	conn, err := listener.Dial()
+	if err != nil {
+		return nil, err
+	}
+	return NewMockPDC(conn, idCode), nil
+}
+
+// Send writes a raw frame to the server, e.g. a malformed command
+func (m *MockPDC) Send(frame []byte) error {
+	_, err := m.Socket.Write(frame)
+	return err
+}
+
+// Handshake requests the CFG-2 configuration and turns transmission on
+func (m *MockPDC) Handshake() (*synchrophasor.ConfigFrame, error) {
+	cfg, err := m.Config(2)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, m.Start()
+}
+
+// Config requests a configuration frame
+func (m *MockPDC) Config(version int) (*synchrophasor.ConfigFrame, error) {
+	if err := m.arm(); err != nil {
+		return nil, err
+	}
+	cfg, err := m.GetConfig(version)
+	return cfg, m.timeout(err)
+}
+
+// Next reads the next frame
+func (m *MockPDC) Next() (interface{}, error) {
+	if err := m.arm(); err != nil {
+		return nil, err
+	}
+	frame, err := m.ReadFrame()
+	return frame, m.timeout(err)
+}
+
+// NextData reads frames until a data frame, whose values are held by the
+// configuration until the next read
+func (m *MockPDC) NextData() (*synchrophasor.DataFrame, error) {
+	for {
+		frame, err := m.Next()
+		if err != nil {
+			return nil, err
+		}
+		if df, ok := frame.(*synchrophasor.DataFrame); ok {
+			return df, nil
+		}
+	}
+}
+
+// Close disconnects from the server
+func (m *MockPDC) Close() {
+	m.Disconnect()
+}
+
+// arm sets the read deadline
+func (m *MockPDC) arm() error {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return m.Socket.SetReadDeadline(time.Now().Add(timeout))
+}
+
+// timeout reports an expired deadline as ErrTimeout
+func (m *MockPDC) timeout(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w after %v", ErrTimeout, m.Timeout)
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+// Package testutil provides an in-process mock PMU and mock PDC, connected
+// through in-memory connections, for integration tests of applications built
+// on this library that need neither real sockets nor sleeps, and fixtures of
+// configurations and measurement streams
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pipeCount numbers the pipes for their addresses
+var pipeCount atomic.Uint64
+
+// pipeAddr is the address of one end of a pipe
+type pipeAddr string
+
+// Network returns "pipe"
+func (a pipeAddr) Network() string { return "pipe" }
+
+// String returns the address
+func (a pipeAddr) String() string { return string(a) }
+
+// pipeBuffer holds the writes to one direction of a pipe
+type pipeBuffer struct {
+	mu     sync.Mutex
+	chunks [][]byte
+	closed bool
+	// ready is closed and replaced when data arrives or the buffer is closed
+	ready chan struct{}
+}
+
+// newPipeBuffer creates an empty buffer
+func newPipeBuffer() *pipeBuffer {
+	return &pipeBuffer{ready: make(chan struct{})}
+}
+
+// wake notifies waiting readers, the caller holds mu
+func (b *pipeBuffer) wake() {
+	close(b.ready)
+	b.ready = make(chan struct{})
+}
+
+// write appends a copy of p
+func (b *pipeBuffer) write(p []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return io.ErrClosedPipe
+	}
+	b.chunks = append(b.chunks, append([]byte(nil), p...))
+	b.wake()
+	return nil
+}
+
+// read copies from the oldest write into p, returning the channel to wait on
+// if there is nothing to read yet
+func (b *pipeBuffer) read(p []byte) (int, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.chunks) == 0 {
+		if b.closed {
+			return 0, nil, io.EOF
+		}
+		return 0, b.ready, nil
+	}
+	n := copy(p, b.chunks[0])
+	if b.chunks[0] = b.chunks[0][n:]; len(b.chunks[0]) == 0 {
+		b.chunks = b.chunks[1:]
+	}
+	return n, nil, nil
+}
+
+// close makes further writes fail and reads return io.EOF once drained
+func (b *pipeBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.wake()
+	}
+}
+
+// deadline is a deadline whose channel is closed once it passes
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// newDeadline creates an unset deadline
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+// set sets the deadline, the zero time clears it
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// Wait for the timer to close cancel
+		<-d.cancel
+	}
+	d.timer = nil
+
+	expired := isClosed(d.cancel)
+	if t.IsZero() {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+	if !expired {
+		close(d.cancel)
+	}
+}
+
+// wait returns the channel closed when the deadline passes
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+// isClosed reports whether c is closed
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// pipeConn is one end of a pipe
+type pipeConn struct {
+	local, remote pipeAddr
+	in, out       *pipeBuffer
+	readDeadline  *deadline
+	writeDeadline *deadline
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+// Pipe returns the two ends of an in-memory connection. Unlike net.Pipe,
+// writes never block: they are buffered until read, and every read returns
+// bytes of a single write, as a PMU server expects one frame per read.
+// Deadlines are supported.
+func Pipe() (net.Conn, net.Conn) {
+	n := pipeCount.Add(1)
+	a, b := pipeAddr(fmt.Sprintf("pipe-%d-a", n)), pipeAddr(fmt.Sprintf("pipe-%d-b", n))
+	ab, ba := newPipeBuffer(), newPipeBuffer()
+	return newPipeConn(a, b, ba, ab), newPipeConn(b, a, ab, ba)
+}
+
+// newPipeConn creates the end at local reading in and writing out
+func newPipeConn(local, remote pipeAddr, in, out *pipeBuffer) *pipeConn {
+	return &pipeConn{
+		local:         local,
+		remote:        remote,
+		in:            in,
+		out:           out,
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+		closed:        make(chan struct{}),
+	}
+}
+
+// Read reads the bytes of the oldest unread write
+func (c *pipeConn) Read(p []byte) (int, error) {
+	for {
+		if isClosed(c.closed) {
+			return 0, net.ErrClosed
+		}
+		if isClosed(c.readDeadline.wait()) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		n, ready, err := c.in.read(p)
+		if ready == nil {
+			return n, err
+		}
+		select {
+		case <-ready:
+		case <-c.closed:
+		case <-c.readDeadline.wait():
+		}
+	}
+}
+
+// Write buffers p for the other end
+func (c *pipeConn) Write(p []byte) (int, error) {
+	if isClosed(c.closed) {
+		return 0, net.ErrClosed
+	}
+	if isClosed(c.writeDeadline.wait()) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if err := c.out.write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes both directions, the other end reads the buffered bytes
+// followed by io.EOF
+func (c *pipeConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.out.close()
+		c.in.close()
+	})
+	return nil
+}
+
+// LocalAddr returns the address of this end
+func (c *pipeConn) LocalAddr() net.Addr { return c.local }
+
+// RemoteAddr returns the address of the other end
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+// SetDeadline sets the read and write deadlines
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline sets the read deadline
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// Listener is an in-memory net.Listener, e.g. for PMU.Serve, whose
+// connections are made by Dial
+type Listener struct {
+	addr  pipeAddr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewListener creates an in-memory listener
+func NewListener() *Listener {
+	return &Listener{
+		addr:  pipeAddr(fmt.Sprintf("listener-%d", pipeCount.Add(1))),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// Accept waits for the next connection made by Dial
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener, unblocking Accept and Dial
+func (l *Listener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr returns the listener address
+func (l *Listener) Addr() net.Addr { return l.addr }
+
+// Dial connects to the listener, waiting until the connection is accepted
+func (l *Listener) Dial() (net.Conn, error) {
+	client, server := Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
@@ -0,0 +1,266 @@
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+)
+
+// ErrTimeout is returned when an expected frame or command does not arrive in time
+var ErrTimeout = errors.New("testutil: timed out")
+
+// DefaultTimeout bounds the waits of the mocks unless set otherwise
+const DefaultTimeout = 2 * time.Second
+
+// mockConn is a connection served by a MockPMU
+type mockConn struct {
+	conn net.Conn
+	// sending is set between the start and stop commands
+	sending bool
+	// next is the index of the next scripted data frame to send
+	next int
+}
+
+// MockPMU is a PMU answering commands with scripted responses and sending a
+// scripted sequence of data frames. Data frames are sent as soon as they are
+// scripted and transmission is on, so a test never waits for a frame rate.
+type MockPMU struct {
+	// Config is answered to the CFG-1 and CFG-2 commands and used by ScriptData
+	Config *synchrophasor.ConfigFrame
+	// Header is answered to the header command if set
+	Header *synchrophasor.HeaderFrame
+	// Time stamps the first frame of ScriptData
+	Time time.Time
+
+	mu        sync.Mutex
+	responses map[uint16][][]byte
+	script    [][]byte
+	conns     []*mockConn
+	received  []uint16
+	commands  chan *synchrophasor.CommandFrame
+}
+
+// NewMockPMU creates a mock PMU serving cfg
+func NewMockPMU(cfg *synchrophasor.ConfigFrame) *MockPMU {
+	return &MockPMU{
+		Config:    cfg,
+		Time:      time.Unix(1700000000, 0).UTC(),
+		responses: make(map[uint16][][]byte),
+		commands:  make(chan *synchrophasor.CommandFrame, 1024),
+	}
+}
+
+// Respond replaces the answer to a command with frames, e.g. a corrupted
+// configuration frame. Without frames the command is left unanswered.
+func (m *MockPMU) Respond(cmd uint16, frames ...[]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[cmd] = frames
+}
+
+// Script appends raw data frames to the stream. Every connection receives
+// them in order while its transmission is on.
+func (m *MockPMU) Script(frames ...[]byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.script = append(m.script, frames...)
+	for _, c := range m.conns {
+		m.flush(c)
+	}
+}
+
+// ScriptData appends n data frames of Config to the stream, stamped at the
+// data rate from Time. fill sets the station values of frame i.
+func (m *MockPMU) ScriptData(n int, fill func(i int, cfg *synchrophasor.ConfigFrame)) error {
+	cfg := m.Config
+	period := time.Second
+	if cfg.DataRate > 0 {
+		period /= time.Duration(cfg.DataRate)
+	} else if cfg.DataRate < 0 {
+		period *= time.Duration(-cfg.DataRate)
+	}
+	base := uint64(cfg.TimeBase & 0xFFFFFF)
+
+	frames := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if fill != nil {
+			fill(i, cfg)
+		}
+		t := m.Time.Add(time.Duration(i) * period)
+		soc := uint32(t.Unix())
+		fracSec := uint32(uint64(t.Nanosecond()) * base / 1e9)
+
+		df := synchrophasor.NewDataFrame(cfg)
+		df.IDCode = cfg.IDCode
+		df.SetTime(&soc, &fracSec)
+		frame, err := df.Pack()
+		if err != nil {
+			return fmt.Errorf("data frame %d: %w", i, err)
+		}
+		frames = append(frames, frame)
+	}
+	m.Script(frames...)
+	return nil
+}
+
+// Send writes a frame to every connection immediately, regardless of their
+// transmission state, e.g. an unsolicited configuration change
+func (m *MockPMU) Send(frame []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.conns {
+		if _, err := c.conn.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dial returns a new connection to the mock, e.g. for PDC.Attach
+func (m *MockPMU) Dial() net.Conn {
+	client, server := Pipe()
+	m.Serve(server)
+	return client
+}
+
+// Serve answers the commands received on conn in the background until it is
+// closed
+func (m *MockPMU) Serve(conn net.Conn) {
+	c := &mockConn{conn: conn}
+	m.mu.Lock()
+	m.conns = append(m.conns, c)
+	m.mu.Unlock()
+
+	go m.handle(c)
+}
+
+// Close closes all connections
+func (m *MockPMU) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.conns {
+		_ = c.conn.Close()
+	}
+	m.conns = nil
+}
+
+// Commands returns the codes of all commands received so far
+func (m *MockPMU) Commands() []uint16 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]uint16(nil), m.received...)
+}
+
+// WaitCommand returns the next received command, or ErrTimeout if none
+// arrives within timeout
+func (m *MockPMU) WaitCommand(timeout time.Duration) (*synchrophasor.CommandFrame, error) {
+	select {
+	case cmd := <-m.commands:
+		return cmd, nil
+	case <-time.After(timeout):
+		return nil, ErrTimeout
+	}
+}
+
+// handle reads the commands of a connection
+func (m *MockPMU) handle(c *mockConn) {
+	defer m.remove(c)
+
+	buffer := make([]byte, 65536)
+	pending := 0
+	for {
+		n, err := c.conn.Read(buffer[pending:])
+		if err != nil {
+			return
+		}
+		pending += n
+
+		// Commands may arrive split or several per read
+		for pending >= 4 {
+			size := int(buffer[2])<<8 | int(buffer[3])
+			if size < 4 {
+				return
+			}
+			if pending < size {
+				break
+			}
+			frame, err := synchrophasor.UnpackFrame(buffer[:size], nil)
+			if cmd, ok := frame.(*synchrophasor.CommandFrame); ok && err == nil {
+				m.command(c, cmd)
+			}
+			pending = copy(buffer, buffer[size:pending])
+		}
+	}
+}
+
+// remove forgets a closed connection
+func (m *MockPMU) remove(c *mockConn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = c.conn.Close()
+	for i, other := range m.conns {
+		if other == c {
+			m.conns = append(m.conns[:i], m.conns[i+1:]...)
+			break
+		}
+	}
+}
+
+// command records and answers a command
+func (m *MockPMU) command(c *mockConn, cmd *synchrophasor.CommandFrame) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.received = append(m.received, cmd.CMD)
+	select {
+	case m.commands <- cmd:
+	default:
+	}
+
+	if frames, ok := m.responses[cmd.CMD]; ok {
+		for _, frame := range frames {
+			if _, err := c.conn.Write(frame); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	var response []byte
+	switch cmd.CMD {
+	case synchrophasor.CmdStart:
+		c.sending = true
+		m.flush(c)
+	case synchrophasor.CmdStop:
+		c.sending = false
+	case synchrophasor.CmdCfg1:
+		cfg1 := synchrophasor.NewConfig1Frame()
+		cfg1.ConfigFrame = *m.Config
+		cfg1.Sync = (synchrophasor.SyncAA << 8) | synchrophasor.SyncCfg1
+		response, _ = cfg1.Pack()
+	case synchrophasor.CmdCfg2:
+		response, _ = m.Config.Pack()
+	case synchrophasor.CmdHeader:
+		if m.Header != nil {
+			response, _ = m.Header.Pack()
+		}
+	}
+	if response != nil {
+		_, _ = c.conn.Write(response)
+	}
+}
+
+// flush sends the scripted frames a connection has not received yet, the
+// caller holds mu
+func (m *MockPMU) flush(c *mockConn) {
+	for c.sending && c.next < len(m.script) {
+		if _, err := c.conn.Write(m.script[c.next]); err != nil {
+			return
+		}
+		c.next++
+	}
+}
@@ -0,0 +1,235 @@
+package testutil
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	cfg := synchrophasor.NewConfigFrame()
+	cfg.IDCode = 7734
+	cfg.TimeBase = 1000000
+	cfg.DataRate = 50
+	station := synchrophasor.NewPMUStation("Station A", 7734, false, true, true, true)
+	station.AddPhasor("VA", 915527, synchrophasor.PhunitVoltage)
+	station.AddAnalog("P", 1, synchrophasor.AnunitPow)
+	cfg.AddPMUStation(station)
+	return cfg
+}
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe()
+
+	// Writes do not block and reads keep their boundaries
+	_, err := a.Write([]byte("first"))
+	require.NoError(t, err)
+	_, err = a.Write([]byte("second"))
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n, err := b.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(buf[:n]))
+
+	require.NoError(t, b.SetReadDeadline(time.Now().Add(time.Hour)))
+	n, err = b.Read(buf[:3])
+	require.NoError(t, err)
+	require.Equal(t, "sec", string(buf[:n]))
+	n, err = b.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "ond", string(buf[:n]))
+
+	require.NoError(t, b.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = b.Read(buf)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	require.True(t, netErr.Timeout())
+
+	// The other end drains the buffer before io.EOF
+	_, err = b.Write([]byte("last"))
+	require.NoError(t, err)
+	require.NoError(t, b.Close())
+	n, err = a.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "last", string(buf[:n]))
+	_, err = a.Read(buf)
+	require.ErrorIs(t, err, io.EOF)
+	_, err = b.Read(buf)
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestListener(t *testing.T) {
+	listener := NewListener()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	client, err := listener.Dial()
+	require.NoError(t, err)
+	server := <-accepted
+	require.Equal(t, client.LocalAddr(), server.RemoteAddr())
+
+	require.NoError(t, listener.Close())
+	_, err = listener.Accept()
+	require.ErrorIs(t, err, net.ErrClosed)
+	_, err = listener.Dial()
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestMockPMU(t *testing.T) {
+	mock := NewMockPMU(testConfig())
+	mock.Header = synchrophasor.NewHeaderFrame(7734, "Mock PMU")
+	defer mock.Close()
+
+	pdc := synchrophasor.NewPDC(7734)
+	pdc.Attach(mock.Dial())
+	defer pdc.Disconnect()
+
+	header, err := pdc.GetHeader()
+	require.NoError(t, err)
+	require.Equal(t, "Mock PMU", header.Data)
+	cfg, err := pdc.GetConfig(1)
+	require.NoError(t, err)
+	require.Equal(t, int16(50), cfg.DataRate)
+	cfg, err = pdc.GetConfig(2)
+	require.NoError(t, err)
+	require.Len(t, cfg.PMUStationList, 1)
+
+	// Frames scripted before the start command are held back
+	require.NoError(t, mock.ScriptData(3, func(i int, cfg *synchrophasor.ConfigFrame) {
+		cfg.PMUStationList[0].Freq = 50 + float32(i)/100
+	}))
+	require.NoError(t, pdc.Start())
+	for i := 0; i < 3; i++ {
+		frame, err := pdc.ReadFrame()
+		require.NoError(t, err)
+		df, ok := frame.(*synchrophasor.DataFrame)
+		require.True(t, ok)
+		require.Equal(t, uint32(1700000000), df.SOC)
+		require.Equal(t, uint32(i*20000), df.FracSec)
+		require.InDelta(t, 50+float32(i)/100, cfg.PMUStationList[0].Freq, 1e-4)
+	}
+	require.NoError(t, pdc.Stop())
+
+	commands := []uint16{synchrophasor.CmdHeader, synchrophasor.CmdCfg1, synchrophasor.CmdCfg2,
+		synchrophasor.CmdStart, synchrophasor.CmdStop}
+	for _, want := range commands {
+		cmd, err := mock.WaitCommand(time.Second)
+		require.NoError(t, err)
+		require.Equal(t, want, cmd.CMD)
+		require.Equal(t, uint16(7734), cmd.IDCode)
+	}
+	require.Len(t, mock.Commands(), 5)
+
+	// Frames scripted while stopped wait for the next start command
+	require.NoError(t, mock.ScriptData(1, nil))
+	require.NoError(t, pdc.Socket.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err = pdc.ReadFrame()
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, pdc.Socket.SetReadDeadline(time.Time{}))
+}
+
+func TestMockPMUScriptedResponses(t *testing.T) {
+	mock := NewMockPMU(testConfig())
+	defer mock.Close()
+
+	pdc := synchrophasor.NewPDC(1)
+	pdc.Attach(mock.Dial())
+	defer pdc.Disconnect()
+
+	// A corrupted configuration frame
+	bad, err := mock.Config.Pack()
+	require.NoError(t, err)
+	bad[len(bad)-1] ^= 0xFF
+	mock.Respond(synchrophasor.CmdCfg2, bad)
+	_, err = pdc.GetConfig(2)
+	require.ErrorIs(t, err, synchrophasor.ErrCRCFailed)
+
+	// An unanswered header command
+	mock.Respond(synchrophasor.CmdHeader)
+	require.NoError(t, pdc.SendCommand(synchrophasor.CmdHeader))
+	_, err = mock.WaitCommand(time.Second)
+	require.NoError(t, err)
+	_, err = mock.WaitCommand(time.Second)
+	require.NoError(t, err)
+	require.NoError(t, pdc.Socket.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err = pdc.ReadFrame()
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, pdc.Socket.SetReadDeadline(time.Time{}))
+
+	// An unsolicited frame
+	header, err := synchrophasor.NewHeaderFrame(1, "Pushed").Pack()
+	require.NoError(t, err)
+	require.NoError(t, mock.Send(header))
+	frame, err := pdc.ReadFrame()
+	require.NoError(t, err)
+	require.Equal(t, "Pushed", frame.(*synchrophasor.HeaderFrame).Data)
+
+	_, err = mock.WaitCommand(10 * time.Millisecond)
+	require.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestMockPDC(t *testing.T) {
+	pmu := newTestPMU(t)
+	listener := ServePMU(t, pmu)
+
+	pdc, err := DialPDC(listener, 7734)
+	require.NoError(t, err)
+	defer pdc.Close()
+
+	cfg, err := pdc.Handshake()
+	require.NoError(t, err)
+	require.Equal(t, uint16(7734), cfg.IDCode)
+
+	df, err := pdc.NextData()
+	require.NoError(t, err)
+	require.Equal(t, uint16(7734), df.IDCode)
+	require.InDelta(t, 50, cfg.PMUStationList[0].Freq, 1e-3)
+
+	// A server that stops answering fails with ErrTimeout
+	require.NoError(t, pdc.Stop())
+	require.NoError(t, pdc.SendCommand(synchrophasor.CmdCfg3))
+	pdc.Timeout = 50 * time.Millisecond
+	for {
+		_, err = pdc.Next()
+		if err != nil {
+			break
+		}
+	}
+	require.ErrorIs(t, err, ErrTimeout)
+}
+
+// newTestPMU creates a PMU server sending testConfig at 50 Hz
+func newTestPMU(t *testing.T) *synchrophasor.PMU {
+	t.Helper()
+	pmu := synchrophasor.NewPMU()
+	cfg := testConfig()
+	cfg.PMUStationList[0].Freq = 50
+	pmu.SetConfig(cfg)
+	return pmu
+}
+
+func TestFixture(t *testing.T) {
+	cfg := NewConfig(50, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+	})
+	require.Len(t, cfg.PMUStationList, 2)
+	require.Equal(t, "Sub 2", cfg.PMUStationList[1].STN)
+	require.Equal(t, uint16(11), cfg.PMUStationList[1].IDCode)
+
+	cfg.PMUStationList[1].PhasorValues[0] = complex(230, 0)
+	m := Measurements(cfg, 51)
+	require.Equal(t, FrameTime(50, 51).UnixNano(), m.UnixNano())
+	require.Equal(t, time.Unix(FixtureSOC+1, 20000000), FrameTime(50, 51))
+	require.Equal(t, complex(230, 0), m.Stations[1].Phasors[0])
+}
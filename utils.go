@@ -3,11 +3,44 @@ package synchrophasor
 import (
 	"encoding/binary"
 	"io"
+	"math"
 	"strings"
+	"sync"
 )
 
 const _padLength = 16
 
+// _maxFrameSize is the largest frame representable by the 16 bit FRAMESIZE field
+const _maxFrameSize = 65535
+
+// framePool recycles buffers used to pack outgoing frames
+var framePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 1024)
+		return &b
+	},
+}
+
+// readPool recycles buffers large enough to hold any incoming frame
+var readPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, _maxFrameSize+1)
+		return &b
+	},
+}
+
+// getFrameBuffer returns an empty pooled buffer for packing a frame
+func getFrameBuffer() *[]byte {
+	b := framePool.Get().(*[]byte)
+	*b = (*b)[:0]
+	return b
+}
+
+// putFrameBuffer returns a buffer obtained from getFrameBuffer to the pool
+func putFrameBuffer(b *[]byte) {
+	framePool.Put(b)
+}
+
 // padString pads a string to specified length
 func padString(s string) string {
 	if len(s) >= _padLength {
@@ -16,14 +49,21 @@ func padString(s string) string {
 	return s + strings.Repeat(" ", _padLength-len(s))
 }
 
-// writeBinary writes multiple values to a writer using binary.BigEndian
-func writeBinary(w io.Writer, values ...interface{}) error {
-	for _, v := range values {
-		if err := binary.Write(w, binary.BigEndian, v); err != nil {
-			return err
-		}
+// resize returns s with length n, reallocating only if the capacity is too small
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
 	}
-	return nil
+	return s[:n]
+}
+
+// at returns s[i], or the zero value if s is too short
+func at[T any](s []T, i int) T {
+	if i < len(s) {
+		return s[i]
+	}
+	var zero T
+	return zero
 }
 
 // readBinary reads multiple values from a reader using binary.BigEndian
@@ -35,3 +75,70 @@ func readBinary(r io.Reader, values ...interface{}) error {
 	}
 	return nil
 }
+
+// appender is implemented by frames that can encode themselves into a byte slice
+type appender interface {
+	AppendTo(dst []byte) ([]byte, error)
+}
+
+// packTo encodes a frame into a pooled buffer and writes it to w in a single call
+func packTo(w io.Writer, frame appender) (int, error) {
+	buf := getFrameBuffer()
+	defer putFrameBuffer(buf)
+
+	data, err := frame.AppendTo(*buf)
+	if err != nil {
+		return 0, err
+	}
+	*buf = data
+
+	return w.Write(data)
+}
+
+// appendFloat32 appends the big-endian IEEE 754 encoding of v
+func appendFloat32(dst []byte, v float32) []byte {
+	return binary.BigEndian.AppendUint32(dst, math.Float32bits(v))
+}
+
+// frameReader decodes big-endian fields from a frame without reflection. The
+// first out-of-bounds read sets err and all later reads return zero values.
+type frameReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+// next returns the next n bytes or nil if the frame is too short
+func (r *frameReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if r.off+n > len(r.data) {
+		r.err = ErrInvalidSize
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// uint16 reads a big-endian uint16
+func (r *frameReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// uint32 reads a big-endian uint32
+func (r *frameReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// float32 reads a big-endian IEEE 754 float
+func (r *frameReader) float32() float32 {
+	return math.Float32frombits(r.uint32())
+}
@@ -0,0 +1,442 @@
+// Package wsserver streams measurements as JSON over WebSocket to browsers,
+// with per-connection station and channel filtering and rate limiting
+package wsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/gorilla/websocket"
+)
+
+// Options configures a Server
+type Options struct {
+	// MaxRate caps the measurement sets per second sent to a connection,
+	// 0 allows the full rate
+	MaxRate float64
+	// Buffer is the number of measurement sets queued per connection,
+	// defaults to 64. Sets are dropped for connections with a full queue.
+	Buffer int
+	// CheckOrigin decides whether a browser origin may connect, defaults to
+	// allowing the same host only
+	CheckOrigin func(r *http.Request) bool
+	// WriteTimeout bounds every message write, defaults to 10 seconds
+	WriteTimeout time.Duration
+	// PingInterval is the keepalive interval, defaults to 30 seconds. A
+	// connection is closed when no pong arrives within two intervals.
+	PingInterval time.Duration
+}
+
+// Subscription selects what a connection receives. It is read from the query
+// parameters stations, channels and rate (comma-separated lists), and can be
+// replaced at any time by sending it as a JSON text message.
+type Subscription struct {
+	// Stations are ID codes or names, all stations when empty
+	Stations []string `json:"stations"`
+	// Channels are phasor, analog or digital channel names, all channels
+	// when empty. Frequency, ROCOF and STAT are always sent.
+	Channels []string `json:"channels"`
+	// Rate is the maximum number of measurement sets per second, 0 for the
+	// full rate
+	Rate float64 `json:"rate"`
+}
+
+// item is a message queued for a connection
+type item struct {
+	cfg    *synchrophasor.ConfigFrame
+	m      *synchrophasor.Measurements
+	config []byte
+	err    string
+}
+
+// conn is an open WebSocket connection
+type conn struct {
+	ws    *websocket.Conn
+	queue chan item
+	sub   atomic.Pointer[Subscription]
+	done  chan struct{}
+	once  sync.Once
+}
+
+// close stops the writer of the connection
+func (c *conn) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// Server is an http.Handler upgrading requests to WebSocket connections.
+// Every connection first receives the configuration as
+//
+//	{"type":"config","config":{...}}
+//
+// followed by measurement sets as
+//
+//	{"type":"data","time":...,"stations":[{"stn":...,"phasors":[...],...}]}
+//
+// Measurements are passed to Write, typically from a PDC read loop.
+type Server struct {
+	opts     Options
+	upgrader websocket.Upgrader
+	mu       sync.RWMutex
+	cfg      *synchrophasor.ConfigFrame
+	config   []byte
+	conns    map[*conn]struct{}
+	closed   bool
+}
+
+// New creates a server for measurements of the given configuration
+func New(cfg *synchrophasor.ConfigFrame, opts Options) (*Server, error) {
+	if opts.MaxRate < 0 {
+		return nil, fmt.Errorf("%w: negative rate", synchrophasor.ErrInvalidParameter)
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = 30 * time.Second
+	}
+
+	config, err := configMessage(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		opts:     opts,
+		upgrader: websocket.Upgrader{CheckOrigin: opts.CheckOrigin},
+		cfg:      cfg,
+		config:   config,
+		conns:    make(map[*conn]struct{}),
+	}, nil
+}
+
+// configMessage encodes the configuration message
+func configMessage(cfg *synchrophasor.ConfigFrame) ([]byte, error) {
+	return json.Marshal(struct {
+		Type   string                     `json:"type"`
+		Config *synchrophasor.ConfigFrame `json:"config"`
+	}{"config", cfg})
+}
+
+// SetConfig replaces the configuration and sends it to all connections
+func (s *Server) SetConfig(cfg *synchrophasor.ConfigFrame) error {
+	config, err := configMessage(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg, s.config = cfg, config
+	for c := range s.conns {
+		// A connection that cannot take the new configuration would
+		// mislabel every following set
+		select {
+		case c.queue <- item{config: config}:
+		default:
+			c.close()
+		}
+	}
+	return nil
+}
+
+// Write queues a measurement set for all connections
+func (s *Server) Write(m *synchrophasor.Measurements) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(m.Stations) != len(s.cfg.PMUStationList) {
+		return fmt.Errorf("%w: %d stations, configuration has %d",
+			synchrophasor.ErrInvalidParameter, len(m.Stations), len(s.cfg.PMUStationList))
+	}
+	if len(s.conns) == 0 {
+		return nil
+	}
+
+	// Connections encode concurrently, so they share a copy of m
+	it := item{cfg: s.cfg, m: clone(m)}
+	for c := range s.conns {
+		select {
+		case c.queue <- it:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close closes all connections and rejects new ones
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.conns {
+		c.close()
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	sub := &Subscription{
+		Stations: split(query.Get("stations")),
+		Channels: split(query.Get("channels")),
+	}
+	if rate := query.Get("rate"); rate != "" {
+		v, err := strconv.ParseFloat(rate, 64)
+		if err != nil || v < 0 {
+			http.Error(w, "invalid rate", http.StatusBadRequest)
+			return
+		}
+		sub.Rate = v
+	}
+
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		http.Error(w, "server closed", http.StatusServiceUnavailable)
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has replied with an error
+		return
+	}
+
+	c := &conn{ws: ws, queue: make(chan item, s.opts.Buffer), done: make(chan struct{})}
+	c.sub.Store(sub)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = ws.Close()
+		return
+	}
+	c.queue <- item{config: s.config}
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+
+	go s.read(c)
+	s.write(c)
+
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+// read handles subscription updates and pongs until the connection fails
+func (s *Server) read(c *conn) {
+	defer c.close()
+
+	c.ws.SetReadLimit(64 * 1024)
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * s.opts.PingInterval))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(2 * s.opts.PingInterval))
+	})
+
+	for {
+		_, msg, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var sub Subscription
+		if err := json.Unmarshal(msg, &sub); err != nil || sub.Rate < 0 {
+			select {
+			case c.queue <- item{err: "invalid subscription"}:
+			default:
+			}
+			continue
+		}
+		c.sub.Store(&sub)
+	}
+}
+
+// write sends queued messages and pings until the connection is closed
+func (s *Server) write(c *conn) {
+	ping := time.NewTicker(s.opts.PingInterval)
+	defer ping.Stop()
+	defer func() { _ = c.ws.Close() }()
+
+	var (
+		buf  []byte
+		last = math.Inf(-1)
+	)
+	for {
+		select {
+		case it := <-c.queue:
+			var msg []byte
+			switch {
+			case it.config != nil:
+				msg = it.config
+			case it.err != "":
+				msg, _ = json.Marshal(struct {
+					Type  string `json:"type"`
+					Error string `json:"error"`
+				}{"error", it.err})
+			default:
+				sub := c.sub.Load()
+				rate := sub.Rate
+				if s.opts.MaxRate > 0 && (rate == 0 || rate > s.opts.MaxRate) {
+					rate = s.opts.MaxRate
+				}
+				// Allow for jitter of the measurement timestamps
+				if rate > 0 && it.m.Time-last < 0.999/rate {
+					continue
+				}
+				last = it.m.Time
+				buf = appendData(buf[:0], it.cfg, it.m, sub)
+				msg = buf
+			}
+
+			_ = c.ws.SetWriteDeadline(time.Now().Add(s.opts.WriteTimeout))
+			if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.opts.WriteTimeout)); err != nil {
+				return
+			}
+		case <-c.done:
+			_ = c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+			return
+		}
+	}
+}
+
+// phasor is a phasor value in polar form with the angle in degrees
+type phasor struct {
+	Name      string          `json:"name"`
+	Magnitude json.RawMessage `json:"magnitude"`
+	Angle     json.RawMessage `json:"angle"`
+}
+
+// value is a named analog or digital value
+type value struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+// station holds the values of one station
+type station struct {
+	STN       string          `json:"stn"`
+	IDCode    uint16          `json:"id_code"`
+	Stat      uint16          `json:"stat"`
+	Frequency json.RawMessage `json:"frequency"`
+	ROCOF     json.RawMessage `json:"rocof"`
+	Phasors   []phasor        `json:"phasors"`
+	Analog    []value         `json:"analog"`
+	Digital   []value         `json:"digital"`
+}
+
+// appendData appends the data message for the subscribed stations and channels
+func appendData(b []byte, cfg *synchrophasor.ConfigFrame, m *synchrophasor.Measurements, sub *Subscription) []byte {
+	stations := make([]station, 0, len(m.Stations))
+	for i, pmu := range cfg.PMUStationList {
+		name := strings.TrimSpace(pmu.STN)
+		if len(sub.Stations) > 0 && !contains(sub.Stations, name) && !contains(sub.Stations, strconv.Itoa(int(pmu.IDCode))) {
+			continue
+		}
+
+		st := &m.Stations[i]
+		out := station{
+			STN:       name,
+			IDCode:    pmu.IDCode,
+			Stat:      st.Stat,
+			Frequency: number(float64(st.Frequency), 32),
+			ROCOF:     number(float64(st.ROCOF), 32),
+			Phasors:   []phasor{},
+			Analog:    []value{},
+			Digital:   []value{},
+		}
+		for j, v := range st.Phasors {
+			if name := pmu.PhasorName(j); len(sub.Channels) == 0 || contains(sub.Channels, name) {
+				out.Phasors = append(out.Phasors, phasor{
+					Name:      name,
+					Magnitude: number(cmplx.Abs(v), 64),
+					Angle:     number(cmplx.Phase(v)*180/math.Pi, 64),
+				})
+			}
+		}
+		for j, v := range st.Analog {
+			if name := pmu.AnalogName(j); len(sub.Channels) == 0 || contains(sub.Channels, name) {
+				out.Analog = append(out.Analog, value{Name: name, Value: number(float64(v), 32)})
+			}
+		}
+		for j, word := range st.Digital {
+			for k, bit := range word {
+				if name := pmu.DigitalName(j*16 + k); len(sub.Channels) == 0 || contains(sub.Channels, name) {
+					out.Digital = append(out.Digital, value{Name: name, Value: bit})
+				}
+			}
+		}
+		stations = append(stations, out)
+	}
+
+	msg, _ := json.Marshal(struct {
+		Type     string    `json:"type"`
+		Time     float64   `json:"time"`
+		Stations []station `json:"stations"`
+	}{"data", m.Time, stations})
+	return append(b, msg...)
+}
+
+// clone returns a deep copy of m
+func clone(m *synchrophasor.Measurements) *synchrophasor.Measurements {
+	out := &synchrophasor.Measurements{
+		PMUID: m.PMUID, Time: m.Time, Stations: make([]synchrophasor.StationMeasurement, len(m.Stations)),
+	}
+	for i, st := range m.Stations {
+		st.Phasors = append([]complex128(nil), st.Phasors...)
+		st.Analog = append([]float32(nil), st.Analog...)
+		digital := make([][]bool, len(st.Digital))
+		for j, word := range st.Digital {
+			digital[j] = append([]bool(nil), word...)
+		}
+		st.Digital = digital
+		out.Stations[i] = st
+	}
+	return out
+}
+
+// number encodes v in the shortest form of the given bit size, or as null
+// for NaN and infinities, which mark missing data
+func number(v float64, bitSize int) json.RawMessage {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return json.RawMessage("null")
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, bitSize)
+}
+
+// contains reports whether list holds name, ignoring case
+func contains(list []string, name string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// split splits a comma-separated list, dropping empty elements
+func split(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSchlarb/synchrophasor"
+	"github.com/JSchlarb/synchrophasor/testutil"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() *synchrophasor.ConfigFrame {
+	return testutil.NewConfig(10, 2, func(station *synchrophasor.PMUStation) {
+		station.AddPhasor("VA", 1, synchrophasor.PhunitVoltage)
+		station.AddPhasor("VB", 1, synchrophasor.PhunitVoltage)
+		station.AddDigital([]string{"BRK"}, 0, 0xFFFF)
+	})
+}
+
+// message is a decoded server message
+type message struct {
+	Type     string
+	Error    string
+	Time     float64
+	Config   map[string]interface{}
+	Stations []struct {
+		STN     string
+		IDCode  uint16 `json:"id_code"`
+		Phasors []struct{ Name string }
+		Digital []struct{ Name string }
+	}
+}
+
+func read(t *testing.T, ws *websocket.Conn) message {
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg message
+	require.NoError(t, ws.ReadJSON(&msg))
+	return msg
+}
+
+func TestServer(t *testing.T) {
+	cfg := testConfig()
+	srv, err := New(cfg, Options{})
+	require.NoError(t, err)
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	url := "ws" + strings.TrimPrefix(hs.URL, "http") + "/?stations=11&channels=VA&rate=10"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+
+	msg := read(t, ws)
+	require.Equal(t, "config", msg.Type)
+	require.Equal(t, "cfg2", msg.Config["frame"])
+
+	df := synchrophasor.NewDataFrame(cfg)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	for i := 0; i < 3; i++ {
+		m.Time = 1700000000 + 0.05*float64(i)
+		require.NoError(t, srv.Write(&m))
+	}
+
+	// The set in between exceeds the rate
+	for _, want := range []float64{1700000000, 1700000000.1} {
+		msg = read(t, ws)
+		require.Equal(t, "data", msg.Type)
+		require.InDelta(t, want, msg.Time, 1e-6)
+		require.Len(t, msg.Stations, 1)
+		require.Equal(t, "Sub 2", msg.Stations[0].STN)
+		require.Len(t, msg.Stations[0].Phasors, 1)
+		require.Equal(t, "VA", msg.Stations[0].Phasors[0].Name)
+		require.Empty(t, msg.Stations[0].Digital)
+	}
+
+	// A subscription message replaces the filter, an invalid one is reported
+	require.NoError(t, ws.WriteJSON(Subscription{Channels: []string{"brk"}}))
+	require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("{")))
+	msg = read(t, ws)
+	require.Equal(t, "error", msg.Type)
+
+	m.Time += 1
+	require.NoError(t, srv.Write(&m))
+	msg = read(t, ws)
+	require.Len(t, msg.Stations, 2)
+	require.Empty(t, msg.Stations[0].Phasors)
+	require.Equal(t, "BRK", msg.Stations[0].Digital[0].Name)
+
+	require.NoError(t, srv.SetConfig(cfg))
+	require.Equal(t, "config", read(t, ws).Type)
+
+	require.NoError(t, srv.Close())
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, _, err = ws.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.Equal(t, 503, resp.StatusCode)
+}
+
+func TestServerMaxRate(t *testing.T) {
+	cfg := testConfig()
+	srv, err := New(cfg, Options{MaxRate: 1})
+	require.NoError(t, err)
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http")+"?rate=50", nil)
+	require.NoError(t, err)
+	defer func() { _ = ws.Close() }()
+	require.Equal(t, "config", read(t, ws).Type)
+
+	df := synchrophasor.NewDataFrame(cfg)
+	var m synchrophasor.Measurements
+	df.FillMeasurements(&m)
+	for i := 0; i <= 50; i++ {
+		m.Time = 1700000000 + 0.02*float64(i)
+		require.NoError(t, srv.Write(&m))
+	}
+	require.InDelta(t, 1700000000, read(t, ws).Time, 1e-6)
+	require.InDelta(t, 1700000001, read(t, ws).Time, 1e-6)
+
+	require.ErrorIs(t, srv.Write(&synchrophasor.Measurements{}), synchrophasor.ErrInvalidParameter)
+
+	var raw json.RawMessage
+	require.NoError(t, srv.Close())
+	require.Error(t, ws.ReadJSON(&raw))
+}